@@ -474,7 +474,7 @@ ${ISTIO_BIN}/go-junit-report:
 test: racetest ## Runs all unit tests
 
 # For now, keep a minimal subset. This can be expanded in the future.
-BENCH_TARGETS ?= ./pilot/...
+BENCH_TARGETS ?= ./pilot/... ./pkg/security/... ./security/pkg/pki/util/... ./security/pkg/nodeagent/cache/...
 
 .PHONY: racetest
 racetest: $(JUNIT_REPORT)
@@ -0,0 +1,290 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"istio.io/istio/pilot/cmd/pilot-agent/options"
+	"istio.io/istio/pkg/security"
+	pb "istio.io/istio/security/proto/certstatus"
+)
+
+var (
+	certStatusSocket  = options.CertStatusSocket
+	certStatusTimeout = 30 * time.Second
+
+	certsCmd = &cobra.Command{
+		Use:   "certs",
+		Short: "Inspects and renews the certificates managed by the running agent",
+		Long: "Inspects and renews the certificates managed by the running agent, through the socket " +
+			"configured with CERT_STATUS_SOCKET.",
+	}
+
+	certsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the certificates served by the agent, with their expiry and rotation status",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			return withCertStatusClient(func(ctx context.Context, client pb.CertificateStatusClient) error {
+				resp, err := client.GetCertificateStatus(ctx, &pb.GetCertificateStatusRequest{})
+				if err != nil {
+					return err
+				}
+				return writeCertificateList(c.OutOrStdout(), resp.Resources)
+			})
+		},
+	}
+
+	certsInspectCmd = &cobra.Command{
+		Use:   "inspect [<resource>]",
+		Short: "Decodes the certificate chain and root certificates of a resource (default: \"default\")",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return withCertStatusClient(func(ctx context.Context, client pb.CertificateStatusClient) error {
+				resp, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: certResourceName(args)})
+				if err != nil {
+					return err
+				}
+				return writeCertificates(c.OutOrStdout(), resp)
+			})
+		},
+	}
+
+	certsVerifyCmd = &cobra.Command{
+		Use:   "verify [<resource>]",
+		Short: "Verifies the certificate chain of a resource (default: \"default\") against its root certificates",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return withCertStatusClient(func(ctx context.Context, client pb.CertificateStatusClient) error {
+				resp, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: certResourceName(args)})
+				if err != nil {
+					return err
+				}
+				expiry, err := verifyCertificates(resp, time.Now())
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(c.OutOrStdout(), "certificate verified, valid until %v\n", expiry.UTC())
+				return err
+			})
+		},
+	}
+
+	certsRenewCmd = &cobra.Command{
+		Use:   "renew [<resource>]",
+		Short: "Rotates the key and certificate of a resource (default: \"default\") now, regardless of rotation holds",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			name := certResourceName(args)
+			return withCertStatusClient(func(ctx context.Context, client pb.CertificateStatusClient) error {
+				if _, err := client.RenewCertificate(ctx, &pb.RenewCertificateRequest{ResourceName: name}); err != nil {
+					return err
+				}
+				// Generate the new certificate, even if no proxy requests it.
+				if _, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: name}); err != nil {
+					return err
+				}
+				resp, err := client.GetCertificateStatus(ctx, &pb.GetCertificateStatusRequest{ResourceNames: []string{name}})
+				if err != nil {
+					return err
+				}
+				return writeCertificateList(c.OutOrStdout(), resp.Resources)
+			})
+		},
+	}
+)
+
+func certResourceName(args []string) string {
+	if len(args) == 0 {
+		return security.WorkloadKeyCertResourceName
+	}
+	return args[0]
+}
+
+func withCertStatusClient(f func(context.Context, pb.CertificateStatusClient) error) error {
+	if certStatusSocket == "" {
+		return fmt.Errorf("the certificate status socket is not configured, set CERT_STATUS_SOCKET or --socket")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), certStatusTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "unix://"+certStatusSocket, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return fmt.Errorf("failed to connect to the agent on %s: %v", certStatusSocket, err)
+	}
+	defer conn.Close()
+	return f(ctx, pb.NewCertificateStatusClient(conn))
+}
+
+func writeCertificateList(w io.Writer, resources []*pb.ResourceStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tSERIAL\tEXPIRES\tLAST ROTATION\tHELD UNTIL\tLAST ERROR")
+	for _, r := range resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ResourceName, r.SerialNumber, formatTimestamp(r.ExpireTime),
+			formatTimestamp(r.LastRotationTime), formatTimestamp(r.RotationHoldExpireTime), r.LastError)
+	}
+	return tw.Flush()
+}
+
+func formatTimestamp(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return "-"
+	}
+	return t.AsTime().UTC().Format(time.RFC3339)
+}
+
+// writeCertificates writes the decoded certificate chain and root certificates of resp.
+func writeCertificates(w io.Writer, resp *pb.GetCertificateResponse) error {
+	chain, err := parseCertificates(resp.CertificateChain)
+	if err != nil {
+		return fmt.Errorf("invalid certificate chain: %v", err)
+	}
+	roots, err := parseCertificates(resp.RootCert)
+	if err != nil {
+		return fmt.Errorf("invalid root certificates: %v", err)
+	}
+	for i, cert := range chain {
+		title := "Intermediate certificate"
+		if i == 0 {
+			title = "Certificate"
+		}
+		writeCertificate(w, title, cert)
+	}
+	for _, cert := range roots {
+		writeCertificate(w, "Root certificate", cert)
+	}
+	return nil
+}
+
+func writeCertificate(w io.Writer, title string, cert *x509.Certificate) {
+	fmt.Fprintf(w, "%s:\n", title)
+	fmt.Fprintf(w, "  Subject:        %s\n", cert.Subject)
+	fmt.Fprintf(w, "  Issuer:         %s\n", cert.Issuer)
+	fmt.Fprintf(w, "  Serial number:  %s\n", cert.SerialNumber.Text(16))
+	fmt.Fprintf(w, "  Not before:     %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "  Not after:      %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "  Key algorithm:  %s\n", cert.PublicKeyAlgorithm)
+	fmt.Fprintf(w, "  Signature:      %s\n", cert.SignatureAlgorithm)
+	if sans := subjectAltNames(cert); len(sans) > 0 {
+		fmt.Fprintf(w, "  SANs:           %s\n", strings.Join(sans, ", "))
+	}
+	fmt.Fprintf(w, "  CA:             %t\n", cert.IsCA)
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	for _, u := range cert.URIs {
+		sans = append(sans, "URI:"+u.String())
+	}
+	for _, d := range cert.DNSNames {
+		sans = append(sans, "DNS:"+d)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	return sans
+}
+
+// verifyCertificates verifies that the certificate chain of resp chains to its root certificates at
+// now, and returns when the chain expires. For trust bundles, it verifies that the root certificates
+// are valid at now.
+func verifyCertificates(resp *pb.GetCertificateResponse, now time.Time) (time.Time, error) {
+	chain, err := parseCertificates(resp.CertificateChain)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid certificate chain: %v", err)
+	}
+	roots, err := parseCertificates(resp.RootCert)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid root certificates: %v", err)
+	}
+	if len(roots) == 0 {
+		return time.Time{}, fmt.Errorf("no root certificates")
+	}
+	if len(chain) == 0 {
+		var expiry time.Time
+		for _, root := range roots {
+			if now.Before(root.NotBefore) || now.After(root.NotAfter) {
+				return time.Time{}, fmt.Errorf("root certificate %s is not valid at %v", root.Subject, now.UTC())
+			}
+			if expiry.IsZero() || root.NotAfter.Before(expiry) {
+				expiry = root.NotAfter
+			}
+		}
+		return expiry, nil
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range roots {
+		opts.Roots.AddCert(root)
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	verified, err := chain[0].Verify(opts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiry := chain[0].NotAfter
+	for _, cert := range verified[0] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry, nil
+}
+
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func init() {
+	certsCmd.PersistentFlags().StringVar(&certStatusSocket, "socket", certStatusSocket,
+		"The certificate status socket of the agent. Defaults to CERT_STATUS_SOCKET.")
+	certsCmd.PersistentFlags().DurationVar(&certStatusTimeout, "timeout", certStatusTimeout,
+		"The timeout of the requests to the agent.")
+	certsCmd.AddCommand(certsListCmd, certsInspectCmd, certsVerifyCmd, certsRenewCmd)
+	rootCmd.AddCommand(certsCmd)
+}
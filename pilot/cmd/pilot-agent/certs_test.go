@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+	pb "istio.io/istio/security/proto/certstatus"
+)
+
+// testCertificates returns a workload certificate signed by a root, and another root.
+func testCertificates(t *testing.T) (leaf, root, otherRoot []byte) {
+	t.Helper()
+	root, rootKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA: true, IsSelfSigned: true, TTL: 24 * time.Hour, Org: "Root CA", RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := util.ParsePemEncodedCertificate(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := util.ParsePemEncodedKey(rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err = util.GenCertKeyFromOptions(util.CertOptions{
+		Host: "spiffe://cluster.local/ns/foo/sa/bar", TTL: time.Hour, RSAKeySize: 2048,
+		SignerCert: rootCert, SignerPriv: signer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoot, _, err = util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA: true, IsSelfSigned: true, TTL: 24 * time.Hour, Org: "Other CA", RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf, root, otherRoot
+}
+
+func TestWriteCertificates(t *testing.T) {
+	leaf, root, _ := testCertificates(t)
+	var out bytes.Buffer
+	if err := writeCertificates(&out, &pb.GetCertificateResponse{CertificateChain: string(leaf), RootCert: string(root)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Certificate:", "URI:spiffe://cluster.local/ns/foo/sa/bar", "Root certificate:", "O=Root CA"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	leaf, root, otherRoot := testCertificates(t)
+	now := time.Now()
+	expiry, err := verifyCertificates(&pb.GetCertificateResponse{CertificateChain: string(leaf), RootCert: string(root)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiry.After(now.Add(time.Hour)) {
+		t.Fatalf("expected the expiry of the leaf, got %v", expiry)
+	}
+	cases := map[string]struct {
+		resp *pb.GetCertificateResponse
+		now  time.Time
+	}{
+		"untrusted root": {resp: &pb.GetCertificateResponse{CertificateChain: string(leaf), RootCert: string(otherRoot)}, now: now},
+		"expired":        {resp: &pb.GetCertificateResponse{CertificateChain: string(leaf), RootCert: string(root)}, now: now.Add(2 * time.Hour)},
+		"no root":        {resp: &pb.GetCertificateResponse{CertificateChain: string(leaf)}, now: now},
+		"expired root":   {resp: &pb.GetCertificateResponse{RootCert: string(root)}, now: now.Add(48 * time.Hour)},
+	}
+	for name, tc := range cases {
+		if _, err := verifyCertificates(tc.resp, tc.now); err == nil {
+			t.Errorf("%s: expected verification to fail", name)
+		}
+	}
+}
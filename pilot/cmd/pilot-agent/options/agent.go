@@ -52,6 +52,12 @@ func NewAgentOptions(proxy *model.Proxy, cfg *meshconfig.ProxyConfig) *istioagen
 		ProxyNamespace:            PodNamespaceVar.Get(),
 		ProxyDomain:               proxy.DNSDomain,
 		IstiodSAN:                 istiodSAN.Get(),
+		JWKSExportPath:            jwksExportPath,
+		TrustBundleExportDir:      trustBundleExportDir,
+		GatewaySecretName:         gatewaySecretName,
+	}
+	if jwksTrustAnchors != "" {
+		o.JWKSTrustAnchors = strings.Split(jwksTrustAnchors, ",")
 	}
 	extractXDSHeadersFromEnv(o)
 	return o
@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"istio.io/istio/pkg/security"
+	// Registers the credential fetchers of the cloud platforms.
+	_ "istio.io/istio/security/pkg/credentialfetcher"
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+// The credential fetchers configured by their own environment variables. Those of the cloud platforms
+// are registered by the credentialfetcher package.
+func init() {
+	// Any platform can use the exec plugin, running a credential command supplied by the operator, or
+	// the token of a file provisioned by another component.
+	mustRegisterCredFetcherFactory(security.Exec, func(o *security.Options) (security.CredFetcher, error) {
+		command := credExecCommand.Get()
+		if command == "" {
+			return nil, fmt.Errorf("the %s credential fetcher requires CREDENTIAL_EXEC_COMMAND", security.Exec)
+		}
+		return plugin.CreateExecPlugin(command, strings.Fields(credExecArgs.Get()), nil, o.CredIdentityProvider), nil
+	})
+	mustRegisterCredFetcherFactory(security.TokenFile, func(o *security.Options) (security.CredFetcher, error) {
+		path := credTokenFile.Get()
+		if path == "" {
+			return nil, fmt.Errorf("the %s credential fetcher requires CREDENTIAL_TOKEN_FILE", security.TokenFile)
+		}
+		credFetcher, err := plugin.CreateTokenFilePlugin(path, o.CredIdentityProvider)
+		if err != nil {
+			return nil, err
+		}
+		return credFetcher, nil
+	})
+	// Azure VMs can send an Azure AD access token of their managed identity.
+	mustRegisterCredFetcherFactory(security.AzureManagedIdentity, func(o *security.Options) (security.CredFetcher, error) {
+		resource := azureManagedIdentityResource.Get()
+		if resource == "" {
+			return nil, fmt.Errorf("the %s credential fetcher requires AZURE_MANAGED_IDENTITY_RESOURCE", security.AzureManagedIdentity)
+		}
+		return plugin.CreateAzureManagedIdentityPlugin(resource, azureManagedIdentityClientID.Get(), o.CredIdentityProvider), nil
+	})
+	// Workloads of SPIRE send a JWT SVID.
+	mustRegisterCredFetcherFactory(security.SPIRE, func(o *security.Options) (security.CredFetcher, error) {
+		audience := credSPIREAudience.Get()
+		if audience == "" {
+			return nil, fmt.Errorf("the %s credential fetcher requires CREDENTIAL_SPIRE_AUDIENCE", security.SPIRE)
+		}
+		return plugin.CreateSPIREPlugin(credSPIRESocket.Get(), audience, o.CredIdentityProvider), nil
+	})
+	// CI jobs send the OIDC token of their CI system.
+	mustRegisterCredFetcherFactory(security.CIOIDC, func(o *security.Options) (security.CredFetcher, error) {
+		requestURL, requestToken := credCIOIDCRequestURL.Get(), credCIOIDCRequestToken.Get()
+		if requestURL == "" {
+			requestURL, requestToken = os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+		}
+		if requestURL == "" {
+			return nil, fmt.Errorf("the %s credential fetcher requires CREDENTIAL_CI_OIDC_REQUEST_URL or ACTIONS_ID_TOKEN_REQUEST_URL",
+				security.CIOIDC)
+		}
+		return plugin.CreateCIOIDCPlugin(requestURL, requestToken, credCIOIDCAudience.Get(),
+			credCIOIDCTokenField.Get(), o.CredIdentityProvider), nil
+	})
+}
+
+func mustRegisterCredFetcherFactory(name string, factory security.CredFetcherFactory) {
+	if err := security.RegisterCredFetcherFactory(name, factory); err != nil {
+		panic(err)
+	}
+}
@@ -16,7 +16,9 @@ package options
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
@@ -25,8 +27,14 @@ import (
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/jwt"
 	"istio.io/istio/pkg/security"
-	"istio.io/istio/security/pkg/credentialfetcher"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+	"istio.io/istio/security/pkg/nodeagent/kms"
+	"istio.io/istio/security/pkg/nodeagent/plugin/providers/azure/federation"
 	"istio.io/istio/security/pkg/nodeagent/plugin/providers/google/stsclient"
+	"istio.io/istio/security/pkg/nodeagent/plugin/providers/tokenexchange"
+	"istio.io/istio/security/pkg/nodeagent/tpm"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/istio/security/pkg/stsservice/tokenmanager"
 	"istio.io/pkg/log"
 )
@@ -34,11 +42,24 @@ import (
 func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenManagerPlugin string) (*security.Options, error) {
 	o := &security.Options{
 		CAEndpoint:                     caEndpointEnv,
+		CARootCertFallback:             caRootCertFallback,
+		SANPolicy:                      certSANPolicy,
+		SecretStore:                    secretStore,
+		SecretStoreDir:                 secretStoreDir,
+		SecretStoreReuse:               secretStoreReuse,
+		LockKeyMemory:                  lockKeyMemory,
 		CAProviderName:                 caProviderEnv,
 		PilotCertProvider:              features.PilotCertProvider,
 		OutputKeyCertToDir:             outputKeyCertToDir,
+		OutputPKCS12:                   outputCertsPKCS12,
+		OutputJKS:                      outputCertsJKS,
+		KeyStorePassphraseSource:       outputCertsKeyStorePassphrase,
 		ProvCert:                       provCert,
 		WorkloadUDSPath:                filepath.Join(proxyConfig.ConfigPath, "SDS"),
+		WorkloadAPIUDSPath:             workloadAPISocket,
+		SPIREAgentUDSPath:              spireAgentSocket,
+		DelegatedIdentityUDSPath:       delegatedIdentitySocket,
+		CertStatusUDSPath:              CertStatusSocket,
 		ClusterID:                      clusterIDVar.Get(),
 		FileMountedCerts:               fileMountedCertsEnv,
 		WorkloadNamespace:              PodNamespaceVar.Get(),
@@ -47,15 +68,39 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 		TrustDomain:                    trustDomainEnv,
 		Pkcs8Keys:                      pkcs8KeysEnv,
 		ECCSigAlg:                      eccSigAlgEnv,
+		ECCCurve:                       eccCurveEnv,
+		WorkloadRSAKeySize:             workloadRSAKeySizeEnv,
+		PQCSigAlg:                      pqcSigAlgEnv,
 		SecretTTL:                      secretTTLEnv,
 		FileDebounceDuration:           fileDebounceDuration,
+		FileWatcher:                    fileWatcherEnv,
+		FileWatchPollInterval:          fileWatchPollInterval,
 		SecretRotationGracePeriodRatio: secretRotationGracePeriodRatioEnv,
+		SecretRotationJitterRatio:      secretRotationJitterRatioEnv,
+		CSRRateLimit:                   csrRateLimitEnv,
+		CSRBurst:                       csrBurstEnv,
+		NearExpiryThreshold:            nearExpiryThresholdEnv,
+		OptionsReloadFile:              optionsReloadFile,
+		CRLRefreshInterval:             crlRefreshIntervalEnv,
+		OCSPStapling:                   ocspStaplingEnv,
+		ClockSkewThreshold:             clockSkewThresholdEnv,
+		ClockTimeSource:                clockTimeSourceEnv,
 		STSPort:                        stsPort,
 		CertSigner:                     certSigner.Get(),
 	}
 
+	credFetcherType, credIdentity := credFetcherTypeEnv, credIdentityProvider
+	if securityOptionsFile != "" {
+		cfg, err := LoadSecurityConfig(securityOptionsFile)
+		if err != nil {
+			return o, err
+		}
+		cfg.apply(o, &credFetcherType, &credIdentity)
+		log.Infof("loaded security options from %s", securityOptionsFile)
+	}
+
 	o, err := SetupSecurityOptions(proxyConfig, o, jwtPolicy.Get(),
-		credFetcherTypeEnv, credIdentityProvider)
+		credFetcherType, credIdentity)
 	if err != nil {
 		return o, err
 	}
@@ -68,6 +113,98 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 	}
 	o.TokenManager = tokenManager
 
+	if tpmAttestationKey.Get() != "" {
+		o.KeyAttestor, err = tpm.NewAttestor(tpmAttestationKey.Get(), tpmAttestationKeyCert.Get())
+		if err != nil {
+			return o, fmt.Errorf("failed to create TPM key attestor: %v", err)
+		}
+		log.Infof("attesting CSR keys with TPM attestation key %s", tpmAttestationKey.Get())
+		if oid := tpmAttestationCSROID.Get(); oid != "" {
+			if _, err := pkiutil.ParseOID(oid); err != nil {
+				return o, fmt.Errorf("invalid TPM_ATTESTATION_CSR_OID: %v", err)
+			}
+			o.KeyAttestationCSROID = oid
+		}
+	}
+	if tpmSealedStorageKey.Get() != "" {
+		o.KeyProtector = tpm.NewSealedKeyProtector(tpmSealedStorageKey.Get())
+	}
+	if provKeyKMS != "" {
+		if o.ProvCert == "" {
+			return o, fmt.Errorf("invalid options: PROV_KEY_KMS requires PROV_CERT")
+		}
+		if filepath.Clean(o.OutputKeyCertToDir) == filepath.Clean(o.ProvCert) {
+			return o, fmt.Errorf("invalid options: OUTPUT_CERTS cannot overwrite the PROV_CERT certificate of PROV_KEY_KMS")
+		}
+		if o.ProvKeyProvider, err = kms.NewKeyProvider(provKeyKMS); err != nil {
+			return o, err
+		}
+	}
+	if o.OutputPKCS12 || o.OutputJKS {
+		if o.KeyProtector != nil {
+			return o, fmt.Errorf("OUTPUT_CERTS_PKCS12 and OUTPUT_CERTS_JKS cannot be used with TPM_SEALED_STORAGE_KEY")
+		}
+		if !nodeagentutil.ValidPassphraseSource(o.KeyStorePassphraseSource) {
+			return o, fmt.Errorf("invalid OUTPUT_CERTS_KEYSTORE_PASSPHRASE %q, expected file:<path> or env:<variable>",
+				o.KeyStorePassphraseSource)
+		}
+	}
+	if o.OutputFiles, err = outputFileOptions(); err != nil {
+		return o, err
+	}
+	switch o.SecretStore {
+	case security.SecretStoreMemory:
+	case security.SecretStoreDisk:
+		if o.KeyProtector != nil {
+			break
+		}
+		if secretStoreKMSKey == "" {
+			return o, fmt.Errorf("SECRET_STORE %q requires TPM_SEALED_STORAGE_KEY or SECRET_STORE_KMS_KEY", o.SecretStore)
+		}
+		if o.KMS, err = kms.NewGoogleKMS(secretStoreKMSKey); err != nil {
+			return o, err
+		}
+	default:
+		return o, fmt.Errorf("invalid SECRET_STORE %q", o.SecretStore)
+	}
+	if caRootPins != "" {
+		o.CARootPins = strings.Split(caRootPins, ",")
+	}
+	if caRetryMaxEnv < 0 {
+		return o, fmt.Errorf("invalid CA_RETRY_MAX %d", caRetryMaxEnv)
+	}
+	retryCodes, err := security.ParseCARetryCodes(caRetryCodesEnv)
+	if err != nil {
+		return o, fmt.Errorf("invalid CA_RETRY_CODES: %v", err)
+	}
+	o.CARetryPolicy = &security.CARetryPolicy{
+		MaxRetries: uint(caRetryMaxEnv),
+		Backoff:    caRetryBackoffEnv,
+		Codes:      retryCodes,
+	}
+	o.CAKeepaliveInterval = caKeepaliveIntervalEnv
+	o.CAKeepaliveTimeout = caKeepaliveTimeoutEnv
+	o.CARPCTimeout = caRPCTimeoutEnv
+	if egressProxyEnv != "" {
+		if o.EgressProxy, err = security.NewEgressProxy(egressProxyEnv, egressProxyRootCertEnv); err != nil {
+			return o, fmt.Errorf("invalid EGRESS_PROXY: %v", err)
+		}
+		log.Infof("dialing the CA and XDS server through egress proxy %s", o.EgressProxy)
+	}
+	if deniedCertAlgorithms != "" {
+		o.DeniedCertAlgorithms = strings.Split(deniedCertAlgorithms, ",")
+	}
+	if detectClonedIdentity {
+		// The instance ID is filled in by the agent, which discovers the platform.
+		o.MachineBinding = nodeagentutil.CurrentMachineBinding()
+	}
+	if err := o.Validate(); err != nil {
+		return o, err
+	}
+	if o.PQCSigAlg != "" {
+		log.Warnf("using experimental post-quantum %s workload keys", o.PQCSigAlg)
+	}
+
 	return o, err
 }
 
@@ -94,11 +231,16 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 		o.CAEndpointSAN = istiodSAN.Get()
 	}
 
-	// TODO (liminw): CredFetcher is a general interface. In 1.7, we limit the use on GCE only because
-	// GCE is the only supported plugin at the moment.
-	if credFetcherTypeEnv == security.GCE {
+	// The credential fetchers are registered by type: those of the cloud platforms by the
+	// credentialfetcher package, and those with their own configuration in credfetchers.go.
+	if credFetcherTypeEnv != "" {
+		factory, f := security.GetCredFetcherFactory(credFetcherTypeEnv)
+		if !f {
+			return nil, fmt.Errorf("invalid credential fetcher type %s, registered types are %v",
+				credFetcherTypeEnv, security.CredFetcherTypes())
+		}
 		o.CredIdentityProvider = credIdentityProvider
-		credFetcher, err := credentialfetcher.NewCredFetcher(credFetcherTypeEnv, o.TrustDomain, jwtPath, o.CredIdentityProvider)
+		credFetcher, err := factory(o)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create credential fetcher: %v", err)
 		}
@@ -110,12 +252,140 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 		o.CAProviderName = security.GoogleCAProvider
 	}
 	// TODO extract this logic out to a plugin
-	if o.CAProviderName == security.GoogleCAProvider || o.CAProviderName == security.GoogleCASProvider {
-		o.TokenExchanger = stsclient.NewSecureTokenServiceExchanger(o.CredFetcher, o.TrustDomain)
+	exchangers, err := newTokenExchangers(o)
+	if err != nil {
+		return nil, err
 	}
-
-	if o.ProvCert != "" && o.FileMountedCerts {
-		return nil, fmt.Errorf("invalid options: PROV_CERT and FILE_MOUNTED_CERTS are mutually exclusive")
+	if pipeline := tokenExchangePipeline.Get(); pipeline != "" {
+		var stages []caclient.TokenExchangeStage
+		for _, name := range strings.Split(pipeline, ",") {
+			name = strings.TrimSpace(name)
+			exchanger, f := exchangers[name]
+			if !f {
+				return nil, fmt.Errorf("token exchange stage %q of TOKEN_EXCHANGE_PIPELINE is unknown or not configured", name)
+			}
+			stages = append(stages, caclient.TokenExchangeStage{Name: name, Exchanger: exchanger})
+		}
+		log.Infof("exchanging the CA tokens through %s", pipeline)
+		o.TokenExchanger = caclient.NewTokenExchangerChain(stages...)
+		return o, nil
+	}
+	// Without a pipeline, the Google STS is only used for the Google CAs, and the last exchanger
+	// configured is used.
+	if o.CAProviderName != security.GoogleCAProvider && o.CAProviderName != security.GoogleCASProvider {
+		delete(exchangers, tokenExchangeGoogle)
+	}
+	for _, name := range []string{tokenExchangeGoogle, tokenExchangeAzure, tokenExchangeRFC8693} {
+		if exchanger, f := exchangers[name]; f {
+			o.TokenExchanger = caclient.NewCachingTokenExchanger(exchanger, caclient.DefaultExchangedTokenTTL)
+		}
 	}
 	return o, nil
 }
+
+// Names of the token exchange stages of TOKEN_EXCHANGE_PIPELINE.
+const (
+	tokenExchangeGoogle  = "google"
+	tokenExchangeAzure   = "azure"
+	tokenExchangeRFC8693 = "rfc8693"
+)
+
+// newTokenExchangers creates the configured token exchangers, by stage name.
+func newTokenExchangers(o *security.Options) (map[string]security.TokenExchanger, error) {
+	exchangers := map[string]security.TokenExchanger{
+		tokenExchangeGoogle: stsclient.NewSecureTokenServiceExchanger(o.CredFetcher, o.TrustDomain),
+	}
+	if scope := azureTokenScope.Get(); scope != "" {
+		exchanger, err := federation.NewExchanger(federation.Options{
+			TenantID:      azureTenantID.Get(),
+			ClientID:      azureClientID.Get(),
+			Scope:         scope,
+			AuthorityHost: azureAuthorityHost.Get(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the Azure AD token exchanger: %v", err)
+		}
+		exchangers[tokenExchangeAzure] = exchanger
+	}
+	if endpoint := tokenExchangeEndpoint.Get(); endpoint != "" {
+		exchanger, err := newTokenExchanger(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exchangers[tokenExchangeRFC8693] = exchanger
+	}
+	return exchangers, nil
+}
+
+// newTokenExchanger creates the RFC 8693 token exchanger configured by the TOKEN_EXCHANGE_* variables.
+func newTokenExchanger(endpoint string) (*tokenexchange.Exchanger, error) {
+	opts := tokenexchange.Options{
+		Endpoint:   endpoint,
+		Scope:      tokenExchangeScope.Get(),
+		ClientID:   tokenExchangeClientID.Get(),
+		ClientAuth: tokenExchangeClientAuth.Get(),
+	}
+	for _, aud := range strings.Split(tokenExchangeAudience.Get(), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			opts.Audiences = append(opts.Audiences, aud)
+		}
+	}
+	if path := tokenExchangeClientSecretFile.Get(); path != "" {
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the token exchange client secret: %v", err)
+		}
+		opts.ClientSecret = strings.TrimSpace(string(secret))
+	}
+	exchanger, err := tokenexchange.NewExchanger(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the token exchanger: %v", err)
+	}
+	return exchanger, nil
+}
+
+// outputFileOptions parses the permissions and ownership of the files written to OUTPUT_CERTS.
+func outputFileOptions() (security.OutputFileOptions, error) {
+	opts := security.OutputFileOptions{Versioned: outputCertsVersioned}
+	var err error
+	if opts.KeyMode, err = parseFileMode("OUTPUT_CERTS_KEY_MODE", outputCertsKeyMode); err != nil {
+		return opts, err
+	}
+	if opts.CertMode, err = parseFileMode("OUTPUT_CERTS_CERT_MODE", outputCertsCertMode); err != nil {
+		return opts, err
+	}
+	if opts.Umask, err = parseFileMode("OUTPUT_CERTS_UMASK", outputCertsUmask); err != nil {
+		return opts, err
+	}
+	if opts.UID, err = parseFileOwner("OUTPUT_CERTS_UID", outputCertsUID); err != nil {
+		return opts, err
+	}
+	if opts.GID, err = parseFileOwner("OUTPUT_CERTS_GID", outputCertsGID); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// parseFileMode parses the octal permission bits of the variable name, or zero if value is empty.
+func parseFileMode(name, value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid %s %q, expected octal permission bits such as 0640", name, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseFileOwner parses the user or group ID of the variable name, or nil if value is empty.
+func parseFileOwner(name, value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected a numeric ID", name, value)
+	}
+	return &id, nil
+}
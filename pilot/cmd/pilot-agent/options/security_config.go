@@ -0,0 +1,130 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+// SecurityConfigVersion is the version of the format of the SECURITY_OPTIONS_FILE.
+const SecurityConfigVersion = "v1alpha1"
+
+// SecurityConfig is the structured form of the security options of the agent, loaded from the YAML or
+// JSON SECURITY_OPTIONS_FILE so that VM and bare-metal deployments do not need an environment
+// variable per option. Each field sets the option of the environment variable named in its comment,
+// unless that variable is set: the environment takes precedence over the file.
+type SecurityConfig struct {
+	// Version is the version of the format of the file, SecurityConfigVersion.
+	Version string `json:"version"`
+
+	CAEndpoint                     string   `json:"caEndpoint,omitempty"`                     // CA_ADDR
+	CAProvider                     string   `json:"caProvider,omitempty"`                     // CA_PROVIDER
+	CARootPins                     []string `json:"caRootPins,omitempty"`                     // CA_ROOT_PINS
+	TrustDomain                    string   `json:"trustDomain,omitempty"`                    // TRUST_DOMAIN
+	ProvCert                       string   `json:"provCert,omitempty"`                       // PROV_CERT
+	OutputCerts                    string   `json:"outputCerts,omitempty"`                    // OUTPUT_CERTS
+	FileMountedCerts               *bool    `json:"fileMountedCerts,omitempty"`               // FILE_MOUNTED_CERTS
+	CredentialFetcherType          string   `json:"credentialFetcherType,omitempty"`          // CREDENTIAL_FETCHER_TYPE
+	CredentialIdentityProvider     string   `json:"credentialIdentityProvider,omitempty"`     // CREDENTIAL_IDENTITY_PROVIDER
+	SecretTTL                      string   `json:"secretTTL,omitempty"`                      // SECRET_TTL
+	SecretRotationGracePeriodRatio *float64 `json:"secretRotationGracePeriodRatio,omitempty"` // SECRET_GRACE_PERIOD_RATIO
+	SecretStore                    string   `json:"secretStore,omitempty"`                    // SECRET_STORE
+	ECCSignatureAlgorithm          string   `json:"eccSignatureAlgorithm,omitempty"`          // ECC_SIGNATURE_ALGORITHM
+	ECCCurve                       string   `json:"eccCurve,omitempty"`                       // ECC_CURVE
+	WorkloadRSAKeySize             *int     `json:"workloadRSAKeySize,omitempty"`             // WORKLOAD_RSA_KEY_SIZE
+	PKCS8Key                       *bool    `json:"pkcs8Key,omitempty"`                       // PKCS8_KEY
+	CertSANPolicy                  string   `json:"certSANPolicy,omitempty"`                  // CERT_SAN_POLICY
+}
+
+// LoadSecurityConfig reads the SecurityConfig of file, rejecting unknown fields and versions.
+func LoadSecurityConfig(file string) (*SecurityConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read security options file: %v", err)
+	}
+	cfg := &SecurityConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid security options file %s: %v", file, err)
+	}
+	if cfg.Version != SecurityConfigVersion {
+		return nil, fmt.Errorf("invalid security options file %s: unsupported version %q, expected %q",
+			file, cfg.Version, SecurityConfigVersion)
+	}
+	if cfg.SecretTTL != "" {
+		if ttl, err := time.ParseDuration(cfg.SecretTTL); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid security options file %s: invalid secretTTL %q", file, cfg.SecretTTL)
+		}
+	}
+	if r := cfg.SecretRotationGracePeriodRatio; r != nil && (*r < 0 || *r > 1) {
+		return nil, fmt.Errorf("invalid security options file %s: invalid secretRotationGracePeriodRatio %v, "+
+			"expected a ratio between 0 and 1", file, *r)
+	}
+	return cfg, nil
+}
+
+// apply sets the options of cfg whose environment variable is not set in o, credFetcherType and
+// credIdentityProvider.
+func (cfg *SecurityConfig) apply(o *security.Options, credFetcherType, credIdentityProvider *string) {
+	setString := func(env string, dst *string, v string) {
+		if v != "" && !envSet(env) {
+			*dst = v
+		}
+	}
+	setString("CA_ADDR", &o.CAEndpoint, cfg.CAEndpoint)
+	setString("CA_PROVIDER", &o.CAProviderName, cfg.CAProvider)
+	setString("TRUST_DOMAIN", &o.TrustDomain, cfg.TrustDomain)
+	setString("PROV_CERT", &o.ProvCert, cfg.ProvCert)
+	setString("OUTPUT_CERTS", &o.OutputKeyCertToDir, cfg.OutputCerts)
+	setString("CREDENTIAL_FETCHER_TYPE", credFetcherType, cfg.CredentialFetcherType)
+	setString("CREDENTIAL_IDENTITY_PROVIDER", credIdentityProvider, cfg.CredentialIdentityProvider)
+	setString("SECRET_STORE", &o.SecretStore, cfg.SecretStore)
+	setString("ECC_SIGNATURE_ALGORITHM", &o.ECCSigAlg, cfg.ECCSignatureAlgorithm)
+	setString("ECC_CURVE", &o.ECCCurve, cfg.ECCCurve)
+	setString("CERT_SAN_POLICY", &o.SANPolicy, cfg.CertSANPolicy)
+	if len(cfg.CARootPins) > 0 && !envSet("CA_ROOT_PINS") {
+		o.CARootPins = cfg.CARootPins
+	}
+	if cfg.FileMountedCerts != nil && !envSet("FILE_MOUNTED_CERTS") {
+		o.FileMountedCerts = *cfg.FileMountedCerts
+	}
+	if cfg.SecretTTL != "" && !envSet("SECRET_TTL") {
+		// Validated by LoadSecurityConfig.
+		o.SecretTTL, _ = time.ParseDuration(cfg.SecretTTL)
+	}
+	if cfg.SecretRotationGracePeriodRatio != nil && !envSet("SECRET_GRACE_PERIOD_RATIO") {
+		o.SecretRotationGracePeriodRatio = *cfg.SecretRotationGracePeriodRatio
+	}
+	if cfg.WorkloadRSAKeySize != nil && !envSet("WORKLOAD_RSA_KEY_SIZE") {
+		o.WorkloadRSAKeySize = *cfg.WorkloadRSAKeySize
+	}
+	if cfg.PKCS8Key != nil && !envSet("PKCS8_KEY") {
+		o.Pkcs8Keys = *cfg.PKCS8Key
+	}
+}
+
+func envSet(name string) bool {
+	if _, f := os.LookupEnv(name); f {
+		log.Infof("%s is set, ignoring it in the security options file", name)
+		return true
+	}
+	return false
+}
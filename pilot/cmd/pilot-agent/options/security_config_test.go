@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+func writeSecurityConfig(t *testing.T, data string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "security.yaml")
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadSecurityConfig(t *testing.T) {
+	file := writeSecurityConfig(t, `
+version: v1alpha1
+caEndpoint: istiod.example.com:15012
+caRootPins: [sha256:abcd]
+trustDomain: example.com
+credentialFetcherType: AmazonEC2
+secretTTL: 12h
+secretRotationGracePeriodRatio: 0.25
+fileMountedCerts: false
+`)
+	cfg, err := LoadSecurityConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TRUST_DOMAIN", "cluster.local")
+	defer os.Unsetenv("TRUST_DOMAIN")
+	o := &security.Options{TrustDomain: "cluster.local", SecretTTL: 24 * time.Hour}
+	credFetcherType, credIdentityProvider := "", "GoogleComputeEngine"
+	cfg.apply(o, &credFetcherType, &credIdentityProvider)
+	want := &security.Options{
+		CAEndpoint: "istiod.example.com:15012",
+		CARootPins: []string{"sha256:abcd"},
+		// The environment takes precedence over the file.
+		TrustDomain:                    "cluster.local",
+		SecretTTL:                      12 * time.Hour,
+		SecretRotationGracePeriodRatio: 0.25,
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Fatalf("got options %+v, want %+v", o, want)
+	}
+	if credFetcherType != security.AWS || credIdentityProvider != "GoogleComputeEngine" {
+		t.Fatalf("unexpected credential fetcher %s of %s", credFetcherType, credIdentityProvider)
+	}
+}
+
+func TestLoadInvalidSecurityConfig(t *testing.T) {
+	cases := map[string]string{
+		"missing version":     "caEndpoint: istiod:15012",
+		"unsupported version": "version: v2\ncaEndpoint: istiod:15012",
+		"unknown field":       "version: v1alpha1\ncaAddress: istiod:15012",
+		"invalid TTL":         "version: v1alpha1\nsecretTTL: 1 day",
+		"invalid ratio":       "version: v1alpha1\nsecretRotationGracePeriodRatio: 1.5",
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadSecurityConfig(writeSecurityConfig(t, data)); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
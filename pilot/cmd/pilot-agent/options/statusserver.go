@@ -24,15 +24,17 @@ import (
 
 func NewStatusServerOptions(proxy *model.Proxy, proxyConfig *meshconfig.ProxyConfig, agent *istioagent.Agent) *status.Options {
 	return &status.Options{
-		IPv6:           IsIPv6Proxy(proxy.IPAddresses),
-		PodIP:          InstanceIPVar.Get(),
-		AdminPort:      uint16(proxyConfig.ProxyAdminPort),
-		StatusPort:     uint16(proxyConfig.StatusPort),
-		KubeAppProbers: kubeAppProberNameVar.Get(),
-		NodeType:       proxy.Type,
-		Probes:         []ready.Prober{agent},
-		NoEnvoy:        agent.EnvoyDisabled(),
-		FetchDNS:       agent.GetDNSTable,
-		GRPCBootstrap:  agent.GRPCBootstrapPath(),
+		IPv6:             IsIPv6Proxy(proxy.IPAddresses),
+		PodIP:            InstanceIPVar.Get(),
+		AdminPort:        uint16(proxyConfig.ProxyAdminPort),
+		StatusPort:       uint16(proxyConfig.StatusPort),
+		KubeAppProbers:   kubeAppProberNameVar.Get(),
+		NodeType:         proxy.Type,
+		Probes:           []ready.Prober{agent},
+		NoEnvoy:          agent.EnvoyDisabled(),
+		FetchDNS:         agent.GetDNSTable,
+		GRPCBootstrap:    agent.GRPCBootstrapPath(),
+		FetchSecrets:     agent.DumpSecrets,
+		SecretzTokenFile: secretzTokenFile,
 	}
 }
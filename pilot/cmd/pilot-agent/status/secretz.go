@@ -0,0 +1,71 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretzPath serves the state of the secret cache of the agent, to localhost clients presenting the
+// token of the secretz token file as a bearer token.
+const secretzPath = "/debug/secretz"
+
+// writeSecretzToken writes a random token to file, only readable by the user of the agent, and
+// returns it.
+func writeSecretzToken(file string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create directory of secretz token file: %v", err)
+	}
+	if err := os.WriteFile(file, []byte(token), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write secretz token file: %v", err)
+	}
+	// The permission of an existing file is not changed by WriteFile.
+	if err := os.Chmod(file, 0o600); err != nil {
+		return "", fmt.Errorf("failed to restrict %q permission: %v", file, err)
+	}
+	return token, nil
+}
+
+func (s *Server) handleSecretz(w http.ResponseWriter, r *http.Request) {
+	if !isRequestFromLocalhost(r) {
+		http.Error(w, "Only requests from localhost are allowed", http.StatusForbidden)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.secretzToken)) != 1 {
+		http.Error(w, "A valid bearer token is required", http.StatusUnauthorized)
+		return
+	}
+	b, err := json.MarshalIndent(s.fetchSecrets(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
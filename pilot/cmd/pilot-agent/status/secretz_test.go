@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestHandleSecretz(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "proxy", "secretz-token")
+	s, err := NewServer(Options{
+		FetchSecrets: func() []security.SecretDump {
+			return []security.SecretDump{{ResourceName: "default", PrivateKey: security.RedactedPrivateKey}}
+		},
+		SecretzTokenFile: tokenFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the token file to only be readable by its owner, got %v", info.Mode())
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		expected   int
+	}{
+		{
+			name:       "valid token",
+			remoteAddr: "127.0.0.1",
+			token:      string(token),
+			expected:   http.StatusOK,
+		},
+		{
+			name:       "should require a token",
+			remoteAddr: "127.0.0.1",
+			expected:   http.StatusUnauthorized,
+		},
+		{
+			name:       "should require the token of the file",
+			remoteAddr: "[::1]",
+			token:      "foo",
+			expected:   http.StatusUnauthorized,
+		},
+		{
+			name:       "should require localhost",
+			remoteAddr: "10.0.0.1",
+			token:      string(token),
+			expected:   http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, secretzPath, nil)
+			req.RemoteAddr = tt.remoteAddr + ":15020"
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := httptest.NewRecorder()
+			s.handleSecretz(resp, req)
+			if resp.Code != tt.expected {
+				t.Fatalf("Expected response code %v got %v", tt.expected, resp.Code)
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+			var dumps []security.SecretDump
+			if err := json.Unmarshal(resp.Body.Bytes(), &dumps); err != nil {
+				t.Fatal(err)
+			}
+			if len(dumps) != 1 || dumps[0].ResourceName != "default" {
+				t.Fatalf("unexpected secrets %v", dumps)
+			}
+		})
+	}
+}
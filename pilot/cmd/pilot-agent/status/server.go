@@ -50,6 +50,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	dnsProto "istio.io/istio/pkg/dns/proto"
 	"istio.io/istio/pkg/kube/apimirror"
+	"istio.io/istio/pkg/security"
 	"istio.io/pkg/env"
 	"istio.io/pkg/log"
 )
@@ -116,6 +117,10 @@ type Options struct {
 	FetchDNS            func() *dnsProto.NameTable
 	NoEnvoy             bool
 	GRPCBootstrap       string
+	// FetchSecrets returns the state of the secret cache of the agent, served on /debug/secretz with the
+	// token written to SecretzTokenFile. Disabled if either is unset.
+	FetchSecrets     func() []security.SecretDump
+	SecretzTokenFile string
 }
 
 // Server provides an endpoint for handling status probes.
@@ -130,6 +135,8 @@ type Server struct {
 	lastProbeSuccessful   bool
 	envoyStatsPort        int
 	fetchDNS              func() *dnsProto.NameTable
+	fetchSecrets          func() []security.SecretDump
+	secretzToken          string
 	upstreamLocalAddress  *net.TCPAddr
 }
 
@@ -182,6 +189,13 @@ func NewServer(config Options) (*Server, error) {
 	if LegacyLocalhostProbeDestination.Get() {
 		s.appProbersDestination = "localhost"
 	}
+	if config.FetchSecrets != nil && config.SecretzTokenFile != "" {
+		if token, err := writeSecretzToken(config.SecretzTokenFile); err != nil {
+			log.Errorf("disabling %s: %v", secretzPath, err)
+		} else {
+			s.fetchSecrets, s.secretzToken = config.FetchSecrets, token
+		}
+	}
 
 	// Enable prometheus server if its configured and a sidecar
 	// Because port 15020 is exposed in the gateway Services, we cannot safely serve this endpoint
@@ -314,6 +328,9 @@ func (s *Server) Run(ctx context.Context) {
 	mux.HandleFunc("/debug/pprof/symbol", s.handlePprofSymbol)
 	mux.HandleFunc("/debug/pprof/trace", s.handlePprofTrace)
 	mux.HandleFunc("/debug/ndsz", s.handleNdsz)
+	if s.fetchSecrets != nil {
+		mux.HandleFunc(secretzPath, s.handleSecretz)
+	}
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.statusPort))
 	if err != nil {
@@ -17,6 +17,8 @@ package bootstrap
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -42,8 +44,15 @@ import (
 	"istio.io/istio/security/pkg/cmd"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
+	"istio.io/istio/security/pkg/pki/util"
 	caserver "istio.io/istio/security/pkg/server/ca"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/istio/security/pkg/server/ca/authenticate/awsauth"
+	"istio.io/istio/security/pkg/server/ca/authenticate/azureauth"
+	"istio.io/istio/security/pkg/server/ca/authenticate/cloudauth"
+	"istio.io/istio/security/pkg/server/ca/authenticate/enrollment"
+	"istio.io/istio/security/pkg/server/ca/authenticate/oidcauth"
+	"istio.io/istio/security/pkg/server/ca/authenticate/tpmauth"
 	"istio.io/pkg/env"
 	"istio.io/pkg/log"
 )
@@ -98,6 +107,11 @@ var (
 		cmd.DefaultMaxWorkloadCertTTL,
 		"The max TTL of issued workload certificates.")
 
+	issuerExpiryWarning = env.RegisterDurationVar("CITADEL_ISSUER_EXPIRY_WARNING",
+		30*24*time.Hour,
+		"How long before the expiry of the CA certificate, its chain or root istiod starts warning about it. "+
+			"Issued certificates are shortened so that they never outlive their issuer.")
+
 	SelfSignedCACertTTL = env.RegisterDurationVar("CITADEL_SELF_SIGNED_CA_CERT_TTL",
 		cmd.DefaultSelfSignedCACertTTL,
 		"The TTL of self-signed CA root certificate.")
@@ -129,6 +143,71 @@ var (
 	audience = env.RegisterStringVar("AUDIENCE", "",
 		"Expected audience in the tokens. ")
 
+	vmInstanceIdentities = env.RegisterStringVar("VM_INSTANCE_IDENTITIES", "",
+		"JSON map from cloud account (aws/<account ID>, gcp/<project ID> or azure/<subscription ID>) to the "+
+			"<namespace>/<service account> granted to its VMs. If set, VMs can get their first certificate "+
+			"with the signed instance identity document of their cloud platform instead of a bootstrap token.")
+
+	awsIAMIdentities = env.RegisterStringVar("AWS_IAM_IDENTITIES", "",
+		"JSON map from AWS IAM role or user ARN, or ARN prefix ending with '*', to the <namespace>/<service account> "+
+			"granted to it. If set, workloads can get certificates with a GetCallerIdentity request signed with their "+
+			"IAM credentials, sent by the AmazonIAM credential fetcher. The sessions of an assumed role are "+
+			"authenticated as the role.")
+
+	azureADAuthentication = env.RegisterStringVar("AZURE_AD_AUTHENTICATION", "",
+		"JSON configuration of the Azure AD tenant whose access tokens are accepted for CSRs, e.g. of AKS federated "+
+			`workload identities or Azure VM managed identities: {"tenantId": "<tenant>", "audiences": ["api://istiod"], `+
+			`"identities": {"oid:<object ID>": "<namespace>/<service account>", "sub:<subject>": "..."}}.`)
+
+	clientCertTrustDomains = env.RegisterStringVar("CLIENT_CERT_TRUST_DOMAINS", "",
+		"Comma separated trust domains whose SPIFFE IDs are authenticated by client certificate. If set, client "+
+			"certificates with other or non-SPIFFE identities are not authenticated; include the mesh trust domain "+
+			"for workloads to renew their certificates.")
+
+	clientCertPathPrefixes = env.RegisterStringVar("CLIENT_CERT_SPIFFE_PATH_PREFIXES", "",
+		"Comma separated SPIFFE ID path prefixes, e.g. /ns/istio-system, authenticated by client certificate. If "+
+			"set, client certificates with other or non-SPIFFE identities are not authenticated.")
+
+	awsInstanceIdentityCerts = env.RegisterStringVar("AWS_INSTANCE_IDENTITY_CERTIFICATES", "",
+		"Path to the PEM encoded AWS public certificates used to verify EC2 instance identity documents.")
+
+	awsInstanceIdentityMaxAge = env.RegisterDurationVar("AWS_INSTANCE_IDENTITY_MAX_AGE", cloudauth.DefaultAWSInstanceMaxAge,
+		"The maximum time since an EC2 instance was launched or started for its instance identity document to be "+
+			"accepted. The documents do not expire, so VMs must get their first certificate within this time.")
+
+	enableVMEnrollmentTokens = env.RegisterBoolVar("ENABLE_VM_ENROLLMENT_TOKENS", false,
+		"If true, istiod accepts single-use enrollment tokens for the first certificate of a VM. Tokens are "+
+			"minted with 'pilot-discovery request POST /debug/enrollment_token?namespace=<ns>&serviceaccount=<sa>' "+
+			"from inside the istiod container, and placed in the token file of the VM agent.")
+
+	oidcIssuers = env.RegisterStringVar("OIDC_ISSUERS", "",
+		"JSON list of OIDC issuers whose tokens are accepted for CSRs, such as those of CI systems or cloud platforms, "+
+			`e.g. [{"issuer": "https://token.actions.githubusercontent.com", "audiences": ["istio-ca"], "identities": `+
+			`[{"claims": {"repository": "org/app", "ref": "refs/heads/*"}, "identity": "<namespace>/<service account>"}]}]. `+
+			"The keys are discovered from the issuer unless jwksUri is set.")
+
+	authenticationMode = env.RegisterStringVar("AUTHENTICATION_MODE", string(security.AuthenticationFirstSuccess),
+		"How the results of the authenticators of the CA and XDS clients are combined: 'first-success' accepts the "+
+			"caller of the first authenticator succeeding, 'all-required' requires all of them to succeed and accepts "+
+			"their common identities, and 'any' requires one to succeed and accepts the identities of all that do.")
+
+	authnAuditSink = env.RegisterStringVar("AUTHN_AUDIT_SINK", "",
+		"If set, the authentication attempts of the CA and XDS clients are recorded to this sink: 'stdout' for JSON "+
+			"lines on the standard output, file:///<path> for JSON lines appended to a file, or grpc://<host:port> "+
+			"(grpcs:// for TLS) to export them to "+security.AuthnAuditExportMethod+".")
+
+	tpmAttestationIdentities = env.RegisterStringVar("TPM_ATTESTATION_IDENTITIES", "",
+		"JSON map from TPM attestation key (sha256:<hex SubjectPublicKeyInfo digest> or cn:<certificate common name>) "+
+			"to the <namespace>/<service account> granted to the VM holding it. If set, VMs can get their first "+
+			"certificate for a key quoted by their TPM instead of with a bootstrap token.")
+
+	tpmAttestationCACerts = env.RegisterStringVar("TPM_ATTESTATION_CA_CERTIFICATES", "",
+		"Path to the PEM encoded CA certificates trusted to certify TPM attestation keys.")
+
+	tpmAttestationCSROID = env.RegisterStringVar("TPM_ATTESTATION_CSR_OID", "",
+		"If set, TPM attestations are also accepted in the CSR extension with this OID, as added by agents "+
+			"with the same TPM_ATTESTATION_CSR_OID.")
+
 	caRSAKeySize = env.RegisterIntVar("CITADEL_SELF_SIGNED_CA_RSA_KEY_SIZE", 2048,
 		"Specify the RSA key size to use for self-signed Istio CA certificates.")
 
@@ -188,7 +267,7 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 		// Add a custom authenticator using standard JWT validation, if not running in K8S
 		// When running inside K8S - we can use the built-in validator, which also check pod removal (invalidation).
 		jwtRule := v1beta1.JWTRule{Issuer: iss, Audiences: []string{aud}}
-		oidcAuth, err := authenticate.NewJwtAuthenticator(&jwtRule, opts.TrustDomain)
+		oidcAuth, err := authenticate.NewJwtAuthenticator(&jwtRule, opts.TrustDomain, false)
 		if err == nil {
 			caServer.Authenticators = append(caServer.Authenticators, oidcAuth)
 			log.Info("Using out-of-cluster JWT authentication")
@@ -197,11 +276,190 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 		}
 	}
 
+	if vmInstanceIdentities.Get() != "" {
+		iidAuth, err := newInstanceIdentityAuthenticator(opts.TrustDomain)
+		if err != nil {
+			log.Errorf("failed to create instance identity authenticator: %v", err)
+		} else {
+			caServer.Authenticators = append(caServer.Authenticators, iidAuth)
+			log.Info("Using cloud instance identity authentication for VMs")
+		}
+	}
+
+	if awsIAMIdentities.Get() != "" {
+		iamAuth, err := newAWSIAMAuthenticator(opts.TrustDomain)
+		if err != nil {
+			log.Errorf("failed to create AWS IAM authenticator: %v", err)
+		} else {
+			caServer.Authenticators = append(caServer.Authenticators, iamAuth)
+			log.Info("Using AWS IAM authentication")
+		}
+	}
+
+	if azureADAuthentication.Get() != "" {
+		azureAuth, err := newAzureADAuthenticator(opts.TrustDomain)
+		if err != nil {
+			log.Errorf("failed to create Azure AD authenticator: %v", err)
+		} else {
+			caServer.Authenticators = append(caServer.Authenticators, azureAuth)
+			log.Info("Using Azure AD authentication")
+		}
+	}
+
+	if tpmAttestationIdentities.Get() != "" {
+		tpmAuth, err := newTPMAuthenticator(opts.TrustDomain)
+		if err != nil {
+			log.Errorf("failed to create TPM authenticator: %v", err)
+		} else {
+			caServer.Authenticators = append(caServer.Authenticators, tpmAuth)
+			log.Info("Using TPM attestation authentication for VMs")
+		}
+	}
+
+	if enableVMEnrollmentTokens.Get() {
+		// The CA key is shared by all replicas, so a token minted by one can be used with any.
+		_, caKey, _, _ := ca.GetCAKeyCertBundle().GetAllPem()
+		// The spent nonces are shared through the cluster for the tokens to be single-use across replicas.
+		var nonces enrollment.NonceStore
+		if s.kubeClient != nil {
+			nonces = enrollment.NewKubeNonceStore(s.kubeClient.Kube(), opts.Namespace)
+		}
+		enrollAuth, err := enrollment.NewAuthenticator(opts.TrustDomain, caKey, nonces)
+		if err != nil {
+			log.Errorf("failed to create enrollment token authenticator: %v", err)
+		} else {
+			caServer.Authenticators = append(caServer.Authenticators, enrollAuth)
+			s.monitoringMux.Handle("/debug/enrollment_token", enrollAuth)
+			log.Info("Using enrollment token authentication for VMs")
+		}
+	}
+
+	if oidcIssuers.Get() != "" {
+		oidcAuths, err := newOIDCAuthenticators(opts.TrustDomain)
+		if err != nil {
+			log.Errorf("failed to create OIDC authenticators: %v", err)
+		} else {
+			for _, a := range oidcAuths {
+				caServer.Authenticators = append(caServer.Authenticators, a)
+			}
+			log.Infof("Using OIDC authentication for %d issuers", len(oidcAuths))
+		}
+	}
+
+	caServer.Authenticators = security.AuditAuthenticators(caServer.Authenticators, s.authnAuditSink)
+	caServer.AuthenticationMode = s.authenticationMode
+	caServer.Authorizer = s.Authorizer
 	caServer.Register(grpc)
 
 	log.Info("Istiod CA has started")
 }
 
+// newInstanceIdentityAuthenticator creates the authenticator for VMs presenting a cloud instance
+// identity document, configured by VM_INSTANCE_IDENTITIES and AWS_INSTANCE_IDENTITY_CERTIFICATES.
+func newInstanceIdentityAuthenticator(trustDomain string) (*cloudauth.InstanceIdentityAuthenticator, error) {
+	opts := cloudauth.Options{TrustDomain: trustDomain, AWSInstanceMaxAge: awsInstanceIdentityMaxAge.Get()}
+	if err := json.Unmarshal([]byte(vmInstanceIdentities.Get()), &opts.Identities); err != nil {
+		return nil, fmt.Errorf("invalid VM_INSTANCE_IDENTITIES: %v", err)
+	}
+	if certFile := awsInstanceIdentityCerts.Get(); certFile != "" {
+		certBytes, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read AWS certificates: %v", err)
+		}
+		if opts.AWSCertificates, err = util.ParsePemEncodedCertificateChain(certBytes); err != nil {
+			return nil, fmt.Errorf("failed to parse AWS certificates: %v", err)
+		}
+	}
+	return cloudauth.NewInstanceIdentityAuthenticator(opts)
+}
+
+// newOIDCAuthenticators creates the authenticators of the OIDC issuers configured by OIDC_ISSUERS.
+func newOIDCAuthenticators(trustDomain string) ([]*oidcauth.OIDCAuthenticator, error) {
+	var issuers []oidcauth.Options
+	if err := json.Unmarshal([]byte(oidcIssuers.Get()), &issuers); err != nil {
+		return nil, fmt.Errorf("invalid OIDC_ISSUERS: %v", err)
+	}
+	authenticators := make([]*oidcauth.OIDCAuthenticator, 0, len(issuers))
+	for _, opts := range issuers {
+		opts.TrustDomain = trustDomain
+		a, err := oidcauth.NewOIDCAuthenticator(opts)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	return authenticators, nil
+}
+
+// newAWSIAMAuthenticator creates the authenticator for workloads presenting a GetCallerIdentity request
+// signed with their AWS IAM credentials, configured by AWS_IAM_IDENTITIES.
+func newAWSIAMAuthenticator(trustDomain string) (*awsauth.AWSIAMAuthenticator, error) {
+	opts := awsauth.Options{TrustDomain: trustDomain}
+	if err := json.Unmarshal([]byte(awsIAMIdentities.Get()), &opts.Identities); err != nil {
+		return nil, fmt.Errorf("invalid AWS_IAM_IDENTITIES: %v", err)
+	}
+	return awsauth.NewAWSIAMAuthenticator(opts)
+}
+
+// newClientCertAuthenticator creates the authenticator of client certificates, restricted to the SPIFFE IDs
+// allowed by CLIENT_CERT_TRUST_DOMAINS and CLIENT_CERT_SPIFFE_PATH_PREFIXES.
+func newClientCertAuthenticator() *authenticate.ClientCertAuthenticator {
+	return &authenticate.ClientCertAuthenticator{
+		TrustDomains: splitList(clientCertTrustDomains.Get()),
+		PathPrefixes: splitList(clientCertPathPrefixes.Get()),
+	}
+}
+
+// splitList splits a comma separated list, ignoring empty elements.
+func splitList(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// newAzureADAuthenticator creates the authenticator for workloads presenting an Azure AD access token,
+// configured by AZURE_AD_AUTHENTICATION.
+func newAzureADAuthenticator(trustDomain string) (*azureauth.AzureADAuthenticator, error) {
+	opts := azureauth.Options{}
+	if err := json.Unmarshal([]byte(azureADAuthentication.Get()), &opts); err != nil {
+		return nil, fmt.Errorf("invalid AZURE_AD_AUTHENTICATION: %v", err)
+	}
+	opts.TrustDomain = trustDomain
+	return azureauth.NewAzureADAuthenticator(opts)
+}
+
+// newTPMAuthenticator creates the authenticator for VMs presenting a TPM attestation of their CSR key,
+// configured by TPM_ATTESTATION_IDENTITIES, TPM_ATTESTATION_CA_CERTIFICATES and TPM_ATTESTATION_CSR_OID.
+func newTPMAuthenticator(trustDomain string) (*tpmauth.TPMAuthenticator, error) {
+	identities := map[string]string{}
+	if err := json.Unmarshal([]byte(tpmAttestationIdentities.Get()), &identities); err != nil {
+		return nil, fmt.Errorf("invalid TPM_ATTESTATION_IDENTITIES: %v", err)
+	}
+	var roots *x509.CertPool
+	if certFile := tpmAttestationCACerts.Get(); certFile != "" {
+		certBytes, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TPM attestation CA certificates: %v", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(certBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", certFile)
+		}
+	}
+	var csrOID asn1.ObjectIdentifier
+	if oid := tpmAttestationCSROID.Get(); oid != "" {
+		var err error
+		if csrOID, err = util.ParseOID(oid); err != nil {
+			return nil, fmt.Errorf("invalid TPM_ATTESTATION_CSR_OID: %v", err)
+		}
+	}
+	return tpmauth.NewTPMAuthenticator(trustDomain, roots, identities, csrOID)
+}
+
 // detectAuthEnv will use the JWT token that is mounted in istiod to set the default audience
 // and trust domain for Istiod, if not explicitly defined.
 // K8S will use the same kind of tokens for the pods, and the value in istiod's own token is
@@ -447,6 +705,7 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 			s.initCACertsWatcher()
 		}
 	}
+	caOpts.IssuerExpiryWarning = issuerExpiryWarning.Get()
 	istioCA, err := ca.NewIstioCA(caOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
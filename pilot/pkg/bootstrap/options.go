@@ -64,6 +64,8 @@ type PilotArgs struct {
 	KeepaliveOptions   *keepalive.Options
 	ShutdownDuration   time.Duration
 	JwtRule            string
+	// JwtRuleAcceptsJWTSVID is whether the issuer of JwtRule also issues JWT SVIDs of the workloads.
+	JwtRuleAcceptsJWTSVID bool
 }
 
 // DiscoveryServerOptions contains options for create a new discovery server instance.
@@ -116,6 +118,9 @@ var (
 	PodName      = env.RegisterStringVar("POD_NAME", "", "").Get()
 	JwtRule      = env.RegisterStringVar("JWT_RULE", "",
 		"The JWT rule used by istiod authentication").Get()
+	JwtRuleAcceptsJWTSVID = env.RegisterBoolVar("JWT_RULE_ACCEPT_JWT_SVID", false,
+		"If enabled, the issuer of JWT_RULE is trusted to issue JWT SVIDs, e.g. as a SPIRE server, and the tokens "+
+			"whose subject is the SPIFFE ID of a service account of the trust domain authenticate that identity.").Get()
 )
 
 // Revision is the value of the Istio control plane revision, e.g. "canary",
@@ -150,6 +155,7 @@ func (p *PilotArgs) applyDefaults() {
 	p.PodName = PodName
 	p.Revision = Revision
 	p.JwtRule = JwtRule
+	p.JwtRuleAcceptsJWTSVID = JwtRuleAcceptsJWTSVID
 	p.KeepaliveOptions = keepalive.DefaultOption()
 	p.RegistryOptions.DistributionTrackingEnabled = features.EnableDistributionTracking
 	p.RegistryOptions.DistributionCacheRetention = features.DistributionHistoryRetention
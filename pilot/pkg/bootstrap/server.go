@@ -182,6 +182,13 @@ type Server struct {
 	internalStop chan struct{}
 
 	statusReporter *status.Reporter
+	// authnAuditSink records the authentication attempts of the CA and XDS clients, if set.
+	authnAuditSink security.AuthnAuditSink
+	// authenticationMode is how the results of the CA and XDS authenticators are combined.
+	authenticationMode security.AuthenticationMode
+	// Authorizer, if set, authorizes the certificates issued by the CA and the secrets sent with SDS
+	// to authenticated callers. It is set by the initFuncs of NewServer.
+	Authorizer security.Authorizer
 	// RWConfigStore is the configstore which allows updates, particularly for status.
 	RWConfigStore model.ConfigStoreCache
 }
@@ -265,6 +272,11 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	}
 
 	s.XDSServer.InitGenerators(e, args.Namespace)
+	if s.kubeClient != nil {
+		if err := s.XDSServer.SharePCDSRollout(s.kubeClient.Kube(), args.Namespace); err != nil {
+			log.Warnf("failed to load the PCDS rollout in progress: %v", err)
+		}
+	}
 
 	// Initialize workloadTrustBundle after CA has been initialized
 	if err := s.initWorkloadTrustBundle(args); err != nil {
@@ -318,11 +330,19 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 
 	s.initSDSServer(args)
 
+	if s.authenticationMode, err = security.ParseAuthenticationMode(authenticationMode.Get()); err != nil {
+		return nil, err
+	}
+	if sink := authnAuditSink.Get(); sink != "" {
+		if s.authnAuditSink, err = security.NewAuthnAuditSink(sink); err != nil {
+			return nil, fmt.Errorf("error initializing the authentication audit sink: %v", err)
+		}
+	}
 	// Notice that the order of authenticators matters, since at runtime
 	// authenticators are activated sequentially and the first successful attempt
 	// is used as the authentication result.
 	authenticators := []security.Authenticator{
-		&authenticate.ClientCertAuthenticator{},
+		newClientCertAuthenticator(),
 	}
 	if args.JwtRule != "" {
 		jwtAuthn, err := initOIDC(args, s.environment.Mesh().TrustDomain)
@@ -338,8 +358,10 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	// so we build it later.
 	authenticators = append(authenticators,
 		kubeauth.NewKubeJWTAuthenticator(s.environment.Watcher, s.kubeClient, s.clusterID, s.multicluster.GetRemoteKubeClient, features.JwtPolicy))
+	authenticators = security.AuditAuthenticators(authenticators, s.authnAuditSink)
 	if features.XDSAuth {
 		s.XDSServer.Authenticators = authenticators
+		s.XDSServer.AuthenticationMode = s.authenticationMode
 	}
 	caOpts.Authenticators = authenticators
 
@@ -376,7 +398,7 @@ func initOIDC(args *PilotArgs, trustDomain string) (security.Authenticator, erro
 		return nil, fmt.Errorf("failed to unmarshal JWT rule: %v", err)
 	}
 	log.Infof("Istiod authenticating using JWTRule: %v", jwtRule)
-	jwtAuthn, err := authenticate.NewJwtAuthenticator(&jwtRule, trustDomain)
+	jwtAuthn, err := authenticate.NewJwtAuthenticator(&jwtRule, trustDomain, args.JwtRuleAcceptsJWTSVID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create the JWT authenticator: %v", err)
 	}
@@ -535,7 +557,9 @@ func (s *Server) initSDSServer(args *PilotArgs) {
 						Reason: []model.TriggerReason{model.SecretTrigger},
 					})
 				})
-				s.XDSServer.Generators[v3.SecretType] = xds.NewSecretGen(sc, s.XDSServer.Cache, s.clusterID)
+				secretGen := xds.NewSecretGen(sc, s.XDSServer.Cache, s.clusterID)
+				secretGen.Authorizer = s.Authorizer
+				s.XDSServer.Generators[v3.SecretType] = secretGen
 				s.secretsController = sc
 				return nil
 			})
@@ -500,6 +500,15 @@ var (
 	MultiRootMesh = env.RegisterBoolVar("ISTIO_MULTIROOT_MESH", false,
 		"If enabled, mesh will support certificates signed by more than one trustAnchor for ISTIO_MUTUAL mTLS").Get()
 
+	PCDSCanarySelector = env.RegisterStringVar("PILOT_PCDS_CANARY_SELECTOR", "",
+		"If set, changes of the trust bundle and identity policy pushed by PCDS are first rolled out to the proxies "+
+			"with these labels (k1=v1,k2=v2), and to the others once the canaries adopted them without rejection, or "+
+			"after PILOT_PCDS_CANARY_SOAK_TIME if no canary was connected. The rollouts are shared by the istiod replicas.").Get()
+
+	PCDSCanarySoakTime = env.RegisterDurationVar("PILOT_PCDS_CANARY_SOAK_TIME", 10*time.Minute,
+		"The minimum time a PCDS rollout stays on the canary proxies selected by PILOT_PCDS_CANARY_SELECTOR "+
+			"before it is promoted to all proxies.").Get()
+
 	EnableEnvoyFilterMetrics = env.RegisterBoolVar("PILOT_ENVOY_FILTER_STATS", false,
 		"If true, Pilot will collect metrics for envoy filter operations.").Get()
 
@@ -63,9 +63,11 @@ func ServerOptions(options *istiokeepalive.Options, interceptors ...grpc.UnarySe
 		grpc.MaxConcurrentStreams(uint32(maxStreams)),
 		grpc.MaxRecvMsgSize(maxRecvMsgSize),
 		// Ensure we allow clients sufficient ability to send keep alives. If this is higher than client
-		// keep alive setting, it will prematurely get a GOAWAY sent.
+		// keep alive setting, it will prematurely get a GOAWAY sent. Pings are permitted without
+		// streams, as sent by agents keeping their mostly idle CA connections open.
 		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-			MinTime: options.Time / 2,
+			MinTime:             options.Time / 2,
+			PermitWithoutStream: true,
 		}),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			Time:                  options.Time,
@@ -574,6 +574,9 @@ type NodeMetadata struct {
 	TLSClientKey string `json:"TLS_CLIENT_KEY,omitempty"`
 	// TLSClientRootCert is the absolute path to client root cert file
 	TLSClientRootCert string `json:"TLS_CLIENT_ROOT_CERT,omitempty"`
+	// DualAlgorithmCerts, if true, makes the proxy present both an ECDSA and an RSA workload certificate
+	// on its servers, so that clients supporting only RSA can connect while ECDSA is preferred.
+	DualAlgorithmCerts StringBool `json:"DUAL_ALGORITHM_CERTS,omitempty"`
 
 	CertBaseDir string `json:"BASE,omitempty"`
 
@@ -19,6 +19,7 @@ import (
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	networking "istio.io/api/networking/v1alpha3"
@@ -35,6 +36,11 @@ const (
 	// SDSDefaultResourceName is the default name in sdsconfig, used for fetching normal key/cert.
 	SDSDefaultResourceName = "default"
 
+	// SDSDefaultRSAResourceName and SDSDefaultECDSAResourceName are the names in sdsconfig used for
+	// fetching the normal key/cert with an RSA and an ECDSA key respectively.
+	SDSDefaultRSAResourceName   = "default-rsa"
+	SDSDefaultECDSAResourceName = "default-ecdsa"
+
 	// SDSRootResourceName is the sdsconfig name for root CA, used for fetching root cert.
 	SDSRootResourceName = "ROOTCA"
 
@@ -109,7 +115,9 @@ var (
 			InitialFetchTimeout: durationpb.New(time.Second * 0),
 		},
 	}
-	rootSDSConfig = &tls.SdsSecretConfig{
+	defaultRSASDSConfig   = withSdsSecretName(defaultSDSConfig, SDSDefaultRSAResourceName)
+	defaultECDSASDSConfig = withSdsSecretName(defaultSDSConfig, SDSDefaultECDSAResourceName)
+	rootSDSConfig         = &tls.SdsSecretConfig{
 		Name: SDSRootResourceName,
 		SdsConfig: &core.ConfigSource{
 			ConfigSourceSpecifier: &core.ConfigSource_ApiConfigSource{
@@ -144,6 +152,12 @@ func ConstructSdsSecretConfig(name string) *tls.SdsSecretConfig {
 	if name == SDSRootResourceName {
 		return rootSDSConfig
 	}
+	if name == SDSDefaultRSAResourceName {
+		return defaultRSASDSConfig
+	}
+	if name == SDSDefaultECDSAResourceName {
+		return defaultECDSASDSConfig
+	}
 
 	cfg := &tls.SdsSecretConfig{
 		Name: name,
@@ -169,6 +183,12 @@ func ConstructSdsSecretConfig(name string) *tls.SdsSecretConfig {
 	return cfg
 }
 
+func withSdsSecretName(cfg *tls.SdsSecretConfig, name string) *tls.SdsSecretConfig {
+	ret := proto.Clone(cfg).(*tls.SdsSecretConfig)
+	ret.Name = name
+	return ret
+}
+
 func appendURIPrefixToTrustDomain(trustDomainAliases []string) []string {
 	var res []string
 	for _, td := range trustDomainAliases {
@@ -205,6 +225,14 @@ func ApplyToCommonTLSContext(tlsContext *tls.CommonTlsContext, proxy *model.Prox
 			},
 		}
 	}
+	if res.GetResourceName() == "" && proxy.Metadata.DualAlgorithmCerts {
+		// Envoy presents the first certificate matching the key types supported by the client.
+		tlsContext.TlsCertificateSdsSecretConfigs = []*tls.SdsSecretConfig{
+			ConstructSdsSecretConfig(SDSDefaultECDSAResourceName),
+			ConstructSdsSecretConfig(SDSDefaultRSAResourceName),
+		}
+		return
+	}
 	tlsContext.TlsCertificateSdsSecretConfigs = []*tls.SdsSecretConfig{
 		ConstructSdsSecretConfig(model.GetOrDefault(res.GetResourceName(), SDSDefaultResourceName)),
 	}
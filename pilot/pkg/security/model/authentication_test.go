@@ -430,3 +430,29 @@ func TestApplyToCommonTLSContext(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyToCommonTLSContextDualAlgorithm(t *testing.T) {
+	tlsContext := &auth.CommonTlsContext{}
+	proxy := &model.Proxy{Metadata: &model.NodeMetadata{DualAlgorithmCerts: true}}
+	ApplyToCommonTLSContext(tlsContext, proxy, []string{}, []string{}, true)
+
+	got := tlsContext.TlsCertificateSdsSecretConfigs
+	if len(got) != 2 || got[0].Name != SDSDefaultECDSAResourceName || got[1].Name != SDSDefaultRSAResourceName {
+		t.Fatalf("expected ECDSA and RSA certificates, got %v", got)
+	}
+	for _, cfg := range got {
+		// The certificates are fetched like the default certificate.
+		if !cmp.Equal(cfg.SdsConfig, ConstructSdsSecretConfig(SDSDefaultResourceName).SdsConfig, protocmp.Transform()) {
+			t.Errorf("unexpected SDS config for %s: %v", cfg.Name, cfg.SdsConfig)
+		}
+	}
+
+	// Certificates mounted in the proxy are used as is.
+	proxy.Metadata.TLSServerCertChain = "/cert-chain.pem"
+	proxy.Metadata.TLSServerKey = "/key.pem"
+	tlsContext = &auth.CommonTlsContext{}
+	ApplyToCommonTLSContext(tlsContext, proxy, []string{}, []string{}, true)
+	if got := tlsContext.TlsCertificateSdsSecretConfigs; len(got) != 1 {
+		t.Fatalf("expected the mounted certificate only, got %v", got)
+	}
+}
@@ -15,6 +15,7 @@
 package xds
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -355,6 +356,9 @@ func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.Disc
 		if s.StatusGen != nil {
 			s.StatusGen.OnNack(con.proxy, request)
 		}
+		if request.TypeUrl == v3.ProxyConfigType {
+			s.pcdsRollout.onNack(con.proxy.ID, request.ErrorDetail.GetMessage())
+		}
 		con.proxy.Lock()
 		if w, f := con.proxy.WatchedResources[request.TypeUrl]; f {
 			w.NonceNacked = request.ResponseNonce
@@ -419,6 +423,9 @@ func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.Disc
 	con.proxy.WatchedResources[request.TypeUrl].ResourceNames = request.ResourceNames
 	con.proxy.WatchedResources[request.TypeUrl].LastRequest = request
 	con.proxy.Unlock()
+	if request.TypeUrl == v3.ProxyConfigType {
+		s.pcdsRollout.onAck(con.proxy.ID)
+	}
 
 	// Envoy can send two DiscoveryRequests with same version and nonce
 	// when it detects a new resource. We should respond if they change.
@@ -1016,3 +1023,18 @@ func (conn *Connection) Watched(typeUrl string) *model.WatchedResource {
 func (conn *Connection) Stop() {
 	conn.stop <- struct{}{}
 }
+
+// Proxy returns the proxy of the connection. It is only set once the connection is initialized, see
+// DiscoveryServer.Clients.
+func (conn *Connection) Proxy() *model.Proxy {
+	return conn.proxy
+}
+
+// Context returns the context of the stream of the connection, which is done once the client
+// disconnects.
+func (conn *Connection) Context() context.Context {
+	if conn.deltaStream != nil {
+		return conn.deltaStream.Context()
+	}
+	return conn.stream.Context()
+}
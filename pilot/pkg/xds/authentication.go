@@ -17,13 +17,12 @@ package xds
 import (
 	"context"
 	"errors"
-	"fmt"
-	"strings"
 
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
 
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pkg/security"
 	"istio.io/pkg/env"
 )
 
@@ -52,16 +51,14 @@ func (s *DiscoveryServer) authenticate(ctx context.Context) ([]string, error) {
 	if _, ok := peerInfo.AuthInfo.(credentials.TLSInfo); !ok && !AuthPlaintext {
 		return nil, nil
 	}
-	authFailMsgs := []string{}
-	for _, authn := range s.Authenticators {
-		u, err := authn.Authenticate(ctx)
-		// If one authenticator passes, return
-		if u != nil && u.Identities != nil && err == nil {
-			return u.Identities, nil
-		}
-		authFailMsgs = append(authFailMsgs, fmt.Sprintf("Authenticator %s: %v", authn.AuthenticatorType(), err))
+	u, err := security.NewMultiAuthenticator(s.AuthenticationMode, s.Authenticators...).Authenticate(ctx)
+	if err == nil && u.Identities != nil {
+		return u.Identities, nil
+	}
+	if err == nil {
+		err = errors.New("no identity authenticated")
 	}
 
-	log.Errorf("Failed to authenticate client from %s: %s", peerInfo.Addr.String(), strings.Join(authFailMsgs, "; "))
+	log.Errorf("Failed to authenticate client from %s: %v", peerInfo.Addr.String(), err)
 	return nil, errors.New("authentication failure")
 }
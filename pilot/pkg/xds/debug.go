@@ -205,6 +205,7 @@ func (s *DiscoveryServer) AddDebugHandlers(mux, internalMux *http.ServeMux, enab
 	s.addDebugHandler(mux, internalMux, "/debug/networkz", "List cross-network gateways", s.networkz)
 	s.addDebugHandler(mux, internalMux, "/debug/exportz", "List endpoints that have been exported via MCS", s.exportz)
 	s.addDebugHandler(mux, internalMux, "/debug/importz", "List services that have been imported via MCS", s.importz)
+	s.addDebugHandler(mux, internalMux, "/debug/pcds_rollout", "Status of the staged rollout of the proxy config pushed by PCDS", s.pcdsRolloutz)
 
 	s.addDebugHandler(mux, internalMux, "/debug/list", "List all supported debug commands in json", s.List)
 }
@@ -875,6 +876,14 @@ func (s *DiscoveryServer) exportz(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, jsonMap)
 }
 
+func (s *DiscoveryServer) pcdsRolloutz(w http.ResponseWriter, _ *http.Request) {
+	if s.pcdsRollout == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.pcdsRollout.status())
+}
+
 func (s *DiscoveryServer) importz(w http.ResponseWriter, _ *http.Request) {
 	jsonMap := make(map[cluster.ID][]string)
 	svcs := sortClusterServices(s.Env.ImportedServices())
@@ -338,6 +338,9 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 		if s.StatusGen != nil {
 			s.StatusGen.OnNack(con.proxy, deltaToSotwRequest(request))
 		}
+		if request.TypeUrl == v3.ProxyConfigType {
+			s.pcdsRollout.onNack(con.proxy.ID, request.ErrorDetail.GetMessage())
+		}
 		con.proxy.Lock()
 		con.proxy.WatchedResources[request.TypeUrl].NonceNacked = request.ResponseNonce
 		con.proxy.Unlock()
@@ -389,6 +392,9 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 	con.proxy.WatchedResources[request.TypeUrl].ResourceNames = deltaWatchedResources(previousResources, request)
 	con.proxy.WatchedResources[request.TypeUrl].LastRequest = deltaToSotwRequest(request)
 	con.proxy.Unlock()
+	if request.TypeUrl == v3.ProxyConfigType {
+		s.pcdsRollout.onAck(con.proxy.ID)
+	}
 
 	oldAck := listEqualUnordered(previousResources, con.proxy.WatchedResources[request.TypeUrl].ResourceNames)
 	newAck := request.ResponseNonce != ""
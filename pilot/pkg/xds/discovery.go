@@ -136,11 +136,16 @@ type DiscoveryServer struct {
 
 	// Authenticators for XDS requests. Should be same/subset of the CA authenticators.
 	Authenticators []security.Authenticator
+	// AuthenticationMode is how the results of the Authenticators are combined, first-success if empty.
+	AuthenticationMode security.AuthenticationMode
 
 	// StatusGen is notified of connect/disconnect/nack on all connections
 	StatusGen               *StatusGen
 	WorkloadEntryController *workloadentry.Controller
 
+	// pcdsRollout stages the proxy config changes pushed by PCDS to canary proxies.
+	pcdsRollout *pcdsRollout
+
 	// serverReady indicates caches have been synced up and server is ready to process requests.
 	serverReady atomic.Bool
 
@@ -572,6 +577,14 @@ func (s *DiscoveryServer) InitGenerators(env *model.Environment, systemNameSpace
 	s.Generators[v3.EndpointType] = edsGen
 	s.Generators[v3.NameTableType] = &NdsGenerator{Server: s}
 	s.Generators[v3.ExtensionConfigurationType] = &EcdsGenerator{Server: s}
+	rollout, err := newPCDSRollout(features.PCDSCanarySelector, features.PCDSCanarySoakTime, func() {
+		s.ConfigUpdate(&model.PushRequest{Full: true, Reason: []model.TriggerReason{model.GlobalUpdate}})
+	})
+	if err != nil {
+		log.Errorf("invalid PILOT_PCDS_CANARY_SELECTOR, rolling out proxy config changes to all proxies: %v", err)
+	} else {
+		s.pcdsRollout = rollout
+	}
 	s.Generators[v3.ProxyConfigType] = &PcdsGenerator{Server: s, TrustBundle: env.TrustBundle}
 
 	s.Generators["grpc"] = &grpcgen.GrpcConfigGenerator{}
@@ -53,6 +53,23 @@ func pcdsNeedsPush(req *model.PushRequest) bool {
 	return false
 }
 
+// identityPolicyMetadata are the proxy metadata keys of the default proxy config setting the TTL and
+// key type of the workload certificates, pushed so that agents apply them without a restart.
+var identityPolicyMetadata = []string{"SECRET_TTL", "ECC_SIGNATURE_ALGORITHM"}
+
+func identityPolicy(pc *mesh.ProxyConfig) map[string]string {
+	var policy map[string]string
+	for _, k := range identityPolicyMetadata {
+		if v, f := pc.GetProxyMetadata()[k]; f {
+			if policy == nil {
+				policy = map[string]string{}
+			}
+			policy[k] = v
+		}
+	}
+	return policy
+}
+
 // Generate returns ProxyConfig protobuf containing TrustBundle for given proxy
 func (e *PcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
 	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
@@ -62,9 +79,11 @@ func (e *PcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 	if e.TrustBundle == nil {
 		return nil, model.DefaultXdsLogDetails, nil
 	}
-	// TODO: For now, only TrustBundle updates are pushed. Eventually, this should push entire Proxy Configuration
+	// TODO: For now, only TrustBundle and identity policy updates are pushed. Eventually, this should push entire Proxy Configuration
 	pc := &mesh.ProxyConfig{
 		CaCertificatesPem: e.TrustBundle.GetTrustBundle(),
+		ProxyMetadata:     identityPolicy(push.Mesh.GetDefaultConfig()),
 	}
+	pc = e.Server.pcdsRollout.configFor(proxy, pc)
 	return model.Resources{&discovery.Resource{Resource: gogo.MessageToAny(pc)}}, model.DefaultXdsLogDetails, nil
 }
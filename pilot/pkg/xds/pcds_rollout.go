@@ -0,0 +1,418 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	klabels "k8s.io/apimachinery/pkg/labels"
+
+	mesh "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+)
+
+type pcdsRolloutState string
+
+const (
+	// pcdsRolloutCanary is a rollout pushed to the canary proxies only.
+	pcdsRolloutCanary pcdsRolloutState = "canary"
+	// pcdsRolloutComplete is a rollout pushed to all proxies.
+	pcdsRolloutComplete pcdsRolloutState = "complete"
+	// pcdsRolloutHalted is a rollout rejected by a canary proxy. The canaries are rolled back, until the
+	// next change of the proxy config.
+	pcdsRolloutHalted pcdsRolloutState = "halted"
+)
+
+// pcdsRolloutSyncInterval is how often a rollout on the canaries is synced with the other replicas.
+var pcdsRolloutSyncInterval = 10 * time.Second
+
+// pcdsRollout stages the changes of the proxy config pushed by PCDS, such as new roots or identity
+// policies: a change is first pushed to the canary proxies selected by labels, and promoted to all
+// proxies once the soak time elapsed without any canary rejecting it, provided a canary adopted it or
+// none was connected to get it.
+//
+// Without a store the state is local to each istiod, and after a restart the current proxy config is
+// considered stable. With a store, the replicas share the canaries which adopted or rejected a rollout
+// and its promotion, and a restarted replica joins the rollout in progress.
+type pcdsRollout struct {
+	selector labels.Instance
+	soakTime time.Duration
+	// push triggers a push of the proxy config to all proxies, when the rollout is promoted or halted.
+	push func()
+
+	mu sync.Mutex
+	// store shares the rollout with the other replicas, if set. joined is the rollout in progress when
+	// the store was set, which the first proxy config joins if it is its target.
+	store   pcdsRolloutStore
+	joined  *pcdsRolloutRecord
+	stable  *mesh.ProxyConfig
+	target  *mesh.ProxyConfig
+	state   pcdsRolloutState
+	started time.Time
+	// sent, adopted and rejected are the canary proxies the target was pushed to, which ACKed it and
+	// which NACKed it, by proxy ID.
+	sent     map[string]struct{}
+	adopted  map[string]struct{}
+	rejected map[string]string
+	timer    *time.Timer
+	// generation is incremented by each rollout, so that the timers of the previous ones are ignored.
+	generation int
+}
+
+// pcdsRolloutStatus is the status of a pcdsRollout reported by /debug/pcds_rollout.
+type pcdsRolloutStatus struct {
+	State    pcdsRolloutState  `json:"state"`
+	Selector labels.Instance   `json:"selector,omitempty"`
+	Started  time.Time         `json:"started,omitempty"`
+	SoakTime string            `json:"soakTime"`
+	Canaries []string          `json:"canaries,omitempty"`
+	Adopted  []string          `json:"adopted,omitempty"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// newPCDSRollout creates a pcdsRollout for the canary proxies matching selector, in the form
+// k1=v1,k2=v2. With an empty selector, changes are pushed to all proxies at once.
+func newPCDSRollout(selector string, soakTime time.Duration, push func()) (*pcdsRollout, error) {
+	sel, err := klabels.ConvertSelectorToLabelsMap(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &pcdsRollout{
+		selector: labels.Instance(sel),
+		soakTime: soakTime,
+		push:     push,
+		state:    pcdsRolloutComplete,
+	}, nil
+}
+
+// share shares the rollouts with the other replicas through store, joining the one in progress unless
+// it fails to be loaded.
+func (r *pcdsRollout) share(store pcdsRolloutStore) error {
+	joined, err := store.load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store = store
+	r.joined = joined
+	return err
+}
+
+// configFor returns the proxy config to push to proxy, given the desired proxy config. A desired proxy
+// config different from the current target starts a new rollout.
+func (r *pcdsRollout) configFor(proxy *model.Proxy, desired *mesh.ProxyConfig) *mesh.ProxyConfig {
+	if r == nil {
+		return desired
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.target == nil || !proto.Equal(r.target, desired) {
+		r.start(desired)
+	}
+	switch {
+	case r.state == pcdsRolloutComplete:
+		return r.target
+	case r.state == pcdsRolloutCanary && r.isCanary(proxy):
+		r.sent[proxy.ID] = struct{}{}
+		return r.target
+	default:
+		return r.stable
+	}
+}
+
+// start starts the rollout of target. Must be called with mu held.
+func (r *pcdsRollout) start(target *mesh.ProxyConfig) {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.generation++
+	joined := r.joined
+	r.joined = nil
+	if r.target == nil && r.join(joined, target) {
+		return
+	}
+	if r.target == nil || len(r.selector) == 0 {
+		r.stable, r.target, r.state = target, target, pcdsRolloutComplete
+		return
+	}
+	if r.state == pcdsRolloutComplete {
+		r.stable = r.target
+	}
+	// A rollout replacing a halted or unfinished one starts over from the last complete one.
+	r.target = target
+	r.state = pcdsRolloutCanary
+	r.started = time.Now()
+	r.sent = map[string]struct{}{}
+	r.adopted = map[string]struct{}{}
+	r.rejected = map[string]string{}
+	r.schedule()
+	log.Infof("PCDS: rolling out new proxy config to canary proxies %v", r.selector)
+}
+
+// join resumes the shared rollout in progress when istiod started, if target is its target. Must be
+// called with mu held.
+func (r *pcdsRollout) join(joined *pcdsRolloutRecord, target *mesh.ProxyConfig) bool {
+	if joined == nil || joined.State == pcdsRolloutComplete || joined.Target != pcdsConfigHash(target) {
+		return false
+	}
+	stable := &mesh.ProxyConfig{}
+	if err := gogoprotomarshal.ApplyJSON(joined.Stable, stable); err != nil {
+		log.Warnf("PCDS: failed to parse the stable proxy config of the rollout in progress: %v", err)
+		return false
+	}
+	r.stable, r.target = stable, target
+	r.state = pcdsRolloutCanary
+	r.sent = map[string]struct{}{}
+	r.adopted = map[string]struct{}{}
+	r.rejected = map[string]string{}
+	r.merge(joined)
+	if r.state == pcdsRolloutCanary {
+		r.schedule()
+	}
+	log.Infof("PCDS: resuming %s rollout of new proxy config to canary proxies %v", joined.State, r.selector)
+	return true
+}
+
+// schedule arms the timer of the rollout, which promotes it once the soak time elapsed and syncs it with
+// the other replicas meanwhile. Must be called with mu held.
+func (r *pcdsRollout) schedule() {
+	wait := time.Until(r.started.Add(r.soakTime))
+	if r.store != nil && (wait > pcdsRolloutSyncInterval || wait <= 0) {
+		wait = pcdsRolloutSyncInterval
+	}
+	generation := r.generation
+	r.timer = time.AfterFunc(wait, func() { r.tick(generation) })
+}
+
+// tick syncs the rollout with the other replicas and promotes it if it is due, then rearms the timer
+// while the rollout is shared and on the canaries.
+func (r *pcdsRollout) tick(generation int) {
+	r.sync()
+	r.maybePromote()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation == generation && r.store != nil && r.state == pcdsRolloutCanary {
+		r.schedule()
+	}
+}
+
+func (r *pcdsRollout) isCanary(proxy *model.Proxy) bool {
+	return proxy.Metadata != nil && r.selector.SubsetOf(proxy.Metadata.Labels)
+}
+
+// onAck records that proxyID adopted the last proxy config pushed to it.
+func (r *pcdsRollout) onAck(proxyID string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.state != pcdsRolloutCanary {
+		r.mu.Unlock()
+		return
+	}
+	if _, f := r.sent[proxyID]; f {
+		r.adopted[proxyID] = struct{}{}
+	}
+	r.mu.Unlock()
+	r.maybePromote()
+}
+
+// onNack records that proxyID rejected the last proxy config pushed to it, halting the rollout.
+func (r *pcdsRollout) onNack(proxyID string, message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if _, f := r.sent[proxyID]; !f || r.state != pcdsRolloutCanary {
+		r.mu.Unlock()
+		return
+	}
+	r.rejected[proxyID] = message
+	r.halt()
+	r.mu.Unlock()
+	log.Warnf("PCDS: halting rollout of new proxy config, rejected by %s: %s", proxyID, message)
+	r.push()
+	go r.sync()
+}
+
+// halt halts the rollout. Must be called with mu held.
+func (r *pcdsRollout) halt() {
+	r.state = pcdsRolloutHalted
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// promote promotes the rollout. Must be called with mu held.
+func (r *pcdsRollout) promote() {
+	r.state = pcdsRolloutComplete
+	r.stable = r.target
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// maybePromote pushes the target to all proxies once the soak time elapsed, if a canary adopted it or
+// none was pushed it, so that a rollout without any connected canary does not wait forever.
+func (r *pcdsRollout) maybePromote() {
+	r.mu.Lock()
+	if r.state != pcdsRolloutCanary || time.Since(r.started) < r.soakTime || len(r.adopted) == 0 && len(r.sent) != 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.promote()
+	adopted := len(r.adopted)
+	r.mu.Unlock()
+	if adopted == 0 {
+		log.Warnf("PCDS: promoting new proxy config to all proxies, no canary proxy was connected during the soak time")
+	} else {
+		log.Infof("PCDS: promoting new proxy config to all proxies, adopted by %d canary proxies", adopted)
+	}
+	r.push()
+	go r.sync()
+}
+
+// sync merges the rollout with the one shared by the other replicas, promoting or halting it if they did.
+func (r *pcdsRollout) sync() {
+	r.mu.Lock()
+	if r.store == nil || r.target == nil || r.sent == nil {
+		r.mu.Unlock()
+		return
+	}
+	local, err := r.record()
+	generation := r.generation
+	r.mu.Unlock()
+	if err != nil {
+		log.Warnf("PCDS: failed to share the rollout of new proxy config: %v", err)
+		return
+	}
+	shared, err := r.store.update(func(current *pcdsRolloutRecord) *pcdsRolloutRecord {
+		return current.merge(local)
+	})
+	if err != nil {
+		log.Warnf("PCDS: failed to share the rollout of new proxy config: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	if r.generation != generation || shared == nil || shared.Target != local.Target {
+		// The rollout was replaced meanwhile, here or by a newer one of another replica.
+		r.mu.Unlock()
+		return
+	}
+	previous := r.state
+	r.merge(shared)
+	r.mu.Unlock()
+	switch {
+	case previous == pcdsRolloutCanary && shared.State == pcdsRolloutHalted:
+		log.Warnf("PCDS: halting rollout of new proxy config, rejected by canary proxies %v", shared.Rejected)
+		r.push()
+	case previous == pcdsRolloutCanary && shared.State == pcdsRolloutComplete:
+		log.Infof("PCDS: promoting new proxy config to all proxies, promoted by another istiod")
+		r.push()
+	}
+}
+
+// record returns the shared record of the rollout. Must be called with mu held.
+func (r *pcdsRollout) record() (*pcdsRolloutRecord, error) {
+	stable, err := gogoprotomarshal.ToJSON(r.stable)
+	if err != nil {
+		return nil, err
+	}
+	rec := &pcdsRolloutRecord{
+		Target:   pcdsConfigHash(r.target),
+		Stable:   stable,
+		State:    r.state,
+		Started:  r.started,
+		Canaries: sortedKeys(r.sent),
+		Adopted:  sortedKeys(r.adopted),
+		Rejected: map[string]string{},
+	}
+	for id, message := range r.rejected {
+		rec.Rejected[id] = message
+	}
+	return rec, nil
+}
+
+// merge merges the shared record of the rollout into it. Must be called with mu held.
+func (r *pcdsRollout) merge(rec *pcdsRolloutRecord) {
+	if r.started.IsZero() || rec.Started.Before(r.started) {
+		r.started = rec.Started
+	}
+	for _, id := range rec.Canaries {
+		r.sent[id] = struct{}{}
+	}
+	for _, id := range rec.Adopted {
+		r.adopted[id] = struct{}{}
+	}
+	for id, message := range rec.Rejected {
+		r.rejected[id] = message
+	}
+	if r.state != pcdsRolloutCanary {
+		return
+	}
+	switch rec.State {
+	case pcdsRolloutHalted:
+		r.halt()
+	case pcdsRolloutComplete:
+		r.promote()
+	}
+}
+
+func (r *pcdsRollout) status() pcdsRolloutStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := pcdsRolloutStatus{
+		State:    r.state,
+		Selector: r.selector,
+		Started:  r.started,
+		SoakTime: r.soakTime.String(),
+		Canaries: sortedKeys(r.sent),
+		Adopted:  sortedKeys(r.adopted),
+		Rejected: map[string]string{},
+	}
+	for id, message := range r.rejected {
+		status.Rejected[id] = message
+	}
+	return status
+}
+
+// pcdsConfigHash identifies a proxy config in the shared records of the rollouts.
+func pcdsConfigHash(pc *mesh.ProxyConfig) string {
+	// The JSON encoding sorts the keys of the maps, unlike the binary one.
+	js, err := gogoprotomarshal.ToJSON(pc)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(js))
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// pcdsRolloutConfigMap is the ConfigMap sharing the PCDS rollout between the istiod replicas.
+	pcdsRolloutConfigMap = "istio-pcds-rollout"
+	pcdsRolloutKey       = "rollout"
+	// pcdsRolloutStoreTimeout bounds each read or write of the shared rollout.
+	pcdsRolloutStoreTimeout = 10 * time.Second
+)
+
+// SharePCDSRollout shares the PCDS rollouts with the other istiod replicas through a ConfigMap of
+// namespace, so that they promote or halt them together.
+func (s *DiscoveryServer) SharePCDSRollout(client kubernetes.Interface, namespace string) error {
+	if s.pcdsRollout == nil || len(s.pcdsRollout.selector) == 0 {
+		return nil
+	}
+	return s.pcdsRollout.share(&kubePCDSRolloutStore{client: client, namespace: namespace})
+}
+
+// pcdsRolloutRecord is a PCDS rollout shared by the istiod replicas.
+type pcdsRolloutRecord struct {
+	// Target is the hash of the proxy config rolled out, and Stable the JSON of the one it replaces.
+	Target   string            `json:"target"`
+	Stable   string            `json:"stable"`
+	State    pcdsRolloutState  `json:"state"`
+	Started  time.Time         `json:"started"`
+	Canaries []string          `json:"canaries,omitempty"`
+	Adopted  []string          `json:"adopted,omitempty"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+// merge returns the record merging local into rec, or nil if rec is up to date. The newest rollout
+// replaces the others, and the canaries of a rollout are merged; a halt prevails over a promotion.
+func (rec *pcdsRolloutRecord) merge(local *pcdsRolloutRecord) *pcdsRolloutRecord {
+	if rec == nil || rec.Target != local.Target && local.Started.After(rec.Started) {
+		return local
+	}
+	if rec.Target != local.Target {
+		return nil
+	}
+	merged := &pcdsRolloutRecord{
+		Target:   rec.Target,
+		Stable:   rec.Stable,
+		State:    rec.State,
+		Started:  rec.Started,
+		Canaries: mergeSorted(rec.Canaries, local.Canaries),
+		Adopted:  mergeSorted(rec.Adopted, local.Adopted),
+		Rejected: map[string]string{},
+	}
+	if local.Started.Before(merged.Started) {
+		merged.Started = local.Started
+	}
+	switch {
+	case rec.State == pcdsRolloutHalted || local.State == pcdsRolloutHalted:
+		merged.State = pcdsRolloutHalted
+	case rec.State == pcdsRolloutComplete || local.State == pcdsRolloutComplete:
+		merged.State = pcdsRolloutComplete
+	}
+	for _, rejected := range []map[string]string{rec.Rejected, local.Rejected} {
+		for id, message := range rejected {
+			merged.Rejected[id] = message
+		}
+	}
+	if len(merged.Rejected) == 0 {
+		merged.Rejected = nil
+	}
+	if reflect.DeepEqual(merged, rec) {
+		return nil
+	}
+	return merged
+}
+
+func mergeSorted(a, b []string) []string {
+	set := map[string]struct{}{}
+	for _, ids := range [][]string{a, b} {
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return sortedKeys(set)
+}
+
+// pcdsRolloutStore stores the PCDS rollout shared by the istiod replicas.
+type pcdsRolloutStore interface {
+	// load returns the shared rollout, or nil if there is none.
+	load() (*pcdsRolloutRecord, error)
+	// update replaces the shared rollout with the one returned by f, unless it returns nil, and returns
+	// the shared rollout. f is called again if the rollout was updated concurrently.
+	update(f func(current *pcdsRolloutRecord) *pcdsRolloutRecord) (*pcdsRolloutRecord, error)
+}
+
+// kubePCDSRolloutStore is a pcdsRolloutStore keeping the rollout in a ConfigMap, whose updates are
+// conflict-checked so that the replicas do not overwrite each other's canaries.
+type kubePCDSRolloutStore struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (s *kubePCDSRolloutStore) get(ctx context.Context) (*corev1.ConfigMap, *pcdsRolloutRecord, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, pcdsRolloutConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	data, f := cm.Data[pcdsRolloutKey]
+	if !f {
+		return cm, nil, nil
+	}
+	rec := &pcdsRolloutRecord{}
+	if err := json.Unmarshal([]byte(data), rec); err != nil {
+		return nil, nil, err
+	}
+	return cm, rec, nil
+}
+
+func (s *kubePCDSRolloutStore) load() (*pcdsRolloutRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pcdsRolloutStoreTimeout)
+	defer cancel()
+	_, rec, err := s.get(ctx)
+	return rec, err
+}
+
+func (s *kubePCDSRolloutStore) update(f func(current *pcdsRolloutRecord) *pcdsRolloutRecord) (*pcdsRolloutRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pcdsRolloutStoreTimeout)
+	defer cancel()
+	var shared *pcdsRolloutRecord
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	err := retry.OnError(retry.DefaultRetry, retriable, func() error {
+		cm, current, err := s.get(ctx)
+		if err != nil {
+			return err
+		}
+		shared = current
+		next := f(current)
+		if next == nil {
+			return nil
+		}
+		data, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		if cm == nil {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: pcdsRolloutConfigMap, Namespace: s.namespace}}
+			cm.Data = map[string]string{pcdsRolloutKey: string(data)}
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+		} else {
+			cm = cm.DeepCopy()
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[pcdsRolloutKey] = string(data)
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			shared = next
+		}
+		return err
+	})
+	return shared, err
+}
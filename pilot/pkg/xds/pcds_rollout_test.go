@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+	"k8s.io/client-go/kubernetes/fake"
+
+	mesh "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func rolloutProxy(id string, labels map[string]string) *model.Proxy {
+	return &model.Proxy{ID: id, Metadata: &model.NodeMetadata{Labels: labels}}
+}
+
+func TestPCDSRollout(t *testing.T) {
+	pushes := atomic.NewInt32(0)
+	r, err := newPCDSRollout("canary=true", 50*time.Millisecond, func() { pushes.Inc() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	canary := rolloutProxy("canary", map[string]string{"canary": "true"})
+	other := rolloutProxy("other", nil)
+	v1 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1"}}
+	v2 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1", "root2"}}
+
+	// The first proxy config is pushed to all proxies.
+	if got := r.configFor(other, v1); got != v1 {
+		t.Fatalf("expected initial proxy config, got %v", got)
+	}
+
+	// A change is only pushed to the canaries.
+	if got := r.configFor(canary, v2); got != v2 {
+		t.Fatalf("expected canary to get the new proxy config, got %v", got)
+	}
+	if got := r.configFor(other, v2); got != v1 {
+		t.Fatalf("expected other proxies to keep the stable proxy config, got %v", got)
+	}
+	// ACKs of other proxies do not count as adoption.
+	r.onAck(other.ID)
+	if got := r.status(); got.State != pcdsRolloutCanary || len(got.Adopted) != 0 {
+		t.Fatalf("unexpected status %+v", got)
+	}
+
+	r.onAck(canary.ID)
+	retry.UntilOrFail(t, func() bool { return pushes.Load() == 1 }, retry.Timeout(time.Second))
+	if got := r.status(); got.State != pcdsRolloutComplete {
+		t.Fatalf("expected rollout to be promoted, got %+v", got)
+	}
+	if got := r.configFor(other, v2); got != v2 {
+		t.Fatalf("expected promoted proxy config, got %v", got)
+	}
+}
+
+func TestPCDSRolloutHalted(t *testing.T) {
+	pushes := atomic.NewInt32(0)
+	r, err := newPCDSRollout("canary=true", time.Hour, func() { pushes.Inc() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	canary := rolloutProxy("canary", map[string]string{"canary": "true"})
+	v1 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1"}}
+	v2 := &mesh.ProxyConfig{ProxyMetadata: map[string]string{"SECRET_TTL": "invalid"}}
+	r.configFor(canary, v1)
+	r.configFor(canary, v2)
+
+	r.onNack(canary.ID, "invalid SECRET_TTL")
+	status := r.status()
+	if status.State != pcdsRolloutHalted || status.Rejected[canary.ID] != "invalid SECRET_TTL" || pushes.Load() != 1 {
+		t.Fatalf("expected rollout to be halted, got %+v", status)
+	}
+	// The canaries are rolled back.
+	if got := r.configFor(canary, v2); got != v1 {
+		t.Fatalf("expected canary to be rolled back, got %v", got)
+	}
+	// A new change starts a new rollout.
+	v3 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1", "root3"}}
+	if got := r.configFor(canary, v3); got != v3 {
+		t.Fatalf("expected canary to get the new proxy config, got %v", got)
+	}
+	if got := r.status(); got.State != pcdsRolloutCanary || len(got.Rejected) != 0 {
+		t.Fatalf("expected a new rollout, got %+v", got)
+	}
+}
+
+func TestPCDSRolloutWithoutSelector(t *testing.T) {
+	r, err := newPCDSRollout("", time.Hour, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := rolloutProxy("proxy", nil)
+	r.configFor(proxy, &mesh.ProxyConfig{CaCertificatesPem: []string{"root1"}})
+	v2 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root2"}}
+	if got := r.configFor(proxy, v2); got != v2 {
+		t.Fatalf("expected changes to be pushed to all proxies, got %v", got)
+	}
+}
+
+func TestPCDSRolloutWithoutCanaries(t *testing.T) {
+	pushes := atomic.NewInt32(0)
+	r, err := newPCDSRollout("canary=true", 50*time.Millisecond, func() { pushes.Inc() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := rolloutProxy("other", nil)
+	v1 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1"}}
+	v2 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1", "root2"}}
+	r.configFor(other, v1)
+	if got := r.configFor(other, v2); got != v1 {
+		t.Fatalf("expected other proxies to keep the stable proxy config, got %v", got)
+	}
+	// No canary was connected to adopt the change, which is promoted after the soak time.
+	retry.UntilOrFail(t, func() bool { return pushes.Load() == 1 }, retry.Timeout(time.Second))
+	if got := r.configFor(other, v2); got != v2 {
+		t.Fatalf("expected promoted proxy config, got %v", got)
+	}
+}
+
+func TestPCDSRolloutShared(t *testing.T) {
+	interval := pcdsRolloutSyncInterval
+	pcdsRolloutSyncInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pcdsRolloutSyncInterval = interval })
+
+	store := &kubePCDSRolloutStore{client: fake.NewSimpleClientset(), namespace: "istio-system"}
+	newRollout := func(soakTime time.Duration) (*pcdsRollout, *atomic.Int32) {
+		pushes := atomic.NewInt32(0)
+		r, err := newPCDSRollout("canary=true", soakTime, func() { pushes.Inc() })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.share(store); err != nil {
+			t.Fatal(err)
+		}
+		return r, pushes
+	}
+	canary1 := rolloutProxy("canary1", map[string]string{"canary": "true"})
+	canary2 := rolloutProxy("canary2", map[string]string{"canary": "true"})
+	other := rolloutProxy("other", nil)
+	v1 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1"}}
+	v2 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1", "root2"}}
+	v3 := &mesh.ProxyConfig{CaCertificatesPem: []string{"root1", "root3"}}
+
+	// A canary rejecting the change on one replica halts the rollout on the others.
+	r1, pushes1 := newRollout(time.Hour)
+	r2, _ := newRollout(time.Hour)
+	for _, r := range []*pcdsRollout{r1, r2} {
+		r.configFor(other, v1)
+	}
+	r1.configFor(canary1, v2)
+	r2.configFor(canary2, v2)
+	r2.onNack(canary2.ID, "invalid root")
+	retry.UntilOrFail(t, func() bool { return pushes1.Load() == 1 }, retry.Timeout(time.Second))
+	if got := r1.status(); got.State != pcdsRolloutHalted || got.Rejected[canary2.ID] != "invalid root" {
+		t.Fatalf("expected rollout to be halted, got %+v", got)
+	}
+
+	// A replica starting during a rollout joins it rather than promoting it.
+	r1.configFor(canary1, v3)
+	retry.UntilOrFail(t, func() bool {
+		rec, err := store.load()
+		return err == nil && rec != nil && rec.Target == pcdsConfigHash(v3)
+	}, retry.Timeout(time.Second))
+	r3, pushes3 := newRollout(100 * time.Millisecond)
+	if got := r3.configFor(other, v3); got.String() != v1.String() {
+		t.Fatalf("expected the joined rollout to keep the stable proxy config, got %v", got)
+	}
+	if got := r3.configFor(canary2, v3); got != v3 {
+		t.Fatalf("expected canary to get the new proxy config, got %v", got)
+	}
+	// The canary of the other replica adopted the change, which is promoted everywhere after the soak
+	// time although the canary of this replica did not ACK it.
+	r1.onAck(canary1.ID)
+	retry.UntilOrFail(t, func() bool { return pushes3.Load() == 1 }, retry.Timeout(time.Second))
+	if got := r3.configFor(other, v3); got != v3 {
+		t.Fatalf("expected promoted proxy config, got %v", got)
+	}
+}
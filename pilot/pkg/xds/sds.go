@@ -15,6 +15,7 @@
 package xds
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -30,6 +31,8 @@ import (
 	"istio.io/istio/pkg/cluster"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
 )
 
 const (
@@ -119,6 +122,7 @@ func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 	// they cannot; instead we just exclude it. This ensures that a single bad reference does not break the whole
 	// SDS flow. The pilotSDSCertificateErrors metric and logs handle visibility into invalid references.
 	resources := filterAuthorizedResources(s.parseResources(w.ResourceNames, proxy), proxy, proxyClusterSecrets)
+	resources = s.authorize(proxy, resources)
 
 	results := model.Resources{}
 	cached, regenerated := 0, 0
@@ -317,6 +321,35 @@ type SecretGen struct {
 	// Cache for XDS resources
 	cache         model.XdsCache
 	configCluster cluster.ID
+
+	// Authorizer, if set, must authorize each secret sent to a proxy, in addition to the Secret
+	// access checks.
+	Authorizer security.Authorizer
+}
+
+// authorize filters down resources to those the Authorizer allows the proxy to get.
+func (s *SecretGen) authorize(proxy *model.Proxy, resources []SecretResource) []SecretResource {
+	if s.Authorizer == nil {
+		return resources
+	}
+	caller := &security.Caller{
+		AuthSource: security.AuthSourceClientCertificate,
+		Identities: []string{proxy.VerifiedIdentity.String()},
+	}
+	if id, err := spiffe.ParseID(caller.Identities[0]); err == nil {
+		caller.SpiffeIDs = []spiffe.ID{id}
+	}
+	allowedResources := make([]SecretResource, 0, len(resources))
+	for _, r := range resources {
+		resource := security.Resource{Type: security.ResourceSDS, Name: r.ResourceName}
+		if err := s.Authorizer.Authorize(context.Background(), caller, resource); err != nil {
+			log.Warnf("proxy %v is not authorized to access certificate %v: %v", proxy.ID, r.ResourceName, err)
+			pilotSDSCertificateErrors.Increment()
+			continue
+		}
+		allowedResources = append(allowedResources, r)
+	}
+	return allowedResources
 }
 
 var _ model.XdsResourceGenerator = &SecretGen{}
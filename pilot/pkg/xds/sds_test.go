@@ -15,7 +15,9 @@
 package xds
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -32,6 +34,7 @@ import (
 	"istio.io/istio/pilot/test/xdstest"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/spiffe"
 )
 
@@ -328,3 +331,37 @@ func TestCaching(t *testing.T) {
 		t.Fatalf("failed to get expected secrets for unauthorized proxy: %v", raw)
 	}
 }
+
+func TestAuthorizer(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{
+		KubernetesObjects: []runtime.Object{genericCert, genericMtlsCert},
+		KubeClientModifier: func(c kube.Client) {
+			cc := c.Kube().(*fake.Clientset)
+			kubesecrets.DisableAuthorizationForTest(cc)
+		},
+	})
+	gen := s.Discovery.Generators[v3.SecretType].(*SecretGen)
+	gen.Authorizer = security.AuthorizerFunc(func(_ context.Context, caller *security.Caller, resource security.Resource) error {
+		if resource.Type != security.ResourceSDS || resource.Name != "kubernetes://generic" {
+			return fmt.Errorf("%v is not allowed", resource.Name)
+		}
+		if len(caller.SpiffeIDs) != 1 || caller.SpiffeIDs[0].Path != "/ns/istio-system/sa/gateway" {
+			return fmt.Errorf("unexpected caller %v", caller.SpiffeIDs)
+		}
+		return nil
+	})
+
+	proxy := &model.Proxy{
+		Metadata:         &model.NodeMetadata{ClusterID: "Kubernetes"},
+		VerifiedIdentity: &spiffe.Identity{TrustDomain: "cluster.local", Namespace: "istio-system", ServiceAccount: "gateway"},
+		Type:             model.Router,
+		ConfigNamespace:  "istio-system",
+	}
+	secrets, _, _ := gen.Generate(s.SetupProxy(proxy), s.PushContext(),
+		&model.WatchedResource{ResourceNames: []string{"kubernetes://generic", "kubernetes://generic-mtls"}},
+		&model.PushRequest{Full: true, Start: time.Now()})
+	raw := xdstest.ExtractTLSSecrets(t, model.ResourcesToAny(secrets))
+	if len(raw) != 1 || raw["kubernetes://generic"] == nil {
+		t.Fatalf("expected only the authorized secret, got %v", raw)
+	}
+}
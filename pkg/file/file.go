@@ -50,8 +50,14 @@ func Copy(srcFilepath, targetDir, targetFilename string) error {
 	return os.WriteFile(filepath.Join(targetDir, targetFilename), input, info.Mode())
 }
 
-// Write atomically by writing to a temporary file in the same directory then renaming
-func AtomicWrite(path string, data []byte, mode os.FileMode) (err error) {
+// Write atomically by writing to a temporary file in the same directory then renaming. On Windows,
+// the mode is enforced with an ACL restricting access to the owner and administrators.
+func AtomicWrite(path string, data []byte, mode os.FileMode) error {
+	return AtomicWriteOwned(path, data, mode, -1, -1)
+}
+
+// AtomicWriteOwned is AtomicWrite of a file owned by uid and gid. An id of -1 is not changed.
+func AtomicWriteOwned(path string, data []byte, mode os.FileMode, uid, gid int) (err error) {
 	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp.")
 	if err != nil {
 		return
@@ -68,9 +74,14 @@ func AtomicWrite(path string, data []byte, mode os.FileMode) (err error) {
 		}
 	}()
 
-	if err = os.Chmod(tmpFile.Name(), mode); err != nil {
+	if err = chmod(tmpFile.Name(), mode); err != nil {
 		return
 	}
+	if uid != -1 || gid != -1 {
+		if err = os.Chown(tmpFile.Name(), uid, gid); err != nil {
+			return
+		}
+	}
 
 	_, err = tmpFile.Write(data)
 	if err != nil {
@@ -83,7 +94,7 @@ func AtomicWrite(path string, data []byte, mode os.FileMode) (err error) {
 		return
 	}
 
-	err = os.Rename(tmpFile.Name(), path)
+	err = rename(tmpFile.Name(), path)
 	return
 }
 
@@ -0,0 +1,65 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key.pem")
+	for _, data := range []string{"first", "second"} {
+		if err := AtomicWrite(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Fatalf("expected %q, got %q", data, got)
+		}
+	}
+	// Windows does not report the permissions of the ACL in the mode.
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected file to only be accessible to its owner: %v %v", info.Mode(), err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary files to be removed, got %v", entries)
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	dir := t.TempDir()
+	if !SamePath(filepath.Join(dir, "certs", "..", "cert.pem"), filepath.Join(dir, "cert.pem")) {
+		t.Error("expected equivalent paths to be the same")
+	}
+	if SamePath(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")) {
+		t.Error("expected different files not to be the same")
+	}
+	if got := SamePath(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "CERT.pem")); got != (runtime.GOOS == "windows") {
+		t.Errorf("expected paths differing in case to be the same only on Windows, got %v", got)
+	}
+}
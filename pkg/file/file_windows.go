@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// renameAttempts bounds the retries of a rename over a file that is open, typically by a reader
+	// that did not share delete access, which Windows reports as a sharing violation.
+	renameAttempts = 10
+	renameBackoff  = 50 * time.Millisecond
+)
+
+// chmod applies mode to the file. Windows only honors the write bit of the mode, so access is
+// restricted with an ACL instead: the owner, SYSTEM and the Administrators have full control, and
+// the Users can read the file if the mode grants read access to the group or others. The ACL does
+// not inherit the permissions of the directory.
+func chmod(name string, mode os.FileMode) error {
+	if err := os.Chmod(name, mode); err != nil {
+		return err
+	}
+	sddl := "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FA;;;BA)"
+	if mode&0o044 != 0 {
+		sddl += "(A;;FR;;;BU)"
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	return windows.SetNamedSecurityInfo(name, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+}
+
+// rename replaces newpath with oldpath, retrying while newpath is open by another process.
+func rename(oldpath, newpath string) (err error) {
+	for i := 0; i < renameAttempts; i++ {
+		if err = os.Rename(oldpath, newpath); err == nil || !isSharingViolation(err) {
+			return err
+		}
+		time.Sleep(renameBackoff)
+	}
+	return err
+}
+
+func isSharingViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
+
+// SamePath returns whether the two paths name the same file. Windows paths are case insensitive.
+func SamePath(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
@@ -33,7 +33,6 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/jsonpb"
-	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 
 	mesh "istio.io/api/mesh/v1alpha1"
@@ -47,13 +46,21 @@ import (
 	dnsProto "istio.io/istio/pkg/dns/proto"
 	"istio.io/istio/pkg/envoy"
 	"istio.io/istio/pkg/istio-agent/grpcxds"
+	"istio.io/istio/pkg/istio-agent/metrics"
+	kubelib "istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/nodeagent/cache"
 	"istio.io/istio/security/pkg/nodeagent/caclient"
 	citadel "istio.io/istio/security/pkg/nodeagent/caclient/providers/citadel"
-	gca "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"
-	cas "istio.io/istio/security/pkg/nodeagent/caclient/providers/google-cas"
+	"istio.io/istio/security/pkg/nodeagent/certstatus"
+	"istio.io/istio/security/pkg/nodeagent/delegatedidentity"
+	"istio.io/istio/security/pkg/nodeagent/jwks"
 	"istio.io/istio/security/pkg/nodeagent/sds"
+	"istio.io/istio/security/pkg/nodeagent/secretwriter"
+	"istio.io/istio/security/pkg/nodeagent/trustbundle"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	"istio.io/istio/security/pkg/nodeagent/workloadapi"
+	"istio.io/pkg/filewatcher"
 	"istio.io/pkg/log"
 )
 
@@ -111,6 +118,32 @@ type Agent struct {
 	sdsServer   *sds.Server
 	secretCache *cache.SecretManagerClient
 
+	// Reloads the options of the agent from security.Options.OptionsReloadFile, if set. caClient is then
+	// the CA client of secretCache, replaced when the CA endpoint changes.
+	optionsReloader *security.OptionsReloader
+	optionsWatcher  filewatcher.FileWatcher
+	caClient        *caclient.SwitchableClient
+
+	// Serves the workload certificate through the SPIFFE Workload API, if enabled.
+	workloadAPIServer *workloadapi.Server
+
+	// Serves the identities of supervised workloads through the SPIRE Delegated Identity API, if enabled.
+	delegatedIdentityServer *delegatedidentity.Server
+
+	// Serves the status of the certificates of the agent, if enabled.
+	certStatusServer *certstatus.Server
+
+	// Writes the JWKS document of the trust anchors on root certificate changes, if enabled.
+	jwksExporter *jwks.Exporter
+
+	// Writes the trust bundle in the formats of legacy applications on root certificate changes, if enabled.
+	trustBundleExporter *trustbundle.Exporter
+	trustBundleMu       sync.Mutex
+
+	// Writes the workload certificate of a gateway back to a Kubernetes Secret, if enabled.
+	secretWriter   *secretwriter.Writer
+	secretWriterMu sync.Mutex
+
 	// Used when proxying envoy xds via istio-agent is enabled.
 	xdsProxy *XdsProxy
 
@@ -191,6 +224,21 @@ type AgentOptions struct {
 	DownstreamGrpcOptions []grpc.ServerOption
 
 	IstiodSAN string
+
+	// JWKSExportPath, if set, is the file the JWKS document of the mesh trust anchors is written to on
+	// every root certificate change, for applications verifying JWTs locally.
+	JWKSExportPath string
+
+	// JWKSTrustAnchors are JWKS documents of additional identity providers merged into the exported JWKS.
+	JWKSTrustAnchors []string
+
+	// TrustBundleExportDir, if set, is the directory the trust bundle is written to as PEM, CA file, Java
+	// truststore and SPIFFE bundle on every root certificate change, for co-located legacy applications.
+	TrustBundleExportDir string
+
+	// GatewaySecretName, if set on a gateway, is the Kubernetes TLS Secret in ProxyNamespace the workload
+	// certificate is written back to, for integrations that can only consume Secrets.
+	GatewaySecretName string
 }
 
 // NewAgent hosts the functionality for local SDS and XDS. This consists of the local SDS server and
@@ -400,14 +448,77 @@ func (a *Agent) Run(ctx context.Context) (func(), error) {
 		return nil, fmt.Errorf("failed to start local DNS server: %v", err)
 	}
 
+	if err = a.discardClonedIdentity(); err != nil {
+		return nil, err
+	}
+
+	if a.secOpts.OptionsReloadFile != "" {
+		if err = a.initOptionsReloader(); err != nil {
+			return nil, err
+		}
+	}
+
 	a.secretCache, err = a.newSecretManager()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start workload secret manager %v", err)
 	}
+	if a.optionsReloader != nil {
+		a.optionsReloader.OnOptionsChange(a.onOptionsChange)
+		a.watchOptionsReloadFile()
+	}
 
+	// Creating the SDS server starts fetching the initial workload certificate in the background, so
+	// it proceeds concurrently with the XDS proxy and bootstrap preparation below. Nothing there waits
+	// for it: the XDS proxy only loads its client certificate when it dials istiod, whether from
+	// ProvCert, the mounted files or the secret cache.
 	a.sdsServer = sds.NewServer(a.secOpts, a.secretCache)
-	a.secretCache.SetUpdateCallback(a.sdsServer.UpdateCallback)
+	if a.secOpts.WorkloadAPIUDSPath != "" {
+		a.workloadAPIServer, err = workloadapi.NewServer(a.secOpts, a.secretCache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start SPIFFE Workload API server: %v", err)
+		}
+	}
+	if a.secOpts.DelegatedIdentityUDSPath != "" {
+		a.delegatedIdentityServer, err = delegatedidentity.NewServer(a.secOpts, a.secretCache,
+			func(namespace, serviceAccount string) (delegatedidentity.WorkloadSecrets, error) {
+				return a.secretCache.ForIdentity(namespace, serviceAccount)
+			})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start SPIRE Delegated Identity API server: %v", err)
+		}
+	}
+	if a.secOpts.CertStatusUDSPath != "" {
+		a.certStatusServer, err = certstatus.NewServer(a.secOpts.CertStatusUDSPath, a.secretCache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start certificate status server: %v", err)
+		}
+	}
+	if a.cfg.JWKSExportPath != "" {
+		a.jwksExporter = jwks.NewExporter(a.cfg.JWKSExportPath, a.cfg.JWKSTrustAnchors)
+		go a.exportJWKS()
+	}
+	if a.cfg.TrustBundleExportDir != "" {
+		a.trustBundleExporter = trustbundle.NewExporter(a.cfg.TrustBundleExportDir, a.secOpts.TrustDomain)
+		go a.exportTrustBundle()
+	}
+	if a.cfg.GatewaySecretName != "" {
+		if a.cfg.ProxyType != model.Router {
+			log.Warnf("ignoring gateway secret %s for proxy type %s", a.cfg.GatewaySecretName, a.cfg.ProxyType)
+		} else {
+			client, err := kubelib.CreateClientset("", "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to create Kubernetes client for gateway secret: %v", err)
+			}
+			a.secretWriter = secretwriter.New(client, a.cfg.ProxyNamespace, a.cfg.GatewaySecretName)
+			go a.writeGatewaySecret()
+		}
+	}
+	a.secretCache.SetUpdateCallback(a.onSecretUpdate)
+	if n, ok := a.secOpts.CredFetcher.(security.CredentialRefreshNotifier); ok {
+		n.AddRefreshHandler(a.secretCache.OnCredentialRefresh)
+	}
 
+	xdsStart := time.Now()
 	a.xdsProxy, err = initXdsProxy(a)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start xds proxy: %v", err)
@@ -430,6 +541,8 @@ func (a *Agent) Run(ctx context.Context) (func(), error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to start envoy agent: %v", err)
 		}
+		metrics.XdsBootstrapDuration.Record(time.Since(xdsStart).Seconds())
+		log.Infof("prepared XDS proxy and bootstrap in %v", time.Since(xdsStart))
 
 		a.wg.Add(1)
 		go func() {
@@ -515,6 +628,15 @@ func (a *Agent) GetDNSTable() *dnsProto.NameTable {
 	return nil
 }
 
+// DumpSecrets returns the state of the secrets cached by the agent, with their private keys redacted,
+// or nil if the agent is not running.
+func (a *Agent) DumpSecrets() []security.SecretDump {
+	if a.secretCache != nil {
+		return a.secretCache.DumpSecrets()
+	}
+	return nil
+}
+
 func (a *Agent) Close() {
 	if a.xdsProxy != nil {
 		a.xdsProxy.close()
@@ -525,6 +647,18 @@ func (a *Agent) Close() {
 	if a.sdsServer != nil {
 		a.sdsServer.Stop()
 	}
+	if a.workloadAPIServer != nil {
+		a.workloadAPIServer.Stop()
+	}
+	if a.delegatedIdentityServer != nil {
+		a.delegatedIdentityServer.Stop()
+	}
+	if a.certStatusServer != nil {
+		a.certStatusServer.Stop()
+	}
+	if a.optionsWatcher != nil {
+		_ = a.optionsWatcher.Close()
+	}
 	if a.secretCache != nil {
 		a.secretCache.Close()
 	}
@@ -619,6 +753,112 @@ func (a *Agent) FindRootCAForCA() (string, error) {
 	return "", fmt.Errorf("root CA file for CA does not exist %s", rootCAPath)
 }
 
+// onSecretUpdate notifies the consumers of the secret cache that a secret has changed.
+func (a *Agent) onSecretUpdate(resourceName string) {
+	a.sdsServer.UpdateCallback(resourceName)
+	if a.workloadAPIServer != nil {
+		a.workloadAPIServer.UpdateCallback(resourceName)
+	}
+	if a.delegatedIdentityServer != nil {
+		a.delegatedIdentityServer.UpdateCallback(resourceName)
+	}
+	if a.jwksExporter != nil && resourceName == security.RootCertReqResourceName {
+		go a.exportJWKS()
+	}
+	if a.trustBundleExporter != nil && resourceName == security.RootCertReqResourceName {
+		go a.exportTrustBundle()
+	}
+	if a.secretWriter != nil &&
+		(resourceName == security.WorkloadKeyCertResourceName || resourceName == security.RootCertReqResourceName) {
+		go a.writeGatewaySecret()
+	}
+}
+
+// exportJWKS writes the JWKS document for the current root certificate.
+func (a *Agent) exportJWKS() {
+	root, err := a.secretCache.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		log.Warnf("failed to get root certificate for JWKS export: %v", err)
+		return
+	}
+	if err := a.jwksExporter.Export(root.RootCert); err != nil {
+		log.Warnf("failed to export JWKS: %v", err)
+		return
+	}
+	log.Infof("exported JWKS to %s", a.cfg.JWKSExportPath)
+}
+
+// exportTrustBundle writes the trust bundle for the current root certificate.
+func (a *Agent) exportTrustBundle() {
+	a.trustBundleMu.Lock()
+	defer a.trustBundleMu.Unlock()
+	root, err := a.secretCache.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		log.Warnf("failed to get root certificate for trust bundle export: %v", err)
+		return
+	}
+	if err := a.trustBundleExporter.Export(root.RootCert); err != nil {
+		log.Warnf("failed to export trust bundle: %v", err)
+		return
+	}
+	log.Infof("exported trust bundle to %s", a.cfg.TrustBundleExportDir)
+}
+
+// writeGatewaySecret writes the current workload and root certificates to the gateway Secret.
+func (a *Agent) writeGatewaySecret() {
+	a.secretWriterMu.Lock()
+	defer a.secretWriterMu.Unlock()
+	workload, err := a.secretCache.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		log.Warnf("failed to get workload certificate for gateway secret: %v", err)
+		return
+	}
+	root, err := a.secretCache.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		log.Warnf("failed to get root certificate for gateway secret: %v", err)
+		return
+	}
+	if err := a.secretWriter.Write(workload, root.RootCert); err != nil {
+		log.Warnf("failed to write gateway secret: %v", err)
+	}
+}
+
+// discardClonedIdentity removes the provisioned certificates if they were issued to another machine,
+// such as when the VM was cloned from an image with a persisted identity. The agent then re-enrolls
+// with its bootstrap credentials and a fresh key.
+func (a *Agent) discardClonedIdentity() error {
+	if a.secOpts.MachineBinding == nil {
+		return nil
+	}
+	if a.cfg.Platform != nil {
+		a.secOpts.MachineBinding.InstanceID = platformInstanceID(a.cfg.Platform)
+	}
+	if a.secOpts.ProvCert == "" {
+		return nil
+	}
+	cloned, err := nodeagentutil.DiscardClonedIdentity(a.secOpts.ProvCert, a.secOpts.MachineBinding)
+	if err != nil {
+		return fmt.Errorf("failed to check provisioned certificates for cloning: %v", err)
+	}
+	if cloned {
+		log.Warnf("certificates in %s were issued to another machine, discarded them to re-enroll with a fresh key",
+			a.secOpts.ProvCert)
+	}
+	return nil
+}
+
+// platformInstanceID returns the cloud instance ID from the platform metadata, if any.
+func platformInstanceID(env platform.Environment) string {
+	md := env.Metadata()
+	// Azure metadata keys are prefixed with "azure_" by platform.NewAzure.
+	for _, k := range []string{platform.GCEInstanceID, platform.AWSInstanceID, "azure_vmId"} {
+		if id := md[k]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
 // newSecretManager creates the SecretManager for workload secrets
 func (a *Agent) newSecretManager() (*cache.SecretManagerClient, error) {
 	// If proxy is using file mounted certs, we do not have to connect to CA.
@@ -626,63 +866,101 @@ func (a *Agent) newSecretManager() (*cache.SecretManagerClient, error) {
 		log.Info("Workload is using file mounted certificates. Skipping connecting to CA")
 		return cache.NewSecretManagerClient(nil, a.secOpts)
 	}
+	if a.secOpts.SPIREAgentUDSPath != "" {
+		log.Infof("Workload certificates are delegated to the SPIRE agent on %s. Skipping connecting to CA", a.secOpts.SPIREAgentUDSPath)
+		return cache.NewSecretManagerClient(nil, a.secOpts)
+	}
 
-	log.Infof("CA Endpoint %s, provider %s", a.secOpts.CAEndpoint, a.secOpts.CAProviderName)
+	caClient, err := a.newCAClient(a.secOpts)
+	if err != nil {
+		return nil, err
+	}
+	if a.optionsReloader != nil {
+		// The CA client is replaced when the CA endpoint is reloaded.
+		a.caClient = caclient.NewSwitchableClient(caClient)
+		caClient = a.caClient
+	}
+	return cache.NewSecretManagerClient(caClient, a.secOpts)
+}
 
-	// TODO: this should all be packaged in a plugin, possibly with optional compilation.
-	if a.secOpts.CAProviderName == security.GoogleCAProvider {
-		// Use a plugin to an external CA - this has direct support for the K8S JWT token
-		// This is only used if the proper env variables are injected - otherwise the existing Citadel or Istiod will be
-		// used.
-		caClient, err := gca.NewGoogleCAClient(a.secOpts.CAEndpoint, true, caclient.NewCATokenProvider(a.secOpts))
+// newCAClient creates the client of the CA of opts, verifying the signed certificates chain to the
+// pinned CA roots if any.
+func (a *Agent) newCAClient(opts *security.Options) (security.Client, error) {
+	if endpoints := strings.Split(opts.CAEndpoint, ","); len(endpoints) > 1 {
+		log.Infof("CA Endpoints %v, in order of preference", endpoints)
+		return caclient.NewFailoverClient(endpoints, func(endpoint string) (security.Client, error) {
+			endpointOpts := *opts
+			endpointOpts.CAEndpoint = strings.TrimSpace(endpoint)
+			return a.newCAClient(&endpointOpts)
+		})
+	}
+	log.Infof("CA Endpoint %s, provider %s", opts.CAEndpoint, opts.CAProviderName)
+
+	// CA providers other than Citadel are registered with security.RegisterCAClientFactory, including
+	// out-of-tree integrations compiled into the agent.
+	if factory, f := security.GetCAClientFactory(opts.CAProviderName); f {
+		caClient, err := factory(opts)
 		if err != nil {
-			return nil, err
-		}
-		return cache.NewSecretManagerClient(caClient, a.secOpts)
-	} else if a.secOpts.CAProviderName == security.GoogleCASProvider {
-		// Use a plugin
-		caClient, err := cas.NewGoogleCASClient(a.secOpts.CAEndpoint,
-			option.WithGRPCDialOption(grpc.WithPerRPCCredentials(caclient.NewCATokenProvider(a.secOpts))))
-		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to create client of CA provider %s: %v", opts.CAProviderName, err)
 		}
-		return cache.NewSecretManagerClient(caClient, a.secOpts)
+		return a.pinCAClient(caClient, opts)
+	}
+	if opts.CAProviderName != "" && opts.CAProviderName != security.CitadelCAProvider {
+		log.Warnf("Unknown CA provider %s, registered providers are %v. Using Citadel",
+			opts.CAProviderName, security.CAProviders())
 	}
 
 	// Using citadel CA
 	var rootCert []byte
+	var caCertFile string
 	var err error
 	// Special case: if Istiod runs on a secure network, on the default port, don't use TLS
 	// TODO: may add extra cases or explicit settings - but this is a rare use cases, mostly debugging
 	tls := true
-	if strings.HasSuffix(a.secOpts.CAEndpoint, ":15010") {
+	if strings.HasSuffix(opts.CAEndpoint, ":15010") {
 		tls = false
 		log.Warn("Debug mode or IP-secure network")
 	}
 	if tls {
-		caCertFile, err := a.FindRootCAForCA()
+		caCertFile, err = a.FindRootCAForCA()
 		if err != nil {
 			return nil, fmt.Errorf("failed to find root CA cert for CA: %v", err)
 		}
 
 		if caCertFile == "" {
-			log.Infof("Using CA %s cert with system certs", a.secOpts.CAEndpoint)
+			log.Infof("Using CA %s cert with system certs", opts.CAEndpoint)
 		} else if rootCert, err = os.ReadFile(caCertFile); err != nil {
-			log.Fatalf("invalid config - %s missing a root certificate %s", a.secOpts.CAEndpoint, caCertFile)
+			log.Fatalf("invalid config - %s missing a root certificate %s", opts.CAEndpoint, caCertFile)
 		} else {
-			log.Infof("Using CA %s cert with certs: %s", a.secOpts.CAEndpoint, caCertFile)
+			log.Infof("Using CA %s cert with certs: %s", opts.CAEndpoint, caCertFile)
 		}
 	}
 
 	// Will use TLS unless the reserved 15010 port is used ( istiod on an ipsec/secure VPC)
 	// rootCert may be nil - in which case the system roots are used, and the CA is expected to have public key
 	// Otherwise assume the injection has mounted /etc/certs/root-cert.pem
-	caClient, err := citadel.NewCitadelClient(a.secOpts, tls, rootCert)
+	caClient, err := citadel.NewCitadelClient(opts, tls, rootCert)
 	if err != nil {
 		return nil, err
 	}
+	// The roots are reloaded from the same file if the CA is no longer signed by them.
+	caClient.SetRootCertFile(caCertFile)
 
-	return cache.NewSecretManagerClient(caClient, a.secOpts)
+	return a.pinCAClient(caClient, opts)
+}
+
+// pinCAClient wraps caClient to verify the signed certificates chain to the pinned CA roots, if any.
+func (a *Agent) pinCAClient(caClient security.Client, opts *security.Options) (security.Client, error) {
+	if len(opts.CARootPins) == 0 {
+		return caClient, nil
+	}
+	pinned, err := caclient.NewPinnedRootClient(caClient, opts.CARootPins)
+	if err != nil {
+		caClient.Close()
+		return nil, err
+	}
+	log.Infof("Verifying certificates signed by CA %s chain to pinned roots %v", opts.CAEndpoint, opts.CARootPins)
+	return pinned, nil
 }
 
 // GRPCBootstrapPath returns the most recently generated gRPC bootstrap or nil if there is none.
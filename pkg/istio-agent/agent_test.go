@@ -301,6 +301,21 @@ func TestAgent(t *testing.T) {
 
 		a.Check(t, security.WorkloadKeyCertResourceName, security.RootCertReqResourceName)
 	})
+	t.Run("VMs bootstrapped with a platform credential", func(t *testing.T) {
+		// The platform credential, e.g. an instance identity document, is only accepted by the CA;
+		// every XDS connection is authenticated with the issued certificate instead.
+		a := Setup(t, func(a AgentTest) AgentTest {
+			a.CaAuthenticator.Set("platform-cred", "")
+			a.XdsAuthenticator.Set("", fakeSpiffeID)
+			a.Security.CredFetcher = plugin.CreateMockPlugin("platform-cred")
+			a.Security.JWTPath = ""
+			return a
+		})
+		a.Check(t, security.WorkloadKeyCertResourceName, security.RootCertReqResourceName)
+		// Reconnect, as after the platform credential is too old for the CA.
+		a.CaAuthenticator.Set("", "")
+		a.Check(t, security.WorkloadKeyCertResourceName, security.RootCertReqResourceName)
+	})
 	t.Run("Token exchange with credential fetcher downtime", func(t *testing.T) {
 		// This ensures our pre-warming is resilient to temporary downtime of the CA
 		dir := mktemp()
@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	kubelib "istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+	acme "istio.io/istio/security/pkg/nodeagent/caclient/providers/acme"
+	awspca "istio.io/istio/security/pkg/nodeagent/caclient/providers/aws-pca"
+	cfssl "istio.io/istio/security/pkg/nodeagent/caclient/providers/cfssl"
+	gca "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"
+	cas "istio.io/istio/security/pkg/nodeagent/caclient/providers/google-cas"
+	k8scsr "istio.io/istio/security/pkg/nodeagent/caclient/providers/kubernetes"
+	offlineca "istio.io/istio/security/pkg/nodeagent/caclient/providers/offline"
+	vault "istio.io/istio/security/pkg/nodeagent/caclient/providers/vault"
+	venafi "istio.io/istio/security/pkg/nodeagent/caclient/providers/venafi"
+)
+
+// The CA providers built into the agent. Citadel is not registered: it is the default for providers
+// without a factory, and locates its root certificate from the agent configuration.
+func init() {
+	mustRegisterCAClientFactory(security.GoogleCAProvider, func(o *security.Options) (security.Client, error) {
+		// Use a plugin to an external CA - this has direct support for the K8S JWT token
+		// This is only used if the proper env variables are injected - otherwise the existing Citadel or Istiod will be
+		// used.
+		return gca.NewGoogleCAClient(o.CAEndpoint, true, caclient.NewCATokenProvider(o), o)
+	})
+	mustRegisterCAClientFactory(security.GoogleCASProvider, func(o *security.Options) (security.Client, error) {
+		return cas.NewGoogleCASClient(o.CAEndpoint,
+			option.WithGRPCDialOption(grpc.WithPerRPCCredentials(caclient.NewCATokenProvider(o))))
+	})
+	mustRegisterCAClientFactory(security.OfflineCAProvider, func(o *security.Options) (security.Client, error) {
+		// No network path to a CA: CA_ADDR is the directory CSRs and signed chains are exchanged through.
+		return offlineca.NewOfflineCAClient(o.CAEndpoint)
+	})
+	mustRegisterCAClientFactory(security.VaultCAProvider, func(o *security.Options) (security.Client, error) {
+		return vault.NewVaultClient(vault.ConfigFromOptions(o))
+	})
+	mustRegisterCAClientFactory(security.AWSPCAProvider, func(o *security.Options) (security.Client, error) {
+		// The AWS credentials are those of the IAM role of the service account (IRSA), if any.
+		return awspca.NewAWSPCAClient(o.CAEndpoint)
+	})
+	mustRegisterCAClientFactory(security.ACMEProvider, func(o *security.Options) (security.Client, error) {
+		config, err := acme.ConfigFromEnv(o.CAEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		return acme.NewACMEClient(config)
+	})
+	mustRegisterCAClientFactory(security.KubernetesCSRProvider, func(o *security.Options) (security.Client, error) {
+		client, err := kubelib.CreateClientset("", "")
+		if err != nil {
+			return nil, err
+		}
+		return k8scsr.NewK8sCSRClient(client, o.CAEndpoint)
+	})
+	mustRegisterCAClientFactory(security.VenafiCAProvider, func(o *security.Options) (security.Client, error) {
+		return venafi.NewVenafiClient(venafi.ConfigFromOptions(o))
+	})
+	mustRegisterCAClientFactory(security.CFSSLCAProvider, func(o *security.Options) (security.Client, error) {
+		return cfssl.NewCFSSLClient(cfssl.ConfigFromOptions(o))
+	})
+}
+
+func mustRegisterCAClientFactory(name string, factory security.CAClientFactory) {
+	if err := security.RegisterCAClientFactory(name, factory); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcxds
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+)
+
+// The helpers below let proxyless gRPC workloads use the mesh identity for mTLS directly, instead of
+// pointing an xDS bootstrap at certificate files. The SecretManager is typically an sdsclient.Client
+// connected to the agent, or the agent's own secret cache when running in process.
+
+// ServerCredentials returns transport credentials for a gRPC server presenting the workload
+// certificate and requiring clients to present a certificate signed by the mesh trust bundle.
+// verifyIdentity, if not nil, authorizes the SPIFFE ID of each client.
+func ServerCredentials(secrets security.SecretManager, verifyIdentity func(identity string) error) credentials.TransportCredentials {
+	creds := security.NewTLSCredentials(secrets)
+	creds.VerifyIdentity = verifyIdentity
+	return credentials.NewTLS(creds.ServerConfig())
+}
+
+// ClientCredentials returns transport credentials for a gRPC client presenting the workload
+// certificate and verifying the server against the mesh trust bundle. verifyIdentity, if not nil,
+// authorizes the SPIFFE ID of the server.
+func ClientCredentials(secrets security.SecretManager, verifyIdentity func(identity string) error) credentials.TransportCredentials {
+	creds := security.NewTLSCredentials(secrets)
+	creds.VerifyIdentity = verifyIdentity
+	return credentials.NewTLS(creds.ClientConfig())
+}
+
+// DialOptions returns the options for a gRPC client to dial a mesh server with mTLS. If opts has a JWT
+// path or a credential fetcher, the workload token is also attached to each call, exchanged with the
+// configured TokenExchanger if any, as done for requests to the CA.
+func DialOptions(opts *security.Options, secrets security.SecretManager) []grpc.DialOption {
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(ClientCredentials(secrets, nil))}
+	if opts != nil && (opts.JWTPath != "" || opts.CredFetcher != nil) {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(caclient.NewCATokenProvider(opts)))
+	}
+	return dialOpts
+}
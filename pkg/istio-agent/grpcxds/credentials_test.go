@@ -0,0 +1,133 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcxds
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func meshSecrets(t *testing.T, caCert *x509.Certificate, caKey interface{}, caPEM []byte, identity string) security.SecretManager {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       identity,
+		SignerCert: caCert,
+		SignerPriv: caKey,
+		TTL:        time.Hour,
+		IsServer:   true,
+		IsClient:   true,
+		ECSigAlg:   util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := security.NewDirectSecretManager()
+	sm.Set(security.WorkloadKeyCertResourceName, &security.SecretItem{
+		CertificateChain: certPEM,
+		PrivateKey:       keyPEM,
+		ResourceName:     security.WorkloadKeyCertResourceName,
+	})
+	sm.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     caPEM,
+		ResourceName: security.RootCertReqResourceName,
+	})
+	return sm
+}
+
+type tokenCapture struct {
+	healthpb.HealthServer
+	tokens chan string
+}
+
+func (h *tokenCapture) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if auth := md.Get("authorization"); len(auth) == 1 {
+		h.tokens <- auth[0]
+	}
+	return h.HealthServer.Check(ctx, req)
+}
+
+func TestCredentials(t *testing.T) {
+	caPEM, caKeyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org:          "cluster.local",
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := util.ParsePemEncodedCertificate(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := util.ParsePemEncodedKey(caKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := make(chan string, 1)
+	server := grpc.NewServer(grpc.Creds(ServerCredentials(
+		meshSecrets(t, caCert, caKey, caPEM, "spiffe://cluster.local/ns/foo/sa/server"),
+		func(identity string) error {
+			clients <- identity
+			return nil
+		})))
+	hs := &tokenCapture{HealthServer: health.NewServer(), tokens: make(chan string, 1)}
+	healthpb.RegisterHealthServer(server, hs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	defer server.Stop()
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtPath, []byte("fake-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clientSecrets := meshSecrets(t, caCert, caKey, caPEM, "spiffe://cluster.local/ns/foo/sa/client")
+	conn, err := grpc.Dial(l.Addr().String(), DialOptions(&security.Options{JWTPath: jwtPath}, clientSecrets)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-clients; got != "spiffe://cluster.local/ns/foo/sa/client" {
+		t.Errorf("unexpected client identity %q", got)
+	}
+	if got := <-hs.tokens; got != "Bearer fake-jwt" {
+		t.Errorf("unexpected authorization header %q", got)
+	}
+}
@@ -18,7 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -154,9 +154,9 @@ func GenerateBootstrap(opts GenerateBootstrapOptions) (*Bootstrap, error) {
 			"default": {
 				PluginName: "file_watcher",
 				Config: FileWatcherCertProviderConfig{
-					PrivateKeyFile:    path.Join(opts.CertDir, "key.pem"),
-					CertificateFile:   path.Join(opts.CertDir, "cert-chain.pem"),
-					CACertificateFile: path.Join(opts.CertDir, "root-cert.pem"),
+					PrivateKeyFile:    filepath.Join(opts.CertDir, "key.pem"),
+					CertificateFile:   filepath.Join(opts.CertDir, "cert-chain.pem"),
+					CACertificateFile: filepath.Join(opts.CertDir, "root-cert.pem"),
 					RefreshDuration:   refresh,
 				},
 			},
@@ -55,6 +55,13 @@ var (
 		"The total number of Xds Proxy Responses",
 	)
 
+	// XdsBootstrapDuration records the time taken to prepare the XDS proxy and Envoy bootstrap at startup.
+	// This runs concurrently with the initial certificate fetch done by the SDS server.
+	XdsBootstrapDuration = monitoring.NewGauge(
+		"startup_xds_bootstrap_duration_seconds",
+		"The time taken to prepare the XDS proxy and Envoy bootstrap at startup, in seconds",
+	)
+
 	IstiodConnectionCancellations = istiodDisconnections.With(disconnectionTypeTag.Value(Cancel))
 	IstiodConnectionErrors        = istiodDisconnections.With(disconnectionTypeTag.Value(Error))
 	EnvoyConnectionCancellations  = envoyDisconnections.With(disconnectionTypeTag.Value(Cancel))
@@ -72,5 +79,6 @@ func init() {
 		IstiodConnectionErrors,
 		istiodDisconnections,
 		envoyDisconnections,
+		XdsBootstrapDuration,
 	)
 }
@@ -0,0 +1,109 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"os"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/filewatcher"
+	"istio.io/pkg/log"
+)
+
+// optionsReloadDebounce debounces the writes of the options reload file.
+const optionsReloadDebounce = 100 * time.Millisecond
+
+// initOptionsReloader creates the reloader of the options of the agent, and applies the overrides of
+// the options reload file to the options the agent starts with.
+func (a *Agent) initOptionsReloader() error {
+	a.optionsReloader = security.NewOptionsReloader(a.secOpts)
+	if err := a.reloadOptions(); err != nil {
+		return err
+	}
+	// Nothing uses the options yet, so the overrides are applied in place.
+	current := a.optionsReloader.Options()
+	a.secOpts.SecretTTL = current.SecretTTL
+	a.secOpts.SecretRotationGracePeriodRatio = current.SecretRotationGracePeriodRatio
+	a.secOpts.CAEndpoint = current.CAEndpoint
+	return nil
+}
+
+// reloadOptions reloads the options of the agent from the options reload file. A missing file
+// reverts to the options the agent was started with.
+func (a *Agent) reloadOptions() error {
+	ro := &security.ReloadableOptions{}
+	data, err := os.ReadFile(a.secOpts.OptionsReloadFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if ro, err = security.ParseReloadableOptions(data); err != nil {
+			return err
+		}
+	}
+	return a.optionsReloader.Reload(ro)
+}
+
+// watchOptionsReloadFile reloads the options of the agent when the options reload file changes.
+func (a *Agent) watchOptionsReloadFile() {
+	a.optionsWatcher = filewatcher.NewWatcher()
+	file := a.secOpts.OptionsReloadFile
+	if err := a.optionsWatcher.Add(file); err != nil {
+		log.Warnf("failed to watch options reload file %s, options will not be reloaded: %v", file, err)
+		return
+	}
+	events, errors := a.optionsWatcher.Events(file), a.optionsWatcher.Errors(file)
+	go func() {
+		var timerC <-chan time.Time
+		for {
+			select {
+			case <-timerC:
+				timerC = nil
+				if err := a.reloadOptions(); err != nil {
+					log.Errorf("failed to reload options from %s, keeping the current options: %v", file, err)
+				}
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+				if timerC == nil {
+					timerC = time.After(optionsReloadDebounce)
+				}
+			case err, ok := <-errors:
+				if !ok {
+					return
+				}
+				log.Warnf("error watching options reload file %s: %v", file, err)
+			}
+		}
+	}()
+}
+
+// onOptionsChange applies reloaded options to the workload certificates and the CA client.
+func (a *Agent) onOptionsChange(before, after *security.Options) {
+	log.Infof("reloaded options: TTL %v, grace period ratio %v, CA endpoint %s",
+		after.SecretTTL, after.SecretRotationGracePeriodRatio, after.CAEndpoint)
+	if before.CAEndpoint != after.CAEndpoint {
+		if a.caClient == nil {
+			log.Warnf("ignoring reloaded CA endpoint %s, the agent does not connect to a CA", after.CAEndpoint)
+		} else if caClient, err := a.newCAClient(after); err != nil {
+			log.Errorf("failed to connect to reloaded CA endpoint %s, keeping %s: %v", after.CAEndpoint, before.CAEndpoint, err)
+		} else {
+			a.caClient.Switch(caClient)
+		}
+	}
+	a.secretCache.UpdateRotationOptions(after)
+}
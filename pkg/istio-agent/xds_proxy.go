@@ -26,7 +26,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -55,10 +55,13 @@ import (
 	"istio.io/istio/pkg/istio-agent/health"
 	"istio.io/istio/pkg/istio-agent/metrics"
 	istiokeepalive "istio.io/istio/pkg/keepalive"
+	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/uds"
 	"istio.io/istio/pkg/util/gogo"
 	"istio.io/istio/pkg/wasm"
+	"istio.io/istio/security/pkg/nodeagent/cache"
 	"istio.io/istio/security/pkg/nodeagent/caclient"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	"istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/log"
 )
@@ -180,7 +183,17 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 			for _, cert := range caCerts {
 				trustBundle = util.AppendCertByte(trustBundle, []byte(cert))
 			}
-			return ia.secretCache.UpdateConfigTrustBundle(trustBundle)
+			// Reject an invalid identity policy before applying anything, so that istiod halts its rollout.
+			policy, err := cache.ParseIdentityPolicy(pc.GetProxyMetadata())
+			if err != nil {
+				log.Errorf("invalid identity policy in proxy config: %v", err)
+				return err
+			}
+			if err := ia.secretCache.UpdateConfigTrustBundle(trustBundle); err != nil {
+				return err
+			}
+			ia.secretCache.UpdateIdentityPolicy(policy)
+			return nil
 		}
 	}
 
@@ -612,11 +625,11 @@ func (p *XdsProxy) initDownstreamServer() error {
 func (p *XdsProxy) getCertKeyPaths(agent *Agent) (string, string) {
 	var key, cert string
 	if agent.secOpts.ProvCert != "" {
-		key = path.Join(agent.secOpts.ProvCert, constants.KeyFilename)
-		cert = path.Join(path.Join(agent.secOpts.ProvCert, constants.CertChainFilename))
+		key = filepath.Join(agent.secOpts.ProvCert, constants.KeyFilename)
+		cert = filepath.Join(agent.secOpts.ProvCert, constants.CertChainFilename)
 
-		// CSR may not have completed – use JWT to auth.
-		if _, err := os.Stat(key); os.IsNotExist(err) {
+		// CSR may not have completed – use JWT to auth. A key held by a KMS has no key file.
+		if _, err := os.Stat(key); os.IsNotExist(err) && agent.secOpts.ProvKeyProvider == nil {
 			return "", ""
 		}
 		if _, err := os.Stat(cert); os.IsNotExist(err) {
@@ -650,6 +663,9 @@ func (p *XdsProxy) buildUpstreamClientDialOpts(sa *Agent) ([]grpc.DialOption, er
 		keepaliveOption, initialWindowSizeOption, initialConnWindowSizeOption, msgSizeOption,
 	}
 
+	if sa.secOpts.EgressProxy != nil {
+		dialOptions = append(dialOptions, grpc.WithContextDialer(sa.secOpts.EgressProxy.DialContext))
+	}
 	if !sa.secOpts.FileMountedCerts {
 		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(caclient.NewXDSTokenProvider(sa.secOpts)))
 	}
@@ -658,6 +674,7 @@ func (p *XdsProxy) buildUpstreamClientDialOpts(sa *Agent) ([]grpc.DialOption, er
 
 // Returns the TLS option to use when talking to Istiod
 // If provisioned cert is set, it will return a mTLS related config
+// VMs bootstrapped with a platform credential instead present the certificate issued by the CA
 // Else it will return a one-way TLS related config with the assumption
 // that the consumer code will use tokens to authenticate the upstream.
 func (p *XdsProxy) getTLSDialOption(agent *Agent) (grpc.DialOption, error) {
@@ -669,13 +686,26 @@ func (p *XdsProxy) getTLSDialOption(agent *Agent) (grpc.DialOption, error) {
 		return nil, err
 	}
 
+	var issued *security.TLSCredentials
+	if agent.secOpts.CredFetcher != nil && agent.secOpts.JWTPath == "" && agent.secretCache != nil {
+		// The platform credential of VMs without a token, e.g. an instance identity document, is only
+		// a bootstrap credential for the CA, which may expire: XDS is authenticated with the issued certificate.
+		issued = security.NewTLSCredentials(agent.secretCache)
+	}
 	config := tls.Config{
-		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
 			var certificate tls.Certificate
 			key, cert := p.getCertKeyPaths(agent)
+			if key == "" && cert == "" && issued != nil {
+				return issued.GetClientCertificate(info)
+			}
 			if key != "" && cert != "" {
-				// Load the certificate from disk
-				certificate, err = tls.LoadX509KeyPair(cert, key)
+				// Load the certificate from disk. Only the key written by the agent itself is encrypted.
+				if agent.secOpts.ProvCert != "" {
+					certificate, err = nodeagentutil.LoadProvCert(context.Background(), agent.secOpts)
+				} else {
+					certificate, err = nodeagentutil.LoadKeyPair(cert, key, nil)
+				}
 				if err != nil {
 					return nil, err
 				}
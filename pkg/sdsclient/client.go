@@ -0,0 +1,335 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sdsclient fetches the workload certificate and trust bundle from the SDS socket of the
+// Istio agent, and keeps them up to date as the agent rotates them. It lets applications running
+// next to the agent use the mesh identity directly, without Envoy.
+package sdsclient
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	sds "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/util"
+	"istio.io/pkg/log"
+)
+
+const (
+	// DefaultSocket is the SDS socket of the agent, relative to the working directory of the proxy.
+	DefaultSocket = "./etc/istio/proxy/SDS"
+
+	// defaultNodeID identifies the client to the agent. The agent serves the same workload identity to
+	// every client, but requires a well formed node ID.
+	defaultNodeID = "sidecar~127.0.0.1~sdsclient.default~default.svc.cluster.local"
+)
+
+var sdsClientLog = log.RegisterScope("sdsclient", "SDS client debugging", 0)
+
+// Options configure the Client.
+type Options struct {
+	// Socket is the SDS socket of the agent. Defaults to DefaultSocket.
+	Socket string
+	// NodeID identifies the client to the agent. Optional.
+	NodeID string
+	// ResourceNames are the secrets to fetch. Defaults to the workload certificate and the root certificate.
+	ResourceNames []string
+}
+
+// Client keeps the latest secrets received from the agent. It implements security.SecretManager, so
+// the secrets can be consumed the same way as from the agent's own secret cache.
+type Client struct {
+	opts   Options
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.RWMutex
+	secrets     map[string]*security.SecretItem
+	ready       chan struct{}
+	callbacks   []func(*security.SecretItem)
+	subscribers []chan *security.SecretItem
+}
+
+var _ security.SecretManager = &Client{}
+
+// New connects to the agent and starts fetching the secrets in the background. Use WaitForSecrets to
+// wait for the initial secrets.
+func New(opts Options) (*Client, error) {
+	if opts.Socket == "" {
+		opts.Socket = DefaultSocket
+	}
+	if opts.NodeID == "" {
+		opts.NodeID = defaultNodeID
+	}
+	if len(opts.ResourceNames) == 0 {
+		opts.ResourceNames = []string{security.WorkloadKeyCertResourceName, security.RootCertReqResourceName}
+	}
+	socket := opts.Socket
+	conn, err := grpc.Dial(socket, grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SDS socket %s: %v", socket, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		opts:    opts,
+		conn:    conn,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		secrets: map[string]*security.SecretItem{},
+		ready:   make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c, nil
+}
+
+// WaitForSecrets blocks until all requested secrets have been received once, or ctx is done.
+func (c *Client) WaitForSecrets(ctx context.Context) error {
+	select {
+	case <-c.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GenerateSecret returns the latest secret received for resourceName.
+func (c *Client) GenerateSecret(resourceName string) (*security.SecretItem, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if secret, f := c.secrets[resourceName]; f {
+		return secret, nil
+	}
+	return nil, fmt.Errorf("secret %q has not been received from the agent", resourceName)
+}
+
+// GenerateSecretWithContext returns the latest secret received for resourceName, like GenerateSecret.
+func (c *Client) GenerateSecretWithContext(_ context.Context, resourceName string) (*security.SecretItem, error) {
+	return c.GenerateSecret(resourceName)
+}
+
+// GenerateSecrets returns the latest secrets received for resourceNames, like GenerateSecret.
+func (c *Client) GenerateSecrets(resourceNames []string) (map[string]*security.SecretItem, error) {
+	return c.GenerateSecretsWithContext(context.Background(), resourceNames)
+}
+
+// GenerateSecretsWithContext returns the latest secrets received for resourceNames, like GenerateSecret.
+func (c *Client) GenerateSecretsWithContext(_ context.Context, resourceNames []string) (map[string]*security.SecretItem, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	secrets := make(map[string]*security.SecretItem, len(resourceNames))
+	var missing []string
+	for _, name := range resourceNames {
+		if secret, f := c.secrets[name]; f {
+			secrets[name] = secret
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return secrets, fmt.Errorf("secrets %v have not been received from the agent", missing)
+	}
+	return secrets, nil
+}
+
+// GenerateJWTSVID is not supported: JWT SVIDs are not served over SDS.
+func (c *Client) GenerateJWTSVID(string) (*security.JWTSVID, error) {
+	return nil, errors.New("JWT SVIDs are not served over SDS")
+}
+
+// OnUpdate registers a callback invoked with every secret received from the agent, including the
+// initial ones. Callbacks are invoked sequentially and should not block.
+func (c *Client) OnUpdate(f func(*security.SecretItem)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.callbacks = append(c.callbacks, f)
+}
+
+// Updates returns a channel receiving every secret received from the agent. A receiver that falls
+// behind only gets the latest secret, so slow consumers never block the client.
+func (c *Client) Updates() <-chan *security.SecretItem {
+	ch := make(chan *security.SecretItem, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
+
+// Close stops fetching secrets and closes the connection to the agent. Channels returned by Updates
+// are closed.
+func (c *Client) Close() {
+	c.cancel()
+	<-c.done
+	c.conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range c.subscribers {
+		close(ch)
+	}
+	c.subscribers = nil
+}
+
+// run keeps a stream to the agent open until ctx is done, reconnecting with backoff.
+func (c *Client) run(ctx context.Context) {
+	defer close(c.done)
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+	for {
+		err := c.stream(ctx, b)
+		if ctx.Err() != nil {
+			return
+		}
+		wait := b.NextBackOff()
+		sdsClientLog.Warnf("SDS stream to %s failed, retrying in %v: %v", c.opts.Socket, wait, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) stream(ctx context.Context, b backoff.BackOff) error {
+	stream, err := sds.NewSecretDiscoveryServiceClient(c.conn).StreamSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	req := &discovery.DiscoveryRequest{
+		Node:          &core.Node{Id: c.opts.NodeID},
+		TypeUrl:       resource.SecretType,
+		ResourceNames: c.opts.ResourceNames,
+	}
+	for {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		b.Reset()
+		req = &discovery.DiscoveryRequest{
+			TypeUrl:       resource.SecretType,
+			ResourceNames: c.opts.ResourceNames,
+			VersionInfo:   resp.VersionInfo,
+			ResponseNonce: resp.Nonce,
+		}
+		if err := c.handleResponse(resp); err != nil {
+			// NACK the response, keeping the previous secrets.
+			sdsClientLog.Warnf("rejecting SDS response: %v", err)
+			req.ErrorDetail = &status.Status{Message: err.Error()}
+		}
+	}
+}
+
+func (c *Client) handleResponse(resp *discovery.DiscoveryResponse) error {
+	secrets := make([]*security.SecretItem, 0, len(resp.Resources))
+	for _, res := range resp.Resources {
+		secret := &tls.Secret{}
+		if err := res.UnmarshalTo(secret); err != nil {
+			return fmt.Errorf("failed to unmarshal secret: %v", err)
+		}
+		item, err := toSecretItem(secret)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, item)
+	}
+
+	c.mu.Lock()
+	for _, s := range secrets {
+		c.secrets[s.ResourceName] = s
+	}
+	ready := true
+	for _, name := range c.opts.ResourceNames {
+		if _, f := c.secrets[name]; !f {
+			ready = false
+		}
+	}
+	if ready {
+		select {
+		case <-c.ready:
+		default:
+			close(c.ready)
+		}
+	}
+	callbacks := c.callbacks
+	c.mu.Unlock()
+
+	for _, s := range secrets {
+		sdsClientLog.Debugf("received secret %q", s.ResourceName)
+		for _, f := range callbacks {
+			f(s)
+		}
+		c.publish(s)
+	}
+	return nil
+}
+
+// publish sends the secret to the subscribers, replacing any secret they have not received yet.
+func (c *Client) publish(s *security.SecretItem) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, ch := range c.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+}
+
+func toSecretItem(secret *tls.Secret) (*security.SecretItem, error) {
+	item := &security.SecretItem{
+		ResourceName: secret.Name,
+		CreatedTime:  time.Now(),
+	}
+	switch t := secret.Type.(type) {
+	case *tls.Secret_TlsCertificate:
+		item.CertificateChain = t.TlsCertificate.GetCertificateChain().GetInlineBytes()
+		item.PrivateKey = t.TlsCertificate.GetPrivateKey().GetInlineBytes()
+		leaf, err := util.ParseLeafCert(item.CertificateChain)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate chain for %q: %v", secret.Name, err)
+		}
+		item.Leaf = leaf
+		item.ExpireTime = leaf.NotAfter
+	case *tls.Secret_ValidationContext:
+		item.RootCert = t.ValidationContext.GetTrustedCa().GetInlineBytes()
+		if !x509.NewCertPool().AppendCertsFromPEM(item.RootCert) {
+			return nil, fmt.Errorf("invalid root certificate for %q", secret.Name)
+		}
+	default:
+		return nil, errors.New("unsupported secret type for " + secret.Name)
+	}
+	return item, nil
+}
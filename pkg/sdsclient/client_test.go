@@ -0,0 +1,141 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdsclient
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/sds"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testAgent struct {
+	server *sds.Server
+	store  *security.DirectSecretManager
+}
+
+func (a *testAgent) rotate(t *testing.T) *security.SecretItem {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         "spiffe://cluster.local/ns/foo/sa/bar",
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &security.SecretItem{
+		CertificateChain: certPEM,
+		PrivateKey:       keyPEM,
+		ResourceName:     security.WorkloadKeyCertResourceName,
+	}
+	a.store.Set(security.WorkloadKeyCertResourceName, secret)
+	a.store.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     certPEM,
+		ResourceName: security.RootCertReqResourceName,
+	})
+	a.server.UpdateCallback(security.WorkloadKeyCertResourceName)
+	return secret
+}
+
+func setupAgent(t *testing.T) (*testAgent, string) {
+	socket := filepath.Join(t.TempDir(), "SDS")
+	store := security.NewDirectSecretManager()
+	server := sds.NewServer(&security.Options{WorkloadUDSPath: socket}, store)
+	t.Cleanup(server.Stop)
+	return &testAgent{server: server, store: store}, socket
+}
+
+func TestClient(t *testing.T) {
+	agent, socket := setupAgent(t)
+	initial := agent.rotate(t)
+
+	client, err := New(Options{Socket: socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	updates := client.Updates()
+	var callbacks []string
+	callbackCh := make(chan string, 10)
+	client.OnUpdate(func(s *security.SecretItem) { callbackCh <- s.ResourceName })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.WaitForSecrets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.CertificateChain, initial.CertificateChain) || !bytes.Equal(secret.PrivateKey, initial.PrivateKey) {
+		t.Fatalf("unexpected workload secret")
+	}
+	if secret.Leaf == nil || secret.ExpireTime.IsZero() {
+		t.Fatalf("expected parsed leaf certificate, got %+v", secret)
+	}
+	root, err := client.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.RootCert, initial.CertificateChain) {
+		t.Fatalf("unexpected root certificate")
+	}
+
+	rotated := agent.rotate(t)
+	for {
+		select {
+		case s := <-updates:
+			if s.ResourceName == security.WorkloadKeyCertResourceName && bytes.Equal(s.CertificateChain, rotated.CertificateChain) {
+				secret, _ := client.GenerateSecret(security.WorkloadKeyCertResourceName)
+				if !bytes.Equal(secret.CertificateChain, rotated.CertificateChain) {
+					t.Fatalf("rotated secret was not stored")
+				}
+				for len(callbackCh) > 0 {
+					callbacks = append(callbacks, <-callbackCh)
+				}
+				if len(callbacks) == 0 {
+					t.Fatalf("expected callbacks to be invoked")
+				}
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for rotated secret")
+		}
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	_, socket := setupAgent(t)
+	client, err := New(Options{Socket: socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := client.Updates()
+	client.Close()
+	if _, ok := <-updates; ok {
+		t.Fatal("expected updates channel to be closed")
+	}
+	if _, err := client.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil {
+		t.Fatal("expected error for secret that was never received")
+	}
+}
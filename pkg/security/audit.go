@@ -0,0 +1,253 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// AuthnAuditExportMethod is the gRPC method the records are exported to by the grpc:// and grpcs://
+	// audit sinks. Its request is a google.protobuf.Struct of the JSON fields of AuthnAuditRecord,
+	// and its response a google.protobuf.Empty.
+	AuthnAuditExportMethod = "/istio.security.v1alpha1.AuthnAuditService/Export"
+
+	// authnAuditBufferSize is the number of records buffered by the gRPC audit sink, beyond which
+	// records are dropped rather than slowing down authentication.
+	authnAuditBufferSize    = 1024
+	authnAuditExportTimeout = 5 * time.Second
+)
+
+// AuthnAuditRecord records an authentication attempt by an Authenticator.
+type AuthnAuditRecord struct {
+	Time          time.Time `json:"time"`
+	Authenticator string    `json:"authenticator"`
+	// RequestType is the full gRPC method, or the HTTP method and path of the request.
+	RequestType string `json:"requestType"`
+	PeerAddress string `json:"peerAddress,omitempty"`
+	Success     bool   `json:"success"`
+	// AuthSource and Identities are those of the authenticated caller.
+	AuthSource string   `json:"authSource,omitempty"`
+	Identities []string `json:"identities,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// AuthnAuditSink records the authentication attempts of the Authenticators. Record must not block.
+type AuthnAuditSink interface {
+	Record(record *AuthnAuditRecord)
+}
+
+// NewAuthnAuditSink returns the audit sink of uri: "stdout" writes JSON lines to the standard
+// output, file:///path appends them to a file, and grpc://host:port or grpcs://host:port exports
+// the records to AuthnAuditExportMethod over plain text or TLS.
+func NewAuthnAuditSink(uri string) (AuthnAuditSink, error) {
+	if uri == "stdout" {
+		return &jsonAuditSink{w: os.Stdout}, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication audit sink: %v", err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid authentication audit sink %q: no path", uri)
+		}
+		f, err := os.OpenFile(u.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the authentication audit log: %v", err)
+		}
+		return &jsonAuditSink{w: f}, nil
+	case "grpc", "grpcs":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid authentication audit sink %q: no host", uri)
+		}
+		return newGRPCAuditSink(u)
+	}
+	return nil, fmt.Errorf("unsupported authentication audit sink %q", uri)
+}
+
+// jsonAuditSink writes the records as JSON lines.
+type jsonAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *jsonAuditSink) Record(record *AuthnAuditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		auditLog.Errorf("failed to encode the authentication audit record: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		auditLog.Errorf("failed to write the authentication audit record: %v", err)
+	}
+}
+
+// grpcAuditSink exports the records asynchronously to AuthnAuditExportMethod.
+type grpcAuditSink struct {
+	conn    *grpc.ClientConn
+	records chan *AuthnAuditRecord
+}
+
+func newGRPCAuditSink(u *url.URL) (*grpcAuditSink, error) {
+	creds := grpc.WithInsecure()
+	if u.Scheme == "grpcs" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the system root certificates: %v", err)
+		}
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}))
+	}
+	conn, err := grpc.Dial(u.Host, creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the authentication audit sink %s: %v", u.Host, err)
+	}
+	s := &grpcAuditSink{conn: conn, records: make(chan *AuthnAuditRecord, authnAuditBufferSize)}
+	go s.export()
+	return s, nil
+}
+
+func (s *grpcAuditSink) Record(record *AuthnAuditRecord) {
+	select {
+	case s.records <- record:
+	default:
+		auditLog.Warnf("authentication audit buffer is full, dropping the record of %s", record.RequestType)
+	}
+}
+
+func (s *grpcAuditSink) export() {
+	for record := range s.records {
+		req, err := auditRecordStruct(record)
+		if err != nil {
+			auditLog.Errorf("failed to encode the authentication audit record: %v", err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), authnAuditExportTimeout)
+		if err := s.conn.Invoke(ctx, AuthnAuditExportMethod, req, &emptypb.Empty{}); err != nil {
+			auditLog.Warnf("failed to export the authentication audit record: %v", err)
+		}
+		cancel()
+	}
+}
+
+// auditRecordStruct returns the JSON fields of record as a Struct.
+func auditRecordStruct(record *AuthnAuditRecord) (*structpb.Struct, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(fields)
+}
+
+// AuditAuthenticators returns the authenticators recording their authentication attempts to sink, or
+// authenticators if sink is nil. Authenticators already audited are unchanged.
+func AuditAuthenticators(authenticators []Authenticator, sink AuthnAuditSink) []Authenticator {
+	if sink == nil {
+		return authenticators
+	}
+	audited := make([]Authenticator, 0, len(authenticators))
+	for _, a := range authenticators {
+		switch a.(type) {
+		case *auditedAuthenticator, *auditedCSRAuthenticator:
+			audited = append(audited, a)
+			continue
+		}
+		aa := &auditedAuthenticator{Authenticator: a, sink: sink}
+		if csrAuthn, ok := a.(CSRAuthenticator); ok {
+			audited = append(audited, &auditedCSRAuthenticator{auditedAuthenticator: aa, csrAuthn: csrAuthn})
+		} else {
+			audited = append(audited, aa)
+		}
+	}
+	return audited
+}
+
+// auditedAuthenticator records the authentication attempts of an Authenticator.
+type auditedAuthenticator struct {
+	Authenticator
+	sink AuthnAuditSink
+}
+
+func (a *auditedAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	caller, err := a.Authenticator.Authenticate(ctx)
+	requestType, _ := grpc.Method(ctx)
+	var peerAddress string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddress = p.Addr.String()
+	}
+	a.record(requestType, peerAddress, caller, err)
+	return caller, err
+}
+
+func (a *auditedAuthenticator) AuthenticateRequest(req *http.Request) (*Caller, error) {
+	caller, err := a.Authenticator.AuthenticateRequest(req)
+	a.record(req.Method+" "+req.URL.Path, req.RemoteAddr, caller, err)
+	return caller, err
+}
+
+func (a *auditedAuthenticator) record(requestType, peerAddress string, caller *Caller, err error) {
+	record := &AuthnAuditRecord{
+		Time:          time.Now(),
+		Authenticator: a.AuthenticatorType(),
+		RequestType:   requestType,
+		PeerAddress:   peerAddress,
+		Success:       err == nil && caller != nil,
+	}
+	if record.Success {
+		record.AuthSource = caller.AuthSource.String()
+		record.Identities = caller.Identities
+	} else if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Error = "no caller authenticated"
+	}
+	a.sink.Record(record)
+}
+
+// auditedCSRAuthenticator records the authentication attempts of an Authenticator that is also a
+// CSRAuthenticator.
+type auditedCSRAuthenticator struct {
+	*auditedAuthenticator
+	csrAuthn CSRAuthenticator
+}
+
+func (a *auditedCSRAuthenticator) AuthenticateCSR(csr *x509.CertificateRequest) (*Caller, error) {
+	caller, err := a.csrAuthn.AuthenticateCSR(csr)
+	a.record("CSR", "", caller, err)
+	return caller, err
+}
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type recordingSink struct {
+	records []*AuthnAuditRecord
+}
+
+func (s *recordingSink) Record(record *AuthnAuditRecord) {
+	s.records = append(s.records, record)
+}
+
+func TestAuditAuthenticators(t *testing.T) {
+	sink := &recordingSink{}
+	authenticators := AuditAuthenticators([]Authenticator{NewFakeAuthenticator("fake").Set("token", "")}, sink)
+	if again := AuditAuthenticators(authenticators, sink); again[0] != authenticators[0] {
+		t.Fatal("expected an audited authenticator to be unchanged")
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+
+	okCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer token"))
+	if _, err := authenticators[0].Authenticate(okCtx); err != nil {
+		t.Fatal(err)
+	}
+	badCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer wrong"))
+	if _, err := authenticators[0].Authenticate(badCtx); err == nil {
+		t.Fatal("expected the wrong token to be rejected")
+	}
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 records, got %v", sink.records)
+	}
+	success, failure := sink.records[0], sink.records[1]
+	if !success.Success || success.AuthSource != "id-token" || len(success.Identities) != 1 ||
+		success.PeerAddress != "10.0.0.1:1234" || success.Authenticator != "fake" {
+		t.Errorf("unexpected success record %+v", success)
+	}
+	if failure.Success || failure.Error == "" || len(failure.Identities) != 0 {
+		t.Errorf("unexpected failure record %+v", failure)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewAuthnAuditSink("file://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(&AuthnAuditRecord{Authenticator: "fake", RequestType: "/test", Success: true})
+	sink.Record(&AuthnAuditRecord{Authenticator: "fake", RequestType: "/test", Error: "denied"})
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", b)
+	}
+	record := &AuthnAuditRecord{}
+	if err := json.Unmarshal([]byte(lines[1]), record); err != nil || record.Error != "denied" {
+		t.Fatalf("got %+v, %v, expected the failure record", record, err)
+	}
+
+	for _, uri := range []string{"file://", "grpc://", "http://collector", "%"} {
+		if _, err := NewAuthnAuditSink(uri); err == nil {
+			t.Errorf("expected %q to be invalid", uri)
+		}
+	}
+}
+
+func TestGRPCAuditSink(t *testing.T) {
+	exported := make(chan *structpb.Struct, 1)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		if method, _ := grpc.MethodFromServerStream(stream); method != AuthnAuditExportMethod {
+			t.Errorf("got method %s, expected %s", method, AuthnAuditExportMethod)
+		}
+		req := &structpb.Struct{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		exported <- req
+		return stream.SendMsg(&emptypb.Empty{})
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	sink, err := NewAuthnAuditSink("grpc://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Record(&AuthnAuditRecord{Authenticator: "fake", Identities: []string{"spiffe://cluster.local/ns/a/sa/b"}, Success: true})
+	select {
+	case req := <-exported:
+		if got := req.Fields["authenticator"].GetStringValue(); got != "fake" {
+			t.Errorf("got authenticator %q, expected fake", got)
+		}
+		if got := req.Fields["identities"].GetListValue().GetValues(); len(got) != 1 {
+			t.Errorf("got identities %v, expected one", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the record to be exported")
+	}
+}
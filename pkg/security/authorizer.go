@@ -0,0 +1,69 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+)
+
+// ResourceType is the type of a Resource requested by an authenticated Caller.
+type ResourceType string
+
+const (
+	// ResourceCertificate is a certificate requested with a CSR.
+	ResourceCertificate ResourceType = "certificate"
+	// ResourceSDS is a secret requested with SDS.
+	ResourceSDS ResourceType = "sds"
+	// ResourceJWTSVID is a JWT SVID requested from the CA.
+	ResourceJWTSVID ResourceType = "jwt-svid"
+)
+
+// Resource is the resource requested by an authenticated Caller.
+type Resource struct {
+	Type ResourceType
+	// Identities are the identities of the certificate requested, for ResourceCertificate, or the
+	// subject of the token requested, for ResourceJWTSVID.
+	Identities []string
+	// Name is the name of the secret requested, for ResourceSDS, or the audience of the token
+	// requested, for ResourceJWTSVID.
+	Name string
+}
+
+// Authorizer decides whether an authenticated Caller may get a Resource. It is invoked after
+// authentication, so that issuance policy is enforced in a single place rather than by each
+// authenticator and server.
+type Authorizer interface {
+	// Authorize returns an error if caller may not get resource.
+	Authorize(ctx context.Context, caller *Caller, resource Resource) error
+}
+
+// AuthorizerFunc is an Authorizer implemented by a function.
+type AuthorizerFunc func(ctx context.Context, caller *Caller, resource Resource) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, caller *Caller, resource Resource) error {
+	return f(ctx, caller, resource)
+}
+
+// Authorizers is an Authorizer requiring all its authorizers to authorize the resource.
+type Authorizers []Authorizer
+
+func (a Authorizers) Authorize(ctx context.Context, caller *Caller, resource Resource) error {
+	for _, authz := range a {
+		if err := authz.Authorize(ctx, caller, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// awsIAMTokenPrefix distinguishes an encoded AWSIAMToken from a JWT or an InstanceIdentityToken.
+	awsIAMTokenPrefix = "aws-iam."
+
+	// AWSIAMServerIDHeader is the header of the signed GetCallerIdentity request naming the server it
+	// is intended for, so that a request captured by another server cannot be replayed to istiod.
+	AWSIAMServerIDHeader = "X-Istio-Aws-Iam-Server-Id"
+)
+
+// AWSIAMToken carries an STS GetCallerIdentity request signed with the AWS IAM credentials of an
+// agent, sent as the bearer token of the CSR request. Istiod sends the request to STS to learn the
+// IAM identity of the agent, without the credentials themselves leaving the agent.
+type AWSIAMToken struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Body    string      `json:"body"`
+	Headers http.Header `json:"headers"`
+}
+
+// Encode returns the bearer token form of the request.
+func (t *AWSIAMToken) Encode() (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return awsIAMTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsAWSIAMToken returns true if the bearer token was produced by AWSIAMToken.Encode.
+func IsAWSIAMToken(token string) bool {
+	return strings.HasPrefix(token, awsIAMTokenPrefix)
+}
+
+// ParseAWSIAMToken decodes a bearer token produced by AWSIAMToken.Encode. The signature is not
+// verified.
+func ParseAWSIAMToken(token string) (*AWSIAMToken, error) {
+	if !IsAWSIAMToken(token) {
+		return nil, fmt.Errorf("not an AWS IAM token")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, awsIAMTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode AWS IAM token: %v", err)
+	}
+	t := &AWSIAMToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal AWS IAM token: %v", err)
+	}
+	if t.Method == "" || t.URL == "" || len(t.Headers) == 0 {
+		return nil, fmt.Errorf("AWS IAM token is missing the method, URL or headers of the request")
+	}
+	return t, nil
+}
@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CAClientFactory creates the Client signing the workload certificates of an agent configured with
+// options. options.CAEndpoint is the address of the CA.
+type CAClientFactory func(options *Options) (Client, error)
+
+var (
+	caClientFactoriesMutex sync.RWMutex
+	caClientFactories      = map[string]CAClientFactory{}
+)
+
+// RegisterCAClientFactory registers the factory of the Client of the CA provider name, so that agents
+// configured with that CAProviderName sign their workload certificates with it. It is meant to be
+// called from the init function of CA integrations built into the agent, and fails if a factory is
+// already registered for name.
+func RegisterCAClientFactory(name string, factory CAClientFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("invalid CA provider %q", name)
+	}
+	caClientFactoriesMutex.Lock()
+	defer caClientFactoriesMutex.Unlock()
+	if _, f := caClientFactories[name]; f {
+		return fmt.Errorf("CA provider %q is already registered", name)
+	}
+	caClientFactories[name] = factory
+	return nil
+}
+
+// UnregisterCAClientFactory removes the factory registered for the CA provider name, if any.
+func UnregisterCAClientFactory(name string) {
+	caClientFactoriesMutex.Lock()
+	defer caClientFactoriesMutex.Unlock()
+	delete(caClientFactories, name)
+}
+
+// GetCAClientFactory returns the factory registered for the CA provider name, if any.
+func GetCAClientFactory(name string) (CAClientFactory, bool) {
+	caClientFactoriesMutex.RLock()
+	defer caClientFactoriesMutex.RUnlock()
+	factory, f := caClientFactories[name]
+	return factory, f
+}
+
+// CAProviders returns the sorted names of the registered CA providers.
+func CAProviders() []string {
+	caClientFactoriesMutex.RLock()
+	defer caClientFactoriesMutex.RUnlock()
+	names := make([]string, 0, len(caClientFactories))
+	for name := range caClientFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
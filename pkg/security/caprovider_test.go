@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type fakeCAClient struct {
+	endpoint string
+}
+
+func (c *fakeCAClient) CSRSign(context.Context, []byte, int64) ([]string, error) { return nil, nil }
+
+func (c *fakeCAClient) Close() {}
+
+func (c *fakeCAClient) GetRootCertBundle(context.Context) ([]string, error) { return nil, nil }
+
+func TestRegisterCAClientFactory(t *testing.T) {
+	factory := func(o *Options) (Client, error) {
+		return &fakeCAClient{endpoint: o.CAEndpoint}, nil
+	}
+	if err := RegisterCAClientFactory("Fake", factory); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterCAClientFactory("Fake")
+	if err := RegisterCAClientFactory("Fake", factory); err == nil {
+		t.Fatal("expected registering a CA provider twice to fail")
+	}
+	if err := RegisterCAClientFactory("", factory); err == nil {
+		t.Fatal("expected registering a CA provider without name to fail")
+	}
+
+	got, f := GetCAClientFactory("Fake")
+	if !f {
+		t.Fatal("expected CA provider to be registered")
+	}
+	client, err := got(&Options{CAEndpoint: "ca.example.com:443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.(*fakeCAClient).endpoint != "ca.example.com:443" {
+		t.Fatalf("unexpected client %+v", client)
+	}
+	if names := CAProviders(); !reflect.DeepEqual(names, []string{"Fake"}) {
+		t.Fatalf("unexpected CA providers %v", names)
+	}
+
+	UnregisterCAClientFactory("Fake")
+	if _, f := GetCAClientFactory("Fake"); f {
+		t.Fatal("expected CA provider to be unregistered")
+	}
+}
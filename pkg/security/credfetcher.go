@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CredFetcherFactory creates the CredFetcher of an agent configured with options. options.TrustDomain,
+// JWTPath and CredIdentityProvider are set.
+type CredFetcherFactory func(options *Options) (CredFetcher, error)
+
+var (
+	credFetcherFactoriesMutex sync.RWMutex
+	credFetcherFactories      = map[string]CredFetcherFactory{}
+)
+
+// RegisterCredFetcherFactory registers the factory of the CredFetcher of type name, so that agents
+// configured with that CREDENTIAL_FETCHER_TYPE authenticate with its credential. It is meant to be
+// called from the init function of the credential fetchers built into the agent, and fails if a
+// factory is already registered for name.
+func RegisterCredFetcherFactory(name string, factory CredFetcherFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("invalid credential fetcher type %q", name)
+	}
+	credFetcherFactoriesMutex.Lock()
+	defer credFetcherFactoriesMutex.Unlock()
+	if _, f := credFetcherFactories[name]; f {
+		return fmt.Errorf("credential fetcher type %q is already registered", name)
+	}
+	credFetcherFactories[name] = factory
+	return nil
+}
+
+// UnregisterCredFetcherFactory removes the factory registered for the credential fetcher type name, if any.
+func UnregisterCredFetcherFactory(name string) {
+	credFetcherFactoriesMutex.Lock()
+	defer credFetcherFactoriesMutex.Unlock()
+	delete(credFetcherFactories, name)
+}
+
+// GetCredFetcherFactory returns the factory registered for the credential fetcher type name, if any.
+func GetCredFetcherFactory(name string) (CredFetcherFactory, bool) {
+	credFetcherFactoriesMutex.RLock()
+	defer credFetcherFactoriesMutex.RUnlock()
+	factory, f := credFetcherFactories[name]
+	return factory, f
+}
+
+// CredFetcherTypes returns the sorted names of the registered credential fetcher types.
+func CredFetcherTypes() []string {
+	credFetcherFactoriesMutex.RLock()
+	defer credFetcherFactoriesMutex.RUnlock()
+	names := make([]string, 0, len(credFetcherFactories))
+	for name := range credFetcherFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,68 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"reflect"
+	"testing"
+)
+
+type fakeCredFetcher struct {
+	identityProvider string
+}
+
+func (f *fakeCredFetcher) GetPlatformCredential() (string, error) { return "token", nil }
+
+func (f *fakeCredFetcher) GetType() string { return "Fake" }
+
+func (f *fakeCredFetcher) GetIdentityProvider() string { return f.identityProvider }
+
+func (f *fakeCredFetcher) Stop() {}
+
+func TestRegisterCredFetcherFactory(t *testing.T) {
+	factory := func(o *Options) (CredFetcher, error) {
+		return &fakeCredFetcher{identityProvider: o.CredIdentityProvider}, nil
+	}
+	if err := RegisterCredFetcherFactory("Fake", factory); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterCredFetcherFactory("Fake")
+	if err := RegisterCredFetcherFactory("Fake", factory); err == nil {
+		t.Fatal("expected registering a credential fetcher type twice to fail")
+	}
+	if err := RegisterCredFetcherFactory("", factory); err == nil {
+		t.Fatal("expected registering a credential fetcher type without name to fail")
+	}
+
+	got, f := GetCredFetcherFactory("Fake")
+	if !f {
+		t.Fatal("expected credential fetcher type to be registered")
+	}
+	fetcher, err := got(&Options{CredIdentityProvider: "idp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.GetIdentityProvider() != "idp" {
+		t.Fatalf("unexpected credential fetcher %+v", fetcher)
+	}
+	if names := CredFetcherTypes(); !reflect.DeepEqual(names, []string{"Fake"}) {
+		t.Fatalf("unexpected credential fetcher types %v", names)
+	}
+
+	UnregisterCredFetcherFactory("Fake")
+	if _, f := GetCredFetcherFactory("Fake"); f {
+		t.Fatal("expected credential fetcher type to be unregistered")
+	}
+}
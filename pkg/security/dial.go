@@ -0,0 +1,69 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"time"
+
+	retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"go.opencensus.io/plugin/ocgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// CADialOptions returns the options of the connections to gRPC CAs implementing the retry policy,
+// keepalive, request deadline and egress proxy of o, or the defaults if o is nil. The trace context
+// of the requests is propagated to the CA.
+func CADialOptions(o *Options) []grpc.DialOption {
+	if o == nil {
+		o = &Options{}
+	}
+	policy := o.CARetryPolicy
+	if policy == nil {
+		policy = &DefaultCARetryPolicy
+	}
+	// The deadline applies to each attempt rather than to the retries as a whole, so that an attempt
+	// timing out is retried.
+	interceptors := []grpc.UnaryClientInterceptor{retry.UnaryClientInterceptor(policy.CallOptions()...)}
+	if o.CARPCTimeout > 0 {
+		interceptors = append(interceptors, rpcTimeoutInterceptor(o.CARPCTimeout))
+	}
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(interceptors...),
+		grpc.WithStatsHandler(&ocgrpc.ClientHandler{}),
+	}
+	if o.CAKeepaliveInterval > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.CAKeepaliveInterval,
+			Timeout:             o.CAKeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	if o.EgressProxy != nil {
+		opts = append(opts, grpc.WithContextDialer(o.EgressProxy.DialContext))
+	}
+	return opts
+}
+
+// rpcTimeoutInterceptor sets a deadline of timeout on the requests, unless an earlier one is set.
+func rpcTimeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// instanceIdentityTokenPrefix distinguishes an encoded InstanceIdentityToken from a JWT,
+// which always has three dot separated parts.
+const instanceIdentityTokenPrefix = "iid."
+
+// InstanceIdentityToken carries a signed cloud instance identity document from a VM agent to
+// istiod, where it is sent as the bearer token of the CSR request in place of a JWT.
+type InstanceIdentityToken struct {
+	// Platform is the credential fetcher type that produced the document, e.g. AWS or Azure.
+	Platform string `json:"platform"`
+	// Document is the raw identity document, if it is not embedded in the signature.
+	Document string `json:"document,omitempty"`
+	// Signature is the base64 encoded signature over the document. For Azure it is a PKCS#7
+	// SignedData blob that also carries the document.
+	Signature string `json:"signature"`
+}
+
+// Encode returns the bearer token form of the document.
+func (t *InstanceIdentityToken) Encode() (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return instanceIdentityTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsInstanceIdentityToken returns true if the bearer token was produced by InstanceIdentityToken.Encode.
+func IsInstanceIdentityToken(token string) bool {
+	return strings.HasPrefix(token, instanceIdentityTokenPrefix)
+}
+
+// ParseInstanceIdentityToken decodes a bearer token produced by InstanceIdentityToken.Encode.
+// The signature is not verified.
+func ParseInstanceIdentityToken(token string) (*InstanceIdentityToken, error) {
+	if !IsInstanceIdentityToken(token) {
+		return nil, fmt.Errorf("not an instance identity token")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, instanceIdentityTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode instance identity token: %v", err)
+	}
+	t := &InstanceIdentityToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal instance identity token: %v", err)
+	}
+	if t.Platform == "" || t.Signature == "" {
+		return nil, fmt.Errorf("instance identity token is missing platform or signature")
+	}
+	return t, nil
+}
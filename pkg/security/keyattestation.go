@@ -0,0 +1,58 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// TPMAttestation is the attestation produced by a TPM backed KeyAttestor: a TPM2 quote over the
+// CSR key digest, signed by an attestation key (AK) resident in the TPM.
+type TPMAttestation struct {
+	// AKCertificate is the DER encoded certificate of the attestation key.
+	AKCertificate []byte `json:"akCertificate"`
+	// Attest is the TPMS_ATTEST structure returned by TPM2_Quote, with the key digest as qualifying data.
+	Attest []byte `json:"attest"`
+	// Signature is the AK signature over Attest.
+	Signature []byte `json:"signature"`
+}
+
+// Encode returns the form of the attestation sent in the KeyAttestationMeta metadata.
+func (a *TPMAttestation) Encode() (string, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseTPMAttestation decodes an attestation produced by TPMAttestation.Encode. The signature is
+// not verified.
+func ParseTPMAttestation(encoded string) (*TPMAttestation, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode TPM attestation: %v", err)
+	}
+	a := &TPMAttestation{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TPM attestation: %v", err)
+	}
+	if len(a.AKCertificate) == 0 || len(a.Attest) == 0 || len(a.Signature) == 0 {
+		return nil, fmt.Errorf("TPM attestation is incomplete")
+	}
+	return a, nil
+}
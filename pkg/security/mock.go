@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/hashicorp/go-multierror"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
@@ -32,15 +33,17 @@ import (
 )
 
 type DirectSecretManager struct {
-	items map[string]*SecretItem
-	mu    sync.RWMutex
+	items    map[string]*SecretItem
+	jwtSVIDs map[string]*JWTSVID
+	mu       sync.RWMutex
 }
 
 var _ SecretManager = &DirectSecretManager{}
 
 func NewDirectSecretManager() *DirectSecretManager {
 	return &DirectSecretManager{
-		items: map[string]*SecretItem{},
+		items:    map[string]*SecretItem{},
+		jwtSVIDs: map[string]*JWTSVID{},
 	}
 }
 
@@ -54,6 +57,48 @@ func (d *DirectSecretManager) GenerateSecret(resourceName string) (*SecretItem,
 	return si, nil
 }
 
+func (d *DirectSecretManager) GenerateSecretWithContext(_ context.Context, resourceName string) (*SecretItem, error) {
+	return d.GenerateSecret(resourceName)
+}
+
+func (d *DirectSecretManager) GenerateSecrets(resourceNames []string) (map[string]*SecretItem, error) {
+	return d.GenerateSecretsWithContext(context.Background(), resourceNames)
+}
+
+func (d *DirectSecretManager) GenerateSecretsWithContext(_ context.Context, resourceNames []string) (map[string]*SecretItem, error) {
+	secrets := make(map[string]*SecretItem, len(resourceNames))
+	var errs *multierror.Error
+	for _, name := range resourceNames {
+		si, err := d.GenerateSecret(name)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		secrets[name] = si
+	}
+	return secrets, errs.ErrorOrNil()
+}
+
+func (d *DirectSecretManager) GenerateJWTSVID(audience string) (*JWTSVID, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	svid, f := d.jwtSVIDs[audience]
+	if !f {
+		return nil, fmt.Errorf("JWT SVID for audience %v not found", audience)
+	}
+	return svid, nil
+}
+
+func (d *DirectSecretManager) SetJWTSVID(audience string, svid *JWTSVID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if svid == nil {
+		delete(d.jwtSVIDs, audience)
+	} else {
+		d.jwtSVIDs[audience] = svid
+	}
+}
+
 func (d *DirectSecretManager) Set(resourceName string, secret *SecretItem) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
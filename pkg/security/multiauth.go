@@ -0,0 +1,219 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+// AuthenticationMode is how a MultiAuthenticator combines the results of its authenticators.
+type AuthenticationMode string
+
+const (
+	// AuthenticationFirstSuccess runs the authenticators in order until one succeeds, and returns
+	// its caller.
+	AuthenticationFirstSuccess AuthenticationMode = "first-success"
+	// AuthenticationAllRequired requires all the authenticators to succeed, and returns the caller
+	// of the first with the identities common to all the callers.
+	AuthenticationAllRequired AuthenticationMode = "all-required"
+	// AuthenticationAny runs all the authenticators, requires one to succeed, and returns the caller
+	// of the first that succeeded with the identities of all the callers.
+	AuthenticationAny AuthenticationMode = "any"
+
+	MultiAuthenticatorType = "MultiAuthenticator"
+)
+
+// ParseAuthenticationMode returns the AuthenticationMode of mode, first-success if empty.
+func ParseAuthenticationMode(mode string) (AuthenticationMode, error) {
+	switch m := AuthenticationMode(mode); m {
+	case "":
+		return AuthenticationFirstSuccess, nil
+	case AuthenticationFirstSuccess, AuthenticationAllRequired, AuthenticationAny:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported authentication mode %q, expected %s, %s or %s",
+		mode, AuthenticationFirstSuccess, AuthenticationAllRequired, AuthenticationAny)
+}
+
+// MultiAuthenticator runs an ordered list of authenticators, combining their results per its mode.
+type MultiAuthenticator struct {
+	mode           AuthenticationMode
+	authenticators []Authenticator
+}
+
+var (
+	_ Authenticator    = &MultiAuthenticator{}
+	_ CSRAuthenticator = &MultiAuthenticator{}
+)
+
+// NewMultiAuthenticator returns the MultiAuthenticator running authenticators in order per mode,
+// first-success if empty.
+func NewMultiAuthenticator(mode AuthenticationMode, authenticators ...Authenticator) *MultiAuthenticator {
+	if mode == "" {
+		mode = AuthenticationFirstSuccess
+	}
+	return &MultiAuthenticator{mode: mode, authenticators: authenticators}
+}
+
+func (m *MultiAuthenticator) AuthenticatorType() string {
+	return MultiAuthenticatorType
+}
+
+func (m *MultiAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	return m.authenticate(m.authenticators, func(a Authenticator) (*Caller, error) {
+		return a.Authenticate(ctx)
+	})
+}
+
+func (m *MultiAuthenticator) AuthenticateRequest(req *http.Request) (*Caller, error) {
+	return m.authenticate(m.authenticators, func(a Authenticator) (*Caller, error) {
+		return a.AuthenticateRequest(req)
+	})
+}
+
+// AuthenticateCSR authenticates csr with the authenticators implementing CSRAuthenticator.
+func (m *MultiAuthenticator) AuthenticateCSR(csr *x509.CertificateRequest) (*Caller, error) {
+	var csrAuthenticators []Authenticator
+	for _, a := range m.authenticators {
+		if _, ok := a.(CSRAuthenticator); ok {
+			csrAuthenticators = append(csrAuthenticators, a)
+		}
+	}
+	return m.authenticate(csrAuthenticators, func(a Authenticator) (*Caller, error) {
+		return a.(CSRAuthenticator).AuthenticateCSR(csr)
+	})
+}
+
+func (m *MultiAuthenticator) authenticate(authenticators []Authenticator,
+	authenticate func(Authenticator) (*Caller, error)) (*Caller, error) {
+	if len(authenticators) == 0 {
+		return nil, errors.New("no authenticator is configured")
+	}
+	var callers []*Caller
+	var failures []string
+	for i, a := range authenticators {
+		caller, err := authenticate(a)
+		if err == nil && caller == nil {
+			err = errors.New("no caller authenticated")
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Authenticator %s at index %d got error: %v", a.AuthenticatorType(), i, err))
+			if m.mode == AuthenticationAllRequired {
+				break
+			}
+			continue
+		}
+		if m.mode == AuthenticationFirstSuccess {
+			return caller, nil
+		}
+		callers = append(callers, caller)
+	}
+	if len(failures) > 0 && (m.mode == AuthenticationAllRequired || len(callers) == 0) {
+		return nil, errors.New(strings.Join(failures, "; "))
+	}
+	return m.combine(callers)
+}
+
+// combine returns the caller combining the callers of the all-required or any modes.
+func (m *MultiAuthenticator) combine(callers []*Caller) (*Caller, error) {
+	combined := *callers[0]
+	combined.Identities = nil
+	seen := map[string]int{}
+	for _, caller := range callers {
+		for _, id := range uniqueIdentities(caller.Identities) {
+			if seen[id] == 0 && (m.mode == AuthenticationAny || caller == callers[0]) {
+				combined.Identities = append(combined.Identities, id)
+			}
+			seen[id]++
+		}
+		if caller != callers[0] && caller.Redeem != nil {
+			combined.Redeem = chainRedeem(combined.Redeem, caller.Redeem)
+		}
+		if caller.KeyDigest == nil {
+			continue
+		}
+		// The caller is bound to the key of any of the callers, which must then agree on it.
+		if combined.KeyDigest != nil && !bytes.Equal(combined.KeyDigest, caller.KeyDigest) {
+			return nil, errors.New("authenticators bound the caller to different keys")
+		}
+		combined.KeyDigest = caller.KeyDigest
+	}
+	if m.mode == AuthenticationAllRequired {
+		common := combined.Identities[:0]
+		for _, id := range combined.Identities {
+			if seen[id] == len(callers) {
+				common = append(common, id)
+			}
+		}
+		if len(common) == 0 {
+			return nil, errors.New("authenticators authenticated no common identity")
+		}
+		combined.Identities = common
+	}
+	// Keep the parsed SPIFFE IDs of the combined identities.
+	combined.SpiffeIDs = nil
+	for _, id := range combined.Identities {
+		for _, caller := range callers {
+			if sid, ok := findSpiffeID(caller.SpiffeIDs, id); ok {
+				combined.SpiffeIDs = append(combined.SpiffeIDs, sid)
+				break
+			}
+		}
+	}
+	return &combined, nil
+}
+
+// chainRedeem returns a Redeem calling first, then second.
+func chainRedeem(first, second func(ctx context.Context) error) func(ctx context.Context) error {
+	if first == nil {
+		return second
+	}
+	return func(ctx context.Context) error {
+		if err := first(ctx); err != nil {
+			return err
+		}
+		return second(ctx)
+	}
+}
+
+func findSpiffeID(ids []spiffe.ID, id string) (spiffe.ID, bool) {
+	for _, sid := range ids {
+		if sid.String() == id {
+			return sid, true
+		}
+	}
+	return spiffe.ID{}, false
+}
+
+// uniqueIdentities returns ids without duplicates.
+func uniqueIdentities(ids []string) []string {
+	unique := make([]string, 0, len(ids))
+	seen := map[string]struct{}{}
+	for _, id := range ids {
+		if _, f := seen[id]; !f {
+			seen[id] = struct{}{}
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// staticAuthenticator authenticates all the calls as caller, or fails with err.
+type staticAuthenticator struct {
+	caller *Caller
+	err    error
+	calls  int
+}
+
+func (a *staticAuthenticator) Authenticate(context.Context) (*Caller, error) {
+	a.calls++
+	return a.caller, a.err
+}
+
+func (a *staticAuthenticator) AuthenticateRequest(*http.Request) (*Caller, error) {
+	a.calls++
+	return a.caller, a.err
+}
+
+func (a *staticAuthenticator) AuthenticatorType() string {
+	return "static"
+}
+
+func TestMultiAuthenticator(t *testing.T) {
+	caller := func(source AuthSource, ids ...string) *staticAuthenticator {
+		return &staticAuthenticator{caller: &Caller{AuthSource: source, Identities: ids}}
+	}
+	failure := func() *staticAuthenticator {
+		return &staticAuthenticator{err: errors.New("denied")}
+	}
+	cases := []struct {
+		name           string
+		mode           AuthenticationMode
+		authenticators []*staticAuthenticator
+		want           *Caller
+		calls          []int
+	}{
+		{
+			name:           "first-success returns the first caller",
+			mode:           AuthenticationFirstSuccess,
+			authenticators: []*staticAuthenticator{failure(), caller(AuthSourceIDToken, "a"), caller(AuthSourceClientCertificate, "b")},
+			want:           &Caller{AuthSource: AuthSourceIDToken, Identities: []string{"a"}},
+			calls:          []int{1, 1, 0},
+		},
+		{
+			name:           "first-success fails if all fail",
+			mode:           AuthenticationFirstSuccess,
+			authenticators: []*staticAuthenticator{failure(), failure()},
+			calls:          []int{1, 1},
+		},
+		{
+			name:           "all-required returns the common identities",
+			mode:           AuthenticationAllRequired,
+			authenticators: []*staticAuthenticator{caller(AuthSourceClientCertificate, "a", "b"), caller(AuthSourceIDToken, "b", "c")},
+			want:           &Caller{AuthSource: AuthSourceClientCertificate, Identities: []string{"b"}},
+			calls:          []int{1, 1},
+		},
+		{
+			name:           "all-required fails on the first failure",
+			mode:           AuthenticationAllRequired,
+			authenticators: []*staticAuthenticator{caller(AuthSourceIDToken, "a"), failure(), caller(AuthSourceIDToken, "a")},
+			calls:          []int{1, 1, 0},
+		},
+		{
+			name:           "all-required fails without common identities",
+			mode:           AuthenticationAllRequired,
+			authenticators: []*staticAuthenticator{caller(AuthSourceIDToken, "a"), caller(AuthSourceIDToken, "b")},
+			calls:          []int{1, 1},
+		},
+		{
+			name:           "any returns the identities of all callers",
+			mode:           AuthenticationAny,
+			authenticators: []*staticAuthenticator{failure(), caller(AuthSourceIDToken, "a"), caller(AuthSourceClientCertificate, "a", "b")},
+			want:           &Caller{AuthSource: AuthSourceIDToken, Identities: []string{"a", "b"}},
+			calls:          []int{1, 1, 1},
+		},
+		{
+			name:           "any fails if all fail",
+			mode:           AuthenticationAny,
+			authenticators: []*staticAuthenticator{failure()},
+			calls:          []int{1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			authenticators := make([]Authenticator, 0, len(tc.authenticators))
+			for _, a := range tc.authenticators {
+				authenticators = append(authenticators, a)
+			}
+			got, err := NewMultiAuthenticator(tc.mode, authenticators...).Authenticate(context.Background())
+			if tc.want == nil && err == nil {
+				t.Fatalf("expected authentication to fail, got %+v", got)
+			}
+			if tc.want != nil && (err != nil || !reflect.DeepEqual(got, tc.want)) {
+				t.Fatalf("got %+v, %v, expected %+v", got, err, tc.want)
+			}
+			for i, a := range tc.authenticators {
+				if a.calls != tc.calls[i] {
+					t.Errorf("authenticator %d called %d times, expected %d", i, a.calls, tc.calls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMultiAuthenticatorRedeem(t *testing.T) {
+	var redeemed []string
+	redeem := func(id string) func(context.Context) error {
+		return func(context.Context) error {
+			redeemed = append(redeemed, id)
+			return nil
+		}
+	}
+	authenticators := []Authenticator{
+		&staticAuthenticator{caller: &Caller{Identities: []string{"a"}, Redeem: redeem("first")}},
+		&staticAuthenticator{caller: &Caller{Identities: []string{"a"}}},
+		&staticAuthenticator{caller: &Caller{Identities: []string{"a"}, Redeem: redeem("third")}},
+	}
+	caller, err := NewMultiAuthenticator(AuthenticationAllRequired, authenticators...).Authenticate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.Redeem(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The credentials of all the callers are spent.
+	if expected := []string{"first", "third"}; !reflect.DeepEqual(redeemed, expected) {
+		t.Errorf("got redeemed %v, expected %v", redeemed, expected)
+	}
+}
+
+func TestParseAuthenticationMode(t *testing.T) {
+	if m, err := ParseAuthenticationMode(""); err != nil || m != AuthenticationFirstSuccess {
+		t.Errorf("got %v, %v, expected the default mode", m, err)
+	}
+	if _, err := ParseAuthenticationMode("all"); err == nil {
+		t.Error("expected an unsupported mode to be rejected")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ReloadableOptions are the overrides of the Options that can change without restarting the agent.
+// Zero values keep the options the agent was started with.
+type ReloadableOptions struct {
+	// SecretTTL overrides Options.SecretTTL, e.g. "12h".
+	SecretTTL string `json:"secretTTL,omitempty"`
+	// SecretRotationGracePeriodRatio overrides Options.SecretRotationGracePeriodRatio.
+	SecretRotationGracePeriodRatio float64 `json:"secretRotationGracePeriodRatio,omitempty"`
+	// CAEndpoint overrides Options.CAEndpoint.
+	CAEndpoint string `json:"caEndpoint,omitempty"`
+}
+
+// ParseReloadableOptions parses the YAML or JSON encoded ReloadableOptions in data.
+func ParseReloadableOptions(data []byte) (*ReloadableOptions, error) {
+	ro := &ReloadableOptions{}
+	if err := yaml.UnmarshalStrict(data, ro); err != nil {
+		return nil, fmt.Errorf("invalid reloadable options: %v", err)
+	}
+	return ro, nil
+}
+
+// apply returns base with the overrides of ro.
+func (ro *ReloadableOptions) apply(base Options) (Options, error) {
+	if ro.SecretTTL != "" {
+		ttl, err := time.ParseDuration(ro.SecretTTL)
+		if err != nil || ttl <= 0 {
+			return base, fmt.Errorf("invalid secretTTL %q", ro.SecretTTL)
+		}
+		base.SecretTTL = ttl
+	}
+	if ro.SecretRotationGracePeriodRatio != 0 {
+		if ro.SecretRotationGracePeriodRatio < 0 || ro.SecretRotationGracePeriodRatio > 1 {
+			return base, fmt.Errorf("invalid secretRotationGracePeriodRatio %v, expected a ratio between 0 and 1",
+				ro.SecretRotationGracePeriodRatio)
+		}
+		base.SecretRotationGracePeriodRatio = ro.SecretRotationGracePeriodRatio
+	}
+	if ro.CAEndpoint != "" {
+		base.CAEndpoint = ro.CAEndpoint
+	}
+	return base, nil
+}
+
+// OptionsChangeHandler is called with the Options before and after a reload.
+type OptionsChangeHandler func(before, after *Options)
+
+// OptionsReloader holds the Options of the agent, of which the ReloadableOptions can change without
+// restart, and notifies their changes.
+type OptionsReloader struct {
+	// reloadMu serializes the reloads, so that the handlers see the changes in order.
+	reloadMu sync.Mutex
+	mu       sync.Mutex
+	base     Options
+	current  Options
+	handlers []OptionsChangeHandler
+}
+
+// NewOptionsReloader returns an OptionsReloader of the Options the agent was started with.
+func NewOptionsReloader(base *Options) *OptionsReloader {
+	return &OptionsReloader{base: *base, current: *base}
+}
+
+// Options returns a copy of the current Options.
+func (r *OptionsReloader) Options() Options {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnOptionsChange adds a handler called after each reload changing the Options.
+func (r *OptionsReloader) OnOptionsChange(h OptionsChangeHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, h)
+}
+
+// Reload applies ro to the Options the agent was started with, so that removed overrides revert to
+// them, and notifies the handlers if the Options change. Invalid overrides are rejected as a whole.
+func (r *OptionsReloader) Reload(ro *ReloadableOptions) error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	r.mu.Lock()
+	next, err := ro.apply(r.base)
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	old := r.current
+	if old.SecretTTL == next.SecretTTL && old.SecretRotationGracePeriodRatio == next.SecretRotationGracePeriodRatio &&
+		old.CAEndpoint == next.CAEndpoint {
+		r.mu.Unlock()
+		return nil
+	}
+	r.current = next
+	handlers := append([]OptionsChangeHandler(nil), r.handlers...)
+	r.mu.Unlock()
+	for _, h := range handlers {
+		h(&old, &next)
+	}
+	return nil
+}
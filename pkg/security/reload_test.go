@@ -0,0 +1,65 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsReloader(t *testing.T) {
+	r := NewOptionsReloader(&Options{SecretTTL: 24 * time.Hour, SecretRotationGracePeriodRatio: 0.5, CAEndpoint: "istiod:15012"})
+	var changes []Options
+	r.OnOptionsChange(func(before, after *Options) {
+		changes = append(changes, *after)
+	})
+
+	ro, err := ParseReloadableOptions([]byte("secretTTL: 1h\ncaEndpoint: istiod-canary:15012\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(ro); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].SecretTTL != time.Hour || changes[0].CAEndpoint != "istiod-canary:15012" ||
+		changes[0].SecretRotationGracePeriodRatio != 0.5 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	// Reloading the same options is not a change.
+	if err := r.Reload(ro); err != nil || len(changes) != 1 {
+		t.Fatalf("expected no change, got %v, %d changes", err, len(changes))
+	}
+
+	for _, data := range []string{"secretTTL: foo", "secretRotationGracePeriodRatio: 2", "secretTL: 1h"} {
+		ro, err := ParseReloadableOptions([]byte(data))
+		if err == nil {
+			err = r.Reload(ro)
+		}
+		if err == nil {
+			t.Fatalf("expected an error for %q", data)
+		}
+	}
+	if r.Options().SecretTTL != time.Hour || len(changes) != 1 {
+		t.Fatalf("expected invalid options to be rejected")
+	}
+
+	// Removed overrides revert to the options the agent was started with.
+	if err := r.Reload(&ReloadableOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Options(); got.SecretTTL != 24*time.Hour || got.CAEndpoint != "istiod:15012" || len(changes) != 2 {
+		t.Fatalf("expected the options to be reverted, got %+v", got)
+	}
+}
@@ -15,11 +15,19 @@
 package security
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"istio.io/istio/security/pkg/monitoring"
 	"istio.io/pkg/log"
@@ -27,19 +35,66 @@ import (
 
 var caLog = log.RegisterScope("ca", "ca client", 0)
 
-// CARetryOptions returns the default retry options recommended for CA calls
-// This includes 5 retries, with backoff from 100ms -> 1.6s with jitter.
-var CARetryOptions = []retry.CallOption{
-	retry.WithMax(5),
-	retry.WithBackoff(wrapBackoffWithMetrics(retry.BackoffExponentialWithJitter(100*time.Millisecond, 0.1))),
-	retry.WithCodes(codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unavailable),
+// CARetryPolicy is the policy of the retries of the CA requests failing with a transient status.
+type CARetryPolicy struct {
+	// MaxRetries is the number of retries of a request, 0 disabling them.
+	MaxRetries uint
+	// Backoff is the delay before the first retry, doubled on each subsequent retry, with 10% jitter.
+	Backoff time.Duration
+	// Codes are the statuses of the requests that are retried.
+	Codes []codes.Code
 }
 
+// DefaultCARetryPolicy is the CARetryPolicy recommended for CA calls: 5 retries, with backoff from
+// 100ms -> 1.6s with jitter.
+var DefaultCARetryPolicy = CARetryPolicy{
+	MaxRetries: 5,
+	Backoff:    100 * time.Millisecond,
+	Codes: []codes.Code{
+		codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.Internal, codes.Unavailable,
+	},
+}
+
+// CallOptions returns the retry options implementing p.
+func (p *CARetryPolicy) CallOptions() []retry.CallOption {
+	return []retry.CallOption{
+		retry.WithMax(p.MaxRetries),
+		retry.WithBackoff(wrapBackoffWithMetrics(retry.BackoffExponentialWithJitter(p.Backoff, 0.1))),
+		retry.WithCodes(p.Codes...),
+	}
+}
+
+// CARetryOptions returns the default retry options recommended for CA calls, those of
+// DefaultCARetryPolicy.
+var CARetryOptions = DefaultCARetryPolicy.CallOptions()
+
 // CARetryInterceptor is a grpc UnaryInterceptor that adds retry options, as a convenience wrapper
-// around CARetryOptions. If needed to chain with other interceptors, the CARetryOptions can be used
-// directly.
-func CARetryInterceptor() grpc.DialOption {
-	return grpc.WithUnaryInterceptor(retry.UnaryClientInterceptor(CARetryOptions...))
+// around CARetryPolicy.CallOptions. policy defaults to DefaultCARetryPolicy if nil. If needed to
+// chain with other interceptors, the CallOptions can be used directly.
+func CARetryInterceptor(policy *CARetryPolicy) grpc.DialOption {
+	if policy == nil {
+		policy = &DefaultCARetryPolicy
+	}
+	return grpc.WithUnaryInterceptor(retry.UnaryClientInterceptor(policy.CallOptions()...))
+}
+
+// ParseCARetryCodes parses the comma separated names of gRPC status codes, such as
+// "UNAVAILABLE,DEADLINE_EXCEEDED".
+func ParseCARetryCodes(names string) ([]codes.Code, error) {
+	var ret []codes.Code
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return nil, fmt.Errorf("invalid gRPC status code %q", name)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
 }
 
 // grpcretry has no hooks to trigger logic on failure (https://github.com/grpc-ecosystem/go-grpc-middleware/issues/375)
@@ -52,3 +107,120 @@ func wrapBackoffWithMetrics(bf retry.BackoffFunc) retry.BackoffFunc {
 		return wait
 	}
 }
+
+// CAPressureRetryDelay reports whether err indicates the CA is overloaded or unavailable
+// (RESOURCE_EXHAUSTED or UNAVAILABLE). If the CA attached a RetryInfo detail to the error, the
+// requested delay is returned as well, allowing Istiod to spread out retries across the fleet.
+func CAPressureRetryDelay(err error) (time.Duration, bool) {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return 0, false
+	}
+	st := se.GRPCStatus()
+	if st.Code() != codes.ResourceExhausted && st.Code() != codes.Unavailable {
+		return 0, false
+	}
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay != nil {
+			return ri.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, true
+}
+
+// IssuanceError is a failure to obtain a workload certificate, while fetching the platform credential,
+// exchanging the token or signing the CSR, classified as retryable or fatal. Retryable errors are
+// transient, such as an unreachable token service, and are retried with backoff. Fatal errors indicate
+// a misconfiguration that retrying will not fix, such as a token exchange rejected for an invalid
+// audience.
+type IssuanceError struct {
+	Err   error
+	Fatal bool
+}
+
+// NewRetryableError classifies err as a retryable issuance error.
+func NewRetryableError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &IssuanceError{Err: err}
+}
+
+// NewFatalError classifies err as a fatal issuance error.
+func NewFatalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &IssuanceError{Err: err, Fatal: true}
+}
+
+func (e *IssuanceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *IssuanceError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus preserves the classification when the error is returned by gRPC per-RPC credentials,
+// which would otherwise turn it into UNAUTHENTICATED: fatal errors become FAILED_PRECONDITION and
+// retryable errors UNAVAILABLE.
+func (e *IssuanceError) GRPCStatus() *status.Status {
+	if e.Fatal {
+		return status.New(codes.FailedPrecondition, e.Error())
+	}
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// IsFatalError reports whether err is a fatal issuance error: either explicitly classified by
+// NewFatalError, or a CA status that indicates the request itself is wrong (INVALID_ARGUMENT,
+// PERMISSION_DENIED, FAILED_PRECONDITION or UNIMPLEMENTED). UNAUTHENTICATED is retryable, as the
+// credential may be refreshed, and so are errors that are not classified.
+func IsFatalError(err error) bool {
+	var ie *IssuanceError
+	if errors.As(err, &ie) {
+		return ie.Fatal
+	}
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.GRPCStatus().Code() {
+	case codes.InvalidArgument, codes.PermissionDenied, codes.FailedPrecondition, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// DecorrelatedJitterBackoff implements the "decorrelated jitter" backoff algorithm: each delay is
+// picked at random between Base and three times the previous delay, capped at Max. Compared to
+// exponential backoff, this avoids clients that failed at the same time from retrying in lock-step.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	mu   sync.Mutex
+	prev time.Duration
+}
+
+// NextBackOff returns the delay to wait before the next attempt.
+func (b *DecorrelatedJitterBackoff) NextBackOff() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.prev < b.Base {
+		b.prev = b.Base
+	}
+	next := b.Base + time.Duration(rand.Int63n(int64(3*b.prev-b.Base)+1))
+	if next > b.Max {
+		next = b.Max
+	}
+	b.prev = next
+	return next
+}
+
+// Reset restarts the backoff sequence, typically after a successful attempt.
+func (b *DecorrelatedJitterBackoff) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prev = 0
+}
@@ -16,14 +16,22 @@ package security
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc/metadata"
 
+	"istio.io/istio/pkg/spiffe"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/env"
+	"istio.io/pkg/log"
 )
 
 const (
@@ -46,22 +54,101 @@ const (
 	// RootCertReqResourceName is resource name of discovery request for root certificate.
 	RootCertReqResourceName = "ROOTCA"
 
+	// TrustDomainRootCertResourcePrefix prefixes the trust domain in the resource names of the root
+	// certificates of a single trust domain, such as a federated one: "ROOTCA:<trust domain>".
+	TrustDomainRootCertResourcePrefix = RootCertReqResourceName + ":"
+
 	// WorkloadKeyCertResourceName is the resource name of the discovery request for workload
 	// identity.
 	// TODO: change all the pilot one reference definition here instead.
 	WorkloadKeyCertResourceName = "default"
 
+	// WorkloadKeyCertTTLResourcePrefix prefixes the requested TTL in the resource names of the
+	// workload identity with a TTL shorter than the configured one, such as for batch jobs:
+	// "default:<duration>", e.g. "default:15m".
+	WorkloadKeyCertTTLResourcePrefix = WorkloadKeyCertResourceName + ":"
+
+	// WorkloadKeyCertRSAResourceName and WorkloadKeyCertECDSAResourceName are the resource names of the
+	// workload identity with an RSA and an ECDSA key respectively, whatever the key type of
+	// WorkloadKeyCertResourceName, so that servers can present both.
+	WorkloadKeyCertRSAResourceName   = "default-rsa"
+	WorkloadKeyCertECDSAResourceName = "default-ecdsa"
+
 	// GCE is Credential fetcher type of Google plugin
 	GCE = "GoogleComputeEngine"
 
+	// AWS is Credential fetcher type of the AWS EC2 instance identity document plugin
+	AWS = "AmazonEC2"
+
+	// Azure is Credential fetcher type of the Azure attested metadata plugin
+	Azure = "AzureVirtualMachine"
+
+	// AzureManagedIdentity is Credential fetcher type of the Azure plugin fetching an Azure AD access
+	// token of the managed identity of the VM
+	AzureManagedIdentity = "AzureManagedIdentity"
+
+	// AWSIAM is Credential fetcher type of the AWS IAM plugin, signing an STS GetCallerIdentity request
+	// with the IAM credentials of the workload, e.g. of an EC2 instance profile or EKS service account
+	AWSIAM = "AmazonIAM"
+
+	// Exec is Credential fetcher type of the exec plugin, running an operator supplied command following
+	// the contract of the kubectl credential plugins
+	Exec = "Exec"
+
+	// TokenFile is Credential fetcher type of the plugin reading the token of a file, and watching it
+	// for rotations
+	TokenFile = "TokenFile"
+
+	// SPIRE is Credential fetcher type of the plugin fetching a JWT SVID of the workload from the
+	// Workload API of a local SPIRE agent
+	SPIRE = "SPIRE"
+
+	// CIOIDC is Credential fetcher type of the plugin fetching an OIDC token of the CI job from the
+	// token endpoint of the CI system, e.g. of GitHub Actions
+	CIOIDC = "CIOIDC"
+
 	// Mock is Credential fetcher type of mock plugin
 	Mock = "Mock" // testing only
 
+	// CitadelCAProvider uses Istiod, or another CA implementing the Istio certificate service, for
+	// workload certificate signing. It is used for CA providers without a registered CAClientFactory.
+	CitadelCAProvider = "Citadel"
+
 	// GoogleCAProvider uses the Google CA for workload certificate signing
 	GoogleCAProvider = "GoogleCA"
 
 	// GoogleCASProvider uses the Google certificate Authority Service to sign workload certificates
 	GoogleCASProvider = "GoogleCAS"
+
+	// OfflineCAProvider writes CSRs to the directory set as the CA address and waits for the
+	// certificate chain to be signed out-of-band, for agents without a network path to any CA
+	OfflineCAProvider = "Offline"
+
+	// VaultCAProvider signs workload certificates with the PKI secrets engine of HashiCorp Vault,
+	// logging in with the Kubernetes auth method
+	VaultCAProvider = "Vault"
+
+	// AWSPCAProvider signs workload certificates with AWS Certificate Manager Private Certificate
+	// Authority, with the ARN of the CA as the CA address
+	AWSPCAProvider = "AWSPCA"
+
+	// ACMEProvider orders workload certificates from an ACME (RFC 8555) server, with the URL of its
+	// directory as the CA address and the roots of the CA in ACME_ROOT_CERT_FILE. No challenge is
+	// fulfilled: the server must pre-authorize the account of the agent for the workload identifiers,
+	// e.g. through an external account binding
+	ACMEProvider = "ACME"
+
+	// KubernetesCSRProvider signs workload certificates with a Kubernetes signer, through
+	// CertificateSigningRequests, with the name of the signer as the CA address
+	KubernetesCSRProvider = "KubernetesCSR"
+
+	// VenafiCAProvider requests workload certificates from Venafi Trust Protection Platform or Venafi
+	// as a Service, subject to the policy of the zone, with the URL of the platform as the CA address
+	VenafiCAProvider = "Venafi"
+
+	// CFSSLCAProvider signs workload certificates with the remote signing API of a CFSSL server, with
+	// the URL of the server as the CA address
+	CFSSLCAProvider = "CFSSL"
 )
 
 // TODO: For 1.8, make sure MeshConfig is updated with those settings,
@@ -79,15 +166,66 @@ var (
 	TokenAudiences = strings.Split(env.RegisterStringVar("TOKEN_AUDIENCES", "istio-ca",
 		"A list of comma separated audiences to check in the JWT token before issuing a certificate. "+
 			"The token is accepted if it matches with one of the audiences").Get(), ",")
+
+	// AllowAlternativeTokenLocations accepts access tokens sent in the access_token form body or URI
+	// query parameter of requests without authorization header, as allowed by RFC 6750 for clients
+	// unable to set headers. Each use is recorded in the audit log.
+	AllowAlternativeTokenLocations = env.RegisterBoolVar("ALLOW_ALTERNATIVE_TOKEN_LOCATIONS", false,
+		"If enabled, HTTP requests without authorization header may send their token in the access_token form "+
+			"body or query parameter, as defined by RFC 6750. Tokens in URIs are easily leaked through logs and "+
+			"browser history; only enable for constrained clients.").Get()
+
+	// AuthorizationHeaderPolicy selects the token of requests with several authorization header values,
+	// repeated or joined with commas: AuthorizationHeaderFirst, AuthorizationHeaderLast or
+	// AuthorizationHeaderReject.
+	AuthorizationHeaderPolicy = env.RegisterStringVar("AUTHORIZATION_HEADER_POLICY", AuthorizationHeaderFirst,
+		"How to handle requests with several authorization header values, repeated or joined with commas: "+
+			"'first' uses the first token, 'last' uses the last token and 'reject' rejects the request.").Get()
 )
 
+// auditLog records security sensitive events.
+var auditLog = log.RegisterScope("audit", "security audit events", 0)
+
 const (
 	BearerTokenPrefix = "Bearer "
 
+	// AuthorizationHeaderFirst, AuthorizationHeaderLast and AuthorizationHeaderReject are the values of
+	// AuthorizationHeaderPolicy.
+	AuthorizationHeaderFirst  = "first"
+	AuthorizationHeaderLast   = "last"
+	AuthorizationHeaderReject = "reject"
+
+	// MaxAuthorizationHeaderSize bounds the size of accepted authorization header values, well above
+	// the size of the tokens issued by Kubernetes and cloud identity providers.
+	MaxAuthorizationHeaderSize = 64 * 1024
+
 	K8sTokenPrefix = "Istio "
 
 	// CertSigner info
 	CertSigner = "CertSigner"
+
+	// SANPolicyExact, SANPolicySubset, SANPolicyTrustDomain and SANPolicyPermissive are the values of
+	// Options.SANPolicy. Exact requires the certificate to only have the requested identity as SAN;
+	// subset requires the requested identity to be one of its SANs, allowing the CA to add others;
+	// trust-domain requires all its URI SANs to be SPIFFE IDs of the trust domain; permissive accepts
+	// any SANs, logging a warning if the requested identity is missing.
+	SANPolicyExact       = "exact"
+	SANPolicySubset      = "subset"
+	SANPolicyTrustDomain = "trust-domain"
+	SANPolicyPermissive  = "permissive"
+
+	// SecretStoreMemory and SecretStoreDisk are the values of Options.SecretStore. Memory keeps the
+	// cached certificates in memory; disk also keeps a copy of the cached workload certificate in
+	// SecretStoreDir, with its private key encrypted by the KeyProtector, or by a data key encrypted by
+	// the KMS without one.
+	SecretStoreMemory = "memory"
+	SecretStoreDisk   = "disk"
+
+	// FileWatcherInotify and FileWatcherPoll are the values of Options.FileWatcher. Inotify relies on
+	// the notifications of the file system; poll compares the files every FileWatchPollInterval, for
+	// network file systems and platforms where notifications are missed.
+	FileWatcherInotify = "inotify"
+	FileWatcherPoll    = "poll"
 )
 
 // Options provides all of the configuration parameters for secret discovery service
@@ -98,12 +236,72 @@ type Options struct {
 	// WorkloadUDSPath is the unix domain socket through which SDS server communicates with workload proxies.
 	WorkloadUDSPath string
 
-	// CAEndpoint is the CA endpoint to which node agent sends CSR request.
+	// WorkloadAPIUDSPath is the unix domain socket through which the SPIFFE Workload API is served to
+	// applications. The Workload API is disabled if empty.
+	WorkloadAPIUDSPath string
+
+	// SPIREAgentUDSPath is the unix domain socket of the Workload API of a local SPIRE agent. If set, the
+	// workload certificate and trust bundle are the X.509 SVID and bundle of the SPIRE agent, and the
+	// agent does not generate keys or CSRs.
+	SPIREAgentUDSPath string
+
+	// DelegatedIdentityUDSPath is the unix domain socket through which the SPIRE Delegated Identity API is
+	// served to node-level components. The Delegated Identity API is disabled if empty.
+	DelegatedIdentityUDSPath string
+
+	// CertStatusUDSPath is the unix domain socket through which the status of the certificates of the
+	// agent is served to node daemons and tooling. The certificate status API is disabled if empty.
+	CertStatusUDSPath string
+
+	// CARetryPolicy is the policy of the retries of the requests to gRPC CAs failing with a transient
+	// status. DefaultCARetryPolicy is used if nil.
+	CARetryPolicy *CARetryPolicy
+
+	// CAKeepaliveInterval is the interval of the keepalive pings of the connections to gRPC CAs, which
+	// are sent even when idle so that NAT and firewalls do not reset them. Disabled if 0, and at least
+	// 10s otherwise. The CA must permit pings without active streams.
+	CAKeepaliveInterval time.Duration
+
+	// CAKeepaliveTimeout is how long a connection to a gRPC CA waits for the ack of a keepalive ping
+	// before closing it, and reconnecting on the next request. gRPC defaults to 20s if 0.
+	CAKeepaliveTimeout time.Duration
+
+	// CARPCTimeout is the deadline of each attempt of a request to a gRPC CA, which is then retried per
+	// CARetryPolicy. No deadline other than the one of the caller if 0.
+	CARPCTimeout time.Duration
+
+	// EgressProxy is the proxy through which the connections to gRPC CAs and to the XDS server are
+	// dialed. They are dialed directly if nil.
+	EgressProxy *EgressProxy
+
+	// CAEndpoint is the CA endpoint to which node agent sends CSR request. It may be a comma separated
+	// list of endpoints in order of preference, which the agent fails over between.
 	CAEndpoint string
 
 	// CAEndpointSAN overrides the ServerName extracted from CAEndpoint.
 	CAEndpointSAN string
 
+	// CARootCertFallback is the path of a PEM file the roots used to verify the TLS certificate of the
+	// CA are re-read from when the handshake fails with an unknown authority, so that a rotation of
+	// the roots does not require restarting the agent. If empty, the file the roots were loaded from
+	// is re-read.
+	CARootCertFallback string
+
+	// CARootPins are the roots every certificate chain signed by the CA must chain to, each either
+	// "sha256:" followed by the hex SHA-256 digest of the root's SubjectPublicKeyInfo, or the path of a
+	// PEM file of root certificates. Chains are not verified if empty.
+	CARootPins []string
+
+	// SANPolicy controls which SANs are accepted in certificates signed by the CA, when the CA replaces
+	// or augments the requested identity: SANPolicyExact, SANPolicySubset, SANPolicyTrustDomain or
+	// SANPolicyPermissive, the default if empty. Certificates violating the policy are rejected.
+	SANPolicy string
+
+	// DeniedCertAlgorithms are the signature and public key algorithms, as named by crypto/x509, that
+	// certificates received from the CA or read from files must not use, in addition to SHA-1
+	// signatures and RSA keys shorter than 2048 bits, which are always rejected.
+	DeniedCertAlgorithms []string
+
 	// The CA provider name.
 	CAProviderName string
 
@@ -120,6 +318,21 @@ type Options struct {
 	// OutputKeyCertToDir is the directory for output the key and certificate
 	OutputKeyCertToDir string
 
+	// OutputPKCS12, if set, also writes the workload key and certificates to OutputKeyCertToDir as a
+	// PKCS#12 bundle, for applications that do not read PEM files.
+	OutputPKCS12 bool
+
+	// OutputJKS, if set, also writes the workload key and certificates to OutputKeyCertToDir as a Java
+	// KeyStore, and the root certificates as a Java truststore.
+	OutputJKS bool
+
+	// KeyStorePassphraseSource is where the passphrase of the PKCS#12 and Java KeyStore files is read
+	// from on every rotation: file:<path> or env:<variable>.
+	KeyStorePassphraseSource string
+
+	// OutputFiles are the permissions and ownership of the files written to OutputKeyCertToDir.
+	OutputFiles OutputFileOptions
+
 	// ProvCert is the directory for client to provide the key and certificate to CA server when authenticating
 	// with mTLS. This is not used for workload mTLS communication, and is
 	ProvCert string
@@ -132,9 +345,21 @@ type Options struct {
 	ClusterID string
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
+	// when generating private keys, ECDSA or ED25519. Ed25519 keys
+	// are always encoded with PKCS#8.
 	ECCSigAlg string
 
+	// ECCCurve is the curve of ECDSA workload keys, P256 or P384. P256 if empty.
+	ECCCurve string
+
+	// WorkloadRSAKeySize is the size of RSA workload keys, at least 2048. 2048 if zero.
+	WorkloadRSAKeySize int
+
+	// PQCSigAlg is EXPERIMENTAL. If set, workload keys are post-quantum ML-DSA keys of this
+	// algorithm, ML-DSA-44, ML-DSA-65 or ML-DSA-87, instead of ECCSigAlg keys. It allows testing
+	// the post-quantum readiness of the CA chain; Envoy does not serve ML-DSA certificates yet.
+	PQCSigAlg string
+
 	// FileMountedCerts indicates whether the proxy is using file
 	// mounted certs created by a foreign CA. Refresh is managed by the external
 	// CA, by updating the Secret or VM file. We will watch the file for changes
@@ -157,6 +382,44 @@ type Options struct {
 	// we would refresh 6 minutes before expiration.
 	SecretRotationGracePeriodRatio float64
 
+	// SecretRotationJitterRatio is the largest fraction of the lifetime of a certificate by which its
+	// rotation is randomly advanced, so that agents started together do not all rotate together.
+	SecretRotationJitterRatio float64
+
+	// NearExpiryThreshold is the remaining validity below which a certificate is reported to be near
+	// expiry, in the logs and to NearExpiryHandler. Disabled if 0.
+	NearExpiryThreshold time.Duration
+
+	// NearExpiryHandler, if set, is notified of the certificates near expiry.
+	NearExpiryHandler NearExpiryHandler
+
+	// CSRRateLimit is the number of CSRs per second the agent sends to the CA at most, with bursts of
+	// CSRBurst, so that many certificates expiring together do not overload the CA. Unlimited if 0.
+	CSRRateLimit float64
+	CSRBurst     int
+
+	// OptionsReloadFile is the path of a YAML file overriding the options that can change without
+	// restarting the agent, see OptionsReloader. It is reloaded when it changes.
+	OptionsReloadFile string
+
+	// CRLRefreshInterval is how often the CRLs of CAs implementing CRLSource are fetched. They are
+	// fetched earlier if they are due to be updated sooner.
+	CRLRefreshInterval time.Duration
+
+	// OCSPStapling enables fetching OCSP responses for the workload certificates from the responders
+	// named in the certificates, to be stapled by Envoy.
+	OCSPStapling bool
+
+	// ClockSkewThreshold is the offset of the local clock from the CA clock beyond which the local
+	// clock is considered skewed, and certificate rotation is scheduled on the CA clock. The clock is
+	// not checked if zero.
+	ClockSkewThreshold time.Duration
+
+	// ClockTimeSource is the host:port of an (S)NTP server the local clock is checked against when
+	// certificates are issued. Optional; without it, skew is only detected if the local clock is
+	// outside the validity of freshly issued certificates.
+	ClockTimeSource string
+
 	// STS port
 	STSPort int
 
@@ -172,6 +435,51 @@ type Options struct {
 	// credential identity provider
 	CredIdentityProvider string
 
+	// KeyAttestor attests the key of each CSR, for CAs that only issue the first certificate of a VM
+	// to a key protected by attested hardware. Optional.
+	KeyAttestor KeyAttestor
+
+	// KeyAttestationCSROID, if set with KeyAttestor, is the OID of the CSR extension the key
+	// attestation is added to, so that any CA can verify it. There is no registered OID for key
+	// attestations in CSRs; the CA must be configured with the same one.
+	KeyAttestationCSROID string
+
+	// LockKeyMemory keeps the private keys of the secrets cached by the SecretManager in memory locked
+	// with mlock, failing to serve those that cannot be locked, e.g. when RLIMIT_MEMLOCK is exceeded.
+	// The keys are locked once when cached, and wiped with SecretItem.Destroy once no longer served.
+	// Keys read from files, which are not cached, are not locked. Without it, only the keys generated
+	// by the agent are locked, where possible.
+	LockKeyMemory bool
+
+	// KeyProtector, if set, encrypts the private key written to OutputKeyCertToDir with a key bound
+	// to the machine, and decrypts the private key read from ProvCert. Optional.
+	KeyProtector KeyProtector
+
+	// ProvKeyProvider, if set, holds the private key of the certificate in ProvCert, which then has no
+	// key.pem. The agent does not rotate such a certificate. Optional.
+	ProvKeyProvider KeyProvider
+
+	// SecretStore selects where the certificates cached by the agent are kept: SecretStoreMemory, the
+	// default if empty, or SecretStoreDisk.
+	SecretStore string
+
+	// SecretStoreDir is the directory of the SecretStoreDisk store.
+	SecretStoreDir string
+
+	// SecretStoreReuse keeps the workload certificate of the SecretStoreDisk store across restarts of the
+	// agent: a certificate left by a previous agent is served until it is due for rotation, instead of
+	// requesting a new one, provided its key, chain and identity are still valid.
+	SecretStoreReuse bool
+
+	// KMS encrypts the data keys of the SecretStoreDisk store without a KeyProtector.
+	KMS KMS
+
+	// MachineBinding identifies the machine the agent runs on. It is recorded next to the certificates
+	// written to OutputKeyCertToDir, and certificates in ProvCert recorded for another machine are
+	// discarded, so that VMs cloned from an image with a persisted identity re-enroll with a fresh key.
+	// Optional.
+	MachineBinding *MachineBinding
+
 	// Namespace corresponding to workload
 	WorkloadNamespace string
 
@@ -190,6 +498,13 @@ type Options struct {
 	// Delay in reading certificates from file after the change is detected. This is useful in cases
 	// where the write operation of key and cert take longer.
 	FileDebounceDuration time.Duration
+
+	// FileWatcher selects how the file mounted certificates and the certificate in ProvCert are watched
+	// for changes: FileWatcherInotify, the default if empty, or FileWatcherPoll.
+	FileWatcher string
+
+	// FileWatchPollInterval is the interval of the FileWatcherPoll watcher. Defaults to 5s.
+	FileWatchPollInterval time.Duration
 }
 
 // TokenManager contains methods for generating token.
@@ -237,12 +552,57 @@ type StsRequestParameters struct {
 // Client interface defines the clients need to implement to talk to CA for CSR.
 // The Agent will create a key pair and a CSR, and use an implementation of this
 // interface to get back a signed certificate. There is no guarantee that the SAN
-// in the request will be returned - server may replace it.
+// in the request will be returned - server may replace it. Calls are abandoned when ctx is
+// cancelled, such as on agent shutdown.
 type Client interface {
-	CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error)
+	CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error)
 	Close()
 	// Retrieve CA root certs If CA publishes API endpoint for this
-	GetRootCertBundle() ([]string, error)
+	GetRootCertBundle(ctx context.Context) ([]string, error)
+}
+
+// RSAKeyAlgorithm, ECDSAKeyAlgorithm, Ed25519KeyAlgorithm and MLDSAKeyAlgorithm are the key
+// algorithms of IssuancePolicy.AllowedKeyAlgorithms.
+const (
+	RSAKeyAlgorithm     = "RSA"
+	ECDSAKeyAlgorithm   = "ECDSA"
+	Ed25519KeyAlgorithm = "ED25519"
+	MLDSAKeyAlgorithm   = "ML-DSA"
+)
+
+// IssuancePolicy constrains the certificates a CA issues.
+type IssuancePolicy struct {
+	// MaxTTL is the longest TTL the CA issues certificates for, if not zero.
+	MaxTTL time.Duration
+	// AllowedKeyAlgorithms are the key algorithms the CA accepts, in order of preference. Any if empty.
+	AllowedKeyAlgorithms []string
+	// MinRSAKeySize is the smallest RSA key size the CA accepts, if not zero.
+	MinRSAKeySize int
+}
+
+// IssuancePolicySource is implemented by the Clients of CAs enforcing an IssuancePolicy, so that the
+// keys and CSRs sent to them comply with it.
+type IssuancePolicySource interface {
+	// IssuancePolicy returns the policy of the CA, or nil if it has none.
+	IssuancePolicy(ctx context.Context) (*IssuancePolicy, error)
+}
+
+// CRLSource is implemented by the Clients of CAs publishing certificate revocation lists, so that
+// revoked peer certificates are rejected. As Envoy then checks the revocation of every CA of a
+// chain, the CRLs must cover all the CAs of the mesh certificate chains.
+type CRLSource interface {
+	// CRL returns the PEM encoded CRLs of the CAs, or nil if the CA publishes none.
+	CRL(ctx context.Context) ([]byte, error)
+}
+
+// ErrJWTSVIDNotSupported is returned for JWT SVIDs requested from a CA that does not issue them.
+var ErrJWTSVIDNotSupported = errors.New("the CA does not issue JWT SVIDs")
+
+// JWTSVIDSigner is implemented by the Clients of CAs issuing JWT SVIDs, for the identity the
+// Client authenticates as.
+type JWTSVIDSigner interface {
+	// SignJWTSVID returns a JWT SVID of the workload for audience.
+	SignJWTSVID(ctx context.Context, audience string) (string, error)
 }
 
 // SecretManager defines secrets management interface which is used by SDS.
@@ -254,12 +614,75 @@ type SecretManager interface {
 	// the K8S format. No other JWTs are currently supported due to client logic. If JWT is
 	// missing/invalid, the resourceName is used.
 	GenerateSecret(resourceName string) (*SecretItem, error)
+
+	// GenerateSecretWithContext is GenerateSecret on behalf of a request: key generation and CSRs
+	// are abandoned once ctx is done, e.g. when the SDS client disconnects, and the CSR deadline is
+	// the one of ctx.
+	GenerateSecretWithContext(ctx context.Context, resourceName string) (*SecretItem, error)
+
+	// GenerateSecrets generates the secrets of several resources at once, e.g. for an SDS request
+	// for the workload certificate, its root and gateway secrets. The secrets generated are returned
+	// along with an error for the others.
+	GenerateSecrets(resourceNames []string) (map[string]*SecretItem, error)
+
+	// GenerateSecretsWithContext is GenerateSecrets on behalf of a request, see
+	// GenerateSecretWithContext.
+	GenerateSecretsWithContext(ctx context.Context, resourceNames []string) (map[string]*SecretItem, error)
+
+	// GenerateJWTSVID returns a short-lived JWT SVID of the workload for audience, for calling
+	// services that do not authenticate it with mTLS.
+	GenerateJWTSVID(audience string) (*JWTSVID, error)
+}
+
+// JWTSVID is a JWT SPIFFE Verifiable Identity Document of the workload.
+type JWTSVID struct {
+	// SpiffeID is the SPIFFE ID of the workload, the subject of the token.
+	SpiffeID string
+	// Token is the signed JWT.
+	Token string
+	// Audience is the audience the token was issued for.
+	Audience string
+	// ExpireTime is the expiry of the token.
+	ExpireTime time.Time
+}
+
+// SecretStore holds the certificates cached by a SecretManager: the workload certificate, and the
+// root certificate it was last issued with. Stores that fail to keep the workload certificate log the
+// failure and return nil from GetWorkload, so that a new certificate is requested.
+type SecretStore interface {
+	GetRoot() []byte
+	SetRoot(rootCert []byte)
+	GetWorkload() *SecretItem
+	SetWorkload(item *SecretItem)
+}
+
+// KMS encrypts and decrypts data keys with a key held by a key management service, for envelope
+// encryption.
+type KMS interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// KeyProvider holds a private key outside of the agent, such as in a cloud KMS, and signs with it.
+type KeyProvider interface {
+	// Signer returns a signer for the key. The private key never leaves the provider.
+	Signer(ctx context.Context) (crypto.Signer, error)
 }
 
 // TokenExchanger provides common interfaces so that authentication providers could choose to implement their specific logic.
 type TokenExchanger interface {
-	// ExchangeToken provides a common interface to exchange an existing token for a new one.
-	ExchangeToken(serviceAccountToken string) (string, error)
+	// ExchangeToken provides a common interface to exchange an existing token for a new one. The
+	// exchange is abandoned when ctx is cancelled.
+	ExchangeToken(ctx context.Context, serviceAccountToken string) (string, error)
+}
+
+// ExpiringTokenExchanger is a TokenExchanger that also reports when the exchanged tokens expire, for
+// them to be cached.
+type ExpiringTokenExchanger interface {
+	TokenExchanger
+	// ExchangeTokenWithExpiry exchanges a token as ExchangeToken, returning the expiry of the exchanged
+	// token, or the zero time if unknown.
+	ExchangeTokenWithExpiry(ctx context.Context, serviceAccountToken string) (string, time.Time, error)
 }
 
 // SecretItem is the cached item in in-memory secret store.
@@ -269,6 +692,18 @@ type SecretItem struct {
 
 	RootCert []byte
 
+	// CRL holds the PEM encoded certificate revocation lists of the CAs, for root resources of CAs
+	// publishing them. Envoy rejects the peer certificates they revoke.
+	CRL []byte
+
+	// OCSPStaple is the DER encoded OCSP response of the certificate, stapled by Envoy to its TLS
+	// handshakes, if OCSP stapling is enabled and a response was fetched.
+	OCSPStaple []byte
+
+	// TrustBundles holds the PEM encoded root certificates of each trust domain, for root resources:
+	// that of the workload, with the same roots as RootCert, and those it is federated with.
+	TrustBundles map[string][]byte
+
 	// ResourceName passed from envoy SDS discovery request.
 	// "ROOTCA" for root cert request, "default" for key/cert request.
 	ResourceName string
@@ -276,13 +711,83 @@ type SecretItem struct {
 	CreatedTime time.Time
 
 	ExpireTime time.Time
+
+	// Leaf is the parsed form of the first certificate in CertificateChain, if available. Like
+	// tls.Certificate.Leaf, it is populated once when the certificate is obtained, so that expiry
+	// checks, SAN validation and metrics don't need to parse the PEM again.
+	Leaf *x509.Certificate
+}
+
+// Destroy wipes the private key of the secret and unlocks its memory, once the secret is no longer
+// served. The private key is shared by the copies of the secret, which must not be used afterwards.
+func (s *SecretItem) Destroy() {
+	pkiutil.ZeroBytes(s.PrivateKey)
+	s.PrivateKey = nil
+}
+
+// CertificateStatus is the status of a resource generated by a SecretManager.
+type CertificateStatus struct {
+	ResourceName string
+
+	// SerialNumber, in hexadecimal, and ExpireTime are those of the current certificate: the leaf for
+	// key and certificate resources, the first root for trust bundles.
+	SerialNumber string
+	ExpireTime   time.Time
+
+	// LastRotationTime is when the current certificate was first served.
+	LastRotationTime time.Time
+
+	// LastError is the last error generating the resource, even if a certificate was served since.
+	LastError     string
+	LastErrorTime time.Time
+
+	// RotationHeldUntil is when the hold on the rotation of the resource expires, if rotation is held.
+	RotationHeldUntil time.Time
+}
+
+// SecretDump is the state of a secret cached by a SecretManager, for troubleshooting. It never
+// contains private keys.
+type SecretDump struct {
+	ResourceName string `json:"resourceName"`
+	// CreatedTime and ExpireTime are those of the SecretItem, unset for trust bundles.
+	CreatedTime *time.Time `json:"createdTime,omitempty"`
+	ExpireTime  *time.Time `json:"expireTime,omitempty"`
+	// PrivateKey is RedactedPrivateKey if the secret has a private key.
+	PrivateKey string `json:"privateKey,omitempty"`
+	// CertificateChain is the certificate chain, leaf first, and RootCertificates the trust bundle.
+	CertificateChain []CertificateDump `json:"certificateChain,omitempty"`
+	RootCertificates []CertificateDump `json:"rootCertificates,omitempty"`
+}
+
+// RedactedPrivateKey replaces the private keys in SecretDump.
+const RedactedPrivateKey = "[redacted]"
+
+// CertificateDump describes a certificate of a SecretDump.
+type CertificateDump struct {
+	// SerialNumber is in hexadecimal.
+	SerialNumber string    `json:"serialNumber"`
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	URIs         []string  `json:"uris,omitempty"`
+	DNSNames     []string  `json:"dnsNames,omitempty"`
+}
+
+// NearExpiryHandler is notified of the certificates nearing their expiry, for custom alerting when
+// their rotation is falling behind.
+type NearExpiryHandler interface {
+	// OnNearExpiry is called once per certificate whose remaining validity falls below
+	// Options.NearExpiryThreshold, with its status and remaining validity. It must not block.
+	OnNearExpiry(status CertificateStatus, remaining time.Duration)
 }
 
 type CredFetcher interface {
 	// GetPlatformCredential fetches workload credential provided by the platform.
 	GetPlatformCredential() (string, error)
 
-	// GetType returns credential fetcher type. Currently the supported type is "GoogleComputeEngine".
+	// GetType returns credential fetcher type, the name its factory is registered with, see
+	// RegisterCredFetcherFactory.
 	GetType() string
 
 	// GetIdentityProvider returns the name of the IdentityProvider that can authenticate the workload credential.
@@ -292,22 +797,110 @@ type CredFetcher interface {
 	Stop()
 }
 
+// CredentialRefreshNotifier is implemented by the CredFetchers which learn when the platform credential
+// changes, e.g. when a token file is rotated, so that the connections authenticated with it can be
+// re-established promptly.
+type CredentialRefreshNotifier interface {
+	// AddRefreshHandler registers f to be called after the credential changed. The handlers are
+	// called from a goroutine of the CredFetcher, never from GetPlatformCredential, so that they can
+	// wait for the requests authenticated with the credential.
+	AddRefreshHandler(f func())
+}
+
+// KeyAttestor proves to the CA that the key of a CSR is held by attested hardware, such as a TPM.
+type KeyAttestor interface {
+	// AttestKey returns the encoded attestation of keyDigest, the SHA-256 digest of the DER encoded
+	// SubjectPublicKeyInfo of the CSR.
+	AttestKey(keyDigest []byte) (string, error)
+}
+
+// OutputFileOptions are the permissions and ownership of the key and certificate files written by
+// the agent, so that an application running as another user can read them.
+type OutputFileOptions struct {
+	// KeyMode is the mode of the files holding a private key, and CertMode the mode of the other
+	// files. Zero keeps the default: 0644 on Kubernetes, 0600 elsewhere.
+	KeyMode  os.FileMode
+	CertMode os.FileMode
+	// Umask clears mode bits of every file written.
+	Umask os.FileMode
+	// UID and GID, if not nil, own the files written.
+	UID *int
+	GID *int
+	// Versioned, if set, writes the files to a new directory on every update and switches to it with
+	// a symbolic link, so that an application never reads a private key with another certificate.
+	Versioned bool
+}
+
+// KeyProtector encrypts private keys at rest with a key bound to the machine, such as a TPM sealed key,
+// so that a VM identity can survive reboots without leaving a plaintext key on disk.
+type KeyProtector interface {
+	// Seal returns the encrypted form of the PEM encoded private key.
+	Seal(privateKey []byte) ([]byte, error)
+	// Open returns the PEM encoded private key encrypted by Seal.
+	Open(sealed []byte) ([]byte, error)
+}
+
+// MachineBinding identifies the machine a persisted identity was issued to.
+type MachineBinding struct {
+	// MachineID is a digest of the OS machine ID.
+	MachineID string `json:"machineId,omitempty"`
+	// InstanceID is the cloud instance ID, if the agent runs on a cloud VM.
+	InstanceID string `json:"instanceId,omitempty"`
+}
+
+// Matches returns false if an ID known to both bindings differs.
+func (b *MachineBinding) Matches(other *MachineBinding) bool {
+	if b.MachineID != "" && other.MachineID != "" && b.MachineID != other.MachineID {
+		return false
+	}
+	if b.InstanceID != "" && other.InstanceID != "" && b.InstanceID != other.InstanceID {
+		return false
+	}
+	return true
+}
+
 // AuthSource represents where authentication result is derived from.
 type AuthSource int
 
 const (
 	AuthSourceClientCertificate AuthSource = iota
 	AuthSourceIDToken
+	AuthSourceKeyAttestation
 )
 
+func (s AuthSource) String() string {
+	switch s {
+	case AuthSourceClientCertificate:
+		return "client-certificate"
+	case AuthSourceIDToken:
+		return "id-token"
+	case AuthSourceKeyAttestation:
+		return "key-attestation"
+	}
+	return fmt.Sprintf("AuthSource(%d)", int(s))
+}
+
 const (
 	authorizationMeta = "authorization"
+
+	// KeyAttestationMeta is the gRPC metadata key carrying the encoded KeyAttestor attestation.
+	KeyAttestationMeta = "x-istio-key-attestation"
 )
 
 // Caller carries the identity and authentication source of a caller.
 type Caller struct {
 	AuthSource AuthSource
 	Identities []string
+	// SpiffeIDs are the parsed Identities which are valid SPIFFE IDs, if the authenticator parses them.
+	SpiffeIDs []spiffe.ID
+
+	// KeyDigest, if set, is the SHA-256 digest of the only SubjectPublicKeyInfo the caller may get
+	// a certificate for.
+	KeyDigest []byte
+
+	// Redeem, if set, is called once a certificate has been issued to the caller, to spend the
+	// single-use credential it was authenticated with. The certificate is not returned if it fails.
+	Redeem func(ctx context.Context) error
 }
 
 type Authenticator interface {
@@ -316,38 +909,117 @@ type Authenticator interface {
 	AuthenticateRequest(req *http.Request) (*Caller, error)
 }
 
+// CSRAuthenticator is implemented by Authenticators that can also authenticate a certificate request
+// with evidence carried by the CSR itself, such as a key attestation extension.
+type CSRAuthenticator interface {
+	AuthenticateCSR(csr *x509.CertificateRequest) (*Caller, error)
+}
+
+// ExtractBearerToken returns the bearer token of the authorization metadata of the call, selected
+// according to AuthorizationHeaderPolicy.
 func ExtractBearerToken(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		return "", fmt.Errorf("no metadata is attached")
 	}
 
-	authHeader, exists := md[authorizationMeta]
-	if !exists {
-		return "", fmt.Errorf("no HTTP authorization header exists")
-	}
+	return extractToken(md[authorizationMeta], BearerTokenPrefix)
+}
 
-	for _, value := range authHeader {
-		if strings.HasPrefix(value, BearerTokenPrefix) {
-			return strings.TrimPrefix(value, BearerTokenPrefix), nil
-		}
+// ExtractKeyAttestation returns the key attestation attached to the call by a KeyAttestor.
+func ExtractKeyAttestation(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("no metadata is attached")
 	}
-
-	return "", fmt.Errorf("no bearer token exists in HTTP authorization header")
+	values := md.Get(KeyAttestationMeta)
+	if len(values) == 0 {
+		return "", fmt.Errorf("no key attestation exists")
+	}
+	return values[0], nil
 }
 
+// ExtractRequestToken returns the bearer or Kubernetes token of the authorization header of the
+// request, selected according to AuthorizationHeaderPolicy.
+//
+// If AllowAlternativeTokenLocations is set, a request without authorization header may send the token
+// in the access_token form body or query parameter instead.
 func ExtractRequestToken(req *http.Request) (string, error) {
-	value := req.Header.Get(authorizationMeta)
-	if value == "" {
-		return "", fmt.Errorf("no HTTP authorization header exists")
+	headers := req.Header.Values(authorizationMeta)
+	if len(headers) > 0 || !AllowAlternativeTokenLocations {
+		return extractToken(headers, BearerTokenPrefix, K8sTokenPrefix)
 	}
+	return extractAlternativeToken(req)
+}
 
-	if strings.HasPrefix(value, BearerTokenPrefix) {
-		return strings.TrimPrefix(value, BearerTokenPrefix), nil
+// accessTokenParameter is the form and query parameter carrying the token, per RFC 6750.
+const accessTokenParameter = "access_token"
+
+// extractAlternativeToken returns the token of the access_token form body or query parameter of req,
+// which must not be sent in both. The body is only parsed if it is form encoded, as required by RFC
+// 6750.
+func extractAlternativeToken(req *http.Request) (string, error) {
+	var locations, tokens []string
+	if req.Method != http.MethodGet && req.Body != nil {
+		if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+			req.Body = http.MaxBytesReader(nil, req.Body, MaxAuthorizationHeaderSize)
+			if err := req.ParseForm(); err != nil {
+				return "", fmt.Errorf("failed to parse form body: %v", err)
+			}
+			if values := req.PostForm[accessTokenParameter]; len(values) > 0 {
+				locations, tokens = append(locations, "form body"), append(tokens, values...)
+			}
+		}
+	}
+	if values := req.URL.Query()[accessTokenParameter]; len(values) > 0 {
+		locations, tokens = append(locations, "query parameter"), append(tokens, values...)
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("no HTTP authorization header exists")
 	}
-	if strings.HasPrefix(value, K8sTokenPrefix) {
-		return strings.TrimPrefix(value, K8sTokenPrefix), nil
+	if len(tokens) > 1 {
+		return "", fmt.Errorf("multiple %s values", accessTokenParameter)
 	}
+	if len(tokens[0]) > MaxAuthorizationHeaderSize {
+		return "", fmt.Errorf("%s exceeds %d bytes", accessTokenParameter, MaxAuthorizationHeaderSize)
+	}
+	auditLog.WithLabels("remote", req.RemoteAddr, "method", req.Method, "path", req.URL.Path).
+		Infof("accepted access token sent in %s", locations[0])
+	return tokens[0], nil
+}
 
-	return "", fmt.Errorf("no bearer token exists in HTTP authorization header")
+// extractToken returns the token of the authorization header values with one of the prefixes,
+// selected according to AuthorizationHeaderPolicy. Each value may hold several comma separated values.
+func extractToken(headers []string, prefixes ...string) (string, error) {
+	var values, tokens []string
+	for _, header := range headers {
+		if len(header) > MaxAuthorizationHeaderSize {
+			return "", fmt.Errorf("HTTP authorization header exceeds %d bytes", MaxAuthorizationHeaderSize)
+		}
+		for _, value := range strings.Split(header, ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			values = append(values, value)
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(value, prefix) {
+					tokens = append(tokens, strings.TrimPrefix(value, prefix))
+					break
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("no HTTP authorization header exists")
+	}
+	if AuthorizationHeaderPolicy == AuthorizationHeaderReject && len(values) > 1 {
+		return "", fmt.Errorf("multiple HTTP authorization header values")
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("no bearer token exists in HTTP authorization header")
+	}
+	if AuthorizationHeaderPolicy == AuthorizationHeaderLast {
+		return tokens[len(tokens)-1], nil
+	}
+	return tokens[0], nil
 }
@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+// TLSCredentials adapts a SecretManager to crypto/tls, so that proxyless Go services can use the mesh
+// identity for mTLS. The workload certificate and trust bundle are read from the SecretManager on each
+// handshake, so rotations are picked up without rebuilding the tls.Config.
+type TLSCredentials struct {
+	secrets SecretManager
+
+	// VerifyIdentity, if set, is called with the SPIFFE ID of a peer whose certificate chain has been
+	// verified, and rejects the handshake if it returns an error. Optional.
+	VerifyIdentity func(identity string) error
+
+	mu       sync.Mutex
+	chain    []byte
+	cert     *tls.Certificate
+	root     []byte
+	verifier *spiffe.PeerCertVerifier
+}
+
+// NewTLSCredentials creates TLSCredentials serving the workload certificate and trust bundle of secrets.
+func NewTLSCredentials(secrets SecretManager) *TLSCredentials {
+	return &TLSCredentials{secrets: secrets}
+}
+
+// ServerConfig returns a tls.Config for servers that require clients to present a mesh certificate.
+func (c *TLSCredentials) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		GetCertificate:        c.GetCertificate,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: c.VerifyPeerCertificate,
+	}
+}
+
+// ClientConfig returns a tls.Config for clients presenting their mesh certificate. Mesh certificates
+// carry SPIFFE IDs rather than DNS names, so the server is verified by VerifyPeerCertificate instead of
+// the hostname based verification of crypto/tls.
+func (c *TLSCredentials) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		GetClientCertificate:  c.GetClientCertificate,
+		InsecureSkipVerify:    true, // nolint: gosec // verified by VerifyPeerCertificate
+		VerifyPeerCertificate: c.VerifyPeerCertificate,
+	}
+}
+
+// GetCertificate is an implementation of tls.Config.GetCertificate.
+func (c *TLSCredentials) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate()
+}
+
+// GetClientCertificate is an implementation of tls.Config.GetClientCertificate.
+func (c *TLSCredentials) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.certificate()
+}
+
+// VerifyPeerCertificate is an implementation of tls.Config.VerifyPeerCertificate. It verifies the peer
+// certificate chain against the current trust bundle, and the peer SPIFFE ID with VerifyIdentity.
+func (c *TLSCredentials) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer did not present a certificate")
+	}
+	verifier, err := c.peerCertVerifier()
+	if err != nil {
+		return err
+	}
+	if err := verifier.VerifyPeerCert(rawCerts, nil); err != nil {
+		return err
+	}
+	if c.VerifyIdentity == nil {
+		return nil
+	}
+	peer, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	return c.VerifyIdentity(peer.URIs[0].String())
+}
+
+// certificate returns the workload certificate, parsing the key pair only when it has been rotated.
+func (c *TLSCredentials) certificate() (*tls.Certificate, error) {
+	secret, err := c.secrets.GenerateSecret(WorkloadKeyCertResourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workload certificate: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// SecretManagers may return a new SecretItem on each call, so compare the certificates themselves.
+	if c.cert != nil && bytes.Equal(c.chain, secret.CertificateChain) {
+		return c.cert, nil
+	}
+	cert, err := tls.X509KeyPair(secret.CertificateChain, secret.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workload certificate: %v", err)
+	}
+	cert.Leaf = secret.Leaf
+	c.chain, c.cert = append([]byte(nil), secret.CertificateChain...), &cert
+	return c.cert, nil
+}
+
+// peerCertVerifier returns a verifier for the current trust bundle, rebuilding it only when the bundle
+// has changed. The trust domain of the bundle is the one of the workload certificate.
+func (c *TLSCredentials) peerCertVerifier() (*spiffe.PeerCertVerifier, error) {
+	root, err := c.secrets.GenerateSecret(RootCertReqResourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trust bundle: %v", err)
+	}
+	cert, err := c.certificate()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verifier != nil && bytes.Equal(c.root, root.RootCert) {
+		return c.verifier, nil
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(leaf.URIs) != 1 {
+		return nil, fmt.Errorf("workload certificate does not contain 1 URI type SAN, detected %d", len(leaf.URIs))
+	}
+	trustDomain, err := spiffe.GetTrustDomainFromURISAN(leaf.URIs[0].String())
+	if err != nil {
+		return nil, err
+	}
+	verifier := spiffe.NewPeerCertVerifier()
+	if err := verifier.AddMappingFromPEM(trustDomain, root.RootCert); err != nil {
+		return nil, fmt.Errorf("invalid trust bundle: %v", err)
+	}
+	c.root, c.verifier = root.RootCert, verifier
+	return verifier, nil
+}
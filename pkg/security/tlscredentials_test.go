@@ -0,0 +1,198 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     interface{}
+	rootPEM []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org:          "cluster.local",
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, rootPEM: certPEM}
+}
+
+// secretManager returns a SecretManager holding a workload certificate for identity signed by ca.
+func (ca *testCA) secretManager(t *testing.T, identity string) *DirectSecretManager {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       identity,
+		SignerCert: ca.cert,
+		SignerPriv: ca.key,
+		TTL:        time.Hour,
+		IsServer:   true,
+		IsClient:   true,
+		ECSigAlg:   util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewDirectSecretManager()
+	sm.Set(WorkloadKeyCertResourceName, &SecretItem{
+		CertificateChain: certPEM,
+		PrivateKey:       keyPEM,
+		ResourceName:     WorkloadKeyCertResourceName,
+	})
+	sm.Set(RootCertReqResourceName, &SecretItem{
+		RootCert:     ca.rootPEM,
+		ResourceName: RootCertReqResourceName,
+	})
+	return sm
+}
+
+func handshake(t *testing.T, server, client *tls.Config) (serverErr, clientErr error) {
+	t.Helper()
+	// Use a loopback connection rather than net.Pipe: the kernel buffers let either side finish the
+	// handshake without the other one reading.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+		s := tls.Server(conn, server)
+		err = s.Handshake()
+		if err == nil {
+			_, err = s.Read(make([]byte, 1))
+		}
+		errCh <- err
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := tls.Client(conn, client)
+	if clientErr = c.Handshake(); clientErr == nil {
+		_, clientErr = c.Write([]byte{0})
+	}
+	serverErr = <-errCh
+	return serverErr, clientErr
+}
+
+func TestTLSCredentials(t *testing.T) {
+	ca := newTestCA(t)
+	serverCreds := NewTLSCredentials(ca.secretManager(t, "spiffe://cluster.local/ns/foo/sa/server"))
+	clientSecrets := ca.secretManager(t, "spiffe://cluster.local/ns/foo/sa/client")
+	clientCreds := NewTLSCredentials(clientSecrets)
+
+	var seen string
+	serverCreds.VerifyIdentity = func(identity string) error {
+		seen = identity
+		return nil
+	}
+	if serr, cerr := handshake(t, serverCreds.ServerConfig(), clientCreds.ClientConfig()); serr != nil || cerr != nil {
+		t.Fatalf("handshake failed: server %v, client %v", serr, cerr)
+	}
+	if seen != "spiffe://cluster.local/ns/foo/sa/client" {
+		t.Fatalf("unexpected client identity %q", seen)
+	}
+
+	// A rotated certificate is used for the next handshake.
+	rotated := ca.secretManager(t, "spiffe://cluster.local/ns/foo/sa/rotated")
+	workload, _ := rotated.GenerateSecret(WorkloadKeyCertResourceName)
+	clientSecrets.Set(WorkloadKeyCertResourceName, workload)
+	if serr, cerr := handshake(t, serverCreds.ServerConfig(), clientCreds.ClientConfig()); serr != nil || cerr != nil {
+		t.Fatalf("handshake failed: server %v, client %v", serr, cerr)
+	}
+	if seen != "spiffe://cluster.local/ns/foo/sa/rotated" {
+		t.Fatalf("expected rotated client identity, got %q", seen)
+	}
+
+	serverCreds.VerifyIdentity = func(identity string) error {
+		return fmt.Errorf("%s is not allowed", identity)
+	}
+	if serr, _ := handshake(t, serverCreds.ServerConfig(), clientCreds.ClientConfig()); serr == nil {
+		t.Fatal("expected handshake to fail for a rejected identity")
+	}
+}
+
+func TestTLSCredentialsUntrustedPeer(t *testing.T) {
+	serverCreds := NewTLSCredentials(newTestCA(t).secretManager(t, "spiffe://cluster.local/ns/foo/sa/server"))
+	clientCreds := NewTLSCredentials(newTestCA(t).secretManager(t, "spiffe://cluster.local/ns/foo/sa/client"))
+	if _, cerr := handshake(t, serverCreds.ServerConfig(), clientCreds.ClientConfig()); cerr == nil {
+		t.Fatal("expected client to reject a server signed by another CA")
+	}
+}
+
+// copyingSecretManager returns a new SecretItem on each call, like the SecretManagerClient of the agent.
+type copyingSecretManager struct {
+	*DirectSecretManager
+}
+
+func (m copyingSecretManager) GenerateSecret(resourceName string) (*SecretItem, error) {
+	item, err := m.DirectSecretManager.GenerateSecret(resourceName)
+	if err != nil {
+		return nil, err
+	}
+	cp := *item
+	return &cp, nil
+}
+
+func TestTLSCredentialsReusesKeyPair(t *testing.T) {
+	ca := newTestCA(t)
+	secrets := ca.secretManager(t, "spiffe://cluster.local/ns/foo/sa/client")
+	creds := NewTLSCredentials(copyingSecretManager{secrets})
+	first, err := creds.certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := creds.certificate(); err != nil || second != first {
+		t.Fatalf("expected the parsed key pair to be reused, got %p (%v), want %p", second, err, first)
+	}
+
+	rotated, _ := ca.secretManager(t, "spiffe://cluster.local/ns/foo/sa/rotated").GenerateSecret(WorkloadKeyCertResourceName)
+	secrets.Set(WorkloadKeyCertResourceName, rotated)
+	if third, err := creds.certificate(); err != nil || third == first {
+		t.Fatalf("expected the rotated key pair to be parsed, got %p (%v)", third, err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// minCAKeepaliveInterval is the shortest keepalive interval gRPC allows.
+const minCAKeepaliveInterval = 10 * time.Second
+
+// ValidationError is an invalid setting of Options.
+type ValidationError struct {
+	// Fields are the names of the Options fields of the setting.
+	Fields []string
+	// Reason is why the setting is invalid.
+	Reason string
+	// Fix is how to make the setting valid.
+	Fix string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s; %s", strings.Join(e.Fields, ", "), e.Reason, e.Fix)
+}
+
+// ValidationErrors are all the invalid settings of Options.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid security options: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the settings of o that are invalid, or mutually exclusive, on their own. It returns
+// ValidationErrors listing all of them, or nil.
+func (o *Options) Validate() error {
+	var errs ValidationErrors
+	invalid := func(reason, fix string, fields ...string) {
+		errs = append(errs, &ValidationError{Fields: fields, Reason: reason, Fix: fix})
+	}
+
+	if o.ProvCert != "" && o.FileMountedCerts {
+		invalid("provisioning certificates are only used to authenticate to a CA, which is not used with file mounted certificates",
+			"unset one of them", "ProvCert", "FileMountedCerts")
+	}
+	if o.FileMountedCerts && o.CAProviderName != "" && o.CAProviderName != CitadelCAProvider {
+		invalid(fmt.Sprintf("CA provider %s is not used with file mounted certificates", o.CAProviderName),
+			"unset one of them", "FileMountedCerts", "CAProviderName")
+	}
+	if o.SPIREAgentUDSPath != "" && o.FileMountedCerts {
+		invalid("workload certificates cannot both be delegated to SPIRE and mounted from files",
+			"unset one of them", "SPIREAgentUDSPath", "FileMountedCerts")
+	}
+	if o.SPIREAgentUDSPath != "" && o.DelegatedIdentityUDSPath != "" {
+		invalid("the Delegated Identity API is served by the SPIRE agent itself when certificates are delegated to it",
+			"unset one of them", "SPIREAgentUDSPath", "DelegatedIdentityUDSPath")
+	}
+	if (o.CAProviderName == GoogleCAProvider || o.CAProviderName == GoogleCASProvider) &&
+		o.JWTPath == "" && o.CredFetcher == nil && !o.FileMountedCerts {
+		invalid(fmt.Sprintf("CA provider %s authenticates with a JWT, but there is no JWT", o.CAProviderName),
+			"set a JWT policy or a credential fetcher", "CAProviderName", "JWTPath", "CredFetcher")
+	}
+	if o.SecretTTL < 0 {
+		invalid(fmt.Sprintf("negative TTL %v", o.SecretTTL), "set a positive TTL", "SecretTTL")
+	}
+	if o.SecretRotationGracePeriodRatio < 0 || o.SecretRotationGracePeriodRatio > 1 {
+		invalid(fmt.Sprintf("grace period ratio %v is not a ratio of the certificate lifetime", o.SecretRotationGracePeriodRatio),
+			"set a ratio between 0 and 1", "SecretRotationGracePeriodRatio")
+	}
+	if o.SecretRotationJitterRatio < 0 || o.SecretRotationJitterRatio > 1 {
+		invalid(fmt.Sprintf("rotation jitter ratio %v is not a ratio of the certificate lifetime", o.SecretRotationJitterRatio),
+			"set a ratio between 0 and 1", "SecretRotationJitterRatio")
+	}
+	if o.CSRRateLimit < 0 {
+		invalid(fmt.Sprintf("negative CSR rate limit %v", o.CSRRateLimit), "set 0 for no limit, or a positive rate", "CSRRateLimit")
+	} else if o.CSRRateLimit > 0 && o.CSRBurst < 1 {
+		invalid(fmt.Sprintf("CSR burst %d would not let any CSR through", o.CSRBurst), "set a burst of at least 1",
+			"CSRBurst")
+	}
+	if o.NearExpiryThreshold < 0 {
+		invalid(fmt.Sprintf("negative near expiry threshold %v", o.NearExpiryThreshold), "set 0 to disable it, or a positive threshold",
+			"NearExpiryThreshold")
+	}
+	if o.NearExpiryHandler != nil && o.NearExpiryThreshold == 0 {
+		invalid("the near expiry handler is never called without a threshold", "set a threshold",
+			"NearExpiryHandler", "NearExpiryThreshold")
+	}
+	switch o.SANPolicy {
+	case "", SANPolicyExact, SANPolicySubset, SANPolicyTrustDomain, SANPolicyPermissive:
+	default:
+		invalid(fmt.Sprintf("unknown SAN policy %q", o.SANPolicy), fmt.Sprintf("use one of %s, %s, %s or %s",
+			SANPolicyExact, SANPolicySubset, SANPolicyTrustDomain, SANPolicyPermissive), "SANPolicy")
+	}
+	switch o.FileWatcher {
+	case "", FileWatcherInotify, FileWatcherPoll:
+	default:
+		invalid(fmt.Sprintf("unknown file watcher %q", o.FileWatcher),
+			fmt.Sprintf("use %s or %s", FileWatcherInotify, FileWatcherPoll), "FileWatcher")
+	}
+	if o.FileWatchPollInterval < 0 {
+		invalid(fmt.Sprintf("negative poll interval %v", o.FileWatchPollInterval), "set a positive interval",
+			"FileWatchPollInterval")
+	}
+	if o.ECCSigAlg != "" && !pkiutil.IsSupportedECSignatureAlgorithm(o.ECCSigAlg) {
+		invalid(fmt.Sprintf("unsupported signature algorithm %q", o.ECCSigAlg), "use ECDSA or ED25519", "ECCSigAlg")
+	}
+	if o.PQCSigAlg != "" && !pkiutil.IsPQCSignatureAlgorithm(o.PQCSigAlg) {
+		invalid(fmt.Sprintf("unsupported post-quantum signature algorithm %q", o.PQCSigAlg),
+			"use ML-DSA-44, ML-DSA-65 or ML-DSA-87", "PQCSigAlg")
+	}
+	if !pkiutil.IsSupportedEllipticCurve(o.ECCCurve) {
+		invalid(fmt.Sprintf("unsupported elliptic curve %q", o.ECCCurve), "use P256 or P384", "ECCCurve")
+	}
+	if o.WorkloadRSAKeySize != 0 && o.WorkloadRSAKeySize < 2048 {
+		invalid(fmt.Sprintf("RSA key size %d is smaller than the minimum of 2048", o.WorkloadRSAKeySize),
+			"use at least 2048 bits", "WorkloadRSAKeySize")
+	}
+	if p := o.CARetryPolicy; p != nil {
+		if p.Backoff < 0 {
+			invalid(fmt.Sprintf("negative retry backoff %v", p.Backoff), "set a positive backoff", "CARetryPolicy.Backoff")
+		}
+		for _, c := range p.Codes {
+			if IsFatalError(status.Error(c, "")) {
+				invalid(fmt.Sprintf("requests failing with status %v fail the same way when retried", c),
+					"remove it from the retried statuses", "CARetryPolicy.Codes")
+			}
+		}
+	}
+	if o.CAKeepaliveInterval < 0 || (o.CAKeepaliveInterval > 0 && o.CAKeepaliveInterval < minCAKeepaliveInterval) {
+		invalid(fmt.Sprintf("keepalive interval %v is shorter than the gRPC minimum of %v", o.CAKeepaliveInterval,
+			minCAKeepaliveInterval), "set 0 to disable keepalive, or a longer interval", "CAKeepaliveInterval")
+	}
+	if o.CAKeepaliveTimeout < 0 {
+		invalid(fmt.Sprintf("negative keepalive timeout %v", o.CAKeepaliveTimeout), "set a positive timeout",
+			"CAKeepaliveTimeout")
+	} else if o.CAKeepaliveTimeout > 0 && o.CAKeepaliveInterval == 0 {
+		invalid("the keepalive timeout is the wait for the ack of keepalive pings, which are disabled",
+			"set a keepalive interval, or unset the timeout", "CAKeepaliveTimeout", "CAKeepaliveInterval")
+	}
+	if o.CARPCTimeout < 0 {
+		invalid(fmt.Sprintf("negative request timeout %v", o.CARPCTimeout), "set a positive timeout", "CARPCTimeout")
+	}
+	if (o.OutputPKCS12 || o.OutputJKS) && o.OutputKeyCertToDir == "" {
+		invalid("key stores are written next to the output certificates, but there is no output directory",
+			"set the output directory", "OutputPKCS12", "OutputJKS", "OutputKeyCertToDir")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		fields  [][]string
+	}{
+		{
+			name:    "valid",
+			options: Options{CAProviderName: CitadelCAProvider, SecretTTL: time.Hour, SecretRotationGracePeriodRatio: 0.5},
+		},
+		{
+			name:    "file mounted certificates with a CA",
+			options: Options{FileMountedCerts: true, ProvCert: "/etc/prov", CAProviderName: GoogleCAProvider},
+			fields:  [][]string{{"ProvCert", "FileMountedCerts"}, {"FileMountedCerts", "CAProviderName"}},
+		},
+		{
+			name:    "SPIRE with the Delegated Identity API",
+			options: Options{SPIREAgentUDSPath: "/run/spire.sock", DelegatedIdentityUDSPath: "/run/delegated.sock"},
+			fields:  [][]string{{"SPIREAgentUDSPath", "DelegatedIdentityUDSPath"}},
+		},
+		{
+			name:    "JWT CA without JWT",
+			options: Options{CAProviderName: GoogleCASProvider},
+			fields:  [][]string{{"CAProviderName", "JWTPath", "CredFetcher"}},
+		},
+		{
+			name:    "JWT CA with JWT",
+			options: Options{CAProviderName: GoogleCASProvider, JWTPath: "/var/run/token"},
+		},
+		{
+			name:    "rotation",
+			options: Options{SecretTTL: -time.Hour, SecretRotationGracePeriodRatio: 1.5},
+			fields:  [][]string{{"SecretTTL"}, {"SecretRotationGracePeriodRatio"}},
+		},
+		{
+			name:    "keys",
+			options: Options{ECCSigAlg: "DSA", ECCCurve: "P521", WorkloadRSAKeySize: 1024, SANPolicy: "any"},
+			fields:  [][]string{{"SANPolicy"}, {"ECCSigAlg"}, {"ECCCurve"}, {"WorkloadRSAKeySize"}},
+		},
+		{
+			name:    "file watcher",
+			options: Options{FileWatcher: "fanotify", FileWatchPollInterval: -time.Second},
+			fields:  [][]string{{"FileWatcher"}, {"FileWatchPollInterval"}},
+		},
+		{
+			name: "retry policy",
+			options: Options{CARetryPolicy: &CARetryPolicy{
+				Backoff: -time.Second, Codes: []codes.Code{codes.Unavailable, codes.InvalidArgument},
+			}},
+			fields: [][]string{{"CARetryPolicy.Backoff"}, {"CARetryPolicy.Codes"}},
+		},
+		{
+			name:    "keepalive",
+			options: Options{CAKeepaliveInterval: 30 * time.Second, CAKeepaliveTimeout: 5 * time.Second, CARPCTimeout: time.Second},
+		},
+		{
+			name:    "invalid keepalive",
+			options: Options{CAKeepaliveInterval: time.Second, CAKeepaliveTimeout: -time.Second, CARPCTimeout: -time.Second},
+			fields:  [][]string{{"CAKeepaliveInterval"}, {"CAKeepaliveTimeout"}, {"CARPCTimeout"}},
+		},
+		{
+			name:    "keepalive timeout without interval",
+			options: Options{CAKeepaliveTimeout: 5 * time.Second},
+			fields:  [][]string{{"CAKeepaliveTimeout", "CAKeepaliveInterval"}},
+		},
+		{
+			name:    "CSR throttling",
+			options: Options{SecretRotationJitterRatio: 0.1, CSRRateLimit: 0.5, CSRBurst: 2},
+		},
+		{
+			name:    "invalid CSR throttling",
+			options: Options{SecretRotationJitterRatio: 1.5, CSRRateLimit: 1},
+			fields:  [][]string{{"SecretRotationJitterRatio"}, {"CSRBurst"}},
+		},
+		{
+			name:    "negative near expiry threshold",
+			options: Options{NearExpiryThreshold: -time.Minute},
+			fields:  [][]string{{"NearExpiryThreshold"}},
+		},
+		{
+			name:    "key stores without output directory",
+			options: Options{OutputJKS: true},
+			fields:  [][]string{{"OutputPKCS12", "OutputJKS", "OutputKeyCertToDir"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.options.Validate()
+			if tc.fields == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			var fields [][]string
+			for _, e := range errs {
+				if e.Reason == "" || e.Fix == "" {
+					t.Fatalf("expected an actionable error, got %v", e)
+				}
+				fields = append(fields, e.Fields)
+			}
+			if !reflect.DeepEqual(fields, tc.fields) {
+				t.Fatalf("got errors of fields %v, want %v", fields, tc.fields)
+			}
+		})
+	}
+}
@@ -85,6 +85,66 @@ func (i Identity) String() string {
 	return URIPrefix + i.TrustDomain + "/ns/" + i.Namespace + "/sa/" + i.ServiceAccount
 }
 
+// ID is a SPIFFE ID of any path, unlike Identity which only represents the IDs of Kubernetes service accounts.
+type ID struct {
+	TrustDomain string
+	// Path is the path of the ID, e.g. /ns/default/sa/bookinfo, or empty for the ID of the trust domain.
+	Path string
+}
+
+// ParseID parses a SPIFFE ID, validating it as per the SPIFFE ID specification: the trust domain is
+// made of lowercase letters, digits, dots, dashes and underscores, and the path segments are not empty,
+// "." or "..", and are made of letters, digits, dots, dashes and underscores.
+func ParseID(s string) (ID, error) {
+	if !strings.HasPrefix(s, URIPrefix) {
+		return ID{}, fmt.Errorf("%q is not a SPIFFE ID: scheme is not %s", s, Scheme)
+	}
+	rest := s[URIPrefixLen:]
+	td, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		td, path = rest[:i], rest[i:]
+	}
+	if td == "" {
+		return ID{}, fmt.Errorf("%q is not a SPIFFE ID: trust domain is empty", s)
+	}
+	for _, c := range td {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return ID{}, fmt.Errorf("%q is not a SPIFFE ID: invalid character %q in trust domain", s, c)
+		}
+	}
+	if path != "" {
+		for _, segment := range strings.Split(path[1:], "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return ID{}, fmt.Errorf("%q is not a SPIFFE ID: invalid path segment %q", s, segment)
+			}
+			for _, c := range segment {
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+					return ID{}, fmt.Errorf("%q is not a SPIFFE ID: invalid character %q in path", s, c)
+				}
+			}
+		}
+	}
+	return ID{TrustDomain: td, Path: path}, nil
+}
+
+func (id ID) String() string {
+	return URIPrefix + id.TrustDomain + id.Path
+}
+
+// HasPathPrefix returns whether the path of the ID is prefix or under it, matching whole segments:
+// /ns/foo matches /ns/foo/sa/bar, but not /ns/foobar.
+func (id ID) HasPathPrefix(prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || id.Path == prefix || strings.HasPrefix(id.Path, prefix+"/")
+}
+
+// Identity returns the Kubernetes service account identity of the ID, if its path has the
+// /ns/<namespace>/sa/<service account> form.
+func (id ID) Identity() (Identity, bool) {
+	identity, err := ParseIdentity(id.String())
+	return identity, err == nil
+}
+
 type bundleDoc struct {
 	jose.JSONWebKeySet
 	Sequence    uint64 `json:"spiffe_sequence,omitempty"`
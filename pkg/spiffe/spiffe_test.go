@@ -637,3 +637,52 @@ func TestIdentity(t *testing.T) {
 		})
 	}
 }
+
+func TestParseID(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected *ID
+	}{
+		{"spiffe://td/ns/ns/sa/sa", &ID{TrustDomain: "td", Path: "/ns/ns/sa/sa"}},
+		{"spiffe://td.example_1/workload/Web-1", &ID{TrustDomain: "td.example_1", Path: "/workload/Web-1"}},
+		{"spiffe://td", &ID{TrustDomain: "td"}},
+		{"td/ns/ns/sa/sa", nil},
+		{"spiffe:///ns/ns/sa/sa", nil},
+		{"spiffe://TD/ns/ns/sa/sa", nil},
+		{"spiffe://td:8080/ns/ns", nil},
+		{"spiffe://td/ns//sa", nil},
+		{"spiffe://td/ns/ns/", nil},
+		{"spiffe://td/ns/../sa", nil},
+		{"spiffe://td/ns/ns?query", nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseID(tt.input)
+			if tt.expected == nil {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != *tt.expected {
+				t.Fatalf("expected %v, got %v", *tt.expected, got)
+			}
+			if got.String() != tt.input {
+				t.Fatalf("expected %v to round trip, got %v", tt.input, got.String())
+			}
+		})
+	}
+
+	id := ID{TrustDomain: "td", Path: "/ns/foo/sa/bar"}
+	for prefix, expected := range map[string]bool{"/ns/foo": true, "/ns/foo/": true, "/": true, "/ns/fo": false, "/ns/foo/sa/bar/x": false} {
+		if got := id.HasPathPrefix(prefix); got != expected {
+			t.Errorf("HasPathPrefix(%q) = %v, expected %v", prefix, got, expected)
+		}
+	}
+	if identity, ok := id.Identity(); !ok || identity.Namespace != "foo" || identity.ServiceAccount != "bar" {
+		t.Errorf("unexpected identity %v", identity)
+	}
+}
@@ -33,7 +33,11 @@ const (
 
 // newEnvoy creates a new Envoy struct and starts envoy.
 func (s *TestSetup) newEnvoy() (envoy.Instance, error) {
-	confPath := filepath.Join(env2.IstioOut, fmt.Sprintf("config.conf.%v.yaml", s.ports.AdminPort))
+	out := s.IstioOut
+	if out == "" {
+		out = env2.IstioOut
+	}
+	confPath := filepath.Join(out, fmt.Sprintf("config.conf.%v.yaml", s.ports.AdminPort))
 	log.Printf("Envoy config: in %v\n", confPath)
 	if err := s.CreateEnvoyConf(confPath); err != nil {
 		return nil, err
@@ -22,13 +22,37 @@ import (
 	"istio.io/istio/security/pkg/credentialfetcher/plugin"
 )
 
-func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider string) (security.CredFetcher, error) {
-	switch credtype {
-	case security.GCE:
-		return plugin.CreateGCEPlugin(trustdomain, jwtPath, identityProvider), nil
-	case security.Mock: // for test only
+// The credential fetchers of the cloud platforms, configured by the agent options alone. The
+// credential fetchers with their own configuration are registered by the agent.
+func init() {
+	mustRegisterCredFetcherFactory(security.GCE, func(o *security.Options) (security.CredFetcher, error) {
+		return plugin.CreateGCEPlugin(o.TrustDomain, o.JWTPath, o.CredIdentityProvider), nil
+	})
+	mustRegisterCredFetcherFactory(security.AWS, func(o *security.Options) (security.CredFetcher, error) {
+		return plugin.CreateAWSPlugin(o.CredIdentityProvider), nil
+	})
+	mustRegisterCredFetcherFactory(security.AWSIAM, func(o *security.Options) (security.CredFetcher, error) {
+		return plugin.CreateAWSIAMPlugin(o.TrustDomain, o.CredIdentityProvider), nil
+	})
+	mustRegisterCredFetcherFactory(security.Azure, func(o *security.Options) (security.CredFetcher, error) {
+		return plugin.CreateAzurePlugin(o.CredIdentityProvider), nil
+	})
+	mustRegisterCredFetcherFactory(security.Mock, func(o *security.Options) (security.CredFetcher, error) { // for test only
 		return plugin.CreateMockPlugin("test_token"), nil
-	default:
+	})
+}
+
+func mustRegisterCredFetcherFactory(name string, factory security.CredFetcherFactory) {
+	if err := security.RegisterCredFetcherFactory(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// NewCredFetcher creates the CredFetcher of the registered type credtype.
+func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider string) (security.CredFetcher, error) {
+	factory, f := security.GetCredFetcherFactory(credtype)
+	if !f {
 		return nil, fmt.Errorf("invalid credential fetcher type %s", credtype)
 	}
+	return factory(&security.Options{TrustDomain: trustdomain, JWTPath: jwtPath, CredIdentityProvider: identityProvider})
 }
@@ -40,6 +40,16 @@ func TestNewCredFetcher(t *testing.T) {
 			expectedToken:    "",
 			expectedIdp:      "GoogleComputeEngine",
 		},
+		"aws test": {
+			fetcherType:      security.AWS,
+			identityProvider: security.AWS,
+			expectedIdp:      "AmazonEC2",
+		},
+		"azure test": {
+			fetcherType:      security.Azure,
+			identityProvider: security.Azure,
+			expectedIdp:      "AzureVirtualMachine",
+		},
 		"mock test": {
 			fetcherType:      security.Mock,
 			trustdomain:      "",
@@ -63,6 +73,7 @@ func TestNewCredFetcher(t *testing.T) {
 	// Disable token refresh for GCE VM credential fetcher.
 	plugin.SetTokenRotation(false)
 	for id, tc := range testCases {
+		id, tc := id, tc
 		t.Run(id, func(t *testing.T) {
 			t.Parallel()
 			cf, err := NewCredFetcher(
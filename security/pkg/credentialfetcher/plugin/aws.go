@@ -0,0 +1,159 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is AWS plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var awscredLog = log.RegisterScope("awscred", "AWS credential fetcher for istio agent", 0)
+
+const (
+	// awsMetadataEndpoint is the EC2 instance metadata service (IMDS) address.
+	awsMetadataEndpoint = "http://169.254.169.254"
+	// awsIMDSTokenTTL is the lifetime requested for the IMDSv2 session token, the maximum of 6 hours.
+	awsIMDSTokenTTL = 6 * time.Hour
+	// awsIMDSTokenRefreshMargin is how long before its expiry the IMDSv2 session token is renewed.
+	awsIMDSTokenRefreshMargin = time.Minute
+)
+
+// errIMDSUnauthorized is returned for the requests rejected for an invalid or expired session token.
+var errIMDSUnauthorized = fmt.Errorf("metadata request is unauthorized")
+
+// AWSPlugin fetches the signed EC2 instance identity document, which istiod verifies against the
+// AWS public certificate of the instance's region.
+// For more info: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
+type AWSPlugin struct {
+	// endpoint of the metadata service, overridden in tests.
+	endpoint string
+	client   *http.Client
+
+	// identity provider
+	identityProvider string
+
+	// The IMDSv2 session token is reused until shortly before it expires.
+	mu            sync.Mutex
+	sessionToken  string
+	sessionExpiry time.Time
+}
+
+// CreateAWSPlugin creates an AWS credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAWSPlugin(identityProvider string) *AWSPlugin {
+	return &AWSPlugin{
+		endpoint:         awsMetadataEndpoint,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential fetches the instance identity document and its RSA-SHA256 signature from
+// the metadata service, using an IMDSv2 session token, and returns them encoded as a bearer token.
+// The session token is reused across calls, and renewed if the metadata service rejects it, e.g.
+// after the instance was stopped.
+// Note: this function only works in an EC2 environment.
+func (p *AWSPlugin) GetPlatformCredential() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token, err := p.instanceIdentity()
+	if err == errIMDSUnauthorized {
+		p.sessionToken = ""
+		token, err = p.instanceIdentity()
+	}
+	return token, err
+}
+
+func (p *AWSPlugin) instanceIdentity() (string, error) {
+	sessionToken, err := p.session()
+	if err != nil {
+		awscredLog.Errorf("Failed to get IMDSv2 session token: %v", err)
+		return "", err
+	}
+	header := map[string]string{"X-aws-ec2-metadata-token": sessionToken}
+	doc, err := p.request(http.MethodGet, "/latest/dynamic/instance-identity/document", header)
+	if err != nil {
+		awscredLog.Errorf("Failed to get instance identity document: %v", err)
+		return "", err
+	}
+	sig, err := p.request(http.MethodGet, "/latest/dynamic/instance-identity/signature", header)
+	if err != nil {
+		awscredLog.Errorf("Failed to get instance identity signature: %v", err)
+		return "", err
+	}
+	iid := &security.InstanceIdentityToken{Platform: security.AWS, Document: doc, Signature: sig}
+	return iid.Encode()
+}
+
+// session returns the IMDSv2 session token, requesting a new one if needed.
+func (p *AWSPlugin) session() (string, error) {
+	if p.sessionToken != "" && time.Now().Before(p.sessionExpiry.Add(-awsIMDSTokenRefreshMargin)) {
+		return p.sessionToken, nil
+	}
+	now := time.Now()
+	token, err := p.request(http.MethodPut, "/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": fmt.Sprint(int(awsIMDSTokenTTL.Seconds()))})
+	if err != nil {
+		return "", err
+	}
+	p.sessionToken, p.sessionExpiry = token, now.Add(awsIMDSTokenTTL)
+	return token, nil
+}
+
+func (p *AWSPlugin) request(method, path string, header map[string]string) (string, error) {
+	req, err := http.NewRequest(method, p.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", errIMDSUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata request %s returned status %d", path, resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AWSPlugin) GetType() string {
+	return security.AWS
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AWSPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *AWSPlugin) Stop() {}
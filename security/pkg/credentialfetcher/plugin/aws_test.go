@@ -0,0 +1,118 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestAWSGetPlatformCredential(t *testing.T) {
+	const sessionToken = "session-token"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(sessionToken))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != sessionToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			_, _ = w.Write([]byte(`{"accountId":"123456789012"}`))
+		case "/latest/dynamic/instance-identity/signature":
+			_, _ = w.Write([]byte("c2lnbmF0dXJl"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	p := CreateAWSPlugin("")
+	p.endpoint = ts.URL
+	token, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	iid, err := security.ParseInstanceIdentityToken(token)
+	if err != nil {
+		t.Fatalf("failed to parse token %q: %v", token, err)
+	}
+	if iid.Platform != security.AWS || iid.Document != `{"accountId":"123456789012"}` || iid.Signature != "c2lnbmF0dXJl" {
+		t.Errorf("unexpected instance identity token: %+v", iid)
+	}
+}
+
+func TestAWSGetPlatformCredentialError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	p := CreateAWSPlugin("")
+	p.endpoint = ts.URL
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expected error when the metadata service rejects the request")
+	}
+}
+
+func TestAWSSessionTokenReuse(t *testing.T) {
+	var sessions int32
+	var valid atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			token := fmt.Sprintf("session-%d", atomic.AddInt32(&sessions, 1))
+			valid.Store(token)
+			_, _ = w.Write([]byte(token))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != valid.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	p := CreateAWSPlugin("")
+	p.endpoint = ts.URL
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetPlatformCredential(); err != nil {
+			t.Fatalf("GetPlatformCredential() returned error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&sessions); got != 1 {
+		t.Errorf("expected the session token to be reused, got %d sessions", got)
+	}
+
+	// The metadata service no longer accepts the cached session token, e.g. after a reboot.
+	valid.Store("")
+	if _, err := p.GetPlatformCredential(); err != nil {
+		t.Fatalf("GetPlatformCredential() returned error after the session token was revoked: %v", err)
+	}
+	if got := atomic.LoadInt32(&sessions); got != 2 {
+		t.Errorf("expected a new session token after a 401, got %d sessions", got)
+	}
+}
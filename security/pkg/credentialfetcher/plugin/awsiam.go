@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is AWS IAM plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"istio.io/istio/pkg/security"
+)
+
+// awsIAMDefaultRegion is the region of the STS endpoint if none is configured.
+const awsIAMDefaultRegion = "us-east-1"
+
+// AWSIAMPlugin signs an STS GetCallerIdentity request with the IAM credentials of the workload, found
+// by the default AWS credential chain: environment, EKS web identity token, shared configuration or
+// EC2 instance profile. Istiod sends the request to STS to authenticate the IAM identity.
+type AWSIAMPlugin struct {
+	// serverID is the server the request is intended for, signed in AWSIAMServerIDHeader.
+	serverID string
+	// newSession creates the AWS session, overridden in tests.
+	newSession func() (*session.Session, error)
+
+	// identity provider
+	identityProvider string
+}
+
+// CreateAWSIAMPlugin creates an AWS IAM credential fetcher plugin for the requests to serverID, the
+// trust domain. Return the pointer to the created plugin.
+func CreateAWSIAMPlugin(serverID, identityProvider string) *AWSIAMPlugin {
+	return &AWSIAMPlugin{
+		serverID:         serverID,
+		newSession:       func() (*session.Session, error) { return session.NewSession() },
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential returns the signed GetCallerIdentity request, encoded as a bearer token.
+func (p *AWSIAMPlugin) GetPlatformCredential() (string, error) {
+	sess, err := p.newSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create AWS session: %v", err)
+	}
+	config := aws.NewConfig()
+	if aws.StringValue(sess.Config.Region) == "" {
+		config = config.WithRegion(awsIAMDefaultRegion)
+	}
+	req, _ := sts.New(sess, config).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Set(security.AWSIAMServerIDHeader, p.serverID)
+	if err := req.Sign(); err != nil {
+		awscredLog.Errorf("Failed to sign GetCallerIdentity request: %v", err)
+		return "", err
+	}
+	body, err := io.ReadAll(req.HTTPRequest.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GetCallerIdentity request: %v", err)
+	}
+	token := &security.AWSIAMToken{
+		Method:  req.HTTPRequest.Method,
+		URL:     req.HTTPRequest.URL.String(),
+		Body:    string(body),
+		Headers: req.HTTPRequest.Header,
+	}
+	return token.Encode()
+}
+
+// GetType returns credential fetcher type.
+func (p *AWSIAMPlugin) GetType() string {
+	return security.AWSIAM
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AWSIAMPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *AWSIAMPlugin) Stop() {}
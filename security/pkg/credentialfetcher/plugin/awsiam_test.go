@@ -0,0 +1,55 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestAWSIAMGetPlatformCredential(t *testing.T) {
+	p := CreateAWSIAMPlugin("cluster.local", "")
+	p.newSession = func() (*session.Session, error) {
+		return session.NewSession(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+			Region:      aws.String("us-west-2"),
+		})
+	}
+	token, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	iam, err := security.ParseAWSIAMToken(token)
+	if err != nil {
+		t.Fatalf("failed to parse token %q: %v", token, err)
+	}
+	if iam.Method != http.MethodPost || !strings.HasPrefix(iam.URL, "https://sts.") || !strings.Contains(iam.Body, "Action=GetCallerIdentity") {
+		t.Errorf("unexpected request %+v", iam)
+	}
+	if iam.Headers.Get(security.AWSIAMServerIDHeader) != "cluster.local" {
+		t.Errorf("got server ID headers %v, expected cluster.local", iam.Headers)
+	}
+	auth := iam.Headers.Get("Authorization")
+	if !strings.Contains(auth, "Credential=AKID/") || !strings.Contains(auth, strings.ToLower(security.AWSIAMServerIDHeader)) {
+		t.Errorf("expected the server ID to be signed, got authorization %q", auth)
+	}
+}
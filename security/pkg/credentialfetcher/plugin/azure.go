@@ -0,0 +1,112 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is Azure plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var azurecredLog = log.RegisterScope("azurecred", "Azure credential fetcher for istio agent", 0)
+
+const (
+	// azureMetadataEndpoint is the Azure instance metadata service (IMDS) address.
+	azureMetadataEndpoint = "http://169.254.169.254"
+	azureAttestedPath     = "/metadata/attested/document?api-version=2020-09-01"
+)
+
+// AzurePlugin fetches the attested metadata document of the VM. The document is a PKCS#7 blob
+// signed by the Azure metadata service, which istiod verifies before trusting the VM. It is requested
+// with the current Unix time as nonce, which istiod checks to reject replayed documents.
+// For more info: https://docs.microsoft.com/azure/virtual-machines/linux/instance-metadata-service
+type AzurePlugin struct {
+	// endpoint of the metadata service, overridden in tests.
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+
+	// identity provider
+	identityProvider string
+}
+
+// CreateAzurePlugin creates an Azure credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAzurePlugin(identityProvider string) *AzurePlugin {
+	return &AzurePlugin{
+		endpoint:         azureMetadataEndpoint,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		now:              time.Now,
+		identityProvider: identityProvider,
+	}
+}
+
+type attestedDocument struct {
+	Encoding  string `json:"encoding"`
+	Signature string `json:"signature"`
+}
+
+// GetPlatformCredential fetches the attested document from the metadata service and returns it
+// encoded as a bearer token.
+// Note: this function only works in an Azure VM environment.
+func (p *AzurePlugin) GetPlatformCredential() (string, error) {
+	url := fmt.Sprintf("%s%s&nonce=%d", p.endpoint, azureAttestedPath, p.now().Unix())
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		azurecredLog.Errorf("Failed to get attested document from metadata server: %v", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("attested document request returned status %d", resp.StatusCode)
+	}
+	doc := &attestedDocument{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return "", fmt.Errorf("failed to unmarshal attested document: %v", err)
+	}
+	if doc.Encoding != "pkcs7" {
+		return "", fmt.Errorf("unsupported attested document encoding %q", doc.Encoding)
+	}
+	iid := &security.InstanceIdentityToken{Platform: security.Azure, Signature: doc.Signature}
+	return iid.Encode()
+}
+
+// GetType returns credential fetcher type.
+func (p *AzurePlugin) GetType() string {
+	return security.Azure
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AzurePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *AzurePlugin) Stop() {}
@@ -0,0 +1,70 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestAzureGetPlatformCredential(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "pkcs7", body: `{"encoding":"pkcs7","signature":"TUlJ"}`},
+		{name: "unknown encoding", body: `{"encoding":"jws","signature":"TUlJ"}`, wantErr: true},
+		{name: "malformed", body: `not json`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/attested/document" ||
+					r.URL.Query().Get("nonce") != "1630497600" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(c.body))
+			}))
+			defer ts.Close()
+
+			p := CreateAzurePlugin("")
+			p.endpoint = ts.URL
+			p.now = func() time.Time { return time.Unix(1630497600, 0) }
+			token, err := p.GetPlatformCredential()
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got token %q", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() returned error: %v", err)
+			}
+			iid, err := security.ParseInstanceIdentityToken(token)
+			if err != nil {
+				t.Fatalf("failed to parse token %q: %v", token, err)
+			}
+			if iid.Platform != security.Azure || iid.Signature != "TUlJ" {
+				t.Errorf("unexpected instance identity token: %+v", iid)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the Azure managed identity plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	azureManagedIdentityPath = "/metadata/identity/oauth2/token"
+	// azureManagedIdentityAPIVersion is the IMDS API version of the managed identity endpoint.
+	azureManagedIdentityAPIVersion = "2018-02-01"
+	// azureManagedIdentityExpiryMargin is how long before its expiry an access token is requested again.
+	azureManagedIdentityExpiryMargin = 5 * time.Minute
+)
+
+// AzureManagedIdentityPlugin fetches an Azure AD access token of the managed identity of the VM from
+// the Azure metadata service, for the configured resource, i.e. the audience of the token. Istiod
+// verifies it against the Azure AD tenant configured in AZURE_AD_AUTHENTICATION.
+// For more info: https://docs.microsoft.com/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
+type AzureManagedIdentityPlugin struct {
+	// endpoint of the metadata service, overridden in tests.
+	endpoint string
+	client   *http.Client
+
+	// resource is the application ID URI the token is requested for, e.g. api://istiod.
+	resource string
+	// clientID selects a user-assigned managed identity. If empty, the system-assigned identity is used.
+	clientID string
+
+	// identity provider
+	identityProvider string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// CreateAzureManagedIdentityPlugin creates an Azure managed identity credential fetcher plugin, requesting
+// tokens for resource with the managed identity clientID, or the system-assigned one if clientID is empty.
+func CreateAzureManagedIdentityPlugin(resource, clientID, identityProvider string) *AzureManagedIdentityPlugin {
+	return &AzureManagedIdentityPlugin{
+		endpoint:         azureMetadataEndpoint,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		resource:         resource,
+		clientID:         clientID,
+		identityProvider: identityProvider,
+	}
+}
+
+type managedIdentityToken struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresOn is the expiry of the token in seconds since the epoch, as a string.
+	ExpiresOn string `json:"expires_on"`
+}
+
+// GetPlatformCredential returns an access token of the managed identity. The token is reused until
+// shortly before its expiry.
+// Note: this function only works in an Azure VM environment.
+func (p *AzureManagedIdentityPlugin) GetPlatformCredential() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expiry.Add(-azureManagedIdentityExpiryMargin)) {
+		return p.token, nil
+	}
+	token, expiry, err := p.fetch()
+	if err != nil {
+		azurecredLog.Errorf("Failed to get managed identity token from metadata server: %v", err)
+		return "", err
+	}
+	p.token, p.expiry = token, expiry
+	return token, nil
+}
+
+func (p *AzureManagedIdentityPlugin) fetch() (string, time.Time, error) {
+	query := url.Values{}
+	query.Set("api-version", azureManagedIdentityAPIVersion)
+	query.Set("resource", p.resource)
+	if p.clientID != "" {
+		query.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+azureManagedIdentityPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("managed identity token request returned status %d: %s", resp.StatusCode, body)
+	}
+	tok := &managedIdentityToken{}
+	if err := json.Unmarshal(body, tok); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to unmarshal managed identity token: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("managed identity token response has no access token")
+	}
+	// Without a valid expiry the token is not reused.
+	var expiry time.Time
+	if secs, err := strconv.ParseInt(tok.ExpiresOn, 10, 64); err == nil {
+		expiry = time.Unix(secs, 0)
+	}
+	return tok.AccessToken, expiry, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AzureManagedIdentityPlugin) GetType() string {
+	return security.AzureManagedIdentity
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AzureManagedIdentityPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *AzureManagedIdentityPlugin) Stop() {}
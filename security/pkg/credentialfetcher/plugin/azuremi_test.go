@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAzureManagedIdentityGetPlatformCredential(t *testing.T) {
+	cases := []struct {
+		name      string
+		clientID  string
+		expiresIn time.Duration
+		status    int
+		// requests is the number of token requests expected for two credentials.
+		requests int32
+		wantErr  bool
+	}{
+		{name: "system-assigned identity", expiresIn: time.Hour, requests: 1},
+		{name: "user-assigned identity", clientID: "client", expiresIn: time.Hour, requests: 1},
+		{name: "token about to expire", expiresIn: time.Minute, requests: 2},
+		{name: "no identity", status: http.StatusBadRequest, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				q := r.URL.Query()
+				if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/identity/oauth2/token" ||
+					q.Get("resource") != "api://istiod" || q.Get("client_id") != c.clientID {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if c.status != 0 {
+					w.WriteHeader(c.status)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_on":"%d","token_type":"Bearer"}`,
+					atomic.LoadInt32(&requests), time.Now().Add(c.expiresIn).Unix())
+			}))
+			defer ts.Close()
+
+			p := CreateAzureManagedIdentityPlugin("api://istiod", c.clientID, "")
+			p.endpoint = ts.URL
+			token, err := p.GetPlatformCredential()
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got token %q", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() returned error: %v", err)
+			}
+			if token != "token-1" {
+				t.Errorf("unexpected token %q", token)
+			}
+			if _, err := p.GetPlatformCredential(); err != nil {
+				t.Fatalf("GetPlatformCredential() returned error: %v", err)
+			}
+			if got := atomic.LoadInt32(&requests); got != c.requests {
+				t.Errorf("expected %d token requests, got %d", c.requests, got)
+			}
+		})
+	}
+}
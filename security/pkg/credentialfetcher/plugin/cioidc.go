@@ -0,0 +1,152 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the CI OIDC plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/util"
+	"istio.io/pkg/log"
+)
+
+var ciCredLog = log.RegisterScope("cicred", "CI OIDC credential fetcher for istio agent", 0)
+
+const (
+	// ciOIDCTokenField is the field of the token in the responses of the GitHub Actions endpoint.
+	ciOIDCTokenField = "value"
+	// ciOIDCDefaultTTL is how long tokens without an exp claim are reused.
+	ciOIDCDefaultTTL = time.Minute
+)
+
+// CIOIDCPlugin fetches an OIDC token of the CI job from the token endpoint of the CI system, as
+// GitHub Actions provides it in ACTIONS_ID_TOKEN_REQUEST_URL: the request is authenticated with a
+// bearer token of the job, the audience is passed in the audience query parameter, and the token is
+// returned in a field of a JSON object. Istiod maps the claims of the token, e.g. the repository,
+// to a mesh identity with OIDC_ISSUERS, so that ephemeral CI runners can join the mesh.
+type CIOIDCPlugin struct {
+	requestURL   string
+	requestToken string
+	audience     string
+	// tokenField is the field of the token in the JSON response.
+	tokenField string
+	client     *http.Client
+
+	identityProvider string
+
+	mu sync.Mutex
+	// token is reused until half its lifetime has passed.
+	token       string
+	refreshTime time.Time
+}
+
+// CreateCIOIDCPlugin creates a CI OIDC credential fetcher plugin, requesting tokens of audience from
+// requestURL with the bearer token requestToken. The token is read from the tokenField field of the
+// response, "value" if empty.
+func CreateCIOIDCPlugin(requestURL, requestToken, audience, tokenField, identityProvider string) *CIOIDCPlugin {
+	if tokenField == "" {
+		tokenField = ciOIDCTokenField
+	}
+	return &CIOIDCPlugin{
+		requestURL:       requestURL,
+		requestToken:     requestToken,
+		audience:         audience,
+		tokenField:       tokenField,
+		client:           &http.Client{Timeout: 10 * time.Second},
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential returns an OIDC token of the CI job.
+func (p *CIOIDCPlugin) GetPlatformCredential() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.token != "" && now.Before(p.refreshTime) {
+		return p.token, nil
+	}
+	token, err := p.fetch()
+	if err != nil {
+		ciCredLog.Errorf("Failed to get OIDC token from CI token endpoint: %v", err)
+		return "", err
+	}
+	expiry := now.Add(ciOIDCDefaultTTL)
+	if exp, err := util.GetExp(token); err == nil && !exp.IsZero() {
+		expiry = exp
+	}
+	p.token, p.refreshTime = token, now.Add(expiry.Sub(now)/2)
+	return token, nil
+}
+
+func (p *CIOIDCPlugin) fetch() (string, error) {
+	u, err := url.Parse(p.requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid CI token request URL: %v", err)
+	}
+	if p.audience != "" {
+		// The URL of GitHub Actions already has query parameters.
+		q := u.Query()
+		q.Set("audience", p.audience)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.requestToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("CI token request returned status %d", resp.StatusCode)
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", fmt.Errorf("failed to unmarshal CI token response: %v", err)
+	}
+	token, _ := fields[p.tokenField].(string)
+	if token == "" {
+		return "", fmt.Errorf("CI token response has no %s field", p.tokenField)
+	}
+	return token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *CIOIDCPlugin) GetType() string {
+	return security.CIOIDC
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *CIOIDCPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *CIOIDCPlugin) Stop() {}
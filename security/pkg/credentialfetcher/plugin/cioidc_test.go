@@ -0,0 +1,80 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCIOIDCGetPlatformCredential(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"repo:org/repo:ref:refs/heads/main","exp":%d}`, exp)))
+	jwt := "eyJhbGciOiJSUzI1NiJ9." + payload + ".c2ln"
+
+	cases := []struct {
+		name       string
+		tokenField string
+		response   string
+		wantErr    bool
+	}{
+		{name: "GitHub Actions", response: `{"count":1,"value":"` + jwt + `"}`},
+		{name: "custom field", tokenField: "token", response: `{"token":"` + jwt + `"}`},
+		{name: "missing field", response: `{"token":"` + jwt + `"}`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				q := r.URL.Query()
+				if r.Header.Get("Authorization") != "Bearer request-token" || q.Get("api-version") != "2.0" ||
+					q.Get("audience") != "istio-ca" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(c.response))
+			}))
+			defer ts.Close()
+
+			p := CreateCIOIDCPlugin(ts.URL+"/token?api-version=2.0", "request-token", "istio-ca", c.tokenField, "")
+			token, err := p.GetPlatformCredential()
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got token %q", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() returned error: %v", err)
+			}
+			if token != jwt {
+				t.Errorf("unexpected token %q", token)
+			}
+			// The token is reused until half its lifetime has passed.
+			if _, err := p.GetPlatformCredential(); err != nil {
+				t.Fatalf("GetPlatformCredential() returned error: %v", err)
+			}
+			if got := atomic.LoadInt32(&requests); got != 1 {
+				t.Errorf("expected 1 token request, got %d", got)
+			}
+		})
+	}
+}
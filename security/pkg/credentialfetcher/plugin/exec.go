@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the exec plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var execcredLog = log.RegisterScope("execcred", "Exec credential fetcher for istio agent", 0)
+
+const (
+	// execInfoEnv is the variable the ExecCredential of the request is passed in, as by kubectl.
+	execInfoEnv = "KUBERNETES_EXEC_INFO"
+	// execCredentialKind is the kind of the ExecCredential objects exchanged with the command.
+	execCredentialKind = "ExecCredential"
+	// ExecAPIVersion is the API version of the ExecCredential sent to the command. The command may reply
+	// with v1 or v1beta1.
+	ExecAPIVersion = "client.authentication.k8s.io/v1"
+
+	execTimeout = 30 * time.Second
+	// execExpiryMargin is how long before its expiry a credential is fetched again.
+	execExpiryMargin = 30 * time.Second
+)
+
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       execCredentialSpec    `json:"spec"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialSpec struct {
+	Interactive bool `json:"interactive"`
+}
+
+type execCredentialStatus struct {
+	Token               string     `json:"token"`
+	ExpirationTimestamp *time.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// ExecPlugin fetches the credential by running an operator supplied command, following the contract of
+// the kubectl credential plugins: the command gets an ExecCredential in KUBERNETES_EXEC_INFO, and writes
+// an ExecCredential with the token and its optional expiry to its standard output. This covers the
+// platforms and identity providers without a native plugin.
+type ExecPlugin struct {
+	command string
+	args    []string
+	// env is added to the environment of the agent for the command.
+	env     []string
+	timeout time.Duration
+
+	identityProvider string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// CreateExecPlugin creates an exec credential fetcher plugin running command with args and the
+// additional environment variables env, as KEY=value.
+func CreateExecPlugin(command string, args, env []string, identityProvider string) *ExecPlugin {
+	return &ExecPlugin{
+		command:          command,
+		args:             args,
+		env:              env,
+		timeout:          execTimeout,
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential returns the token written by the command. The token is reused until shortly
+// before its expiry, if the command reported one, else the command runs for each credential.
+func (p *ExecPlugin) GetPlatformCredential() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Before(p.expiry.Add(-execExpiryMargin)) {
+		return p.token, nil
+	}
+	token, expiry, err := p.run()
+	if err != nil {
+		return "", err
+	}
+	p.token, p.expiry = token, expiry
+	return token, nil
+}
+
+func (p *ExecPlugin) run() (string, time.Time, error) {
+	input, err := json.Marshal(execCredential{APIVersion: ExecAPIVersion, Kind: execCredentialKind})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Env = append(append(os.Environ(), p.env...), execInfoEnv+"="+string(input))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		execcredLog.Errorf("credential command %s failed: %v: %s", p.command, err, strings.TrimSpace(stderr.String()))
+		return "", time.Time{}, fmt.Errorf("credential command %s failed: %v", p.command, err)
+	}
+	cred := &execCredential{}
+	if err := json.Unmarshal(stdout.Bytes(), cred); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to unmarshal the output of credential command %s: %v", p.command, err)
+	}
+	if cred.Kind != execCredentialKind || !strings.HasPrefix(cred.APIVersion, "client.authentication.k8s.io/") {
+		return "", time.Time{}, fmt.Errorf("credential command %s returned a %s %s, expected an %s",
+			p.command, cred.APIVersion, cred.Kind, execCredentialKind)
+	}
+	if cred.Status == nil || cred.Status.Token == "" {
+		return "", time.Time{}, fmt.Errorf("credential command %s returned no token", p.command)
+	}
+	var expiry time.Time
+	if cred.Status.ExpirationTimestamp != nil {
+		expiry = *cred.Status.ExpirationTimestamp
+	}
+	return cred.Status.Token, expiry, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *ExecPlugin) GetType() string {
+	return security.Exec
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *ExecPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *ExecPlugin) Stop() {}
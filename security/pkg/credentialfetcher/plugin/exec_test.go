@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// credentialCommand writes a credential command printing output, and recording its runs and
+// KUBERNETES_EXEC_INFO in the returned file.
+func credentialCommand(t *testing.T, output string, exitCode int) (string, string) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$1 $KUBERNETES_EXEC_INFO\" >> %s\ncat <<'EOF'\n%s\nEOF\nexit %d\n", runs, output, exitCode)
+	command := filepath.Join(dir, "credential")
+	if err := os.WriteFile(command, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return command, runs
+}
+
+func readRuns(t *testing.T, runs string) []string {
+	b, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestExecGetPlatformCredential(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	command, runs := credentialCommand(t, `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential",`+
+		`"status":{"token":"exec-token","expirationTimestamp":"`+expiry+`"}}`, 0)
+	p := CreateExecPlugin(command, []string{"--audience=istio-ca"}, nil, "idp")
+	for i := 0; i < 2; i++ {
+		token, err := p.GetPlatformCredential()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "exec-token" {
+			t.Fatalf("got token %q", token)
+		}
+	}
+	got := readRuns(t, runs)
+	if len(got) != 1 {
+		t.Fatalf("expected the credential to be cached until its expiry, got runs %v", got)
+	}
+	if !strings.HasPrefix(got[0], "--audience=istio-ca ") || !strings.Contains(got[0], `"kind":"ExecCredential"`) {
+		t.Fatalf("unexpected arguments or exec info %q", got[0])
+	}
+	if p.GetType() != "Exec" || p.GetIdentityProvider() != "idp" {
+		t.Fatalf("unexpected type %s or identity provider %s", p.GetType(), p.GetIdentityProvider())
+	}
+}
+
+func TestExecGetPlatformCredentialNoExpiry(t *testing.T) {
+	command, runs := credentialCommand(t, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"t"}}`, 0)
+	p := CreateExecPlugin(command, nil, nil, "")
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetPlatformCredential(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readRuns(t, runs); len(got) != 2 {
+		t.Fatalf("expected the command to run for each credential without expiry, got runs %v", got)
+	}
+}
+
+func TestExecGetPlatformCredentialErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		exitCode int
+	}{
+		{name: "failure", output: `{}`, exitCode: 1},
+		{name: "malformed", output: `not json`},
+		{name: "other kind", output: `{"apiVersion":"v1","kind":"Secret","status":{"token":"t"}}`},
+		{name: "no token", output: `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{}}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			command, _ := credentialCommand(t, c.output, c.exitCode)
+			if token, err := CreateExecPlugin(command, nil, nil, "").GetPlatformCredential(); err == nil {
+				t.Fatalf("expected an error, got token %q", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the token file plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/filewatcher"
+	"istio.io/pkg/log"
+)
+
+var filecredLog = log.RegisterScope("filecred", "Token file credential fetcher for istio agent", 0)
+
+// TokenFilePlugin reads the credential from a token file, e.g. of a projected volume or written by
+// another sidecar, and watches the file to notify the refresh handlers when the token is rotated.
+type TokenFilePlugin struct {
+	path             string
+	identityProvider string
+	watcher          filewatcher.FileWatcher
+
+	refreshNotifier
+
+	mu sync.Mutex
+	// token is the last token read by the watch, to tell its rotations from other file events.
+	token string
+}
+
+var _ security.CredentialRefreshNotifier = &TokenFilePlugin{}
+
+// CreateTokenFilePlugin creates a token file credential fetcher plugin reading path. The file does
+// not need to exist yet.
+func CreateTokenFilePlugin(path, identityProvider string) (*TokenFilePlugin, error) {
+	p := &TokenFilePlugin{
+		path:             path,
+		identityProvider: identityProvider,
+		watcher:          filewatcher.NewWatcher(),
+	}
+	p.token, _ = p.read()
+	if err := p.watcher.Add(path); err != nil {
+		_ = p.watcher.Close()
+		return nil, fmt.Errorf("failed to watch token file %s: %v", path, err)
+	}
+	go p.watch(p.watcher.Events(path), p.watcher.Errors(path))
+	return p, nil
+}
+
+// GetPlatformCredential returns the token currently in the file.
+func (p *TokenFilePlugin) GetPlatformCredential() (string, error) {
+	return p.read()
+}
+
+func (p *TokenFilePlugin) read() (string, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", p.path)
+	}
+	return token, nil
+}
+
+func (p *TokenFilePlugin) watch(events <-chan fsnotify.Event, errors <-chan error) {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			p.onFileEvent()
+		case err, ok := <-errors:
+			if !ok {
+				return
+			}
+			filecredLog.Warnf("error watching token file %s: %v", p.path, err)
+		}
+	}
+}
+
+func (p *TokenFilePlugin) onFileEvent() {
+	token, err := p.read()
+	if err != nil {
+		// The file is being replaced or was removed, wait for the new token.
+		filecredLog.Debugf("token file changed but is not readable: %v", err)
+		return
+	}
+	p.mu.Lock()
+	if token == p.token {
+		p.mu.Unlock()
+		return
+	}
+	p.token = token
+	p.mu.Unlock()
+	filecredLog.Infof("token file %s was refreshed", p.path)
+	p.notifyRefresh()
+}
+
+// GetType returns credential fetcher type.
+func (p *TokenFilePlugin) GetType() string {
+	return security.TokenFile
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *TokenFilePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *TokenFilePlugin) Stop() {
+	_ = p.watcher.Close()
+}
@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenFilePlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	p, err := CreateTokenFilePlugin(path, "")
+	if err != nil {
+		t.Fatalf("CreateTokenFilePlugin() returned error: %v", err)
+	}
+	defer p.Stop()
+	refreshed := make(chan struct{}, 10)
+	p.AddRefreshHandler(func() { refreshed <- struct{}{} })
+
+	// The token file is provisioned after the agent started.
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Fatal("expected error without a token file")
+	}
+	writeToken(t, path, "token-1\n")
+	expectRefresh(t, refreshed)
+	if token, err := p.GetPlatformCredential(); err != nil || token != "token-1" {
+		t.Fatalf("GetPlatformCredential() = %q, %v, want token-1", token, err)
+	}
+
+	writeToken(t, path, "token-2")
+	expectRefresh(t, refreshed)
+	if token, err := p.GetPlatformCredential(); err != nil || token != "token-2" {
+		t.Fatalf("GetPlatformCredential() = %q, %v, want token-2", token, err)
+	}
+
+	// Rewriting the same token is not a refresh.
+	writeToken(t, path, "token-2\n")
+	select {
+	case <-refreshed:
+		t.Fatal("unexpected refresh without a new token")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// writeToken replaces the token file atomically, as the kubelet does for projected volumes.
+func writeToken(t *testing.T, path, token string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectRefresh(t *testing.T, refreshed <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the token refresh")
+	}
+}
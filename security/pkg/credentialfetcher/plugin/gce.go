@@ -65,8 +65,12 @@ type GCEPlugin struct {
 	tokenCache     string
 	// mutex lock is required to avoid race condition when updating token file and token cache.
 	tokenMutex sync.RWMutex
+	// The refresh handlers are notified of the new tokens of the rotation job.
+	refreshNotifier
 }
 
+var _ security.CredentialRefreshNotifier = &GCEPlugin{}
+
 // CreateGCEPlugin creates a Google credential fetcher plugin. Return the pointer to the created plugin.
 func CreateGCEPlugin(audience, jwtPath, identityProvider string) *GCEPlugin {
 	p := &GCEPlugin{
@@ -103,8 +107,16 @@ func (p *GCEPlugin) startTokenRotationJob() {
 
 func (p *GCEPlugin) rotate() {
 	if p.shouldRotate(time.Now()) {
-		if _, err := p.GetPlatformCredential(); err != nil {
+		p.tokenMutex.RLock()
+		previous := p.tokenCache
+		p.tokenMutex.RUnlock()
+		token, err := p.GetPlatformCredential()
+		if err != nil {
 			gcecredLog.Errorf("credential refresh failed: %+v", err)
+			return
+		}
+		if token != previous {
+			p.notifyRefresh()
 		}
 	}
 }
@@ -304,3 +304,40 @@ func TestTokenRotationJob(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenRotationJobNotifiesRefresh(t *testing.T) {
+	rotationInterval = 100 * time.Millisecond
+	SetTokenRotation(true)
+	ms, err := StartMetadataServer()
+	if err != nil {
+		t.Fatalf("StartMetadataServer() returns err: %v", err)
+	}
+	t.Cleanup(func() {
+		ms.Stop()
+		rotationInterval = 5 * time.Minute
+	})
+	jwtPath := fmt.Sprintf("/tmp/security-pkg-credentialfetcher-plugin-gcetest-%s", uuid.New().String())
+	if err := creatJWTFile(jwtPath); err != nil {
+		t.Fatalf("creatJWTFile() returns err: %v", err)
+	}
+	defer os.Remove(jwtPath)
+
+	// The mock metadata server returns a new token without expiry on each call, rotated every interval.
+	ms.Reset()
+	p := CreateGCEPlugin("", jwtPath, "")
+	defer p.Stop()
+	refreshed := make(chan struct{}, 10)
+	p.AddRefreshHandler(func() {
+		select {
+		case refreshed <- struct{}{}:
+		default:
+		}
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-refreshed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the token refresh")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import "sync"
+
+// refreshNotifier implements security.CredentialRefreshNotifier for the plugins refreshing their
+// credential in the background.
+type refreshNotifier struct {
+	mu       sync.Mutex
+	handlers []func()
+}
+
+// AddRefreshHandler registers f to be called after the credential changed.
+func (n *refreshNotifier) AddRefreshHandler(f func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers = append(n.handlers, f)
+}
+
+// notifyRefresh calls the refresh handlers. It must not be called from GetPlatformCredential, as the
+// handlers may wait for the requests authenticated with the credential.
+func (n *refreshNotifier) notifyRefresh() {
+	n.mu.Lock()
+	handlers := append([]func(){}, n.handlers...)
+	n.mu.Unlock()
+	for _, h := range handlers {
+		h()
+	}
+}
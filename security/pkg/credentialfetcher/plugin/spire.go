@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the SPIRE plugin of credentialfetcher.
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var spirecredLog = log.RegisterScope("spirecred", "SPIRE credential fetcher for istio agent", 0)
+
+const spireFetchTimeout = 10 * time.Second
+
+// SPIREPlugin fetches a JWT SVID of the workload for the configured audience from the Workload API
+// of the local SPIRE agent. Istiod verifies it with the JWT authenticator of the SPIRE issuer, e.g.
+// configured with the OIDC discovery provider of the SPIRE server.
+type SPIREPlugin struct {
+	// socket is the unix domain socket of the SPIRE agent Workload API.
+	socket   string
+	audience string
+	timeout  time.Duration
+
+	identityProvider string
+
+	mu sync.Mutex
+	// token is reused until half its lifetime has passed.
+	token       string
+	refreshTime time.Time
+}
+
+// CreateSPIREPlugin creates a SPIRE credential fetcher plugin, fetching the JWT SVIDs of audience
+// from the SPIRE agent listening on socket.
+func CreateSPIREPlugin(socket, audience, identityProvider string) *SPIREPlugin {
+	return &SPIREPlugin{
+		socket:           socket,
+		audience:         audience,
+		timeout:          spireFetchTimeout,
+		identityProvider: identityProvider,
+	}
+}
+
+// GetPlatformCredential returns a JWT SVID of the workload.
+func (p *SPIREPlugin) GetPlatformCredential() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.token != "" && now.Before(p.refreshTime) {
+		return p.token, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	svid, err := workloadapi.FetchJWTSVID(ctx, jwtsvid.Params{Audience: p.audience},
+		workloadapi.WithAddr("unix://"+p.socket))
+	if err != nil {
+		spirecredLog.Errorf("Failed to fetch JWT SVID from SPIRE agent %s: %v", p.socket, err)
+		return "", fmt.Errorf("failed to fetch JWT SVID for audience %q: %v", p.audience, err)
+	}
+	p.token, p.refreshTime = svid.Marshal(), now.Add(svid.Expiry.Sub(now)/2)
+	spirecredLog.Debugf("fetched JWT SVID of %s, expiring at %v", svid.ID, svid.Expiry)
+	return p.token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *SPIREPlugin) GetType() string {
+	return security.SPIRE
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *SPIREPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// Stop releases resources and cleans up.
+func (p *SPIREPlugin) Stop() {}
@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/workloadapi"
+)
+
+func TestSPIREGetPlatformCredential(t *testing.T) {
+	const (
+		spiffeID = "spiffe://cluster.local/ns/foo/sa/bar"
+		audience = "istiod.istio-system.svc"
+	)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(time.Hour)
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Subject:  spiffeID,
+		Audience: jwt.Audience{audience},
+		Expiry:   jwt.NewNumericDate(expiry),
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Workload API server of the agent stands in for the SPIRE agent.
+	socket := filepath.Join(t.TempDir(), "spire.sock")
+	store := security.NewDirectSecretManager()
+	store.SetJWTSVID(audience, &security.JWTSVID{SpiffeID: spiffeID, Token: token, Audience: audience, ExpireTime: expiry})
+	server, err := workloadapi.NewServer(&security.Options{WorkloadAPIUDSPath: socket}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	p := CreateSPIREPlugin(socket, audience, "")
+	got, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() returned error: %v", err)
+	}
+	if got != token {
+		t.Errorf("expected the JWT SVID of the SPIRE agent, got %q", got)
+	}
+
+	// The JWT SVID is reused until half its lifetime has passed.
+	store.SetJWTSVID(audience, nil)
+	if got, err := p.GetPlatformCredential(); err != nil || got != token {
+		t.Errorf("expected the cached JWT SVID, got %q, %v", got, err)
+	}
+	p.refreshTime = time.Now()
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expected error once the SPIRE agent has no JWT SVID")
+	}
+}
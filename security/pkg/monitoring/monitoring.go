@@ -16,12 +16,13 @@ package monitoring
 
 import "istio.io/pkg/monitoring"
 
-// RequestType specifies the type of request we are monitoring. Current supported are CSR and TokenExchange
+// RequestType specifies the type of request we are monitoring. Current supported are CSR, TokenExchange and JWTSVID
 var RequestType = monitoring.MustCreateLabel("request_type")
 
 const (
 	TokenExchange = "token_exchange"
 	CSR           = "csr"
+	JWTSVID       = "jwt_svid"
 )
 
 var NumOutgoingRetries = monitoring.NewSum(
@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/istio/pkg/security"
+)
+
+// GenerateSecrets generates the secrets of resourceNames, see GenerateSecretsWithContext.
+func (sc *SecretManagerClient) GenerateSecrets(resourceNames []string) (map[string]*security.SecretItem, error) {
+	return sc.GenerateSecretsWithContext(context.Background(), resourceNames)
+}
+
+// GenerateSecretsWithContext generates the secrets of resourceNames at once. The workload certificate
+// and its root are generated first, so that they are issued by a single CSR. The other resources, e.g.
+// the file certificates of gateways or the workload certificates of another key type or TTL, are then
+// generated concurrently, sharing the connection to the CA. The secrets generated are returned along
+// with an error for the others.
+func (sc *SecretManagerClient) GenerateSecretsWithContext(ctx context.Context,
+	resourceNames []string) (map[string]*security.SecretItem, error) {
+	secrets := make(map[string]*security.SecretItem, len(resourceNames))
+	var (
+		mu   sync.Mutex
+		errs *multierror.Error
+	)
+	generate := func(resourceName string) {
+		secret, err := sc.GenerateSecretWithContext(ctx, resourceName)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", resourceName, err))
+			return
+		}
+		secrets[resourceName] = secret
+	}
+
+	others := make([]string, 0, len(resourceNames))
+	seen := make(map[string]struct{}, len(resourceNames))
+	for _, resourceName := range resourceNames {
+		if _, f := seen[resourceName]; f {
+			continue
+		}
+		seen[resourceName] = struct{}{}
+		if resourceName != security.WorkloadKeyCertResourceName && resourceName != security.RootCertReqResourceName {
+			others = append(others, resourceName)
+		}
+	}
+	// The root is served from the cache once the workload certificate is issued.
+	for _, resourceName := range []string{security.WorkloadKeyCertResourceName, security.RootCertReqResourceName} {
+		if _, f := seen[resourceName]; f {
+			generate(resourceName)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, resourceName := range others {
+		wg.Add(1)
+		go func(resourceName string) {
+			defer wg.Done()
+			generate(resourceName)
+		}(resourceName)
+	}
+	wg.Wait()
+	return secrets, errs.ErrorOrNil()
+}
@@ -0,0 +1,59 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestGenerateSecrets(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	invalid := security.WorkloadKeyCertTTLResourcePrefix + "forever"
+	secrets, err := sc.GenerateSecrets([]string{
+		security.RootCertReqResourceName,
+		security.WorkloadKeyCertResourceName,
+		security.WorkloadKeyCertECDSAResourceName,
+		security.WorkloadKeyCertResourceName,
+		invalid,
+	})
+	if err == nil || !strings.Contains(err.Error(), invalid) {
+		t.Fatalf("expected an error for %s, got %v", invalid, err)
+	}
+	for _, resourceName := range []string{
+		security.RootCertReqResourceName,
+		security.WorkloadKeyCertResourceName,
+		security.WorkloadKeyCertECDSAResourceName,
+	} {
+		if secret := secrets[resourceName]; secret == nil || secret.ResourceName != resourceName {
+			t.Fatalf("expected the secret of %s, got %+v", resourceName, secret)
+		}
+	}
+	if _, f := secrets[invalid]; f {
+		t.Fatalf("unexpected secret for %s", invalid)
+	}
+	// The workload certificate and its root share a CSR.
+	if got := fakeCACli.SignInvokeCount; got != 2 {
+		t.Fatalf("expected 2 CSRs to be sent, got %d", got)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/x509"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// clockSourceTimeout bounds the query of the configured time source.
+const clockSourceTimeout = 2 * time.Second
+
+// minSkewedRotationDelay is the shortest delay before rotating a certificate while the local clock
+// is skewed, so that a certificate which looks expired to the local clock is not rotated in a tight
+// loop.
+var minSkewedRotationDelay = time.Minute
+
+// checkClockSkew estimates the offset of the CA clock from the local clock when leaf was received,
+// and records it if it exceeds the configured threshold. The offset is measured with the configured
+// time source if any; otherwise the local clock is only known to be skewed if it is outside the
+// validity of the freshly issued leaf, in which case the CA is assumed to have backdated it by
+// pkiutil.ClockSkewGracePeriod. Must be called with generateMutex held.
+func (sc *SecretManagerClient) checkClockSkew(leaf *x509.Certificate, received time.Time) {
+	threshold := sc.configOptions.ClockSkewThreshold
+	if threshold <= 0 {
+		return
+	}
+	var offset time.Duration
+	source := "certificate validity"
+	if received.Before(leaf.NotBefore) || received.After(leaf.NotAfter) {
+		issued := leaf.NotBefore.Add(pkiutil.ClockSkewGracePeriod)
+		if issued.After(leaf.NotAfter) {
+			issued = leaf.NotAfter
+		}
+		offset = issued.Sub(received)
+	}
+	if sc.configOptions.ClockTimeSource != "" {
+		measured, err := nodeagentutil.ClockOffset(sc.configOptions.ClockTimeSource, clockSourceTimeout)
+		if err != nil {
+			cacheLog.Warnf("failed to query time source %s: %v", sc.configOptions.ClockTimeSource, err)
+		} else {
+			offset, source = measured, sc.configOptions.ClockTimeSource
+		}
+	}
+
+	if offset < threshold && offset > -threshold {
+		if sc.clockOffset != 0 {
+			cacheLog.Infof("local clock is no longer skewed according to %s", source)
+		}
+		sc.clockOffset = 0
+		return
+	}
+	numClockSkewEvents.Increment()
+	if offset > 0 {
+		cacheLog.Warnf("local clock is %v behind according to %s, scheduling certificate rotation conservatively", offset, source)
+	} else {
+		cacheLog.Warnf("local clock is %v ahead according to %s, scheduling certificate rotation conservatively", -offset, source)
+	}
+	sc.clockOffset = offset
+}
+
+// skewedRotateTime returns the delay before rotating secret while the local clock is offset from the
+// CA clock. The delay is computed on the CA clock, and is at least minSkewedRotationDelay.
+func (sc *SecretManagerClient) skewedRotateTime(secret security.SecretItem, offset time.Duration) time.Duration {
+	lifetime := secret.Leaf.NotAfter.Sub(secret.Leaf.NotBefore)
+	remaining := secret.Leaf.NotAfter.Sub(time.Now().Add(offset))
+	if remaining > lifetime {
+		remaining = lifetime
+	}
+	gracePeriod := time.Duration(sc.gracePeriodRatio() * float64(lifetime))
+	delay := remaining - gracePeriod
+	if delay < minSkewedRotationDelay {
+		delay = minSkewedRotationDelay
+	}
+	return delay
+}
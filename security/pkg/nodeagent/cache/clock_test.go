@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+func TestClockSkewRotateTime(t *testing.T) {
+	now := time.Now()
+	lifetime := 24 * time.Hour
+	// The leaf as issued by a CA whose clock is offset from the local clock, backdated by the CA.
+	issuedAt := func(offset time.Duration) security.SecretItem {
+		notBefore := now.Add(offset).Add(-pkiutil.ClockSkewGracePeriod)
+		leaf := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(lifetime)}
+		return security.SecretItem{CreatedTime: now, ExpireTime: leaf.NotAfter, Leaf: leaf}
+	}
+	// The rotation delay on the CA clock of a certificate issued at now.
+	want := lifetime/2 - pkiutil.ClockSkewGracePeriod
+
+	cases := []struct {
+		name       string
+		threshold  time.Duration
+		offset     time.Duration
+		wantSkewed bool
+		wantDelay  time.Duration
+	}{
+		// The validity is counted from the time the certificate is received on the local clock.
+		{name: "accurate clock", threshold: 5 * time.Minute, wantDelay: want + pkiutil.ClockSkewGracePeriod/2},
+		{name: "local clock ahead", threshold: 5 * time.Minute, offset: -48 * time.Hour, wantSkewed: true, wantDelay: want},
+		{name: "local clock behind", threshold: 5 * time.Minute, offset: 48 * time.Hour, wantSkewed: true, wantDelay: want},
+		// Without the check, a certificate that looks expired is rotated immediately.
+		{name: "check disabled", offset: -48 * time.Hour, wantDelay: 0},
+		// A skew within the validity of the leaf can't be detected without a time source.
+		{name: "undetectable skew", threshold: 5 * time.Minute, offset: -time.Hour, wantDelay: (lifetime - time.Hour - pkiutil.ClockSkewGracePeriod) / 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := &SecretManagerClient{configOptions: &security.Options{
+				ClockSkewThreshold:             tc.threshold,
+				SecretRotationGracePeriodRatio: 0.5,
+			}}
+			secret := issuedAt(tc.offset)
+			sc.checkClockSkew(secret.Leaf, now)
+			if skewed := sc.clockOffset != 0; skewed != tc.wantSkewed {
+				t.Fatalf("expected skewed %v, got offset %v", tc.wantSkewed, sc.clockOffset)
+			}
+			if got := sc.rotateTime(secret); got-tc.wantDelay > time.Second || tc.wantDelay-got > time.Second {
+				t.Errorf("expected rotation in %v, got %v", tc.wantDelay, got)
+			}
+		})
+	}
+}
+
+func TestClockSkewMinRotationDelay(t *testing.T) {
+	sc := &SecretManagerClient{configOptions: &security.Options{
+		ClockSkewThreshold:             5 * time.Minute,
+		SecretRotationGracePeriodRatio: 0.5,
+	}}
+	// A certificate whose validity is mostly elapsed on the CA clock.
+	now := time.Now()
+	leaf := &x509.Certificate{NotBefore: now.Add(-48 * time.Hour), NotAfter: now.Add(-47 * time.Hour)}
+	sc.clockOffset = 47*time.Hour - time.Minute
+	if got := sc.rotateTime(security.SecretItem{Leaf: leaf, ExpireTime: leaf.NotAfter}); got != minSkewedRotationDelay {
+		t.Errorf("expected rotation in %v, got %v", minSkewedRotationDelay, got)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	// defaultCRLRefreshInterval is used if security.Options.CRLRefreshInterval is not set.
+	defaultCRLRefreshInterval = 10 * time.Minute
+	// minCRLRefreshInterval bounds the refreshes of CRLs due to be updated, or failing to be fetched.
+	minCRLRefreshInterval = time.Minute
+)
+
+// getCRL returns the CRLs served with the root certificates.
+func (sc *SecretManagerClient) getCRL() []byte {
+	if sc.crlOwner != nil {
+		return sc.crlOwner.getCRL()
+	}
+	sc.crlMutex.RLock()
+	defer sc.crlMutex.RUnlock()
+	return sc.crl
+}
+
+// startCRLRefresh is the queue task refreshing the CRLs. They are fetched in the background, not to
+// hold up the rotations run by the queue.
+func (sc *SecretManagerClient) startCRLRefresh() error {
+	go sc.refreshCRL()
+	return nil
+}
+
+// refreshCRL fetches the CRLs of the CA, and pushes the root certificates to Envoy if they changed.
+// It schedules the next refresh before the CRLs are due to be updated.
+func (sc *SecretManagerClient) refreshCRL() {
+	interval := sc.configOptions.CRLRefreshInterval
+	if interval <= 0 {
+		interval = defaultCRLRefreshInterval
+	}
+	defer func() {
+		select {
+		case <-sc.stop:
+		default:
+			sc.queue.PushDelayed(sc.startCRLRefresh, interval)
+		}
+	}()
+
+	crl, err := sc.caClient.(security.CRLSource).CRL(sc.ctx)
+	var nextUpdate time.Time
+	if err == nil {
+		nextUpdate, err = parseCRLs(crl)
+	}
+	sc.crlMutex.Lock()
+	if err != nil {
+		interval = minCRLRefreshInterval
+		cacheLog.Errorf("failed to refresh CRLs: %v", err)
+		if sc.crl == nil || sc.crlNextUpdate.IsZero() || time.Now().Before(sc.crlNextUpdate) {
+			sc.crlMutex.Unlock()
+			return
+		}
+		// Envoy rejects every certificate checked against an expired CRL; revocation checks are
+		// suspended instead until the CRLs can be fetched again.
+		cacheLog.Warnf("CRLs expired at %v, serving the root certificates without CRLs", sc.crlNextUpdate)
+		crl, nextUpdate = nil, time.Time{}
+	} else if !nextUpdate.IsZero() {
+		if due := time.Until(nextUpdate) / 2; due < interval {
+			interval = due
+		}
+		if interval < minCRLRefreshInterval {
+			interval = minCRLRefreshInterval
+		}
+	}
+	changed := !bytes.Equal(sc.crl, crl)
+	sc.crl, sc.crlNextUpdate = crl, nextUpdate
+	sc.crlMutex.Unlock()
+
+	if changed {
+		cacheLog.Infof("CRLs changed, pushing the root certificates")
+		sc.CallUpdateCallback(security.RootCertReqResourceName)
+	}
+}
+
+// parseCRLs checks the PEM encoded CRLs, and returns the earliest time one of them is due to be
+// updated, or zero if none sets it.
+func parseCRLs(data []byte) (time.Time, error) {
+	var nextUpdate time.Time
+	found := false
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "X509 CRL" {
+			return time.Time{}, fmt.Errorf("unexpected PEM block %q in CRLs", block.Type)
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid CRL: %v", err)
+		}
+		found = true
+		if !crl.NextUpdate.IsZero() && (nextUpdate.IsZero() || crl.NextUpdate.Before(nextUpdate)) {
+			nextUpdate = crl.NextUpdate
+		}
+	}
+	if !found && len(bytes.TrimSpace(data)) > 0 {
+		return time.Time{}, fmt.Errorf("no CRL found")
+	}
+	return nextUpdate, nil
+}
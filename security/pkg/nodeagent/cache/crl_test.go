@@ -0,0 +1,174 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+// crlCAClient serves the CRLs set with setCRL.
+type crlCAClient struct {
+	security.Client
+	mu  sync.Mutex
+	crl []byte
+	err error
+}
+
+func (c *crlCAClient) CRL(context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.crl, c.err
+}
+
+func (c *crlCAClient) setCRL(crl []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crl, c.err = crl, err
+}
+
+func newTestCRL(t *testing.T, nextUpdate time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+}
+
+func TestRefreshCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	crl := newTestCRL(t, time.Now().Add(time.Hour))
+	caClient := &crlCAClient{Client: fakeCACli, crl: crl}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, caClient, u.Callback, security.Options{})
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.CRL, crl) {
+		t.Fatalf("expected the root certificates to carry the CRL")
+	}
+
+	// The CRLs are kept while they are valid, if they cannot be refreshed.
+	caClient.setCRL(nil, errors.New("unavailable"))
+	sc.refreshCRL()
+	if !bytes.Equal(sc.getCRL(), crl) {
+		t.Fatalf("expected the CRL to be kept")
+	}
+
+	// Expired CRLs are dropped, rather than failing every connection.
+	sc.crlMutex.Lock()
+	sc.crlNextUpdate = time.Now().Add(-time.Minute)
+	sc.crlMutex.Unlock()
+	u.Reset()
+	sc.refreshCRL()
+	if sc.getCRL() != nil {
+		t.Fatalf("expected the expired CRL to be dropped")
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	caClient.setCRL([]byte("-----BEGIN CERTIFICATE-----\nYQ==\n-----END CERTIFICATE-----\n"), nil)
+	sc.refreshCRL()
+	if sc.getCRL() != nil {
+		t.Fatalf("expected an invalid CRL to be rejected")
+	}
+}
+
+func TestSharedCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	crl := newTestCRL(t, time.Now().Add(time.Hour))
+	caClient := &crlCAClient{Client: fakeCACli, crl: crl}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, caClient, u.Callback, security.Options{})
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	other, err := sc.ForIdentity("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	// The client sharing the CA client does not refresh the CRLs of its own, but serves those of the owner.
+	if _, ok := other.caClient.(security.CRLSource); ok {
+		t.Fatalf("expected the shared CA client not to be a CRL source")
+	}
+	if !bytes.Equal(other.getCRL(), crl) {
+		t.Fatalf("expected the CRL of the owner to be served")
+	}
+}
+
+func TestParseCRLs(t *testing.T) {
+	early, late := time.Now().Add(time.Hour).Truncate(time.Second), time.Now().Add(2*time.Hour)
+	nextUpdate, err := parseCRLs(append(newTestCRL(t, late), newTestCRL(t, early)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nextUpdate.Equal(early) {
+		t.Fatalf("got next update %v, want %v", nextUpdate, early)
+	}
+	if _, err := parseCRLs([]byte("not a CRL")); err == nil {
+		t.Fatalf("expected an error for data without CRLs")
+	}
+	if nextUpdate, err := parseCRLs(nil); err != nil || !nextUpdate.IsZero() {
+		t.Fatalf("expected no CRLs to be valid, got %v, %v", nextUpdate, err)
+	}
+}
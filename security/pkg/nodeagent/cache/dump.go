@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sort"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// DumpSecrets returns the state of the cached secrets, ordered by resource name, with their private
+// keys redacted: the workload certificate, the root certificates, and the workload certificates of
+// the resources with a fixed key type or TTL. Certificates read from files are not cached, and are
+// not included.
+func (sc *SecretManagerClient) DumpSecrets() []security.SecretDump {
+	var dumps []security.SecretDump
+	if workload := sc.cache.GetWorkload(); workload != nil {
+		dumps = append(dumps, dumpSecret(security.WorkloadKeyCertResourceName, workload))
+	}
+	if root := sc.cache.GetRoot(); len(root) > 0 {
+		dumps = append(dumps, security.SecretDump{
+			ResourceName:     security.RootCertReqResourceName,
+			RootCertificates: dumpCertificates(root),
+		})
+	}
+	sc.resourceMutex.Lock()
+	for key, client := range sc.resourceClients {
+		if workload := client.cache.GetWorkload(); workload != nil {
+			for name := range sc.resourceNames[key] {
+				dumps = append(dumps, dumpSecret(name, workload))
+			}
+		}
+	}
+	sc.resourceMutex.Unlock()
+	sort.Slice(dumps, func(i, j int) bool {
+		return dumps[i].ResourceName < dumps[j].ResourceName
+	})
+	return dumps
+}
+
+func dumpSecret(resourceName string, item *security.SecretItem) security.SecretDump {
+	created, expire := item.CreatedTime, item.ExpireTime
+	dump := security.SecretDump{
+		ResourceName:     resourceName,
+		CreatedTime:      &created,
+		ExpireTime:       &expire,
+		CertificateChain: dumpCertificates(item.CertificateChain),
+		RootCertificates: dumpCertificates(item.RootCert),
+	}
+	if len(item.PrivateKey) > 0 {
+		dump.PrivateKey = security.RedactedPrivateKey
+	}
+	return dump
+}
+
+// dumpCertificates describes the PEM certificates, or none if they cannot be parsed.
+func dumpCertificates(pem []byte) []security.CertificateDump {
+	certs, err := pkiutil.ParsePemEncodedCertificateChain(pem)
+	if err != nil {
+		cacheLog.Debugf("failed to parse certificates to dump: %v", err)
+		return nil
+	}
+	dumps := make([]security.CertificateDump, 0, len(certs))
+	for _, cert := range certs {
+		dump := security.CertificateDump{
+			SerialNumber: cert.SerialNumber.Text(16),
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			DNSNames:     cert.DNSNames,
+		}
+		for _, uri := range cert.URIs {
+			dump.URIs = append(dump.URIs, uri.String())
+		}
+		dumps = append(dumps, dump)
+	}
+	return dumps
+}
@@ -0,0 +1,68 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestDumpSecrets(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	if got := sc.DumpSecrets(); len(got) != 0 {
+		t.Fatalf("expected no secrets before any is generated, got %v", got)
+	}
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.RootCertReqResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "15m"); err != nil {
+		t.Fatal(err)
+	}
+
+	dumps := sc.DumpSecrets()
+	var names []string
+	for _, d := range dumps {
+		names = append(names, d.ResourceName)
+	}
+	if want := "ROOTCA,default,default:15m"; strings.Join(names, ",") != want {
+		t.Fatalf("expected secrets %s, got %v", want, names)
+	}
+	root, workload := dumps[0], dumps[1]
+	if len(root.RootCertificates) == 0 || root.PrivateKey != "" || root.ExpireTime != nil {
+		t.Fatalf("unexpected root secret %+v", root)
+	}
+	if workload.PrivateKey != security.RedactedPrivateKey {
+		t.Fatalf("expected the private key to be redacted, got %q", workload.PrivateKey)
+	}
+	if !workload.ExpireTime.Equal(secret.ExpireTime) {
+		t.Fatalf("expected expiry %v, got %v", secret.ExpireTime, workload.ExpireTime)
+	}
+	leaf := workload.CertificateChain[0]
+	if leaf.SerialNumber != secret.Leaf.SerialNumber.Text(16) || leaf.Issuer == "" || len(leaf.DNSNames) == 0 {
+		t.Fatalf("unexpected leaf certificate %+v", leaf)
+	}
+}
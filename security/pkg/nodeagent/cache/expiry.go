@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"time"
+)
+
+// expiryCheckInterval is the interval of the updates of the expiry of the certificates.
+var expiryCheckInterval = 30 * time.Second
+
+// startExpiryCheck reports the expiry of the certificates, and schedules the next check.
+func (sc *SecretManagerClient) startExpiryCheck() error {
+	sc.checkExpiry(time.Now())
+	sc.queue.PushDelayed(sc.startExpiryCheck, expiryCheckInterval)
+	return nil
+}
+
+// checkExpiry records the time until the certificates expire at now, and reports each certificate
+// whose remaining validity is below security.Options.NearExpiryThreshold once.
+func (sc *SecretManagerClient) checkExpiry(now time.Time) {
+	threshold := sc.configOptions.NearExpiryThreshold
+	for _, status := range sc.CertificateStatus() {
+		if status.ExpireTime.IsZero() {
+			continue
+		}
+		remaining := status.ExpireTime.Sub(now)
+		certExpirySeconds.With(resourceNameLabel.Value(status.ResourceName)).Record(remaining.Seconds())
+		if threshold <= 0 || remaining >= threshold || sc.nearExpiryNotified[status.ResourceName] == status.SerialNumber {
+			continue
+		}
+		sc.nearExpiryNotified[status.ResourceName] = status.SerialNumber
+		numNearExpiryEvents.Increment()
+		resourceLog(status.ResourceName).Warnf("certificate %s expires in %v, rotation is falling behind",
+			status.SerialNumber, remaining.Round(time.Second))
+		if handler := sc.configOptions.NearExpiryHandler; handler != nil {
+			handler.OnNearExpiry(status, remaining)
+		}
+	}
+}
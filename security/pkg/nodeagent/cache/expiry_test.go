@@ -0,0 +1,102 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+type nearExpiryRecorder struct {
+	mu       sync.Mutex
+	statuses []security.CertificateStatus
+}
+
+func (r *nearExpiryRecorder) OnNearExpiry(status security.CertificateStatus, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, status)
+}
+
+func (r *nearExpiryRecorder) resources() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, s := range r.statuses {
+		names = append(names, s.ResourceName)
+	}
+	return names
+}
+
+func TestCheckExpiry(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	handler := &nearExpiryRecorder{}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{
+		NearExpiryThreshold: 10 * time.Minute,
+		NearExpiryHandler:   handler,
+	})
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The expiry is checked on the queue, like the periodic checks.
+	check := func(now time.Time) {
+		done := make(chan struct{})
+		sc.queue.Push(func() error {
+			sc.checkExpiry(now)
+			close(done)
+			return nil
+		})
+		<-done
+	}
+
+	check(time.Now())
+	if got := handler.resources(); len(got) != 0 {
+		t.Fatalf("expected no certificate near expiry, got %v", got)
+	}
+	rows, err := view.RetrieveData("certificate_expiry_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, row := range rows {
+		if len(row.Tags) == 1 && row.Tags[0].Value == security.WorkloadKeyCertResourceName {
+			found = true
+			if v := row.Data.(*view.LastValueData).Value; v < 50*60 || v > 60*60 {
+				t.Fatalf("expected the certificate to expire in about 1h, got %vs", v)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected the expiry of %s to be recorded, got %v", security.WorkloadKeyCertResourceName, rows)
+	}
+
+	// The certificate is reported once.
+	nearExpiry := secret.ExpireTime.Add(-5 * time.Minute)
+	check(nearExpiry)
+	check(nearExpiry)
+	if got := handler.resources(); len(got) != 1 || got[0] != security.WorkloadKeyCertResourceName {
+		t.Fatalf("expected %s to be reported near expiry once, got %v", security.WorkloadKeyCertResourceName, got)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+)
+
+// trustBundles returns the root certificates by trust domain of the workload certificate c: those
+// of the trust domains it is federated with, and root for its own trust domain.
+func (sc *SecretManagerClient) trustBundles(c *security.SecretItem, root []byte) map[string][]byte {
+	bundles := make(map[string][]byte, len(c.TrustBundles)+1)
+	for trustDomain, bundle := range c.TrustBundles {
+		bundles[trustDomain] = bundle
+	}
+	if trustDomain := workloadTrustDomain(c.Leaf, sc.configOptions.TrustDomain); trustDomain != "" {
+		bundles[trustDomain] = root
+	}
+	return bundles
+}
+
+// workloadTrustDomain returns the trust domain of the SPIFFE ID of leaf, or defaultTrustDomain if
+// it has none.
+func workloadTrustDomain(leaf *x509.Certificate, defaultTrustDomain string) string {
+	if leaf != nil {
+		for _, uri := range leaf.URIs {
+			if id, err := spiffe.ParseIdentity(uri.String()); err == nil {
+				return id.TrustDomain
+			}
+		}
+	}
+	return defaultTrustDomain
+}
+
+// generateTrustDomainRootSecret returns the root certificates of the trust domain named by
+// resourceName, which has the TrustDomainRootCertResourcePrefix.
+func (sc *SecretManagerClient) generateTrustDomainRootSecret(resourceName string) (*security.SecretItem, error) {
+	trustDomain := strings.TrimPrefix(resourceName, security.TrustDomainRootCertResourcePrefix)
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		return nil, err
+	}
+	ns := &security.SecretItem{ResourceName: resourceName}
+	bundle, f := root.TrustBundles[trustDomain]
+	if !f && root.TrustBundles == nil && trustDomain == sc.configOptions.TrustDomain {
+		// Roots read from files are those of the configured trust domain.
+		bundle, f = root.RootCert, true
+	}
+	if !f {
+		return nil, fmt.Errorf("no root certificates for trust domain %q", trustDomain)
+	}
+	ns.RootCert = bundle
+	// The CRLs only cover the CAs of the trust domain of the workload.
+	if bytes.Equal(bundle, root.RootCert) {
+		ns.CRL = root.CRL
+	}
+	return ns, nil
+}
+
+// spireTrustBundles returns the PEM encoded bundles of set by trust domain.
+func spireTrustBundles(set *x509bundle.Set) (map[string][]byte, error) {
+	bundles := make(map[string][]byte, set.Len())
+	for _, b := range set.Bundles() {
+		bundle, err := b.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle of trust domain %s: %v", b.TrustDomain(), err)
+		}
+		bundles[b.TrustDomain().String()] = bundle
+	}
+	return bundles, nil
+}
+
+func equalTrustBundles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for trustDomain, bundle := range a {
+		if other, f := b[trustDomain]; !f || !bytes.Equal(bundle, other) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+func TestTrustDomainRoots(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{TrustDomain: "cluster.local"})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := sc.GenerateSecret(security.TrustDomainRootCertResourcePrefix + "cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(own.RootCert, root.RootCert) {
+		t.Fatalf("expected the roots of the workload trust domain to be those of ROOTCA")
+	}
+
+	// The bundles of federated trust domains are served separately.
+	item := *sc.cache.GetWorkload()
+	item.TrustBundles = map[string][]byte{"example.com": []byte("federated")}
+	sc.cache.SetWorkload(&item)
+	federated, err := sc.GenerateSecret(security.TrustDomainRootCertResourcePrefix + "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(federated.RootCert) != "federated" || federated.ResourceName != security.TrustDomainRootCertResourcePrefix+"example.com" {
+		t.Fatalf("unexpected roots of the federated trust domain: %+v", federated)
+	}
+	if _, err := sc.GenerateSecret(security.TrustDomainRootCertResourcePrefix + "unknown.com"); err == nil {
+		t.Fatalf("expected an error for a trust domain without roots")
+	}
+}
+
+func TestSPIRETrustBundles(t *testing.T) {
+	certPEM, _, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		Host: "spiffe://example.com/ns/foo/sa/bar", IsSelfSigned: true, TTL: time.Hour, RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := pkiutil.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := x509bundle.NewSet(x509bundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString("example.com"),
+		[]*x509.Certificate{cert}))
+	bundles, err := spireTrustBundles(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bundles["example.com"], certPEM) || len(bundles) != 1 {
+		t.Fatalf("unexpected trust bundles %v", bundles)
+	}
+	if !equalTrustBundles(bundles, map[string][]byte{"example.com": certPEM}) ||
+		equalTrustBundles(bundles, map[string][]byte{"example.org": certPEM}) {
+		t.Fatalf("unexpected equality of trust bundles")
+	}
+}
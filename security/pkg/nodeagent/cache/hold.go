@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+// MaxRotationHold is the longest a rotation hold may last, so that a forgotten hold eventually
+// lets rotation resume.
+const MaxRotationHold = 7 * 24 * time.Hour
+
+// HoldRotation pauses the automatic rotation of resourceName, or of all the resources if empty, for
+// duration, to preserve the continuity of the keys during CA maintenance or an investigation. A
+// rotation due during the hold is deferred until the hold expires or is released, but never past
+// the expiration of the certificate. It returns when the hold expires.
+func (sc *SecretManagerClient) HoldRotation(resourceName string, duration time.Duration) (time.Time, error) {
+	if duration <= 0 || duration > MaxRotationHold {
+		return time.Time{}, fmt.Errorf("rotation hold must expire within %v, got %v", MaxRotationHold, duration)
+	}
+	until := time.Now().Add(duration)
+	sc.holdMutex.Lock()
+	sc.holds[resourceName] = until
+	sc.holdMutex.Unlock()
+	if resourceName == "" {
+		cacheLog.Warnf("rotation of all resources held until %v", until)
+	} else {
+		resourceLog(resourceName).Warnf("rotation held until %v", until)
+	}
+	return until, nil
+}
+
+// ReleaseRotation releases the hold on resourceName, or the hold on all the resources if empty, and
+// rotates the resources whose rotation it deferred and that are not otherwise held.
+func (sc *SecretManagerClient) ReleaseRotation(resourceName string) {
+	sc.holdMutex.Lock()
+	delete(sc.holds, resourceName)
+	var released []func() error
+	for name, rotate := range sc.deferredRotations {
+		if sc.rotationHeldUntilLocked(name).IsZero() {
+			delete(sc.deferredRotations, name)
+			released = append(released, rotate)
+		}
+	}
+	sc.holdMutex.Unlock()
+	if resourceName == "" {
+		cacheLog.Infof("rotation hold of all resources released")
+	} else {
+		resourceLog(resourceName).Infof("rotation hold released")
+	}
+	for _, rotate := range released {
+		sc.queue.PushDelayed(rotate, 0)
+	}
+}
+
+// rotationHeldUntil returns when the hold on the rotation of resourceName expires, or the zero time if
+// its rotation is not held.
+func (sc *SecretManagerClient) rotationHeldUntil(resourceName string) time.Time {
+	sc.holdMutex.Lock()
+	defer sc.holdMutex.Unlock()
+	return sc.rotationHeldUntilLocked(resourceName)
+}
+
+func (sc *SecretManagerClient) rotationHeldUntilLocked(resourceName string) time.Time {
+	until := sc.holds[resourceName]
+	if all := sc.holds[""]; all.After(until) {
+		until = all
+	}
+	if !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// deferRotation checks whether the rotation of resourceName, whose certificate expires at expire, is
+// held. If so, rotate is recorded to run when the hold is released, and the delay until the hold
+// expires, bounded by the expiration of the certificate, is returned.
+func (sc *SecretManagerClient) deferRotation(resourceName string, expire time.Time, rotate func() error) (time.Duration, bool) {
+	sc.holdMutex.Lock()
+	defer sc.holdMutex.Unlock()
+	until := sc.rotationHeldUntilLocked(resourceName)
+	if until.IsZero() {
+		delete(sc.deferredRotations, resourceName)
+		return 0, false
+	}
+	if expire.Before(until) {
+		until = expire
+	}
+	delay := time.Until(until)
+	if delay <= 0 {
+		resourceLog(resourceName).Warnf("rotating certificate despite hold, as it expires")
+		delete(sc.deferredRotations, resourceName)
+		return 0, false
+	}
+	sc.deferredRotations[resourceName] = rotate
+	return delay, true
+}
+
+// RenewCertificate rotates the key and certificate of resourceName now, regardless of holds, for
+// example to pick up a change of the CA without waiting for the next rotation.
+func (sc *SecretManagerClient) RenewCertificate(resourceName string) error {
+	if _, f := keyTypeResources[resourceName]; f {
+		client, err := sc.keyTypeClient(resourceName)
+		if err != nil {
+			return err
+		}
+		return client.RenewCertificate(security.WorkloadKeyCertResourceName)
+	}
+	if strings.HasPrefix(resourceName, security.WorkloadKeyCertTTLResourcePrefix) {
+		client, err := sc.ttlClient(resourceName)
+		if err != nil {
+			return err
+		}
+		return client.RenewCertificate(security.WorkloadKeyCertResourceName)
+	}
+	if resourceName != security.WorkloadKeyCertResourceName {
+		return fmt.Errorf("only the workload certificates can be renewed, got %q", resourceName)
+	}
+	resourceLog(resourceName).Infof("renewing certificate")
+	// The rotation scheduled for the replaced certificate is skipped, as it is no longer cached.
+	sc.cache.SetWorkload(nil)
+	sc.CallUpdateCallback(resourceName)
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestHoldRotationRequiresExpiry(t *testing.T) {
+	sc := createCache(t, nil, func(string) {}, security.Options{})
+	for _, d := range []time.Duration{0, -time.Minute, MaxRotationHold + time.Minute} {
+		if _, err := sc.HoldRotation("", d); err == nil {
+			t.Errorf("expected hold of %v to be rejected", d)
+		}
+	}
+}
+
+func TestHoldRotation(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	// Rotate as soon as the certificate is issued.
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{SecretRotationGracePeriodRatio: 1})
+
+	if _, err := sc.HoldRotation("", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	until, err := sc.HoldRotation(security.WorkloadKeyCertResourceName, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to get secrets: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	// The hold on all the resources outlasts the hold on the workload certificate.
+	if statuses := sc.CertificateStatus(); len(statuses) != 1 || !statuses[0].RotationHeldUntil.After(until) {
+		t.Fatalf("expected rotation to be reported held, got %+v", statuses)
+	}
+
+	// The workload certificate is still held by the hold on all the resources.
+	sc.ReleaseRotation(security.WorkloadKeyCertResourceName)
+	time.Sleep(100 * time.Millisecond)
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	sc.ReleaseRotation("")
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1, security.RootCertReqResourceName: 1})
+	if statuses := sc.CertificateStatus(); !statuses[0].RotationHeldUntil.IsZero() {
+		t.Fatalf("expected rotation to be released, got %+v", statuses)
+	}
+}
+
+func TestHoldRotationBoundedByExpiry(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(200*time.Millisecond, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{SecretRotationGracePeriodRatio: 1})
+
+	if _, err := sc.HoldRotation(security.WorkloadKeyCertResourceName, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to get secrets: %v", err)
+	}
+	// The certificate is rotated once it expires, despite the hold.
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1, security.RootCertReqResourceName: 1})
+}
+
+func TestRenewCertificate(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	if _, err := sc.HoldRotation("", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	// Renewal ignores holds.
+	if err := sc.RenewCertificate(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1, security.RootCertReqResourceName: 1})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 2 {
+		t.Fatalf("expected a new CSR to be sent, got %d", got)
+	}
+
+	if err := sc.RenewCertificate(security.RootCertReqResourceName); err == nil {
+		t.Fatal("expected the renewal of the root to be rejected")
+	}
+}
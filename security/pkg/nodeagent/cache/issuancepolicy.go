@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// applyIssuancePolicy returns the TTL, signature algorithm, in the form of Options.ECCSigAlg, and RSA
+// key size of a CSR complying with the issuance policy of the CA. The configured key algorithm is
+// kept if the CA accepts it, otherwise the one preferred by the CA is used.
+func applyIssuancePolicy(policy *security.IssuancePolicy, ttl time.Duration, eccSigAlg string,
+	rsaKeySize int) (time.Duration, string, int) {
+	if policy == nil {
+		return ttl, eccSigAlg, rsaKeySize
+	}
+	if policy.MaxTTL > 0 && ttl > policy.MaxTTL {
+		cacheLog.Infof("requesting certificate TTL %v instead of %v, the maximum of the CA", policy.MaxTTL, ttl)
+		ttl = policy.MaxTTL
+	}
+	alg := keyAlgorithm(eccSigAlg)
+	if len(policy.AllowedKeyAlgorithms) > 0 && !contains(policy.AllowedKeyAlgorithms, alg) {
+		preferred := policy.AllowedKeyAlgorithms[0]
+		cacheLog.Infof("using %s keys instead of %s, which the CA does not accept", preferred, alg)
+		switch preferred {
+		case security.ECDSAKeyAlgorithm:
+			eccSigAlg = string(pkiutil.EcdsaSigAlg)
+		case security.Ed25519KeyAlgorithm:
+			eccSigAlg = string(pkiutil.Ed25519SigAlg)
+		default:
+			eccSigAlg = ""
+		}
+	}
+	if policy.MinRSAKeySize > rsaKeySize {
+		rsaKeySize = policy.MinRSAKeySize
+	}
+	return ttl, eccSigAlg, rsaKeySize
+}
+
+// keyAlgorithm returns the key algorithm, in the form of IssuancePolicy.AllowedKeyAlgorithms, of
+// keys generated with the signature algorithm eccSigAlg.
+func keyAlgorithm(eccSigAlg string) string {
+	switch pkiutil.SupportedECSignatureAlgorithms(eccSigAlg) {
+	case "":
+		return security.RSAKeyAlgorithm
+	case pkiutil.Ed25519SigAlg:
+		return security.Ed25519KeyAlgorithm
+	case pkiutil.MLDSA44SigAlg, pkiutil.MLDSA65SigAlg, pkiutil.MLDSA87SigAlg:
+		return security.MLDSAKeyAlgorithm
+	default:
+		return security.ECDSAKeyAlgorithm
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
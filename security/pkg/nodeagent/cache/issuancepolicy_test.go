@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestApplyIssuancePolicy(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     *security.IssuancePolicy
+		eccSigAlg  string
+		wantTTL    time.Duration
+		wantECC    string
+		wantRSALen int
+	}{
+		{
+			name:       "no policy",
+			wantTTL:    24 * time.Hour,
+			wantRSALen: 2048,
+		},
+		{
+			name:       "ttl clamped",
+			policy:     &security.IssuancePolicy{MaxTTL: time.Hour},
+			wantTTL:    time.Hour,
+			wantRSALen: 2048,
+		},
+		{
+			name:       "allowed algorithm kept",
+			policy:     &security.IssuancePolicy{AllowedKeyAlgorithms: []string{security.ECDSAKeyAlgorithm, security.RSAKeyAlgorithm}},
+			wantTTL:    24 * time.Hour,
+			wantRSALen: 2048,
+		},
+		{
+			name:       "rsa replaced by ecdsa",
+			policy:     &security.IssuancePolicy{AllowedKeyAlgorithms: []string{security.ECDSAKeyAlgorithm}},
+			wantTTL:    24 * time.Hour,
+			wantECC:    "ECDSA",
+			wantRSALen: 2048,
+		},
+		{
+			name:       "ecdsa replaced by rsa with minimum size",
+			policy:     &security.IssuancePolicy{AllowedKeyAlgorithms: []string{security.RSAKeyAlgorithm}, MinRSAKeySize: 4096},
+			eccSigAlg:  "ECDSA",
+			wantTTL:    24 * time.Hour,
+			wantRSALen: 4096,
+		},
+		{
+			name:       "ed25519 kept",
+			policy:     &security.IssuancePolicy{AllowedKeyAlgorithms: []string{security.Ed25519KeyAlgorithm, security.ECDSAKeyAlgorithm}},
+			eccSigAlg:  "ED25519",
+			wantTTL:    24 * time.Hour,
+			wantECC:    "ED25519",
+			wantRSALen: 2048,
+		},
+		{
+			name:       "ed25519 replaced by ecdsa",
+			policy:     &security.IssuancePolicy{AllowedKeyAlgorithms: []string{security.ECDSAKeyAlgorithm}},
+			eccSigAlg:  "ED25519",
+			wantTTL:    24 * time.Hour,
+			wantECC:    "ECDSA",
+			wantRSALen: 2048,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, ecc, rsaLen := applyIssuancePolicy(tc.policy, 24*time.Hour, tc.eccSigAlg, 2048)
+			if ttl != tc.wantTTL || ecc != tc.wantECC || rsaLen != tc.wantRSALen {
+				t.Errorf("got (%v, %q, %d), want (%v, %q, %d)", ttl, ecc, rsaLen, tc.wantTTL, tc.wantECC, tc.wantRSALen)
+			}
+		})
+	}
+}
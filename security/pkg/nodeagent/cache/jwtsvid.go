@@ -0,0 +1,103 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/monitoring"
+)
+
+const (
+	// maxCachedJWTSVIDs bounds the JWT SVIDs cached by audience.
+	maxCachedJWTSVIDs = 100
+	jwtSVIDTimeout    = 10 * time.Second
+)
+
+// cachedJWTSVID is a JWT SVID, reused until half its lifetime has passed.
+type cachedJWTSVID struct {
+	svid        *security.JWTSVID
+	refreshTime time.Time
+}
+
+// GenerateJWTSVID returns a JWT SVID of the workload for audience, from the SPIRE agent when
+// delegating to it, or else from the CA if it issues them.
+func (sc *SecretManagerClient) GenerateJWTSVID(audience string) (*security.JWTSVID, error) {
+	if audience == "" {
+		return nil, errors.New("JWT SVID audience is empty")
+	}
+	sc.jwtSVIDMutex.Lock()
+	defer sc.jwtSVIDMutex.Unlock()
+	if c, f := sc.jwtSVIDs[audience]; f && time.Now().Before(c.refreshTime) {
+		return c.svid, nil
+	}
+
+	t0 := time.Now()
+	numOutgoingRequests.With(RequestType.Value(monitoring.JWTSVID)).Increment()
+	token, err := sc.fetchJWTSVID(audience)
+	latency := float64(time.Since(t0).Nanoseconds()) / float64(time.Millisecond)
+	outgoingLatency.With(RequestType.Value(monitoring.JWTSVID)).Record(latency)
+	if err != nil {
+		if !errors.Is(err, security.ErrJWTSVIDNotSupported) {
+			numFailedOutgoingRequests.With(RequestType.Value(monitoring.JWTSVID)).Increment()
+		}
+		return nil, fmt.Errorf("failed to get JWT SVID for audience %q: %w", audience, err)
+	}
+	// The token comes from a trusted source; the claims are only read to cache it.
+	parsed, err := jwtsvid.ParseInsecure(token, []string{audience})
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT SVID for audience %q: %v", audience, err)
+	}
+	svid := &security.JWTSVID{
+		SpiffeID:   parsed.ID.String(),
+		Token:      token,
+		Audience:   audience,
+		ExpireTime: parsed.Expiry,
+	}
+
+	now := time.Now()
+	if sc.jwtSVIDs == nil || len(sc.jwtSVIDs) >= maxCachedJWTSVIDs {
+		sc.jwtSVIDs = map[string]cachedJWTSVID{}
+	}
+	sc.jwtSVIDs[audience] = cachedJWTSVID{svid: svid, refreshTime: now.Add(parsed.Expiry.Sub(now) / 2)}
+	cacheLog.WithLabels("spiffe", svid.SpiffeID, "audience", audience, "ttl", time.Until(svid.ExpireTime)).
+		Debugf("issued JWT SVID")
+	return svid, nil
+}
+
+func (sc *SecretManagerClient) fetchJWTSVID(audience string) (string, error) {
+	ctx, cancel := context.WithTimeout(sc.ctx, jwtSVIDTimeout)
+	defer cancel()
+	if sc.configOptions.SPIREAgentUDSPath != "" {
+		svid, err := workloadapi.FetchJWTSVID(ctx, jwtsvid.Params{Audience: audience},
+			workloadapi.WithAddr("unix://"+sc.configOptions.SPIREAgentUDSPath))
+		if err != nil {
+			return "", err
+		}
+		return svid.Marshal(), nil
+	}
+	signer, ok := sc.caClient.(security.JWTSVIDSigner)
+	if !ok {
+		return "", security.ErrJWTSVIDNotSupported
+	}
+	return signer.SignJWTSVID(ctx, audience)
+}
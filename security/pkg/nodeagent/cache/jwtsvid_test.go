@@ -0,0 +1,107 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+// jwtSVIDCAClient signs JWT SVIDs for testJWTSVIDSpiffeID, and counts them.
+type jwtSVIDCAClient struct {
+	security.Client
+	signer jose.Signer
+
+	mu     sync.Mutex
+	signed int
+}
+
+const testJWTSVIDSpiffeID = "spiffe://cluster.local/ns/foo/sa/bar"
+
+func newJWTSVIDCAClient(t *testing.T) *jwtSVIDCAClient {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &jwtSVIDCAClient{Client: fakeCACli, signer: signer}
+}
+
+func (c *jwtSVIDCAClient) SignJWTSVID(_ context.Context, audience string) (string, error) {
+	c.mu.Lock()
+	c.signed++
+	c.mu.Unlock()
+	return jwt.Signed(c.signer).Claims(jwt.Claims{
+		Subject:  testJWTSVIDSpiffeID,
+		Audience: jwt.Audience{audience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).CompactSerialize()
+}
+
+func TestGenerateJWTSVID(t *testing.T) {
+	caClient := newJWTSVIDCAClient(t)
+	sc := createCache(t, caClient, func(string) {}, security.Options{})
+
+	svid, err := sc.GenerateJWTSVID("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svid.SpiffeID != testJWTSVIDSpiffeID || svid.Audience != "example.com" || time.Until(svid.ExpireTime) < 59*time.Minute {
+		t.Fatalf("unexpected JWT SVID %+v", svid)
+	}
+	again, err := sc.GenerateJWTSVID("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Token != svid.Token || caClient.signed != 1 {
+		t.Fatalf("expected the JWT SVID to be reused, signed %d", caClient.signed)
+	}
+	if _, err := sc.GenerateJWTSVID("example.org"); err != nil || caClient.signed != 2 {
+		t.Fatalf("expected a JWT SVID for another audience, got %v, signed %d", err, caClient.signed)
+	}
+	if _, err := sc.GenerateJWTSVID(""); err == nil {
+		t.Fatalf("expected an error for an empty audience")
+	}
+}
+
+func TestGenerateJWTSVIDNotSupported(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	if _, err := sc.GenerateJWTSVID("example.com"); !errors.Is(err, security.ErrJWTSVIDNotSupported) {
+		t.Fatalf("expected %v, got %v", security.ErrJWTSVIDNotSupported, err)
+	}
+}
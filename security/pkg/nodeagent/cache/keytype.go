@@ -0,0 +1,149 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// keyTypeResources are the signature algorithms, in the form of security.Options.ECCSigAlg, of the
+// workload certificates with a fixed key type, by resource name.
+var keyTypeResources = map[string]string{
+	security.WorkloadKeyCertRSAResourceName:   "",
+	security.WorkloadKeyCertECDSAResourceName: string(pkiutil.EcdsaSigAlg),
+}
+
+// generateKeyTypeSecret returns the workload certificate with the key type of resourceName, issued
+// by a SecretManagerClient for that key type so that it is cached and rotated independently of the
+// workload certificate with the configured key type.
+func (sc *SecretManagerClient) generateKeyTypeSecret(ctx context.Context, resourceName string) (*security.SecretItem, error) {
+	client, err := sc.keyTypeClient(resourceName)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.GenerateSecretWithContext(ctx, security.WorkloadKeyCertResourceName)
+	if err != nil {
+		return nil, err
+	}
+	ret := *secret
+	ret.ResourceName = resourceName
+	return &ret, nil
+}
+
+func (sc *SecretManagerClient) keyTypeClient(resourceName string) (*SecretManagerClient, error) {
+	options := *sc.configOptions
+	options.ECCSigAlg = keyTypeResources[resourceName]
+	return sc.resourceClient(resourceName, resourceName, options, 0)
+}
+
+// resourceClient returns the SecretManagerClient issuing the workload certificate of resourceName
+// with options, creating it if needed. The client is keyed by key, the canonical form of
+// resourceName, and serves all the resource names with that key. maxTTL caps the TTL of its
+// certificates, if not zero.
+func (sc *SecretManagerClient) resourceClient(key, resourceName string, options security.Options,
+	maxTTL time.Duration) (*SecretManagerClient, error) {
+	sc.resourceMutex.Lock()
+	defer sc.resourceMutex.Unlock()
+	if client, f := sc.resourceClients[key]; f {
+		sc.resourceNames[key][resourceName] = struct{}{}
+		return client, nil
+	}
+	if maxTTL != 0 && sc.ttlClientCount() >= maxTTLResources {
+		return nil, fmt.Errorf("too many workload certificate TTLs requested, at most %d are served", maxTTLResources)
+	}
+	options.OutputKeyCertToDir = ""
+	options.MachineBinding = nil
+	if options.SecretStoreDir != "" {
+		options.SecretStoreDir = filepath.Join(options.SecretStoreDir, key)
+	}
+	var caClient security.Client
+	if sc.caClient != nil {
+		caClient = sharedCAClient{sc.caClient}
+	}
+	// The certificates of the resource are reported by sc.
+	client, err := newSecretManagerClient(caClient, &options)
+	if err != nil {
+		return nil, err
+	}
+	// Certificates mounted for the workload have a key type and TTL of their own.
+	client.existingCertificateFile = model.SdsCertificateConfig{}
+	sc.generateMutex.Lock()
+	client.identityPolicy = resourcePolicy(resourceName, sc.identityPolicy)
+	client.reloadedRotation = sc.reloadedRotation
+	sc.generateMutex.Unlock()
+	client.maxSecretTTL = maxTTL
+	client.csrLimiter = sc.csrLimiter
+	client.crlOwner = sc
+	// Changes of the root are notified by this client.
+	client.SetUpdateCallback(func(name string) {
+		if name == security.WorkloadKeyCertResourceName {
+			for _, resourceName := range sc.resourceNamesOf(key) {
+				sc.CallUpdateCallback(resourceName)
+			}
+		}
+	})
+	client.OnSecretRotated(func(_ string, item *security.SecretItem) {
+		for _, resourceName := range sc.resourceNamesOf(key) {
+			ret := *item
+			ret.ResourceName = resourceName
+			sc.notifyRotated(resourceName, &ret)
+		}
+	})
+	sc.resourceClients[key] = client
+	sc.resourceNames[key] = map[string]struct{}{resourceName: {}}
+	return client, nil
+}
+
+// resourceNamesOf returns the resource names served by the resource client of key.
+func (sc *SecretManagerClient) resourceNamesOf(key string) []string {
+	sc.resourceMutex.Lock()
+	defer sc.resourceMutex.Unlock()
+	names := make([]string, 0, len(sc.resourceNames[key]))
+	for name := range sc.resourceNames[key] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ttlClientCount returns the number of resource clients issuing certificates with a shorter TTL.
+// Requires resourceMutex.
+func (sc *SecretManagerClient) ttlClientCount() int {
+	n := 0
+	for key := range sc.resourceClients {
+		if strings.HasPrefix(key, security.WorkloadKeyCertTTLResourcePrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// resourcePolicy returns the part of policy applying to the workload certificate of resourceName:
+// those with a fixed key type only follow the TTL.
+func resourcePolicy(resourceName string, policy IdentityPolicy) IdentityPolicy {
+	if _, f := keyTypeResources[resourceName]; f {
+		return IdentityPolicy{SecretTTL: policy.SecretTTL}
+	}
+	return policy
+}
@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+func TestKeyTypeSecrets(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	cases := []struct {
+		resourceName string
+		isECDSA      bool
+	}{
+		{resourceName: security.WorkloadKeyCertResourceName, isECDSA: false},
+		{resourceName: security.WorkloadKeyCertECDSAResourceName, isECDSA: true},
+		{resourceName: security.WorkloadKeyCertRSAResourceName, isECDSA: false},
+	}
+	for _, tc := range cases {
+		// The second request is served from the cache.
+		for i := 0; i < 2; i++ {
+			secret, err := sc.GenerateSecret(tc.resourceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret.ResourceName != tc.resourceName {
+				t.Fatalf("expected resource %s, got %s", tc.resourceName, secret.ResourceName)
+			}
+			key, err := pkiutil.ParsePemEncodedKey(secret.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch key.(type) {
+			case *ecdsa.PrivateKey:
+				if !tc.isECDSA {
+					t.Fatalf("%s: expected an RSA key", tc.resourceName)
+				}
+			case *rsa.PrivateKey:
+				if tc.isECDSA {
+					t.Fatalf("%s: expected an ECDSA key", tc.resourceName)
+				}
+			}
+		}
+	}
+	if got := fakeCACli.SignInvokeCount; got != 3 {
+		t.Fatalf("expected 3 CSRs to be sent, got %d", got)
+	}
+}
+
+func TestKeyTypeSecretRotation(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Millisecond*200, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertRSAResourceName); err != nil {
+		t.Fatal(err)
+	}
+	// The rotation is notified for the resource with a fixed key type.
+	u.Expect(map[string]int{security.WorkloadKeyCertRSAResourceName: 1})
+}
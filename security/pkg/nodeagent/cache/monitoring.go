@@ -18,6 +18,11 @@ import "istio.io/pkg/monitoring"
 
 var RequestType = monitoring.MustCreateLabel("request_type")
 
+// rotationResult is the outcome of an attempt to issue the certificate of a rotation.
+var rotationResult = monitoring.MustCreateLabel("result")
+
+var resourceNameLabel = monitoring.MustCreateLabel("resource_name")
+
 // Metrics for outgoing requests from citadel agent to external services such as token exchange server or a CA.
 // This is different from incoming request metrics (i.e. from Envoy to citadel agent).
 var (
@@ -44,6 +49,67 @@ var (
 	numFileSecretFailures = monitoring.NewSum(
 		"num_file_secret_failures_total",
 		"Number of times secret generation failed for files")
+
+	numClockSkewEvents = monitoring.NewSum(
+		"num_clock_skew_events_total",
+		"Number of times the local clock was found skewed from the CA clock beyond the threshold")
+
+	numFatalIssuanceErrors = monitoring.NewSum(
+		"num_fatal_issuance_errors_total",
+		"Number of times certificate issuance was halted by an error that retrying will not fix")
+
+	numOCSPStapleFailures = monitoring.NewSum(
+		"num_ocsp_staple_failures_total",
+		"Number of times an OCSP response for the workload certificate could not be fetched")
+
+	numRotationsTriggered = monitoring.NewSum(
+		"num_certificate_rotations_triggered_total",
+		"Number of times the rotation of the workload certificate was triggered")
+
+	numRotationAttempts = monitoring.NewSum(
+		"num_certificate_rotation_attempts_total",
+		"Number of attempts to issue the certificate of a rotation of the workload certificate, by result: "+
+			"success or failure",
+		monitoring.WithLabels(rotationResult))
+
+	rotationSuccesses = numRotationAttempts.With(rotationResult.Value("success"))
+	rotationFailures  = numRotationAttempts.With(rotationResult.Value("failure"))
+
+	numRotationGracePeriodMisses = monitoring.NewSum(
+		"num_certificate_rotation_grace_period_misses_total",
+		"Number of rotations of the workload certificate that completed after the rotated certificate expired")
+
+	rotationTimeToExpiry = monitoring.NewDistribution(
+		"certificate_rotation_time_to_expiry_seconds",
+		"The time in seconds until the workload certificate expires when its rotation is triggered.",
+		[]float64{0, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600},
+	)
+
+	certExpirySeconds = monitoring.NewGauge(
+		"certificate_expiry_seconds",
+		"The time in seconds until the certificate of a resource expires: the leaf for key and certificate "+
+			"resources, the first root for trust bundles. Negative once expired.",
+		monitoring.WithLabels(resourceNameLabel))
+
+	numNearExpiryEvents = monitoring.NewSum(
+		"num_certificate_near_expiry_events_total",
+		"Number of certificates whose remaining validity fell below the near expiry threshold")
+
+	csrLatency = monitoring.NewDistribution(
+		"csr_latency_seconds",
+		"The time in seconds the CA takes to sign a CSR, including retries.",
+		[]float64{.01, .05, .1, .5, 1, 3, 5, 10, 30},
+	)
+
+	ocspStapleThisUpdate = monitoring.NewGauge(
+		"ocsp_staple_this_update_timestamp_seconds",
+		"The unix timestamp, in seconds, when the OCSP response stapled to the workload certificate was produced. "+
+			"Zero if no response is stapled.")
+
+	ocspStapleNextUpdate = monitoring.NewGauge(
+		"ocsp_staple_next_update_timestamp_seconds",
+		"The unix timestamp, in seconds, when the OCSP response stapled to the workload certificate is due to be "+
+			"updated. Zero if no response is stapled, or it sets no next update.")
 )
 
 func init() {
@@ -53,5 +119,17 @@ func init() {
 		numFailedOutgoingRequests,
 		numFileWatcherFailures,
 		numFileSecretFailures,
+		numClockSkewEvents,
+		numFatalIssuanceErrors,
+		numOCSPStapleFailures,
+		numRotationsTriggered,
+		numRotationAttempts,
+		numRotationGracePeriodMisses,
+		rotationTimeToExpiry,
+		csrLatency,
+		certExpirySeconds,
+		numNearExpiryEvents,
+		ocspStapleThisUpdate,
+		ocspStapleNextUpdate,
 	)
 }
@@ -0,0 +1,184 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// defaultOCSPRefreshInterval is used for OCSP responses that set no next update.
+	defaultOCSPRefreshInterval = time.Hour
+	// minOCSPRefreshInterval bounds the refreshes of OCSP responses due to be updated, or failing to
+	// be fetched.
+	minOCSPRefreshInterval = time.Minute
+	// maxOCSPResponseSize bounds the responses read from OCSP responders.
+	maxOCSPResponseSize = 1 << 20
+)
+
+var ocspClient = &http.Client{Timeout: 10 * time.Second}
+
+// errNoOCSPServer is returned for certificates that name no OCSP responder.
+var errNoOCSPServer = errors.New("certificate has no OCSP server")
+
+// getOCSPStaple returns the OCSP response of the workload certificate created at createdTime, if
+// one was fetched.
+func (sc *SecretManagerClient) getOCSPStaple(createdTime time.Time) []byte {
+	sc.ocspMutex.RLock()
+	defer sc.ocspMutex.RUnlock()
+	if !sc.ocspCreatedTime.Equal(createdTime) {
+		return nil
+	}
+	return sc.ocspStaple
+}
+
+// refreshOCSPStaple returns a task fetching the OCSP response of the workload certificate item, and
+// pushing the certificate to Envoy if it changed. The response is fetched in the background, not to
+// hold up the rotations run by the queue, and refreshed before it is due to be updated, until the
+// certificate is rotated.
+func (sc *SecretManagerClient) refreshOCSPStaple(item security.SecretItem) func() error {
+	var refresh func() error
+	refresh = func() error {
+		if cached := sc.cache.GetWorkload(); cached == nil || !cached.CreatedTime.Equal(item.CreatedTime) {
+			return nil
+		}
+		go func() {
+			interval, ok := sc.updateOCSPStaple(item)
+			if !ok {
+				return
+			}
+			select {
+			case <-sc.stop:
+			default:
+				sc.queue.PushDelayed(refresh, interval)
+			}
+		}()
+		return nil
+	}
+	return refresh
+}
+
+// updateOCSPStaple fetches the OCSP response of the workload certificate item, and returns when it
+// should be refreshed, or false if the certificate names no OCSP server.
+func (sc *SecretManagerClient) updateOCSPStaple(item security.SecretItem) (time.Duration, bool) {
+	staple, resp, err := fetchOCSPResponse(sc.ctx, item.CertificateChain, item.RootCert)
+	if errors.Is(err, errNoOCSPServer) {
+		cacheLog.Warnf("OCSP stapling is enabled, but the workload certificate names no OCSP server")
+		return 0, false
+	}
+	interval := defaultOCSPRefreshInterval
+	sc.ocspMutex.Lock()
+	if err != nil {
+		numOCSPStapleFailures.Increment()
+		cacheLog.Errorf("failed to fetch the OCSP response of the workload certificate: %v", err)
+		if !sc.ocspCreatedTime.Equal(item.CreatedTime) || sc.ocspNextUpdate.IsZero() ||
+			time.Now().Before(sc.ocspNextUpdate) {
+			sc.ocspMutex.Unlock()
+			return minOCSPRefreshInterval, true
+		}
+		// Envoy does not staple an expired response, and fails to load it on restart.
+		cacheLog.Warnf("OCSP response expired at %v, serving the workload certificate without it", sc.ocspNextUpdate)
+		staple, resp, interval = nil, &ocsp.Response{}, minOCSPRefreshInterval
+	} else if !resp.NextUpdate.IsZero() {
+		interval = time.Until(resp.NextUpdate) / 2
+		if interval < minOCSPRefreshInterval {
+			interval = minOCSPRefreshInterval
+		}
+	}
+	changed := !sc.ocspCreatedTime.Equal(item.CreatedTime) || !bytes.Equal(sc.ocspStaple, staple)
+	sc.ocspStaple, sc.ocspCreatedTime, sc.ocspNextUpdate = staple, item.CreatedTime, resp.NextUpdate
+	sc.ocspMutex.Unlock()
+
+	ocspStapleThisUpdate.Record(unixSeconds(resp.ThisUpdate))
+	ocspStapleNextUpdate.Record(unixSeconds(resp.NextUpdate))
+	if changed {
+		resourceLog(security.WorkloadKeyCertResourceName).Infof("OCSP response changed, pushing the certificate")
+		sc.CallUpdateCallback(security.WorkloadKeyCertResourceName)
+	}
+	return interval, true
+}
+
+// fetchOCSPResponse returns the DER encoded OCSP response of the leaf of the PEM encoded certChain,
+// from the first OCSP server it names. The issuer is the next certificate of the chain, or the root
+// for a chain of a single certificate. Only responses of certificates in good standing are returned.
+func fetchOCSPResponse(ctx context.Context, certChain, rootCert []byte) ([]byte, *ocsp.Response, error) {
+	chain, err := pkiutil.ParsePemEncodedCertificateChain(certChain)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf := chain[0]
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, errNoOCSPServer
+	}
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	} else if issuer, err = pkiutil.ParsePemEncodedCertificate(rootCert); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the issuer: %v", err)
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpResp, err := ocspClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+	der, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP server %s returned status %d", leaf.OCSPServer[0], httpResp.StatusCode)
+	}
+	resp, err := ocsp.ParseResponseForCert(der, leaf, issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid OCSP response from %s: %v", leaf.OCSPServer[0], err)
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return der, resp, nil
+	case ocsp.Revoked:
+		return nil, nil, fmt.Errorf("certificate %x was revoked at %v", leaf.SerialNumber, resp.RevokedAt)
+	default:
+		return nil, nil, fmt.Errorf("certificate %x is unknown to OCSP server %s", leaf.SerialNumber, leaf.OCSPServer[0])
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix())
+}
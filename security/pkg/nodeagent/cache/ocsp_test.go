@@ -0,0 +1,166 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"istio.io/istio/pkg/security"
+)
+
+// fakeOCSPResponder answers OCSP requests with the status set in status.
+type fakeOCSPResponder struct {
+	issuer *x509.Certificate
+	key    *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	status int
+}
+
+func (r *fakeOCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	status := r.status
+	r.mu.Unlock()
+	resp, err := ocsp.CreateResponse(r.issuer, r.issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, r.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(resp)
+}
+
+// newOCSPTestSecret returns a workload certificate naming an OCSP server answering with responder.
+func newOCSPTestSecret(t *testing.T) (security.SecretItem, *fakeOCSPResponder) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder := &fakeOCSPResponder{issuer: ca, key: key, status: ocsp.Good}
+	server := httptest.NewServer(responder)
+	t.Cleanup(server.Close)
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{server.URL},
+	}, ca, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return security.SecretItem{
+		ResourceName:     security.WorkloadKeyCertResourceName,
+		CertificateChain: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		RootCert:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		CreatedTime:      time.Now(),
+		ExpireTime:       time.Now().Add(time.Hour),
+	}, responder
+}
+
+func TestUpdateOCSPStaple(t *testing.T) {
+	item, responder := newOCSPTestSecret(t)
+	u := NewUpdateTracker(t)
+	sc := createCache(t, nil, u.Callback, security.Options{OCSPStapling: true})
+	sc.cache.SetWorkload(&item)
+
+	interval, ok := sc.updateOCSPStaple(item)
+	if !ok || interval < 25*time.Minute || interval > 30*time.Minute {
+		t.Fatalf("expected a refresh halfway to the next update, got %v, %v", interval, ok)
+	}
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+	staple := sc.getCachedSecret(security.WorkloadKeyCertResourceName).OCSPStaple
+	if len(staple) == 0 {
+		t.Fatalf("expected the workload certificate to carry the OCSP response")
+	}
+	if sc.getOCSPStaple(item.CreatedTime.Add(time.Second)) != nil {
+		t.Fatalf("expected no OCSP response for another certificate")
+	}
+
+	// A response that cannot be refreshed is kept while it is valid.
+	responder.mu.Lock()
+	responder.status = ocsp.Revoked
+	responder.mu.Unlock()
+	if interval, _ := sc.updateOCSPStaple(item); interval != minOCSPRefreshInterval {
+		t.Fatalf("expected a retry in %v, got %v", minOCSPRefreshInterval, interval)
+	}
+	if !bytes.Equal(sc.getOCSPStaple(item.CreatedTime), staple) {
+		t.Fatalf("expected the OCSP response to be kept")
+	}
+
+	// Expired responses are dropped.
+	sc.ocspMutex.Lock()
+	sc.ocspNextUpdate = time.Now().Add(-time.Minute)
+	sc.ocspMutex.Unlock()
+	u.Reset()
+	sc.updateOCSPStaple(item)
+	if sc.getOCSPStaple(item.CreatedTime) != nil {
+		t.Fatalf("expected the expired OCSP response to be dropped")
+	}
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+}
+
+func TestFetchOCSPResponseWithoutServer(t *testing.T) {
+	item, _ := newOCSPTestSecret(t)
+	if _, _, err := fetchOCSPResponse(context.Background(), item.RootCert, nil); !errors.Is(err, errNoOCSPServer) {
+		t.Fatalf("expected %v for a certificate without OCSP server, got %v", errNoOCSPServer, err)
+	}
+}
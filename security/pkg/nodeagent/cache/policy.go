@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// SecretTTLMetadata and ECCSigAlgMetadata are the proxy metadata keys of the identity policy pushed
+	// by istiod, named after the environment variables they override.
+	SecretTTLMetadata = "SECRET_TTL"
+	ECCSigAlgMetadata = "ECC_SIGNATURE_ALGORITHM"
+)
+
+// IdentityPolicy overrides the TTL and key type of the workload certificates configured in
+// security.Options, so that istiod can roll them out without restarting the agents.
+type IdentityPolicy struct {
+	// SecretTTL overrides Options.SecretTTL, if not zero.
+	SecretTTL time.Duration
+	// ECCSigAlg overrides Options.ECCSigAlg, if not nil. An empty value requests RSA keys.
+	ECCSigAlg *string
+}
+
+// ParseIdentityPolicy parses the identity policy from the proxy metadata pushed by istiod. Keys that
+// are absent leave the configured values in place.
+func ParseIdentityPolicy(metadata map[string]string) (IdentityPolicy, error) {
+	var policy IdentityPolicy
+	if ttl, f := metadata[SecretTTLMetadata]; f {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return policy, fmt.Errorf("invalid %s %q", SecretTTLMetadata, ttl)
+		}
+		policy.SecretTTL = d
+	}
+	if alg, f := metadata[ECCSigAlgMetadata]; f {
+		if alg != "" && !pkiutil.IsSupportedECSignatureAlgorithm(alg) {
+			return policy, fmt.Errorf("invalid %s %q", ECCSigAlgMetadata, alg)
+		}
+		policy.ECCSigAlg = &alg
+	}
+	return policy, nil
+}
+
+// UpdateIdentityPolicy applies policy to the workload certificates. If it changes the TTL or the key
+// type, the workload certificate is rotated to apply it.
+func (sc *SecretManagerClient) UpdateIdentityPolicy(policy IdentityPolicy) {
+	sc.generateMutex.Lock()
+	before := sc.secretTTL()
+	beforeAlg := sc.eccSigAlg()
+	sc.identityPolicy = policy
+	changed := before != sc.secretTTL() || beforeAlg != sc.eccSigAlg()
+	ttl, alg := sc.secretTTL(), sc.eccSigAlg()
+	sc.generateMutex.Unlock()
+	sc.resourceMutex.Lock()
+	clients := make(map[string]*SecretManagerClient, len(sc.resourceClients))
+	for name, c := range sc.resourceClients {
+		clients[name] = c
+	}
+	sc.resourceMutex.Unlock()
+	for name, c := range clients {
+		c.UpdateIdentityPolicy(resourcePolicy(name, policy))
+	}
+	if !changed {
+		return
+	}
+	cacheLog.Infof("identity policy changed to TTL %v and signature algorithm %q, rotating workload certificate", ttl, alg)
+	sc.cache.SetWorkload(nil)
+	sc.CallUpdateCallback(security.WorkloadKeyCertResourceName)
+}
+
+// secretTTL returns the TTL of the workload certificates. Must be called with generateMutex held.
+func (sc *SecretManagerClient) secretTTL() time.Duration {
+	ttl := sc.configOptions.SecretTTL
+	if sc.reloadedRotation != nil {
+		ttl = sc.reloadedRotation.secretTTL
+	}
+	if sc.identityPolicy.SecretTTL != 0 {
+		ttl = sc.identityPolicy.SecretTTL
+	}
+	if sc.maxSecretTTL != 0 && sc.maxSecretTTL < ttl {
+		return sc.maxSecretTTL
+	}
+	return ttl
+}
+
+// eccSigAlg returns the signature algorithm of the workload keys. Must be called with generateMutex
+// held.
+func (sc *SecretManagerClient) eccSigAlg() string {
+	if sc.identityPolicy.ECCSigAlg != nil {
+		return *sc.identityPolicy.ECCSigAlg
+	}
+	return sc.configOptions.ECCSigAlg
+}
@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+func TestParseIdentityPolicy(t *testing.T) {
+	policy, err := ParseIdentityPolicy(map[string]string{SecretTTLMetadata: "12h", ECCSigAlgMetadata: "ECDSA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.SecretTTL != 12*time.Hour || policy.ECCSigAlg == nil || *policy.ECCSigAlg != "ECDSA" {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+	policy, err = ParseIdentityPolicy(map[string]string{"OTHER": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.SecretTTL != 0 || policy.ECCSigAlg != nil {
+		t.Fatalf("expected an empty policy, got %+v", policy)
+	}
+	for _, metadata := range []map[string]string{
+		{SecretTTLMetadata: "forever"},
+		{SecretTTLMetadata: "-1h"},
+		{ECCSigAlgMetadata: "ED448"},
+	} {
+		if _, err := ParseIdentityPolicy(metadata); err == nil {
+			t.Errorf("expected policy %v to be rejected", metadata)
+		}
+	}
+}
+
+func TestUpdateIdentityPolicy(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	// A policy that does not change the TTL or key type does not rotate the certificate.
+	sc.UpdateIdentityPolicy(IdentityPolicy{})
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+
+	alg := "ECDSA"
+	sc.UpdateIdentityPolicy(IdentityPolicy{ECCSigAlg: &alg})
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1, security.RootCertReqResourceName: 1})
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 2 {
+		t.Fatalf("expected a new CSR to be sent, got %d", got)
+	}
+	key, err := pkiutil.ParsePemEncodedKey(secret.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("expected an ECDSA key, got %T", key)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+// rotationOptions are the options of the rotation of the workload certificates that can be reloaded.
+type rotationOptions struct {
+	secretTTL        time.Duration
+	gracePeriodRatio float64
+}
+
+// UpdateRotationOptions applies the SecretTTL and SecretRotationGracePeriodRatio of reloaded options
+// to the workload certificates. If they change the TTL or the rotation time, the workload certificate
+// is rotated to apply them.
+func (sc *SecretManagerClient) UpdateRotationOptions(options *security.Options) {
+	sc.generateMutex.Lock()
+	before, beforeRatio := sc.secretTTL(), sc.gracePeriodRatio()
+	sc.reloadedRotation = &rotationOptions{
+		secretTTL:        options.SecretTTL,
+		gracePeriodRatio: options.SecretRotationGracePeriodRatio,
+	}
+	changed := before != sc.secretTTL() || beforeRatio != sc.gracePeriodRatio()
+	ttl, ratio := sc.secretTTL(), sc.gracePeriodRatio()
+	sc.generateMutex.Unlock()
+	sc.resourceMutex.Lock()
+	clients := make([]*SecretManagerClient, 0, len(sc.resourceClients))
+	for _, c := range sc.resourceClients {
+		clients = append(clients, c)
+	}
+	sc.resourceMutex.Unlock()
+	for _, c := range clients {
+		c.UpdateRotationOptions(options)
+	}
+	if !changed {
+		return
+	}
+	cacheLog.Infof("rotation options changed to TTL %v and grace period ratio %v, rotating workload certificate", ttl, ratio)
+	sc.cache.SetWorkload(nil)
+	sc.CallUpdateCallback(security.WorkloadKeyCertResourceName)
+}
+
+// gracePeriodRatio returns the ratio of the lifetime of the workload certificates before their
+// expiry at which they are rotated. Must be called with generateMutex held.
+func (sc *SecretManagerClient) gracePeriodRatio() float64 {
+	if sc.reloadedRotation != nil {
+		return sc.reloadedRotation.gracePeriodRatio
+	}
+	return sc.configOptions.SecretRotationGracePeriodRatio
+}
@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestUpdateRotationOptions(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	caClient := &ttlCAClient{Client: fakeCACli}
+	u := NewUpdateTracker(t)
+	options := security.Options{SecretTTL: time.Hour, SecretRotationGracePeriodRatio: 0.5}
+	sc := createCache(t, caClient, u.Callback, options)
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	u.Reset()
+
+	// Unchanged options do not rotate the workload certificate.
+	sc.UpdateRotationOptions(&options)
+	u.Expect(map[string]int{})
+
+	reloaded := options
+	reloaded.SecretTTL = 10 * time.Minute
+	sc.UpdateRotationOptions(&reloaded)
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := caClient.lastTTL(); got != 10*time.Minute {
+		t.Fatalf("expected the reloaded TTL, got %v", got)
+	}
+
+	reloaded.SecretRotationGracePeriodRatio = 0.9
+	sc.UpdateRotationOptions(&reloaded)
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 2})
+	sc.generateMutex.Lock()
+	ratio := sc.gracePeriodRatio()
+	sc.generateMutex.Unlock()
+	if ratio != 0.9 {
+		t.Fatalf("expected the reloaded grace period ratio, got %v", ratio)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/trace"
+
+	"istio.io/istio/pkg/security"
+)
+
+// rotation is a pending rotation of the workload certificate.
+type rotation struct {
+	// expireTime is the expiry of the certificate being rotated.
+	expireTime time.Time
+	// span traces the rotation, from its trigger until the replacement is issued.
+	span *trace.Span
+}
+
+// rotationTriggered records the start of the rotation of the workload certificate item.
+func (sc *SecretManagerClient) rotationTriggered(item security.SecretItem) {
+	numRotationsTriggered.Increment()
+	rotationTimeToExpiry.Record(time.Until(item.ExpireTime).Seconds())
+	_, span := trace.StartSpan(context.Background(), "istio.agent.rotation")
+	span.AddAttributes(trace.StringAttribute("expire_time", item.ExpireTime.Format(time.RFC3339)))
+	sc.rotationMutex.Lock()
+	defer sc.rotationMutex.Unlock()
+	if sc.pendingRotation != nil {
+		sc.pendingRotation.span.End()
+	}
+	sc.pendingRotation = &rotation{expireTime: item.ExpireTime, span: span}
+}
+
+// rotationContext returns ctx carrying the span of the pending rotation if any, so that the
+// issuance of the replacement certificate is traced as part of the rotation.
+func (sc *SecretManagerClient) rotationContext(ctx context.Context) context.Context {
+	sc.rotationMutex.Lock()
+	defer sc.rotationMutex.Unlock()
+	if sc.pendingRotation == nil {
+		return ctx
+	}
+	return trace.NewContext(ctx, sc.pendingRotation.span)
+}
+
+// rotationIssued records the result of an attempt to issue a workload certificate, which completes
+// the pending rotation if any on success.
+func (sc *SecretManagerClient) rotationIssued(err error) {
+	sc.rotationMutex.Lock()
+	defer sc.rotationMutex.Unlock()
+	if sc.pendingRotation == nil {
+		return
+	}
+	if err != nil {
+		rotationFailures.Increment()
+		sc.pendingRotation.span.Annotate(nil, "attempt failed: "+err.Error())
+		return
+	}
+	rotationSuccesses.Increment()
+	if time.Now().After(sc.pendingRotation.expireTime) {
+		cacheLog.Warnf("workload certificate rotated after it expired at %v", sc.pendingRotation.expireTime)
+		numRotationGracePeriodMisses.Increment()
+		sc.pendingRotation.span.Annotate(nil, "grace period missed")
+	}
+	sc.pendingRotation.span.End()
+	sc.pendingRotation = nil
+}
+
+// OnSecretRotated registers f to be called with each workload certificate issued by the CA or the
+// SPIRE agent, starting with the first one, so that other components of the agent can react to
+// rotations without polling. The workload certificates with a fixed key type or TTL are reported
+// with their own resource name. f may be called concurrently, must not block and must not modify item.
+func (sc *SecretManagerClient) OnSecretRotated(f func(resourceName string, item *security.SecretItem)) {
+	sc.rotatedMutex.Lock()
+	defer sc.rotatedMutex.Unlock()
+	sc.rotatedHandlers = append(sc.rotatedHandlers, f)
+}
+
+// notifyRotated calls the handlers registered with OnSecretRotated with item, the workload
+// certificate of resourceName just issued.
+func (sc *SecretManagerClient) notifyRotated(resourceName string, item *security.SecretItem) {
+	sc.rotatedMutex.RLock()
+	handlers := sc.rotatedHandlers
+	sc.rotatedMutex.RUnlock()
+	for _, f := range handlers {
+		f(resourceName, item)
+	}
+}
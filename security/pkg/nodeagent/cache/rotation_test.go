@@ -0,0 +1,182 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+// metricValue returns the value of the sum or count of the distribution name, for the rows with tag
+// value if set.
+func metricValue(t *testing.T, name, value string) float64 {
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("failed to get metric %s: %v", name, err)
+	}
+	total := 0.0
+	for _, row := range rows {
+		if value != "" && (len(row.Tags) == 0 || row.Tags[0].Value != value) {
+			continue
+		}
+		switch data := row.Data.(type) {
+		case *view.SumData:
+			total += data.Value
+		case *view.DistributionData:
+			total += float64(data.Count)
+		}
+	}
+	return total
+}
+
+func TestRotationMetrics(t *testing.T) {
+	sc := &SecretManagerClient{}
+	metrics := func() []float64 {
+		return []float64{
+			metricValue(t, "num_certificate_rotations_triggered_total", ""),
+			metricValue(t, "num_certificate_rotation_attempts_total", "success"),
+			metricValue(t, "num_certificate_rotation_attempts_total", "failure"),
+			metricValue(t, "num_certificate_rotation_grace_period_misses_total", ""),
+			metricValue(t, "certificate_rotation_time_to_expiry_seconds", ""),
+		}
+	}
+	expectDelta := func(before []float64, delta ...float64) {
+		t.Helper()
+		after := metrics()
+		for i := range delta {
+			if after[i]-before[i] != delta[i] {
+				t.Fatalf("expected metric deltas %v, got before %v after %v", delta, before, after)
+			}
+		}
+	}
+
+	// Issuing a certificate outside of a rotation is not recorded.
+	before := metrics()
+	sc.rotationIssued(nil)
+	expectDelta(before, 0, 0, 0, 0, 0)
+
+	before = metrics()
+	sc.rotationTriggered(security.SecretItem{ExpireTime: time.Now().Add(time.Hour)})
+	sc.rotationIssued(errors.New("CA unavailable"))
+	sc.rotationIssued(nil)
+	sc.rotationIssued(nil)
+	expectDelta(before, 1, 1, 1, 0, 1)
+
+	// The rotated certificate expired before its replacement was issued.
+	before = metrics()
+	sc.rotationTriggered(security.SecretItem{ExpireTime: time.Now().Add(-time.Minute)})
+	sc.rotationIssued(nil)
+	expectDelta(before, 1, 1, 0, 1, 1)
+}
+
+// spanRecorder records the spans exported.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans map[string]*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans[s.Name] = s
+}
+
+func TestRotationTracing(t *testing.T) {
+	recorder := &spanRecorder{spans: map[string]*trace.SpanData{}}
+	trace.RegisterExporter(recorder)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	t.Cleanup(func() {
+		trace.UnregisterExporter(recorder)
+		trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+	})
+
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	sc.rotationTriggered(security.SecretItem{ExpireTime: time.Now().Add(time.Hour)})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	sc.rotationIssued(nil)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	parents := map[string]string{
+		"istio.agent.csr":      "istio.agent.rotation",
+		"istio.agent.keygen":   "istio.agent.csr",
+		"istio.agent.csr_sign": "istio.agent.csr",
+	}
+	for name, parent := range parents {
+		span, p := recorder.spans[name], recorder.spans[parent]
+		if span == nil || p == nil {
+			t.Fatalf("expected spans %s and %s, got %v", name, parent, recorder.spans)
+		}
+		if span.ParentSpanID != p.SpanID || span.TraceID != p.TraceID {
+			t.Errorf("expected span %s to be a child of %s", name, parent)
+		}
+	}
+}
+
+func TestOnSecretRotated(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	var (
+		mu      sync.Mutex
+		rotated []string
+	)
+	sc.OnSecretRotated(func(resourceName string, item *security.SecretItem) {
+		if item.ResourceName != resourceName || len(item.CertificateChain) == 0 || len(item.PrivateKey) == 0 {
+			t.Errorf("unexpected secret for %s: %+v", resourceName, item)
+		}
+		// Handlers may generate secrets.
+		if _, err := sc.GenerateSecret(security.RootCertReqResourceName); err != nil {
+			t.Errorf("failed to generate the root from the handler: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		rotated = append(rotated, resourceName)
+	})
+
+	for _, resourceName := range []string{
+		security.WorkloadKeyCertResourceName,
+		security.WorkloadKeyCertResourceName,
+		security.RootCertReqResourceName,
+		security.WorkloadKeyCertECDSAResourceName,
+	} {
+		if _, err := sc.GenerateSecret(resourceName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Secrets served from the cache are not rotations.
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{security.WorkloadKeyCertResourceName, security.WorkloadKeyCertECDSAResourceName}
+	if len(rotated) != len(want) || rotated[0] != want[0] || rotated[1] != want[1] {
+		t.Fatalf("expected rotations %v, got %v", want, rotated)
+	}
+}
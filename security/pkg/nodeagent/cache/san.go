@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+)
+
+// checkSANs verifies the SANs of leaf, signed for the requested identity, against the configured
+// security.Options.SANPolicy.
+func (sc *SecretManagerClient) checkSANs(leaf *x509.Certificate, requested string) error {
+	sans := certSANs(leaf)
+	found := false
+	for _, san := range sans {
+		if san == requested {
+			found = true
+			break
+		}
+	}
+
+	switch sc.configOptions.SANPolicy {
+	case security.SANPolicyExact:
+		if !found || len(sans) != 1 {
+			return fmt.Errorf("certificate SANs %v do not exactly match the requested identity %s", sans, requested)
+		}
+	case security.SANPolicySubset:
+		if !found {
+			return fmt.Errorf("certificate SANs %v do not include the requested identity %s", sans, requested)
+		}
+	case security.SANPolicyTrustDomain:
+		if len(leaf.URIs) == 0 {
+			return fmt.Errorf("certificate has no URI SAN, requested identity %s", requested)
+		}
+		for _, uri := range leaf.URIs {
+			td, err := spiffe.GetTrustDomainFromURISAN(uri.String())
+			if err != nil {
+				return err
+			}
+			if td != sc.configOptions.TrustDomain {
+				return fmt.Errorf("certificate SAN %s is not in trust domain %s", uri, sc.configOptions.TrustDomain)
+			}
+		}
+	default:
+		if !found {
+			cacheLog.Warnf("certificate SANs %v do not include the requested identity %s", sans, requested)
+		}
+	}
+	return nil
+}
+
+// certSANs returns all the SANs of cert.
+func certSANs(cert *x509.Certificate) []string {
+	var sans []string
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return append(sans, cert.EmailAddresses...)
+}
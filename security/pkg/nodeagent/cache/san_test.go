@@ -0,0 +1,91 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/x509"
+	"net/url"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestCheckSANs(t *testing.T) {
+	const requested = "spiffe://cluster.local/ns/foo/sa/bar"
+	leaf := func(uris ...string) *x509.Certificate {
+		cert := &x509.Certificate{}
+		for _, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert.URIs = append(cert.URIs, u)
+		}
+		return cert
+	}
+	exact := leaf(requested)
+	augmented := leaf(requested, "spiffe://cluster.local/ns/foo/sa/other")
+	replaced := leaf("spiffe://cluster.local/ns/foo/sa/other")
+	foreign := leaf("spiffe://other.domain/ns/foo/sa/bar")
+	withDNS := leaf(requested)
+	withDNS.DNSNames = []string{"bar.foo.svc"}
+
+	cases := []struct {
+		policy string
+		leaf   *x509.Certificate
+		valid  bool
+	}{
+		{security.SANPolicyExact, exact, true},
+		{security.SANPolicyExact, augmented, false},
+		{security.SANPolicyExact, withDNS, false},
+		{security.SANPolicyExact, replaced, false},
+		{security.SANPolicySubset, exact, true},
+		{security.SANPolicySubset, augmented, true},
+		{security.SANPolicySubset, withDNS, true},
+		{security.SANPolicySubset, replaced, false},
+		{security.SANPolicyTrustDomain, replaced, true},
+		{security.SANPolicyTrustDomain, augmented, true},
+		{security.SANPolicyTrustDomain, foreign, false},
+		{security.SANPolicyTrustDomain, leaf(), false},
+		{security.SANPolicyPermissive, foreign, true},
+		{"", leaf(), true},
+	}
+	for _, tc := range cases {
+		sc := &SecretManagerClient{configOptions: &security.Options{SANPolicy: tc.policy, TrustDomain: "cluster.local"}}
+		err := sc.checkSANs(tc.leaf, requested)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("policy %q, SANs %v: expected valid %v, got %v", tc.policy, certSANs(tc.leaf), tc.valid, err)
+		}
+	}
+}
+
+func TestSANPolicyRejectsCertificate(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	// The mock CA replaces the requested identity.
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{
+		TrustDomain:       "cluster.local",
+		WorkloadNamespace: "foo",
+		ServiceAccount:    "bar",
+		SANPolicy:         security.SANPolicySubset,
+	})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); !security.IsFatalError(err) {
+		t.Fatalf("expected certificate to be rejected, got %v", err)
+	}
+}
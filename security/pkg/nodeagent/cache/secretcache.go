@@ -17,15 +17,20 @@ package cache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/fsnotify/fsnotify"
+	"go.opencensus.io/trace"
+	"golang.org/x/time/rate"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/file"
@@ -33,6 +38,7 @@ import (
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/security/pkg/monitoring"
+	"istio.io/istio/security/pkg/nodeagent/filewatch"
 	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	pkiutil "istio.io/istio/security/pkg/pki/util"
 	istiolog "istio.io/pkg/log"
@@ -45,12 +51,26 @@ var (
 )
 
 const (
-	// The size of a private key for a leaf certificate.
+	// The default size of a private key for a leaf certificate.
 	keySize = 2048
 
 	// firstRetryBackOffInMilliSec is the initial backoff time interval when hitting
 	// non-retryable error in CSR request or while there is an error in reading file mounts.
 	firstRetryBackOffInMilliSec = 50
+
+	// caPressureBaseBackoff and caPressureMaxBackoff bound the delay between CSRs when the CA
+	// reports it is overloaded or unavailable.
+	caPressureBaseBackoff = time.Second
+	caPressureMaxBackoff  = 5 * time.Minute
+
+	// fatalErrorHold is how long certificate issuance is halted after a fatal error, so that a
+	// misconfiguration is not retried in a loop, while a fix on the CA side is eventually picked up
+	// without restarting the agent.
+	fatalErrorHold = 30 * time.Minute
+
+	// evictedKeyRetention is how long the private key of a rotated certificate is kept in memory
+	// before being zeroed, so that consumers still sending the previous certificate are not affected.
+	evictedKeyRetention = time.Minute
 )
 
 // SecretManagerClient a SecretManager that signs CSRs using a provided security.Client. The primary
@@ -88,19 +108,65 @@ type SecretManagerClient struct {
 	// callback function to invoke when detecting secret change.
 	notifyCallback func(resourceName string)
 
-	// Cache of workload certificate and root certificate. File based certs are never cached, as
-	// lookup is cheap.
-	cache secretCache
+	// Cache of workload certificate and root certificate, selected by security.Options.SecretStore.
+	// File based certs are never cached, as lookup is cheap.
+	cache security.SecretStore
 
 	// generateMutex ensures we do not send concurrent requests to generate a certificate
 	generateMutex sync.Mutex
 
+	// resourceClients issue the workload certificates with a fixed key type or a shorter TTL, by
+	// resource name, the TTL of which is canonical. resourceNames are the resource names served by
+	// each of them, as requested. Protected by resourceMutex.
+	resourceMutex   sync.Mutex
+	resourceClients map[string]*SecretManagerClient
+	resourceNames   map[string]map[string]struct{}
+
+	// spireReady is closed when the first X.509 SVID is received from the SPIRE agent, if the workload
+	// certificates are delegated to it.
+	spireReady     chan struct{}
+	spireReadyOnce sync.Once
+
+	// caBackoff spreads out CSRs after retryable failures, so that a fleet of agents does not
+	// retry in lock-step after a CA outage.
+	caBackoff *security.DecorrelatedJitterBackoff
+	// pendingRotation is the rotation of the workload certificate, until its replacement is issued.
+	// Protected by rotationMutex.
+	rotationMutex   sync.Mutex
+	pendingRotation *rotation
+	// rotatedHandlers are called with the workload certificates issued, see OnSecretRotated.
+	// Protected by rotatedMutex.
+	rotatedMutex    sync.RWMutex
+	rotatedHandlers []func(resourceName string, item *security.SecretItem)
+	// nearExpiryNotified is the serial number of the certificate last reported near expiry, by
+	// resource name. Only accessed by the expiry check on the queue.
+	nearExpiryNotified map[string]string
+	// csrLimiter limits the rate of the CSRs sent to the CA, shared with the resource and identity
+	// clients. Nil if unlimited.
+	csrLimiter *rate.Limiter
+	// nextCSRAttempt is the earliest time a new CSR may be sent to the CA, and issuanceErr the failure
+	// that delayed it. Protected by generateMutex.
+	nextCSRAttempt time.Time
+	issuanceErr    error
+	// clockOffset is the offset of the CA clock from the local clock, if it exceeds
+	// security.Options.ClockSkewThreshold. Protected by generateMutex.
+	clockOffset time.Duration
+	// identityPolicy overrides the TTL and key type of the workload certificates in configOptions.
+	// Protected by generateMutex.
+	identityPolicy IdentityPolicy
+	// reloadedRotation overrides the TTL and rotation grace period ratio of configOptions once they are
+	// reloaded. Protected by generateMutex.
+	reloadedRotation *rotationOptions
+	// maxSecretTTL caps the TTL of the workload certificates, if not zero. Set on the clients of the
+	// resources requesting a TTL shorter than the configured one.
+	maxSecretTTL time.Duration
+
 	// The paths for an existing certificate chain, key and root cert files. Istio agent will
 	// use them as the source of secrets if they exist.
 	existingCertificateFile model.SdsCertificateConfig
 
 	// certWatcher watches the certificates for changes and triggers a notification to proxy.
-	certWatcher *fsnotify.Watcher
+	certWatcher filewatch.FileWatcher
 	// certs being watched with file watcher.
 	fileCerts map[FileCert]struct{}
 	certMutex sync.RWMutex
@@ -108,16 +174,59 @@ type SecretManagerClient struct {
 	// outputMutex protects writes of certificates to disk
 	outputMutex sync.Mutex
 
+	// statusMutex protects status, the status of the resources generated so far by resource name.
+	statusMutex sync.Mutex
+	status      map[string]*security.CertificateStatus
+
+	// holdMutex protects holds, the expiry of the rotation holds by resource name, or "" for all
+	// the resources, and deferredRotations, the rotations deferred by a hold by resource name.
+	holdMutex         sync.Mutex
+	holds             map[string]time.Time
+	deferredRotations map[string]func() error
+
 	// Dynamically configured Trust Bundle Mutex
 	configTrustBundleMutex sync.RWMutex
 	// Dynamically configured Trust Bundle
 	configTrustBundle []byte
+	// mergedTrustBundle memoizes the last result of mergeConfigTrustBundle, so large bundles are not
+	// merged and copied again for every ROOTCA request. Protected by configTrustBundleMutex.
+	mergedTrustBundle mergedTrustBundle
+
+	// crlMutex protects crl, the PEM encoded CRLs of the CA served with the root certificates, and
+	// crlNextUpdate, the earliest time they are due to be updated.
+	crlMutex      sync.RWMutex
+	crl           []byte
+	crlNextUpdate time.Time
+	// crlOwner, if set, is the client whose CRLs are served, for clients sharing its CA client.
+	crlOwner *SecretManagerClient
+
+	// jwtSVIDMutex protects jwtSVIDs, the JWT SVIDs issued by audience. Requests are serialized, so
+	// that concurrent requests for an audience share a token.
+	jwtSVIDMutex sync.Mutex
+	jwtSVIDs     map[string]cachedJWTSVID
+
+	// ocspMutex protects ocspStaple, the OCSP response of the workload certificate created at
+	// ocspCreatedTime, and ocspNextUpdate, the time it is due to be updated.
+	ocspMutex       sync.RWMutex
+	ocspStaple      []byte
+	ocspCreatedTime time.Time
+	ocspNextUpdate  time.Time
 
 	// queue maintains all certificate rotation events that need to be triggered when they are about to expire
 	queue queue.Delayed
 	stop  chan struct{}
+	// ctx is cancelled on Close, so that in-flight requests to the CA do not outlive the client.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+type mergedTrustBundle struct {
+	configTrustBundle []byte
+	rootCert          []byte
+	merged            []byte
+}
+
+// secretCache is the security.SecretStore keeping the certificates in memory.
 type secretCache struct {
 	mu       sync.RWMutex
 	workload *security.SecretItem
@@ -163,38 +272,141 @@ type FileCert struct {
 
 // NewSecretManagerClient creates a new SecretManagerClient.
 func NewSecretManagerClient(caClient security.Client, options *security.Options) (*SecretManagerClient, error) {
-	watcher, err := fsnotify.NewWatcher()
+	ret, err := newSecretManagerClient(caClient, options)
+	if err != nil {
+		return nil, err
+	}
+	ret.queue.PushDelayed(ret.startExpiryCheck, expiryCheckInterval)
+	return ret, nil
+}
+
+// newSecretManagerClient creates a SecretManagerClient that does not report the expiry of its
+// certificates, for clients whose certificates are reported by another one.
+func newSecretManagerClient(caClient security.Client, options *security.Options) (*SecretManagerClient, error) {
+	store, err := newSecretStore(options)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := filewatch.New(options)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	ret := &SecretManagerClient{
 		queue:         queue.NewDelayed(queue.DelayQueueBuffer(0)),
 		caClient:      caClient,
 		configOptions: options,
+		cache:         store,
 		existingCertificateFile: model.SdsCertificateConfig{
 			CertificatePath:   security.DefaultCertChainFilePath,
 			PrivateKeyPath:    security.DefaultKeyFilePath,
 			CaCertificatePath: security.DefaultRootCertFilePath,
 		},
-		certWatcher: watcher,
-		fileCerts:   make(map[FileCert]struct{}),
-		stop:        make(chan struct{}),
+		certWatcher:        watcher,
+		fileCerts:          make(map[FileCert]struct{}),
+		status:             make(map[string]*security.CertificateStatus),
+		holds:              make(map[string]time.Time),
+		deferredRotations:  make(map[string]func() error),
+		resourceClients:    make(map[string]*SecretManagerClient),
+		resourceNames:      make(map[string]map[string]struct{}),
+		nearExpiryNotified: make(map[string]string),
+		spireReady:         make(chan struct{}),
+		stop:               make(chan struct{}),
+		ctx:                ctx,
+		cancel:             cancel,
+		caBackoff: &security.DecorrelatedJitterBackoff{
+			Base: caPressureBaseBackoff,
+			Max:  caPressureMaxBackoff,
+		},
+		csrLimiter: newCSRLimiter(options),
 	}
 
 	go ret.queue.Run(ret.stop)
+	if _, ok := caClient.(security.CRLSource); ok {
+		ret.queue.Push(ret.startCRLRefresh)
+	}
 	go ret.handleFileWatch()
+	if options.SPIREAgentUDSPath != "" {
+		go ret.watchSPIRE()
+	} else if options.SecretStoreReuse {
+		ret.restoreStoredSecret()
+	}
 	return ret, nil
 }
 
 func (sc *SecretManagerClient) Close() {
+	sc.cancel()
 	_ = sc.certWatcher.Close()
+	sc.resourceMutex.Lock()
+	for _, c := range sc.resourceClients {
+		c.Close()
+	}
+	sc.resourceMutex.Unlock()
+	if workload := sc.cache.GetWorkload(); workload != nil {
+		workload.Destroy()
+	}
 	if sc.caClient != nil {
 		sc.caClient.Close()
 	}
 	close(sc.stop)
 }
 
+// ForIdentity creates a SecretManagerClient requesting certificates for the service account in namespace
+// from the same CA, with the credential of the agent, for components obtaining the identity of the
+// workloads they supervise. CAs signing for the authenticated caller rather than the CSR, such as
+// istiod, issue certificates of the agent's own identity, which the users of the client must reject.
+// The certificates are only kept in memory, their expiry is not reported, and closing the returned
+// client leaves the CA client open.
+func (sc *SecretManagerClient) ForIdentity(namespace, serviceAccount string) (*SecretManagerClient, error) {
+	if sc.configOptions.SPIREAgentUDSPath != "" {
+		return nil, errors.New("identities of other workloads are not available when delegating to the SPIRE agent")
+	}
+	options := *sc.configOptions
+	options.WorkloadNamespace = namespace
+	options.ServiceAccount = serviceAccount
+	options.OutputKeyCertToDir = ""
+	options.MachineBinding = nil
+	if options.SecretStoreDir != "" {
+		options.SecretStoreDir = filepath.Join(options.SecretStoreDir, namespace, serviceAccount)
+	}
+	var caClient security.Client
+	if sc.caClient != nil {
+		caClient = sharedCAClient{sc.caClient}
+	}
+	ret, err := newSecretManagerClient(caClient, &options)
+	if err != nil {
+		return nil, err
+	}
+	// The certificates mounted for the agent's own identity must not be served for other identities.
+	ret.existingCertificateFile = model.SdsCertificateConfig{}
+	ret.csrLimiter = sc.csrLimiter
+	ret.crlOwner = sc
+	return ret, nil
+}
+
+// sharedCAClient is a CA client shared with another SecretManagerClient, which owns it. It is not a
+// CRLSource: the CRLs are only refreshed by the owner, and served from it through crlOwner.
+type sharedCAClient struct {
+	security.Client
+}
+
+func (sharedCAClient) Close() {}
+
+func (c sharedCAClient) SignJWTSVID(ctx context.Context, audience string) (string, error) {
+	if s, ok := c.Client.(security.JWTSVIDSigner); ok {
+		return s.SignJWTSVID(ctx, audience)
+	}
+	return "", security.ErrJWTSVIDNotSupported
+}
+
+func (c sharedCAClient) IssuancePolicy(ctx context.Context) (*security.IssuancePolicy, error) {
+	if p, ok := c.Client.(security.IssuancePolicySource); ok {
+		return p.IssuancePolicy(ctx)
+	}
+	return nil, nil
+}
+
 func (sc *SecretManagerClient) SetUpdateCallback(f func(resourceName string)) {
 	sc.certMutex.Lock()
 	defer sc.certMutex.Unlock()
@@ -209,6 +421,22 @@ func (sc *SecretManagerClient) CallUpdateCallback(resourceName string) {
 	}
 }
 
+// OnCredentialRefresh retries the workload certificate right away if its last CSR failed, instead
+// of after the backoff, as the failure may be due to the previous credential, e.g. an expired token.
+func (sc *SecretManagerClient) OnCredentialRefresh() {
+	sc.generateMutex.Lock()
+	failed := sc.issuanceErr != nil
+	if failed {
+		sc.nextCSRAttempt = time.Time{}
+		sc.caBackoff.Reset()
+	}
+	sc.generateMutex.Unlock()
+	if failed {
+		cacheLog.Info("credential refreshed, retrying the workload certificate")
+		sc.CallUpdateCallback(security.WorkloadKeyCertResourceName)
+	}
+}
+
 // getCachedSecret: retrieve cached Secret Item (workload-certificate/workload-root) from secretManager client
 func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *security.SecretItem) {
 	var rootCertBundle []byte
@@ -220,6 +448,8 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 			ns = &security.SecretItem{
 				ResourceName: resourceName,
 				RootCert:     rootCertBundle,
+				CRL:          sc.getCRL(),
+				TrustBundles: sc.trustBundles(c, rootCertBundle),
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload trust anchor from cache")
 
@@ -230,6 +460,8 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 				PrivateKey:       c.PrivateKey,
 				ExpireTime:       c.ExpireTime,
 				CreatedTime:      c.CreatedTime,
+				Leaf:             c.Leaf,
+				OCSPStaple:       sc.getOCSPStaple(c.CreatedTime),
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload certificate from cache")
 		}
@@ -239,11 +471,68 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 	return nil
 }
 
+// outputKeyCertToDir writes the secret to OutputKeyCertToDir, encrypting the private key with the
+// KeyProtector if one is configured, and records the machine the key was issued to.
+func (sc *SecretManagerClient) outputKeyCertToDir(secret *security.SecretItem) error {
+	privateKey := secret.PrivateKey
+	if privateKey != nil && sc.configOptions.KeyProtector != nil && sc.configOptions.OutputKeyCertToDir != "" {
+		var err error
+		if privateKey, err = sc.configOptions.KeyProtector.Seal(privateKey); err != nil {
+			return fmt.Errorf("failed to encrypt private key: %v", err)
+		}
+	}
+	if err := nodeagentutil.OutputKeyCertToDir(sc.configOptions.OutputKeyCertToDir, privateKey,
+		secret.CertificateChain, secret.RootCert, sc.configOptions.OutputFiles); err != nil {
+		return err
+	}
+	if err := sc.outputKeyStores(secret); err != nil {
+		return err
+	}
+	if privateKey == nil {
+		return nil
+	}
+	return nodeagentutil.WriteMachineBinding(sc.configOptions.OutputKeyCertToDir, sc.configOptions.MachineBinding,
+		sc.configOptions.OutputFiles)
+}
+
+// outputKeyStores writes the secret to OutputKeyCertToDir as the PKCS#12 and Java KeyStore files
+// that are enabled, protected by the current keystore passphrase.
+func (sc *SecretManagerClient) outputKeyStores(secret *security.SecretItem) error {
+	dir := sc.configOptions.OutputKeyCertToDir
+	if dir == "" || !(sc.configOptions.OutputPKCS12 || sc.configOptions.OutputJKS) {
+		return nil
+	}
+	passphrase, err := nodeagentutil.ReadPassphrase(sc.configOptions.KeyStorePassphraseSource)
+	if err != nil {
+		return err
+	}
+	if sc.configOptions.OutputPKCS12 && secret.PrivateKey != nil {
+		if err := nodeagentutil.OutputPKCS12ToDir(dir, secret.PrivateKey, secret.CertificateChain, secret.RootCert,
+			passphrase, sc.configOptions.OutputFiles); err != nil {
+			return err
+		}
+	}
+	if sc.configOptions.OutputJKS {
+		return nodeagentutil.OutputJKSToDir(dir, secret.PrivateKey, secret.CertificateChain, secret.RootCert, passphrase,
+			sc.configOptions.OutputFiles)
+	}
+	return nil
+}
+
 // GenerateSecret passes the cached secret to SDS.StreamSecrets and SDS.FetchSecret.
-func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *security.SecretItem, err error) {
+func (sc *SecretManagerClient) GenerateSecret(resourceName string) (*security.SecretItem, error) {
+	return sc.GenerateSecretWithContext(context.Background(), resourceName)
+}
+
+// GenerateSecretWithContext is GenerateSecret on behalf of a request. Once ctx is done, a pending
+// key generation or CSR is abandoned without delaying the next attempt, as it did not fail.
+func (sc *SecretManagerClient) GenerateSecretWithContext(ctx context.Context, resourceName string) (secret *security.SecretItem, err error) {
 	cacheLog.Debugf("generate secret %q", resourceName)
+	// issued is the workload certificate issued by this call, if any.
+	var issued *security.SecretItem
 	// Setup the call to store generated secret to disk
 	defer func() {
+		sc.recordStatus(resourceName, secret, err)
 		if secret == nil || err != nil {
 			return
 		}
@@ -254,16 +543,35 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 		// if needed.
 		sc.outputMutex.Lock()
 		if resourceName == security.RootCertReqResourceName || resourceName == security.WorkloadKeyCertResourceName {
-			if err := nodeagentutil.OutputKeyCertToDir(sc.configOptions.OutputKeyCertToDir, secret.PrivateKey,
-				secret.CertificateChain, secret.RootCert); err != nil {
+			if err := sc.outputKeyCertToDir(secret); err != nil {
 				cacheLog.Errorf("error when output the resource: %v", err)
 			} else {
 				resourceLog(resourceName).Debugf("output the resource to %v", sc.configOptions.OutputKeyCertToDir)
 			}
 		}
 		sc.outputMutex.Unlock()
+		// The handlers are called once the locks are released, so that they may generate secrets.
+		if issued != nil {
+			sc.notifyRotated(security.WorkloadKeyCertResourceName, issued)
+		}
 	}()
 
+	if strings.HasPrefix(resourceName, security.TrustDomainRootCertResourcePrefix) {
+		return sc.generateTrustDomainRootSecret(resourceName)
+	}
+
+	if sc.configOptions.SPIREAgentUDSPath != "" {
+		return sc.generateSPIRESecret(ctx, resourceName)
+	}
+
+	if _, f := keyTypeResources[resourceName]; f {
+		return sc.generateKeyTypeSecret(ctx, resourceName)
+	}
+
+	if strings.HasPrefix(resourceName, security.WorkloadKeyCertTTLResourcePrefix) {
+		return sc.generateTTLSecret(ctx, resourceName)
+	}
+
 	// First try to generate secret from file.
 	if sdsFromFile, ns, err := sc.generateFileSecret(resourceName); sdsFromFile {
 		if err != nil {
@@ -291,17 +599,43 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 		cacheLog.Warnf("slow generate secret lock: %v", ts)
 	}
 
+	if wait := time.Until(sc.nextCSRAttempt); wait > 0 {
+		return nil, fmt.Errorf("failed to generate workload certificate: next attempt in %v after error: %w", wait, sc.issuanceErr)
+	}
+	// The request may have been abandoned while waiting for the lock.
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to generate workload certificate: %w", err)
+	}
+
 	// send request to CA to get new workload certificate
-	ns, err = sc.generateNewSecret(resourceName)
+	ns, err = sc.generateNewSecret(ctx, resourceName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate workload certificate: %v", err)
+		if ctx.Err() != nil {
+			// The request was abandoned, which says nothing about the CA.
+			return nil, fmt.Errorf("failed to generate workload certificate: %w", err)
+		}
+		sc.rotationIssued(err)
+		sc.backoffOnError(resourceName, err)
+		return nil, fmt.Errorf("failed to generate workload certificate: %w", err)
 	}
+	if err := sc.lockKey(ns.PrivateKey); err != nil {
+		ns.Destroy()
+		return nil, err
+	}
+	sc.rotationIssued(nil)
+	rotated := *ns
+	rotated.ResourceName = security.WorkloadKeyCertResourceName
+	issued = &rotated
+	sc.caBackoff.Reset()
+	sc.issuanceErr = nil
 
 	// Store the new secret in the secretCache and trigger the periodic rotation for workload certificate
 	sc.registerSecret(*ns)
 
 	if resourceName == security.RootCertReqResourceName {
 		ns.RootCert = sc.mergeConfigTrustBundle(ns.RootCert)
+		ns.CRL = sc.getCRL()
+		ns.TrustBundles = sc.trustBundles(ns, ns.RootCert)
 	} else {
 		// If periodic cert refresh resulted in discovery of a new root, trigger a ROOTCA request to refresh trust anchor
 		oldRoot := sc.cache.GetRoot()
@@ -316,6 +650,85 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 	return ns, nil
 }
 
+// recordStatus records the outcome of generating resourceName, reported by CertificateStatus.
+func (sc *SecretManagerClient) recordStatus(resourceName string, secret *security.SecretItem, err error) {
+	sc.statusMutex.Lock()
+	defer sc.statusMutex.Unlock()
+	status := sc.status[resourceName]
+	if status == nil {
+		status = &security.CertificateStatus{ResourceName: resourceName}
+		sc.status[resourceName] = status
+	}
+	if err != nil {
+		status.LastError = err.Error()
+		status.LastErrorTime = time.Now()
+		return
+	}
+	cert := secret.Leaf
+	if cert == nil {
+		certs := secret.CertificateChain
+		if len(certs) == 0 {
+			certs = secret.RootCert
+		}
+		if cert, err = nodeagentutil.ParseLeafCert(certs); err != nil {
+			return
+		}
+	}
+	if serial := cert.SerialNumber.Text(16); serial != status.SerialNumber {
+		status.SerialNumber = serial
+		status.ExpireTime = cert.NotAfter
+		status.LastRotationTime = time.Now()
+	}
+}
+
+// CertificateStatus returns the status of the resources generated so far, ordered by name.
+func (sc *SecretManagerClient) CertificateStatus() []security.CertificateStatus {
+	sc.statusMutex.Lock()
+	defer sc.statusMutex.Unlock()
+	statuses := make([]security.CertificateStatus, 0, len(sc.status))
+	for _, status := range sc.status {
+		s := *status
+		s.RotationHeldUntil = sc.rotationHeldUntil(s.ResourceName)
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ResourceName < statuses[j].ResourceName
+	})
+	return statuses
+}
+
+// backoffOnError delays the next CSR after err. A fatal error, see security.IsFatalError, halts
+// issuance for fatalErrorHold without scheduling a retry. Otherwise a retry is scheduled once the
+// delay expires, which is the larger of a decorrelated jitter backoff and the retry delay hinted by
+// the CA, if any. Must be called with generateMutex held.
+func (sc *SecretManagerClient) backoffOnError(resourceName string, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client is closing.
+		return
+	}
+	sc.issuanceErr = err
+	if security.IsFatalError(err) {
+		numFatalIssuanceErrors.Increment()
+		sc.nextCSRAttempt = time.Now().Add(fatalErrorHold)
+		resourceLog(resourceName).Errorf("fatal error generating certificate, halting issuance for %v: %v", fatalErrorHold, err)
+		return
+	}
+	delay := sc.caBackoff.NextBackOff()
+	if hint, ok := security.CAPressureRetryDelay(err); ok {
+		if hint > delay {
+			delay = hint
+		}
+		resourceLog(resourceName).Warnf("CA is under pressure, delaying next certificate request by %v", delay)
+	} else {
+		resourceLog(resourceName).Warnf("failed to generate certificate, retrying in %v: %v", delay, err)
+	}
+	sc.nextCSRAttempt = time.Now().Add(delay)
+	sc.queue.PushDelayed(func() error {
+		sc.CallUpdateCallback(resourceName)
+		return nil
+	}, delay)
+}
+
 func (sc *SecretManagerClient) addFileWatcher(file string, resourceName string) {
 	// Try adding file watcher and if it fails start a retryloop.
 	if err := sc.tryAddFileWatcher(file, resourceName); err == nil {
@@ -331,7 +744,11 @@ func (sc *SecretManagerClient) addFileWatcher(file string, resourceName string)
 			if err := sc.tryAddFileWatcher(file, resourceName); err == nil {
 				break
 			}
-			time.Sleep(b.NextBackOff())
+			select {
+			case <-time.After(b.NextBackOff()):
+			case <-sc.stop:
+				return
+			}
 		}
 	}()
 }
@@ -393,6 +810,9 @@ func (sc *SecretManagerClient) generateRootCertFromExistingFile(rootCertPath, re
 	if err != nil {
 		return nil, err
 	}
+	if err := pkiutil.CheckCertAlgorithms(rootCert, sc.configOptions.DeniedCertAlgorithms); err != nil {
+		return nil, fmt.Errorf("rejecting root certificate %s: %v", rootCertPath, err)
+	}
 
 	// Set the rootCert only if it is workload root cert.
 	if workload {
@@ -408,8 +828,11 @@ func (sc *SecretManagerClient) generateRootCertFromExistingFile(rootCertPath, re
 func (sc *SecretManagerClient) generateKeyCertFromExistingFiles(certChainPath, keyPath, resourceName string) (*security.SecretItem, error) {
 	// There is a remote possibility that key is written and cert is not written yet.
 	// To handle that case, we wait for some time here.
-	timer := time.After(sc.configOptions.FileDebounceDuration)
-	<-timer
+	select {
+	case <-time.After(sc.configOptions.FileDebounceDuration):
+	case <-sc.stop:
+		return nil, errors.New("secret manager is closed")
+	}
 	return sc.keyCertSecretItem(certChainPath, keyPath, resourceName)
 }
 
@@ -418,14 +841,17 @@ func (sc *SecretManagerClient) keyCertSecretItem(cert, key, resource string) (*s
 	if err != nil {
 		return nil, err
 	}
+	if err := pkiutil.CheckCertAlgorithms(certChain, sc.configOptions.DeniedCertAlgorithms); err != nil {
+		return nil, fmt.Errorf("rejecting certificate chain %s: %v", cert, err)
+	}
 	keyPEM, err := sc.readFileWithTimeout(key)
 	if err != nil {
 		return nil, err
 	}
 
 	now := time.Now()
-	var certExpireTime time.Time
-	if certExpireTime, err = nodeagentutil.ParseCertAndGetExpiryTimestamp(certChain); err != nil {
+	leaf, err := nodeagentutil.ParseLeafCert(certChain)
+	if err != nil {
 		cacheLog.Errorf("failed to extract expiration time in the certificate loaded from file: %v", err)
 		return nil, fmt.Errorf("failed to extract expiration time in the certificate loaded from file: %v", err)
 	}
@@ -435,7 +861,8 @@ func (sc *SecretManagerClient) keyCertSecretItem(cert, key, resource string) (*s
 		PrivateKey:       keyPEM,
 		ResourceName:     resource,
 		CreatedTime:      now,
-		ExpireTime:       certExpireTime,
+		ExpireTime:       leaf.NotAfter,
+		Leaf:             leaf,
 	}, nil
 }
 
@@ -528,15 +955,20 @@ func (sc *SecretManagerClient) generateFileSecret(resourceName string) (bool, *s
 	return sdsFromFile, nil, nil
 }
 
-func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security.SecretItem, error) {
+func (sc *SecretManagerClient) generateNewSecret(requestCtx context.Context, resourceName string) (*security.SecretItem, error) {
 	var trustBundlePEM []string = []string{}
 	var rootCertPEM []byte
 
 	if sc.caClient == nil {
-		return nil, fmt.Errorf("attempted to fetch secret, but ca client is nil")
+		return nil, security.NewFatalError(fmt.Errorf("attempted to fetch secret, but ca client is nil"))
 	}
 	t0 := time.Now()
 	logPrefix := cacheLogPrefix(resourceName)
+	csrCtx, cancel := sc.requestContext(requestCtx)
+	defer cancel()
+	ctx, span := trace.StartSpan(sc.rotationContext(csrCtx), "istio.agent.csr")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("resource_name", resourceName))
 
 	csrHostName := &spiffe.Identity{
 		TrustDomain:    sc.configOptions.TrustDomain,
@@ -545,45 +977,102 @@ func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security
 	}
 
 	cacheLog.Debugf("constructed host name for CSR: %s", csrHostName.String())
+	rsaKeySize := keySize
+	if sc.configOptions.WorkloadRSAKeySize > 0 {
+		rsaKeySize = sc.configOptions.WorkloadRSAKeySize
+	}
+	ttl, eccSigAlg := sc.secretTTL(), sc.eccSigAlg()
+	if sc.configOptions.PQCSigAlg != "" {
+		eccSigAlg = sc.configOptions.PQCSigAlg
+	}
+	if source, ok := sc.caClient.(security.IssuancePolicySource); ok {
+		policy, err := source.IssuancePolicy(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get issuance policy of the CA: %v", err)
+		}
+		ttl, eccSigAlg, rsaKeySize = applyIssuancePolicy(policy, ttl, eccSigAlg, rsaKeySize)
+	}
 	options := pkiutil.CertOptions{
 		Host:       csrHostName.String(),
-		RSAKeySize: keySize,
+		RSAKeySize: rsaKeySize,
 		PKCS8Key:   sc.configOptions.Pkcs8Keys,
-		ECSigAlg:   pkiutil.SupportedECSignatureAlgorithms(sc.configOptions.ECCSigAlg),
+		ECSigAlg:   pkiutil.SupportedECSignatureAlgorithms(eccSigAlg),
+		ECCCurve:   pkiutil.SupportedEllipticCurves(sc.configOptions.ECCCurve),
+	}
+	if attestor := sc.configOptions.KeyAttestor; attestor != nil && sc.configOptions.KeyAttestationCSROID != "" {
+		oid, err := pkiutil.ParseOID(sc.configOptions.KeyAttestationCSROID)
+		if err != nil {
+			return nil, security.NewFatalError(err)
+		}
+		options.KeyAttestationOID = oid
+		options.KeyAttestation = func(keyDigest []byte) ([]byte, error) {
+			attestation, err := attestor.AttestKey(keyDigest)
+			return []byte(attestation), err
+		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// Generate the cert/key, send CSR to CA.
+	_, keySpan := trace.StartSpan(ctx, "istio.agent.keygen")
 	csrPEM, keyPEM, err := pkiutil.GenCSR(options)
+	keySpan.End()
 	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeInternal, Message: err.Error()})
 		cacheLog.Errorf("%s failed to generate key and certificate for CSR: %v", logPrefix, err)
-		return nil, err
+		return nil, security.NewFatalError(err)
 	}
 
+	if err := sc.waitCSR(ctx, resourceName); err != nil {
+		return nil, err
+	}
 	numOutgoingRequests.With(RequestType.Value(monitoring.CSR)).Increment()
 	timeBeforeCSR := time.Now()
-	certChainPEM, err := sc.caClient.CSRSign(csrPEM, int64(sc.configOptions.SecretTTL.Seconds()))
+	// The span context is propagated to the CA, and parents the spans of the token fetch.
+	signCtx, signSpan := trace.StartSpan(ctx, "istio.agent.csr_sign")
+	certChainPEM, err := sc.caClient.CSRSign(signCtx, csrPEM, int64(ttl.Seconds()))
+	signSpan.End()
+	csrLatency.Record(time.Since(timeBeforeCSR).Seconds())
 	if err == nil {
-		trustBundlePEM, err = sc.caClient.GetRootCertBundle()
+		trustBundlePEM, err = sc.caClient.GetRootCertBundle(ctx)
 	}
-	csrLatency := float64(time.Since(timeBeforeCSR).Nanoseconds()) / float64(time.Millisecond)
-	outgoingLatency.With(RequestType.Value(monitoring.CSR)).Record(csrLatency)
+	latency := float64(time.Since(timeBeforeCSR).Nanoseconds()) / float64(time.Millisecond)
+	outgoingLatency.With(RequestType.Value(monitoring.CSR)).Record(latency)
 	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnavailable, Message: err.Error()})
 		numFailedOutgoingRequests.With(RequestType.Value(monitoring.CSR)).Increment()
 		return nil, err
 	}
 
+	if size := pemSize(certChainPEM) + pemSize(trustBundlePEM); size > pkiutil.MaxCertChainSize {
+		return nil, fmt.Errorf("CSR response of %d bytes exceeds %d bytes", size, pkiutil.MaxCertChainSize)
+	}
 	certChain := concatCerts(certChainPEM)
 
-	var expireTime time.Time
 	// Cert expire time by default is createTime + sc.configOptions.SecretTTL.
 	// Istiod respects SecretTTL that passed to it and use it decide TTL of cert it issued.
 	// Some customer CA may override TTL param that's passed to it.
-	if expireTime, err = nodeagentutil.ParseCertAndGetExpiryTimestamp(certChain); err != nil {
+	leaf, err := nodeagentutil.ParseLeafCert(certChain)
+	if err != nil {
 		cacheLog.Errorf("%s failed to extract expire time from server certificate in CSR response %+v: %v",
 			logPrefix, certChainPEM, err)
 		return nil, fmt.Errorf("failed to extract expire time from server certificate in CSR response: %v", err)
 	}
 
+	if err := sc.checkSANs(leaf, csrHostName.String()); err != nil {
+		cacheLog.Errorf("%s rejecting certificate in CSR response: %v", logPrefix, err)
+		return nil, security.NewFatalError(fmt.Errorf("rejecting certificate in CSR response: %v", err))
+	}
+
+	if err := pkiutil.CheckCertAlgorithms(certChain, sc.configOptions.DeniedCertAlgorithms); err != nil {
+		cacheLog.Errorf("%s rejecting certificate chain in CSR response: %v", logPrefix, err)
+		return nil, security.NewFatalError(fmt.Errorf("rejecting certificate chain in CSR response: %v", err))
+	}
+
+	sc.checkClockSkew(leaf, time.Now())
+
+	expireTime := leaf.NotAfter
 	cacheLog.WithLabels("latency", time.Since(t0), "ttl", time.Until(expireTime)).Info("generated new workload certificate")
 
 	if len(trustBundlePEM) > 0 {
@@ -592,6 +1081,10 @@ func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security
 		// If CA Client has no explicit mechanism to retrieve CA root, infer it from the root of the certChain
 		rootCertPEM = []byte(certChainPEM[len(certChainPEM)-1])
 	}
+	if err := pkiutil.CheckCertAlgorithms(rootCertPEM, sc.configOptions.DeniedCertAlgorithms); err != nil {
+		cacheLog.Errorf("%s rejecting root certificate in CSR response: %v", logPrefix, err)
+		return nil, security.NewFatalError(fmt.Errorf("rejecting root certificate in CSR response: %v", err))
+	}
 
 	return &security.SecretItem{
 		CertificateChain: certChain,
@@ -600,13 +1093,46 @@ func (sc *SecretManagerClient) generateNewSecret(resourceName string) (*security
 		CreatedTime:      time.Now(),
 		ExpireTime:       expireTime,
 		RootCert:         rootCertPEM,
+		Leaf:             leaf,
 	}, nil
 }
 
+// requestContext returns the context of a CSR on behalf of the request ctx: it is done once either
+// ctx or the client is, and carries the deadline and trace span of ctx.
+func (sc *SecretManagerClient) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	merged, cancel := context.WithCancel(sc.ctx)
+	if span := trace.FromContext(ctx); span != nil {
+		merged = trace.NewContext(merged, span)
+	}
+	if ctx.Done() == nil {
+		return merged, cancel
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		merged, cancelDeadline = context.WithDeadline(merged, deadline)
+		cancelAll := cancel
+		cancel = func() {
+			cancelDeadline()
+			cancelAll()
+		}
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-merged.Done():
+		}
+	}()
+	return merged, cancel
+}
+
 func (sc *SecretManagerClient) rotateTime(secret security.SecretItem) time.Duration {
+	if sc.clockOffset != 0 && secret.Leaf != nil {
+		return sc.skewedRotateTime(secret, sc.clockOffset)
+	}
 	secretLifeTime := secret.ExpireTime.Sub(secret.CreatedTime)
-	gracePeriod := time.Duration((sc.configOptions.SecretRotationGracePeriodRatio) * float64(secretLifeTime))
-	delay := time.Until(secret.ExpireTime.Add(-gracePeriod))
+	gracePeriod := time.Duration(sc.gracePeriodRatio() * float64(secretLifeTime))
+	delay := time.Until(secret.ExpireTime.Add(-gracePeriod)) - sc.rotationJitter(secretLifeTime)
 	if delay < 0 {
 		delay = 0
 	}
@@ -623,20 +1149,42 @@ func (sc *SecretManagerClient) registerSecret(item security.SecretItem) {
 	}
 	sc.cache.SetWorkload(&item)
 	resourceLog(item.ResourceName).Debugf("scheduled certificate for rotation in %v", delay)
-	sc.queue.PushDelayed(func() error {
-		resourceLog(item.ResourceName).Debugf("rotating certificate")
-		// Clear the cache so the next call generates a fresh certificate
-		sc.cache.SetWorkload(nil)
-
-		sc.CallUpdateCallback(item.ResourceName)
+	if sc.configOptions.OCSPStapling {
+		sc.queue.Push(sc.refreshOCSPStaple(item))
+	}
+	var rotated sync.Once
+	var rotate func() error
+	rotate = func() error {
+		if delay, held := sc.deferRotation(item.ResourceName, item.ExpireTime, rotate); held {
+			resourceLog(item.ResourceName).Infof("certificate rotation held, deferred by %v", delay)
+			sc.queue.PushDelayed(rotate, delay)
+			return nil
+		}
+		// A rotation deferred by a hold may be triggered by both the release and the expiry of the hold.
+		rotated.Do(func() {
+			// The certificate may have been replaced already, e.g. by a change of the identity policy.
+			if cached := sc.cache.GetWorkload(); cached != nil && cached.CreatedTime.Equal(item.CreatedTime) {
+				resourceLog(item.ResourceName).Debugf("rotating certificate")
+				sc.rotationTriggered(item)
+				// Clear the cache so the next call generates a fresh certificate
+				sc.cache.SetWorkload(nil)
+
+				sc.CallUpdateCallback(item.ResourceName)
+			}
+			sc.queue.PushDelayed(func() error {
+				item.Destroy()
+				return nil
+			}, evictedKeyRetention)
+		})
 		return nil
-	}, delay)
+	}
+	sc.queue.PushDelayed(rotate, delay)
 }
 
 func (sc *SecretManagerClient) handleFileWatch() {
 	for {
 		select {
-		case event, ok := <-sc.certWatcher.Events:
+		case event, ok := <-sc.certWatcher.Events():
 			// Channel is closed.
 			if !ok {
 				return
@@ -655,7 +1203,7 @@ func (sc *SecretManagerClient) handleFileWatch() {
 			// a single resource.
 			cacheLog.Infof("event for file certificate %s : %s, pushing to proxy", event.Name, event.Op.String())
 			for k := range resources {
-				if k.Filename == event.Name {
+				if file.SamePath(k.Filename, event.Name) {
 					sc.CallUpdateCallback(k.ResourceName)
 				}
 			}
@@ -663,7 +1211,7 @@ func (sc *SecretManagerClient) handleFileWatch() {
 			if isRemove(event) {
 				sc.certMutex.Lock()
 				for fc := range sc.fileCerts {
-					if fc.Filename == event.Name {
+					if file.SamePath(fc.Filename, event.Name) {
 						cacheLog.Debugf("removing file %s from file certs", event.Name)
 						delete(sc.fileCerts, fc)
 						break
@@ -671,7 +1219,7 @@ func (sc *SecretManagerClient) handleFileWatch() {
 				}
 				sc.certMutex.Unlock()
 			}
-		case err, ok := <-sc.certWatcher.Errors:
+		case err, ok := <-sc.certWatcher.Errors():
 			// Channel is closed.
 			if !ok {
 				return
@@ -694,6 +1242,19 @@ func isRemove(event fsnotify.Event) bool {
 	return event.Op&fsnotify.Remove == fsnotify.Remove
 }
 
+// lockKey locks the private key of a certificate in memory with mlock, if LockKeyMemory is set. Keys
+// are locked once, when they are cached: the copies of a cached secret share its key, which is
+// unlocked by Destroy once it is evicted.
+func (sc *SecretManagerClient) lockKey(key []byte) error {
+	if !sc.configOptions.LockKeyMemory {
+		return nil
+	}
+	if err := pkiutil.TryLockMemory(key); err != nil {
+		return fmt.Errorf("failed to lock private key in memory: %v", err)
+	}
+	return nil
+}
+
 // concatCerts concatenates PEM certificates, making sure each one starts on a new line
 func concatCerts(certsPEM []string) []byte {
 	if len(certsPEM) == 0 {
@@ -709,6 +1270,15 @@ func concatCerts(certsPEM []string) []byte {
 	return certChain.Bytes()
 }
 
+// pemSize returns the total size of the PEM encoded certificates.
+func pemSize(certsPEM []string) int {
+	size := 0
+	for _, cert := range certsPEM {
+		size += len(cert)
+	}
+	return size
+}
+
 func (sc *SecretManagerClient) getConfigTrustBundle() []byte {
 	sc.configTrustBundleMutex.RLock()
 	defer sc.configTrustBundleMutex.RUnlock()
@@ -732,6 +1302,26 @@ func (sc *SecretManagerClient) UpdateConfigTrustBundle(trustBundle []byte) error
 	return nil
 }
 
+// mergeConfigTrustBundle returns rootCert merged with the configured trust bundle, with duplicate
+// roots removed. The result is memoized, so callers passing the same root get back the same slice,
+// which lets consumers (such as SDS) reuse their encoded form instead of copying it again.
 func (sc *SecretManagerClient) mergeConfigTrustBundle(rootCert []byte) []byte {
-	return pkiutil.AppendCertByte(sc.getConfigTrustBundle(), rootCert)
+	sc.configTrustBundleMutex.RLock()
+	m := sc.mergedTrustBundle
+	configTrustBundle := sc.configTrustBundle
+	sc.configTrustBundleMutex.RUnlock()
+	// bytes.Equal is cheap when comparing a slice to itself, which is the common case here.
+	if m.merged != nil && bytes.Equal(m.configTrustBundle, configTrustBundle) && bytes.Equal(m.rootCert, rootCert) {
+		return m.merged
+	}
+
+	merged := pkiutil.DedupCertByte(pkiutil.AppendCertByte(configTrustBundle, rootCert))
+	sc.configTrustBundleMutex.Lock()
+	sc.mergedTrustBundle = mergedTrustBundle{
+		configTrustBundle: configTrustBundle,
+		rootCert:          rootCert,
+		merged:            merged,
+	}
+	sc.configTrustBundleMutex.Unlock()
+	return merged
 }
@@ -16,6 +16,12 @@ package cache
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,12 +31,19 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/file"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/pkg/testcerts"
 	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/log"
 )
 
@@ -75,6 +88,9 @@ func testWorkloadAgentGenerateSecret(t *testing.T, isUsingPluginProvider bool) {
 	if got, want := gotSecret.CertificateChain, []byte(strings.Join(fakeCACli.GeneratedCerts[0], "")); !bytes.Equal(got, want) {
 		t.Errorf("Got unexpected certificate chain #1. Got: %v, want: %v", string(got), string(want))
 	}
+	if gotSecret.Leaf == nil || !gotSecret.Leaf.NotAfter.Equal(gotSecret.ExpireTime) {
+		t.Errorf("Expected parsed leaf certificate expiring at %v, got %v", gotSecret.ExpireTime, gotSecret.Leaf)
+	}
 
 	gotSecretRoot, err := sc.GenerateSecret(security.RootCertReqResourceName)
 	if err != nil {
@@ -86,10 +102,14 @@ func testWorkloadAgentGenerateSecret(t *testing.T, isUsingPluginProvider bool) {
 	}
 
 	// Try to get secret again, verify secret is not generated.
+	leaf := gotSecret.Leaf
 	gotSecret, err = sc.GenerateSecret(security.WorkloadKeyCertResourceName)
 	if err != nil {
 		t.Fatalf("Failed to get secrets: %v", err)
 	}
+	if gotSecret.Leaf != leaf {
+		t.Errorf("Expected cached secret to reuse the parsed leaf certificate")
+	}
 
 	if got, want := gotSecret.CertificateChain, []byte(strings.Join(fakeCACli.GeneratedCerts[0], "")); !bytes.Equal(got, want) {
 		t.Errorf("Got unexpected certificate chain #1. Got: %v, want: %v", string(got), string(want))
@@ -165,6 +185,396 @@ func TestWorkloadAgentRefreshSecret(t *testing.T) {
 	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 2, security.RootCertReqResourceName: 1})
 }
 
+func TestCAPressureBackoff(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	st, err := status.New(codes.ResourceExhausted, "overloaded").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(100 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeCACli.SignErr = fmt.Errorf("create certificate: %w", st.Err())
+
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	sc.caBackoff.Base = 10 * time.Millisecond
+	sc.caBackoff.Max = 10 * time.Millisecond
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil {
+		t.Fatalf("expected error from overloaded CA")
+	}
+	// Further requests fail fast without reaching the CA until the hinted delay has passed.
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil {
+		t.Fatalf("expected error while backing off")
+	}
+	if got := fakeCACli.SignInvokeCount; got != 1 {
+		t.Fatalf("expected 1 CSR to be sent, got %d", got)
+	}
+
+	// Once the delay expires, a retry is triggered through the update callback.
+	fakeCACli.SignErr = nil
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret after backoff: %v", err)
+	}
+}
+
+func TestFatalErrorHaltsIssuance(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	fakeCACli.SignErr = fmt.Errorf("create certificate: %w", status.Error(codes.PermissionDenied, "denied"))
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); !security.IsFatalError(err) {
+		t.Fatalf("expected fatal error, got %v", err)
+	}
+	// Issuance is halted: the CA is not retried even once it would succeed.
+	fakeCACli.SignErr = nil
+	_, err = sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if !security.IsFatalError(err) {
+		t.Fatalf("expected fatal error while halted, got %v", err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 1 {
+		t.Fatalf("expected 1 CSR to be sent, got %d", got)
+	}
+	if wait := time.Until(sc.nextCSRAttempt); wait < fatalErrorHold-time.Minute {
+		t.Fatalf("expected issuance to be halted for %v, got %v", fatalErrorHold, wait)
+	}
+}
+
+func TestCredentialRefreshLiftsHold(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	fakeCACli.SignErr = fmt.Errorf("create certificate: %w", status.Error(codes.PermissionDenied, "token expired"))
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+
+	// Without a failure, a refresh is a no-op.
+	sc.OnCredentialRefresh()
+	u.Expect(map[string]int{})
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); !security.IsFatalError(err) {
+		t.Fatalf("expected fatal error, got %v", err)
+	}
+	fakeCACli.SignErr = nil
+	sc.OnCredentialRefresh()
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret after the credential refresh: %v", err)
+	}
+}
+
+func TestRetryableErrorBackoff(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	fakeCACli.SignErr = errors.New("connection reset")
+
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	sc.caBackoff.Base = 10 * time.Millisecond
+	sc.caBackoff.Max = 10 * time.Millisecond
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil || security.IsFatalError(err) {
+		t.Fatalf("expected retryable error, got %v", err)
+	}
+	// The scheduler retries once the backoff expires.
+	fakeCACli.SignErr = nil
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret after backoff: %v", err)
+	}
+}
+
+func TestCertificateStatus(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	fakeCACli.SignErr = errors.New("connection reset")
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil {
+		t.Fatalf("expected error from CA")
+	}
+	statuses := sc.CertificateStatus()
+	if len(statuses) != 1 || !strings.Contains(statuses[0].LastError, "connection reset") || statuses[0].LastErrorTime.IsZero() {
+		t.Fatalf("expected the failure to be recorded, got %+v", statuses)
+	}
+	if statuses[0].SerialNumber != "" || !statuses[0].LastRotationTime.IsZero() {
+		t.Fatalf("expected no certificate to be recorded, got %+v", statuses[0])
+	}
+
+	fakeCACli.SignErr = nil
+	sc.nextCSRAttempt = time.Time{}
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.GenerateSecret(security.RootCertReqResourceName); err != nil {
+		t.Fatal(err)
+	}
+	statuses = sc.CertificateStatus()
+	if len(statuses) != 2 || statuses[0].ResourceName != security.RootCertReqResourceName {
+		t.Fatalf("expected the status of both resources ordered by name, got %+v", statuses)
+	}
+	got := statuses[1]
+	if got.SerialNumber != secret.Leaf.SerialNumber.Text(16) || !got.ExpireTime.Equal(secret.Leaf.NotAfter) || got.LastRotationTime.IsZero() {
+		t.Errorf("expected the issued certificate to be recorded, got %+v", got)
+	}
+	// The last error is kept for diagnosis after a successful rotation.
+	if got.LastError == "" {
+		t.Errorf("expected the last error to be kept, got %+v", got)
+	}
+}
+
+// prefixKeyProtector is a reversible security.KeyProtector for tests.
+type prefixKeyProtector struct{}
+
+func (prefixKeyProtector) Seal(key []byte) ([]byte, error) {
+	return []byte("sealed:" + base64.StdEncoding.EncodeToString(key)), nil
+}
+
+func (prefixKeyProtector) Open(sealed []byte) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, []byte("sealed:")) {
+		return nil, fmt.Errorf("not sealed")
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(string(sealed), "sealed:"))
+}
+
+func TestOutputKeyCertToDirWithKeyProtector(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir := t.TempDir()
+	sc := createCache(t, fakeCACli, func(resourceName string) {}, security.Options{
+		OutputKeyCertToDir: dir,
+		KeyProtector:       prefixKeyProtector{},
+	})
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	onDisk, err := os.ReadFile(filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(onDisk, secret.PrivateKey) {
+		t.Fatalf("private key is written in plaintext")
+	}
+	if _, err := nodeagentutil.LoadKeyPair(filepath.Join(dir, "cert-chain.pem"), filepath.Join(dir, "key.pem"),
+		prefixKeyProtector{}); err != nil {
+		t.Errorf("failed to load the protected key pair: %v", err)
+	}
+}
+
+func TestOutputKeyCertToDirKeyStores(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	sc := createCache(t, fakeCACli, func(resourceName string) {}, security.Options{
+		OutputKeyCertToDir:       dir,
+		OutputPKCS12:             true,
+		OutputJKS:                true,
+		KeyStorePassphraseSource: "file:" + passphraseFile,
+	})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "key-cert.p12")); !os.IsNotExist(err) {
+		t.Fatalf("expected no keystore without a passphrase, got %v", err)
+	}
+
+	if err := os.WriteFile(passphraseFile, []byte("passphrase\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sc.cache.SetWorkload(nil)
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	for _, name := range []string{"key-cert.p12", "key-cert.jks", "truststore.jks"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 {
+			t.Fatalf("empty %s", name)
+		}
+	}
+}
+
+func TestOutputKeyCertToDirRecordsMachineBinding(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir := t.TempDir()
+	binding := &security.MachineBinding{MachineID: "machine", InstanceID: "instance"}
+	sc := createCache(t, fakeCACli, func(resourceName string) {}, security.Options{
+		OutputKeyCertToDir: dir,
+		MachineBinding:     binding,
+	})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	recorded, err := nodeagentutil.ReadMachineBinding(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded == nil || *recorded != *binding {
+		t.Fatalf("got machine binding %v, want %v", recorded, binding)
+	}
+}
+
+// recordingCAClient records the identities certificates are requested for, and whether it was closed.
+type recordingCAClient struct {
+	security.Client
+	mu         sync.Mutex
+	identities []string
+	closed     bool
+}
+
+func (c *recordingCAClient) CSRSign(ctx context.Context, csrPEM []byte, ttl int64) ([]string, error) {
+	csr, err := pkiutil.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	for _, uri := range csr.URIs {
+		c.identities = append(c.identities, uri.String())
+	}
+	c.mu.Unlock()
+	return c.Client.CSRSign(ctx, csrPEM, ttl)
+}
+
+func (c *recordingCAClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+func TestForIdentity(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	caClient := &recordingCAClient{Client: fakeCACli}
+	dir := t.TempDir()
+	sc := createCache(t, caClient, func(resourceName string) {}, security.Options{
+		TrustDomain:        "cluster.local",
+		WorkloadNamespace:  "istio-system",
+		ServiceAccount:     "agent",
+		OutputKeyCertToDir: dir,
+	})
+	delegated, err := sc.ForIdentity("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := delegated.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	delegated.Close()
+
+	caClient.mu.Lock()
+	defer caClient.mu.Unlock()
+	if len(caClient.identities) != 1 || caClient.identities[0] != "spiffe://cluster.local/ns/foo/sa/bar" {
+		t.Errorf("unexpected identities requested: %v", caClient.identities)
+	}
+	if caClient.closed {
+		t.Errorf("closing the derived client closed the shared CA client")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cert-chain.pem")); !os.IsNotExist(err) {
+		t.Errorf("expected the derived certificate not to be written to disk: %v", err)
+	}
+}
+
+// blockingCAClient blocks signing until the request is cancelled.
+type blockingCAClient struct {
+	security.Client
+	started chan struct{}
+}
+
+func (c *blockingCAClient) CSRSign(ctx context.Context, _ []byte, _ int64) ([]string, error) {
+	close(c.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *blockingCAClient) Close() {}
+
+func TestCloseCancelsCSR(t *testing.T) {
+	caClient := &blockingCAClient{started: make(chan struct{})}
+	sc, err := NewSecretManagerClient(caClient, &security.Options{
+		TrustDomain:       "cluster.local",
+		WorkloadNamespace: "istio-system",
+		ServiceAccount:    "agent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+		errCh <- err
+	}()
+	<-caClient.started
+	sc.Close()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the CSR to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CSR was not cancelled by Close")
+	}
+}
+
+func TestRequestCancelsCSR(t *testing.T) {
+	caClient := &blockingCAClient{started: make(chan struct{})}
+	sc, err := NewSecretManagerClient(caClient, &security.Options{
+		TrustDomain:       "cluster.local",
+		WorkloadNamespace: "istio-system",
+		ServiceAccount:    "agent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := sc.GenerateSecretWithContext(ctx, security.WorkloadKeyCertResourceName)
+		errCh <- err
+	}()
+	<-caClient.started
+	cancel()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the CSR to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CSR was not cancelled with the request")
+	}
+	// An abandoned request does not delay the next one.
+	sc.generateMutex.Lock()
+	defer sc.generateMutex.Unlock()
+	if sc.issuanceErr != nil || !sc.nextCSRAttempt.IsZero() {
+		t.Fatalf("unexpected backoff after the request was cancelled: %v", sc.issuanceErr)
+	}
+}
+
 // Compare times, with 5s error allowance
 func almostEqual(t1, t2 time.Duration) bool {
 	diff := t1 - t2
@@ -436,6 +846,79 @@ func checkSecret(t *testing.T, sc *SecretManagerClient, name string, expected se
 	verifySecret(t, got, &expected)
 }
 
+func TestDeniedCertAlgorithms(t *testing.T) {
+	t.Run("CA", func(t *testing.T) {
+		opts := security.Options{DeniedCertAlgorithms: []string{"SHA256-RSA"}}
+		fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+		if err != nil {
+			t.Fatalf("Error creating Mock CA client: %v", err)
+		}
+		sc := createCache(t, fakeCACli, func(resourceName string) {}, opts)
+		_, err = sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+		if err == nil || !strings.Contains(err.Error(), "denied algorithm SHA256-RSA") {
+			t.Fatalf("expected certificate chain to be rejected, got %v", err)
+		}
+	})
+	t.Run("file", func(t *testing.T) {
+		// Self-signed roots are only rejected for their key.
+		opts := security.Options{DeniedCertAlgorithms: []string{"RSA"}}
+		sc := createCache(t, nil, func(resourceName string) {}, opts)
+		rootCertPath, _ := filepath.Abs("./testdata/root-cert.pem")
+		keyPath, _ := filepath.Abs("./testdata/key.pem")
+		certChainPath, _ := filepath.Abs("./testdata/cert-chain.pem")
+		for _, resource := range []string{"file-cert:" + certChainPath + "~" + keyPath, "file-root:" + rootCertPath} {
+			if _, err := sc.GenerateSecret(resource); err == nil || !strings.Contains(err.Error(), "denied algorithm") {
+				t.Fatalf("expected %s to be rejected, got %v", resource, err)
+			}
+		}
+	})
+}
+
+func TestWorkloadKeyStrength(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    security.Options
+		checkFn func(key interface{}) bool
+	}{
+		{
+			name: "RSA 3072",
+			opts: security.Options{WorkloadRSAKeySize: 3072},
+			checkFn: func(key interface{}) bool {
+				k, ok := key.(*rsa.PrivateKey)
+				return ok && k.N.BitLen() == 3072
+			},
+		},
+		{
+			name: "ECDSA P384",
+			opts: security.Options{ECCSigAlg: string(pkiutil.EcdsaSigAlg), ECCCurve: string(pkiutil.P384Curve)},
+			checkFn: func(key interface{}) bool {
+				k, ok := key.(*ecdsa.PrivateKey)
+				return ok && k.Curve == elliptic.P384()
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+			if err != nil {
+				t.Fatalf("Error creating Mock CA client: %v", err)
+			}
+			sc := createCache(t, fakeCACli, func(resourceName string) {}, tc.opts)
+			secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := pkiutil.ParsePemEncodedKey(secret.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.checkFn(key) {
+				t.Errorf("unexpected key %T", key)
+			}
+		})
+	}
+}
+
 func TestWorkloadAgentGenerateSecretFromFileOverSdsWithBogusFiles(t *testing.T) {
 	originalTimeout := totalTimeout
 	totalTimeout = time.Millisecond * 1
@@ -603,3 +1086,62 @@ func TestProxyConfigAnchors(t *testing.T) {
 		RootCert:     rootCert,
 	})
 }
+
+func BenchmarkGenerateSecret(b *testing.B) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, true)
+	if err != nil {
+		b.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc, err := NewSecretManagerClient(fakeCACli, &security.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sc.Close()
+
+	b.Run("cached", func(b *testing.B) {
+		if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("rotation", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			// Clear the cache to simulate a rotation, which sends a new CSR to the CA.
+			sc.cache.SetWorkload(nil)
+			if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("root", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, err := sc.GenerateSecret(security.RootCertReqResourceName); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestMergeConfigTrustBundle(t *testing.T) {
+	sc := createCache(t, nil, func(resourceName string) {}, security.Options{})
+	rootCert, err := os.ReadFile(filepath.Join("./testdata", "root-cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.UpdateConfigTrustBundle(rootCert); err != nil {
+		t.Fatal(err)
+	}
+	merged := sc.mergeConfigTrustBundle(rootCert)
+	if n := bytes.Count(merged, []byte("BEGIN CERTIFICATE")); n != 1 {
+		t.Fatalf("expected duplicate roots to be removed, got %d certificates", n)
+	}
+	again := sc.mergeConfigTrustBundle(rootCert)
+	if &again[0] != &merged[0] {
+		t.Fatalf("expected merged bundle to be reused")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// spireWatcher receives the X.509 SVIDs of the workload from the SPIRE agent.
+type spireWatcher struct {
+	sc *SecretManagerClient
+}
+
+func (w spireWatcher) OnX509ContextUpdate(c *workloadapi.X509Context) {
+	if err := w.sc.onSPIREUpdate(c); err != nil {
+		cacheLog.Errorf("ignoring X.509 SVID update from the SPIRE agent: %v", err)
+	}
+}
+
+func (w spireWatcher) OnX509ContextWatchError(err error) {
+	cacheLog.Warnf("error watching X.509 SVIDs from the SPIRE agent on %s: %v", w.sc.configOptions.SPIREAgentUDSPath, err)
+}
+
+// watchSPIRE watches the X.509 SVIDs of the workload from the Workload API of the SPIRE agent until
+// the client is closed. Connection failures are retried.
+func (sc *SecretManagerClient) watchSPIRE() {
+	cacheLog.Infof("delegating workload certificates to the SPIRE agent on %s", sc.configOptions.SPIREAgentUDSPath)
+	err := workloadapi.WatchX509Context(sc.ctx, spireWatcher{sc}, workloadapi.WithAddr("unix://"+sc.configOptions.SPIREAgentUDSPath))
+	if err != nil && sc.ctx.Err() == nil {
+		cacheLog.Errorf("stopped watching X.509 SVIDs from the SPIRE agent: %v", err)
+	}
+}
+
+// onSPIREUpdate caches the default X.509 SVID, the bundle of its trust domain and those of the trust
+// domains it is federated with as the workload certificate, and notifies the SDS clients.
+func (sc *SecretManagerClient) onSPIREUpdate(c *workloadapi.X509Context) error {
+	if len(c.SVIDs) == 0 {
+		return errors.New("no X.509 SVID")
+	}
+	svid := c.DefaultSVID()
+	certChain, key, err := svid.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := sc.lockKey(key); err != nil {
+		pkiutil.ZeroBytes(key)
+		return err
+	}
+	bundle, err := c.Bundles.GetX509BundleForTrustDomain(svid.ID.TrustDomain())
+	if err != nil {
+		return err
+	}
+	root, err := bundle.Marshal()
+	if err != nil {
+		return err
+	}
+	trustBundles, err := spireTrustBundles(c.Bundles)
+	if err != nil {
+		return err
+	}
+	leaf := svid.Certificates[0]
+	cacheLog.WithLabels("spiffe", svid.ID, "ttl", time.Until(leaf.NotAfter)).Info("received X.509 SVID from the SPIRE agent")
+	oldRoot := sc.cache.GetRoot()
+	var oldTrustBundles map[string][]byte
+	if old := sc.cache.GetWorkload(); old != nil {
+		oldTrustBundles = old.TrustBundles
+		// The key of the previous SVID is wiped once the SDS clients had time to pick up the new one.
+		sc.queue.PushDelayed(func() error {
+			old.Destroy()
+			return nil
+		}, evictedKeyRetention)
+	}
+	item := &security.SecretItem{
+		CertificateChain: certChain,
+		PrivateKey:       key,
+		RootCert:         root,
+		TrustBundles:     trustBundles,
+		ResourceName:     security.WorkloadKeyCertResourceName,
+		CreatedTime:      time.Now(),
+		ExpireTime:       leaf.NotAfter,
+		Leaf:             leaf,
+	}
+	sc.cache.SetWorkload(item)
+	sc.CallUpdateCallback(security.WorkloadKeyCertResourceName)
+	if !bytes.Equal(oldRoot, root) || !equalTrustBundles(oldTrustBundles, trustBundles) {
+		sc.cache.SetRoot(root)
+		sc.CallUpdateCallback(security.RootCertReqResourceName)
+	}
+	sc.notifyRotated(security.WorkloadKeyCertResourceName, item)
+	sc.spireReadyOnce.Do(func() { close(sc.spireReady) })
+	return nil
+}
+
+// generateSPIRESecret returns resourceName from the X.509 SVID received from the SPIRE agent, waiting
+// for the first one if needed.
+func (sc *SecretManagerClient) generateSPIRESecret(ctx context.Context, resourceName string) (*security.SecretItem, error) {
+	if resourceName != security.WorkloadKeyCertResourceName && resourceName != security.RootCertReqResourceName {
+		return nil, fmt.Errorf("resource %s is not served when delegating to the SPIRE agent", resourceName)
+	}
+	select {
+	case <-sc.spireReady:
+	case <-sc.ctx.Done():
+		return nil, errors.New("secret manager is closed")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for the X.509 SVID from the SPIRE agent: %w", ctx.Err())
+	}
+	if ns := sc.getCachedSecret(resourceName); ns != nil {
+		return ns, nil
+	}
+	return nil, fmt.Errorf("no X.509 SVID received from the SPIRE agent for %s", resourceName)
+}
@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/test/util/retry"
+	istioworkloadapi "istio.io/istio/security/pkg/nodeagent/workloadapi"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// fakeSPIREAgent serves X.509 SVIDs through the SPIFFE Workload API.
+type fakeSPIREAgent struct {
+	server *istioworkloadapi.Server
+	store  *security.DirectSecretManager
+}
+
+func (a *fakeSPIREAgent) rotate(t *testing.T) *security.SecretItem {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host: "spiffe://cluster.local/ns/foo/sa/bar", IsSelfSigned: true, TTL: time.Hour, RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &security.SecretItem{CertificateChain: certPEM, PrivateKey: keyPEM, RootCert: certPEM}
+	a.store.Set(security.WorkloadKeyCertResourceName, secret)
+	a.store.Set(security.RootCertReqResourceName, &security.SecretItem{RootCert: certPEM})
+	a.server.UpdateCallback(security.WorkloadKeyCertResourceName)
+	return secret
+}
+
+func TestSPIREDelegation(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "spire.sock")
+	agent := &fakeSPIREAgent{store: security.NewDirectSecretManager()}
+	var err error
+	agent.server, err = istioworkloadapi.NewServer(&security.Options{WorkloadAPIUDSPath: socket}, agent.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.server.Stop()
+	want := agent.rotate(t)
+
+	sc, err := NewSecretManagerClient(nil, &security.Options{SPIREAgentUDSPath: socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	u := NewUpdateTracker(t)
+	sc.SetUpdateCallback(u.Callback)
+
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.CertificateChain, want.CertificateChain) {
+		t.Fatalf("expected the X.509 SVID of the SPIRE agent, got %s", secret.CertificateChain)
+	}
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.RootCert, want.RootCert) {
+		t.Fatalf("expected the bundle of the SPIRE agent, got %s", root.RootCert)
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertRSAResourceName); err == nil {
+		t.Fatal("expected key type resources not to be served")
+	}
+	if _, err := sc.ForIdentity("bar", "baz"); err == nil {
+		t.Fatal("expected identities of other workloads not to be available")
+	}
+
+	// Rotations by the SPIRE agent are pushed.
+	u.Reset()
+	want = agent.rotate(t)
+	retry.UntilSuccessOrFail(t, func() error {
+		secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(secret.CertificateChain, want.CertificateChain) {
+			return fmt.Errorf("X.509 SVID not rotated")
+		}
+		return nil
+	}, retry.Timeout(10*time.Second))
+	u.Expect(map[string]int{security.WorkloadKeyCertResourceName: 1, security.RootCertReqResourceName: 1})
+}
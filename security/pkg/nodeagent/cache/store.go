@@ -0,0 +1,303 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// storedWorkloadFile is the file of the workload certificate in the directory of a diskStore.
+	storedWorkloadFile = "workload.json"
+
+	// kmsTimeout bounds the requests to the KMS of a kmsKeyProtector.
+	kmsTimeout = 5 * time.Second
+)
+
+// newSecretStore creates the security.SecretStore selected by options.SecretStore.
+func newSecretStore(options *security.Options) (security.SecretStore, error) {
+	switch options.SecretStore {
+	case "", security.SecretStoreMemory:
+		return &secretCache{}, nil
+	case security.SecretStoreDisk:
+		protector := options.KeyProtector
+		if protector == nil && options.KMS != nil {
+			protector = kmsKeyProtector{kms: options.KMS}
+		}
+		if protector == nil {
+			return nil, fmt.Errorf("the %s secret store requires a key protector or a KMS", security.SecretStoreDisk)
+		}
+		identity := spiffe.Identity{
+			TrustDomain:    options.TrustDomain,
+			Namespace:      options.WorkloadNamespace,
+			ServiceAccount: options.ServiceAccount,
+		}
+		return newDiskStore(options.SecretStoreDir, protector, identity.String(), options.SecretStoreReuse)
+	default:
+		return nil, fmt.Errorf("unknown secret store %q", options.SecretStore)
+	}
+}
+
+// diskStore is a security.SecretStore keeping a copy of the workload certificate in a directory, with
+// its private key encrypted by a security.KeyProtector, so that the plaintext key is never written to
+// disk. The certificates are served from memory: the stored copy is only decrypted to restore the
+// workload certificate when the agent restarts.
+type diskStore struct {
+	secretCache
+
+	path      string
+	protector security.KeyProtector
+	// identity is the workload identity the certificates are requested for. A certificate stored for
+	// another identity is ignored.
+	identity string
+}
+
+// storedSecret is the form of a security.SecretItem written by diskStore.
+type storedSecret struct {
+	Identity         string    `json:"identity"`
+	ResourceName     string    `json:"resourceName"`
+	CertificateChain []byte    `json:"certificateChain"`
+	SealedKey        []byte    `json:"sealedKey"`
+	RootCert         []byte    `json:"rootCert"`
+	CreatedTime      time.Time `json:"createdTime"`
+	ExpireTime       time.Time `json:"expireTime"`
+}
+
+// newDiskStore creates a diskStore in dir for identity. A certificate left by a previous agent is
+// discarded unless reuse is set, in which case the SecretManagerClient validates it and schedules its
+// rotation.
+func newDiskStore(dir string, protector security.KeyProtector, identity string, reuse bool) (*diskStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("the %s secret store requires a directory", security.SecretStoreDisk)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create secret store directory: %v", err)
+	}
+	s := &diskStore{path: filepath.Join(dir, storedWorkloadFile), protector: protector, identity: identity}
+	if reuse {
+		return s, nil
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to clear secret store: %v", err)
+	}
+	return s, nil
+}
+
+// restore returns the workload certificate stored by a previous agent for the workload identity, or
+// nil if there is none.
+func (s *diskStore) restore() (*security.SecretItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read stored workload certificate: %v", err)
+	}
+	var stored storedSecret
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse stored workload certificate: %v", err)
+	}
+	if stored.Identity != s.identity {
+		cacheLog.Debugf("ignoring stored workload certificate of %s, expected %s", stored.Identity, s.identity)
+		return nil, nil
+	}
+	leaf, err := nodeagentutil.ParseLeafCert(stored.CertificateChain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stored workload certificate: %v", err)
+	}
+	key, err := s.protector.Open(stored.SealedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt stored workload private key: %v", err)
+	}
+	return &security.SecretItem{
+		ResourceName:     stored.ResourceName,
+		CertificateChain: stored.CertificateChain,
+		PrivateKey:       key,
+		RootCert:         stored.RootCert,
+		CreatedTime:      stored.CreatedTime,
+		ExpireTime:       stored.ExpireTime,
+		Leaf:             leaf,
+	}, nil
+}
+
+func (s *diskStore) SetWorkload(item *security.SecretItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The certificate is served even if it cannot be stored, it is then only lost on restart.
+	s.workload = item
+	if item == nil {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			cacheLog.Errorf("failed to remove stored workload certificate: %v", err)
+		}
+		return
+	}
+	sealed, err := s.protector.Seal(item.PrivateKey)
+	if err != nil {
+		cacheLog.Errorf("failed to encrypt workload private key: %v", err)
+		return
+	}
+	data, err := json.Marshal(storedSecret{
+		Identity:         s.identity,
+		ResourceName:     item.ResourceName,
+		CertificateChain: item.CertificateChain,
+		SealedKey:        sealed,
+		RootCert:         item.RootCert,
+		CreatedTime:      item.CreatedTime,
+		ExpireTime:       item.ExpireTime,
+	})
+	if err != nil {
+		cacheLog.Errorf("failed to encode workload certificate: %v", err)
+		return
+	}
+	if err := file.AtomicWrite(s.path, data, 0o600); err != nil {
+		cacheLog.Errorf("failed to store workload certificate: %v", err)
+	}
+}
+
+// restoreStoredSecret serves the workload certificate left in the store by a previous agent for the
+// workload identity, if security.Options.SecretStoreReuse is set, and schedules its rotation. The
+// certificate is discarded unless its private key matches, its chain verifies against the stored
+// root, its SANs satisfy the SAN policy, and it is not yet due for rotation.
+func (sc *SecretManagerClient) restoreStoredSecret() {
+	store, ok := sc.cache.(*diskStore)
+	if !ok {
+		return
+	}
+	item, err := store.restore()
+	if err != nil {
+		cacheLog.Errorf("failed to restore stored workload certificate, requesting a new one: %v", err)
+		return
+	}
+	if item == nil {
+		return
+	}
+	if err = sc.validateStoredSecret(item); err == nil {
+		err = sc.lockKey(item.PrivateKey)
+	}
+	if err != nil {
+		cacheLog.Infof("discarding stored workload certificate: %v", err)
+		sc.cache.SetWorkload(nil)
+		item.Destroy()
+		return
+	}
+	cacheLog.WithLabels("ttl", time.Until(item.ExpireTime)).Info("reusing stored workload certificate")
+	sc.cache.SetRoot(item.RootCert)
+	sc.registerSecret(*item)
+}
+
+func (sc *SecretManagerClient) validateStoredSecret(item *security.SecretItem) error {
+	if item.Leaf == nil {
+		return fmt.Errorf("no certificate")
+	}
+	if sc.rotateTime(*item) <= 0 {
+		return fmt.Errorf("certificate expiring at %v is due for rotation", item.ExpireTime)
+	}
+	if err := pkiutil.VerifyCertificate(item.PrivateKey, item.CertificateChain, item.RootCert, nil); err != nil {
+		return err
+	}
+	identity := spiffe.Identity{
+		TrustDomain:    sc.configOptions.TrustDomain,
+		Namespace:      sc.configOptions.WorkloadNamespace,
+		ServiceAccount: sc.configOptions.ServiceAccount,
+	}
+	if err := sc.checkSANs(item.Leaf, identity.String()); err != nil {
+		return err
+	}
+	return pkiutil.CheckCertAlgorithms(item.CertificateChain, sc.configOptions.DeniedCertAlgorithms)
+}
+
+// kmsKeyProtector is a security.KeyProtector encrypting each private key with a data key generated for
+// it, and keeping the data key encrypted by the KMS along with the encrypted private key.
+type kmsKeyProtector struct {
+	kms security.KMS
+}
+
+// envelope is the form of a private key sealed by kmsKeyProtector.
+type envelope struct {
+	// WrappedKey is the data key encrypted by the KMS.
+	WrappedKey []byte `json:"wrappedKey"`
+	// SealedKey is the nonce followed by the private key encrypted by the data key.
+	SealedKey []byte `json:"sealedKey"`
+}
+
+func (p kmsKeyProtector) Seal(privateKey []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	defer pkiutil.ZeroBytes(dataKey)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+	aead, err := newDataKeyCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	wrappedKey, err := p.kms.Encrypt(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key: %v", err)
+	}
+	return json.Marshal(envelope{WrappedKey: wrappedKey, SealedKey: aead.Seal(nonce, nonce, privateKey, nil)})
+}
+
+func (p kmsKeyProtector) Open(sealed []byte) ([]byte, error) {
+	var e envelope
+	if err := json.Unmarshal(sealed, &e); err != nil {
+		return nil, fmt.Errorf("invalid sealed key: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kmsTimeout)
+	defer cancel()
+	dataKey, err := p.kms.Decrypt(ctx, e.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %v", err)
+	}
+	defer pkiutil.ZeroBytes(dataKey)
+	aead, err := newDataKeyCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %v", err)
+	}
+	if len(e.SealedKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed key")
+	}
+	nonce, ciphertext := e.SealedKey[:aead.NonceSize()], e.SealedKey[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newDataKeyCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,275 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+// fakeKMS encrypts by reversing and prefixing the plaintext, and counts the decryptions.
+type fakeKMS struct {
+	decryptions int
+	err         error
+}
+
+func (k *fakeKMS) Encrypt(_ context.Context, plaintext []byte) ([]byte, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	out := []byte("kms:")
+	for i := len(plaintext) - 1; i >= 0; i-- {
+		out = append(out, plaintext[i])
+	}
+	return out, nil
+}
+
+func (k *fakeKMS) Decrypt(_ context.Context, ciphertext []byte) ([]byte, error) {
+	k.decryptions++
+	if k.err != nil {
+		return nil, k.err
+	}
+	if !bytes.HasPrefix(ciphertext, []byte("kms:")) {
+		return nil, fmt.Errorf("not encrypted by the KMS")
+	}
+	ciphertext = ciphertext[len("kms:"):]
+	out := make([]byte, 0, len(ciphertext))
+	for i := len(ciphertext) - 1; i >= 0; i-- {
+		out = append(out, ciphertext[i])
+	}
+	return out, nil
+}
+
+func TestSecretStores(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	// A certificate to store.
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{})
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := append([]byte{}, secret.PrivateKey...)
+
+	dir := t.TempDir()
+	cases := []struct {
+		name    string
+		options security.Options
+	}{
+		{name: "memory", options: security.Options{SecretStore: security.SecretStoreMemory}},
+		{name: "disk", options: security.Options{SecretStore: security.SecretStoreDisk, SecretStoreDir: dir, KeyProtector: prefixKeyProtector{}}},
+		{name: "disk-kms", options: security.Options{SecretStore: security.SecretStoreDisk, SecretStoreDir: t.TempDir(), KMS: &fakeKMS{}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := newSecretStore(&tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if store.GetWorkload() != nil {
+				t.Fatal("expected empty store")
+			}
+			store.SetRoot(secret.RootCert)
+			store.SetWorkload(secret)
+			got := store.GetWorkload()
+			if got == nil {
+				t.Fatal("expected stored certificate")
+			}
+			if !bytes.Equal(got.PrivateKey, key) || !bytes.Equal(got.CertificateChain, secret.CertificateChain) ||
+				!got.ExpireTime.Equal(secret.ExpireTime) || got.Leaf == nil || !got.Leaf.Equal(secret.Leaf) {
+				t.Fatalf("expected stored certificate to round trip, got %+v", got)
+			}
+			if !bytes.Equal(store.GetRoot(), secret.RootCert) {
+				t.Fatal("expected stored root certificate")
+			}
+			store.SetWorkload(nil)
+			if store.GetWorkload() != nil {
+				t.Fatal("expected certificate to be cleared")
+			}
+		})
+	}
+}
+
+func TestDiskStoreEncryptsKey(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir := t.TempDir()
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{
+		SecretStore:    security.SecretStoreDisk,
+		SecretStoreDir: dir,
+		KeyProtector:   prefixKeyProtector{},
+	})
+	secret, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, storedWorkloadFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored storedSecret
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(stored.SealedKey, []byte("sealed:")) || bytes.Contains(stored.SealedKey, secret.PrivateKey) {
+		t.Fatalf("expected the stored private key to be encrypted: %s", stored.SealedKey)
+	}
+	// The certificate is served from the store.
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 1 {
+		t.Fatalf("expected 1 CSR to be sent, got %d", got)
+	}
+}
+
+func TestDiskStoreReuse(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir := t.TempDir()
+	options := security.Options{
+		TrustDomain:       "cluster.local",
+		WorkloadNamespace: "default",
+		ServiceAccount:    "app",
+		SecretStore:       security.SecretStoreDisk,
+		SecretStoreDir:    dir,
+		SecretStoreReuse:  true,
+		KMS:               &fakeKMS{},
+	}
+	first, err := createCache(t, fakeCACli, func(string) {}, options).GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted agent serves the stored certificate.
+	secret, err := createCache(t, fakeCACli, func(string) {}, options).GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.CertificateChain, first.CertificateChain) {
+		t.Fatal("expected the stored certificate to be reused")
+	}
+	if got := fakeCACli.SignInvokeCount; got != 1 {
+		t.Fatalf("expected 1 CSR to be sent, got %d", got)
+	}
+
+	// The stored certificate of another identity is discarded.
+	other := options
+	other.ServiceAccount = "other"
+	if _, err := createCache(t, fakeCACli, func(string) {}, other).GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 2 {
+		t.Fatalf("expected a new CSR to be sent, got %d", got)
+	}
+
+	// So is a certificate due for rotation.
+	due := other
+	due.SecretRotationGracePeriodRatio = 1
+	if _, err := createCache(t, fakeCACli, func(string) {}, due).GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 3 {
+		t.Fatalf("expected a new CSR to be sent, got %d", got)
+	}
+
+	// And a certificate whose private key does not match.
+	data, err := os.ReadFile(filepath.Join(dir, storedWorkloadFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored storedSecret
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.CertificateChain = first.CertificateChain
+	if data, err = json.Marshal(stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, storedWorkloadFile), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCache(t, fakeCACli, func(string) {}, other).GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	if got := fakeCACli.SignInvokeCount; got != 4 {
+		t.Fatalf("expected a new CSR to be sent, got %d", got)
+	}
+}
+
+func TestDiskStoreKMSFailure(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	kms := &fakeKMS{}
+	options := security.Options{
+		SecretStore:      security.SecretStoreDisk,
+		SecretStoreDir:   t.TempDir(),
+		SecretStoreReuse: true,
+		KMS:              kms,
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, options)
+	for i := 0; i < 2; i++ {
+		if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The certificate is served from memory, the stored copy is only decrypted on restore.
+	if got := fakeCACli.SignInvokeCount; got != 1 || kms.decryptions != 0 {
+		t.Fatalf("expected the certificate to be served from memory, got %d CSRs and %d decryptions", got, kms.decryptions)
+	}
+
+	// A stored certificate that can't be decrypted is requested again, once.
+	kms.err = fmt.Errorf("KMS unavailable")
+	sc = createCache(t, fakeCACli, func(string) {}, options)
+	for i := 0; i < 2; i++ {
+		if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fakeCACli.SignInvokeCount; got != 2 || kms.decryptions != 1 {
+		t.Fatalf("expected a single new CSR after a failed restore, got %d CSRs and %d decryptions", got, kms.decryptions)
+	}
+}
+
+func TestNewSecretStoreInvalid(t *testing.T) {
+	for _, options := range []security.Options{
+		{SecretStore: "vault"},
+		{SecretStore: security.SecretStoreDisk, SecretStoreDir: t.TempDir()},
+		{SecretStore: security.SecretStoreDisk, KeyProtector: prefixKeyProtector{}},
+		{SecretStore: "kms", KMS: &fakeKMS{}},
+	} {
+		options := options
+		if _, err := newSecretStore(&options); err == nil {
+			t.Errorf("expected secret store %+v to be rejected", options)
+		}
+	}
+}
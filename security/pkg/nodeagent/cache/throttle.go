@@ -0,0 +1,70 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"istio.io/istio/pkg/security"
+)
+
+// newCSRLimiter returns the limiter of the CSRs sent per options, or nil if they are not limited.
+func newCSRLimiter(options *security.Options) *rate.Limiter {
+	if options.CSRRateLimit <= 0 {
+		return nil
+	}
+	burst := options.CSRBurst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(options.CSRRateLimit), burst)
+}
+
+// waitCSR waits until a CSR may be sent to the CA per the CSR rate limit.
+func (sc *SecretManagerClient) waitCSR(ctx context.Context, resourceName string) error {
+	if sc.csrLimiter == nil {
+		return nil
+	}
+	r := sc.csrLimiter.Reserve()
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+	resourceLog(resourceName).Infof("CSR rate limited, sending it in %v", delay)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// rotationJitter returns the random advance of the rotation of a certificate of lifetime, per
+// security.Options.SecretRotationJitterRatio.
+func (sc *SecretManagerClient) rotationJitter(lifetime time.Duration) time.Duration {
+	ratio := sc.configOptions.SecretRotationJitterRatio
+	if ratio <= 0 || lifetime <= 0 {
+		return 0
+	}
+	// nolint: gosec // the jitter does not need to be unpredictable
+	return time.Duration(rand.Float64() * ratio * float64(lifetime))
+}
@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+func TestRotationJitter(t *testing.T) {
+	sc := &SecretManagerClient{configOptions: &security.Options{
+		SecretRotationGracePeriodRatio: 0.5,
+		SecretRotationJitterRatio:      0.25,
+	}}
+	now := time.Now()
+	secret := security.SecretItem{CreatedTime: now, ExpireTime: now.Add(time.Hour)}
+	delays := map[time.Duration]struct{}{}
+	for i := 0; i < 20; i++ {
+		got := sc.rotateTime(secret)
+		// Rotation is advanced from 30m by up to 15m.
+		if got > 30*time.Minute || got < 15*time.Minute-time.Second {
+			t.Fatalf("got rotation in %v, expected between 15m and 30m", got)
+		}
+		delays[got.Round(time.Second)] = struct{}{}
+	}
+	if len(delays) < 2 {
+		t.Fatalf("expected the rotations to be spread, got %v", delays)
+	}
+}
+
+func TestCSRRateLimit(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{
+		SecretTTL:    time.Hour,
+		CSRRateLimit: 2,
+		CSRBurst:     1,
+	})
+	start := time.Now()
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	// The resource clients share the limit: the second CSR is sent at least 500ms after the first.
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "15m"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("expected the second CSR to wait for the rate limit, took %v", elapsed)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	// minResourceTTL is the shortest TTL a resource may request, so that its certificates are not
+	// rotated more often than the CA can sign them.
+	minResourceTTL = 10 * time.Minute
+	// maxTTLResources bounds the number of distinct TTLs requested by resources, each of which has
+	// its own certificate, CSRs and rotation.
+	maxTTLResources = 8
+)
+
+// resourceTTL returns the TTL requested by resourceName, which has the
+// WorkloadKeyCertTTLResourcePrefix.
+func resourceTTL(resourceName string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(strings.TrimPrefix(resourceName, security.WorkloadKeyCertTTLResourcePrefix))
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid TTL in resource name %q", resourceName)
+	}
+	if ttl < minResourceTTL {
+		return 0, fmt.Errorf("TTL in resource name %q is shorter than the minimum of %v", resourceName, minResourceTTL)
+	}
+	return ttl, nil
+}
+
+// generateTTLSecret returns the workload certificate with the TTL requested by resourceName, issued
+// by a SecretManagerClient for that TTL so that it is cached and rotated independently of the
+// workload certificate with the configured TTL. The TTL is capped by the configured one: a resource
+// may only shorten the lifetime of the workload certificates.
+func (sc *SecretManagerClient) generateTTLSecret(ctx context.Context, resourceName string) (*security.SecretItem, error) {
+	client, err := sc.ttlClient(resourceName)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.GenerateSecretWithContext(ctx, security.WorkloadKeyCertResourceName)
+	if err != nil {
+		return nil, err
+	}
+	ret := *secret
+	ret.ResourceName = resourceName
+	return &ret, nil
+}
+
+func (sc *SecretManagerClient) ttlClient(resourceName string) (*SecretManagerClient, error) {
+	ttl, err := resourceTTL(resourceName)
+	if err != nil {
+		return nil, err
+	}
+	// Resources requesting the same TTL, e.g. default:60m and default:1h, share a client.
+	return sc.resourceClient(security.WorkloadKeyCertTTLResourcePrefix+ttl.String(), resourceName, *sc.configOptions, ttl)
+}
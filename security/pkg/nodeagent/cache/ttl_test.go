@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+)
+
+// ttlCAClient records the TTLs requested in the CSRs.
+type ttlCAClient struct {
+	security.Client
+
+	mu   sync.Mutex
+	ttls []time.Duration
+}
+
+func (c *ttlCAClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	c.mu.Lock()
+	c.ttls = append(c.ttls, time.Duration(certValidTTLInSec)*time.Second)
+	c.mu.Unlock()
+	return c.Client.CSRSign(ctx, csrPEM, certValidTTLInSec)
+}
+
+func (c *ttlCAClient) lastTTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttls[len(c.ttls)-1]
+}
+
+func TestTTLSecrets(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	caClient := &ttlCAClient{Client: fakeCACli}
+	sc := createCache(t, caClient, func(string) {}, security.Options{SecretTTL: time.Hour})
+	cases := []struct {
+		resourceName string
+		ttl          time.Duration
+	}{
+		{resourceName: security.WorkloadKeyCertResourceName, ttl: time.Hour},
+		{resourceName: security.WorkloadKeyCertTTLResourcePrefix + "15m", ttl: 15 * time.Minute},
+		// The TTL of a resource cannot exceed the configured one.
+		{resourceName: security.WorkloadKeyCertTTLResourcePrefix + "2h", ttl: time.Hour},
+	}
+	for _, tc := range cases {
+		secret, err := sc.GenerateSecret(tc.resourceName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.ResourceName != tc.resourceName {
+			t.Fatalf("expected resource %s, got %s", tc.resourceName, secret.ResourceName)
+		}
+		if got := caClient.lastTTL(); got != tc.ttl {
+			t.Fatalf("%s: expected a TTL of %v, got %v", tc.resourceName, tc.ttl, got)
+		}
+	}
+
+	// The identity policy applies to the resources with a TTL, within their TTL.
+	sc.UpdateIdentityPolicy(IdentityPolicy{SecretTTL: 10 * time.Minute})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "15m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := caClient.lastTTL(); got != 10*time.Minute {
+		t.Fatalf("expected the TTL of the identity policy, got %v", got)
+	}
+
+	for _, name := range []string{
+		security.WorkloadKeyCertTTLResourcePrefix + "foo",
+		security.WorkloadKeyCertTTLResourcePrefix + "-1h",
+		security.WorkloadKeyCertTTLResourcePrefix + "1ns",
+	} {
+		if _, err := sc.GenerateSecret(name); err == nil {
+			t.Fatalf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestTTLSecretsSharedClients(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	sc := createCache(t, fakeCACli, func(string) {}, security.Options{SecretTTL: 24 * time.Hour})
+	first, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "60m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same TTL spelled differently is served by the same client, with the same certificate.
+	second, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ResourceName != security.WorkloadKeyCertTTLResourcePrefix+"1h" ||
+		!bytes.Equal(first.CertificateChain, second.CertificateChain) {
+		t.Fatalf("expected the certificate of the same TTL to be shared")
+	}
+
+	// The number of distinct TTLs is bounded.
+	for i := 1; i < maxTTLResources; i++ {
+		name := fmt.Sprintf("%s%dh", security.WorkloadKeyCertTTLResourcePrefix, i+1)
+		if _, err := sc.GenerateSecret(name); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "20h"); err == nil {
+		t.Fatal("expected an error once the number of TTLs is exhausted")
+	}
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertTTLResourcePrefix + "120m"); err != nil {
+		t.Fatalf("expected an existing TTL to be served, got %v", err)
+	}
+}
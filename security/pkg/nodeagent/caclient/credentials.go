@@ -21,6 +21,7 @@ import (
 	"os"
 	"strings"
 
+	"go.opencensus.io/trace"
 	"google.golang.org/grpc/credentials"
 
 	"istio.io/istio/pkg/security"
@@ -58,9 +59,13 @@ func (t *TokenProvider) GetRequestMetadata(ctx context.Context, uri ...string) (
 	if t == nil {
 		return nil, nil
 	}
-	token, err := t.GetToken()
+	token, err := t.getToken(ctx)
 	if err != nil {
-		return nil, err
+		// Keep the classification of the error, which gRPC only preserves for status errors.
+		if security.IsFatalError(err) {
+			return nil, security.NewFatalError(err)
+		}
+		return nil, security.NewRetryableError(err)
 	}
 	if token == "" {
 		return nil, nil
@@ -86,16 +91,23 @@ func (t *TokenProvider) RequireTransportSecurity() bool {
 // volatile memory), we can still proceed and allow other authentication methods to potentially
 // handle the request, such as mTLS.
 func (t *TokenProvider) GetToken() (string, error) {
+	return t.getToken(context.Background())
+}
+
+// getToken is GetToken, abandoning the token exchange when ctx is cancelled.
+func (t *TokenProvider) getToken(ctx context.Context) (string, error) {
 	if !t.forCA {
 		return t.GetTokenForXDS()
 	}
+	_, span := trace.StartSpan(ctx, "istio.agent.token")
+	defer span.End()
 	// For CA, we have two modes, using the newer CredentialFetcher or just reading directly from file
 	var token string
 	if t.opts.CredFetcher != nil {
 		var err error
 		token, err = t.opts.CredFetcher.GetPlatformCredential()
 		if err != nil {
-			return "", fmt.Errorf("fetch platform credential: %v", err)
+			return "", security.NewRetryableError(fmt.Errorf("fetch platform credential: %v", err))
 		}
 	} else {
 		if t.opts.JWTPath == "" {
@@ -111,7 +123,7 @@ func (t *TokenProvider) GetToken() (string, error) {
 
 	// Regardless of where the token came from, we (optionally) can exchange the token for a different
 	// one using the configured TokenExchanger.
-	return t.exchangeToken(token)
+	return t.exchangeToken(ctx, token)
 }
 
 // GetTokenForXDS gets the token for the XDS flow.
@@ -138,13 +150,13 @@ func (t *TokenProvider) getTokenForGCP() (string, error) {
 		// When running at a non-k8s platform, use CredFetcher to get credential.
 		tok, err = t.opts.CredFetcher.GetPlatformCredential()
 		if err != nil {
-			return "", fmt.Errorf("failed to fetch platform credential: %v", err)
+			return "", security.NewRetryableError(fmt.Errorf("failed to fetch platform credential: %v", err))
 		}
 	} else {
 		// When XDS auth provider is GCP, token is always required. We should return
 		// err when failed to get a token.
 		if t.opts.JWTPath == "" {
-			return "", fmt.Errorf("the JWTPath is not set")
+			return "", security.NewFatalError(fmt.Errorf("the JWTPath is not set"))
 		}
 		tokBytes, err := os.ReadFile(t.opts.JWTPath)
 		if err != nil {
@@ -154,7 +166,7 @@ func (t *TokenProvider) getTokenForGCP() (string, error) {
 	}
 	// For XDS flow, the token exchange is different from that of the CA flow.
 	if t.opts.TokenManager == nil {
-		return "", fmt.Errorf("XDS token exchange is enabled but token manager is nil")
+		return "", security.NewFatalError(fmt.Errorf("XDS token exchange is enabled but token manager is nil"))
 	}
 	if strings.TrimSpace(tok) == "" {
 		return "", fmt.Errorf("the token for XDS token exchange is empty")
@@ -178,9 +190,15 @@ func (t *TokenProvider) getTokenForGCP() (string, error) {
 
 // exchangeToken exchanges the provided token using TokenExchanger, if configured. If not, the
 // original token is returned.
-func (t *TokenProvider) exchangeToken(token string) (string, error) {
+func (t *TokenProvider) exchangeToken(ctx context.Context, token string) (string, error) {
 	if t.opts.TokenExchanger == nil {
 		return token, nil
 	}
-	return t.opts.TokenExchanger.ExchangeToken(token)
+	ctx, span := trace.StartSpan(ctx, "istio.agent.token_exchange")
+	defer span.End()
+	exchanged, err := t.opts.TokenExchanger.ExchangeToken(ctx, token)
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnavailable, Message: err.Error()})
+	}
+	return exchanged, err
 }
@@ -0,0 +1,228 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+// unhealthyEndpointCooldown is how long a CA endpoint that failed is skipped before being tried again.
+var unhealthyEndpointCooldown = 30 * time.Second
+
+// failoverEndpoint is a CA endpoint of a failoverClient, and its health.
+type failoverEndpoint struct {
+	address string
+	// client is created on first use. unhealthyUntil is the time until which the endpoint is skipped
+	// after a failure.
+	client         security.Client
+	unhealthyUntil time.Time
+}
+
+// failoverClient sends the requests to the first healthy of several CA endpoints, in order of
+// preference. An endpoint failing with a retryable error is skipped for unhealthyEndpointCooldown,
+// and the next one is tried instead; requests fail back to a preferred endpoint once its cooldown
+// expires. Fatal errors are returned as is, as they would be the same on any endpoint.
+type failoverClient struct {
+	newClient func(address string) (security.Client, error)
+
+	mu        sync.Mutex
+	endpoints []*failoverEndpoint
+	// active is the index of the endpoint that last served a request.
+	active int
+}
+
+var _ security.Client = &failoverClient{}
+
+// NewFailoverClient returns a client of the CA endpoints addresses, in order of preference, created
+// with newClient on first use.
+func NewFailoverClient(addresses []string, newClient func(address string) (security.Client, error)) (security.Client, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no CA endpoints")
+	}
+	c := &failoverClient{newClient: newClient}
+	for _, address := range addresses {
+		c.endpoints = append(c.endpoints, &failoverEndpoint{address: address})
+	}
+	return c, nil
+}
+
+// candidates returns the endpoints to try in order: the healthy ones, then those cooling down in case
+// they all are.
+func (c *failoverClient) candidates() []*failoverEndpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	healthy := make([]*failoverEndpoint, 0, len(c.endpoints))
+	var unhealthy []*failoverEndpoint
+	for _, e := range c.endpoints {
+		if now.Before(e.unhealthyUntil) {
+			unhealthy = append(unhealthy, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// client returns the client of e, creating it if needed. The client is created without holding mu,
+// so that dialing an endpoint doesn't block the requests to the others.
+func (c *failoverClient) client(e *failoverEndpoint) (security.Client, error) {
+	c.mu.Lock()
+	client := e.client
+	c.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	client, err := c.newClient(e.address)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.client != nil {
+		// Another request created the client concurrently.
+		client.Close()
+		return e.client, nil
+	}
+	e.client = client
+	return client, nil
+}
+
+// markHealthy records that e served a request, logging a failover or failback.
+func (c *failoverClient) markHealthy(e *failoverEndpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.unhealthyUntil = time.Time{}
+	for i, other := range c.endpoints {
+		if other == e && i != c.active {
+			previous := c.endpoints[c.active].address
+			if i < c.active {
+				log.Infof("failing back from CA endpoint %s to %s", previous, e.address)
+			} else {
+				log.Warnf("failing over from CA endpoint %s to %s", previous, e.address)
+			}
+			c.active = i
+		}
+	}
+}
+
+func (c *failoverClient) markUnhealthy(e *failoverEndpoint, err error) {
+	log.Warnf("CA endpoint %s failed, skipping it for %v: %v", e.address, unhealthyEndpointCooldown, err)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.unhealthyUntil = time.Now().Add(unhealthyEndpointCooldown)
+}
+
+// do calls f with the client of each candidate endpoint until one succeeds, fails with a fatal error,
+// or ctx is done.
+func (c *failoverClient) do(ctx context.Context, f func(security.Client) error) error {
+	var err error
+	for _, e := range c.candidates() {
+		var client security.Client
+		if client, err = c.client(e); err == nil {
+			if err = f(client); err == nil {
+				c.markHealthy(e)
+				return nil
+			}
+			if security.IsFatalError(err) {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			// The request was abandoned, which says nothing about the endpoint.
+			break
+		}
+		c.markUnhealthy(e, err)
+	}
+	return err
+}
+
+func (c *failoverClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	var chain []string
+	err := c.do(ctx, func(client security.Client) (err error) {
+		chain, err = client.CSRSign(ctx, csrPEM, certValidTTLInSec)
+		return err
+	})
+	return chain, err
+}
+
+func (c *failoverClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
+	var roots []string
+	err := c.do(ctx, func(client security.Client) (err error) {
+		roots, err = client.GetRootCertBundle(ctx)
+		return err
+	})
+	return roots, err
+}
+
+func (c *failoverClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.endpoints {
+		if e.client != nil {
+			e.client.Close()
+		}
+	}
+}
+
+// IssuancePolicy returns the issuance policy of the CA, if its client has one.
+func (c *failoverClient) IssuancePolicy(ctx context.Context) (*security.IssuancePolicy, error) {
+	var policy *security.IssuancePolicy
+	err := c.do(ctx, func(client security.Client) (err error) {
+		if p, ok := client.(security.IssuancePolicySource); ok {
+			policy, err = p.IssuancePolicy(ctx)
+		}
+		return err
+	})
+	return policy, err
+}
+
+// CRL returns the CRLs of the CA, if its client has them.
+func (c *failoverClient) CRL(ctx context.Context) ([]byte, error) {
+	var crl []byte
+	err := c.do(ctx, func(client security.Client) (err error) {
+		if s, ok := client.(security.CRLSource); ok {
+			crl, err = s.CRL(ctx)
+		}
+		return err
+	})
+	return crl, err
+}
+
+// SignJWTSVID returns a JWT SVID from the CA, if its client issues them.
+func (c *failoverClient) SignJWTSVID(ctx context.Context, audience string) (string, error) {
+	var token string
+	err := c.do(ctx, func(client security.Client) error {
+		s, ok := client.(security.JWTSVIDSigner)
+		if !ok {
+			return security.NewFatalError(security.ErrJWTSVIDNotSupported)
+		}
+		var err error
+		token, err = s.SignJWTSVID(ctx, audience)
+		if errors.Is(err, security.ErrJWTSVIDNotSupported) {
+			// The other endpoints are served by the same kind of CA.
+			return security.NewFatalError(err)
+		}
+		return err
+	})
+	return token, err
+}
@@ -0,0 +1,126 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+)
+
+// failingClient signs with its endpoint as chain, or fails with err.
+type failingClient struct {
+	endpointClient
+	err   error
+	calls int
+}
+
+func (c *failingClient) CSRSign(ctx context.Context, csrPEM []byte, ttl int64) ([]string, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.endpointClient.CSRSign(ctx, csrPEM, ttl)
+}
+
+func TestFailoverClient(t *testing.T) {
+	defer func(cooldown time.Duration) { unhealthyEndpointCooldown = cooldown }(unhealthyEndpointCooldown)
+	unhealthyEndpointCooldown = time.Hour
+
+	clients := map[string]*failingClient{
+		"primary":   {endpointClient: endpointClient{endpoint: "primary"}},
+		"secondary": {endpointClient: endpointClient{endpoint: "secondary"}},
+	}
+	c, err := NewFailoverClient([]string{"primary", "secondary"}, func(address string) (security.Client, error) {
+		return clients[address], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func() string {
+		t.Helper()
+		chain, err := c.CSRSign(context.Background(), nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chain[0]
+	}
+	if got := sign(); got != "primary" {
+		t.Fatalf("expected the preferred endpoint, got %s", got)
+	}
+
+	// A failing endpoint is skipped while it cools down.
+	clients["primary"].err = status.Error(codes.Unavailable, "unavailable")
+	if got := sign(); got != "secondary" {
+		t.Fatalf("expected a failover, got %s", got)
+	}
+	clients["primary"].err = nil
+	calls := clients["primary"].calls
+	if got := sign(); got != "secondary" || clients["primary"].calls != calls {
+		t.Fatalf("expected the unhealthy endpoint to be skipped, got %s", got)
+	}
+
+	// Requests fail back to the preferred endpoint once it cooled down.
+	c.(*failoverClient).endpoints[0].unhealthyUntil = time.Now()
+	if got := sign(); got != "primary" {
+		t.Fatalf("expected a failback, got %s", got)
+	}
+
+	// Fatal errors are not retried on other endpoints.
+	clients["primary"].err = status.Error(codes.InvalidArgument, "invalid CSR")
+	calls = clients["secondary"].calls
+	if _, err := c.CSRSign(context.Background(), nil, 0); err == nil || clients["secondary"].calls != calls {
+		t.Fatalf("expected the fatal error to be returned, got %v", err)
+	}
+
+	c.Close()
+	if !clients["primary"].closed || !clients["secondary"].closed {
+		t.Fatalf("expected the clients of all endpoints to be closed")
+	}
+}
+
+func TestFailoverClientAbandonedRequest(t *testing.T) {
+	primary := &failingClient{endpointClient: endpointClient{endpoint: "primary"}}
+	secondary := &failingClient{endpointClient: endpointClient{endpoint: "secondary"}}
+	c, err := NewFailoverClient([]string{"primary", "secondary"}, func(address string) (security.Client, error) {
+		if address == "primary" {
+			return primary, nil
+		}
+		return secondary, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A request abandoned while the endpoint is serving it doesn't mark the endpoint unhealthy.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary.err = context.Canceled
+	if _, err := c.CSRSign(ctx, nil, 0); err == nil {
+		t.Fatal("expected the abandoned request to fail")
+	}
+	if secondary.calls != 0 {
+		t.Fatalf("expected no failover for an abandoned request")
+	}
+	primary.err = nil
+	if chain, err := c.CSRSign(context.Background(), nil, 0); err != nil || chain[0] != "primary" {
+		t.Fatalf("expected the preferred endpoint to still be healthy, got %v %v", chain, err)
+	}
+}
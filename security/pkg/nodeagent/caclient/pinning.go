@@ -0,0 +1,207 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+// pinHashPrefix prefixes a pin given as the hex SHA-256 digest of a root's SubjectPublicKeyInfo.
+const pinHashPrefix = "sha256:"
+
+// pinnedRootClient verifies that every certificate chain signed by the CA chains to a pinned root,
+// so that a compromised or misrouted CA endpoint cannot silently issue from a different hierarchy.
+type pinnedRootClient struct {
+	security.Client
+	// roots are the pinned root certificates.
+	roots []*x509.Certificate
+	// hashes are the SHA-256 digests of the SubjectPublicKeyInfo of the pinned roots.
+	hashes map[[sha256.Size]byte]bool
+}
+
+var _ security.Client = &pinnedRootClient{}
+
+// NewPinnedRootClient wraps client to reject certificate chains that do not chain to one of pins.
+// Each pin is either "sha256:" followed by the hex SHA-256 digest of the SubjectPublicKeyInfo of a
+// root, or the path of a PEM file of root certificates.
+func NewPinnedRootClient(client security.Client, pins []string) (security.Client, error) {
+	c := &pinnedRootClient{Client: client, hashes: map[[sha256.Size]byte]bool{}}
+	for _, pin := range pins {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		if strings.HasPrefix(pin, pinHashPrefix) {
+			digest, err := hex.DecodeString(strings.TrimPrefix(pin, pinHashPrefix))
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("invalid CA root pin %q: expected %s followed by %d hex encoded bytes",
+					pin, pinHashPrefix, sha256.Size)
+			}
+			var h [sha256.Size]byte
+			copy(h[:], digest)
+			c.hashes[h] = true
+			continue
+		}
+		roots, err := readRoots(pin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA root pin %q: %v", pin, err)
+		}
+		c.roots = append(c.roots, roots...)
+	}
+	if len(c.roots) == 0 && len(c.hashes) == 0 {
+		return nil, fmt.Errorf("no CA root pins")
+	}
+	return c, nil
+}
+
+// IssuancePolicy returns the issuance policy of the wrapped client, if any.
+func (c *pinnedRootClient) IssuancePolicy(ctx context.Context) (*security.IssuancePolicy, error) {
+	if p, ok := c.Client.(security.IssuancePolicySource); ok {
+		return p.IssuancePolicy(ctx)
+	}
+	return nil, nil
+}
+
+// CRL returns the CRLs of the wrapped client, if any.
+func (c *pinnedRootClient) CRL(ctx context.Context) ([]byte, error) {
+	if s, ok := c.Client.(security.CRLSource); ok {
+		return s.CRL(ctx)
+	}
+	return nil, nil
+}
+
+// SignJWTSVID returns a JWT SVID from the wrapped client, if it issues them.
+func (c *pinnedRootClient) SignJWTSVID(ctx context.Context, audience string) (string, error) {
+	if s, ok := c.Client.(security.JWTSVIDSigner); ok {
+		return s.SignJWTSVID(ctx, audience)
+	}
+	return "", security.ErrJWTSVIDNotSupported
+}
+
+// CSRSign signs the CSR with the wrapped client, and returns an error if the signed chain does not
+// chain to a pinned root.
+func (c *pinnedRootClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	chain, err := c.Client.CSRSign(ctx, csrPEM, certValidTTLInSec)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verify(ctx, chain); err != nil {
+		log.Errorf("rejecting certificate chain from CA: %v", err)
+		return nil, err
+	}
+	return chain, nil
+}
+
+// verify checks that the leaf of chain chains to a pinned root. Roots pinned by hash are looked up in
+// chain, then in the root bundle of the CA, since some CAs do not include the root in the chain.
+func (c *pinnedRootClient) verify(ctx context.Context, chain []string) error {
+	certs, err := parseChain(chain)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("CA returned an empty certificate chain")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	err = c.verifyLeaf(certs[0], intermediates, certs[1:])
+	if err == nil || len(c.hashes) == 0 {
+		return err
+	}
+	bundle, bundleErr := c.Client.GetRootCertBundle(ctx)
+	if bundleErr != nil {
+		return fmt.Errorf("%v; failed to get root bundle of CA: %v", err, bundleErr)
+	}
+	bundleCerts, bundleErr := parseChain(bundle)
+	if bundleErr != nil {
+		return fmt.Errorf("%v; invalid root bundle of CA: %v", err, bundleErr)
+	}
+	return c.verifyLeaf(certs[0], intermediates, bundleCerts)
+}
+
+// verifyLeaf verifies leaf against the pinned roots, and the candidates whose public key is pinned.
+func (c *pinnedRootClient) verifyLeaf(leaf *x509.Certificate, intermediates *x509.CertPool, candidates []*x509.Certificate) error {
+	roots := x509.NewCertPool()
+	for _, root := range c.roots {
+		roots.AddCert(root)
+	}
+	for _, cert := range candidates {
+		if c.hashes[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+			roots.AddCert(cert)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate chain from CA does not chain to a pinned root: %v", err)
+	}
+	return nil
+}
+
+// readRoots reads the PEM encoded certificates in file.
+func readRoots(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := parseChain([]string{string(data)})
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return roots, nil
+}
+
+// parseChain parses the PEM encoded certificates in chain, where each element may hold several
+// certificates.
+func parseChain(chain []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, element := range chain {
+		rest := []byte(element)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,206 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testCA struct {
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCA(t *testing.T, org string) testCA {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org:          org,
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{certPEM: certPEM, keyPEM: keyPEM}
+}
+
+func (ca testCA) pin(t *testing.T) string {
+	t.Helper()
+	cert, err := util.ParsePemEncodedCertificate(ca.certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinHashPrefix + hex.EncodeToString(h[:])
+}
+
+func (ca testCA) issue(t *testing.T) string {
+	t.Helper()
+	signer, err := util.ParsePemEncodedCertificate(ca.certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(ca.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       "spiffe://cluster.local/ns/foo/sa/bar",
+		SignerCert: signer,
+		SignerPriv: key,
+		TTL:        time.Hour,
+		ECSigAlg:   util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(certPEM)
+}
+
+// fakeCAClient returns a fixed chain and root bundle.
+type fakeCAClient struct {
+	chain  []string
+	bundle []string
+}
+
+func (f *fakeCAClient) CSRSign(context.Context, []byte, int64) ([]string, error) {
+	return f.chain, nil
+}
+
+func (f *fakeCAClient) GetRootCertBundle(context.Context) ([]string, error) {
+	return f.bundle, nil
+}
+
+func (f *fakeCAClient) Close() {}
+
+func TestPinnedRootClient(t *testing.T) {
+	pinned := newTestCA(t, "pinned")
+	other := newTestCA(t, "other")
+	rootFile := filepath.Join(t.TempDir(), "root-cert.pem")
+	if err := os.WriteFile(rootFile, pinned.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		pins    []string
+		client  *fakeCAClient
+		wantErr bool
+	}{
+		{
+			name:   "hash pin, root in chain",
+			pins:   []string{pinned.pin(t)},
+			client: &fakeCAClient{chain: []string{pinned.issue(t), string(pinned.certPEM)}},
+		},
+		{
+			name:   "hash pin, root in bundle",
+			pins:   []string{pinned.pin(t)},
+			client: &fakeCAClient{chain: []string{pinned.issue(t)}, bundle: []string{string(pinned.certPEM)}},
+		},
+		{
+			name:   "file pin, root not returned",
+			pins:   []string{rootFile},
+			client: &fakeCAClient{chain: []string{pinned.issue(t)}},
+		},
+		{
+			name:   "one of several pins",
+			pins:   []string{other.pin(t), rootFile},
+			client: &fakeCAClient{chain: []string{pinned.issue(t)}},
+		},
+		{
+			name:    "hash pin, different hierarchy",
+			pins:    []string{pinned.pin(t)},
+			client:  &fakeCAClient{chain: []string{other.issue(t), string(other.certPEM)}, bundle: []string{string(other.certPEM)}},
+			wantErr: true,
+		},
+		{
+			name: "hash pin, pinned root in bundle but chain from different hierarchy",
+			pins: []string{pinned.pin(t)},
+			client: &fakeCAClient{
+				chain:  []string{other.issue(t), string(other.certPEM)},
+				bundle: []string{string(pinned.certPEM)},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "file pin, different hierarchy",
+			pins:    []string{rootFile},
+			client:  &fakeCAClient{chain: []string{other.issue(t), string(other.certPEM)}},
+			wantErr: true,
+		},
+		{
+			name:    "empty chain",
+			pins:    []string{rootFile},
+			client:  &fakeCAClient{},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewPinnedRootClient(tc.client, tc.pins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain, err := client.CSRSign(context.Background(), nil, 3600)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected chain %v to be rejected", chain)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != len(tc.client.chain) {
+				t.Fatalf("expected the chain of the CA, got %v", chain)
+			}
+		})
+	}
+}
+
+func TestNewPinnedRootClientInvalidPins(t *testing.T) {
+	for name, pins := range map[string][]string{
+		"no pins":        {" "},
+		"short hash":     {"sha256:abcd"},
+		"invalid hex":    {"sha256:" + string(make([]byte, 64))},
+		"missing file":   {filepath.Join(t.TempDir(), "missing.pem")},
+		"not a pem file": {writeFile(t, "not a certificate")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewPinnedRootClient(&fakeCAClient{}, pins); err == nil {
+				t.Fatalf("expected pins %v to be rejected", pins)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	f := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(f, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,210 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var acmeClientLog = log.RegisterScope("acme", "ACME CA client debugging", 0)
+
+var (
+	eabKeyIDEnv = env.RegisterStringVar("ACME_EAB_KEY_ID", "",
+		"The key identifier of the external account binding the agent registers its ACME account with.").Get()
+	eabHMACKeyFileEnv = env.RegisterStringVar("ACME_EAB_HMAC_KEY_FILE", "",
+		"The file holding the base64url encoded HMAC key of the external account binding.").Get()
+	rootCertFileEnv = env.RegisterStringVar("ACME_ROOT_CERT_FILE", "",
+		"The PEM file of the root certificates of the ACME CA, required as ACME servers do not return them.").Get()
+)
+
+// permanentIdentifierType is the ACME identifier type of the URI SANs of workload CSRs, as defined
+// by the device attestation extension of ACME (draft-acme-device-attest). The device-attest-01
+// challenge of that extension is not implemented: the identifiers must be pre-authorized.
+const permanentIdentifierType = "permanent-identifier"
+
+// Config configures an ACME CA client.
+type Config struct {
+	// DirectoryURL is the URL of the ACME directory of the CA.
+	DirectoryURL string
+	// RootCertFile is the PEM file of the root certificates of the CA. It is required, as the chains
+	// returned by ACME servers end at the issuing intermediate rather than at the root.
+	RootCertFile string
+	// EAB binds the ACME account of the agent to an account of the CA, if not nil. The CA must
+	// authorize the account for the identifiers of the workloads, typically through this binding.
+	EAB *acme.ExternalAccountBinding
+}
+
+// ConfigFromEnv returns the configuration of an ACME CA client for the directory at directoryURL,
+// with the root certificates of ACME_ROOT_CERT_FILE and the external account binding taken from the
+// ACME_EAB_* environment variables.
+func ConfigFromEnv(directoryURL string) (Config, error) {
+	config := Config{DirectoryURL: directoryURL, RootCertFile: rootCertFileEnv}
+	if eabKeyIDEnv == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(eabHMACKeyFileEnv)
+	if err != nil {
+		return config, fmt.Errorf("failed to read external account binding key: %v", err)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(string(data)), "="))
+	if err != nil {
+		return config, fmt.Errorf("invalid external account binding key in %s: %v", eabHMACKeyFileEnv, err)
+	}
+	config.EAB = &acme.ExternalAccountBinding{KID: eabKeyIDEnv, Key: key}
+	return config, nil
+}
+
+// ACMEClient orders workload certificates from an RFC 8555 ACME server, such as step-ca or Boulder.
+// The client fulfills no challenge: HTTP-01 and TLS-ALPN-01 cannot reach the workloads, the agent
+// does not control the DNS zones dns-01 needs, and device-attest-01 is not implemented. The ACME
+// account must therefore be pre-authorized by the CA for the identifiers of the workloads, e.g.
+// through its external account binding, or orders fail.
+type ACMEClient struct {
+	config Config
+	client *acme.Client
+
+	// registerMu serializes the registration of the account, done on the first CSR.
+	registerMu sync.Mutex
+	registered bool
+}
+
+// NewACMEClient creates a CA client for the ACME server of config. The account key is generated for
+// the lifetime of the client.
+func NewACMEClient(config Config) (*ACMEClient, error) {
+	if config.DirectoryURL == "" {
+		return nil, errors.New("ACME directory URL is not set")
+	}
+	if config.RootCertFile == "" {
+		return nil, errors.New("ACME root certificate file is not set")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %v", err)
+	}
+	acmeClientLog.Debugf("initialized ACME client for %s", config.DirectoryURL)
+	return &ACMEClient{
+		config: config,
+		client: &acme.Client{Key: key, DirectoryURL: config.DirectoryURL, UserAgent: "istio-agent"},
+	}, nil
+}
+
+// CSRSign orders a certificate for the SANs of csrPEM valid for certValidTTLInSec. The authorizations
+// of the order must already be valid.
+func (c *ACMEClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %v", err)
+	}
+	var ids []acme.AuthzID
+	for _, name := range csr.DNSNames {
+		ids = append(ids, acme.AuthzID{Type: "dns", Value: name})
+	}
+	for _, ip := range csr.IPAddresses {
+		ids = append(ids, acme.AuthzID{Type: "ip", Value: ip.String()})
+	}
+	for _, uri := range csr.URIs {
+		ids = append(ids, acme.AuthzID{Type: permanentIdentifierType, Value: uri.String()})
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("CSR has no subject alternative names to order a certificate for")
+	}
+	if err := c.register(ctx); err != nil {
+		return nil, err
+	}
+
+	order, err := c.client.AuthorizeOrder(ctx, ids,
+		acme.WithOrderNotAfter(time.Now().Add(time.Duration(certValidTTLInSec)*time.Second)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME order: %v", err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := c.checkAuthorization(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := c.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("ACME order %s is not ready: %v", order.URI, err)
+	}
+	der, _, err := c.client.CreateOrderCert(ctx, order.FinalizeURL, csr.Raw, true)
+	if err != nil {
+		acmeClientLog.Errorf("failed to finalize ACME order %s: %v", order.URI, err)
+		return nil, err
+	}
+	chain := make([]string, 0, len(der))
+	for _, cert := range der {
+		chain = append(chain, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})))
+	}
+	return chain, nil
+}
+
+// GetRootCertBundle returns the root certificates of RootCertFile, read on each call so that they can
+// be rotated. ACME has no API for them.
+func (c *ACMEClient) GetRootCertBundle(context.Context) ([]string, error) {
+	data, err := os.ReadFile(c.config.RootCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME root certificates: %v", err)
+	}
+	if _, err := util.ParsePemEncodedCertificateChain(data); err != nil {
+		return nil, fmt.Errorf("invalid ACME root certificates in %s: %v", c.config.RootCertFile, err)
+	}
+	return []string{string(data)}, nil
+}
+
+func (c *ACMEClient) Close() {}
+
+func (c *ACMEClient) register(ctx context.Context) error {
+	c.registerMu.Lock()
+	defer c.registerMu.Unlock()
+	if c.registered {
+		return nil
+	}
+	account := &acme.Account{ExternalAccountBinding: c.config.EAB}
+	if _, err := c.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register ACME account: %v", err)
+	}
+	c.registered = true
+	return nil
+}
+
+// checkAuthorization returns an error unless the authorization at url is valid, as the client
+// fulfills no challenge.
+func (c *ACMEClient) checkAuthorization(ctx context.Context, url string) error {
+	authz, err := c.client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get ACME authorization %s: %v", url, err)
+	}
+	if authz.Status != acme.StatusValid {
+		return fmt.Errorf("ACME authorization of %s %s is %s: the account must be pre-authorized for it, e.g. through an external account binding",
+			authz.Identifier.Type, authz.Identifier.Value, authz.Status)
+	}
+	return nil
+}
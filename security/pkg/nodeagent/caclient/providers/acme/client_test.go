@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// fakeACME is an ACME server ordering certificates for a DNS name and a SPIFFE ID, pre-authorized
+// for the accounts with an external account binding. Request signatures are not verified.
+type fakeACME struct {
+	url   string
+	chain string
+
+	mu          sync.Mutex
+	accounts    int
+	bound       bool
+	identifiers []acme.AuthzID
+}
+
+func (f *fakeACME) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	if r.Method == http.MethodHead {
+		return
+	}
+	authzStatus := "pending"
+	if f.bound {
+		authzStatus = "valid"
+	}
+	order := map[string]interface{}{
+		"status":         "ready",
+		"authorizations": []string{f.url + "/authz/dns", f.url + "/authz/spiffe"},
+		"finalize":       f.url + "/finalize",
+	}
+	var resp interface{}
+	switch r.URL.Path {
+	case "/directory":
+		resp = map[string]string{
+			"newNonce":   f.url + "/nonce",
+			"newAccount": f.url + "/account",
+			"newOrder":   f.url + "/order",
+		}
+	case "/account":
+		var jws struct{ Payload string }
+		_ = json.NewDecoder(r.Body).Decode(&jws)
+		var req struct{ ExternalAccountBinding json.RawMessage }
+		_ = json.Unmarshal(decodeB64(jws.Payload), &req)
+		f.accounts++
+		f.bound = req.ExternalAccountBinding != nil
+		w.Header().Set("Location", f.url+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		resp = map[string]string{"status": "valid"}
+	case "/order":
+		var jws struct{ Payload string }
+		_ = json.NewDecoder(r.Body).Decode(&jws)
+		var req struct{ Identifiers []acme.AuthzID }
+		_ = json.Unmarshal(decodeB64(jws.Payload), &req)
+		f.identifiers = req.Identifiers
+		w.Header().Set("Location", f.url+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		order["status"] = "pending"
+		resp = order
+	case "/order/1":
+		resp = order
+	case "/authz/dns":
+		resp = map[string]interface{}{
+			"status":     authzStatus,
+			"identifier": map[string]string{"type": "dns", "value": "example.com"},
+			"challenges": []map[string]string{
+				{"type": "http-01", "url": f.url + "/challenge/http", "token": "token", "status": "pending"},
+			},
+		}
+	case "/authz/spiffe":
+		resp = map[string]interface{}{
+			"status":     authzStatus,
+			"identifier": map[string]string{"type": permanentIdentifierType, "value": "spiffe://cluster.local/ns/foo/sa/bar"},
+		}
+	case "/finalize":
+		order["status"] = "valid"
+		order["certificate"] = f.url + "/certificate"
+		resp = order
+	case "/certificate":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write([]byte(f.chain))
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func decodeB64(s string) []byte {
+	b, _ := base64.RawURLEncoding.DecodeString(s)
+	return b
+}
+
+func testChain(t *testing.T) string {
+	t.Helper()
+	cert, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host: "spiffe://cluster.local/ns/foo/sa/bar", IsSelfSigned: true, TTL: time.Hour, RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(cert)
+}
+
+func TestCSRSign(t *testing.T) {
+	fake := &fakeACME{chain: testChain(t)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.url = server.URL
+
+	csr, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar,example.com", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootFile := filepath.Join(t.TempDir(), "root-cert.pem")
+	if err := os.WriteFile(rootFile, []byte(fake.chain), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewACMEClient(Config{DirectoryURL: server.URL + "/directory"}); err == nil {
+		t.Fatal("expected an error without root certificates")
+	}
+
+	// Without an external account binding, the account is not pre-authorized and no challenge is fulfilled.
+	client, err := NewACMEClient(Config{DirectoryURL: server.URL + "/directory", RootCertFile: rootFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CSRSign(context.Background(), csr, 3600); err == nil || !strings.Contains(err.Error(), "pre-authorized") {
+		t.Fatalf("expected the pending authorization to fail, got %v", err)
+	}
+
+	client, err = NewACMEClient(Config{
+		DirectoryURL: server.URL + "/directory",
+		RootCertFile: rootFile,
+		EAB:          &acme.ExternalAccountBinding{KID: "kid", Key: []byte("hmac-key")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		chain, err := client.CSRSign(context.Background(), csr, 3600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{fake.chain}; !reflect.DeepEqual(chain, want) {
+			t.Fatalf("got chain %v, want %v", chain, want)
+		}
+	}
+	if fake.accounts != 2 {
+		t.Fatalf("expected each client to register its account once, got %d registrations", fake.accounts)
+	}
+	if roots, err := client.GetRootCertBundle(context.Background()); err != nil || !reflect.DeepEqual(roots, []string{fake.chain}) {
+		t.Fatalf("got roots %v, %v, want the root certificate file", roots, err)
+	}
+	want := []acme.AuthzID{{Type: "dns", Value: "example.com"}, {Type: permanentIdentifierType, Value: "spiffe://cluster.local/ns/foo/sa/bar"}}
+	if !reflect.DeepEqual(fake.identifiers, want) {
+		t.Fatalf("got identifiers %v, want %v", fake.identifiers, want)
+	}
+}
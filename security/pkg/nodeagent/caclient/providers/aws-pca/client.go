@@ -0,0 +1,168 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acmpca"
+	"github.com/aws/aws-sdk-go/service/acmpca/acmpcaiface"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var awsPCAClientLog = log.RegisterScope("awspca", "AWS Private CA client debugging", 0)
+
+var (
+	templateARNEnv = env.RegisterStringVar("AWS_PCA_TEMPLATE_ARN", "",
+		"The ARN of the AWS Private CA certificate template workload certificates are issued with. "+
+			"Defaults to the end entity template, which copies the SANs of the CSR.").Get()
+	signingAlgorithmEnv = env.RegisterStringVar("AWS_PCA_SIGNING_ALGORITHM", "",
+		"The algorithm AWS Private CA signs workload certificates with, e.g. SHA256WITHECDSA. "+
+			"Defaults to the signing algorithm of the CA.").Get()
+)
+
+// idempotencyTokenLength is the maximum length of the idempotency token of IssueCertificate.
+const idempotencyTokenLength = 36
+
+// AWSPCAClient signs workload CSRs with AWS Certificate Manager Private Certificate Authority. The
+// AWS credentials are taken from the default credential chain, which includes the web identity
+// token of IAM roles for service accounts (IRSA).
+type AWSPCAClient struct {
+	caARN  string
+	client acmpcaiface.ACMPCAAPI
+
+	// signingAlgorithmMu protects signingAlgorithm, the configured or discovered algorithm of the CA.
+	signingAlgorithmMu sync.Mutex
+	signingAlgorithm   string
+}
+
+// NewAWSPCAClient creates a CA client for the AWS Private CA with the ARN caARN, in the region of
+// the ARN.
+func NewAWSPCAClient(caARN string) (*AWSPCAClient, error) {
+	parsed, err := arn.Parse(caARN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWS Private CA ARN %q: %v", caARN, err)
+	}
+	sess, err := session.NewSession(aws.NewConfig().WithRegion(parsed.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+	awsPCAClientLog.Debugf("initialized AWS Private CA client for %s", caARN)
+	return newAWSPCAClient(caARN, acmpca.New(sess)), nil
+}
+
+func newAWSPCAClient(caARN string, client acmpcaiface.ACMPCAAPI) *AWSPCAClient {
+	return &AWSPCAClient{
+		caARN:            caARN,
+		client:           client,
+		signingAlgorithm: signingAlgorithmEnv,
+	}
+}
+
+// CSRSign issues a certificate for csrPEM valid for certValidTTLInSec, and waits for it to be issued.
+func (c *AWSPCAClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	alg, err := c.getSigningAlgorithm(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Retries of the same CSR return the same certificate instead of issuing a new one.
+	sum := sha256.Sum256(csrPEM)
+	input := &acmpca.IssueCertificateInput{
+		CertificateAuthorityArn: aws.String(c.caARN),
+		Csr:                     csrPEM,
+		SigningAlgorithm:        aws.String(alg),
+		IdempotencyToken:        aws.String(hex.EncodeToString(sum[:])[:idempotencyTokenLength]),
+		Validity: &acmpca.Validity{
+			Type:  aws.String(acmpca.ValidityPeriodTypeAbsolute),
+			Value: aws.Int64(time.Now().Add(time.Duration(certValidTTLInSec) * time.Second).Unix()),
+		},
+	}
+	if templateARNEnv != "" {
+		input.TemplateArn = aws.String(templateARNEnv)
+	}
+	issued, err := c.client.IssueCertificateWithContext(ctx, input)
+	if err != nil {
+		awsPCAClientLog.Errorf("failed to issue certificate: %v", err)
+		return nil, err
+	}
+	get := &acmpca.GetCertificateInput{
+		CertificateArn:          issued.CertificateArn,
+		CertificateAuthorityArn: aws.String(c.caARN),
+	}
+	if err := c.client.WaitUntilCertificateIssuedWithContext(ctx, get); err != nil {
+		return nil, fmt.Errorf("failed waiting for certificate %s: %v", aws.StringValue(issued.CertificateArn), err)
+	}
+	resp, err := c.client.GetCertificateWithContext(ctx, get)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate %s: %v", aws.StringValue(issued.CertificateArn), err)
+	}
+	chain := []string{aws.StringValue(resp.Certificate)}
+	chain = append(chain, util.SplitCertificates([]byte(aws.StringValue(resp.CertificateChain)))...)
+	return chain, nil
+}
+
+// GetRootCertBundle returns the root of the hierarchy of the CA.
+func (c *AWSPCAClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
+	resp, err := c.client.GetCertificateAuthorityCertificateWithContext(ctx, &acmpca.GetCertificateAuthorityCertificateInput{
+		CertificateAuthorityArn: aws.String(c.caARN),
+	})
+	if err != nil {
+		awsPCAClientLog.Errorf("failed to get certificate of CA %s: %v", c.caARN, err)
+		return nil, err
+	}
+	// The chain of a subordinate CA ends with the root. A root CA has no chain.
+	if chain := util.SplitCertificates([]byte(aws.StringValue(resp.CertificateChain))); len(chain) > 0 {
+		return chain[len(chain)-1:], nil
+	}
+	if resp.Certificate == nil {
+		return nil, errors.New("no certificate returned for the CA")
+	}
+	return []string{aws.StringValue(resp.Certificate)}, nil
+}
+
+func (c *AWSPCAClient) Close() {}
+
+// getSigningAlgorithm returns the signing algorithm of the CA, describing the CA the first time if
+// none is configured.
+func (c *AWSPCAClient) getSigningAlgorithm(ctx context.Context) (string, error) {
+	c.signingAlgorithmMu.Lock()
+	defer c.signingAlgorithmMu.Unlock()
+	if c.signingAlgorithm != "" {
+		return c.signingAlgorithm, nil
+	}
+	resp, err := c.client.DescribeCertificateAuthorityWithContext(ctx, &acmpca.DescribeCertificateAuthorityInput{
+		CertificateAuthorityArn: aws.String(c.caARN),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe CA %s: %v", c.caARN, err)
+	}
+	if resp.CertificateAuthority == nil || resp.CertificateAuthority.CertificateAuthorityConfiguration == nil {
+		return "", fmt.Errorf("CA %s has no configuration", c.caARN)
+	}
+	c.signingAlgorithm = aws.StringValue(resp.CertificateAuthority.CertificateAuthorityConfiguration.SigningAlgorithm)
+	return c.signingAlgorithm, nil
+}
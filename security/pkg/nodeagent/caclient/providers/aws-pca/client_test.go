@@ -0,0 +1,139 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/acmpca"
+	"github.com/aws/aws-sdk-go/service/acmpca/acmpcaiface"
+)
+
+const (
+	testCAARN = "arn:aws:acm-pca:us-west-2:123456789012:certificate-authority/ca"
+
+	testLeaf = `-----BEGIN CERTIFICATE-----
+bGVhZg==
+-----END CERTIFICATE-----
+`
+	testIntermediate = `-----BEGIN CERTIFICATE-----
+aW50ZXJtZWRpYXRl
+-----END CERTIFICATE-----
+`
+	testRoot = `-----BEGIN CERTIFICATE-----
+cm9vdA==
+-----END CERTIFICATE-----
+`
+)
+
+type fakePCA struct {
+	acmpcaiface.ACMPCAAPI
+
+	describes int
+	issued    []*acmpca.IssueCertificateInput
+	waited    bool
+}
+
+func (f *fakePCA) DescribeCertificateAuthorityWithContext(aws.Context, *acmpca.DescribeCertificateAuthorityInput,
+	...request.Option) (*acmpca.DescribeCertificateAuthorityOutput, error) {
+	f.describes++
+	return &acmpca.DescribeCertificateAuthorityOutput{CertificateAuthority: &acmpca.CertificateAuthority{
+		CertificateAuthorityConfiguration: &acmpca.CertificateAuthorityConfiguration{
+			SigningAlgorithm: aws.String(acmpca.SigningAlgorithmSha256withecdsa),
+		},
+	}}, nil
+}
+
+func (f *fakePCA) IssueCertificateWithContext(_ aws.Context, input *acmpca.IssueCertificateInput,
+	_ ...request.Option) (*acmpca.IssueCertificateOutput, error) {
+	f.issued = append(f.issued, input)
+	return &acmpca.IssueCertificateOutput{CertificateArn: aws.String(testCAARN + "/certificate/leaf")}, nil
+}
+
+func (f *fakePCA) WaitUntilCertificateIssuedWithContext(aws.Context, *acmpca.GetCertificateInput, ...request.WaiterOption) error {
+	f.waited = true
+	return nil
+}
+
+func (f *fakePCA) GetCertificateWithContext(aws.Context, *acmpca.GetCertificateInput,
+	...request.Option) (*acmpca.GetCertificateOutput, error) {
+	return &acmpca.GetCertificateOutput{
+		Certificate:      aws.String(testLeaf),
+		CertificateChain: aws.String(testIntermediate + testRoot),
+	}, nil
+}
+
+func (f *fakePCA) GetCertificateAuthorityCertificateWithContext(aws.Context, *acmpca.GetCertificateAuthorityCertificateInput,
+	...request.Option) (*acmpca.GetCertificateAuthorityCertificateOutput, error) {
+	return &acmpca.GetCertificateAuthorityCertificateOutput{
+		Certificate:      aws.String(testIntermediate),
+		CertificateChain: aws.String(testRoot),
+	}, nil
+}
+
+func TestCSRSign(t *testing.T) {
+	pca := &fakePCA{}
+	client := newAWSPCAClient(testCAARN, pca)
+	for i := 0; i < 2; i++ {
+		chain, err := client.CSRSign(context.Background(), []byte("csr"), 3600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{testLeaf, testIntermediate, testRoot}; !reflect.DeepEqual(chain, want) {
+			t.Fatalf("got chain %v, want %v", chain, want)
+		}
+	}
+	if pca.describes != 1 {
+		t.Fatalf("expected the signing algorithm to be described once, got %d", pca.describes)
+	}
+	if !pca.waited {
+		t.Fatal("expected to wait for the certificate to be issued")
+	}
+	input := pca.issued[0]
+	if aws.StringValue(input.SigningAlgorithm) != acmpca.SigningAlgorithmSha256withecdsa {
+		t.Fatalf("unexpected signing algorithm %v", aws.StringValue(input.SigningAlgorithm))
+	}
+	if len(aws.StringValue(input.IdempotencyToken)) != idempotencyTokenLength ||
+		aws.StringValue(input.IdempotencyToken) != aws.StringValue(pca.issued[1].IdempotencyToken) {
+		t.Fatalf("expected the same idempotency token for the same CSR, got %v and %v",
+			aws.StringValue(input.IdempotencyToken), aws.StringValue(pca.issued[1].IdempotencyToken))
+	}
+	expiry := time.Unix(aws.Int64Value(input.Validity.Value), 0)
+	if d := time.Until(expiry); d <= 59*time.Minute || d > time.Hour {
+		t.Fatalf("unexpected validity %v", expiry)
+	}
+}
+
+func TestGetRootCertBundle(t *testing.T) {
+	client := newAWSPCAClient(testCAARN, &fakePCA{})
+	roots, err := client.GetRootCertBundle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testRoot}; !reflect.DeepEqual(roots, want) {
+		t.Fatalf("got roots %v, want %v", roots, want)
+	}
+}
+
+func TestNewAWSPCAClient(t *testing.T) {
+	if _, err := NewAWSPCAClient("ca"); err == nil {
+		t.Fatal("expected an invalid ARN to be rejected")
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var cfsslClientLog = log.RegisterScope("cfssl", "CFSSL CA client debugging", 0)
+
+var (
+	profileEnv = env.RegisterStringVar("CFSSL_PROFILE", "",
+		"The CFSSL signing profile workload certificates are signed with. If empty, the default profile is used.").Get()
+	labelEnv = env.RegisterStringVar("CFSSL_LABEL", "",
+		"The label of the CFSSL signer, for multi-root CFSSL servers.").Get()
+	authKeyFileEnv = env.RegisterStringVar("CFSSL_AUTH_KEY_FILE", "",
+		"The file holding the hex encoded auth key of the CFSSL profile. If set, CSRs are sent to the "+
+			"authenticated signing endpoint, with an HMAC-SHA256 of the request as token.").Get()
+	caCertFileEnv = env.RegisterStringVar("CFSSL_CACERT", "",
+		"The PEM file of the root certificates of the CFSSL server. If empty, the system roots are used.").Get()
+)
+
+const (
+	// maxResponseSize bounds the responses read from CFSSL.
+	maxResponseSize = 1 << 20
+	requestTimeout  = 30 * time.Second
+)
+
+// Config configures a CFSSL CA client.
+type Config struct {
+	// Address is the URL of the CFSSL server. An address without scheme uses HTTPS.
+	Address string
+	// Profile is the signing profile. It decides the validity of the certificates.
+	Profile string
+	// Label selects the signer of multi-root CFSSL servers.
+	Label string
+	// AuthKeyFile holds the hex encoded auth key of the profile. It is read on every request, so that
+	// the key can be rotated.
+	AuthKeyFile string
+	// CACertFile holds the root certificates of the CFSSL server, if not signed by the system roots.
+	CACertFile string
+}
+
+// ConfigFromOptions returns the configuration of a CFSSL CA client for an agent configured with
+// options, with the CFSSL specific settings taken from the CFSSL_* environment variables.
+func ConfigFromOptions(options *security.Options) Config {
+	return Config{
+		Address:     options.CAEndpoint,
+		Profile:     profileEnv,
+		Label:       labelEnv,
+		AuthKeyFile: authKeyFileEnv,
+		CACertFile:  caCertFileEnv,
+	}
+}
+
+// CFSSLClient signs workload CSRs with the remote signing API of a CFSSL server.
+type CFSSLClient struct {
+	config Config
+	client *http.Client
+}
+
+// NewCFSSLClient creates a CA client for a CFSSL server.
+func NewCFSSLClient(config Config) (*CFSSLClient, error) {
+	if config.Address == "" {
+		return nil, errors.New("cfssl address is not set")
+	}
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "https://" + config.Address
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACertFile != "" {
+		roots, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CFSSL root certificates %s: %v", config.CACertFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(roots) {
+			return nil, fmt.Errorf("no certificates found in CFSSL root certificates %s", config.CACertFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	cfsslClientLog.Debugf("initialized CFSSL client for %s, profile %q", config.Address, config.Profile)
+	return &CFSSLClient{
+		config: config,
+		client: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+// signRequest is the body of CFSSL sign requests.
+type signRequest struct {
+	CertificateRequest string `json:"certificate_request"`
+	Profile            string `json:"profile,omitempty"`
+	Label              string `json:"label,omitempty"`
+}
+
+// authenticatedRequest wraps requests to the authenticated endpoints of CFSSL.
+type authenticatedRequest struct {
+	// Token is the HMAC-SHA256 of Request with the auth key.
+	Token   []byte `json:"token"`
+	Request []byte `json:"request"`
+}
+
+// response is the envelope of CFSSL API responses.
+type response struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// CSRSign signs csrPEM with the profile of the client. The TTL is decided by the profile. The chain
+// ends with the certificate of the signer.
+func (c *CFSSLClient) CSRSign(ctx context.Context, csrPEM []byte, _ int64) ([]string, error) {
+	var result struct {
+		Certificate string `json:"certificate"`
+	}
+	req := signRequest{CertificateRequest: string(csrPEM), Profile: c.config.Profile, Label: c.config.Label}
+	if err := c.call(ctx, "sign", req, c.config.AuthKeyFile != "", &result); err != nil {
+		cfsslClientLog.Errorf("failed to sign CSR: %v", err)
+		return nil, err
+	}
+	chain := util.SplitCertificates([]byte(result.Certificate))
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate in the CFSSL response")
+	}
+	signer, err := c.signerCertificate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(chain, signer...), nil
+}
+
+// GetRootCertBundle returns the certificate of the signer.
+func (c *CFSSLClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
+	return c.signerCertificate(ctx)
+}
+
+func (c *CFSSLClient) Close() {}
+
+func (c *CFSSLClient) signerCertificate(ctx context.Context) ([]string, error) {
+	var result struct {
+		Certificate string `json:"certificate"`
+	}
+	req := map[string]string{"profile": c.config.Profile, "label": c.config.Label}
+	if err := c.call(ctx, "info", req, false, &result); err != nil {
+		return nil, fmt.Errorf("failed to get the CFSSL signer certificate: %v", err)
+	}
+	certs := util.SplitCertificates([]byte(result.Certificate))
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate in the CFSSL info response")
+	}
+	return certs, nil
+}
+
+// call sends req to the CFSSL endpoint, or its authenticated variant, and decodes its result into out.
+func (c *CFSSLClient) call(ctx context.Context, endpoint string, req interface{}, authenticate bool, out interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if authenticate {
+		endpoint = "auth" + endpoint
+		if body, err = c.authenticate(body); err != nil {
+			return err
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Address+"/api/v1/cfssl/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	var r response
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("invalid CFSSL response with status %d: %v", resp.StatusCode, err)
+	}
+	if !r.Success {
+		if len(r.Errors) > 0 {
+			return fmt.Errorf("cfssl error %d: %s", r.Errors[0].Code, r.Errors[0].Message)
+		}
+		return fmt.Errorf("cfssl request failed with status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(r.Result, out)
+}
+
+// authenticate wraps body in an authenticated request, with the auth key of the profile.
+func (c *CFSSLClient) authenticate(body []byte) ([]byte, error) {
+	data, err := os.ReadFile(c.config.AuthKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CFSSL auth key: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CFSSL auth key, expected hex: %v", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return json.Marshal(authenticatedRequest{Token: mac.Sum(nil), Request: body})
+}
@@ -0,0 +1,126 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testLeaf = `-----BEGIN CERTIFICATE-----
+bGVhZg==
+-----END CERTIFICATE-----
+`
+	testRoot = `-----BEGIN CERTIFICATE-----
+cm9vdA==
+-----END CERTIFICATE-----
+`
+)
+
+var testAuthKey = []byte("0123456789abcdef")
+
+func writeResponse(w http.ResponseWriter, result interface{}, errMessage string) {
+	resp := map[string]interface{}{"success": errMessage == "", "result": result, "errors": []interface{}{}}
+	if errMessage != "" {
+		resp["errors"] = []interface{}{map[string]interface{}{"code": 1000, "message": errMessage}}
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// fakeCFSSL serves the sign, authsign and info endpoints of a CFSSL server with the workloads profile.
+func fakeCFSSL(t *testing.T) *httptest.Server {
+	sign := func(w http.ResponseWriter, body []byte) {
+		var req signRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.CertificateRequest != "csr" || req.Profile != "workloads" {
+			writeResponse(w, nil, "invalid sign request")
+			return
+		}
+		writeResponse(w, map[string]string{"certificate": testLeaf}, "")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/cfssl/sign", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, nil, "profile requires authentication")
+	})
+	mux.HandleFunc("/api/v1/cfssl/authsign", func(w http.ResponseWriter, r *http.Request) {
+		var req authenticatedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mac := hmac.New(sha256.New, testAuthKey)
+		mac.Write(req.Request)
+		if !hmac.Equal(mac.Sum(nil), req.Token) {
+			writeResponse(w, nil, "invalid token")
+			return
+		}
+		sign(w, req.Request)
+	})
+	mux.HandleFunc("/api/v1/cfssl/info", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, map[string]string{"certificate": testRoot}, "")
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestClient(t *testing.T, url string, authKey []byte) *CFSSLClient {
+	t.Helper()
+	config := Config{Address: url, Profile: "workloads"}
+	if authKey != nil {
+		config.AuthKeyFile = filepath.Join(t.TempDir(), "auth-key")
+		if err := os.WriteFile(config.AuthKeyFile, []byte(hex.EncodeToString(authKey)+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, err := NewCFSSLClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCSRSign(t *testing.T) {
+	server := fakeCFSSL(t)
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, testAuthKey)
+	chain, err := client.CSRSign(context.Background(), []byte("csr"), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(chain, []string{testLeaf, testRoot}) {
+		t.Errorf("unexpected chain %v", chain)
+	}
+	roots, err := client.GetRootCertBundle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roots, []string{testRoot}) {
+		t.Errorf("unexpected roots %v", roots)
+	}
+
+	if _, err := newTestClient(t, server.URL, []byte("wrong key")).CSRSign(context.Background(), []byte("csr"), 3600); err == nil {
+		t.Error("expected a wrong auth key to be rejected")
+	}
+	if _, err := newTestClient(t, server.URL, nil).CSRSign(context.Background(), []byte("csr"), 3600); err == nil {
+		t.Error("expected unauthenticated requests to be rejected")
+	}
+}
@@ -15,31 +15,51 @@
 package caclient
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gogo/protobuf/types"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	ghc "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	pb "istio.io/api/security/v1alpha1"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/nodeagent/caclient"
+	"istio.io/istio/security/pkg/nodeagent/filewatch"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/proto/jwtsvid"
 	"istio.io/pkg/log"
 )
 
 const (
 	bearerTokenPrefix = "Bearer "
+
+	// provCertWatchRetryInterval is how often a provisioning certificate that cannot be watched, such
+	// as one that is not provisioned yet, is tried again.
+	provCertWatchRetryInterval = 5 * time.Second
+	// connDrainPeriod is how long a replaced connection to the CA is kept open, so that the requests
+	// in flight on it complete.
+	connDrainPeriod = time.Minute
 )
 
 var citadelClientLog = log.RegisterScope("citadelclient", "citadel client debugging", 0)
@@ -47,21 +67,42 @@ var citadelClientLog = log.RegisterScope("citadelclient", "citadel client debugg
 type CitadelClient struct {
 	enableTLS     bool
 	caTLSRootCert []byte
-	client        pb.IstioCertificateServiceClient
-	conn          *grpc.ClientConn
-	provider      *caclient.TokenProvider
-	opts          *security.Options
-	usingMtls     *atomic.Bool
+	// caTLSRootCertFile is the file caTLSRootCert was loaded from, if any.
+	caTLSRootCertFile string
+	provider          *caclient.TokenProvider
+	opts              *security.Options
+	usingMtls         *atomic.Bool
+	// unknownAuthority is set when a TLS handshake fails because the certificate of the CA is not
+	// signed by caTLSRootCert, typically because the roots were rotated.
+	unknownAuthority *atomic.Bool
+
+	// connMu protects conn and client. A single connection is shared by CSR signing, root bundle
+	// fetches and health probes, so that only one TLS handshake is done with the CA.
+	connMu sync.RWMutex
+	client pb.IstioCertificateServiceClient
+	conn   *grpc.ClientConn
+	closed bool
+	// draining are the replaced connections, closed once connDrainPeriod elapsed.
+	draining map[*grpc.ClientConn]struct{}
+
+	// provCertWatcher watches the certificate in ProvCert, to reconnect with it once it is replaced.
+	provCertWatcher filewatch.FileWatcher
+	// provCertReplaced is set when the certificate in ProvCert was replaced, so that the next request
+	// reconnects with it.
+	provCertReplaced *atomic.Bool
 }
 
 // NewCitadelClient create a CA client for Citadel.
 func NewCitadelClient(opts *security.Options, tls bool, rootCert []byte) (*CitadelClient, error) {
 	c := &CitadelClient{
-		enableTLS:     tls,
-		caTLSRootCert: rootCert,
-		opts:          opts,
-		provider:      caclient.NewCATokenProvider(opts),
-		usingMtls:     atomic.NewBool(false),
+		enableTLS:        tls,
+		caTLSRootCert:    rootCert,
+		opts:             opts,
+		provider:         caclient.NewCATokenProvider(opts),
+		usingMtls:        atomic.NewBool(false),
+		unknownAuthority: atomic.NewBool(false),
+		draining:         map[*grpc.ClientConn]struct{}{},
+		provCertReplaced: atomic.NewBool(false),
 	}
 
 	conn, err := c.buildConnection()
@@ -71,17 +112,108 @@ func NewCitadelClient(opts *security.Options, tls bool, rootCert []byte) (*Citad
 	}
 	c.conn = conn
 	c.client = pb.NewIstioCertificateServiceClient(conn)
+	// When the agent writes its certificates to ProvCert, the changes are its own renewals rather than a
+	// new provisioning certificate, and the connection keeps authenticating with the provisioned one.
+	if opts.ProvCert != "" && filepath.Clean(opts.ProvCert) != filepath.Clean(opts.OutputKeyCertToDir) {
+		if c.provCertWatcher, err = filewatch.New(opts); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to watch provisioning certificate: %v", err)
+		}
+		go c.watchProvCert(filepath.Join(opts.ProvCert, "cert-chain.pem"))
+	}
 	return c, nil
 }
 
 func (c *CitadelClient) Close() {
+	if c.provCertWatcher != nil {
+		_ = c.provCertWatcher.Close()
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.closed = true
 	if c.conn != nil {
 		c.conn.Close()
 	}
+	for conn := range c.draining {
+		conn.Close()
+	}
+	c.draining = nil
+}
+
+// watchProvCert reconnects to the CA whenever certFile changes, as the certificate is only presented
+// in the TLS handshake. While the file cannot be watched, because it was removed or is not
+// provisioned yet, it is tried again every provCertWatchRetryInterval.
+func (c *CitadelClient) watchProvCert(certFile string) {
+	var retry *time.Ticker
+	stopRetry := func() {
+		if retry != nil {
+			retry.Stop()
+			retry = nil
+		}
+	}
+	defer stopRetry()
+	if c.provCertWatcher.Add(certFile) != nil {
+		retry = time.NewTicker(provCertWatchRetryInterval)
+	}
+	for {
+		var retryC <-chan time.Time
+		if retry != nil {
+			retryC = retry.C
+		}
+		select {
+		case event, ok := <-c.provCertWatcher.Events():
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				_ = c.provCertWatcher.Remove(certFile)
+				if retry == nil {
+					retry = time.NewTicker(provCertWatchRetryInterval)
+				}
+			}
+			c.reloadProvCert()
+		case err, ok := <-c.provCertWatcher.Errors():
+			if !ok {
+				return
+			}
+			citadelClientLog.Warnf("error watching provisioning certificate %s: %v", certFile, err)
+		case <-retryC:
+			if c.provCertWatcher.Add(certFile) == nil {
+				stopRetry()
+				c.reloadProvCert()
+			}
+		}
+	}
+}
+
+// reloadProvCert has the next request rebuild the connection to the CA, so that it authenticates with
+// the replaced certificate in ProvCert. The connection is not rebuilt right away, as the certificate
+// may be replaced several times in a row, and so as not to disrupt the requests in flight.
+func (c *CitadelClient) reloadProvCert() {
+	if !c.provCertReplaced.Swap(true) {
+		citadelClientLog.Infof("provisioning certificate in %s replaced, reconnecting to CA %s on the next request",
+			c.opts.ProvCert, c.opts.CAEndpoint)
+	}
+}
+
+// drainConn closes conn once connDrainPeriod elapsed. Must be called with connMu held.
+func (c *CitadelClient) drainConn(conn *grpc.ClientConn) {
+	c.draining[conn] = struct{}{}
+	time.AfterFunc(connDrainPeriod, func() {
+		c.connMu.Lock()
+		defer c.connMu.Unlock()
+		if _, f := c.draining[conn]; f {
+			delete(c.draining, conn)
+			conn.Close()
+		}
+	})
 }
 
 // CSR Sign calls Citadel to sign a CSR.
-func (c *CitadelClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+func (c *CitadelClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
 	crMetaStruct := &types.Struct{
 		Fields: map[string]*types.Value{
 			security.CertSigner: {
@@ -97,10 +229,28 @@ func (c *CitadelClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]strin
 	if err := c.reconnectIfNeeded(); err != nil {
 		return nil, err
 	}
-	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("ClusterID", c.opts.ClusterID))
-	resp, err := c.client.CreateCertificate(ctx, req)
+	client, _, err := c.getClient()
 	if err != nil {
-		return nil, fmt.Errorf("create certificate: %v", err)
+		return nil, err
+	}
+	md := metadata.Pairs("ClusterID", c.opts.ClusterID)
+	if c.opts.KeyAttestor != nil {
+		attestation, err := attestKey(c.opts.KeyAttestor, c.opts.KeyAttestationCSROID, csrPEM)
+		if err != nil {
+			return nil, fmt.Errorf("attest CSR key: %v", err)
+		}
+		md.Set(security.KeyAttestationMeta, attestation)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	resp, err := client.CreateCertificate(ctx, req)
+	if err != nil && c.refreshRootCert() {
+		citadelClientLog.Infof("retrying certificate request with refreshed roots")
+		if client, _, err = c.getClient(); err == nil {
+			resp, err = client.CreateCertificate(ctx, req)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
 	}
 
 	if len(resp.CertChain) <= 1 {
@@ -110,6 +260,51 @@ func (c *CitadelClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]strin
 	return resp.CertChain, nil
 }
 
+// SignJWTSVID returns a JWT SVID of the workload for audience, signed by istiod.
+func (c *CitadelClient) SignJWTSVID(ctx context.Context, audience string) (string, error) {
+	if err := c.reconnectIfNeeded(); err != nil {
+		return "", err
+	}
+	_, conn, err := c.getClient()
+	if err != nil {
+		return "", err
+	}
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("ClusterID", c.opts.ClusterID))
+	resp, err := jwtsvid.NewJWTSVIDServiceClient(conn).SignJWTSVID(ctx, &jwtsvid.SignJWTSVIDRequest{Audience: audience})
+	if status.Code(err) == codes.Unimplemented {
+		// Istiod predates the JWT SVID service, or its CA signs with an external signer.
+		return "", security.ErrJWTSVIDNotSupported
+	}
+	if err != nil {
+		return "", fmt.Errorf("sign JWT SVID: %w", err)
+	}
+	return resp.Token, nil
+}
+
+// attestKey returns the attestation of the public key of the CSR, taken from its csrOID extension if
+// set, so that the key is only quoted once.
+func attestKey(attestor security.KeyAttestor, csrOID string, csrPEM []byte) (string, error) {
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return "", err
+	}
+	if csrOID != "" {
+		oid, err := util.ParseOID(csrOID)
+		if err != nil {
+			return "", err
+		}
+		attestation, err := util.KeyAttestationFromCSR(csr, oid)
+		if err != nil {
+			return "", err
+		}
+		if attestation != nil {
+			return string(attestation), nil
+		}
+	}
+	digest := sha256.Sum256(csr.RawSubjectPublicKeyInfo)
+	return attestor.AttestKey(digest[:])
+}
+
 func (c *CitadelClient) getTLSDialOption() (grpc.DialOption, error) {
 	// Load the TLS root certificate from the specified file.
 	// Create a certificate pool
@@ -136,9 +331,7 @@ func (c *CitadelClient) getTLSDialOption() (grpc.DialOption, error) {
 		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
 			if c.opts.ProvCert != "" {
 				// Load the certificate from disk
-				certificate, err = tls.LoadX509KeyPair(
-					filepath.Join(c.opts.ProvCert, "cert-chain.pem"),
-					filepath.Join(c.opts.ProvCert, "key.pem"))
+				certificate, err = nodeagentutil.LoadProvCert(context.Background(), c.opts)
 
 				if err != nil {
 					// we will return an empty cert so that when user sets the Prov cert path
@@ -174,7 +367,77 @@ func (c *CitadelClient) getTLSDialOption() (grpc.DialOption, error) {
 	}
 
 	transportCreds := credentials.NewTLS(&config)
-	return grpc.WithTransportCredentials(transportCreds), nil
+	return grpc.WithTransportCredentials(verificationRecorder{transportCreds, c.unknownAuthority}), nil
+}
+
+// SetRootCertFile records the file the roots passed to NewCitadelClient were loaded from, to re-read
+// them from if the CA is no longer signed by them and security.Options.CARootCertFallback is unset.
+func (c *CitadelClient) SetRootCertFile(path string) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.caTLSRootCertFile = path
+}
+
+// refreshRootCert re-reads the roots used to verify the CA if a TLS handshake failed with an unknown
+// authority, and rebuilds the connection if they changed. It reports whether the connection was
+// rebuilt, in which case the failed request can be retried.
+func (c *CitadelClient) refreshRootCert() bool {
+	if !c.unknownAuthority.CAS(true, false) {
+		return false
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	path := c.opts.CARootCertFallback
+	if path == "" {
+		path = c.caTLSRootCertFile
+	}
+	if path == "" || c.closed {
+		citadelClientLog.Warnf("certificate of CA %s is signed by an unknown authority, and there is no file to reload roots from",
+			c.opts.CAEndpoint)
+		return false
+	}
+	rootCert, err := os.ReadFile(path)
+	if err != nil {
+		citadelClientLog.Warnf("failed to reload roots of CA %s from %s: %v", c.opts.CAEndpoint, path, err)
+		return false
+	}
+	if bytes.Equal(rootCert, c.caTLSRootCert) {
+		citadelClientLog.Warnf("certificate of CA %s is not signed by the roots in %s", c.opts.CAEndpoint, path)
+		return false
+	}
+	previous := c.caTLSRootCert
+	c.caTLSRootCert = rootCert
+	conn, err := c.buildConnection()
+	if err != nil {
+		c.caTLSRootCert = previous
+		citadelClientLog.Warnf("failed to connect to CA %s with roots from %s: %v", c.opts.CAEndpoint, path, err)
+		return false
+	}
+	c.conn.Close()
+	c.conn = conn
+	c.client = pb.NewIstioCertificateServiceClient(conn)
+	citadelClientLog.Infof("reloaded roots of CA %s from %s", c.opts.CAEndpoint, path)
+	return true
+}
+
+// verificationRecorder records TLS handshakes that failed because the certificate of the server is
+// signed by an unknown authority.
+type verificationRecorder struct {
+	credentials.TransportCredentials
+	unknownAuthority *atomic.Bool
+}
+
+func (v verificationRecorder) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	out, info, err := v.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		v.unknownAuthority.Store(true)
+	}
+	return out, info, err
+}
+
+func (v verificationRecorder) Clone() credentials.TransportCredentials {
+	return verificationRecorder{v.TransportCredentials.Clone(), v.unknownAuthority}
 }
 
 func (c *CitadelClient) isCertExpired(filepath string) (bool, error) {
@@ -208,10 +471,8 @@ func (c *CitadelClient) buildConnection() (*grpc.ClientConn, error) {
 		opts = grpc.WithInsecure()
 	}
 
-	conn, err := grpc.Dial(c.opts.CAEndpoint,
-		opts,
-		grpc.WithPerRPCCredentials(c.provider),
-		security.CARetryInterceptor())
+	dialOpts := append([]grpc.DialOption{opts, grpc.WithPerRPCCredentials(c.provider)}, security.CADialOptions(c.opts)...)
+	conn, err := grpc.Dial(c.opts.CAEndpoint, dialOpts...)
 	if err != nil {
 		citadelClientLog.Errorf("Failed to connect to endpoint %s: %v", c.opts.CAEndpoint, err)
 		return nil, fmt.Errorf("failed to connect to endpoint %s", c.opts.CAEndpoint)
@@ -220,19 +481,79 @@ func (c *CitadelClient) buildConnection() (*grpc.ClientConn, error) {
 	return conn, nil
 }
 
+// getClient returns the client and connection shared by all CA operations. If the connection was
+// shut down, or the provisioning certificate was replaced, it is rebuilt first; transient failures
+// are handled by gRPC's own reconnect logic.
+func (c *CitadelClient) getClient() (pb.IstioCertificateServiceClient, *grpc.ClientConn, error) {
+	c.connMu.RLock()
+	client, conn := c.client, c.conn
+	c.connMu.RUnlock()
+	if conn.GetState() != connectivity.Shutdown && !c.provCertReplaced.Load() {
+		return client, conn, nil
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.closed {
+		return nil, nil, errors.New("ca client is closed")
+	}
+	replaced := c.provCertReplaced.Swap(false)
+	// Another caller may have already rebuilt the connection.
+	if !replaced && c.conn.GetState() != connectivity.Shutdown {
+		return c.client, c.conn, nil
+	}
+	conn, err := c.buildConnection()
+	if err != nil {
+		if replaced && c.conn.GetState() != connectivity.Shutdown {
+			citadelClientLog.Warnf("failed to reconnect to CA %s with the replaced provisioning certificate: %v",
+				c.opts.CAEndpoint, err)
+			return c.client, c.conn, nil
+		}
+		return nil, nil, err
+	}
+	if replaced {
+		// The requests in flight on the previous connection are left to complete.
+		c.drainConn(c.conn)
+		citadelClientLog.Infof("reconnected to CA %s with the replaced provisioning certificate in %s",
+			c.opts.CAEndpoint, c.opts.ProvCert)
+	} else {
+		citadelClientLog.Infof("recreated shutdown connection to %s", c.opts.CAEndpoint)
+	}
+	c.conn = conn
+	c.client = pb.NewIstioCertificateServiceClient(conn)
+	return c.client, c.conn, nil
+}
+
+// CheckHealth probes the CA using the standard gRPC health service, over the same connection used
+// for signing.
+func (c *CitadelClient) CheckHealth(ctx context.Context) error {
+	_, conn, err := c.getClient()
+	if err != nil {
+		return err
+	}
+	resp, err := ghc.NewHealthClient(conn).Check(ctx, &ghc.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("health check: %v", err)
+	}
+	if resp.Status != ghc.HealthCheckResponse_SERVING {
+		return fmt.Errorf("CA %s is %v", c.opts.CAEndpoint, resp.Status)
+	}
+	return nil
+}
+
 func (c *CitadelClient) reconnectIfNeeded() error {
 	if c.opts.ProvCert == "" || c.usingMtls.Load() {
 		// No need to reconnect, already using mTLS or never will use it
 		return nil
 	}
-	_, err := tls.LoadX509KeyPair(
-		filepath.Join(c.opts.ProvCert, "cert-chain.pem"),
-		filepath.Join(c.opts.ProvCert, "key.pem"))
+	_, err := nodeagentutil.LoadProvCert(context.Background(), c.opts)
 	if err != nil {
 		// Cannot load the certificates yet, don't both reconnecting
 		return nil
 	}
 
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
 	if err := c.conn.Close(); err != nil {
 		return fmt.Errorf("failed to close connection")
 	}
@@ -248,6 +569,6 @@ func (c *CitadelClient) reconnectIfNeeded() error {
 }
 
 // GetRootCertBundle: Citadel (Istiod) CA doesn't publish any endpoint to retrieve CA certs
-func (c *CitadelClient) GetRootCertBundle() ([]string, error) {
+func (c *CitadelClient) GetRootCertBundle(context.Context) ([]string, error) {
 	return []string{}, nil
 }
@@ -17,6 +17,7 @@ package caclient
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"path/filepath"
@@ -28,7 +29,10 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	ghc "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
@@ -43,6 +47,7 @@ import (
 	"istio.io/istio/security/pkg/monitoring"
 	"istio.io/istio/security/pkg/nodeagent/util"
 	ca2 "istio.io/istio/security/pkg/server/ca"
+	"istio.io/istio/security/proto/jwtsvid"
 )
 
 const (
@@ -60,6 +65,17 @@ type mockCAServer struct {
 	Certs         []string
 	Authenticator *security.FakeAuthenticator
 	Err           error
+	// JWTSVID, if set, is returned by a JWT SVID service served along the certificate service.
+	JWTSVID string
+}
+
+type mockJWTSVIDServer struct {
+	jwtsvid.UnimplementedJWTSVIDServiceServer
+	token string
+}
+
+func (s *mockJWTSVIDServer) SignJWTSVID(_ context.Context, in *jwtsvid.SignJWTSVIDRequest) (*jwtsvid.SignJWTSVIDResponse, error) {
+	return &jwtsvid.SignJWTSVIDResponse{Token: s.token + "/" + in.Audience}, nil
 }
 
 func (ca *mockCAServer) CreateCertificate(ctx context.Context, in *pb.IstioCertificateRequest) (*pb.IstioCertificateResponse, error) {
@@ -106,6 +122,10 @@ func serve(t *testing.T, ca mockCAServer, opts ...grpc.ServerOption) string {
 
 	go func() {
 		pb.RegisterIstioCertificateServiceServer(s, &ca)
+		if ca.JWTSVID != "" {
+			jwtsvid.RegisterJWTSVIDServiceServer(s, &mockJWTSVIDServer{token: ca.JWTSVID})
+		}
+		ghc.RegisterHealthServer(s, health.NewServer())
 		if err := s.Serve(lis); err != nil {
 			t.Logf("failed to serve: %v", err)
 		}
@@ -117,7 +137,7 @@ func serve(t *testing.T, ca mockCAServer, opts ...grpc.ServerOption) string {
 func TestCitadelClientRotation(t *testing.T) {
 	checkSign := func(t *testing.T, cli security.Client, expectError bool) {
 		t.Helper()
-		resp, err := cli.CSRSign([]byte{0o1}, 1)
+		resp, err := cli.CSRSign(context.Background(), []byte{0o1}, 1)
 		if expectError != (err != nil) {
 			t.Fatalf("expected error:%v, got error:%v", expectError, err)
 		}
@@ -179,6 +199,153 @@ func TestCitadelClientRotation(t *testing.T) {
 		}
 		checkSign(t, cli, false)
 	})
+	t.Run("cert replaced", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"cert-chain.pem", "key.pem"} {
+			if err := file.Copy(filepath.Join(certDir, name), dir, name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		server := mockCAServer{Certs: fakeCert, Err: nil, Authenticator: security.NewFakeAuthenticator("ca")}
+		addr := serve(t, server, tlsOptions(t))
+		opts := &security.Options{
+			CAEndpoint: addr, JWTPath: "testdata/token", ProvCert: dir,
+			FileWatcher: security.FileWatcherPoll, FileWatchPollInterval: 10 * time.Millisecond,
+		}
+		cli, err := NewCitadelClient(opts, true, testutil.ReadFile(filepath.Join(certDir, "root-cert.pem"), t))
+		if err != nil {
+			t.Fatalf("failed to create ca client: %v", err)
+		}
+		t.Cleanup(cli.Close)
+		server.Authenticator.Set("", "istiod.istio-system.svc")
+		checkSign(t, cli, false)
+
+		cli.connMu.RLock()
+		conn := cli.conn
+		cli.connMu.RUnlock()
+		if err := file.AtomicCopy(filepath.Join(certDir, "cert-chain.pem"), dir, "cert-chain.pem"); err != nil {
+			t.Fatal(err)
+		}
+		retry.UntilSuccessOrFail(t, func() error {
+			if !cli.provCertReplaced.Load() {
+				return fmt.Errorf("expected the replaced certificate to be noticed")
+			}
+			return nil
+		}, retry.Timeout(5*time.Second))
+		// The connection is rebuilt by the next request, while the previous one drains.
+		checkSign(t, cli, false)
+		cli.connMu.RLock()
+		rebuilt := cli.conn != conn
+		_, draining := cli.draining[conn]
+		cli.connMu.RUnlock()
+		if !rebuilt || !draining {
+			t.Fatalf("expected the connection to be rebuilt and the previous one to drain")
+		}
+		if conn.GetState() == connectivity.Shutdown {
+			t.Fatalf("expected the previous connection to stay open while draining")
+		}
+	})
+	t.Run("cert written by the agent", func(t *testing.T) {
+		server := mockCAServer{Certs: fakeCert, Err: nil, Authenticator: security.NewFakeAuthenticator("ca")}
+		addr := serve(t, server, tlsOptions(t))
+		opts := &security.Options{CAEndpoint: addr, JWTPath: "testdata/token", ProvCert: certDir, OutputKeyCertToDir: certDir + "/"}
+		cli, err := NewCitadelClient(opts, true, testutil.ReadFile(filepath.Join(certDir, "root-cert.pem"), t))
+		if err != nil {
+			t.Fatalf("failed to create ca client: %v", err)
+		}
+		t.Cleanup(cli.Close)
+		if cli.provCertWatcher != nil {
+			t.Fatalf("expected the certificates written by the agent not to be watched")
+		}
+	})
+}
+
+func TestCitadelClientRootCertRefresh(t *testing.T) {
+	certDir := filepath.Join(env.IstioSrc, "./tests/testdata/certs/pilot")
+	// Roots that did not sign the certificate of the CA, as if the roots were rotated.
+	staleRoot := testutil.ReadFile(filepath.Join(env.IstioSrc, "./samples/certs/root-cert.pem"), t)
+	addr := serve(t, mockCAServer{Certs: fakeCert}, tlsOptions(t))
+
+	t.Run("reloaded", func(t *testing.T) {
+		rootFile := filepath.Join(t.TempDir(), "root-cert.pem")
+		if err := file.AtomicWrite(rootFile, staleRoot, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cli, err := NewCitadelClient(&security.Options{CAEndpoint: addr}, true, staleRoot)
+		if err != nil {
+			t.Fatalf("failed to create ca client: %v", err)
+		}
+		t.Cleanup(cli.Close)
+		cli.SetRootCertFile(rootFile)
+		if _, err := cli.CSRSign(context.Background(), []byte{0o1}, 1); err == nil {
+			t.Fatal("expected handshake with stale roots to fail")
+		}
+
+		// The roots are rotated on disk; the next request reloads them.
+		if err := file.Copy(filepath.Join(certDir, "root-cert.pem"), filepath.Dir(rootFile), "root-cert.pem"); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cli.CSRSign(context.Background(), []byte{0o1}, 1)
+		if err != nil {
+			t.Fatalf("failed to sign after roots were rotated: %v", err)
+		}
+		if !reflect.DeepEqual(resp, fakeCert) {
+			t.Fatalf("expected cert %v, got %v", fakeCert, resp)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		cli, err := NewCitadelClient(&security.Options{
+			CAEndpoint:         addr,
+			CARootCertFallback: filepath.Join(certDir, "root-cert.pem"),
+		}, true, staleRoot)
+		if err != nil {
+			t.Fatalf("failed to create ca client: %v", err)
+		}
+		t.Cleanup(cli.Close)
+		if _, err := cli.CSRSign(context.Background(), []byte{0o1}, 1); err != nil {
+			t.Fatalf("failed to sign with roots from the fallback: %v", err)
+		}
+	})
+}
+
+func TestCitadelClientSharedConnection(t *testing.T) {
+	addr := serve(t, mockCAServer{Certs: fakeCert})
+	cli, err := NewCitadelClient(&security.Options{CAEndpoint: addr, ClusterID: "Kubernetes"}, false, nil)
+	if err != nil {
+		t.Fatalf("failed to create ca client: %v", err)
+	}
+	t.Cleanup(cli.Close)
+
+	conn := cli.conn
+	for i := 0; i < 3; i++ {
+		if _, err := cli.CSRSign(context.Background(), []byte{0o1}, 1); err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		if _, err := cli.GetRootCertBundle(context.Background()); err != nil {
+			t.Fatalf("failed to get root bundle: %v", err)
+		}
+		if err := cli.CheckHealth(context.Background()); err != nil {
+			t.Fatalf("failed health check: %v", err)
+		}
+	}
+	if cli.conn != conn {
+		t.Fatalf("expected a single shared connection to be used")
+	}
+
+	// A shutdown connection is transparently rebuilt.
+	conn.Close()
+	if _, err := cli.CSRSign(context.Background(), []byte{0o1}, 1); err != nil {
+		t.Fatalf("failed to sign after connection shutdown: %v", err)
+	}
+	if cli.conn == conn {
+		t.Fatalf("expected connection to be rebuilt")
+	}
+
+	cli.Close()
+	if _, err := cli.CSRSign(context.Background(), []byte{0o1}, 1); err == nil {
+		t.Fatalf("expected error after client is closed")
+	}
 }
 
 func TestCitadelClient(t *testing.T) {
@@ -220,7 +387,7 @@ func TestCitadelClient(t *testing.T) {
 			}
 			t.Cleanup(cli.Close)
 
-			resp, err := cli.CSRSign([]byte{0o1}, 1)
+			resp, err := cli.CSRSign(context.Background(), []byte{0o1}, 1)
 			if err != nil {
 				if !strings.Contains(err.Error(), tc.expectedErr) {
 					t.Errorf("error (%s) does not match expected error (%s)", err.Error(), tc.expectedErr)
@@ -251,6 +418,28 @@ func TestCitadelClient(t *testing.T) {
 	}
 }
 
+func TestCitadelClientSignJWTSVID(t *testing.T) {
+	cli, err := NewCitadelClient(&security.Options{CAEndpoint: serve(t, mockCAServer{JWTSVID: "token"})}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cli.Close)
+	token, err := cli.SignJWTSVID(context.Background(), "aud")
+	if err != nil || token != "token/aud" {
+		t.Fatalf("got %q, %v, expected token/aud", token, err)
+	}
+
+	// Istiod without the JWT SVID service does not issue them.
+	cli, err = NewCitadelClient(&security.Options{CAEndpoint: serve(t, mockCAServer{})}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cli.Close)
+	if _, err := cli.SignJWTSVID(context.Background(), "aud"); !errors.Is(err, security.ErrJWTSVIDNotSupported) {
+		t.Fatalf("expected ErrJWTSVIDNotSupported, got %v", err)
+	}
+}
+
 type mockTokenCAServer struct {
 	Certs []string
 }
@@ -337,7 +526,7 @@ func TestCitadelClientWithDifferentTypeToken(t *testing.T) {
 					return fmt.Errorf("failed to create ca client: %v", err)
 				}
 				t.Cleanup(cli.Close)
-				resp, err := cli.CSRSign([]byte{0o1}, 1)
+				resp, err := cli.CSRSign(context.Background(), []byte{0o1}, 1)
 				if err != nil {
 					if !strings.Contains(err.Error(), tc.expectedErr) {
 						return fmt.Errorf("error (%s) does not match expected error (%s)", err.Error(), tc.expectedErr)
@@ -96,15 +96,13 @@ func (r *GoogleCASClient) createCertReq(name string, csrPEM []byte, lifetime tim
 }
 
 // CSR Sign calls Google CAS to sign a CSR.
-func (r *GoogleCASClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+func (r *GoogleCASClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
 	certChain := []string{}
 
 	rand.Seed(time.Now().UnixNano())
 	name := fmt.Sprintf("csr-workload-%s", rand.String(8))
 	creq := r.createCertReq(name, csrPEM, time.Duration(certValidTTLInSec)*time.Second)
 
-	ctx := context.Background()
-
 	cresp, err := r.caClient.CreateCertificate(ctx, creq)
 	if err != nil {
 		googleCASClientLog.Errorf("unable to create certificate: %v", err)
@@ -116,13 +114,11 @@ func (r *GoogleCASClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]str
 }
 
 // GetRootCertBundle:  Get CA certs of the pool from Google CAS API endpoint
-func (r *GoogleCASClient) GetRootCertBundle() ([]string, error) {
+func (r *GoogleCASClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
 	var rootCertMap map[string]struct{} = make(map[string]struct{})
 	var trustbundle []string = []string{}
 	var err error
 
-	ctx := context.Background()
-
 	req := &privatecapb.FetchCaCertsRequest{
 		CaPool: r.caSigner,
 	}
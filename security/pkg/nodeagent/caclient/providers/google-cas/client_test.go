@@ -15,6 +15,7 @@
 package caclient
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -81,7 +82,7 @@ func TestGoogleCASClient(t *testing.T) {
 			t.Errorf("Test case [%s] Client Init: failed to create ca client: %v", id, err)
 		}
 
-		resp, err := cli.CSRSign([]byte{01}, 1)
+		resp, err := cli.CSRSign(context.Background(), []byte{01}, 1)
 		if err != nil {
 			if err.Error() != tc.expectedErr.Error() {
 				t.Errorf("Test case [%s] Cert Check: error (%s) does not match expected error (%s)", id, err.Error(), tc.expectedErr.Error())
@@ -94,7 +95,7 @@ func TestGoogleCASClient(t *testing.T) {
 			}
 		}
 
-		resp, err = cli.GetRootCertBundle()
+		resp, err = cli.GetRootCertBundle(context.Background())
 		if err != nil {
 			if err.Error() != tc.expectedErr.Error() {
 				t.Errorf("Test case [%s] RootCaBundle check: error (%s) does not match expected error (%s)", id, err.Error(), tc.expectedErr.Error())
@@ -50,29 +50,28 @@ type googleCAClient struct {
 	conn       *grpc.ClientConn
 }
 
-// NewGoogleCAClient create a CA client for Google CA.
-func NewGoogleCAClient(endpoint string, tls bool, provider *caclient.TokenProvider) (security.Client, error) {
+// NewGoogleCAClient create a CA client for Google CA. The connection is configured per the CA options
+// of opts, or the defaults if nil.
+func NewGoogleCAClient(endpoint string, tls bool, provider *caclient.TokenProvider,
+	opts *security.Options) (security.Client, error) {
 	c := &googleCAClient{
 		caEndpoint: endpoint,
 		enableTLS:  tls,
 	}
 
-	var opts grpc.DialOption
+	var transportOpt grpc.DialOption
 	var err error
 	if tls {
-		opts, err = c.getTLSDialOption()
+		transportOpt, err = c.getTLSDialOption()
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		opts = grpc.WithInsecure()
+		transportOpt = grpc.WithInsecure()
 	}
 
-	conn, err := grpc.Dial(endpoint,
-		opts,
-		grpc.WithPerRPCCredentials(provider),
-		security.CARetryInterceptor(),
-	)
+	dialOpts := append([]grpc.DialOption{transportOpt, grpc.WithPerRPCCredentials(provider)}, security.CADialOptions(opts)...)
+	conn, err := grpc.Dial(endpoint, dialOpts...)
 	if err != nil {
 		googleCAClientLog.Errorf("Failed to connect to endpoint %s: %v", endpoint, err)
 		return nil, fmt.Errorf("failed to connect to endpoint %s", endpoint)
@@ -84,7 +83,7 @@ func NewGoogleCAClient(endpoint string, tls bool, provider *caclient.TokenProvid
 }
 
 // CSR Sign calls Google CA to sign a CSR.
-func (cl *googleCAClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+func (cl *googleCAClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
 	req := &gcapb.MeshCertificateRequest{
 		RequestId: uuid.New().String(),
 		Csr:       string(csrPEM),
@@ -101,7 +100,7 @@ func (cl *googleCAClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]str
 		out["x-goog-request-params"] = []string{fmt.Sprintf("location=locations/%s", zone)}
 	}
 
-	ctx := metadata.NewOutgoingContext(context.Background(), out)
+	ctx = metadata.NewOutgoingContext(ctx, out)
 	resp, err := cl.client.CreateCertificate(ctx, req)
 	if err != nil {
 		googleCAClientLog.Errorf("Failed to create certificate: %v", err)
@@ -136,7 +135,7 @@ func (cl *googleCAClient) getTLSDialOption() (grpc.DialOption, error) {
 }
 
 // GetRootCertBundle: Google Mesh CA doesn't publish any endpoint to retrieve CA certs
-func (cl *googleCAClient) GetRootCertBundle() ([]string, error) {
+func (cl *googleCAClient) GetRootCertBundle(context.Context) ([]string, error) {
 	return []string{}, nil
 }
 
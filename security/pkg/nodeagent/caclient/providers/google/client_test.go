@@ -15,6 +15,7 @@
 package caclient
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -63,12 +64,12 @@ func TestGoogleCAClient(t *testing.T) {
 		}
 		defer s.Stop()
 
-		cli, err := NewGoogleCAClient(s.Address, false, nil)
+		cli, err := NewGoogleCAClient(s.Address, false, nil, nil)
 		if err != nil {
 			t.Errorf("Test case [%s]: failed to create ca client: %v", id, err)
 		}
 
-		resp, err := cli.CSRSign([]byte{0o1}, 1)
+		resp, err := cli.CSRSign(context.Background(), []byte{0o1}, 1)
 		if err != nil {
 			if err.Error() != tc.expectedErr {
 				t.Errorf("Test case [%s]: error (%s) does not match expected error (%s)", id, err.Error(), tc.expectedErr)
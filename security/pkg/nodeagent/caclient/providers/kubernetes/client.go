@@ -0,0 +1,149 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var k8sCSRClientLog = log.RegisterScope("k8scsr", "Kubernetes CSR client debugging", 0)
+
+var rootCertFileEnv = env.RegisterStringVar("K8S_SIGNER_ROOT_CERT", "",
+	"The PEM file of the root certificates of the Kubernetes signer. If empty, the root is taken from "+
+		"the end of the signed certificate chain.").Get()
+
+// pollInterval is how often the CertificateSigningRequest is read while waiting for its certificate.
+var pollInterval = time.Second
+
+// csrNamePrefix prefixes the generated names of the CertificateSigningRequests of the agent.
+const csrNamePrefix = "istio-agent-csr-"
+
+// K8sCSRClient signs workload CSRs by creating certificates.k8s.io/v1 CertificateSigningRequests for
+// a signer, and waiting for them to be approved and issued. The agent must be allowed to create, get
+// and delete CertificateSigningRequests. Approval is left to an approver of the signer.
+type K8sCSRClient struct {
+	client       kubernetes.Interface
+	signerName   string
+	rootCertFile string
+}
+
+// NewK8sCSRClient creates a CA client for the Kubernetes signer signerName.
+func NewK8sCSRClient(client kubernetes.Interface, signerName string) (*K8sCSRClient, error) {
+	if signerName == "" {
+		return nil, errors.New("kubernetes signer name is not set")
+	}
+	return &K8sCSRClient{
+		client:       client,
+		signerName:   signerName,
+		rootCertFile: rootCertFileEnv,
+	}, nil
+}
+
+// CSRSign creates a CertificateSigningRequest for csrPEM and blocks until it is issued, denied or
+// failed, or ctx is cancelled. The CertificateSigningRequest is deleted when done.
+func (c *K8sCSRClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	csr := &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: csrNamePrefix + rand.String(8)},
+		Spec: certv1.CertificateSigningRequestSpec{
+			Request:    csrPEM,
+			SignerName: c.signerName,
+			Usages: []certv1.KeyUsage{
+				certv1.UsageDigitalSignature,
+				certv1.UsageKeyEncipherment,
+				certv1.UsageServerAuth,
+				certv1.UsageClientAuth,
+			},
+		},
+	}
+	// The minimum duration a signer accepts is 10 minutes.
+	if certValidTTLInSec >= 600 && certValidTTLInSec <= 1<<31-1 {
+		expiration := int32(certValidTTLInSec)
+		csr.Spec.ExpirationSeconds = &expiration
+	}
+	csrs := c.client.CertificatesV1().CertificateSigningRequests()
+	created, err := csrs.Create(ctx, csr, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CertificateSigningRequest: %v", err)
+	}
+	name := created.Name
+	k8sCSRClientLog.Infof("created CertificateSigningRequest %s for signer %s, waiting for it to be issued", name, c.signerName)
+	defer func() {
+		// ctx may be cancelled, e.g. on agent shutdown.
+		if err := csrs.Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+			k8sCSRClientLog.Warnf("failed to delete CertificateSigningRequest %s: %v", name, err)
+		}
+	}()
+
+	var certificate []byte
+	err = wait.PollImmediateUntil(pollInterval, func() (bool, error) {
+		current, err := csrs.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			k8sCSRClientLog.Debugf("failed to get CertificateSigningRequest %s: %v", name, err)
+			return false, nil
+		}
+		for _, cond := range current.Status.Conditions {
+			if (cond.Type == certv1.CertificateDenied || cond.Type == certv1.CertificateFailed) && cond.Status == corev1.ConditionTrue {
+				return false, fmt.Errorf("CertificateSigningRequest %s is %s: %s", name, cond.Type, cond.Message)
+			}
+		}
+		certificate = current.Status.Certificate
+		return len(certificate) > 0, nil
+	}, ctx.Done())
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	chain := util.SplitCertificates(certificate)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate in CertificateSigningRequest %s", name)
+	}
+	return chain, nil
+}
+
+// GetRootCertBundle returns the roots configured with K8S_SIGNER_ROOT_CERT. Kubernetes has no API
+// for the roots of a signer.
+func (c *K8sCSRClient) GetRootCertBundle(context.Context) ([]string, error) {
+	if c.rootCertFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.rootCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root certificates of signer %s: %v", c.signerName, err)
+	}
+	roots := util.SplitCertificates(data)
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", c.rootCertFile)
+	}
+	return roots, nil
+}
+
+func (c *K8sCSRClient) Close() {}
@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+const (
+	testLeaf = `-----BEGIN CERTIFICATE-----
+bGVhZg==
+-----END CERTIFICATE-----
+`
+	testRoot = `-----BEGIN CERTIFICATE-----
+cm9vdA==
+-----END CERTIFICATE-----
+`
+)
+
+// signWith waits for the CertificateSigningRequest of the client and completes it with status.
+func signWith(t *testing.T, client *fake.Clientset, status certv1.CertificateSigningRequestStatus) {
+	t.Helper()
+	csrs := client.CertificatesV1().CertificateSigningRequests()
+	var csr *certv1.CertificateSigningRequest
+	retry.UntilSuccessOrFail(t, func() error {
+		list, err := csrs.List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		if len(list.Items) != 1 {
+			return fmt.Errorf("expected 1 CertificateSigningRequest, got %d", len(list.Items))
+		}
+		csr = &list.Items[0]
+		return nil
+	}, retry.Timeout(5*time.Second))
+	if csr.Spec.SignerName != "example.com/istio" || *csr.Spec.ExpirationSeconds != 3600 {
+		t.Errorf("unexpected CertificateSigningRequest %+v", csr.Spec)
+	}
+	csr.Status = status
+	if _, err := csrs.UpdateStatus(context.Background(), csr, metav1.UpdateOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCSRSign(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	client := fake.NewSimpleClientset()
+	caClient, err := NewK8sCSRClient(client, "example.com/istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go signWith(t, client, certv1.CertificateSigningRequestStatus{
+		Conditions:  []certv1.CertificateSigningRequestCondition{{Type: certv1.CertificateApproved, Status: corev1.ConditionTrue}},
+		Certificate: []byte(testLeaf + testRoot),
+	})
+	chain, err := caClient.CSRSign(context.Background(), []byte("csr"), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testLeaf, testRoot}; !reflect.DeepEqual(chain, want) {
+		t.Fatalf("got chain %v, want %v", chain, want)
+	}
+	list, err := client.CertificatesV1().CertificateSigningRequests().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Fatalf("expected the CertificateSigningRequest to be deleted, got %v", list.Items)
+	}
+}
+
+func TestCSRSignDenied(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	client := fake.NewSimpleClientset()
+	caClient, err := NewK8sCSRClient(client, "example.com/istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go signWith(t, client, certv1.CertificateSigningRequestStatus{
+		Conditions: []certv1.CertificateSigningRequestCondition{{Type: certv1.CertificateDenied, Status: corev1.ConditionTrue, Message: "denied"}},
+	})
+	if _, err := caClient.CSRSign(context.Background(), []byte("csr"), 3600); err == nil {
+		t.Fatal("expected a denied CertificateSigningRequest to fail")
+	}
+}
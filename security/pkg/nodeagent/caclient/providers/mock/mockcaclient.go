@@ -15,6 +15,7 @@
 package mock
 
 import (
+	"context"
 	"encoding/pem"
 	"fmt"
 	"path"
@@ -40,6 +41,8 @@ type CAClient struct {
 	certLifetime    time.Duration
 	GeneratedCerts  [][]string // Cache the generated certificates for verification purpose.
 	mockTrustAnchor bool
+	// SignErr, if set, is returned by CSRSign instead of signing the CSR.
+	SignErr error
 }
 
 // NewMockCAClient creates an instance of CAClient. errors is used to specify the number of errors
@@ -63,8 +66,11 @@ func NewMockCAClient(certLifetime time.Duration, mockTrustAnchor bool) (*CAClien
 func (c *CAClient) Close() {}
 
 // CSRSign returns the certificate or errors depending on the settings.
-func (c *CAClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+func (c *CAClient) CSRSign(_ context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
 	atomic.AddUint64(&c.SignInvokeCount, 1)
+	if c.SignErr != nil {
+		return nil, c.SignErr
+	}
 	signingCert, signingKey, certChain, rootCert := c.bundle.GetAll()
 	csr, err := util.ParsePemEncodedCSR(csrPEM)
 	if err != nil {
@@ -87,7 +93,7 @@ func (c *CAClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, er
 	return ret, nil
 }
 
-func (c *CAClient) GetRootCertBundle() ([]string, error) {
+func (c *CAClient) GetRootCertBundle(context.Context) ([]string, error) {
 	if c.mockTrustAnchor {
 		rootCertBytes := c.bundle.GetRootCertPem()
 		return []string{string(rootCertBytes)}, nil
@@ -110,7 +116,7 @@ func NewMockTokenExchangeServer(exchangeMap map[string]string) *TokenExchangeSer
 var _ security.TokenExchanger = &TokenExchangeServer{}
 
 // ExchangeToken returns a dumb token or errors depending on the settings.
-func (s *TokenExchangeServer) ExchangeToken(token string) (string, error) {
+func (s *TokenExchangeServer) ExchangeToken(_ context.Context, token string) (string, error) {
 	if len(s.exchangeMap) == 0 {
 		return "some-token", nil
 	}
@@ -0,0 +1,176 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+const (
+	// CSRFileName is the file the agent writes the pending certificate signing request to.
+	CSRFileName = "csr.pem"
+	// SignedCertChainFileName is the file the operator places the signed certificate chain in,
+	// leaf certificate first.
+	SignedCertChainFileName = "signed-cert-chain.pem"
+	// RootCertFileName optionally holds the root certificate of the offline CA. When absent, the root
+	// is taken from the last certificate of the signed chain.
+	RootCertFileName = "root-cert.pem"
+)
+
+var offlineCAClientLog = log.RegisterScope("offlineca", "Offline CA client debugging", 0)
+
+// pollInterval is how often the exchange directory is re-read in case a file system event is missed,
+// e.g. on network or FUSE mounts that do not support inotify.
+var pollInterval = 5 * time.Second
+
+type offlineCAClient struct {
+	dir string
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+// NewOfflineCAClient creates a CA client for environments where the agent cannot reach any CA.
+// Certificate signing requests are written to dir and the client waits for an operator to place the
+// chain signed out-of-band next to it.
+func NewOfflineCAClient(dir string) (security.Client, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("offline CA exchange directory %q must be an absolute path", dir)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create offline CA exchange directory %s: %v", dir, err)
+	}
+	return &offlineCAClient{
+		dir:     dir,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// CSRSign writes the CSR to the exchange directory and blocks until a signed chain whose leaf
+// certificate matches the CSR's public key is available, or the client is closed or ctx is cancelled. The requested
+// TTL is ignored: the validity is decided by whoever signs the request.
+// There is no timeout, as a retry by the caller would generate a new key and invalidate the CSR the
+// operator may already be processing.
+func (c *offlineCAClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %v", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(c.dir); err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %v", c.dir, err)
+	}
+
+	csrPath := filepath.Join(c.dir, CSRFileName)
+	if err := file.AtomicWrite(csrPath, csrPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write CSR to %s: %v", csrPath, err)
+	}
+	chainPath := filepath.Join(c.dir, SignedCertChainFileName)
+	offlineCAClientLog.Infof("wrote CSR to %s, waiting for the signed certificate chain at %s", csrPath, chainPath)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		chain, err := c.loadSignedChain(chainPath, csr.RawSubjectPublicKeyInfo)
+		if err != nil {
+			offlineCAClientLog.Debugf("signed certificate chain not usable yet: %v", err)
+		} else {
+			if err := os.Remove(csrPath); err != nil && !os.IsNotExist(err) {
+				offlineCAClientLog.Warnf("failed to remove processed CSR %s: %v", csrPath, err)
+			}
+			offlineCAClientLog.Infof("loaded signed certificate chain from %s", chainPath)
+			return chain, nil
+		}
+
+		select {
+		case <-c.closing:
+			return nil, errors.New("offline CA client is closed")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err := <-watcher.Errors:
+			offlineCAClientLog.Warnf("error watching %s: %v", c.dir, err)
+		case <-watcher.Events:
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadSignedChain reads the signed chain and returns its certificates as individual PEM blocks. A chain
+// left over from a previous request is rejected by comparing the leaf public key with the CSR's.
+func (c *offlineCAClient) loadSignedChain(path string, spki []byte) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []string
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if len(chain) == 0 {
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse leaf certificate: %v", err)
+			}
+			if !bytes.Equal(leaf.RawSubjectPublicKeyInfo, spki) {
+				return nil, errors.New("leaf certificate does not match the pending CSR")
+			}
+		}
+		chain = append(chain, string(pem.EncodeToMemory(block)))
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return chain, nil
+}
+
+// GetRootCertBundle returns the root certificate provided by the operator, if any.
+func (c *offlineCAClient) GetRootCertBundle(context.Context) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, RootCertFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(data)}, nil
+}
+
+func (c *offlineCAClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+}
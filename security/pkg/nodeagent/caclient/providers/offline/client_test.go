@@ -0,0 +1,195 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testCA struct {
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org:          "offline.test",
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{certPEM: certPEM, keyPEM: keyPEM}
+}
+
+func (ca *testCA) sign(t *testing.T, csrPEM []byte) []byte {
+	t.Helper()
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := util.ParsePemEncodedCertificate(ca.certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := util.ParsePemEncodedKey(ca.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := util.GenCertFromCSR(csr, caCert, csr.PublicKey, caKey, []string{"spiffe://cluster.local/ns/foo/sa/bar"}, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), ca.certPEM...)
+}
+
+func newCSR(t *testing.T) []byte {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csrPEM
+}
+
+func waitForFile(t *testing.T, path string) []byte {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", path)
+	return nil
+}
+
+type signResult struct {
+	chain []string
+	err   error
+}
+
+func TestCSRSign(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	client, err := NewOfflineCAClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A chain left over from an earlier request must not be picked up for a new key.
+	chainPath := filepath.Join(dir, SignedCertChainFileName)
+	if err := os.WriteFile(chainPath, ca.sign(t, newCSR(t)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	csrPEM := newCSR(t)
+	done := make(chan signResult, 1)
+	go func() {
+		chain, err := client.CSRSign(context.Background(), csrPEM, 3600)
+		done <- signResult{chain, err}
+	}()
+
+	written := waitForFile(t, filepath.Join(dir, CSRFileName))
+	if string(written) != string(csrPEM) {
+		t.Fatalf("unexpected CSR written: %s", written)
+	}
+	select {
+	case r := <-done:
+		t.Fatalf("CSRSign returned before the chain was signed: %v, %v", r.chain, r.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(chainPath, ca.sign(t, written), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("CSRSign failed: %v", r.err)
+		}
+		if len(r.chain) != 2 {
+			t.Fatalf("expected a chain of 2 certificates, got %d", len(r.chain))
+		}
+		if r.chain[1] != string(ca.certPEM) {
+			t.Errorf("unexpected root in chain: %s", r.chain[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for CSRSign")
+	}
+	if _, err := os.Stat(filepath.Join(dir, CSRFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected processed CSR to be removed, got %v", err)
+	}
+}
+
+func TestCSRSignClose(t *testing.T) {
+	client, err := NewOfflineCAClient(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan signResult, 1)
+	go func() {
+		chain, err := client.CSRSign(context.Background(), newCSR(t), 3600)
+		done <- signResult{chain, err}
+	}()
+	client.Close()
+	select {
+	case r := <-done:
+		if r.err == nil {
+			t.Fatal("expected CSRSign to fail once the client is closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for CSRSign")
+	}
+}
+
+func TestGetRootCertBundle(t *testing.T) {
+	dir := t.TempDir()
+	client, err := NewOfflineCAClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := client.GetRootCertBundle(context.Background())
+	if err != nil || roots != nil {
+		t.Fatalf("expected no roots without %s, got %v, %v", RootCertFileName, roots, err)
+	}
+	ca := newTestCA(t)
+	if err := os.WriteFile(filepath.Join(dir, RootCertFileName), ca.certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	roots, err = client.GetRootCertBundle(context.Background())
+	if err != nil || len(roots) != 1 || roots[0] != string(ca.certPEM) {
+		t.Fatalf("unexpected roots: %v, %v", roots, err)
+	}
+}
+
+func TestNewOfflineCAClientRelativePath(t *testing.T) {
+	if _, err := NewOfflineCAClient("relative/dir"); err == nil {
+		t.Fatal("expected relative exchange directory to be rejected")
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var vaultClientLog = log.RegisterScope("vault", "Vault CA client debugging", 0)
+
+var (
+	pkiPathEnv = env.RegisterStringVar("VAULT_PKI_PATH", "pki",
+		"The mount path of the Vault PKI secrets engine signing workload certificates.").Get()
+	pkiRoleEnv = env.RegisterStringVar("VAULT_PKI_ROLE", "istio",
+		"The Vault PKI role workload certificates are signed with.").Get()
+	authPathEnv = env.RegisterStringVar("VAULT_AUTH_PATH", "kubernetes",
+		"The mount path of the Vault Kubernetes auth method the agent logs in with.").Get()
+	authRoleEnv = env.RegisterStringVar("VAULT_AUTH_ROLE", "istio",
+		"The Vault Kubernetes auth role the agent logs in with.").Get()
+	caCertFileEnv = env.RegisterStringVar("VAULT_CACERT", "",
+		"The PEM file of the root certificates of the Vault server. If empty, the system roots are used.").Get()
+	crlPKIPathsEnv = env.RegisterStringVar("VAULT_CRL_PKI_PATHS", "",
+		"Comma separated mount paths of the Vault PKI secrets engines whose CRLs are served to Envoy. "+
+			"The CRLs must cover every CA of the workload certificate chains, including the root. "+
+			"If empty, no CRLs are served.").Get()
+)
+
+const (
+	// tokenHeader is the header carrying the Vault token of authenticated requests.
+	tokenHeader = "X-Vault-Token"
+	// tokenRenewMargin is how long before the expiry of its lease a Vault token is replaced.
+	tokenRenewMargin = 30 * time.Second
+	// maxResponseSize bounds the responses read from Vault.
+	maxResponseSize = 1 << 20
+	requestTimeout  = 30 * time.Second
+)
+
+// Config configures a Vault CA client.
+type Config struct {
+	// Address is the URL of the Vault server. An address without scheme uses HTTPS.
+	Address string
+	// PKIPath is the mount path of the PKI secrets engine.
+	PKIPath string
+	// PKIRole is the PKI role that signs the CSRs. It must allow the SPIFFE URI SANs of the workloads
+	// and, since the CSRs have no common name, set require_cn to false.
+	PKIRole string
+	// AuthPath is the mount path of the Kubernetes auth method.
+	AuthPath string
+	// AuthRole is the Kubernetes auth role bound to the service account of the workload.
+	AuthRole string
+	// JWTPath is the projected service account token the agent logs in with. It is read on every
+	// login, as the token is rotated by the kubelet.
+	JWTPath string
+	// CACertFile holds the root certificates of the Vault server, if not signed by the system roots.
+	CACertFile string
+	// CRLPKIPaths are the mount paths of the PKI secrets engines whose CRLs are fetched.
+	CRLPKIPaths []string
+}
+
+// ConfigFromOptions returns the configuration of a Vault CA client for an agent configured with
+// options, with the Vault specific settings taken from the VAULT_* environment variables.
+func ConfigFromOptions(options *security.Options) Config {
+	config := Config{
+		Address:    options.CAEndpoint,
+		PKIPath:    pkiPathEnv,
+		PKIRole:    pkiRoleEnv,
+		AuthPath:   authPathEnv,
+		AuthRole:   authRoleEnv,
+		JWTPath:    options.JWTPath,
+		CACertFile: caCertFileEnv,
+	}
+	if crlPKIPathsEnv != "" {
+		config.CRLPKIPaths = strings.Split(crlPKIPathsEnv, ",")
+	}
+	return config
+}
+
+var _ security.CRLSource = &VaultClient{}
+
+// VaultClient signs workload CSRs with the PKI secrets engine of Vault, logging in with the Kubernetes
+// auth method.
+type VaultClient struct {
+	config Config
+	client *http.Client
+
+	// tokenMu protects token and tokenExpiry.
+	tokenMu     sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewVaultClient creates a CA client for the PKI secrets engine of Vault.
+func NewVaultClient(config Config) (*VaultClient, error) {
+	if config.Address == "" {
+		return nil, errors.New("vault address is not set")
+	}
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "https://" + config.Address
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	if config.PKIPath == "" || config.PKIRole == "" || config.AuthPath == "" || config.AuthRole == "" {
+		return nil, errors.New("vault PKI path and role, and auth path and role must be set")
+	}
+	if config.JWTPath == "" {
+		return nil, errors.New("vault Kubernetes auth requires a JWT path")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACertFile != "" {
+		roots, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault root certificates %s: %v", config.CACertFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(roots) {
+			return nil, fmt.Errorf("no certificates found in Vault root certificates %s", config.CACertFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	vaultClientLog.Debugf("initialized Vault client for %s, PKI role %s/%s", config.Address, config.PKIPath, config.PKIRole)
+	return &VaultClient{
+		config: config,
+		client: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+type vaultError struct {
+	Errors []string `json:"errors"`
+}
+
+type loginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+type signResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+}
+
+// statusError is returned for requests Vault answered with an error status.
+type statusError struct {
+	code   int
+	errors []string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("vault returned status %d: %s", e.code, strings.Join(e.errors, "; "))
+}
+
+// CSRSign signs csrPEM with the PKI role, logging in again if the cached token is rejected.
+func (c *VaultClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	req := map[string]string{
+		"csr":    string(csrPEM),
+		"ttl":    fmt.Sprintf("%ds", certValidTTLInSec),
+		"format": "pem",
+	}
+	var resp signResponse
+	path := fmt.Sprintf("/v1/%s/sign/%s", c.config.PKIPath, c.config.PKIRole)
+	err := c.authenticated(ctx, func(token string) error {
+		return c.do(ctx, http.MethodPost, path, token, req, &resp)
+	})
+	if err != nil {
+		vaultClientLog.Errorf("failed to sign CSR with %s: %v", path, err)
+		return nil, err
+	}
+	if resp.Data.Certificate == "" {
+		return nil, errors.New("vault returned no certificate")
+	}
+	chain := []string{resp.Data.Certificate}
+	if len(resp.Data.CAChain) > 0 {
+		chain = append(chain, resp.Data.CAChain...)
+	} else if resp.Data.IssuingCA != "" {
+		chain = append(chain, resp.Data.IssuingCA)
+	}
+	return chain, nil
+}
+
+// GetRootCertBundle returns the root of the CA chain of the PKI secrets engine.
+func (c *VaultClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
+	path := fmt.Sprintf("/v1/%s/ca_chain", c.config.PKIPath)
+	blocks, err := c.getPEM(ctx, path, "CERTIFICATE")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CA chain from %s: %v", path, err)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no certificates in CA chain from %s", path)
+	}
+	// The chain is ordered from the issuer to the root.
+	return []string{string(blocks[len(blocks)-1])}, nil
+}
+
+// CRL returns the concatenated CRLs of the configured PKI secrets engines, or nil if none is
+// configured. The CRLs are public, so no token is needed.
+func (c *VaultClient) CRL(ctx context.Context) ([]byte, error) {
+	var crls []byte
+	for _, pkiPath := range c.config.CRLPKIPaths {
+		path := fmt.Sprintf("/v1/%s/crl/pem", pkiPath)
+		blocks, err := c.getPEM(ctx, path, "X509 CRL")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CRL from %s: %v", path, err)
+		}
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("no CRL from %s", path)
+		}
+		for _, b := range blocks {
+			crls = append(crls, b...)
+		}
+	}
+	return crls, nil
+}
+
+// getPEM returns the PEM encoded blocks of type blockType of the unauthenticated GET of path.
+func (c *VaultClient) getPEM(ctx context.Context, path, blockType string) ([][]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Address+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", httpResp.StatusCode)
+	}
+	var blocks [][]byte
+	for block, rest := pem.Decode(body); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == blockType {
+			blocks = append(blocks, pem.EncodeToMemory(block))
+		}
+	}
+	return blocks, nil
+}
+
+func (c *VaultClient) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// authenticated calls f with a Vault token. If Vault rejects the token, which may have been revoked
+// before its lease expired, f is retried once with a new token.
+func (c *VaultClient) authenticated(ctx context.Context, f func(token string) error) error {
+	token, err := c.getToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = f(token)
+	var se *statusError
+	if !errors.As(err, &se) || se.code != http.StatusForbidden {
+		return err
+	}
+	vaultClientLog.Infof("vault token rejected, logging in again")
+	if token, err = c.getToken(ctx, true); err != nil {
+		return err
+	}
+	return f(token)
+}
+
+// getToken returns the cached Vault token, logging in if there is none, it is about to expire or
+// refresh is set.
+func (c *VaultClient) getToken(ctx context.Context, refresh bool) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if !refresh && c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+	jwt, err := os.ReadFile(c.config.JWTPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read JWT %s: %v", c.config.JWTPath, err)
+	}
+	req := map[string]string{
+		"role": c.config.AuthRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}
+	var resp loginResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", c.config.AuthPath), "", req, &resp); err != nil {
+		return "", fmt.Errorf("failed to log in to Vault with role %s: %v", c.config.AuthRole, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", errors.New("vault login returned no token")
+	}
+	c.token = resp.Auth.ClientToken
+	// A lease of 0 is a token that does not expire.
+	c.tokenExpiry = time.Now().Add(100 * 365 * 24 * time.Hour)
+	if lease := time.Duration(resp.Auth.LeaseDuration) * time.Second; lease > 0 {
+		c.tokenExpiry = time.Now().Add(lease - tokenRenewMargin)
+	}
+	return c.token, nil
+}
+
+// do sends req as JSON to path and decodes the JSON response into resp.
+func (c *VaultClient) do(ctx context.Context, method, path, token string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.config.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		httpReq.Header.Set(tokenHeader, token)
+	}
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var ve vaultError
+		_ = json.Unmarshal(data, &ve)
+		return &statusError{code: httpResp.StatusCode, errors: ve.Errors}
+	}
+	return json.Unmarshal(data, resp)
+}
@@ -0,0 +1,197 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeVault serves the Kubernetes auth login, PKI sign and CA chain endpoints of Vault.
+type fakeVault struct {
+	mu     sync.Mutex
+	logins int
+	token  string
+	csrs   []map[string]string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["role"] != "istio" || req["jwt"] != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.logins++
+		v.token = "vault-token-" + string(rune('0'+v.logins))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": v.token, "lease_duration": 3600},
+		})
+	case "/v1/pki/sign/istio":
+		if r.Header.Get(tokenHeader) != v.token {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		v.csrs = append(v.csrs, req)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"certificate": "leaf",
+				"issuing_ca":  "intermediate",
+				"ca_chain":    []string{"intermediate", "root"},
+			},
+		})
+	case "/v1/pki/ca_chain":
+		_, _ = w.Write([]byte(testIntermediate + testRoot))
+	case "/v1/pki/crl/pem":
+		_, _ = w.Write([]byte(testCRL))
+	case "/v1/pki_root/crl/pem":
+		_, _ = w.Write([]byte(testRootCRL))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+const (
+	testIntermediate = `-----BEGIN CERTIFICATE-----
+aW50ZXJtZWRpYXRl
+-----END CERTIFICATE-----
+`
+	testRoot = `-----BEGIN CERTIFICATE-----
+cm9vdA==
+-----END CERTIFICATE-----
+`
+	testCRL = `-----BEGIN X509 CRL-----
+Y3Js
+-----END X509 CRL-----
+`
+	testRootCRL = `-----BEGIN X509 CRL-----
+cm9vdCBjcmw=
+-----END X509 CRL-----
+`
+)
+
+func newTestClient(t *testing.T) (*VaultClient, *fakeVault) {
+	t.Helper()
+	vault := &fakeVault{}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtPath, []byte("token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewVaultClient(Config{
+		Address:  server.URL,
+		PKIPath:  "pki",
+		PKIRole:  "istio",
+		AuthPath: "kubernetes",
+		AuthRole: "istio",
+		JWTPath:  jwtPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client, vault
+}
+
+func TestCSRSign(t *testing.T) {
+	client, vault := newTestClient(t)
+	for i := 0; i < 2; i++ {
+		chain, err := client.CSRSign(context.Background(), []byte("csr"), 3600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"leaf", "intermediate", "root"}; !reflect.DeepEqual(chain, want) {
+			t.Fatalf("got chain %v, want %v", chain, want)
+		}
+	}
+	if vault.logins != 1 {
+		t.Fatalf("expected the token to be reused, got %d logins", vault.logins)
+	}
+	if want := (map[string]string{"csr": "csr", "ttl": "3600s", "format": "pem"}); !reflect.DeepEqual(vault.csrs[0], want) {
+		t.Fatalf("got sign request %v, want %v", vault.csrs[0], want)
+	}
+
+	// A revoked token is replaced.
+	vault.token = "revoked"
+	if _, err := client.CSRSign(context.Background(), []byte("csr"), 3600); err != nil {
+		t.Fatal(err)
+	}
+	if vault.logins != 2 {
+		t.Fatalf("expected a new login, got %d logins", vault.logins)
+	}
+}
+
+func TestGetRootCertBundle(t *testing.T) {
+	client, _ := newTestClient(t)
+	roots, err := client.GetRootCertBundle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testRoot}; !reflect.DeepEqual(roots, want) {
+		t.Fatalf("got roots %v, want %v", roots, want)
+	}
+}
+
+func TestCRL(t *testing.T) {
+	client, _ := newTestClient(t)
+	crl, err := client.CRL(context.Background())
+	if err != nil || crl != nil {
+		t.Fatalf("expected no CRL without CRL PKI paths, got %q, %v", crl, err)
+	}
+
+	client.config.CRLPKIPaths = []string{"pki", "pki_root"}
+	crl, err = client.CRL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testCRL + testRootCRL; string(crl) != want {
+		t.Fatalf("got CRL %q, want %q", crl, want)
+	}
+
+	client.config.CRLPKIPaths = []string{"missing"}
+	if _, err := client.CRL(context.Background()); err == nil {
+		t.Fatalf("expected an error for a missing PKI secrets engine")
+	}
+}
+
+func TestNewVaultClient(t *testing.T) {
+	if _, err := NewVaultClient(Config{Address: "vault:8200", PKIPath: "pki", PKIRole: "istio", AuthPath: "kubernetes", AuthRole: "istio"}); err == nil {
+		t.Fatal("expected a client without JWT path to be rejected")
+	}
+	client, err := NewVaultClient(Config{
+		Address: "vault:8200/", PKIPath: "pki", PKIRole: "istio", AuthPath: "kubernetes", AuthRole: "istio", JWTPath: "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.config.Address != "https://vault:8200" {
+		t.Fatalf("unexpected address %s", client.config.Address)
+	}
+}
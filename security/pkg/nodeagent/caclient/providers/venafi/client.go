@@ -0,0 +1,261 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var venafiClientLog = log.RegisterScope("venafi", "Venafi CA client debugging", 0)
+
+var (
+	platformEnv = env.RegisterStringVar("VENAFI_PLATFORM", PlatformTPP,
+		"The Venafi platform of the CA address: 'tpp' for Trust Protection Platform or 'cloud' for Venafi as a Service.").Get()
+	zoneEnv = env.RegisterStringVar("VENAFI_ZONE", "",
+		"The Venafi zone workload certificates are requested in: the policy folder DN for TPP, or "+
+			"'<application>\\<issuing template alias>' for Venafi as a Service.").Get()
+	credentialFileEnv = env.RegisterStringVar("VENAFI_CREDENTIAL_FILE", "",
+		"The file holding the OAuth access token for TPP, or the API key for Venafi as a Service.").Get()
+)
+
+const (
+	// PlatformTPP and PlatformCloud are the Venafi platforms of Config.Platform.
+	PlatformTPP   = "tpp"
+	PlatformCloud = "cloud"
+
+	// maxResponseSize bounds the responses read from Venafi.
+	maxResponseSize = 1 << 20
+	requestTimeout  = 30 * time.Second
+	// policyRefreshInterval is how long the policy of the zone is cached.
+	policyRefreshInterval = 10 * time.Minute
+)
+
+// pollInterval is how often pending certificate requests are checked.
+var pollInterval = 2 * time.Second
+
+// Config configures a Venafi CA client.
+type Config struct {
+	// URL is the base URL of TPP, or of the Venafi as a Service API.
+	URL string
+	// Platform is PlatformTPP or PlatformCloud.
+	Platform string
+	// Zone is the policy folder DN for TPP, or "<application>\<issuing template alias>" for Venafi
+	// as a Service.
+	Zone string
+	// CredentialFile holds the OAuth access token for TPP or the API key for Venafi as a Service. It
+	// is read on every request, so that the credential can be rotated.
+	CredentialFile string
+}
+
+// ConfigFromOptions returns the configuration of a Venafi CA client for an agent configured with
+// options, with the Venafi specific settings taken from the VENAFI_* environment variables.
+func ConfigFromOptions(options *security.Options) Config {
+	return Config{
+		URL:            options.CAEndpoint,
+		Platform:       platformEnv,
+		Zone:           zoneEnv,
+		CredentialFile: credentialFileEnv,
+	}
+}
+
+// connector requests certificates from a Venafi platform.
+type connector interface {
+	// policy returns the issuance policy of the zone.
+	policy(ctx context.Context) (*security.IssuancePolicy, error)
+	// request submits csrPEM and returns the identifier of the request.
+	request(ctx context.Context, csrPEM []byte, ttl time.Duration) (string, error)
+	// retrieve returns the PEM certificate chain of the request, leaf first, or nil if it is still
+	// pending.
+	retrieve(ctx context.Context, id string) ([]byte, error)
+}
+
+// VenafiClient signs workload CSRs through Venafi Trust Protection Platform or Venafi as a Service,
+// subject to the policy of the zone. The key type and TTL of the workload certificates follow the
+// policy, as reported to the agent with IssuancePolicy.
+type VenafiClient struct {
+	connector connector
+
+	// policyMu protects cachedPolicy and policyExpiry.
+	policyMu     sync.Mutex
+	cachedPolicy *security.IssuancePolicy
+	policyExpiry time.Time
+}
+
+var _ security.IssuancePolicySource = &VenafiClient{}
+
+// NewVenafiClient creates a CA client for the Venafi platform of config.
+func NewVenafiClient(config Config) (*VenafiClient, error) {
+	if config.URL == "" || config.Zone == "" {
+		return nil, errors.New("venafi URL and zone must be set")
+	}
+	if config.CredentialFile == "" {
+		return nil, errors.New("venafi credential file must be set")
+	}
+	if !strings.Contains(config.URL, "://") {
+		config.URL = "https://" + config.URL
+	}
+	api := &apiClient{
+		baseURL:        strings.TrimSuffix(config.URL, "/"),
+		credentialFile: config.CredentialFile,
+		client:         &http.Client{Timeout: requestTimeout},
+	}
+	c := &VenafiClient{}
+	switch config.Platform {
+	case PlatformTPP:
+		api.authorize = func(req *http.Request, credential string) {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		c.connector = &tppConnector{api: api, policyDN: config.Zone}
+	case PlatformCloud:
+		api.authorize = func(req *http.Request, credential string) {
+			req.Header.Set("tppl-api-key", credential)
+		}
+		parts := strings.SplitN(config.Zone, "\\", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid Venafi as a Service zone %q, expected <application>\\<issuing template alias>", config.Zone)
+		}
+		c.connector = &cloudConnector{api: api, application: parts[0], templateAlias: parts[1]}
+	default:
+		return nil, fmt.Errorf("unknown Venafi platform %q", config.Platform)
+	}
+	venafiClientLog.Debugf("initialized Venafi %s client for %s, zone %s", config.Platform, config.URL, config.Zone)
+	return c, nil
+}
+
+// IssuancePolicy returns the policy of the zone, refreshed every 10 minutes.
+func (c *VenafiClient) IssuancePolicy(ctx context.Context) (*security.IssuancePolicy, error) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	if c.cachedPolicy != nil && time.Now().Before(c.policyExpiry) {
+		return c.cachedPolicy, nil
+	}
+	policy, err := c.connector.policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cachedPolicy = policy
+	c.policyExpiry = time.Now().Add(policyRefreshInterval)
+	return policy, nil
+}
+
+// CSRSign requests a certificate for csrPEM, and waits for it to be issued.
+func (c *VenafiClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	id, err := c.connector.request(ctx, csrPEM, time.Duration(certValidTTLInSec)*time.Second)
+	if err != nil {
+		venafiClientLog.Errorf("failed to request certificate: %v", err)
+		return nil, err
+	}
+	venafiClientLog.Debugf("requested certificate %s", id)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		chain, err := c.connector.retrieve(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve certificate %s: %v", id, err)
+		}
+		if chain != nil {
+			certs := util.SplitCertificates(chain)
+			if len(certs) == 0 {
+				return nil, fmt.Errorf("no certificate in the response for %s", id)
+			}
+			return certs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetRootCertBundle returns no roots: the root is taken from the end of the chain returned by
+// CSRSign, which both platforms include.
+func (c *VenafiClient) GetRootCertBundle(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (c *VenafiClient) Close() {}
+
+// apiClient sends authenticated JSON requests to a Venafi API.
+type apiClient struct {
+	baseURL        string
+	credentialFile string
+	authorize      func(req *http.Request, credential string)
+	client         *http.Client
+}
+
+// statusError is returned for requests answered with an unexpected status.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("venafi returned status %d: %s", e.code, e.body)
+}
+
+// do sends req, as JSON if not nil, and returns the response body if its status is one of ok.
+func (a *apiClient) do(ctx context.Context, method, path string, req interface{}, ok ...int) (int, []byte, error) {
+	credential, err := os.ReadFile(a.credentialFile)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read Venafi credential: %v", err)
+	}
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if req != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	a.authorize(httpReq, strings.TrimSpace(string(credential)))
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp.StatusCode, data, nil
+		}
+	}
+	return resp.StatusCode, nil, &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(data))}
+}
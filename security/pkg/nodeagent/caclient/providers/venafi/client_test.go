@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	testLeaf = `-----BEGIN CERTIFICATE-----
+bGVhZg==
+-----END CERTIFICATE-----
+`
+	testRoot = `-----BEGIN CERTIFICATE-----
+cm9vdA==
+-----END CERTIFICATE-----
+`
+)
+
+func writeCredential(t *testing.T, credential string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "credential")
+	if err := os.WriteFile(path, []byte(credential+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakeTPP serves the web SDK endpoints of TPP used by the client. Certificates are pending on the
+// first retrieval.
+func fakeTPP(t *testing.T) *httptest.Server {
+	retrieved := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vedsdk/certificates/checkpolicy", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Policy":{"KeyPair":{"KeyAlgorithm":{"Locked":true,"Value":"RSA"},"KeySize":{"Locked":true,"Value":3072}}}}`))
+	})
+	mux.HandleFunc("/vedsdk/certificates/request", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["PolicyDN"] != `\VED\Policy\Istio` || req["PKCS10"] != "csr" {
+			t.Errorf("unexpected request %v", req)
+		}
+		_, _ = w.Write([]byte(`{"CertificateDN":"\\VED\\Policy\\Istio\\workload"}`))
+	})
+	mux.HandleFunc("/vedsdk/certificates/retrieve", func(w http.ResponseWriter, r *http.Request) {
+		if retrieved++; retrieved == 1 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data := base64.StdEncoding.EncodeToString([]byte(testLeaf + testRoot))
+		_ = json.NewEncoder(w).Encode(map[string]string{"CertificateData": data})
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+// fakeVaaS serves the Venafi as a Service endpoints used by the client.
+func fakeVaaS(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/outagedetection/v1/applications/name/istio", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"app-id"}`))
+	})
+	mux.HandleFunc("/outagedetection/v1/applications/name/istio/certificateissuingtemplates/workloads", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"template-id","keyTypes":[{"keyType":"EC","keyCurves":["P256"]},` +
+			`{"keyType":"RSA","keyLengths":[4096,2048]}],"product":{"validityPeriod":"P1D"}}`))
+	})
+	mux.HandleFunc("/outagedetection/v1/certificaterequests", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["applicationId"] != "app-id" || req["certificateIssuingTemplateId"] != "template-id" || req["validityPeriod"] != "PT3600S" {
+			t.Errorf("unexpected request %v", req)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"certificateRequests":[{"id":"request-id","status":"PENDING"}]}`))
+	})
+	mux.HandleFunc("/outagedetection/v1/certificaterequests/request-id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"request-id","status":"ISSUED","certificateIds":["cert-id"]}`))
+	})
+	mux.HandleFunc("/outagedetection/v1/certificates/cert-id/contents", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chainOrder") != "EE_FIRST" {
+			t.Errorf("unexpected query %v", r.URL.Query())
+		}
+		_, _ = w.Write([]byte(testLeaf + testRoot))
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("tppl-api-key") != "api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestVenafiClient(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	cases := []struct {
+		name       string
+		server     func(*testing.T) *httptest.Server
+		platform   string
+		zone       string
+		credential string
+		policy     *security.IssuancePolicy
+	}{
+		{
+			name:       "tpp",
+			server:     fakeTPP,
+			platform:   PlatformTPP,
+			zone:       `\VED\Policy\Istio`,
+			credential: "token",
+			policy: &security.IssuancePolicy{
+				AllowedKeyAlgorithms: []string{security.RSAKeyAlgorithm},
+				MinRSAKeySize:        3072,
+			},
+		},
+		{
+			name:       "cloud",
+			server:     fakeVaaS,
+			platform:   PlatformCloud,
+			zone:       `istio\workloads`,
+			credential: "api-key",
+			policy: &security.IssuancePolicy{
+				MaxTTL:               24 * time.Hour,
+				AllowedKeyAlgorithms: []string{security.ECDSAKeyAlgorithm, security.RSAKeyAlgorithm},
+				MinRSAKeySize:        2048,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := tc.server(t)
+			defer server.Close()
+			client, err := NewVenafiClient(Config{
+				URL:            server.URL,
+				Platform:       tc.platform,
+				Zone:           tc.zone,
+				CredentialFile: writeCredential(t, tc.credential),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy, err := client.IssuancePolicy(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(policy, tc.policy) {
+				t.Errorf("expected policy %+v, got %+v", tc.policy, policy)
+			}
+			chain, err := client.CSRSign(context.Background(), []byte("csr"), 3600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(chain, []string{testLeaf, testRoot}) {
+				t.Errorf("unexpected chain %v", chain)
+			}
+		})
+	}
+}
+
+func TestVenafiClientUnauthorized(t *testing.T) {
+	server := fakeTPP(t)
+	defer server.Close()
+	client, err := NewVenafiClient(Config{
+		URL:            server.URL,
+		Platform:       PlatformTPP,
+		Zone:           `\VED\Policy\Istio`,
+		CredentialFile: writeCredential(t, "expired"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CSRSign(context.Background(), []byte("csr"), 3600); err == nil {
+		t.Fatal("expected the request to be rejected")
+	}
+}
+
+func TestParseISO8601Duration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"P90D":    90 * 24 * time.Hour,
+		"PT12H":   12 * time.Hour,
+		"P1DT30M": 24*time.Hour + 30*time.Minute,
+		"P1Y":     365 * 24 * time.Hour,
+	}
+	for in, want := range cases {
+		got, err := parseISO8601Duration(in)
+		if err != nil || got != want {
+			t.Errorf("parseISO8601Duration(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "P", "PT", "90D", "P1H"} {
+		if _, err := parseISO8601Duration(in); err == nil {
+			t.Errorf("expected %q to be invalid", in)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+// cloudConnector requests certificates from Venafi as a Service, through an issuing template of an
+// application.
+type cloudConnector struct {
+	api           *apiClient
+	application   string
+	templateAlias string
+
+	// mu protects applicationID and templateID, resolved on first use.
+	mu            sync.Mutex
+	applicationID string
+	templateID    string
+}
+
+type cloudTemplate struct {
+	ID       string `json:"id"`
+	KeyTypes []struct {
+		KeyType    string `json:"keyType"`
+		KeyLengths []int  `json:"keyLengths"`
+	} `json:"keyTypes"`
+	Product struct {
+		ValidityPeriod string `json:"validityPeriod"`
+	} `json:"product"`
+}
+
+func (c *cloudConnector) template(ctx context.Context) (*cloudTemplate, error) {
+	path := fmt.Sprintf("/outagedetection/v1/applications/name/%s/certificateissuingtemplates/%s",
+		url.PathEscape(c.application), url.PathEscape(c.templateAlias))
+	_, data, err := c.api.do(ctx, http.MethodGet, path, nil, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issuing template %s of application %s: %v", c.templateAlias, c.application, err)
+	}
+	var tmpl cloudTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// ids returns the identifiers of the application and of its issuing template.
+func (c *cloudConnector) ids(ctx context.Context) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.applicationID != "" {
+		return c.applicationID, c.templateID, nil
+	}
+	_, data, err := c.api.do(ctx, http.MethodGet, "/outagedetection/v1/applications/name/"+url.PathEscape(c.application), nil, http.StatusOK)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get application %s: %v", c.application, err)
+	}
+	var app struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &app); err != nil {
+		return "", "", err
+	}
+	tmpl, err := c.template(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	c.applicationID, c.templateID = app.ID, tmpl.ID
+	return c.applicationID, c.templateID, nil
+}
+
+func (c *cloudConnector) policy(ctx context.Context) (*security.IssuancePolicy, error) {
+	tmpl, err := c.template(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy := &security.IssuancePolicy{}
+	minRSAKeySize := 0
+	for _, kt := range tmpl.KeyTypes {
+		switch strings.ToUpper(kt.KeyType) {
+		case "RSA":
+			policy.AllowedKeyAlgorithms = append(policy.AllowedKeyAlgorithms, security.RSAKeyAlgorithm)
+			for _, l := range kt.KeyLengths {
+				if minRSAKeySize == 0 || l < minRSAKeySize {
+					minRSAKeySize = l
+				}
+			}
+		case "EC":
+			policy.AllowedKeyAlgorithms = append(policy.AllowedKeyAlgorithms, security.ECDSAKeyAlgorithm)
+		}
+	}
+	policy.MinRSAKeySize = minRSAKeySize
+	if tmpl.Product.ValidityPeriod != "" {
+		maxTTL, err := parseISO8601Duration(tmpl.Product.ValidityPeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validity period of issuing template %s: %v", c.templateAlias, err)
+		}
+		policy.MaxTTL = maxTTL
+	}
+	return policy, nil
+}
+
+func (c *cloudConnector) request(ctx context.Context, csrPEM []byte, ttl time.Duration) (string, error) {
+	applicationID, templateID, err := c.ids(ctx)
+	if err != nil {
+		return "", err
+	}
+	req := map[string]interface{}{
+		"certificateSigningRequest":    string(csrPEM),
+		"applicationId":                applicationID,
+		"certificateIssuingTemplateId": templateID,
+	}
+	if ttl > 0 {
+		req["validityPeriod"] = fmt.Sprintf("PT%dS", int64(ttl.Seconds()))
+	}
+	_, data, err := c.api.do(ctx, http.MethodPost, "/outagedetection/v1/certificaterequests", req, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		CertificateRequests []struct {
+			ID string `json:"id"`
+		} `json:"certificateRequests"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.CertificateRequests) == 0 || resp.CertificateRequests[0].ID == "" {
+		return "", fmt.Errorf("no certificate request in the response")
+	}
+	return resp.CertificateRequests[0].ID, nil
+}
+
+func (c *cloudConnector) retrieve(ctx context.Context, id string) ([]byte, error) {
+	_, data, err := c.api.do(ctx, http.MethodGet, "/outagedetection/v1/certificaterequests/"+url.PathEscape(id), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var req struct {
+		Status           string   `json:"status"`
+		CertificateIDs   []string `json:"certificateIds"`
+		ErrorInformation struct {
+			Message string `json:"message"`
+		} `json:"errorInformation"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	switch req.Status {
+	case "ISSUED":
+	case "FAILED", "REJECTED", "CANCELLED":
+		return nil, fmt.Errorf("certificate request is %s: %s", req.Status, req.ErrorInformation.Message)
+	default:
+		return nil, nil
+	}
+	if len(req.CertificateIDs) == 0 {
+		return nil, fmt.Errorf("no certificate in the issued request")
+	}
+	path := fmt.Sprintf("/outagedetection/v1/certificates/%s/contents?format=PEM&chainOrder=EE_FIRST", url.PathEscape(req.CertificateIDs[0]))
+	_, chain, err := c.api.do(ctx, http.MethodGet, path, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+var iso8601Duration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISO8601Duration parses the validity periods of issuing templates, e.g. "P90D". Years and
+// months are counted as 365 and 30 days.
+func parseISO8601Duration(s string) (time.Duration, error) {
+	m := iso8601Duration.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"istio.io/istio/pkg/security"
+)
+
+// tppConnector requests certificates from the web SDK of Venafi Trust Protection Platform. TPP
+// decides the validity of the certificates from the CA template of the policy folder, so the
+// requested TTL is not sent.
+type tppConnector struct {
+	api      *apiClient
+	policyDN string
+}
+
+type tppLockedValue struct {
+	Locked bool        `json:"Locked"`
+	Value  interface{} `json:"Value"`
+}
+
+type tppPolicyResponse struct {
+	Error  string `json:"Error"`
+	Policy struct {
+		KeyPair struct {
+			KeyAlgorithm tppLockedValue `json:"KeyAlgorithm"`
+			KeySize      tppLockedValue `json:"KeySize"`
+		} `json:"KeyPair"`
+	} `json:"Policy"`
+}
+
+func (t *tppConnector) policy(ctx context.Context) (*security.IssuancePolicy, error) {
+	_, data, err := t.api.do(ctx, http.MethodPost, "/vedsdk/certificates/checkpolicy",
+		map[string]string{"PolicyDN": t.policyDN}, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy of %s: %v", t.policyDN, err)
+	}
+	var resp tppPolicyResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("failed to get policy of %s: %s", t.policyDN, resp.Error)
+	}
+	policy := &security.IssuancePolicy{}
+	// Settings that are not locked are defaults that requests may override.
+	if alg := resp.Policy.KeyPair.KeyAlgorithm; alg.Locked {
+		switch v, _ := alg.Value.(string); strings.ToUpper(v) {
+		case "RSA":
+			policy.AllowedKeyAlgorithms = []string{security.RSAKeyAlgorithm}
+		case "EC", "ECC", "ECDSA":
+			policy.AllowedKeyAlgorithms = []string{security.ECDSAKeyAlgorithm}
+		}
+	}
+	if size := resp.Policy.KeyPair.KeySize; size.Locked {
+		if v, ok := size.Value.(float64); ok {
+			policy.MinRSAKeySize = int(v)
+		}
+	}
+	return policy, nil
+}
+
+func (t *tppConnector) request(ctx context.Context, csrPEM []byte, _ time.Duration) (string, error) {
+	req := map[string]interface{}{
+		"PolicyDN":                t.policyDN,
+		"PKCS10":                  string(csrPEM),
+		"ObjectName":              "istio-" + rand.String(16),
+		"DisableAutomaticRenewal": true,
+	}
+	_, data, err := t.api.do(ctx, http.MethodPost, "/vedsdk/certificates/request", req, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		CertificateDN string `json:"CertificateDN"`
+		Error         string `json:"Error"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	if resp.CertificateDN == "" {
+		return "", fmt.Errorf("certificate request rejected: %s", resp.Error)
+	}
+	return resp.CertificateDN, nil
+}
+
+func (t *tppConnector) retrieve(ctx context.Context, id string) ([]byte, error) {
+	req := map[string]interface{}{
+		"CertificateDN":  id,
+		"Format":         "Base64",
+		"IncludeChain":   true,
+		"RootFirstOrder": false,
+	}
+	// TPP answers 202 while the certificate is being issued.
+	code, data, err := t.api.do(ctx, http.MethodPost, "/vedsdk/certificates/retrieve", req, http.StatusOK, http.StatusAccepted)
+	if err != nil || code == http.StatusAccepted {
+		return nil, err
+	}
+	var resp struct {
+		CertificateData string `json:"CertificateData"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.CertificateData)
+}
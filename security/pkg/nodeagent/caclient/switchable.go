@@ -0,0 +1,88 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"sync"
+
+	"istio.io/istio/pkg/security"
+)
+
+// SwitchableClient is a CA client whose underlying client can be replaced while in use, for example
+// when the CA endpoint is reloaded.
+type SwitchableClient struct {
+	mu     sync.RWMutex
+	client security.Client
+}
+
+var _ security.Client = &SwitchableClient{}
+
+// NewSwitchableClient returns a SwitchableClient using client until it is switched.
+func NewSwitchableClient(client security.Client) *SwitchableClient {
+	return &SwitchableClient{client: client}
+}
+
+// Switch replaces the underlying client by client, and closes the previous one. Requests in flight on
+// the previous client fail, and are retried on client.
+func (c *SwitchableClient) Switch(client security.Client) {
+	c.mu.Lock()
+	previous := c.client
+	c.client = client
+	c.mu.Unlock()
+	previous.Close()
+}
+
+func (c *SwitchableClient) current() security.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+func (c *SwitchableClient) CSRSign(ctx context.Context, csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	return c.current().CSRSign(ctx, csrPEM, certValidTTLInSec)
+}
+
+func (c *SwitchableClient) GetRootCertBundle(ctx context.Context) ([]string, error) {
+	return c.current().GetRootCertBundle(ctx)
+}
+
+func (c *SwitchableClient) Close() {
+	c.current().Close()
+}
+
+// IssuancePolicy returns the issuance policy of the current client, if any.
+func (c *SwitchableClient) IssuancePolicy(ctx context.Context) (*security.IssuancePolicy, error) {
+	if p, ok := c.current().(security.IssuancePolicySource); ok {
+		return p.IssuancePolicy(ctx)
+	}
+	return nil, nil
+}
+
+// CRL returns the CRLs of the current client, if any.
+func (c *SwitchableClient) CRL(ctx context.Context) ([]byte, error) {
+	if s, ok := c.current().(security.CRLSource); ok {
+		return s.CRL(ctx)
+	}
+	return nil, nil
+}
+
+// SignJWTSVID returns a JWT SVID from the current client, if it issues them.
+func (c *SwitchableClient) SignJWTSVID(ctx context.Context, audience string) (string, error) {
+	if s, ok := c.current().(security.JWTSVIDSigner); ok {
+		return s.SignJWTSVID(ctx, audience)
+	}
+	return "", security.ErrJWTSVIDNotSupported
+}
@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"testing"
+)
+
+// endpointClient returns its endpoint as the root certificate bundle.
+type endpointClient struct {
+	endpoint string
+	closed   bool
+}
+
+func (c *endpointClient) CSRSign(context.Context, []byte, int64) ([]string, error) {
+	return []string{c.endpoint}, nil
+}
+
+func (c *endpointClient) GetRootCertBundle(context.Context) ([]string, error) {
+	return []string{c.endpoint}, nil
+}
+
+func (c *endpointClient) Close() {
+	c.closed = true
+}
+
+func TestSwitchableClient(t *testing.T) {
+	first := &endpointClient{endpoint: "first"}
+	c := NewSwitchableClient(first)
+	if roots, _ := c.GetRootCertBundle(context.Background()); roots[0] != "first" {
+		t.Fatalf("expected the first client, got %v", roots)
+	}
+	second := &endpointClient{endpoint: "second"}
+	c.Switch(second)
+	if !first.closed {
+		t.Fatalf("expected the previous client to be closed")
+	}
+	if chain, _ := c.CSRSign(context.Background(), nil, 0); chain[0] != "second" {
+		t.Fatalf("expected the second client, got %v", chain)
+	}
+	if crl, err := c.CRL(context.Background()); crl != nil || err != nil {
+		t.Fatalf("expected no CRL, got %v, %v", crl, err)
+	}
+	c.Close()
+	if !second.closed {
+		t.Fatalf("expected the current client to be closed")
+	}
+}
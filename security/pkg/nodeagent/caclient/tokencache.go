@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/util"
+)
+
+const (
+	// DefaultExchangedTokenTTL is how long exchanged tokens of unknown expiry are cached.
+	DefaultExchangedTokenTTL = 5 * time.Minute
+	// exchangedTokenRefreshMargin is how long before their expiry exchanged tokens are refreshed, at
+	// most half of their lifetime.
+	exchangedTokenRefreshMargin = time.Minute
+	// tokenExchangeTimeout bounds the exchanges shared by concurrent callers, which are not cancelled
+	// with the request of any of them.
+	tokenExchangeTimeout = 30 * time.Second
+)
+
+// CachingTokenExchanger is a TokenExchanger caching the tokens exchanged by another one, keyed by the
+// hash of the subject token, until shortly before they expire. Concurrent exchanges of the same subject
+// token share a single request, so that CSRs close together do not each make a round trip to the STS.
+type CachingTokenExchanger struct {
+	exchanger  security.TokenExchanger
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]exchangedToken
+	group  singleflight.Group
+}
+
+type exchangedToken struct {
+	token     string
+	refreshAt time.Time
+	expiry    time.Time
+}
+
+var _ security.TokenExchanger = &CachingTokenExchanger{}
+
+// NewCachingTokenExchanger returns a CachingTokenExchanger of exchanger. The expiry of the exchanged
+// tokens is the one reported by exchanger if it is a security.ExpiringTokenExchanger, else the exp
+// claim of the tokens if they are JWTs, else defaultTTL after the exchange.
+func NewCachingTokenExchanger(exchanger security.TokenExchanger, defaultTTL time.Duration) *CachingTokenExchanger {
+	return &CachingTokenExchanger{
+		exchanger:  exchanger,
+		defaultTTL: defaultTTL,
+		now:        time.Now,
+		tokens:     map[string]exchangedToken{},
+	}
+}
+
+// ExchangeToken returns the cached exchanged token of subjectToken, exchanging it if it is not cached or
+// about to expire. The exchange runs under its own timeout rather than ctx, as it is shared with the
+// concurrent callers: it returns when ctx is cancelled, while the exchange goes on for the others.
+func (c *CachingTokenExchanger) ExchangeToken(ctx context.Context, subjectToken string) (string, error) {
+	sum := sha256.Sum256([]byte(subjectToken))
+	key := hex.EncodeToString(sum[:])
+	if token, ok := c.get(key); ok {
+		return token, nil
+	}
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		// The token may have been exchanged by a flight that ended since the cache was checked.
+		if token, ok := c.get(key); ok {
+			return token, nil
+		}
+		exchangeCtx, cancel := context.WithTimeout(context.Background(), tokenExchangeTimeout)
+		defer cancel()
+		token, expiry, err := c.exchange(exchangeCtx, subjectToken)
+		if err != nil {
+			return "", err
+		}
+		c.put(key, token, expiry)
+		return token, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (c *CachingTokenExchanger) exchange(ctx context.Context, subjectToken string) (string, time.Time, error) {
+	if exchanger, ok := c.exchanger.(security.ExpiringTokenExchanger); ok {
+		token, expiry, err := exchanger.ExchangeTokenWithExpiry(ctx, subjectToken)
+		if err != nil || !expiry.IsZero() {
+			return token, expiry, err
+		}
+		return token, c.expiry(token), nil
+	}
+	token, err := c.exchanger.ExchangeToken(ctx, subjectToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, c.expiry(token), nil
+}
+
+// expiry returns the expiry of a token whose expiry was not reported by the exchanger.
+func (c *CachingTokenExchanger) expiry(token string) time.Time {
+	if exp, err := util.GetExp(token); err == nil && !exp.IsZero() {
+		return exp
+	}
+	return c.now().Add(c.defaultTTL)
+}
+
+func (c *CachingTokenExchanger) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tokens[key]
+	if !ok || !c.now().Before(t.refreshAt) {
+		return "", false
+	}
+	return t.token, true
+}
+
+func (c *CachingTokenExchanger) put(key, token string, expiry time.Time) {
+	now := c.now()
+	margin := exchangedTokenRefreshMargin
+	if lifetime := expiry.Sub(now); lifetime < 2*margin {
+		margin = lifetime / 2
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop the tokens of subject tokens which are no longer used, e.g. after their rotation.
+	for k, t := range c.tokens {
+		if !now.Before(t.expiry) {
+			delete(c.tokens, k)
+		}
+	}
+	c.tokens[key] = exchangedToken{token: token, refreshAt: expiry.Add(-margin), expiry: expiry}
+}
@@ -0,0 +1,197 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingExchanger exchanges subject tokens for "<subject>-<n>", n counting the exchanges, expiring
+// after ttl if set.
+type countingExchanger struct {
+	exchanges int32
+	ttl       time.Duration
+	err       error
+	// block, if set, blocks the exchanges until closed.
+	block chan struct{}
+}
+
+func (e *countingExchanger) ExchangeToken(ctx context.Context, subjectToken string) (string, error) {
+	token, _, err := e.ExchangeTokenWithExpiry(ctx, subjectToken)
+	return token, err
+}
+
+func (e *countingExchanger) ExchangeTokenWithExpiry(ctx context.Context, subjectToken string) (string, time.Time, error) {
+	if e.block != nil {
+		<-e.block
+	}
+	if err := ctx.Err(); err != nil {
+		return "", time.Time{}, err
+	}
+	n := atomic.AddInt32(&e.exchanges, 1)
+	if e.err != nil {
+		return "", time.Time{}, e.err
+	}
+	var expiry time.Time
+	if e.ttl != 0 {
+		expiry = time.Now().Add(e.ttl)
+	}
+	return fmt.Sprintf("%s-%d", subjectToken, n), expiry, nil
+}
+
+// plainExchanger only implements TokenExchanger, returning token.
+type plainExchanger struct {
+	token     string
+	exchanges int
+}
+
+func (e *plainExchanger) ExchangeToken(context.Context, string) (string, error) {
+	e.exchanges++
+	return e.token, nil
+}
+
+func TestCachingTokenExchanger(t *testing.T) {
+	ctx := context.Background()
+	exchanger := &countingExchanger{ttl: time.Hour}
+	c := NewCachingTokenExchanger(exchanger, DefaultExchangedTokenTTL)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if token, err := c.ExchangeToken(ctx, "a"); err != nil || token != "a-1" {
+			t.Fatalf("got %q, %v, expected the cached a-1", token, err)
+		}
+	}
+	if token, _ := c.ExchangeToken(ctx, "b"); token != "b-2" {
+		t.Fatalf("got %q, expected b to be exchanged", token)
+	}
+	// The token is refreshed before it expires. The expiry is set with the real clock, slightly later.
+	now = now.Add(time.Hour - exchangedTokenRefreshMargin + time.Second)
+	if token, _ := c.ExchangeToken(ctx, "a"); token != "a-3" {
+		t.Fatalf("got %q, expected a to be refreshed", token)
+	}
+}
+
+func TestCachingTokenExchangerSingleFlight(t *testing.T) {
+	exchanger := &countingExchanger{ttl: time.Hour, block: make(chan struct{})}
+	c := NewCachingTokenExchanger(exchanger, DefaultExchangedTokenTTL)
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = c.ExchangeToken(context.Background(), "a")
+		}(i)
+	}
+	// Let the callers join the flight before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(exchanger.block)
+	wg.Wait()
+	if n := atomic.LoadInt32(&exchanger.exchanges); n != 1 {
+		t.Fatalf("got %d exchanges, expected 1", n)
+	}
+	for _, token := range tokens {
+		if token != "a-1" {
+			t.Fatalf("got tokens %v, expected a-1", tokens)
+		}
+	}
+}
+
+func TestCachingTokenExchangerCancelledCaller(t *testing.T) {
+	exchanger := &countingExchanger{ttl: time.Hour, block: make(chan struct{})}
+	c := NewCachingTokenExchanger(exchanger, DefaultExchangedTokenTTL)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.ExchangeToken(ctx, "a")
+		first <- err
+	}()
+	second := make(chan string, 1)
+	go func() {
+		token, _ := c.ExchangeToken(context.Background(), "a")
+		second <- token
+	}()
+	// Let the callers join the flight, then abandon the one which started it.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, expected the cancelled caller to return", err)
+	}
+	close(exchanger.block)
+	if token := <-second; token != "a-1" {
+		t.Fatalf("got %q, expected the exchange to complete for the other caller", token)
+	}
+}
+
+func TestCachingTokenExchangerErrors(t *testing.T) {
+	exchanger := &countingExchanger{err: errors.New("unavailable")}
+	c := NewCachingTokenExchanger(exchanger, DefaultExchangedTokenTTL)
+	for i := 0; i < 2; i++ {
+		if _, err := c.ExchangeToken(context.Background(), "a"); err == nil {
+			t.Fatal("expected the exchange to fail")
+		}
+	}
+	if n := atomic.LoadInt32(&exchanger.exchanges); n != 2 {
+		t.Fatalf("got %d exchanges, expected failures not to be cached", n)
+	}
+
+	blocked := &countingExchanger{block: make(chan struct{})}
+	defer close(blocked.block)
+	c = NewCachingTokenExchanger(blocked, DefaultExchangedTokenTTL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.ExchangeToken(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected the exchange to be abandoned", err)
+	}
+}
+
+func TestCachingTokenExchangerExpiry(t *testing.T) {
+	claims := fmt.Sprintf(`{"exp":%d}`, time.Now().Add(30*time.Second).Unix())
+	jwt := "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	for name, tc := range map[string]struct {
+		token string
+		// refreshed is the time after which the token is expected to be refreshed.
+		refreshed time.Duration
+	}{
+		"JWT exp":     {token: jwt, refreshed: 15 * time.Second},
+		"default TTL": {token: "opaque", refreshed: DefaultExchangedTokenTTL - exchangedTokenRefreshMargin},
+	} {
+		t.Run(name, func(t *testing.T) {
+			exchanger := &plainExchanger{token: tc.token}
+			c := NewCachingTokenExchanger(exchanger, DefaultExchangedTokenTTL)
+			now := time.Now()
+			c.now = func() time.Time { return now }
+			_, _ = c.ExchangeToken(context.Background(), "a")
+			now = now.Add(tc.refreshed - 2*time.Second)
+			_, _ = c.ExchangeToken(context.Background(), "a")
+			if exchanger.exchanges != 1 {
+				t.Fatalf("got %d exchanges, expected the token to be cached", exchanger.exchanges)
+			}
+			now = now.Add(2 * time.Second)
+			_, _ = c.ExchangeToken(context.Background(), "a")
+			if exchanger.exchanges != 2 {
+				t.Fatalf("got %d exchanges, expected the token to be refreshed", exchanger.exchanges)
+			}
+		})
+	}
+}
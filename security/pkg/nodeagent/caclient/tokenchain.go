@@ -0,0 +1,65 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"fmt"
+
+	"istio.io/istio/pkg/security"
+)
+
+// TokenExchangeStage is a named stage of a TokenExchangerChain.
+type TokenExchangeStage struct {
+	// Name identifies the stage in the errors of the chain, e.g. "azure".
+	Name      string
+	Exchanger security.TokenExchanger
+}
+
+// TokenExchangerChain is a TokenExchanger exchanging the token through a pipeline of exchangers, each
+// exchanging the token of the previous one, e.g. a Kubernetes token for a federation token, and the
+// federation token for an access token of the CA provider.
+type TokenExchangerChain struct {
+	stages []TokenExchangeStage
+}
+
+var _ security.TokenExchanger = &TokenExchangerChain{}
+
+// NewTokenExchangerChain returns a chain of stages. The exchangers of the stages are wrapped in a
+// CachingTokenExchanger, unless they already are one, so that a stage is not repeated while its token
+// is valid, even if a later stage has to be.
+func NewTokenExchangerChain(stages ...TokenExchangeStage) *TokenExchangerChain {
+	c := &TokenExchangerChain{}
+	for _, stage := range stages {
+		if _, ok := stage.Exchanger.(*CachingTokenExchanger); !ok {
+			stage.Exchanger = NewCachingTokenExchanger(stage.Exchanger, DefaultExchangedTokenTTL)
+		}
+		c.stages = append(c.stages, stage)
+	}
+	return c
+}
+
+// ExchangeToken exchanges token through all the stages. The error of a failed stage names the stage,
+// and keeps the retryable or fatal classification of the stage error.
+func (c *TokenExchangerChain) ExchangeToken(ctx context.Context, token string) (string, error) {
+	for i, stage := range c.stages {
+		exchanged, err := stage.Exchanger.ExchangeToken(ctx, token)
+		if err != nil {
+			return "", fmt.Errorf("token exchange stage %d (%s) failed: %w", i+1, stage.Name, err)
+		}
+		token = exchanged
+	}
+	return token, nil
+}
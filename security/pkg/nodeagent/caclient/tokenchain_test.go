@@ -0,0 +1,59 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestTokenExchangerChain(t *testing.T) {
+	federation := &countingExchanger{ttl: time.Hour}
+	provider := &countingExchanger{ttl: time.Hour}
+	chain := NewTokenExchangerChain(
+		TokenExchangeStage{Name: "federation", Exchanger: federation},
+		TokenExchangeStage{Name: "provider", Exchanger: provider},
+	)
+	for i := 0; i < 2; i++ {
+		token, err := chain.ExchangeToken(context.Background(), "k8s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "k8s-1-1" {
+			t.Fatalf("got %q, expected the token of each stage to be exchanged by the next one", token)
+		}
+	}
+	if atomic.LoadInt32(&federation.exchanges) != 1 || atomic.LoadInt32(&provider.exchanges) != 1 {
+		t.Fatalf("expected each stage to be cached, got %d and %d exchanges", federation.exchanges, provider.exchanges)
+	}
+
+	failing := NewTokenExchangerChain(
+		TokenExchangeStage{Name: "federation", Exchanger: &countingExchanger{ttl: time.Hour}},
+		TokenExchangeStage{Name: "provider", Exchanger: &countingExchanger{err: security.NewFatalError(errors.New("invalid audience"))}},
+	)
+	_, err := failing.ExchangeToken(context.Background(), "k8s")
+	if err == nil || !strings.Contains(err.Error(), "stage 2 (provider)") {
+		t.Fatalf("got %v, expected the failed stage to be named", err)
+	}
+	if !security.IsFatalError(err) {
+		t.Fatalf("got %v, expected the fatal error of the stage to stay fatal", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package certstatus serves the status of the certificates of the agent over gRPC, as a stable
+// programmatic alternative to the debug endpoints for node daemons and tooling.
+package certstatus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/uds"
+	pb "istio.io/istio/security/proto/certstatus"
+	"istio.io/pkg/log"
+)
+
+var certStatusLog = log.RegisterScope("certstatus", "certificate status API debugging", 0)
+
+// StatusSource reports the status of the resources generated by a SecretManager.
+type StatusSource interface {
+	CertificateStatus() []security.CertificateStatus
+}
+
+// RotationController pauses and resumes the automatic rotation of the resources of a SecretManager.
+// The rotation RPCs are unimplemented if the StatusSource is not a RotationController.
+type RotationController interface {
+	HoldRotation(resourceName string, duration time.Duration) (time.Time, error)
+	ReleaseRotation(resourceName string)
+}
+
+// CertificateSource returns the certificates of the resources of a SecretManager. GetCertificate is
+// unimplemented if the StatusSource is not a CertificateSource.
+type CertificateSource interface {
+	GenerateSecret(resourceName string) (*security.SecretItem, error)
+}
+
+// Renewer rotates the certificates of a SecretManager on demand. RenewCertificate is unimplemented if
+// the StatusSource is not a Renewer.
+type Renewer interface {
+	RenewCertificate(resourceName string) error
+}
+
+// Server is the gRPC server that exposes the certificate status API through UDS. The socket is only
+// accessible to the user of the agent and to root.
+type Server struct {
+	pb.UnimplementedCertificateStatusServer
+
+	source     StatusSource
+	grpcServer *grpc.Server
+	listener   net.Listener
+}
+
+// NewServer creates and starts the certificate status server, listening on path.
+func NewServer(path string, source StatusSource) (*Server, error) {
+	listener, err := uds.NewListener(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict %q permission: %v", path, err)
+	}
+	s := &Server{
+		source:     source,
+		grpcServer: grpc.NewServer(),
+		listener:   listener,
+	}
+	pb.RegisterCertificateStatusServer(s.grpcServer, s)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			certStatusLog.Errorf("certificate status server failed: %v", err)
+		}
+	}()
+	certStatusLog.Infof("certificate status server started, listening on %q", path)
+	return s, nil
+}
+
+// Stop closes the gRPC server.
+func (s *Server) Stop() {
+	if s == nil {
+		return
+	}
+	s.grpcServer.Stop()
+	s.listener.Close()
+}
+
+// GetCertificateStatus returns the status of the requested resources.
+func (s *Server) GetCertificateStatus(_ context.Context, req *pb.GetCertificateStatusRequest) (*pb.GetCertificateStatusResponse, error) {
+	requested := map[string]bool{}
+	for _, name := range req.ResourceNames {
+		requested[name] = true
+	}
+	resp := &pb.GetCertificateStatusResponse{}
+	for _, status := range s.source.CertificateStatus() {
+		if len(requested) > 0 && !requested[status.ResourceName] {
+			continue
+		}
+		resp.Resources = append(resp.Resources, &pb.ResourceStatus{
+			ResourceName:           status.ResourceName,
+			SerialNumber:           status.SerialNumber,
+			ExpireTime:             timestamp(status.ExpireTime),
+			LastRotationTime:       timestamp(status.LastRotationTime),
+			LastError:              status.LastError,
+			LastErrorTime:          timestamp(status.LastErrorTime),
+			RotationHoldExpireTime: timestamp(status.RotationHeldUntil),
+		})
+	}
+	return resp, nil
+}
+
+// HoldRotation pauses the automatic rotation of the requested resource, or of all the resources.
+func (s *Server) HoldRotation(_ context.Context, req *pb.HoldRotationRequest) (*pb.HoldRotationResponse, error) {
+	controller, ok := s.source.(RotationController)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "rotation hold is not supported")
+	}
+	if req.Duration == nil {
+		return nil, status.Error(codes.InvalidArgument, "rotation hold duration is required")
+	}
+	until, err := controller.HoldRotation(req.ResourceName, req.Duration.AsDuration())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &pb.HoldRotationResponse{ExpireTime: timestamppb.New(until)}, nil
+}
+
+// ReleaseRotation releases the hold on the rotation of the requested resource, or of all the resources.
+func (s *Server) ReleaseRotation(_ context.Context, req *pb.ReleaseRotationRequest) (*pb.ReleaseRotationResponse, error) {
+	controller, ok := s.source.(RotationController)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "rotation hold is not supported")
+	}
+	controller.ReleaseRotation(req.ResourceName)
+	return &pb.ReleaseRotationResponse{}, nil
+}
+
+// GetCertificate returns the certificate chain and root certificates of the requested resource.
+func (s *Server) GetCertificate(_ context.Context, req *pb.GetCertificateRequest) (*pb.GetCertificateResponse, error) {
+	source, ok := s.source.(CertificateSource)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "certificate retrieval is not supported")
+	}
+	if req.ResourceName == "" {
+		return nil, status.Error(codes.InvalidArgument, "resource name is required")
+	}
+	secret, err := source.GenerateSecret(req.ResourceName)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.GetCertificateResponse{
+		CertificateChain: string(secret.CertificateChain),
+		RootCert:         string(secret.RootCert),
+	}, nil
+}
+
+// RenewCertificate rotates the certificate of the requested resource.
+func (s *Server) RenewCertificate(_ context.Context, req *pb.RenewCertificateRequest) (*pb.RenewCertificateResponse, error) {
+	renewer, ok := s.source.(Renewer)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "certificate renewal is not supported")
+	}
+	if err := renewer.RenewCertificate(req.ResourceName); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	certStatusLog.Infof("renewed certificate %q on request", req.ResourceName)
+	return &pb.RenewCertificateResponse{}, nil
+}
+
+// timestamp converts t, leaving the zero time unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
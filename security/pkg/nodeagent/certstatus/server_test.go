@@ -0,0 +1,216 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certstatus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"istio.io/istio/pkg/security"
+	pb "istio.io/istio/security/proto/certstatus"
+)
+
+type fakeSource []security.CertificateStatus
+
+func (f fakeSource) CertificateStatus() []security.CertificateStatus {
+	return f
+}
+
+// fakeController records the rotation holds.
+type fakeController struct {
+	fakeSource
+	holds map[string]time.Duration
+}
+
+func (f *fakeController) HoldRotation(resourceName string, duration time.Duration) (time.Time, error) {
+	f.holds[resourceName] = duration
+	return time.Now().Add(duration), nil
+}
+
+func (f *fakeController) ReleaseRotation(resourceName string) {
+	delete(f.holds, resourceName)
+}
+
+func dial(t *testing.T, source StatusSource) pb.CertificateStatusClient {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "certstatus.sock")
+	server, err := NewServer(socket, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected socket to only be accessible to its owner: %v %v", info.Mode(), err)
+	}
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCertificateStatusClient(conn)
+}
+
+func TestGetCertificateStatus(t *testing.T) {
+	expire := time.Now().Add(time.Hour).Truncate(time.Second)
+	failed := time.Now().Truncate(time.Second)
+	source := fakeSource{
+		{ResourceName: security.RootCertReqResourceName, ExpireTime: expire},
+		{
+			ResourceName:      security.WorkloadKeyCertResourceName,
+			SerialNumber:      "1234",
+			ExpireTime:        expire,
+			LastRotationTime:  failed.Add(-time.Minute),
+			LastError:         "CA unavailable",
+			LastErrorTime:     failed,
+			RotationHeldUntil: expire,
+		},
+	}
+
+	client := dial(t, source)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := client.GetCertificateStatus(ctx, &pb.GetCertificateStatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Resources) != 2 {
+		t.Fatalf("expected the status of all resources, got %v", resp.Resources)
+	}
+	if root := resp.Resources[0]; root.LastRotationTime != nil || root.LastErrorTime != nil {
+		t.Errorf("expected unset times to be omitted, got %v", root)
+	}
+
+	resp, err = client.GetCertificateStatus(ctx, &pb.GetCertificateStatusRequest{
+		ResourceNames: []string{security.WorkloadKeyCertResourceName},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Resources) != 1 {
+		t.Fatalf("expected the status of the requested resource, got %v", resp.Resources)
+	}
+	got := resp.Resources[0]
+	if got.ResourceName != security.WorkloadKeyCertResourceName || got.SerialNumber != "1234" || got.LastError != "CA unavailable" {
+		t.Errorf("unexpected status %v", got)
+	}
+	if !got.ExpireTime.AsTime().Equal(expire) || !got.LastErrorTime.AsTime().Equal(failed) ||
+		!got.LastRotationTime.AsTime().Equal(failed.Add(-time.Minute)) || !got.RotationHoldExpireTime.AsTime().Equal(expire) {
+		t.Errorf("unexpected times %v", got)
+	}
+}
+
+func TestRotationHold(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Sources that can't hold rotation don't support the rotation RPCs.
+	_, err := dial(t, fakeSource{}).HoldRotation(ctx, &pb.HoldRotationRequest{Duration: durationpb.New(time.Hour)})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected unimplemented, got %v", err)
+	}
+
+	controller := &fakeController{holds: map[string]time.Duration{}}
+	client := dial(t, controller)
+	if _, err := client.HoldRotation(ctx, &pb.HoldRotationRequest{ResourceName: security.WorkloadKeyCertResourceName}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a hold without expiry to be rejected, got %v", err)
+	}
+	resp, err := client.HoldRotation(ctx, &pb.HoldRotationRequest{
+		ResourceName: security.WorkloadKeyCertResourceName,
+		Duration:     durationpb.New(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if controller.holds[security.WorkloadKeyCertResourceName] != time.Hour || resp.ExpireTime.AsTime().Before(time.Now()) {
+		t.Fatalf("unexpected hold %v expiring at %v", controller.holds, resp.ExpireTime.AsTime())
+	}
+	if _, err := client.ReleaseRotation(ctx, &pb.ReleaseRotationRequest{ResourceName: security.WorkloadKeyCertResourceName}); err != nil {
+		t.Fatal(err)
+	}
+	if len(controller.holds) != 0 {
+		t.Fatalf("expected the hold to be released, got %v", controller.holds)
+	}
+}
+
+// fakeSecretManager serves fixed certificates and records the renewals.
+type fakeSecretManager struct {
+	fakeSource
+	renewed []string
+}
+
+func (f *fakeSecretManager) GenerateSecret(resourceName string) (*security.SecretItem, error) {
+	if resourceName != security.WorkloadKeyCertResourceName {
+		return nil, fmt.Errorf("unknown resource %q", resourceName)
+	}
+	return &security.SecretItem{CertificateChain: []byte("chain"), PrivateKey: []byte("key"), RootCert: []byte("root")}, nil
+}
+
+func (f *fakeSecretManager) RenewCertificate(resourceName string) error {
+	if resourceName != security.WorkloadKeyCertResourceName {
+		return fmt.Errorf("unknown resource %q", resourceName)
+	}
+	f.renewed = append(f.renewed, resourceName)
+	return nil
+}
+
+func TestGetAndRenewCertificate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Sources that can't generate or renew certificates don't support the certificate RPCs.
+	client := dial(t, fakeSource{})
+	if _, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: "default"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected unimplemented, got %v", err)
+	}
+	if _, err := client.RenewCertificate(ctx, &pb.RenewCertificateRequest{ResourceName: "default"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected unimplemented, got %v", err)
+	}
+
+	manager := &fakeSecretManager{}
+	client = dial(t, manager)
+	resp, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: security.WorkloadKeyCertResourceName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.CertificateChain != "chain" || resp.RootCert != "root" {
+		t.Fatalf("unexpected certificates %v", resp)
+	}
+	if _, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a request without resource to be rejected, got %v", err)
+	}
+	if _, err := client.GetCertificate(ctx, &pb.GetCertificateRequest{ResourceName: "other"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+
+	if _, err := client.RenewCertificate(ctx, &pb.RenewCertificateRequest{ResourceName: security.WorkloadKeyCertResourceName}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RenewCertificate(ctx, &pb.RenewCertificateRequest{ResourceName: "ROOTCA"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected the renewal of a root to be rejected, got %v", err)
+	}
+	if len(manager.renewed) != 1 {
+		t.Fatalf("expected a renewal, got %v", manager.renewed)
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delegatedidentity serves the SPIRE Delegated Identity API, so that node-level components
+// such as CNI plugins can obtain the identities of the workloads they supervise through the agent
+// instead of running a SPIRE agent alongside it.
+package delegatedidentity
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/pkg/uds"
+	"istio.io/istio/security/pkg/pki/util"
+	pb "istio.io/istio/security/proto/spire/delegatedidentity"
+	"istio.io/pkg/log"
+)
+
+// k8sSelectorType is the type of the Kubernetes workload selectors. The namespace and service account
+// of the workload are selected with the values "ns:<namespace>" and "sa:<service account>".
+const k8sSelectorType = "k8s"
+
+var delegatedIdentityLog = log.RegisterScope("delegatedidentity", "SPIRE Delegated Identity API debugging", 0)
+
+// WorkloadSecrets issues the certificates of a supervised workload.
+type WorkloadSecrets interface {
+	security.SecretManager
+	SetUpdateCallback(func(resourceName string))
+	Close()
+}
+
+// NewWorkloadSecrets creates the WorkloadSecrets for the service account in namespace.
+type NewWorkloadSecrets func(namespace, serviceAccount string) (WorkloadSecrets, error)
+
+// Server is the gRPC server that exposes the Delegated Identity API through UDS. Workloads are
+// selected by their Kubernetes namespace and service account; process IDs are not supported. Only the
+// X.509 RPCs are supported; the JWT RPCs return Unimplemented.
+//
+// The socket is only accessible to the user of the agent and to root, which are the authorized
+// delegates.
+type Server struct {
+	pb.UnimplementedDelegatedIdentityServer
+
+	trustDomain        string
+	secretManager      security.SecretManager
+	newWorkloadSecrets NewWorkloadSecrets
+	grpcServer         *grpc.Server
+	listener           net.Listener
+
+	mu sync.Mutex
+	// bundleUpdated is closed and replaced when the trust bundle changes.
+	bundleUpdated chan struct{}
+	// workloads are the supervised workloads with active subscriptions, keyed by SPIFFE ID.
+	workloads map[string]*workload
+}
+
+// workload is a supervised workload, shared by all subscriptions to its SVIDs.
+type workload struct {
+	secrets WorkloadSecrets
+	refs    int
+	// updated is closed and replaced when the SVID is rotated. Protected by Server.mu.
+	updated chan struct{}
+}
+
+// NewServer creates and starts the Delegated Identity API server, listening on
+// options.DelegatedIdentityUDSPath. The trust bundle is read from secretManager, and the SVIDs of
+// supervised workloads are issued by the WorkloadSecrets created with newWorkloadSecrets.
+func NewServer(options *security.Options, secretManager security.SecretManager, newWorkloadSecrets NewWorkloadSecrets) (*Server, error) {
+	listener, err := uds.NewListener(options.DelegatedIdentityUDSPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(options.DelegatedIdentityUDSPath, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict %q permission: %v", options.DelegatedIdentityUDSPath, err)
+	}
+	s := &Server{
+		trustDomain:        options.TrustDomain,
+		secretManager:      secretManager,
+		newWorkloadSecrets: newWorkloadSecrets,
+		grpcServer:         grpc.NewServer(),
+		listener:           listener,
+		bundleUpdated:      make(chan struct{}),
+		workloads:          map[string]*workload{},
+	}
+	pb.RegisterDelegatedIdentityServer(s.grpcServer, s)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			delegatedIdentityLog.Errorf("SPIRE Delegated Identity API server failed: %v", err)
+		}
+	}()
+	delegatedIdentityLog.Infof("SPIRE Delegated Identity API server started, listening on %q", options.DelegatedIdentityUDSPath)
+	return s, nil
+}
+
+// UpdateCallback notifies the bundle streams of clients that the trust bundle has changed.
+func (s *Server) UpdateCallback(resourceName string) {
+	if resourceName != security.RootCertReqResourceName {
+		return
+	}
+	s.mu.Lock()
+	close(s.bundleUpdated)
+	s.bundleUpdated = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// Stop closes the gRPC server, ending all streams.
+func (s *Server) Stop() {
+	if s == nil {
+		return
+	}
+	s.grpcServer.Stop()
+	s.listener.Close()
+}
+
+func (s *Server) SubscribeToX509SVIDs(req *pb.SubscribeToX509SVIDsRequest, stream pb.DelegatedIdentity_SubscribeToX509SVIDsServer) error {
+	id, err := s.identity(req.Selectors)
+	if err != nil {
+		return err
+	}
+	w, err := s.acquire(id)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to issue certificates for %s: %v", id, err)
+	}
+	defer s.release(id.String())
+	delegatedIdentityLog.Infof("subscribed to X.509 SVIDs of %s", id)
+
+	for {
+		s.mu.Lock()
+		updated := w.updated
+		s.mu.Unlock()
+		svid, err := x509SVID(id, w.secrets)
+		if err != nil {
+			return err
+		}
+		err = stream.Send(&pb.SubscribeToX509SVIDsResponse{X509Svids: []*pb.X509SVIDWithKey{svid}})
+		// The response is serialized by Send, the key is no longer needed afterwards.
+		util.ZeroBytes(svid.X509SvidKey)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-updated:
+		}
+	}
+}
+
+func (s *Server) SubscribeToX509Bundles(_ *pb.SubscribeToX509BundlesRequest, stream pb.DelegatedIdentity_SubscribeToX509BundlesServer) error {
+	for {
+		s.mu.Lock()
+		updated := s.bundleUpdated
+		s.mu.Unlock()
+		root, err := s.secretManager.GenerateSecret(security.RootCertReqResourceName)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to get trust bundle: %v", err)
+		}
+		bundles := map[string][]byte{spiffe.URIPrefix + s.trustDomain: concatDER(pemToDER(root.RootCert))}
+		if err := stream.Send(&pb.SubscribeToX509BundlesResponse{CaCertificates: bundles}); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-updated:
+		}
+	}
+}
+
+// identity returns the identity of the workload selected by the selectors.
+func (s *Server) identity(selectors []*pb.Selector) (spiffe.Identity, error) {
+	id := spiffe.Identity{TrustDomain: s.trustDomain}
+	for _, selector := range selectors {
+		if selector.GetType() != k8sSelectorType {
+			return id, status.Errorf(codes.InvalidArgument, "unsupported selector type %q", selector.GetType())
+		}
+		switch {
+		case strings.HasPrefix(selector.GetValue(), "ns:"):
+			id.Namespace = strings.TrimPrefix(selector.GetValue(), "ns:")
+		case strings.HasPrefix(selector.GetValue(), "sa:"):
+			id.ServiceAccount = strings.TrimPrefix(selector.GetValue(), "sa:")
+		default:
+			return id, status.Errorf(codes.InvalidArgument, "unsupported selector %q", selector.GetValue())
+		}
+	}
+	if id.Namespace == "" || id.ServiceAccount == "" {
+		return id, status.Error(codes.InvalidArgument, "selectors must include the namespace and the service account")
+	}
+	return id, nil
+}
+
+// acquire returns the workload of the identity, creating it for the first subscription.
+func (s *Server) acquire(id spiffe.Identity) (*workload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, f := s.workloads[id.String()]; f {
+		w.refs++
+		return w, nil
+	}
+	secrets, err := s.newWorkloadSecrets(id.Namespace, id.ServiceAccount)
+	if err != nil {
+		return nil, err
+	}
+	w := &workload{secrets: secrets, refs: 1, updated: make(chan struct{})}
+	secrets.SetUpdateCallback(func(resourceName string) {
+		if resourceName != security.WorkloadKeyCertResourceName {
+			return
+		}
+		s.mu.Lock()
+		close(w.updated)
+		w.updated = make(chan struct{})
+		s.mu.Unlock()
+	})
+	s.workloads[id.String()] = w
+	return w, nil
+}
+
+// release closes the workload of the identity after its last subscription ended.
+func (s *Server) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.workloads[id]
+	w.refs--
+	if w.refs > 0 {
+		return
+	}
+	delete(s.workloads, id)
+	w.secrets.Close()
+	delegatedIdentityLog.Infof("released X.509 SVIDs of %s", id)
+}
+
+// x509SVID builds the SVID of the workload from its WorkloadSecrets. CAs such as istiod sign for the
+// identity the caller authenticated with rather than the SANs of the CSR, so the certificate is only
+// served if it is of the requested identity.
+func x509SVID(id spiffe.Identity, secrets security.SecretManager) (*pb.X509SVIDWithKey, error) {
+	secret, err := secrets.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get certificate of %s: %v", id, err)
+	}
+	chain := pemToDER(secret.CertificateChain)
+	if len(chain) == 0 {
+		return nil, status.Errorf(codes.Unavailable, "certificate of %s is empty", id)
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to parse certificate of %s: %v", id, err)
+	}
+	svidID, err := certificateID(leaf, id)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "certificate issued for %s: %v", id, err)
+	}
+	key, err := util.ParsePemEncodedKey(secret.PrivateKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to parse key of %s: %v", id, err)
+	}
+	defer util.ZeroPrivateKey(key)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to encode key of %s: %v", id, err)
+	}
+	return &pb.X509SVIDWithKey{
+		X509Svid: &pb.X509SVID{
+			Id:        &pb.SPIFFEID{TrustDomain: svidID.TrustDomain, Path: svidID.Path},
+			CertChain: chain,
+			ExpiresAt: leaf.NotAfter.Unix(),
+		},
+		X509SvidKey: pkcs8,
+	}, nil
+}
+
+// certificateID returns the SPIFFE ID of leaf, which must be id.
+func certificateID(leaf *x509.Certificate, id spiffe.Identity) (spiffe.ID, error) {
+	var sans []string
+	for _, uri := range leaf.URIs {
+		if uri.String() == id.String() {
+			return spiffe.ParseID(uri.String())
+		}
+		sans = append(sans, uri.String())
+	}
+	return spiffe.ID{}, fmt.Errorf("certificate is of %v, not of the requested identity", sans)
+}
+
+// pemToDER returns the DER encoding of the certificates in PEM.
+func pemToDER(data []byte) [][]byte {
+	var der [][]byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			der = append(der, block.Bytes)
+		}
+	}
+	return der
+}
+
+func concatDER(certs [][]byte) []byte {
+	var der []byte
+	for _, cert := range certs {
+		der = append(der, cert...)
+	}
+	return der
+}
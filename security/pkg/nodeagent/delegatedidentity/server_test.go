@@ -0,0 +1,285 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delegatedidentity
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/util"
+	pb "istio.io/istio/security/proto/spire/delegatedidentity"
+)
+
+func newSecret(t *testing.T, id string) *security.SecretItem {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         id,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &security.SecretItem{
+		CertificateChain: certPEM,
+		PrivateKey:       keyPEM,
+		RootCert:         certPEM,
+		ResourceName:     security.WorkloadKeyCertResourceName,
+	}
+}
+
+// fakeWorkloadSecrets serves the secrets of a supervised workload from memory.
+type fakeWorkloadSecrets struct {
+	*security.DirectSecretManager
+	mu       sync.Mutex
+	callback func(string)
+	closed   bool
+}
+
+func (f *fakeWorkloadSecrets) SetUpdateCallback(cb func(string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.callback = cb
+}
+
+func (f *fakeWorkloadSecrets) rotate(secret *security.SecretItem) {
+	f.Set(security.WorkloadKeyCertResourceName, secret)
+	f.mu.Lock()
+	cb := f.callback
+	f.mu.Unlock()
+	cb(security.WorkloadKeyCertResourceName)
+}
+
+func (f *fakeWorkloadSecrets) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+type testServer struct {
+	server  *Server
+	store   *security.DirectSecretManager
+	client  pb.DelegatedIdentityClient
+	mu      sync.Mutex
+	created map[string]*fakeWorkloadSecrets
+	// issuedAs, if set, is the identity of the certificates issued for every workload, as by a CA
+	// signing for the identity of the agent rather than the requested one.
+	issuedAs string
+}
+
+func (s *testServer) workload(id string) *fakeWorkloadSecrets {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created[id]
+}
+
+func setupServer(t *testing.T) *testServer {
+	s := &testServer{store: security.NewDirectSecretManager(), created: map[string]*fakeWorkloadSecrets{}}
+	root := newSecret(t, "spiffe://cluster.local/ns/istio-system/sa/istiod")
+	s.store.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     root.RootCert,
+		ResourceName: security.RootCertReqResourceName,
+	})
+
+	socket := filepath.Join(t.TempDir(), "delegated.sock")
+	newWorkloadSecrets := func(namespace, serviceAccount string) (WorkloadSecrets, error) {
+		id := spiffe.Identity{TrustDomain: "cluster.local", Namespace: namespace, ServiceAccount: serviceAccount}.String()
+		secrets := &fakeWorkloadSecrets{DirectSecretManager: security.NewDirectSecretManager()}
+		s.mu.Lock()
+		san := id
+		if s.issuedAs != "" {
+			san = s.issuedAs
+		}
+		secrets.Set(security.WorkloadKeyCertResourceName, newSecret(t, san))
+		s.created[id] = secrets
+		s.mu.Unlock()
+		return secrets, nil
+	}
+	server, err := NewServer(&security.Options{DelegatedIdentityUDSPath: socket, TrustDomain: "cluster.local"},
+		s.store, newWorkloadSecrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	s.server = server
+
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected socket to only be accessible to its owner: %v %v", info.Mode(), err)
+	}
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s.client = pb.NewDelegatedIdentityClient(conn)
+	return s
+}
+
+func k8sSelectors(ns, sa string) []*pb.Selector {
+	return []*pb.Selector{{Type: "k8s", Value: "ns:" + ns}, {Type: "k8s", Value: "sa:" + sa}}
+}
+
+func TestSubscribeToX509SVIDs(t *testing.T) {
+	s := setupServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := s.client.SubscribeToX509SVIDs(ctx, &pb.SubscribeToX509SVIDsRequest{Selectors: k8sSelectors("foo", "bar")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "spiffe://cluster.local/ns/foo/sa/bar"
+	verify := func(resp *pb.SubscribeToX509SVIDsResponse, secret *security.SecretItem) {
+		t.Helper()
+		if len(resp.X509Svids) != 1 {
+			t.Fatalf("expected 1 SVID, got %d", len(resp.X509Svids))
+		}
+		svid := resp.X509Svids[0]
+		if got := svid.X509Svid.Id; got.TrustDomain != "cluster.local" || got.Path != "/ns/foo/sa/bar" {
+			t.Errorf("unexpected SPIFFE ID %v", got)
+		}
+		cert, err := x509.ParseCertificate(svid.X509Svid.CertChain[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := util.ParsePemEncodedCertificate(secret.CertificateChain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.Equal(want) || svid.X509Svid.ExpiresAt != want.NotAfter.Unix() {
+			t.Errorf("unexpected SVID certificate")
+		}
+		if _, err := x509.ParsePKCS8PrivateKey(svid.X509SvidKey); err != nil {
+			t.Errorf("SVID key is not PKCS#8: %v", err)
+		}
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	workload := s.workload(id)
+	first, _ := workload.GenerateSecret(security.WorkloadKeyCertResourceName)
+	verify(resp, first)
+
+	rotated := newSecret(t, id)
+	workload.rotate(rotated)
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(resp, rotated)
+
+	// The workload secrets are released with the last subscription.
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		workload.mu.Lock()
+		closed := workload.closed
+		workload.mu.Unlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected workload secrets to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeToX509SVIDsOfAnotherIdentity(t *testing.T) {
+	s := setupServer(t)
+	s.issuedAs = "spiffe://cluster.local/ns/istio-system/sa/agent"
+	stream, err := s.client.SubscribeToX509SVIDs(context.Background(), &pb.SubscribeToX509SVIDsRequest{Selectors: k8sSelectors("foo", "bar")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable for a certificate of another identity, got %v", err)
+	}
+}
+
+func TestSubscribeToX509SVIDsInvalidSelectors(t *testing.T) {
+	s := setupServer(t)
+	for name, selectors := range map[string][]*pb.Selector{
+		"missing service account": {{Type: "k8s", Value: "ns:foo"}},
+		"unix selector":           {{Type: "unix", Value: "uid:0"}},
+		"pod selector":            append(k8sSelectors("foo", "bar"), &pb.Selector{Type: "k8s", Value: "pod-name:foo"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream, err := s.client.SubscribeToX509SVIDs(context.Background(), &pb.SubscribeToX509SVIDsRequest{Selectors: selectors})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("expected InvalidArgument, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSubscribeToX509Bundles(t *testing.T) {
+	s := setupServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := s.client.SubscribeToX509Bundles(ctx, &pb.SubscribeToX509BundlesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func() {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _ := s.store.GenerateSecret(security.RootCertReqResourceName)
+		want, err := util.ParsePemEncodedCertificate(root.RootCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, err := x509.ParseCertificates(resp.CaCertificates["spiffe://cluster.local"])
+		if err != nil || len(certs) != 1 || !certs[0].Equal(want) {
+			t.Fatalf("unexpected bundle %v: %v", resp.CaCertificates, err)
+		}
+	}
+	verify()
+
+	root := newSecret(t, "spiffe://cluster.local/ns/istio-system/sa/istiod")
+	s.store.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     root.RootCert,
+		ResourceName: security.RootCertReqResourceName,
+	})
+	s.server.UpdateCallback(security.RootCertReqResourceName)
+	verify()
+}
+
+func TestFetchJWTSVIDsUnimplemented(t *testing.T) {
+	s := setupServer(t)
+	_, err := s.client.FetchJWTSVIDs(context.Background(), &pb.FetchJWTSVIDsRequest{Selectors: k8sSelectors("foo", "bar")})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented, got %v", err)
+	}
+}
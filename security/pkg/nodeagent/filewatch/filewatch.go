@@ -0,0 +1,208 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filewatch watches certificate files for changes, either with the notifications of the
+// file system or by polling them, for file systems that do not deliver notifications reliably.
+package filewatch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/pkg/security"
+)
+
+// DefaultPollInterval is the interval of the polling watcher if Options.FileWatchPollInterval is unset.
+const DefaultPollInterval = 5 * time.Second
+
+// FileWatcher reports the changes of a set of files. As with fsnotify, a file that is removed is no
+// longer watched, and must be added again once it is recreated.
+type FileWatcher interface {
+	// Add starts watching path, which must exist. Adding a path already watched does nothing.
+	Add(path string) error
+	// Remove stops watching path.
+	Remove(path string) error
+	// Events reports the writes, creations and removals of the watched files. It is closed by Close.
+	Events() <-chan fsnotify.Event
+	// Errors reports the failures to watch files. It is closed by Close.
+	Errors() <-chan error
+	Close() error
+}
+
+// New returns the FileWatcher selected by options.FileWatcher.
+func New(options *security.Options) (FileWatcher, error) {
+	switch options.FileWatcher {
+	case "", security.FileWatcherInotify:
+		return NewNotifyWatcher()
+	case security.FileWatcherPoll:
+		interval := options.FileWatchPollInterval
+		if interval <= 0 {
+			interval = DefaultPollInterval
+		}
+		return NewPollingWatcher(interval), nil
+	default:
+		return nil, fmt.Errorf("unknown file watcher %q", options.FileWatcher)
+	}
+}
+
+// notifyWatcher watches files with the notifications of the file system: inotify on Linux.
+type notifyWatcher struct {
+	watcher *fsnotify.Watcher
+}
+
+// NewNotifyWatcher returns a FileWatcher notified by the file system.
+func NewNotifyWatcher() (FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return notifyWatcher{watcher: watcher}, nil
+}
+
+func (w notifyWatcher) Add(path string) error {
+	return w.watcher.Add(path)
+}
+
+func (w notifyWatcher) Remove(path string) error {
+	return w.watcher.Remove(path)
+}
+
+func (w notifyWatcher) Events() <-chan fsnotify.Event {
+	return w.watcher.Events
+}
+
+func (w notifyWatcher) Errors() <-chan error {
+	return w.watcher.Errors
+}
+
+func (w notifyWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// changed reports whether a file was changed between two polls. The file is compared by identity, to
+// detect a file renamed over it, and by size and modification time.
+func changed(prev, cur os.FileInfo) bool {
+	return !os.SameFile(prev, cur) || prev.Size() != cur.Size() || !prev.ModTime().Equal(cur.ModTime())
+}
+
+// pollingWatcher watches files by comparing their state every interval. Symbolic links are followed,
+// so a file replaced by switching a link, as in Kubernetes volumes, is detected.
+type pollingWatcher struct {
+	interval time.Duration
+	events   chan fsnotify.Event
+	errors   chan error
+	stop     chan struct{}
+	once     sync.Once
+
+	mu    sync.Mutex
+	files map[string]os.FileInfo
+}
+
+// NewPollingWatcher returns a FileWatcher polling the watched files every interval.
+func NewPollingWatcher(interval time.Duration) FileWatcher {
+	w := &pollingWatcher{
+		interval: interval,
+		events:   make(chan fsnotify.Event, 10),
+		errors:   make(chan error, 1),
+		stop:     make(chan struct{}),
+		files:    make(map[string]os.FileInfo),
+	}
+	go w.run()
+	return w
+}
+
+func (w *pollingWatcher) Add(path string) error {
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.files[path]; !ok {
+		w.files[path] = info
+	}
+	return nil
+}
+
+func (w *pollingWatcher) Remove(path string) error {
+	path = filepath.Clean(path)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.files[path]; !ok {
+		return fmt.Errorf("can't remove non-existent watch for %s", path)
+	}
+	delete(w.files, path)
+	return nil
+}
+
+func (w *pollingWatcher) Events() <-chan fsnotify.Event {
+	return w.events
+}
+
+func (w *pollingWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *pollingWatcher) Close() error {
+	w.once.Do(func() { close(w.stop) })
+	return nil
+}
+
+func (w *pollingWatcher) run() {
+	defer close(w.errors)
+	defer close(w.events)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, event := range w.poll() {
+			select {
+			case w.events <- event:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// poll returns the changes of the watched files since the last poll. A file that cannot be read is
+// reported as removed, and no longer watched.
+func (w *pollingWatcher) poll() []fsnotify.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var events []fsnotify.Event
+	for path, prev := range w.files {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.files, path)
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+			continue
+		}
+		if changed(prev, info) {
+			w.files[path] = info
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	return events
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+)
+
+func expectEvent(t *testing.T, w FileWatcher, name string, op fsnotify.Op) {
+	t.Helper()
+	for {
+		select {
+		case event := <-w.Events():
+			if event.Op&op != 0 && file.SamePath(event.Name, name) {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v of %s", op, name)
+		}
+	}
+}
+
+func TestWatchers(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options *security.Options
+	}{
+		{"inotify", &security.Options{}},
+		{"poll", &security.Options{FileWatcher: security.FileWatcherPoll, FileWatchPollInterval: 10 * time.Millisecond}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			path := filepath.Join(t.TempDir(), "cert-chain.pem")
+			if err := w.Add(path); err == nil {
+				t.Fatal("expected watching a missing file to fail")
+			}
+			if err := os.WriteFile(path, []byte("first"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Add(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("second, longer"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			expectEvent(t, w, path, fsnotify.Write)
+
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			expectEvent(t, w, path, fsnotify.Remove)
+		})
+	}
+}
+
+func TestPollingWatcherReplacedFile(t *testing.T) {
+	w := NewPollingWatcher(10 * time.Millisecond)
+	path := filepath.Join(t.TempDir(), "cert-chain.pem")
+	if err := os.WriteFile(path, []byte("cert"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	// A file of the same size renamed over the watched one is detected.
+	if err := file.AtomicWrite(path, []byte("next"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, path, fsnotify.Write)
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range w.Events() {
+	}
+	if _, ok := <-w.Errors(); ok {
+		t.Fatal("expected errors to be closed")
+	}
+}
+
+func TestNewUnknownWatcher(t *testing.T) {
+	if _, err := New(&security.Options{FileWatcher: "fanotify"}); err == nil {
+		t.Fatal("expected an unknown file watcher to be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwks exports the trust anchors of the mesh as a local JWKS document, so that applications
+// can verify JWTs signed by the mesh CA or by the configured identity providers without talking to
+// istiod.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/square/go-jose.v2"
+
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// Exporter writes the JWKS document to a file.
+type Exporter struct {
+	path         string
+	trustAnchors []string
+}
+
+// NewExporter creates an Exporter writing to path. trustAnchors are JWKS documents of additional
+// identity providers, merged into the exported document.
+func NewExporter(path string, trustAnchors []string) *Exporter {
+	return &Exporter{path: path, trustAnchors: trustAnchors}
+}
+
+// Export writes the JWKS document for the root certificates, replacing the previous one atomically.
+func (e *Exporter) Export(rootCert []byte) error {
+	jwks, err := Build(rootCert, e.trustAnchors)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := file.AtomicWrite(e.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write JWKS to %s: %v", e.path, err)
+	}
+	return nil
+}
+
+// Build returns the JWKS document with a key for each root certificate, followed by the keys of the
+// trustAnchors JWKS documents. Keys are deduplicated by key ID.
+func Build(rootCert []byte, trustAnchors []string) (*jose.JSONWebKeySet, error) {
+	roots, err := util.ParsePemEncodedCertificateChain(rootCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse root certificates: %v", err)
+	}
+	jwks := &jose.JSONWebKeySet{}
+	seen := map[string]struct{}{}
+	add := func(key jose.JSONWebKey) {
+		if _, f := seen[key.KeyID]; f {
+			return
+		}
+		seen[key.KeyID] = struct{}{}
+		jwks.Keys = append(jwks.Keys, key)
+	}
+	for _, root := range roots {
+		key, err := certificateKey(root)
+		if err != nil {
+			return nil, err
+		}
+		add(key)
+	}
+	for _, anchor := range trustAnchors {
+		data, err := os.ReadFile(anchor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trust anchor %s: %v", anchor, err)
+		}
+		set := &jose.JSONWebKeySet{}
+		if err := json.Unmarshal(data, set); err != nil {
+			return nil, fmt.Errorf("failed to parse trust anchor %s: %v", anchor, err)
+		}
+		for _, key := range set.Keys {
+			add(key)
+		}
+	}
+	return jwks, nil
+}
+
+// certificateKey returns the signing key of the certificate, identified by its RFC 7638 thumbprint.
+func certificateKey(cert *x509.Certificate) (jose.JSONWebKey, error) {
+	key := jose.JSONWebKey{
+		Key:          cert.PublicKey,
+		Certificates: []*x509.Certificate{cert},
+		Use:          "sig",
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = string(jose.RS256)
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 384:
+			key.Algorithm = string(jose.ES384)
+		case 521:
+			key.Algorithm = string(jose.ES512)
+		default:
+			key.Algorithm = string(jose.ES256)
+		}
+	default:
+		return key, fmt.Errorf("unsupported root certificate key type %T", cert.PublicKey)
+	}
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return key, err
+	}
+	key.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	return key, nil
+}
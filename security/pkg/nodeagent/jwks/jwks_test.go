@@ -0,0 +1,126 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestExport(t *testing.T) {
+	rsaRoot, rsaKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org: "cluster.local", IsCA: true, IsSelfSigned: true, TTL: time.Hour, RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecRoot, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org: "cluster.local", IsCA: true, IsSelfSigned: true, TTL: time.Hour, ECSigAlg: util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	idpKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: idpKey.Public(), KeyID: "idp", Algorithm: string(jose.ES256), Use: "sig"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchorPath := filepath.Join(dir, "idp.json")
+	if err := os.WriteFile(anchorPath, anchor, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "jwks.json")
+	// The RSA root appears twice, as in a merged trust bundle, and is exported once.
+	roots := append(append(append([]byte{}, rsaRoot...), ecRoot...), rsaRoot...)
+	if err := NewExporter(out, []string{anchorPath}).Export(roots); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(data, jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Algorithm != "RS256" || jwks.Keys[1].Algorithm != "ES256" || jwks.Keys[2].KeyID != "idp" {
+		t.Fatalf("unexpected keys: %+v", jwks.Keys)
+	}
+
+	// A token signed by the mesh CA key verifies with the exported document.
+	caKey, err := util.ParsePemEncodedKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: caKey},
+		(&jose.SignerOptions{}).WithHeader("kid", jwks.Keys[0].KeyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{Subject: "foo"}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := jwks.Key(parsed.Headers[0].KeyID)
+	if len(keys) != 1 {
+		t.Fatalf("expected the signing key to be found by key ID")
+	}
+	claims := jwt.Claims{}
+	if err := parsed.Claims(keys[0].Key, &claims); err != nil || claims.Subject != "foo" {
+		t.Fatalf("failed to verify token: %v", err)
+	}
+}
+
+func TestExportInvalidTrustAnchor(t *testing.T) {
+	root, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org: "cluster.local", IsCA: true, IsSelfSigned: true, TTL: time.Hour, ECSigAlg: util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "jwks.json")
+	if err := NewExporter(out, []string{filepath.Join(t.TempDir(), "missing.json")}).Export(root); err == nil {
+		t.Fatal("expected missing trust anchor to fail the export")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("expected no JWKS to be written, got %v", err)
+	}
+}
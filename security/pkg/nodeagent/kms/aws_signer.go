@@ -0,0 +1,133 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+
+	"istio.io/istio/pkg/security"
+)
+
+// AWSKeyProvider is a security.KeyProvider for an asymmetric SIGN_VERIFY key of AWS KMS. The AWS
+// credentials are taken from the default credential chain.
+type AWSKeyProvider struct {
+	keyID  string
+	client kmsiface.KMSAPI
+
+	// mu protects signer, created on first use.
+	mu     sync.Mutex
+	signer crypto.Signer
+}
+
+var _ security.KeyProvider = &AWSKeyProvider{}
+
+// NewAWSKeyProvider creates an AWSKeyProvider for the key keyID, a key ID, alias or ARN. The region
+// of an ARN takes precedence over the default region.
+func NewAWSKeyProvider(keyID string) (*AWSKeyProvider, error) {
+	config := aws.NewConfig()
+	if parsed, err := arn.Parse(keyID); err == nil {
+		config = config.WithRegion(parsed.Region)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+	return &AWSKeyProvider{keyID: keyID, client: kms.New(sess)}, nil
+}
+
+// Signer returns a signer for the key.
+func (p *AWSKeyProvider) Signer(ctx context.Context) (crypto.Signer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.signer != nil {
+		return p.signer, nil
+	}
+	resp, err := p.client.GetPublicKeyWithContext(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(p.keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the public key of %s: %v", p.keyID, err)
+	}
+	if aws.StringValue(resp.KeyUsage) != kms.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("key %s with usage %s cannot sign", p.keyID, aws.StringValue(resp.KeyUsage))
+	}
+	public, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of %s: %v", p.keyID, err)
+	}
+	if err := checkPublicKey(public); err != nil {
+		return nil, err
+	}
+	p.signer = &kmsSigner{public: public, sign: func(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+		return p.sign(ctx, public, digest, opts)
+	}}
+	return p.signer, nil
+}
+
+func (p *AWSKeyProvider) sign(ctx context.Context, public crypto.PublicKey, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, err := awsSigningAlgorithm(public, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.SignWithContext(ctx, &kms.SignInput{
+		KeyId:            aws.String(p.keyID),
+		Message:          digest,
+		MessageType:      aws.String(kms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(algorithm),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with %s: %v", p.keyID, err)
+	}
+	return resp.Signature, nil
+}
+
+// awsSigningAlgorithm returns the AWS KMS signing algorithm for a signature of public with opts.
+func awsSigningAlgorithm(public crypto.PublicKey, opts crypto.SignerOpts) (string, error) {
+	var suffix string
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		suffix = "SHA_256"
+	case crypto.SHA384:
+		suffix = "SHA_384"
+	case crypto.SHA512:
+		suffix = "SHA_512"
+	default:
+		return "", fmt.Errorf("unsupported hash %v", opts.HashFunc())
+	}
+	switch public.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA_" + suffix, nil
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if err := checkPSSOptions(pss); err != nil {
+				return "", err
+			}
+			return "RSASSA_PSS_" + suffix, nil
+		}
+		return "RSASSA_PKCS1_V1_5_" + suffix, nil
+	default:
+		return "", fmt.Errorf("unsupported KMS key type %T", public)
+	}
+}
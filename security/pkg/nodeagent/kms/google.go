@@ -0,0 +1,101 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms provides the key management services encrypting the data keys of the agent, and holding
+// the keys it signs with.
+package kms
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+
+	"google.golang.org/api/option"
+	gtransport "google.golang.org/api/transport/grpc"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	googleKMSEndpoint = "cloudkms.googleapis.com:443"
+	googleKMSScope    = "https://www.googleapis.com/auth/cloudkms"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// GoogleKMS is a security.KMS encrypting with a symmetric Google Cloud KMS CryptoKey. The integrity of
+// the requests and responses is verified with their CRC32C checksums.
+type GoogleKMS struct {
+	keyName string
+	conn    *grpc.ClientConn
+	client  kmspb.KeyManagementServiceClient
+}
+
+var _ security.KMS = &GoogleKMS{}
+
+// NewGoogleKMS creates a GoogleKMS for the CryptoKey keyName, in the form
+// projects/*/locations/*/keyRings/*/cryptoKeys/*, authenticated with the application default
+// credentials unless overridden by options.
+func NewGoogleKMS(keyName string, options ...option.ClientOption) (*GoogleKMS, error) {
+	options = append([]option.ClientOption{option.WithEndpoint(googleKMSEndpoint), option.WithScopes(googleKMSScope)}, options...)
+	conn, err := gtransport.Dial(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Google Cloud KMS: %v", err)
+	}
+	return &GoogleKMS{keyName: keyName, conn: conn, client: kmspb.NewKeyManagementServiceClient(conn)}, nil
+}
+
+// Encrypt encrypts plaintext with the CryptoKey.
+func (k *GoogleKMS) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	resp, err := k.client.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:            k.keyName,
+		Plaintext:       plaintext,
+		PlaintextCrc32C: checksum(plaintext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.VerifiedPlaintextCrc32C || resp.CiphertextCrc32C.GetValue() != checksum(resp.Ciphertext).Value {
+		return nil, fmt.Errorf("KMS encryption with %s was corrupted in transit", k.keyName)
+	}
+	return resp.Ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext encrypted by Encrypt.
+func (k *GoogleKMS) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	resp, err := k.client.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:             k.keyName,
+		Ciphertext:       ciphertext,
+		CiphertextCrc32C: checksum(ciphertext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.PlaintextCrc32C.GetValue() != checksum(resp.Plaintext).Value {
+		return nil, fmt.Errorf("KMS decryption with %s was corrupted in transit", k.keyName)
+	}
+	return resp.Plaintext, nil
+}
+
+// Close closes the connection to the KMS.
+func (k *GoogleKMS) Close() error {
+	return k.conn.Close()
+}
+
+func checksum(data []byte) *wrapperspb.Int64Value {
+	return wrapperspb.Int64(int64(crc32.Checksum(data, crc32c)))
+}
@@ -0,0 +1,136 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+	gtransport "google.golang.org/api/transport/grpc"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pkg/security"
+)
+
+// GoogleKeyProvider is a security.KeyProvider for an asymmetric signing key version of Google Cloud
+// KMS. The algorithm of the key version decides the padding of RSA signatures, so TLS peers must
+// accept it.
+type GoogleKeyProvider struct {
+	keyVersion string
+	conn       *grpc.ClientConn
+	client     kmspb.KeyManagementServiceClient
+
+	// mu protects signer, created on first use. The public key of a key version never changes.
+	mu     sync.Mutex
+	signer crypto.Signer
+}
+
+var _ security.KeyProvider = &GoogleKeyProvider{}
+
+// NewGoogleKeyProvider creates a GoogleKeyProvider for the key version keyVersion, in the form
+// projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*, authenticated with the
+// application default credentials unless overridden by options.
+func NewGoogleKeyProvider(keyVersion string, options ...option.ClientOption) (*GoogleKeyProvider, error) {
+	options = append([]option.ClientOption{option.WithEndpoint(googleKMSEndpoint), option.WithScopes(googleKMSScope)}, options...)
+	conn, err := gtransport.Dial(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Google Cloud KMS: %v", err)
+	}
+	return &GoogleKeyProvider{keyVersion: keyVersion, conn: conn, client: kmspb.NewKeyManagementServiceClient(conn)}, nil
+}
+
+// Signer returns a signer for the key version.
+func (p *GoogleKeyProvider) Signer(ctx context.Context) (crypto.Signer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.signer != nil {
+		return p.signer, nil
+	}
+	resp, err := p.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: p.keyVersion})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the public key of %s: %v", p.keyVersion, err)
+	}
+	if resp.PemCrc32C.GetValue() != checksum([]byte(resp.Pem)).Value {
+		return nil, fmt.Errorf("public key of %s was corrupted in transit", p.keyVersion)
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key of %s", p.keyVersion)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of %s: %v", p.keyVersion, err)
+	}
+	if err := checkPublicKey(public); err != nil {
+		return nil, err
+	}
+	algorithm := resp.Algorithm.String()
+	p.signer = &kmsSigner{public: public, sign: func(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+		return p.sign(ctx, algorithm, digest, opts)
+	}}
+	return p.signer, nil
+}
+
+func (p *GoogleKeyProvider) sign(ctx context.Context, algorithm string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	// The key version algorithm fixes the digest and, for RSA, the padding, e.g. RSA_SIGN_PSS_2048_SHA256.
+	var d kmspb.Digest
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		d.Digest = &kmspb.Digest_Sha256{Sha256: digest}
+	case crypto.SHA384:
+		d.Digest = &kmspb.Digest_Sha384{Sha384: digest}
+	case crypto.SHA512:
+		d.Digest = &kmspb.Digest_Sha512{Sha512: digest}
+	default:
+		return nil, fmt.Errorf("unsupported hash %v", opts.HashFunc())
+	}
+	if !strings.HasSuffix(algorithm, "_"+strings.ReplaceAll(opts.HashFunc().String(), "-", "")) {
+		return nil, fmt.Errorf("key %s with algorithm %s cannot sign %v digests", p.keyVersion, algorithm, opts.HashFunc())
+	}
+	pss, isPSS := opts.(*rsa.PSSOptions)
+	if isPSS {
+		if err := checkPSSOptions(pss); err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasPrefix(algorithm, "RSA_SIGN_") && strings.HasPrefix(algorithm, "RSA_SIGN_PSS_") != isPSS {
+		return nil, fmt.Errorf("key %s with algorithm %s does not match the requested RSA padding", p.keyVersion, algorithm)
+	}
+	resp, err := p.client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name:         p.keyVersion,
+		Digest:       &d,
+		DigestCrc32C: checksum(digest),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with %s: %v", p.keyVersion, err)
+	}
+	if !resp.VerifiedDigestCrc32C || resp.SignatureCrc32C.GetValue() != checksum(resp.Signature).Value {
+		return nil, fmt.Errorf("signature with %s was corrupted in transit", p.keyVersion)
+	}
+	return resp.Signature, nil
+}
+
+// Close closes the connection to the KMS.
+func (p *GoogleKeyProvider) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,99 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
+)
+
+const testKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+// fakeKMSServer encrypts by prefixing the plaintext with the key name.
+type fakeKMSServer struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+	corrupt bool
+}
+
+func (s *fakeKMSServer) Encrypt(_ context.Context, req *kmspb.EncryptRequest) (*kmspb.EncryptResponse, error) {
+	if req.PlaintextCrc32C.GetValue() != checksum(req.Plaintext).Value {
+		return nil, fmt.Errorf("invalid checksum")
+	}
+	ciphertext := append([]byte(req.Name+":"), req.Plaintext...)
+	resp := &kmspb.EncryptResponse{Ciphertext: ciphertext, CiphertextCrc32C: checksum(ciphertext), VerifiedPlaintextCrc32C: true}
+	if s.corrupt {
+		resp.Ciphertext = []byte("corrupt")
+	}
+	return resp, nil
+}
+
+func (s *fakeKMSServer) Decrypt(_ context.Context, req *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error) {
+	if req.CiphertextCrc32C.GetValue() != checksum(req.Ciphertext).Value {
+		return nil, fmt.Errorf("invalid checksum")
+	}
+	plaintext := bytes.TrimPrefix(req.Ciphertext, []byte(req.Name+":"))
+	return &kmspb.DecryptResponse{Plaintext: plaintext, PlaintextCrc32C: checksum(plaintext)}, nil
+}
+
+func newTestKMS(t *testing.T, server *fakeKMSServer) *GoogleKMS {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	kmspb.RegisterKeyManagementServiceServer(s, server)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewGoogleKMS(testKeyName, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { k.Close() })
+	return k
+}
+
+func TestGoogleKMS(t *testing.T) {
+	k := newTestKMS(t, &fakeKMSServer{})
+	ciphertext, err := k.Encrypt(context.Background(), []byte("data key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := k.Decrypt(context.Background(), ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "data key" {
+		t.Fatalf("expected data key, got %q", plaintext)
+	}
+}
+
+func TestGoogleKMSCorruption(t *testing.T) {
+	k := newTestKMS(t, &fakeKMSServer{corrupt: true})
+	if _, err := k.Encrypt(context.Background(), []byte("data key")); err == nil {
+		t.Fatal("expected corrupted ciphertext to be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	// GoogleKeyPrefix and AWSKeyPrefix prefix the names of the keys of NewKeyProvider.
+	GoogleKeyPrefix = "gcp-kms://"
+	AWSKeyPrefix    = "aws-kms://"
+
+	// signTimeout bounds the signing requests, which are made during TLS handshakes.
+	signTimeout = 10 * time.Second
+)
+
+// NewKeyProvider returns the provider of the asymmetric key uri, either
+// gcp-kms://projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/* for a Google Cloud
+// KMS key version, or aws-kms://<key ID or ARN> for an AWS KMS key.
+func NewKeyProvider(uri string) (security.KeyProvider, error) {
+	switch {
+	case strings.HasPrefix(uri, GoogleKeyPrefix):
+		return NewGoogleKeyProvider(strings.TrimPrefix(uri, GoogleKeyPrefix))
+	case strings.HasPrefix(uri, AWSKeyPrefix):
+		return NewAWSKeyProvider(strings.TrimPrefix(uri, AWSKeyPrefix))
+	default:
+		return nil, fmt.Errorf("unsupported KMS key %q, expected a %s or %s key", uri, GoogleKeyPrefix, AWSKeyPrefix)
+	}
+}
+
+// signFunc signs digest in a KMS, with the algorithm selected by opts.
+type signFunc func(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+
+// kmsSigner is a crypto.Signer whose private key is held by a KMS.
+type kmsSigner struct {
+	public crypto.PublicKey
+	sign   signFunc
+}
+
+var _ crypto.Signer = &kmsSigner{}
+
+func (s *kmsSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs digest in the KMS. rand is not used.
+func (s *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	return s.sign(ctx, digest, opts)
+}
+
+// checkPublicKey returns an error for the public keys the signers do not support.
+func checkPublicKey(public crypto.PublicKey) error {
+	switch public.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return nil
+	default:
+		return fmt.Errorf("unsupported KMS key type %T", public)
+	}
+}
+
+// checkPSSOptions returns an error if opts, the options of an RSA-PSS signature, do not use a salt
+// as long as the digest, the only salt length supported by the KMSs.
+func checkPSSOptions(opts *rsa.PSSOptions) error {
+	if opts.SaltLength != rsa.PSSSaltLengthEqualsHash && opts.SaltLength != opts.Hash.Size() {
+		return fmt.Errorf("unsupported RSA-PSS salt length %d", opts.SaltLength)
+	}
+	return nil
+}
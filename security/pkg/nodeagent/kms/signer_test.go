@@ -0,0 +1,197 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
+)
+
+const testKeyVersion = testKeyName + "/cryptoKeyVersions/1"
+
+// fakeSigningKMSServer signs with a local P-256 key.
+type fakeSigningKMSServer struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+	key *ecdsa.PrivateKey
+}
+
+func (s *fakeSigningKMSServer) GetPublicKey(_ context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(s.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return &kmspb.PublicKey{
+		Name:      req.Name,
+		Pem:       pemKey,
+		PemCrc32C: checksum([]byte(pemKey)),
+		Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	}, nil
+}
+
+func (s *fakeSigningKMSServer) AsymmetricSign(_ context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error) {
+	digest := req.Digest.GetSha256()
+	if digest == nil || req.DigestCrc32C.GetValue() != checksum(digest).Value {
+		return nil, fmt.Errorf("invalid digest")
+	}
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.AsymmetricSignResponse{Signature: signature, SignatureCrc32C: checksum(signature), VerifiedDigestCrc32C: true}, nil
+}
+
+func TestGoogleKeyProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	kmspb.RegisterKeyManagementServiceServer(s, &fakeSigningKMSServer{key: key})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewGoogleKeyProvider(testKeyVersion, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	signer, err := p.Signer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(signer.Public()) {
+		t.Fatal("unexpected public key")
+	}
+	digest := sha256.Sum256([]byte("handshake"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Error("invalid signature")
+	}
+	if _, err := signer.Sign(rand.Reader, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Error("expected a digest not matching the key algorithm to be rejected")
+	}
+}
+
+// fakeAWSKMS signs with a local RSA key.
+type fakeAWSKMS struct {
+	kmsiface.KMSAPI
+	key       *rsa.PrivateKey
+	algorithm string
+}
+
+func (f *fakeAWSKMS) GetPublicKeyWithContext(_ aws.Context, in *kms.GetPublicKeyInput, _ ...request.Option) (*kms.GetPublicKeyOutput, error) {
+	der, err := x509.MarshalPKIXPublicKey(f.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{KeyId: in.KeyId, PublicKey: der, KeyUsage: aws.String(kms.KeyUsageTypeSignVerify)}, nil
+}
+
+func (f *fakeAWSKMS) SignWithContext(_ aws.Context, in *kms.SignInput, _ ...request.Option) (*kms.SignOutput, error) {
+	if aws.StringValue(in.MessageType) != kms.MessageTypeDigest {
+		return nil, fmt.Errorf("unexpected message type %s", aws.StringValue(in.MessageType))
+	}
+	f.algorithm = aws.StringValue(in.SigningAlgorithm)
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	signature, err := f.key.Sign(rand.Reader, in.Message, opts)
+	return &kms.SignOutput{KeyId: in.KeyId, Signature: signature, SigningAlgorithm: in.SigningAlgorithm}, err
+}
+
+func TestAWSKeyProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeAWSKMS{key: key}
+	p := &AWSKeyProvider{keyID: "arn:aws:kms:us-east-1:111122223333:key/test", client: fake}
+	signer, err := p.Signer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("handshake"))
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	signature, err := signer.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.algorithm != kms.SigningAlgorithmSpecRsassaPssSha256 {
+		t.Errorf("unexpected signing algorithm %s", fake.algorithm)
+	}
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:], signature, opts); err != nil {
+		t.Error(err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: 10, Hash: crypto.SHA256}); err == nil {
+		t.Error("expected an unsupported salt length to be rejected")
+	}
+}
+
+func TestAWSSigningAlgorithm(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cases := []struct {
+		public crypto.PublicKey
+		opts   crypto.SignerOpts
+		want   string
+	}{
+		{ecKey.Public(), crypto.SHA384, kms.SigningAlgorithmSpecEcdsaSha384},
+		{rsaKey.Public(), crypto.SHA256, kms.SigningAlgorithmSpecRsassaPkcs1V15Sha256},
+		{rsaKey.Public(), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}, kms.SigningAlgorithmSpecRsassaPssSha512},
+	}
+	for _, c := range cases {
+		got, err := awsSigningAlgorithm(c.public, c.opts)
+		if err != nil || got != c.want {
+			t.Errorf("expected %s, got %s: %v", c.want, got, err)
+		}
+	}
+	if _, err := awsSigningAlgorithm(rsaKey.Public(), crypto.SHA1); err == nil {
+		t.Error("expected SHA1 to be rejected")
+	}
+}
+
+func TestNewKeyProvider(t *testing.T) {
+	if _, err := NewKeyProvider("vault://key"); err == nil {
+		t.Error("expected an unsupported KMS to be rejected")
+	}
+}
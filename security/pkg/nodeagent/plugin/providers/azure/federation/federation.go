@@ -0,0 +1,173 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package federation exchanges the Kubernetes service account token of the workload for an Azure AD
+// access token, with the client assertion flow of Azure AD workload identity federation.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+const (
+	// DefaultAuthorityHost is the Azure AD authority of the Azure public cloud.
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	httpTimeout         = 10 * time.Second
+	// maxResponseSize bounds the size of the Azure AD responses read.
+	maxResponseSize = 64 * 1024
+)
+
+var federationLog = log.RegisterScope("azurefederation", "Azure AD workload identity federation", 0)
+
+// Options configures an Exchanger. The AKS workload identity webhook sets the tenant, client and
+// authority host of the service accounts with a federated credential in the AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_AUTHORITY_HOST variables.
+type Options struct {
+	// TenantID is the Azure AD tenant of the application or managed identity.
+	TenantID string
+	// ClientID is the client ID of the application or managed identity trusting the service account
+	// token with a federated credential.
+	ClientID string
+	// Scope is the scope of the access token, e.g. api://istiod/.default.
+	Scope string
+	// AuthorityHost is the Azure AD authority, DefaultAuthorityHost if empty.
+	AuthorityHost string
+
+	// HTTPClient is the client of the token requests, a default one if nil.
+	HTTPClient *http.Client
+}
+
+// Exchanger exchanges the service account token of the workload, trusted by a federated credential of
+// an Azure AD application or managed identity, for an access token of that identity.
+type Exchanger struct {
+	endpoint string
+	clientID string
+	scope    string
+	client   *http.Client
+}
+
+var _ security.ExpiringTokenExchanger = &Exchanger{}
+
+// NewExchanger returns an Exchanger configured by opts.
+func NewExchanger(opts Options) (*Exchanger, error) {
+	if opts.TenantID == "" || opts.ClientID == "" {
+		return nil, fmt.Errorf("the Azure AD tenant and client IDs are required")
+	}
+	if opts.Scope == "" {
+		return nil, fmt.Errorf("the scope of the Azure AD access token is required")
+	}
+	authority := strings.TrimSuffix(opts.AuthorityHost, "/")
+	if authority == "" {
+		authority = DefaultAuthorityHost
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	return &Exchanger{
+		endpoint: fmt.Sprintf("%s/%s/oauth2/v2.0/token", authority, url.PathEscape(opts.TenantID)),
+		clientID: opts.ClientID,
+		scope:    opts.Scope,
+		client:   client,
+	}, nil
+}
+
+// ExchangeToken exchanges the service account token for an Azure AD access token.
+func (e *Exchanger) ExchangeToken(ctx context.Context, serviceAccountToken string) (string, error) {
+	token, _, err := e.ExchangeTokenWithExpiry(ctx, serviceAccountToken)
+	return token, err
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeTokenWithExpiry exchanges the service account token as ExchangeToken, returning the expiry
+// of the access token.
+func (e *Exchanger) ExchangeTokenWithExpiry(ctx context.Context, serviceAccountToken string) (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {e.clientID},
+		"scope":                 {e.scope},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {serviceAccountToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, security.NewRetryableError(fmt.Errorf("the Azure AD token request failed: %v", err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", time.Time{}, security.NewRetryableError(fmt.Errorf("failed to read the Azure AD token response: %v", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, responseError(resp.StatusCode, body)
+	}
+	token := &tokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to unmarshal the Azure AD token response: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("the Azure AD token response has no access_token")
+	}
+	federationLog.Debugf("exchanged the service account token for an access token of client %s", e.clientID)
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, expiry, nil
+}
+
+// responseError returns the error of a failed token request: fatal if Azure AD rejected the client or
+// the scope, e.g. without a federated credential matching the issuer and subject of the service account
+// token, so that it is not retried until the configuration is fixed.
+func responseError(status int, body []byte) error {
+	aadErr := &errorResponse{}
+	_ = json.Unmarshal(body, aadErr)
+	err := fmt.Errorf("the Azure AD token request failed: status code %d, error %q: %s", status, aadErr.Error, aadErr.ErrorDescription)
+	switch {
+	case status >= 500, status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return security.NewRetryableError(err)
+	case aadErr.Error == "invalid_client", aadErr.Error == "unauthorized_client", aadErr.Error == "invalid_scope":
+		return security.NewFatalError(err)
+	default:
+		// e.g. invalid_grant for an expired service account token, which may be refreshed.
+		return err
+	}
+}
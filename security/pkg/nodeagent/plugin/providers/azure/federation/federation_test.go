@@ -0,0 +1,102 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestExchangeToken(t *testing.T) {
+	var path string
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = r.ParseForm()
+		form = r.PostForm
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "aad-token", TokenType: "Bearer", ExpiresIn: 3599})
+	}))
+	defer server.Close()
+
+	e, err := NewExchanger(Options{TenantID: "tenant", ClientID: "client", Scope: "api://istiod/.default", AuthorityHost: server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, expiry, err := e.ExchangeTokenWithExpiry(context.Background(), "sa-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "aad-token" || time.Until(expiry) < 59*time.Minute {
+		t.Fatalf("got token %q expiring at %v", token, expiry)
+	}
+	if path != "/tenant/oauth2/v2.0/token" {
+		t.Fatalf("got path %s", path)
+	}
+	expected := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {"client"},
+		"scope":                 {"api://istiod/.default"},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {"sa-token"},
+	}
+	if !reflect.DeepEqual(form, expected) {
+		t.Fatalf("got form %v, expected %v", form, expected)
+	}
+}
+
+func TestExchangeTokenErrors(t *testing.T) {
+	if _, err := NewExchanger(Options{TenantID: "tenant", Scope: "api://istiod/.default"}); err == nil {
+		t.Error("expected the client ID to be required")
+	}
+	cases := []struct {
+		name   string
+		status int
+		error  string
+		fatal  bool
+	}{
+		{name: "unavailable", status: http.StatusServiceUnavailable},
+		{name: "expired assertion", status: http.StatusBadRequest, error: "invalid_grant"},
+		{name: "no federated credential", status: http.StatusUnauthorized, error: "invalid_client", fatal: true},
+		{name: "unknown scope", status: http.StatusBadRequest, error: "invalid_scope", fatal: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				_ = json.NewEncoder(w).Encode(errorResponse{Error: c.error, ErrorDescription: "AADSTS00000"})
+			}))
+			defer server.Close()
+			e, err := NewExchanger(Options{TenantID: "tenant", ClientID: "client", Scope: "api://istiod/.default", AuthorityHost: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = e.ExchangeToken(context.Background(), "sa-token")
+			if err == nil {
+				t.Fatal("expected the exchange to fail")
+			}
+			if security.IsFatalError(err) != c.fatal {
+				t.Fatalf("got error %v, expected fatal %v", err, c.fatal)
+			}
+		})
+	}
+}
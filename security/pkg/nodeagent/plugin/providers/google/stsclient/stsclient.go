@@ -17,6 +17,7 @@ package stsclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -80,12 +81,23 @@ func retryable(code int) bool {
 			code == http.StatusNetworkAuthenticationRequired)
 }
 
-func (p *SecureTokenServiceExchanger) requestWithRetry(reqBytes []byte) ([]byte, error) {
+// fatal reports whether the STS rejected the request itself, typically for an invalid audience, so
+// that the exchange will not succeed until the configuration is fixed. An unauthorized subject token
+// is not fatal, as it may be refreshed.
+func fatal(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= 400 && code < 500
+}
+
+func (p *SecureTokenServiceExchanger) requestWithRetry(ctx context.Context, reqBytes []byte) ([]byte, error) {
 	attempts := 0
 	var lastError error
 	for attempts < 5 {
 		attempts++
-		req, err := http.NewRequest("POST", SecureTokenEndpoint, bytes.NewBuffer(reqBytes))
+		req, err := http.NewRequestWithContext(ctx, "POST", SecureTokenEndpoint, bytes.NewBuffer(reqBytes))
 		if err != nil {
 			return nil, err
 		}
@@ -95,7 +107,9 @@ func (p *SecureTokenServiceExchanger) requestWithRetry(reqBytes []byte) ([]byte,
 		if err != nil {
 			lastError = err
 			stsClientLog.Errorf("token exchange request failed: %v", err)
-			time.Sleep(p.backoff)
+			if err := p.sleep(ctx); err != nil {
+				return nil, err
+			}
 			monitoring.NumOutgoingRetries.With(monitoring.RequestType.Value(monitoring.TokenExchange)).Increment()
 			continue
 		}
@@ -108,6 +122,9 @@ func (p *SecureTokenServiceExchanger) requestWithRetry(reqBytes []byte) ([]byte,
 		lastError = fmt.Errorf("token exchange request failed: status code %v body %v", resp.StatusCode, string(body))
 		resp.Body.Close()
 		if !retryable(resp.StatusCode) {
+			if fatal(resp.StatusCode) {
+				return nil, security.NewFatalError(lastError)
+			}
 			break
 		}
 		monitoring.NumOutgoingRetries.With(monitoring.RequestType.Value(monitoring.TokenExchange)).Increment()
@@ -116,37 +133,62 @@ func (p *SecureTokenServiceExchanger) requestWithRetry(reqBytes []byte) ([]byte,
 		} else {
 			stsClientLog.Errorf("token exchange request failed: status code %v", resp.StatusCode)
 		}
-		time.Sleep(p.backoff)
+		if err := p.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return nil, security.NewRetryableError(fmt.Errorf("exchange failed all retries, last error: %w", lastError))
+}
+
+// sleep waits for the retry backoff, returning early with an error if ctx is cancelled.
+func (p *SecureTokenServiceExchanger) sleep(ctx context.Context) error {
+	select {
+	case <-time.After(p.backoff):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil, fmt.Errorf("exchange failed all retries, last error: %v", lastError)
 }
 
+var _ security.ExpiringTokenExchanger = &SecureTokenServiceExchanger{}
+
 // ExchangeToken exchange oauth access token from trusted domain and k8s sa jwt.
-func (p *SecureTokenServiceExchanger) ExchangeToken(k8sSAjwt string) (string, error) {
+func (p *SecureTokenServiceExchanger) ExchangeToken(ctx context.Context, k8sSAjwt string) (string, error) {
+	token, _, err := p.ExchangeTokenWithExpiry(ctx, k8sSAjwt)
+	return token, err
+}
+
+// ExchangeTokenWithExpiry exchanges the k8s sa jwt as ExchangeToken, returning the expiry of the
+// access token, or the zero time if the response has no expires_in.
+func (p *SecureTokenServiceExchanger) ExchangeTokenWithExpiry(ctx context.Context, k8sSAjwt string) (string, time.Time, error) {
 	aud := p.audience
 	jsonStr, err := constructFederatedTokenRequest(aud, k8sSAjwt)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal federated token request: %v", err)
+		return "", time.Time{}, fmt.Errorf("failed to marshal federated token request: %v", err)
 	}
 
-	body, err := p.requestWithRetry(jsonStr)
+	body, err := p.requestWithRetry(ctx, jsonStr)
 	if err != nil {
-		return "", fmt.Errorf("token exchange failed: %v, (aud: %s, STS endpoint: %s)", err, aud, SecureTokenEndpoint)
+		return "", time.Time{}, fmt.Errorf("token exchange failed: %w, (aud: %s, STS endpoint: %s)", err, aud, SecureTokenEndpoint)
 	}
 	respData := &federatedTokenResponse{}
 	if err := json.Unmarshal(body, respData); err != nil {
 		// Normally the request should json - extremely hard to debug otherwise, not enough info in status/err
 		stsClientLog.Debugf("Unexpected unmarshal error, response was %s", string(body))
-		return "", fmt.Errorf("(aud: %s, STS endpoint: %s), failed to unmarshal response data of size %v: %v",
+		return "", time.Time{}, fmt.Errorf("(aud: %s, STS endpoint: %s), failed to unmarshal response data of size %v: %v",
 			aud, SecureTokenEndpoint, len(body), err)
 	}
 
 	if respData.AccessToken == "" {
-		return "", fmt.Errorf(
+		return "", time.Time{}, fmt.Errorf(
 			"exchanged empty token (aud: %s, STS endpoint: %s), response: %v", aud, SecureTokenEndpoint, string(body))
 	}
 
-	return respData.AccessToken, nil
+	var expiry time.Time
+	if respData.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(respData.ExpiresIn) * time.Second)
+	}
+	return respData.AccessToken, expiry, nil
 }
 
 func constructAudience(credFetcher security.CredFetcher, trustDomain string) string {
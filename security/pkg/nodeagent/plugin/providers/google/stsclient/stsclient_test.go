@@ -15,11 +15,15 @@
 package stsclient
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/security/pkg/monitoring"
 	"istio.io/istio/security/pkg/nodeagent/util"
@@ -44,7 +48,7 @@ func TestGetFederatedToken(t *testing.T) {
 	})
 
 	t.Run("exchange", func(t *testing.T) {
-		token, err := r.ExchangeToken(mock.FakeSubjectToken)
+		token, err := r.ExchangeToken(context.Background(), mock.FakeSubjectToken)
 		if err != nil {
 			t.Fatalf("failed to call exchange token %v", err)
 		}
@@ -57,16 +61,27 @@ func TestGetFederatedToken(t *testing.T) {
 		t.Cleanup(func() {
 			ms.SetGenFedTokenError(nil)
 		})
-		_, err := r.ExchangeToken(mock.FakeSubjectToken)
+		_, err := r.ExchangeToken(context.Background(), mock.FakeSubjectToken)
 		if err == nil {
 			t.Fatalf("expected error %v", err)
 		}
+		if security.IsFatalError(err) {
+			t.Fatalf("expected server error to be retryable: %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := r.ExchangeToken(ctx, mock.FakeSubjectToken); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the exchange to be cancelled, got %v", err)
+		}
 	})
 
 	t.Run("retry", func(t *testing.T) {
 		monitoring.Reset()
 		ms.SetGenFedTokenError(errors.New("fake error"))
-		_, err := r.ExchangeToken(mock.FakeSubjectToken)
+		_, err := r.ExchangeToken(context.Background(), mock.FakeSubjectToken)
 		if err == nil {
 			t.Fatalf("expected error %v", err)
 		}
@@ -85,3 +100,36 @@ func TestGetFederatedToken(t *testing.T) {
 		}, retry.Timeout(time.Second*5))
 	})
 }
+
+func TestExchangeTokenErrorClassification(t *testing.T) {
+	cases := []struct {
+		code  int
+		fatal bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusForbidden, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tc := range cases {
+		t.Run(http.StatusText(tc.code), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.code)
+			}))
+			defer server.Close()
+			SecureTokenEndpoint = server.URL
+			defer func() { SecureTokenEndpoint = "https://sts.googleapis.com/v1/token" }()
+
+			r := NewSecureTokenServiceExchanger(nil, mock.FakeTrustDomain)
+			r.backoff = time.Millisecond
+			_, err := r.ExchangeToken(context.Background(), mock.FakeSubjectToken)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if got := security.IsFatalError(err); got != tc.fatal {
+				t.Fatalf("got fatal %v, want %v: %v", got, tc.fatal, err)
+			}
+		})
+	}
+}
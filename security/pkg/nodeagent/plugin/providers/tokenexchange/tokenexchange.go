@@ -0,0 +1,225 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tokenexchange is an OAuth 2.0 token exchange (RFC 8693) client, exchanging the token of the
+// workload with any standards compliant STS.
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+const (
+	GrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// Token types of RFC 8693.
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+
+	// ClientAuthNone, ClientAuthBasic and ClientAuthPost are the ways the client authenticates to the STS:
+	// not at all, with its credentials in the authorization header (client_secret_basic) or in the
+	// request body (client_secret_post).
+	ClientAuthNone  = "none"
+	ClientAuthBasic = "basic"
+	ClientAuthPost  = "post"
+
+	httpTimeout = 10 * time.Second
+	// maxResponseSize bounds the size of the STS responses read.
+	maxResponseSize = 64 * 1024
+)
+
+var tokenExchangeLog = log.RegisterScope("tokenexchange", "OAuth 2.0 token exchange client", 0)
+
+// Options configures an Exchanger.
+type Options struct {
+	// Endpoint is the URL of the token endpoint of the STS.
+	Endpoint string
+	// Audiences and Resources are the audience and resource parameters, naming the services the
+	// exchanged token is for.
+	Audiences []string
+	Resources []string
+	// Scope is the space separated scopes requested, if any.
+	Scope string
+	// SubjectTokenType is the type of the exchanged token, TokenTypeJWT if empty.
+	SubjectTokenType string
+	// RequestedTokenType is the type of the requested token, TokenTypeAccessToken if empty.
+	RequestedTokenType string
+
+	// ClientAuth is how the client authenticates: ClientAuthNone, ClientAuthBasic or ClientAuthPost.
+	// If empty, ClientAuthBasic if ClientID is set, else ClientAuthNone.
+	ClientAuth   string
+	ClientID     string
+	ClientSecret string
+
+	// HTTPClient is the client of the STS requests, a default one if nil.
+	HTTPClient *http.Client
+}
+
+// Exchanger exchanges tokens with an OAuth 2.0 token exchange endpoint.
+type Exchanger struct {
+	opts   Options
+	client *http.Client
+}
+
+var _ security.ExpiringTokenExchanger = &Exchanger{}
+
+// NewExchanger returns an Exchanger configured by opts.
+func NewExchanger(opts Options) (*Exchanger, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("invalid token exchange endpoint %q", opts.Endpoint)
+	}
+	if opts.SubjectTokenType == "" {
+		opts.SubjectTokenType = TokenTypeJWT
+	}
+	if opts.RequestedTokenType == "" {
+		opts.RequestedTokenType = TokenTypeAccessToken
+	}
+	if opts.ClientAuth == "" {
+		opts.ClientAuth = ClientAuthNone
+		if opts.ClientID != "" {
+			opts.ClientAuth = ClientAuthBasic
+		}
+	}
+	switch opts.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthBasic, ClientAuthPost:
+		if opts.ClientID == "" {
+			return nil, fmt.Errorf("client authentication %s requires a client ID", opts.ClientAuth)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported client authentication %q", opts.ClientAuth)
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	return &Exchanger{opts: opts, client: client}, nil
+}
+
+// ExchangeToken exchanges subjectToken for a token of the requested type.
+func (e *Exchanger) ExchangeToken(ctx context.Context, subjectToken string) (string, error) {
+	token, _, err := e.ExchangeTokenWithExpiry(ctx, subjectToken)
+	return token, err
+}
+
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeTokenWithExpiry exchanges subjectToken as ExchangeToken, returning the expiry of the
+// exchanged token, or the zero time if the response has no expires_in.
+func (e *Exchanger) ExchangeTokenWithExpiry(ctx context.Context, subjectToken string) (string, time.Time, error) {
+	req, err := e.request(ctx, subjectToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, security.NewRetryableError(fmt.Errorf("token exchange request to %s failed: %v", e.opts.Endpoint, err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", time.Time{}, security.NewRetryableError(fmt.Errorf("failed to read token exchange response: %v", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, e.responseError(resp.StatusCode, body)
+	}
+	token := &tokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to unmarshal token exchange response: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token exchange response of %s has no access_token", e.opts.Endpoint)
+	}
+	if token.IssuedTokenType != "" && token.IssuedTokenType != e.opts.RequestedTokenType {
+		tokenExchangeLog.Debugf("requested a token of type %s, issued %s", e.opts.RequestedTokenType, token.IssuedTokenType)
+	}
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, expiry, nil
+}
+
+func (e *Exchanger) request(ctx context.Context, subjectToken string) (*http.Request, error) {
+	form := url.Values{
+		"grant_type":           {GrantType},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {e.opts.SubjectTokenType},
+		"requested_token_type": {e.opts.RequestedTokenType},
+	}
+	for _, aud := range e.opts.Audiences {
+		form.Add("audience", aud)
+	}
+	for _, resource := range e.opts.Resources {
+		form.Add("resource", resource)
+	}
+	if e.opts.Scope != "" {
+		form.Set("scope", e.opts.Scope)
+	}
+	if e.opts.ClientAuth == ClientAuthPost {
+		form.Set("client_id", e.opts.ClientID)
+		form.Set("client_secret", e.opts.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.opts.ClientAuth == ClientAuthBasic {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before the basic encoding.
+		req.SetBasicAuth(url.QueryEscape(e.opts.ClientID), url.QueryEscape(e.opts.ClientSecret))
+	}
+	return req, nil
+}
+
+// responseError returns the error of a failed exchange: fatal if the STS rejected the request itself,
+// e.g. for an invalid audience or client, so that it is not retried until the configuration is fixed.
+func (e *Exchanger) responseError(status int, body []byte) error {
+	oauthErr := &errorResponse{}
+	_ = json.Unmarshal(body, oauthErr)
+	err := fmt.Errorf("token exchange with %s failed: status code %d, error %q: %s",
+		e.opts.Endpoint, status, oauthErr.Error, oauthErr.ErrorDescription)
+	switch {
+	case status >= 500, status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return security.NewRetryableError(err)
+	case oauthErr.Error == "invalid_grant", status == http.StatusUnauthorized && oauthErr.Error == "":
+		// The subject token may be refreshed.
+		return err
+	default:
+		return security.NewFatalError(err)
+	}
+}
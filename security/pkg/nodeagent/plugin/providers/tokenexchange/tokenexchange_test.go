@@ -0,0 +1,180 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+// fakeSTS records the last request form and answers with status and response.
+type fakeSTS struct {
+	status   int
+	response interface{}
+
+	form       url.Values
+	user, pass string
+	basic      bool
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	f.form = r.PostForm
+	f.user, f.pass, f.basic = r.BasicAuth()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.status)
+	_ = json.NewEncoder(w).Encode(f.response)
+}
+
+func newSTS(t *testing.T, status int, response interface{}) (*fakeSTS, string) {
+	sts := &fakeSTS{status: status, response: response}
+	server := httptest.NewServer(sts)
+	t.Cleanup(server.Close)
+	return sts, server.URL + "/token"
+}
+
+func TestNewExchanger(t *testing.T) {
+	for _, opts := range []Options{
+		{Endpoint: "sts.example.com/token"},
+		{Endpoint: "ftp://sts.example.com/token"},
+		{Endpoint: "https://sts.example.com/token", ClientAuth: ClientAuthPost},
+		{Endpoint: "https://sts.example.com/token", ClientAuth: "private_key_jwt", ClientID: "agent"},
+	} {
+		if _, err := NewExchanger(opts); err == nil {
+			t.Errorf("expected options %+v to be invalid", opts)
+		}
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	sts, endpoint := newSTS(t, http.StatusOK, tokenResponse{
+		AccessToken:     "exchanged",
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       3600,
+	})
+	cases := []struct {
+		name     string
+		opts     Options
+		form     url.Values
+		basicID  string
+		basicPwd string
+	}{
+		{
+			name: "no client authentication",
+			opts: Options{Endpoint: endpoint, Audiences: []string{"ca-1", "ca-2"}, Scope: "csr read"},
+			form: url.Values{
+				"grant_type":           {GrantType},
+				"subject_token":        {"subject"},
+				"subject_token_type":   {TokenTypeJWT},
+				"requested_token_type": {TokenTypeAccessToken},
+				"audience":             {"ca-1", "ca-2"},
+				"scope":                {"csr read"},
+			},
+		},
+		{
+			name:     "client_secret_basic",
+			opts:     Options{Endpoint: endpoint, ClientID: "agent:1", ClientSecret: "s3cr&t", Resources: []string{"https://ca"}},
+			basicID:  "agent%3A1",
+			basicPwd: "s3cr%26t",
+			form: url.Values{
+				"grant_type":           {GrantType},
+				"subject_token":        {"subject"},
+				"subject_token_type":   {TokenTypeJWT},
+				"requested_token_type": {TokenTypeAccessToken},
+				"resource":             {"https://ca"},
+			},
+		},
+		{
+			name: "client_secret_post",
+			opts: Options{
+				Endpoint: endpoint, ClientAuth: ClientAuthPost, ClientID: "agent", ClientSecret: "secret",
+				SubjectTokenType: TokenTypeIDToken, RequestedTokenType: TokenTypeJWT,
+			},
+			form: url.Values{
+				"grant_type":           {GrantType},
+				"subject_token":        {"subject"},
+				"subject_token_type":   {TokenTypeIDToken},
+				"requested_token_type": {TokenTypeJWT},
+				"client_id":            {"agent"},
+				"client_secret":        {"secret"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e, err := NewExchanger(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, expiry, err := e.ExchangeTokenWithExpiry(context.Background(), "subject")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "exchanged" {
+				t.Fatalf("got token %q", token)
+			}
+			if d := time.Until(expiry); d < 59*time.Minute || d > time.Hour {
+				t.Fatalf("got expiry in %v, expected an hour", d)
+			}
+			if !reflect.DeepEqual(sts.form, c.form) {
+				t.Fatalf("got form %v, expected %v", sts.form, c.form)
+			}
+			if sts.basic != (c.basicID != "") || sts.user != c.basicID || sts.pass != c.basicPwd {
+				t.Fatalf("got basic credentials %q:%q, expected %q:%q", sts.user, sts.pass, c.basicID, c.basicPwd)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		response interface{}
+		fatal    bool
+	}{
+		{name: "unavailable", status: http.StatusServiceUnavailable},
+		{name: "throttled", status: http.StatusTooManyRequests},
+		{name: "invalid grant", status: http.StatusBadRequest, response: errorResponse{Error: "invalid_grant"}},
+		{name: "invalid target", status: http.StatusBadRequest, response: errorResponse{Error: "invalid_target"}, fatal: true},
+		{name: "invalid client", status: http.StatusUnauthorized, response: errorResponse{Error: "invalid_client"}, fatal: true},
+		{name: "no token", status: http.StatusOK, response: tokenResponse{TokenType: "Bearer"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, endpoint := newSTS(t, c.status, c.response)
+			e, err := NewExchanger(Options{Endpoint: endpoint})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = e.ExchangeToken(context.Background(), "subject")
+			if err == nil {
+				t.Fatal("expected the exchange to fail")
+			}
+			if security.IsFatalError(err) != c.fatal {
+				t.Fatalf("got error %v, expected fatal %v", err, c.fatal)
+			}
+		})
+	}
+}
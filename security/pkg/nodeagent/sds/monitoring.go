@@ -52,6 +52,13 @@ var (
 		"total_secret_update_failures",
 		"The total number of dynamic secret update failures reported by proxy.",
 	)
+
+	// initialCertificateDuration records the time taken to fetch the initial workload certificate and
+	// root certificate at startup.
+	initialCertificateDuration = monitoring.NewGauge(
+		"startup_certificate_duration_seconds",
+		"The time taken to fetch the initial workload and root certificates at startup, in seconds.",
+	)
 )
 
 func init() {
@@ -61,5 +68,6 @@ func init() {
 		totalActiveConnCounts,
 		totalStaleConnCounts,
 		totalSecretUpdateFailureCounts,
+		initialCertificateDuration,
 	)
 }
@@ -16,8 +16,11 @@
 package sds
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -25,13 +28,14 @@ import (
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	sds "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
-	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config/schema/gvk"
@@ -46,6 +50,18 @@ type sdsservice struct {
 
 	XdsServer *xds.DiscoveryServer
 	stop      chan struct{}
+
+	// rootCache holds the encoded form of root certificate resources, keyed by resource name. Trust
+	// bundles can be large (for example with many federated trust domains), so they are encoded once
+	// and shared by all SDS streams rather than marshaled again for every push.
+	rootCacheMu sync.Mutex
+	rootCache   map[string]encodedRoot
+}
+
+type encodedRoot struct {
+	rootCert []byte
+	crl      []byte
+	resource *any.Any
 }
 
 // Assert we implement the generator interface
@@ -69,15 +85,12 @@ func NewXdsServer(stop chan struct{}, gen model.XdsResourceGenerator) *xds.Disco
 			return false
 		}
 
-		names := sets.NewSet(wr.ResourceNames...)
-		found := false
-		for name := range model.ConfigsOfKind(req.ConfigsUpdated, gvk.Secret) {
-			if names.Contains(name.Name) {
-				found = true
-				break
+		for _, name := range wr.ResourceNames {
+			if secretUpdated(name, req.ConfigsUpdated) {
+				return true
 			}
 		}
-		return found
+		return false
 	}
 	s.DiscoveryServer.Start(stop)
 	return s.DiscoveryServer
@@ -86,8 +99,9 @@ func NewXdsServer(stop chan struct{}, gen model.XdsResourceGenerator) *xds.Disco
 // newSDSService creates Secret Discovery Service which implements envoy SDS API.
 func newSDSService(st security.SecretManager, options *security.Options) *sdsservice {
 	ret := &sdsservice{
-		st:   st,
-		stop: make(chan struct{}),
+		st:        st,
+		stop:      make(chan struct{}),
+		rootCache: map[string]encodedRoot{},
 	}
 	ret.XdsServer = NewXdsServer(ret.stop, ret)
 
@@ -100,6 +114,7 @@ func newSDSService(st security.SecretManager, options *security.Options) *sdsser
 	// configured, in which case this will fail; if it becomes noisy we should disable the entire SDS
 	// server in these cases.
 	go func() {
+		start := time.Now()
 		b := backoff.NewExponentialBackOff()
 		b.MaxElapsedTime = 0
 		for {
@@ -126,56 +141,111 @@ func newSDSService(st security.SecretManager, options *security.Options) *sdsser
 			case <-time.After(b.NextBackOff()):
 			}
 		}
+		initialCertificateDuration.Record(time.Since(start).Seconds())
+		sdsServiceLog.Infof("warmed workload certificates in %v", time.Since(start))
 	}()
 
 	return ret
 }
 
-func (s *sdsservice) generate(resourceNames []string) (model.Resources, error) {
-	resources := model.Resources{}
+func (s *sdsservice) generate(ctx context.Context, resourceNames []string) (model.Resources, error) {
+	ctx, span := trace.StartSpan(ctx, "istio.agent.sds_push")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("resource_names", strings.Join(resourceNames, ",")))
+	// The resources are generated at once, so that the workload certificate and its root share a CSR.
+	secrets, err := s.st.GenerateSecretsWithContext(ctx, resourceNames)
+	if err != nil {
+		// Typically, in Istiod, we do not return an error for a failure to generate a resource
+		// However, here it makes sense, because we are generally streaming a single resource,
+		// so sending an error will not cause a single failure to prevent the entire multiplex stream
+		// of resources, and failures here are generally due to temporary networking issues to the CA
+		// rather than a result of configuration issues, which trigger updates in Istiod when resolved.
+		// Instead, we rely on the client to retry (with backoff) on failures.
+		return nil, fmt.Errorf("failed to generate secrets: %v", err)
+	}
+	resources := make(model.Resources, 0, len(resourceNames))
 	for _, resourceName := range resourceNames {
-		secret, err := s.st.GenerateSecret(resourceName)
-		if err != nil {
-			// Typically, in Istiod, we do not return an error for a failure to generate a resource
-			// However, here it makes sense, because we are generally streaming a single resource,
-			// so sending an error will not cause a single failure to prevent the entire multiplex stream
-			// of resources, and failures here are generally due to temporary networking issues to the CA
-			// rather than a result of configuration issues, which trigger updates in Istiod when resolved.
-			// Instead, we rely on the client to retry (with backoff) on failures.
-			return nil, fmt.Errorf("failed to generate secret for %v: %v", resourceName, err)
-		}
-
-		res := util.MessageToAny(toEnvoySecret(secret))
 		resources = append(resources, &discovery.Resource{
 			Name:     resourceName,
-			Resource: res,
+			Resource: s.encode(secrets[resourceName]),
 		})
 	}
 	return resources, nil
 }
 
+// encode converts the secret to an Envoy resource. Root certificates are cached by content, so an
+// unchanged trust bundle is only encoded once.
+func (s *sdsservice) encode(secret *security.SecretItem) *any.Any {
+	if !isRootResource(secret.ResourceName) {
+		return util.MessageToAny(toEnvoySecret(secret))
+	}
+	s.rootCacheMu.Lock()
+	defer s.rootCacheMu.Unlock()
+	// The secret manager generally returns the same slice for an unchanged bundle, which makes this
+	// comparison cheap.
+	if cached, f := s.rootCache[secret.ResourceName]; f && bytes.Equal(cached.rootCert, secret.RootCert) &&
+		bytes.Equal(cached.crl, secret.CRL) {
+		return cached.resource
+	}
+	res := util.MessageToAny(toEnvoySecret(secret))
+	s.rootCache[secret.ResourceName] = encodedRoot{rootCert: secret.RootCert, crl: secret.CRL, resource: res}
+	return res
+}
+
+func isRootResource(resourceName string) bool {
+	cfg, ok := model.SdsCertificateConfigFromResourceName(resourceName)
+	return resourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) ||
+		strings.HasPrefix(resourceName, security.TrustDomainRootCertResourcePrefix)
+}
+
 // Generate implements the XDS Generator interface. This allows the XDS server to dispatch requests
 // for SecretTypeV3 to our server to generate the Envoy response.
-func (s *sdsservice) Generate(_ *model.Proxy, _ *model.PushContext, w *model.WatchedResource,
+func (s *sdsservice) Generate(proxy *model.Proxy, _ *model.PushContext, w *model.WatchedResource,
 	updates *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	ctx := s.streamContext(proxy)
 	// updates.Full indicates we should do a complete push of all updated resources
 	// In practice, all pushes should be incremental (ie, if the `default` cert changes we won't push
 	// all file certs).
 	if updates.Full {
-		resp, err := s.generate(w.ResourceNames)
+		resp, err := s.generate(ctx, w.ResourceNames)
 		return resp, pushLog(w.ResourceNames), err
 	}
 	names := []string{}
-	watched := sets.NewSet(w.ResourceNames...)
-	for i := range updates.ConfigsUpdated {
-		if i.Kind == gvk.Secret && watched.Contains(i.Name) {
-			names = append(names, i.Name)
+	for _, name := range w.ResourceNames {
+		if secretUpdated(name, updates.ConfigsUpdated) {
+			names = append(names, name)
 		}
 	}
-	resp, err := s.generate(names)
+	resp, err := s.generate(ctx, names)
 	return resp, pushLog(names), err
 }
 
+// streamContext returns the context of the SDS stream of proxy, so that the secrets generated for a
+// client that disconnected are abandoned.
+func (s *sdsservice) streamContext(proxy *model.Proxy) context.Context {
+	if proxy != nil {
+		for _, con := range s.XdsServer.Clients() {
+			if con.Proxy() == proxy {
+				return con.Context()
+			}
+		}
+	}
+	return context.Background()
+}
+
+// secretUpdated returns whether the resource name is updated by configsUpdated. The roots of each
+// trust domain are derived from ROOTCA, and updated with it.
+func secretUpdated(name string, configsUpdated map[model.ConfigKey]struct{}) bool {
+	if _, f := configsUpdated[model.ConfigKey{Kind: gvk.Secret, Name: name}]; f {
+		return true
+	}
+	if strings.HasPrefix(name, security.TrustDomainRootCertResourcePrefix) {
+		_, f := configsUpdated[model.ConfigKey{Kind: gvk.Secret, Name: security.RootCertReqResourceName}]
+		return f
+	}
+	return false
+}
+
 // register adds the SDS handle to the grpc server
 func (s *sdsservice) register(rpcs *grpc.Server) {
 	sds.RegisterSecretDiscoveryServiceServer(rpcs, s)
@@ -205,17 +275,26 @@ func toEnvoySecret(s *security.SecretItem) *tls.Secret {
 		Name: s.ResourceName,
 	}
 
-	cfg, ok := model.SdsCertificateConfigFromResourceName(s.ResourceName)
-	if s.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) {
-		secret.Type = &tls.Secret_ValidationContext{
-			ValidationContext: &tls.CertificateValidationContext{
-				TrustedCa: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.RootCert,
-					},
+	if isRootResource(s.ResourceName) {
+		validationContext := &tls.CertificateValidationContext{
+			TrustedCa: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.RootCert,
 				},
 			},
 		}
+		if len(s.CRL) > 0 {
+			// Envoy rejects certificates issued by a CA without a CRL once any CRL is configured, so
+			// the CRLs must cover every CA of the chain.
+			validationContext.Crl = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CRL,
+				},
+			}
+		}
+		secret.Type = &tls.Secret_ValidationContext{
+			ValidationContext: validationContext,
+		}
 	} else {
 		secret.Type = &tls.Secret_TlsCertificate{
 			TlsCertificate: &tls.TlsCertificate{
@@ -231,6 +310,13 @@ func toEnvoySecret(s *security.SecretItem) *tls.Secret {
 				},
 			},
 		}
+		if len(s.OCSPStaple) > 0 {
+			secret.GetTlsCertificate().OcspStaple = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.OCSPStaple,
+				},
+			}
+		}
 	}
 
 	return secret
@@ -14,11 +14,13 @@
 package sds
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"strings"
 	"testing"
 
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/net/context"
@@ -234,6 +236,19 @@ func TestSDS(t *testing.T) {
 		// No need to push a new root if just the cert changes
 		root.ExpectNoResponse(t)
 	})
+	t.Run("push trust domain root", func(t *testing.T) {
+		s := setupSDS(t)
+		name := ca2.TrustDomainRootCertResourcePrefix + "example.com"
+		s.store.Set(name, &ca2.SecretItem{ResourceName: name, RootCert: []byte{0o11}})
+		c := s.Connect()
+		s.Verify(c.RequestResponseAck(t, &discovery.DiscoveryRequest{ResourceNames: []string{name}}),
+			Expectation{ResourceName: name, RootCert: []byte{0o11}})
+
+		// The roots of each trust domain are pushed with ROOTCA.
+		s.store.Set(name, &ca2.SecretItem{ResourceName: name, RootCert: []byte{0o12}})
+		s.UpdateSecret(rootResourceName, &ca2.SecretItem{ResourceName: rootResourceName, RootCert: fakeRootCert})
+		s.Verify(c.ExpectResponse(t), Expectation{ResourceName: name, RootCert: []byte{0o12}})
+	})
 	t.Run("reconnect", func(t *testing.T) {
 		s := setupSDS(t)
 		c := s.Connect()
@@ -286,6 +301,41 @@ func TestSDS(t *testing.T) {
 	})
 }
 
+func TestEncodeRootCache(t *testing.T) {
+	s := newSDSService(ca2.NewDirectSecretManager(), &ca2.Options{FileMountedCerts: true})
+	t.Cleanup(s.Close)
+
+	root := &ca2.SecretItem{ResourceName: rootResourceName, RootCert: []byte{0o5}}
+	first := s.encode(root)
+	if s.encode(root) != first {
+		t.Fatalf("expected unchanged root to reuse the encoded resource")
+	}
+	if s.encode(&ca2.SecretItem{ResourceName: rootResourceName, RootCert: []byte{0o5}}) != first {
+		t.Fatalf("expected root with identical content to reuse the encoded resource")
+	}
+	if s.encode(&ca2.SecretItem{ResourceName: rootResourceName, RootCert: []byte{0o6}}) == first {
+		t.Fatalf("expected changed root to be encoded again")
+	}
+	withCRL := s.encode(&ca2.SecretItem{ResourceName: rootResourceName, RootCert: []byte{0o6}, CRL: []byte{0o7}})
+	secret := &tls.Secret{}
+	if err := withCRL.UnmarshalTo(secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := secret.GetValidationContext().GetCrl().GetInlineBytes(); !bytes.Equal(got, []byte{0o7}) {
+		t.Fatalf("expected the CRL in the validation context, got %v", got)
+	}
+	stapled := &ca2.SecretItem{ResourceName: testResourceName, CertificateChain: []byte{0o1}, OCSPStaple: []byte{0o10}}
+	if err := s.encode(stapled).UnmarshalTo(secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := secret.GetTlsCertificate().GetOcspStaple().GetInlineBytes(); !bytes.Equal(got, []byte{0o10}) {
+		t.Fatalf("expected the OCSP staple in the TLS certificate, got %v", got)
+	}
+	if s.encode(pushSecret) == s.encode(pushSecret) {
+		t.Fatalf("expected key/cert resources to not be cached")
+	}
+}
+
 func setupConnection(socket string) (*grpc.ClientConn, error) {
 	var opts []grpc.DialOption
 
@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secretwriter writes the certificates obtained by the agent back into a Kubernetes TLS
+// Secret, for integrations next to a gateway that can only consume Secrets.
+package secretwriter
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+const (
+	// ManagedByAnnotation marks the Secrets written by the agent. Secrets without it are never modified.
+	ManagedByAnnotation = "istio.io/managed-by"
+	managedByValue      = "istio-agent"
+	// IdentityAnnotation records the SPIFFE identity of the certificate in the Secret.
+	IdentityAnnotation = "security.istio.io/identity"
+	// CACertKey is the key of the root certificate in the Secret, alongside the standard TLS keys.
+	CACertKey = "ca.crt"
+)
+
+var secretWriterLog = log.RegisterScope("secretwriter", "Kubernetes Secret write-back debugging", 0)
+
+// Writer keeps a kubernetes.io/tls Secret in sync with the workload certificate.
+type Writer struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// New creates a Writer for the Secret name in namespace.
+func New(client kubernetes.Interface, namespace, name string) *Writer {
+	return &Writer{client: client, namespace: namespace, name: name}
+}
+
+// Write creates or updates the Secret with the workload certificate and the root certificate. A
+// Secret that exists but was not created by the agent is left untouched and an error is returned.
+// All replicas of a gateway share the Secret: the last rotated certificate wins, which is valid for
+// the identity of every replica.
+func (w *Writer) Write(workload *security.SecretItem, rootCert []byte) error {
+	identity := ""
+	if workload.Leaf != nil && len(workload.Leaf.URIs) > 0 {
+		identity = workload.Leaf.URIs[0].String()
+	}
+	data := map[string][]byte{
+		v1.TLSCertKey:       workload.CertificateChain,
+		v1.TLSPrivateKeyKey: workload.PrivateKey,
+		CACertKey:           rootCert,
+	}
+
+	secrets := w.client.CoreV1().Secrets(w.namespace)
+	existing, err := secrets.Get(context.TODO(), w.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      w.name,
+				Namespace: w.namespace,
+				Annotations: map[string]string{
+					ManagedByAnnotation: managedByValue,
+					IdentityAnnotation:  identity,
+				},
+			},
+			Type: v1.SecretTypeTLS,
+			Data: data,
+		}
+		if _, err := secrets.Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %v", w.namespace, w.name, err)
+		}
+		secretWriterLog.Infof("created secret %s/%s", w.namespace, w.name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %v", w.namespace, w.name, err)
+	}
+	if existing.Annotations[ManagedByAnnotation] != managedByValue {
+		return fmt.Errorf("secret %s/%s is not managed by the agent, refusing to overwrite it", w.namespace, w.name)
+	}
+	if existing.Annotations[IdentityAnnotation] == identity && equalData(existing.Data, data) {
+		return nil
+	}
+	existing.Annotations[IdentityAnnotation] = identity
+	existing.Data = data
+	if _, err := secrets.Update(context.TODO(), existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %v", w.namespace, w.name, err)
+	}
+	secretWriterLog.Infof("updated secret %s/%s", w.namespace, w.name)
+	return nil
+}
+
+func equalData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		// The data includes the private key, so it is compared in constant time.
+		if subtle.ConstantTimeCompare(v, b[k]) != 1 {
+			return false
+		}
+	}
+	return true
+}
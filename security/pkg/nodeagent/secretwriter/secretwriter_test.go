@@ -0,0 +1,90 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secretwriter
+
+import (
+	"context"
+	"crypto/x509"
+	"net/url"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/pkg/security"
+)
+
+func workloadSecret(chain string) *security.SecretItem {
+	return &security.SecretItem{
+		CertificateChain: []byte(chain),
+		PrivateKey:       []byte("key-" + chain),
+		ResourceName:     security.WorkloadKeyCertResourceName,
+		Leaf: &x509.Certificate{URIs: []*url.URL{
+			{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/istio-system/sa/ingress"},
+		}},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	w := New(client, "istio-system", "ingress-cert")
+
+	if err := w.Write(workloadSecret("chain-1"), []byte("root")); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.CoreV1().Secrets("istio-system").Get(context.TODO(), "ingress-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != v1.SecretTypeTLS {
+		t.Errorf("unexpected secret type %v", secret.Type)
+	}
+	if got := secret.Annotations[IdentityAnnotation]; got != "spiffe://cluster.local/ns/istio-system/sa/ingress" {
+		t.Errorf("unexpected identity annotation %q", got)
+	}
+	if string(secret.Data[v1.TLSCertKey]) != "chain-1" || string(secret.Data[CACertKey]) != "root" {
+		t.Errorf("unexpected secret data %v", secret.Data)
+	}
+
+	if err := w.Write(workloadSecret("chain-2"), []byte("root")); err != nil {
+		t.Fatal(err)
+	}
+	secret, err = client.CoreV1().Secrets("istio-system").Get(context.TODO(), "ingress-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[v1.TLSCertKey]) != "chain-2" || string(secret.Data[v1.TLSPrivateKeyKey]) != "key-chain-2" {
+		t.Errorf("expected rotated certificate to be written, got %v", secret.Data)
+	}
+}
+
+func TestWriteUnmanagedSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress-cert", Namespace: "istio-system"},
+		Data:       map[string][]byte{v1.TLSCertKey: []byte("user")},
+	})
+	w := New(client, "istio-system", "ingress-cert")
+	if err := w.Write(workloadSecret("chain-1"), []byte("root")); err == nil {
+		t.Fatal("expected unmanaged secret to be left untouched")
+	}
+	secret, err := client.CoreV1().Secrets("istio-system").Get(context.TODO(), "ingress-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[v1.TLSCertKey]) != "user" {
+		t.Errorf("unmanaged secret was modified: %v", secret.Data)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"istio.io/istio/pkg/security"
+)
+
+// sealedKeyBlockType is the PEM block type of a private key encrypted by SealedKeyProtector.
+const sealedKeyBlockType = "ISTIO SEALED PRIVATE KEY"
+
+// SealedKeyProtector is a security.KeyProtector that encrypts private keys with AES-256-GCM under a
+// storage key sealed to the TPM. The storage key is unsealed with the tpm2_unseal command of
+// tpm2-tools on first use and is only kept in memory, so a copy of the disk is useless without the
+// TPM of the machine.
+type SealedKeyProtector struct {
+	// handle is the persistent handle or context file of the sealed storage key.
+	handle string
+	// tool is the tpm2_unseal binary, overridden in tests.
+	tool string
+
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+var _ security.KeyProtector = &SealedKeyProtector{}
+
+// NewSealedKeyProtector creates a SealedKeyProtector for the 32 byte storage key sealed at handle.
+func NewSealedKeyProtector(handle string) *SealedKeyProtector {
+	return &SealedKeyProtector{handle: handle, tool: "tpm2_unseal"}
+}
+
+// cipher returns the AEAD of the storage key, unsealing it if needed. Failures are not cached, so a
+// transient TPM error is retried on the next call.
+func (p *SealedKeyProtector) cipher() (cipher.AEAD, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aead != nil {
+		return p.aead, nil
+	}
+	key, err := exec.Command(p.tool, "--object-context", p.handle).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", p.tool, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("sealed storage key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if p.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	tpmLog.Infof("unsealed storage key %s", p.handle)
+	return p.aead, nil
+}
+
+// Seal encrypts the PEM encoded private key into a PEM block of type "ISTIO SEALED PRIVATE KEY".
+func (p *SealedKeyProtector) Seal(privateKey []byte) ([]byte, error) {
+	aead, err := p.cipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, privateKey, []byte(sealedKeyBlockType))
+	return pem.EncodeToMemory(&pem.Block{Type: sealedKeyBlockType, Bytes: sealed}), nil
+}
+
+// Open decrypts a private key encrypted by Seal.
+func (p *SealedKeyProtector) Open(sealed []byte) ([]byte, error) {
+	block, _ := pem.Decode(sealed)
+	if block == nil || block.Type != sealedKeyBlockType {
+		return nil, fmt.Errorf("not a sealed private key")
+	}
+	aead, err := p.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed private key is truncated")
+	}
+	nonce, ciphertext := block.Bytes[:aead.NonceSize()], block.Bytes[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(sealedKeyBlockType))
+}
@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpm uses the TPM of the machine to attest CSR keys and to protect private keys at rest,
+// for VM agents that bootstrap and persist their identity without tokens.
+package tpm
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+var tpmLog = log.RegisterScope("tpm", "TPM key attestation", 0)
+
+// Attestor is a security.KeyAttestor that quotes the CSR key digest with an attestation key (AK)
+// resident in the TPM. It uses the tpm2_quote command of tpm2-tools, so that the agent doesn't
+// need to link a TPM stack.
+type Attestor struct {
+	// akContext is the persistent handle or context file of the AK, e.g. "0x81010002".
+	akContext string
+	// akCert is the DER encoded certificate of the AK.
+	akCert []byte
+	// tool is the tpm2_quote binary, overridden in tests.
+	tool string
+}
+
+var _ security.KeyAttestor = &Attestor{}
+
+// NewAttestor creates an Attestor using the AK at akContext, whose PEM or DER encoded certificate
+// is at akCertPath.
+func NewAttestor(akContext, akCertPath string) (*Attestor, error) {
+	certBytes, err := os.ReadFile(akCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AK certificate: %v", err)
+	}
+	if block, _ := pem.Decode(certBytes); block != nil {
+		certBytes = block.Bytes
+	}
+	return &Attestor{akContext: akContext, akCert: certBytes, tool: "tpm2_quote"}, nil
+}
+
+// AttestKey quotes keyDigest with the AK and returns the encoded security.TPMAttestation.
+func (a *Attestor) AttestKey(keyDigest []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "istio-tpm")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	msgPath := filepath.Join(dir, "attest")
+	sigPath := filepath.Join(dir, "signature")
+	// The PCR selection is required by TPM2_Quote; only the qualifying data is checked by istiod.
+	out, err := exec.Command(a.tool,
+		"--key-context", a.akContext,
+		"--pcr-list", "sha256:0",
+		"--qualification", hex.EncodeToString(keyDigest),
+		"--hash-algorithm", "sha256",
+		"--message", msgPath,
+		"--signature", sigPath,
+		"--format", "plain").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v: %s", a.tool, err, out)
+	}
+	attest, err := os.ReadFile(msgPath)
+	if err != nil {
+		return "", err
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return "", err
+	}
+	tpmLog.Debugf("quoted CSR key with AK %s", a.akContext)
+	att := &security.TPMAttestation{AKCertificate: a.akCert, Attest: attest, Signature: sig}
+	return att.Encode()
+}
@@ -0,0 +1,76 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+// fakeQuote writes the qualifying data as the message and a fixed signature, checking the arguments
+// the real tpm2_quote requires.
+const fakeQuote = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --key-context) ctx="$2" ;;
+    --qualification) q="$2" ;;
+    --message) msg="$2" ;;
+    --signature) sig="$2" ;;
+  esac
+  shift 2
+done
+[ "$ctx" = "0x81010002" ] || { echo "bad key context $ctx"; exit 1; }
+printf '%s' "$q" > "$msg"
+printf 'signature' > "$sig"
+`
+
+func TestAttestKey(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "tpm2_quote")
+	if err := os.WriteFile(tool, []byte(fakeQuote), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "ak.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("ak-der")}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAttestor("0x81010002", certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.tool = tool
+	encoded, err := a.AttestKey([]byte{0xab, 0xcd})
+	if err != nil {
+		t.Fatalf("AttestKey() returned error: %v", err)
+	}
+	att, err := security.ParseTPMAttestation(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(att.AKCertificate, []byte("ak-der")) || string(att.Attest) != "abcd" || string(att.Signature) != "signature" {
+		t.Errorf("unexpected attestation %+v", att)
+	}
+
+	a.akContext = "0x81010003"
+	if _, err := a.AttestKey([]byte{0xab}); err == nil {
+		t.Error("expected error when tpm2_quote fails")
+	}
+}
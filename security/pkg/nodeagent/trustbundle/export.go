@@ -0,0 +1,181 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trustbundle exports the mesh trust bundle in the formats expected by co-located legacy
+// applications.
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// PEMFile holds the mesh root certificates.
+	PEMFile = "root-certs.pem"
+	// CAFile holds the system CA certificates followed by the mesh root certificates, for applications
+	// accepting a single CA file.
+	CAFile = "ca-certificates.crt"
+	// TruststoreFile is a Java KeyStore holding the mesh root certificates as trusted entries.
+	TruststoreFile = "truststore.jks"
+	// SPIFFEBundleFile is the SPIFFE bundle of the trust domain.
+	SPIFFEBundleFile = "bundle.spiffe"
+
+	// TruststorePassword protects the integrity of the truststore; it is the JDK default, as the
+	// truststore only holds public certificates.
+	TruststorePassword = "changeit"
+
+	// dataDir is the symlink to the directory holding the current set of files.
+	dataDir = "..data"
+)
+
+// systemCAFiles are the locations of the system CA bundle, in order of preference.
+var systemCAFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// Exporter writes the trust bundle to a directory. All formats are switched at once: the files are
+// symlinks into a directory that is replaced by renaming a symlink, as done for Kubernetes volumes.
+type Exporter struct {
+	dir         string
+	trustDomain string
+}
+
+// NewExporter creates an Exporter writing to dir. trustDomain names the SPIFFE bundle.
+func NewExporter(dir, trustDomain string) *Exporter {
+	return &Exporter{dir: dir, trustDomain: trustDomain}
+}
+
+// Export writes the trust bundle for the root certificates in all formats.
+func (e *Exporter) Export(rootCert []byte) error {
+	roots, err := util.ParsePemEncodedCertificateChain(rootCert)
+	if err != nil {
+		return fmt.Errorf("failed to parse root certificates: %v", err)
+	}
+	now := time.Now()
+	files := map[string][]byte{
+		PEMFile: encodePEM(roots),
+		CAFile:  append(systemCAs(), encodePEM(roots)...),
+	}
+	if files[TruststoreFile], err = EncodeTruststore(roots, TruststorePassword, now); err != nil {
+		return err
+	}
+	if files[SPIFFEBundleFile], err = e.spiffeBundle(roots, now); err != nil {
+		return err
+	}
+	return e.write(files, now)
+}
+
+// write writes the files to a new timestamped directory, then switches the data symlink to it.
+func (e *Exporter) write(files map[string][]byte, now time.Time) error {
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return err
+	}
+	ts, err := os.MkdirTemp(e.dir, now.Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(ts, name), data, 0o644); err != nil {
+			os.RemoveAll(ts)
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := os.Chmod(ts, 0o755); err != nil {
+		os.RemoveAll(ts)
+		return err
+	}
+
+	previous, _ := os.Readlink(filepath.Join(e.dir, dataDir))
+	tmpLink := filepath.Join(e.dir, dataDir+"_tmp")
+	os.Remove(tmpLink)
+	if err := os.Symlink(filepath.Base(ts), tmpLink); err != nil {
+		os.RemoveAll(ts)
+		return err
+	}
+	if err := os.Rename(tmpLink, filepath.Join(e.dir, dataDir)); err != nil {
+		os.RemoveAll(ts)
+		return err
+	}
+	for name := range files {
+		link := filepath.Join(e.dir, name)
+		if target, err := os.Readlink(link); err == nil && target == filepath.Join(dataDir, name) {
+			continue
+		}
+		os.Remove(link)
+		if err := os.Symlink(filepath.Join(dataDir, name), link); err != nil {
+			return err
+		}
+	}
+	if previous != "" && previous != filepath.Base(ts) && strings.HasPrefix(previous, "..") {
+		os.RemoveAll(filepath.Join(e.dir, previous))
+	}
+	return nil
+}
+
+func (e *Exporter) spiffeBundle(roots []*x509.Certificate, now time.Time) ([]byte, error) {
+	doc := struct {
+		jose.JSONWebKeySet
+		Sequence uint64 `json:"spiffe_sequence,omitempty"`
+	}{
+		// The sequence only needs to increase with every update of the bundle.
+		Sequence: uint64(now.UnixNano()),
+	}
+	for _, root := range roots {
+		doc.Keys = append(doc.Keys, jose.JSONWebKey{
+			Key:          root.PublicKey,
+			Certificates: []*x509.Certificate{root},
+			Use:          "x509-svid",
+		})
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SPIFFE bundle for %s: %v", e.trustDomain, err)
+	}
+	return data, nil
+}
+
+func encodePEM(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+func systemCAs() []byte {
+	for _, f := range systemCAFiles {
+		if data, err := os.ReadFile(f); err == nil {
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				data = append(data, '\n')
+			}
+			return data
+		}
+	}
+	return nil
+}
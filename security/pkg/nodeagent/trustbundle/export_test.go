@@ -0,0 +1,200 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint: gosec // mandated by the JKS format
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func genRoot(t *testing.T) []byte {
+	t.Helper()
+	root, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org: "cluster.local", IsCA: true, IsSelfSigned: true, TTL: time.Hour, ECSigAlg: util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	e := NewExporter(dir, "cluster.local")
+
+	first := genRoot(t)
+	if err := e.Export(first); err != nil {
+		t.Fatal(err)
+	}
+	roots := append(append([]byte{}, first...), genRoot(t)...)
+	if err := e.Export(roots); err != nil {
+		t.Fatal(err)
+	}
+
+	pemData, err := os.ReadFile(filepath.Join(dir, PEMFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := util.ParsePemEncodedCertificateChain(pemData)
+	if err != nil || len(certs) != 2 {
+		t.Fatalf("expected 2 root certificates, got %d: %v", len(certs), err)
+	}
+	caData, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(caData, pemData) {
+		t.Errorf("expected CA file to end with the mesh roots")
+	}
+
+	jks, err := os.ReadFile(filepath.Join(dir, TruststoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(jks) != jksMagic || binary.BigEndian.Uint32(jks[8:]) != 2 {
+		t.Fatalf("unexpected truststore header %x", jks[:12])
+	}
+	h := sha1.New() // nolint: gosec // mandated by the JKS format
+	for _, c := range TruststorePassword {
+		h.Write([]byte{0, byte(c)})
+	}
+	h.Write([]byte(jksWhitener))
+	h.Write(jks[:len(jks)-sha1.Size])
+	if !bytes.Equal(h.Sum(nil), jks[len(jks)-sha1.Size:]) {
+		t.Errorf("truststore integrity digest does not match")
+	}
+
+	td := spiffeid.RequireTrustDomainFromString("cluster.local")
+	bundle, err := spiffebundle.Load(td, filepath.Join(dir, SPIFFEBundleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.X509Authorities()) != 2 {
+		t.Errorf("expected 2 X.509 authorities, got %d", len(bundle.X509Authorities()))
+	}
+	if seq, ok := bundle.SequenceNumber(); !ok || seq == 0 {
+		t.Errorf("expected the bundle to carry a sequence number")
+	}
+
+	// Only the current data directory is kept.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 {
+		t.Errorf("expected 4 files, the data symlink and one data directory, got %d entries", len(entries))
+	}
+}
+
+func TestExportInvalidRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := NewExporter(dir, "cluster.local").Export([]byte("invalid")); err == nil {
+		t.Fatal("expected invalid root certificate to fail the export")
+	}
+	if _, err := os.Stat(filepath.Join(dir, PEMFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no trust bundle to be written, got %v", err)
+	}
+}
+
+func TestEncodeKeystore(t *testing.T) {
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host: "spiffe://cluster.local/ns/default/sa/default", IsSelfSigned: true, TTL: time.Hour, ECSigAlg: util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := util.ParsePemEncodedKey(keyPEM)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	chain, _ := util.ParsePemEncodedCertificateChain(certPEM)
+	const password = "passphrase"
+	jks, err := EncodeKeystore(pkcs8, chain, password, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha1.New() // nolint: gosec // mandated by the JKS format
+	h.Write(jksPassword(password))
+	h.Write([]byte(jksWhitener))
+	h.Write(jks[:len(jks)-sha1.Size])
+	if !bytes.Equal(h.Sum(nil), jks[len(jks)-sha1.Size:]) {
+		t.Fatalf("keystore integrity digest does not match")
+	}
+
+	r := bytes.NewReader(jks[12 : len(jks)-sha1.Size])
+	var tag uint32
+	var aliasLen uint16
+	_ = binary.Read(r, binary.BigEndian, &tag)
+	_ = binary.Read(r, binary.BigEndian, &aliasLen)
+	alias := make([]byte, aliasLen)
+	_, _ = r.Read(alias)
+	if tag != jksPrivateKeyType || string(alias) != KeystoreAlias {
+		t.Fatalf("unexpected entry %d %q", tag, alias)
+	}
+	var created uint64
+	var protectedLen uint32
+	_ = binary.Read(r, binary.BigEndian, &created)
+	_ = binary.Read(r, binary.BigEndian, &protectedLen)
+	protectedInfo := make([]byte, protectedLen)
+	_, _ = r.Read(protectedInfo)
+
+	// Reverse the key protector of the JDK.
+	var info struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}
+	if _, err := asn1.Unmarshal(protectedInfo, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		t.Fatalf("unexpected key protection %v", info.Algorithm.Algorithm)
+	}
+	data := info.EncryptedData
+	digest, encrypted, checksum := data[:sha1.Size], data[sha1.Size:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	plain := make([]byte, 0, len(encrypted))
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		h := sha1.New() // nolint: gosec // mandated by the JKS format
+		h.Write(jksPassword(password))
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			plain = append(plain, encrypted[i+j]^digest[j])
+		}
+	}
+	h = sha1.New() // nolint: gosec // mandated by the JKS format
+	h.Write(jksPassword(password))
+	h.Write(plain)
+	if !bytes.Equal(h.Sum(nil), checksum) || !bytes.Equal(plain, pkcs8) {
+		t.Fatal("the protected key does not match")
+	}
+
+	var chainLen uint32
+	_ = binary.Read(r, binary.BigEndian, &chainLen)
+	if chainLen != 1 {
+		t.Errorf("expected a chain of 1 certificate, got %d", chainLen)
+	}
+}
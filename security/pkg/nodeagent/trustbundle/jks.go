@@ -0,0 +1,172 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1" // nolint: gosec // mandated by the JKS format
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic           = 0xfeedfeed
+	jksVersion         = 2
+	jksPrivateKeyType  = 1
+	jksTrustedCertType = 2
+	// jksWhitener is mixed into the integrity digest by the JDK.
+	jksWhitener = "Mighty Aphrodite"
+	// KeystoreAlias is the alias of the private key entry of EncodeKeystore.
+	KeystoreAlias = "istio"
+)
+
+// oidJKSKeyProtector identifies the proprietary key protection of the JDK.
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// EncodeTruststore encodes the certificates as trusted certificate entries of a Java KeyStore (JKS),
+// readable by every JDK. Entries are named "istio-root-<n>".
+func EncodeTruststore(certs []*x509.Certificate, password string, created time.Time) ([]byte, error) {
+	w := newJKSWriter(len(certs))
+	for i, cert := range certs {
+		w.write(uint32(jksTrustedCertType))
+		if err := w.writeUTF(fmt.Sprintf("istio-root-%d", i)); err != nil {
+			return nil, err
+		}
+		w.write(uint64(created.UnixNano() / int64(time.Millisecond)))
+		if err := w.writeCert(cert); err != nil {
+			return nil, err
+		}
+	}
+	return w.finish(password), nil
+}
+
+// EncodeKeystore encodes the PKCS#8 private key and its certificate chain, leaf first, as the private
+// key entry "istio" of a Java KeyStore (JKS). The key is protected with password, as by keytool.
+func EncodeKeystore(pkcs8 []byte, chain []*x509.Certificate, password string, created time.Time) ([]byte, error) {
+	protected, err := protectJKSKey(pkcs8, password)
+	if err != nil {
+		return nil, err
+	}
+	w := newJKSWriter(1)
+	w.write(uint32(jksPrivateKeyType))
+	if err := w.writeUTF(KeystoreAlias); err != nil {
+		return nil, err
+	}
+	w.write(uint64(created.UnixNano() / int64(time.Millisecond)))
+	w.write(uint32(len(protected)))
+	w.buf.Write(protected)
+	w.write(uint32(len(chain)))
+	for _, cert := range chain {
+		if err := w.writeCert(cert); err != nil {
+			return nil, err
+		}
+	}
+	return w.finish(password), nil
+}
+
+// protectJKSKey returns the EncryptedPrivateKeyInfo of the JDK key protector: the key is XORed with a
+// SHA-1 keystream seeded by a random salt, and followed by a SHA-1 checksum of the key.
+func protectJKSKey(pkcs8 []byte, password string) ([]byte, error) {
+	passwd := jksPassword(password)
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	protected := append([]byte{}, salt...)
+	digest := salt
+	for i := 0; i < len(pkcs8); i += sha1.Size {
+		h := sha1.New() // nolint: gosec // mandated by the JKS format
+		h.Write(passwd)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(pkcs8); j++ {
+			protected = append(protected, pkcs8[i+j]^digest[j])
+		}
+	}
+	h := sha1.New() // nolint: gosec // mandated by the JKS format
+	h.Write(passwd)
+	h.Write(pkcs8)
+	protected = h.Sum(protected)
+	return asn1.Marshal(struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: protected,
+	})
+}
+
+// jksWriter writes the entries of a Java KeyStore.
+type jksWriter struct {
+	buf bytes.Buffer
+}
+
+func newJKSWriter(entries int) *jksWriter {
+	w := &jksWriter{}
+	w.write(uint32(jksMagic))
+	w.write(uint32(jksVersion))
+	w.write(uint32(entries))
+	return w
+}
+
+func (w *jksWriter) write(v interface{}) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *jksWriter) writeUTF(s string) error {
+	// The JDK uses modified UTF-8, which only differs from UTF-8 for NUL and supplementary
+	// characters; aliases and types are plain ASCII.
+	if len(s) > 0xffff {
+		return fmt.Errorf("string too long for JKS: %d", len(s))
+	}
+	w.write(uint16(len(s)))
+	w.buf.WriteString(s)
+	return nil
+}
+
+func (w *jksWriter) writeCert(cert *x509.Certificate) error {
+	if err := w.writeUTF("X.509"); err != nil {
+		return err
+	}
+	w.write(uint32(len(cert.Raw)))
+	w.buf.Write(cert.Raw)
+	return nil
+}
+
+// finish appends the integrity digest, SHA-1 over the password as UTF-16BE, the whitener and the
+// keystore, and returns the keystore.
+func (w *jksWriter) finish(password string) []byte {
+	h := sha1.New() // nolint: gosec // mandated by the JKS format
+	h.Write(jksPassword(password))
+	h.Write([]byte(jksWhitener))
+	h.Write(w.buf.Bytes())
+	w.buf.Write(h.Sum(nil))
+	return w.buf.Bytes()
+}
+
+// jksPassword returns password as UTF-16BE, the form the JDK hashes passwords in.
+func jksPassword(password string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(password)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
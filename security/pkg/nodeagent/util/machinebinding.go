@@ -0,0 +1,98 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"istio.io/istio/pkg/security"
+)
+
+// MachineBindingFilename is the file recording the machine the certificates in a directory were issued to.
+const MachineBindingFilename = "machine-binding.json"
+
+// machineIDFiles are the locations of the OS machine ID, in order of preference.
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// CurrentMachineBinding returns the binding of the machine the agent runs on. The machine ID is
+// hashed, as it should not be exposed outside of the machine. The instance ID is left for the caller
+// to fill from the platform metadata.
+func CurrentMachineBinding() *security.MachineBinding {
+	for _, f := range machineIDFiles {
+		id, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if trimmed := strings.TrimSpace(string(id)); trimmed != "" {
+			digest := sha256.Sum256([]byte("istio-agent:" + trimmed))
+			return &security.MachineBinding{MachineID: hex.EncodeToString(digest[:])}
+		}
+	}
+	return &security.MachineBinding{}
+}
+
+// WriteMachineBinding records the binding in dir, owned as set by opts. If directory or binding is
+// empty, return nil.
+func WriteMachineBinding(dir string, binding *security.MachineBinding, opts security.OutputFileOptions) error {
+	if len(dir) == 0 || binding == nil || (binding.MachineID == "" && binding.InstanceID == "") {
+		return nil
+	}
+	data, err := json.Marshal(binding)
+	if err != nil {
+		return err
+	}
+	if err := writeOwnedFile(filepath.Join(dir, MachineBindingFilename), data, 0o644, opts); err != nil {
+		return fmt.Errorf("failed to write machine binding to file: %v", err)
+	}
+	return nil
+}
+
+// ReadMachineBinding reads the binding recorded in dir, or returns nil if there is none.
+func ReadMachineBinding(dir string) (*security.MachineBinding, error) {
+	data, err := os.ReadFile(filepath.Join(dir, MachineBindingFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	binding := &security.MachineBinding{}
+	if err := json.Unmarshal(data, binding); err != nil {
+		return nil, fmt.Errorf("failed to parse machine binding: %v", err)
+	}
+	return binding, nil
+}
+
+// DiscardClonedIdentity removes the key and certificate chain from dir if they were issued to another
+// machine, and reports whether it did. Certificates without a recorded binding are kept, as there is
+// no way to tell. The root certificate is not machine specific and is kept.
+func DiscardClonedIdentity(dir string, current *security.MachineBinding) (bool, error) {
+	recorded, err := ReadMachineBinding(dir)
+	if err != nil || recorded == nil || recorded.Matches(current) {
+		return false, err
+	}
+	for _, f := range []string{"key.pem", "cert-chain.pem", MachineBindingFilename} {
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to remove cloned identity: %v", err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestCurrentMachineBinding(t *testing.T) {
+	dir := t.TempDir()
+	machineID := path.Join(dir, "machine-id")
+	if err := os.WriteFile(machineID, []byte("0123456789abcdef\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	orig := machineIDFiles
+	defer func() { machineIDFiles = orig }()
+
+	machineIDFiles = []string{path.Join(dir, "missing"), machineID}
+	binding := CurrentMachineBinding()
+	if binding.MachineID == "" || binding.MachineID == "0123456789abcdef" {
+		t.Errorf("expected a digest of the machine ID, got %q", binding.MachineID)
+	}
+
+	machineIDFiles = []string{path.Join(dir, "missing")}
+	if binding := CurrentMachineBinding(); binding.MachineID != "" {
+		t.Errorf("expected no machine ID, got %q", binding.MachineID)
+	}
+}
+
+func TestDiscardClonedIdentity(t *testing.T) {
+	issued := &security.MachineBinding{MachineID: "machine-a", InstanceID: "i-1"}
+	cases := []struct {
+		name    string
+		current *security.MachineBinding
+		cloned  bool
+	}{
+		{"same machine", &security.MachineBinding{MachineID: "machine-a", InstanceID: "i-1"}, false},
+		{"no instance ID", &security.MachineBinding{MachineID: "machine-a"}, false},
+		{"instance ID changed", &security.MachineBinding{MachineID: "machine-a", InstanceID: "i-2"}, true},
+		{"machine ID changed", &security.MachineBinding{MachineID: "machine-b", InstanceID: "i-1"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := OutputKeyCertToDir(dir, []byte("key"), []byte("chain"), []byte("root"), security.OutputFileOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteMachineBinding(dir, issued, security.OutputFileOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			cloned, err := DiscardClonedIdentity(dir, tc.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cloned != tc.cloned {
+				t.Fatalf("got cloned %v, want %v", cloned, tc.cloned)
+			}
+			for _, f := range []string{"key.pem", "cert-chain.pem", MachineBindingFilename} {
+				_, err := os.Stat(path.Join(dir, f))
+				if tc.cloned != os.IsNotExist(err) {
+					t.Errorf("%s: unexpected stat result %v", f, err)
+				}
+			}
+			if _, err := os.Stat(path.Join(dir, "root-cert.pem")); err != nil {
+				t.Errorf("expected root cert to be kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestDiscardClonedIdentityWithoutBinding(t *testing.T) {
+	dir := t.TempDir()
+	if err := OutputKeyCertToDir(dir, []byte("key"), []byte("chain"), nil, security.OutputFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cloned, err := DiscardClonedIdentity(dir, &security.MachineBinding{MachineID: "machine-a"})
+	if err != nil || cloned {
+		t.Fatalf("expected identity without binding to be kept, got %v, %v", cloned, err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+const (
+	// dataLink is the symbolic link to the current version of a versioned output directory. The files
+	// of the directory are symbolic links through it, so that all of them change with a single rename.
+	dataLink = "..data"
+
+	// versionPrefix prefixes the name of the versions of a versioned output directory.
+	versionPrefix = "..version_"
+)
+
+// versionMutex serializes the updates of versioned output directories.
+var versionMutex sync.Mutex
+
+// outputFile is a file written to an output directory.
+type outputFile struct {
+	name string
+	// desc describes the content of the file in errors.
+	desc string
+	data []byte
+	// key tells whether the file holds a private key.
+	key bool
+}
+
+// writeOutputFiles writes files to dir with the permissions and ownership of opts. Each file is
+// written to a temporary file renamed over the previous one, so a reader never sees a partial file.
+// If opts.Versioned is set, the files are instead written together to a new version of dir, so a
+// reader never sees a private key with the certificate of another.
+func writeOutputFiles(dir string, files []outputFile, opts security.OutputFileOptions) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if opts.Versioned {
+		return writeVersion(dir, files, opts)
+	}
+	for _, f := range files {
+		if err := writeOutputFile(filepath.Join(dir, f.name), f.data, f.key, opts); err != nil {
+			return fmt.Errorf("failed to write %s to file: %v", f.desc, err)
+		}
+	}
+	return nil
+}
+
+// writeVersion writes files to a new version directory in dir, along with the files of the current
+// version that are not replaced, then atomically points dataLink to it and removes the previous
+// versions. Each file of dir is a symbolic link to the file of the same name in dataLink.
+func writeVersion(dir string, files []outputFile, opts security.OutputFileOptions) error {
+	versionMutex.Lock()
+	defer versionMutex.Unlock()
+
+	current, err := os.Readlink(filepath.Join(dir, dataLink))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the current output version: %v", err)
+	}
+	version, err := os.MkdirTemp(dir, versionPrefix+time.Now().Format("2006_01_02_15_04_05."))
+	if err != nil {
+		return fmt.Errorf("failed to create output version: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = os.RemoveAll(version)
+		}
+	}()
+	if err := setDirOwnership(version, opts); err != nil {
+		return fmt.Errorf("failed to set the permissions of output version: %v", err)
+	}
+
+	written := map[string]bool{}
+	for _, f := range files {
+		if err := writeOutputFile(filepath.Join(version, f.name), f.data, f.key, opts); err != nil {
+			return fmt.Errorf("failed to write %s to file: %v", f.desc, err)
+		}
+		written[f.name] = true
+	}
+	if current != "" {
+		entries, err := os.ReadDir(filepath.Join(dir, current))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read the current output version: %v", err)
+		}
+		for _, e := range entries {
+			if written[e.Name()] {
+				continue
+			}
+			// Files of a version are never modified, so the new version can share them.
+			if err := os.Link(filepath.Join(dir, current, e.Name()), filepath.Join(version, e.Name())); err != nil {
+				return fmt.Errorf("failed to carry %s over to the output version: %v", e.Name(), err)
+			}
+		}
+	}
+
+	if err := replaceSymlink(filepath.Join(dir, dataLink), filepath.Base(version)); err != nil {
+		return fmt.Errorf("failed to switch to the output version: %v", err)
+	}
+	committed = true
+
+	entries, err := os.ReadDir(version)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		target := filepath.Join(dataLink, e.Name())
+		if link, err := os.Readlink(filepath.Join(dir, e.Name())); err == nil && link == target {
+			continue
+		}
+		if err := replaceSymlink(filepath.Join(dir, e.Name()), target); err != nil {
+			return fmt.Errorf("failed to link %s to the output version: %v", e.Name(), err)
+		}
+	}
+
+	// Versions that cannot be removed now, including those left by a crash, are removed by the
+	// next update.
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), versionPrefix) && e.Name() != filepath.Base(version) {
+				_ = os.RemoveAll(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+// replaceSymlink atomically replaces path with a symbolic link to target.
+func replaceSymlink(path, target string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// setDirOwnership lets the owner of the files of opts traverse the directory.
+func setDirOwnership(dir string, opts security.OutputFileOptions) error {
+	if err := os.Chmod(dir, 0o755&^opts.Umask); err != nil {
+		return err
+	}
+	uid, gid := ownerIDs(opts)
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	return os.Chown(dir, uid, gid)
+}
@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and the Unix epoch.
+	ntpEpochOffset = 2208988800
+	ntpPacketSize  = 48
+	// sntpClientHeader is leap indicator 0, version 4, mode 3 (client).
+	sntpClientHeader = 0x23
+	sntpModeServer   = 4
+)
+
+// ClockOffset queries the (S)NTP server at address, as host:port, and returns the offset of its clock
+// from the local clock: positive if the local clock is behind.
+func ClockOffset(address string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	req[0] = sntpClientHeader
+	t1 := time.Now()
+	origin := toNTPTime(t1)
+	binary.BigEndian.PutUint64(req[40:], origin)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < ntpPacketSize {
+		return 0, fmt.Errorf("short NTP response of %d bytes", n)
+	}
+	if mode := resp[0] & 0x7; mode != sntpModeServer {
+		return 0, fmt.Errorf("unexpected NTP response mode %d", mode)
+	}
+	if stratum := resp[1]; stratum == 0 {
+		return 0, fmt.Errorf("NTP server sent kiss-of-death %q", resp[12:16])
+	}
+	if binary.BigEndian.Uint64(resp[24:]) != origin {
+		return 0, fmt.Errorf("NTP response does not match the request")
+	}
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+func fromNTPTime(ntp uint64) time.Time {
+	sec := int64(ntp>>32) - ntpEpochOffset
+	nsec := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
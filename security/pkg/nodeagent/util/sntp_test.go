@@ -0,0 +1,75 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeNTPServer answers SNTP requests with its clock set offset from the local clock.
+func fakeNTPServer(t *testing.T, offset time.Duration, stratum byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, ntpPacketSize)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, ntpPacketSize)
+			resp[0] = 0x24 // version 4, mode 4 (server)
+			resp[1] = stratum
+			copy(resp[24:32], buf[40:48])
+			now := toNTPTime(time.Now().Add(offset))
+			binary.BigEndian.PutUint64(resp[32:], now)
+			binary.BigEndian.PutUint64(resp[40:], now)
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestClockOffset(t *testing.T) {
+	for _, want := range []time.Duration{0, time.Hour, -10 * time.Minute} {
+		got, err := ClockOffset(fakeNTPServer(t, want, 2), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := got - want; d > time.Second || d < -time.Second {
+			t.Errorf("expected offset %v, got %v", want, got)
+		}
+	}
+}
+
+func TestClockOffsetKissOfDeath(t *testing.T) {
+	if _, err := ClockOffset(fakeNTPServer(t, 0, 0), time.Second); err == nil {
+		t.Fatal("expected kiss-of-death response to be rejected")
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	now := time.Now()
+	if got := fromNTPTime(toNTPTime(now)); got.Sub(now) > time.Microsecond || now.Sub(got) > time.Microsecond {
+		t.Errorf("expected %v, got %v", now, got)
+	}
+}
@@ -15,16 +15,24 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"go.opencensus.io/stats/view"
 
 	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/trustbundle"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/env"
 )
 
@@ -34,15 +42,24 @@ var k8sInCluster = env.RegisterStringVar("KUBERNETES_SERVICE_HOST", "",
 // ParseCertAndGetExpiryTimestamp parses the first certificate in certByte and returns cert expire
 // time, or return error if fails to parse certificate.
 func ParseCertAndGetExpiryTimestamp(certByte []byte) (time.Time, error) {
+	cert, err := ParseLeafCert(certByte)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// ParseLeafCert parses the first certificate in certByte, or return error if fails to parse certificate.
+func ParseLeafCert(certByte []byte) (*x509.Certificate, error) {
 	block, _ := pem.Decode(certByte)
 	if block == nil {
-		return time.Time{}, fmt.Errorf("failed to decode certificate")
+		return nil, fmt.Errorf("failed to decode certificate")
 	}
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("failed to parse certificate: %v", err)
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
 	}
-	return cert.NotAfter, nil
+	return cert, nil
 }
 
 // GetMetricsCounterValueWithTags returns counter value in float64. For test purpose only.
@@ -68,40 +85,204 @@ func GetMetricsCounterValueWithTags(metricName string, tags map[string]string) (
 	return float64(0), fmt.Errorf("no metrics matched tags %s: %d", metricName, len(rows))
 }
 
-// Output the key and certificate to the given directory.
+// Output the key and certificate to the given directory, with the permissions and ownership of opts.
 // If directory is empty, return nil.
-func OutputKeyCertToDir(dir string, privateKey, certChain, rootCert []byte) error {
+func OutputKeyCertToDir(dir string, privateKey, certChain, rootCert []byte, opts security.OutputFileOptions) error {
 	if len(dir) == 0 {
 		return nil
 	}
 
-	certFileMode := os.FileMode(0o600)
-	if k8sInCluster.Get() != "" {
-		// If this is running on k8s, give more permission to the file certs.
-		// This is typically used to share the certs with non-proxy containers in the pod which does not run as root or 1337.
-		// For example, prometheus server could use proxy provisioned certs to scrape application metrics through mTLS.
-		certFileMode = os.FileMode(0o644)
-	}
 	// Depending on the SDS resource to output, some fields may be nil
 	if privateKey == nil && certChain == nil && rootCert == nil {
 		return fmt.Errorf("the input private key, cert chain, and root cert are nil")
 	}
 
+	var files []outputFile
 	if privateKey != nil {
-		if err := file.AtomicWrite(path.Join(dir, "key.pem"), privateKey, certFileMode); err != nil {
-			return fmt.Errorf("failed to write private key to file: %v", err)
-		}
+		files = append(files, outputFile{name: "key.pem", desc: "private key", data: privateKey, key: true})
 	}
 	if certChain != nil {
-		if err := file.AtomicWrite(path.Join(dir, "cert-chain.pem"), certChain, certFileMode); err != nil {
-			return fmt.Errorf("failed to write cert chain to file: %v", err)
+		files = append(files, outputFile{name: "cert-chain.pem", desc: "cert chain", data: certChain})
+	}
+	if rootCert != nil {
+		files = append(files, outputFile{name: "root-cert.pem", desc: "root cert", data: rootCert})
+	}
+	return writeOutputFiles(dir, files, opts)
+}
+
+// OutputPKCS12ToDir writes the key, certificate chain and root certificate to key-cert.p12 in the
+// given directory, as a PKCS#12 bundle protected by passphrase.
+func OutputPKCS12ToDir(dir string, privateKey, certChain, rootCert, passphrase []byte, opts security.OutputFileOptions) error {
+	bundle, err := pkiutil.EncodePKCS12(privateKey, certChain, rootCert, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encode PKCS#12 bundle: %v", err)
+	}
+	return writeOutputFiles(dir, []outputFile{{name: "key-cert.p12", desc: "PKCS#12 bundle", data: bundle, key: true}}, opts)
+}
+
+// OutputJKSToDir writes the key and certificate chain to key-cert.jks, a Java KeyStore with the entry
+// "istio", and the root certificates to truststore.jks, in the given directory. Both are protected by
+// passphrase. Files whose content is nil are not written.
+func OutputJKSToDir(dir string, privateKey, certChain, rootCert, passphrase []byte, opts security.OutputFileOptions) error {
+	now := time.Now()
+	var files []outputFile
+	if privateKey != nil && certChain != nil {
+		key, err := pkiutil.ParsePemEncodedKey(privateKey)
+		if err != nil {
+			return err
+		}
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the private key: %v", err)
+		}
+		defer pkiutil.ZeroBytes(pkcs8)
+		chain, err := pkiutil.ParsePemEncodedCertificateChain(certChain)
+		if err != nil {
+			return err
 		}
+		keystore, err := trustbundle.EncodeKeystore(pkcs8, chain, string(passphrase), now)
+		if err != nil {
+			return fmt.Errorf("failed to encode Java KeyStore: %v", err)
+		}
+		files = append(files, outputFile{name: "key-cert.jks", desc: "Java KeyStore", data: keystore, key: true})
 	}
 	if rootCert != nil {
-		if err := file.AtomicWrite(path.Join(dir, "root-cert.pem"), rootCert, certFileMode); err != nil {
-			return fmt.Errorf("failed to write root cert to file: %v", err)
+		roots, err := pkiutil.ParsePemEncodedCertificateChain(rootCert)
+		if err != nil {
+			return err
+		}
+		truststore, err := trustbundle.EncodeTruststore(roots, string(passphrase), now)
+		if err != nil {
+			return fmt.Errorf("failed to encode Java truststore: %v", err)
 		}
+		files = append(files, outputFile{name: trustbundle.TruststoreFile, desc: "Java truststore", data: truststore})
 	}
+	return writeOutputFiles(dir, files, opts)
+}
 
-	return nil
+// ValidPassphraseSource returns true if source is a passphrase source of ReadPassphrase.
+func ValidPassphraseSource(source string) bool {
+	return strings.HasPrefix(source, "file:") || strings.HasPrefix(source, "env:")
+}
+
+// ReadPassphrase reads the passphrase of source, either file:<path> for the content of a file without
+// its trailing newline, or env:<variable> for an environment variable.
+func ReadPassphrase(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %v", err)
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("passphrase variable %s is not set", name)
+		}
+		return []byte(value), nil
+	default:
+		return nil, fmt.Errorf("invalid passphrase source %q, expected file:<path> or env:<variable>", source)
+	}
+}
+
+func outputFileMode() os.FileMode {
+	if k8sInCluster.Get() != "" {
+		// If this is running on k8s, give more permission to the file certs.
+		// This is typically used to share the certs with non-proxy containers in the pod which does not run as root or 1337.
+		// For example, prometheus server could use proxy provisioned certs to scrape application metrics through mTLS.
+		return os.FileMode(0o644)
+	}
+	return os.FileMode(0o600)
+}
+
+// writeOutputFile atomically writes a file output by the agent with the permissions and ownership of
+// opts. key tells whether the file holds a private key.
+func writeOutputFile(path string, data []byte, key bool, opts security.OutputFileOptions) error {
+	mode := outputFileMode()
+	if key && opts.KeyMode != 0 {
+		mode = opts.KeyMode
+	} else if !key && opts.CertMode != 0 {
+		mode = opts.CertMode
+	}
+	return writeOwnedFile(path, data, mode, opts)
+}
+
+// writeOwnedFile atomically writes path with mode, less the umask, owned by the UID and GID of opts.
+func writeOwnedFile(path string, data []byte, mode os.FileMode, opts security.OutputFileOptions) error {
+	uid, gid := ownerIDs(opts)
+	return file.AtomicWriteOwned(path, data, mode&^opts.Umask, uid, gid)
+}
+
+// ownerIDs returns the UID and GID of opts, or -1 for those that are not set.
+func ownerIDs(opts security.OutputFileOptions) (uid, gid int) {
+	uid, gid = -1, -1
+	if opts.UID != nil {
+		uid = *opts.UID
+	}
+	if opts.GID != nil {
+		gid = *opts.GID
+	}
+	return uid, gid
+}
+
+// LoadKeyPair reads a key pair written by OutputKeyCertToDir, decrypting the private key with
+// protector if it is not nil.
+func LoadKeyPair(certFile, keyFile string, protector security.KeyProtector) (tls.Certificate, error) {
+	if protector == nil {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	sealed, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := protector.Open(sealed)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decrypt private key %s: %v", keyFile, err)
+	}
+	// The parsed key is kept by the certificate; the decrypted PEM is no longer needed.
+	defer pkiutil.ZeroBytes(keyPEM)
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// LoadProvCert reads the key pair of the pre-provisioned certificate in options.ProvCert. Its
+// private key is held by options.ProvKeyProvider if set, and read from key.pem otherwise.
+func LoadProvCert(ctx context.Context, options *security.Options) (tls.Certificate, error) {
+	certFile := filepath.Join(options.ProvCert, "cert-chain.pem")
+	if options.ProvKeyProvider == nil {
+		return LoadKeyPair(certFile, filepath.Join(options.ProvCert, "key.pem"), options.KeyProtector)
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var certificate tls.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certificate.Certificate = append(certificate.Certificate, block.Bytes)
+		}
+	}
+	if len(certificate.Certificate) == 0 {
+		return tls.Certificate{}, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate %s: %v", certFile, err)
+	}
+	signer, err := options.ProvKeyProvider.Signer(ctx)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(leaf.PublicKey) {
+		return tls.Certificate{}, fmt.Errorf("certificate %s does not match the provisioning key", certFile)
+	}
+	certificate.PrivateKey = signer
+	certificate.Leaf = leaf
+	return certificate, nil
 }
@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestOutputKeyCertToDirPermissions(t *testing.T) {
+	dir := t.TempDir()
+	uid, gid := os.Getuid(), os.Getgid()
+	opts := security.OutputFileOptions{
+		KeyMode:  0o640,
+		CertMode: 0o644,
+		Umask:    0o004,
+		UID:      &uid,
+		GID:      &gid,
+	}
+	if err := OutputKeyCertToDir(dir, []byte("key"), []byte("chain"), []byte("root"), opts); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"key.pem":        0o640,
+		"cert-chain.pem": 0o640,
+		"root-cert.pem":  0o640,
+	} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: expected mode %o, got %o", name, want, info.Mode().Perm())
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && (int(st.Uid) != uid || int(st.Gid) != gid) {
+			t.Errorf("%s: expected owner %d:%d, got %d:%d", name, uid, gid, st.Uid, st.Gid)
+		}
+	}
+
+	opts.KeyMode = 0o600
+	opts.CertMode = 0
+	opts.Umask = 0
+	if err := OutputKeyCertToDir(dir, []byte("key"), nil, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "key.pem")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the rotated key to have mode 600: %v %v", info.Mode(), err)
+	}
+}
+
+func TestOutputKeyCertToDirVersioned(t *testing.T) {
+	dir := t.TempDir()
+	// Files written without versioning are replaced by links.
+	if err := OutputKeyCertToDir(dir, []byte("key0"), []byte("chain0"), []byte("root0"), security.OutputFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := security.OutputFileOptions{Versioned: true}
+	if err := OutputKeyCertToDir(dir, []byte("key1"), []byte("chain1"), []byte("root1"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := OutputKeyCertToDir(dir, []byte("key2"), []byte("chain2"), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"key.pem":        "key2",
+		"cert-chain.pem": "chain2",
+		"root-cert.pem":  "root1",
+	} {
+		if link, err := os.Readlink(filepath.Join(dir, name)); err != nil || link != filepath.Join(dataLink, name) {
+			t.Errorf("%s: expected a link through %s, got %q %v", name, dataLink, link, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// The links of the three files, dataLink, and the only remaining version.
+	if len(names) != 5 {
+		t.Errorf("expected previous versions and temporary files to be removed, got %v", names)
+	}
+}
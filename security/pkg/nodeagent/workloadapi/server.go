@@ -0,0 +1,254 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workloadapi serves the workload certificate of the agent through the SPIFFE Workload API,
+// so that applications and SPIFFE libraries can consume the mesh identity without Envoy.
+// See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md.
+package workloadapi
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"strings"
+	"sync"
+
+	workloadpb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/pkg/uds"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+// securityHeader must be set to "true" by Workload API clients, to protect against SSRF.
+const securityHeader = "workload.spiffe.io"
+
+var workloadAPILog = log.RegisterScope("workloadapi", "SPIFFE Workload API debugging", 0)
+
+// Server is the gRPC server that exposes the SPIFFE Workload API through UDS. The X.509 RPCs and
+// FetchJWTSVID are supported; the other JWT RPCs return Unimplemented.
+type Server struct {
+	workloadpb.UnimplementedSpiffeWorkloadAPIServer
+
+	secretManager security.SecretManager
+	grpcServer    *grpc.Server
+	listener      net.Listener
+
+	mu sync.Mutex
+	// updated is closed and replaced when the workload certificate or the trust bundle changes.
+	updated chan struct{}
+}
+
+// NewServer creates and starts the Workload API server, listening on options.WorkloadAPIUDSPath.
+func NewServer(options *security.Options, secretManager security.SecretManager) (*Server, error) {
+	listener, err := uds.NewListener(options.WorkloadAPIUDSPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		secretManager: secretManager,
+		grpcServer:    grpc.NewServer(),
+		listener:      listener,
+		updated:       make(chan struct{}),
+	}
+	workloadpb.RegisterSpiffeWorkloadAPIServer(s.grpcServer, s)
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			workloadAPILog.Errorf("SPIFFE Workload API server failed: %v", err)
+		}
+	}()
+	workloadAPILog.Infof("SPIFFE Workload API server started, listening on %q", options.WorkloadAPIUDSPath)
+	return s, nil
+}
+
+// UpdateCallback notifies the streams of clients that a secret has changed.
+func (s *Server) UpdateCallback(resourceName string) {
+	if resourceName != security.WorkloadKeyCertResourceName && resourceName != security.RootCertReqResourceName {
+		return
+	}
+	s.mu.Lock()
+	close(s.updated)
+	s.updated = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// Stop closes the gRPC server, ending all streams.
+func (s *Server) Stop() {
+	if s == nil {
+		return
+	}
+	s.grpcServer.Stop()
+	s.listener.Close()
+}
+
+func (s *Server) FetchX509SVID(_ *workloadpb.X509SVIDRequest, stream workloadpb.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	return s.stream(stream, func() error {
+		svid, federated, err := s.x509SVID()
+		if err != nil {
+			return err
+		}
+		// The response is serialized by Send, the key is no longer needed afterwards.
+		defer util.ZeroBytes(svid.X509SvidKey)
+		return stream.Send(&workloadpb.X509SVIDResponse{Svids: []*workloadpb.X509SVID{svid}, FederatedBundles: federated})
+	})
+}
+
+func (s *Server) FetchX509Bundles(_ *workloadpb.X509BundlesRequest, stream workloadpb.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
+	return s.stream(stream, func() error {
+		svid, bundles, err := s.x509SVID()
+		if err != nil {
+			return err
+		}
+		trustDomain, err := spiffe.GetTrustDomainFromURISAN(svid.SpiffeId)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "invalid SPIFFE ID: %v", err)
+		}
+		if bundles == nil {
+			bundles = map[string][]byte{}
+		}
+		bundles[spiffe.URIPrefix+trustDomain] = svid.Bundle
+		return stream.Send(&workloadpb.X509BundlesResponse{Bundles: bundles})
+	})
+}
+
+// FetchJWTSVID returns a JWT SVID of the workload. Tokens are issued for a single audience.
+func (s *Server) FetchJWTSVID(ctx context.Context, req *workloadpb.JWTSVIDRequest) (*workloadpb.JWTSVIDResponse, error) {
+	if err := checkSecurityHeader(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.Audience) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "expected a single audience, got %d", len(req.Audience))
+	}
+	svid, err := s.secretManager.GenerateJWTSVID(req.Audience[0])
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get JWT SVID: %v", err)
+	}
+	if req.SpiffeId != "" && req.SpiffeId != svid.SpiffeID {
+		return nil, status.Errorf(codes.PermissionDenied, "no JWT SVID for SPIFFE ID %q", req.SpiffeId)
+	}
+	return &workloadpb.JWTSVIDResponse{Svids: []*workloadpb.JWTSVID{{SpiffeId: svid.SpiffeID, Svid: svid.Token}}}, nil
+}
+
+// checkSecurityHeader returns an error if the client did not set the security header.
+func checkSecurityHeader(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(securityHeader); len(v) != 1 || v[0] != "true" {
+		return status.Errorf(codes.InvalidArgument, "security header %q is missing", securityHeader)
+	}
+	return nil
+}
+
+// stream checks the security header, then calls send initially and on every update until the client
+// goes away.
+func (s *Server) stream(stream grpc.ServerStream, send func() error) error {
+	if err := checkSecurityHeader(stream.Context()); err != nil {
+		return err
+	}
+	for {
+		s.mu.Lock()
+		updated := s.updated
+		s.mu.Unlock()
+		if err := send(); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-updated:
+		}
+	}
+}
+
+// x509SVID builds the SVID of the workload from the SecretManager, and returns it with the bundles
+// of the trust domains it is federated with, by trust domain ID.
+func (s *Server) x509SVID() (*workloadpb.X509SVID, map[string][]byte, error) {
+	secret, err := s.secretManager.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "failed to get workload certificate: %v", err)
+	}
+	root, err := s.secretManager.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "failed to get trust bundle: %v", err)
+	}
+
+	chain := pemToDER(secret.CertificateChain)
+	leaf := secret.Leaf
+	if leaf == nil && len(chain) > 0 {
+		certs, err := x509.ParseCertificates(chain)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Unavailable, "failed to parse workload certificate: %v", err)
+		}
+		leaf = certs[0]
+	}
+	if leaf == nil {
+		return nil, nil, status.Error(codes.Unavailable, "workload certificate is empty")
+	}
+	spiffeID := ""
+	for _, uri := range leaf.URIs {
+		if strings.HasPrefix(uri.String(), spiffe.URIPrefix) {
+			spiffeID = uri.String()
+			break
+		}
+	}
+	if spiffeID == "" {
+		return nil, nil, status.Error(codes.Unavailable, "workload certificate has no SPIFFE ID")
+	}
+
+	key, err := util.ParsePemEncodedKey(secret.PrivateKey)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "failed to parse workload key: %v", err)
+	}
+	defer util.ZeroPrivateKey(key)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "failed to encode workload key: %v", err)
+	}
+
+	var federated map[string][]byte
+	trustDomain, _ := spiffe.GetTrustDomainFromURISAN(spiffeID)
+	for td, bundle := range root.TrustBundles {
+		if td == trustDomain {
+			continue
+		}
+		if federated == nil {
+			federated = map[string][]byte{}
+		}
+		federated[spiffe.URIPrefix+td] = pemToDER(bundle)
+	}
+
+	return &workloadpb.X509SVID{
+		SpiffeId:    spiffeID,
+		X509Svid:    chain,
+		X509SvidKey: pkcs8,
+		Bundle:      pemToDER(root.RootCert),
+	}, federated, nil
+}
+
+// pemToDER concatenates the DER encoding of the certificates in PEM, as the Workload API expects.
+func pemToDER(data []byte) []byte {
+	var der []byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			der = append(der, block.Bytes...)
+		}
+	}
+	return der
+}
@@ -0,0 +1,224 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workloadapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	workloadpb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const testSpiffeID = "spiffe://cluster.local/ns/foo/sa/bar"
+
+func newSecret(t *testing.T) *security.SecretItem {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         testSpiffeID,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &security.SecretItem{
+		CertificateChain: certPEM,
+		PrivateKey:       keyPEM,
+		RootCert:         certPEM,
+		ResourceName:     security.WorkloadKeyCertResourceName,
+	}
+}
+
+type testServer struct {
+	server *Server
+	store  *security.DirectSecretManager
+	client workloadpb.SpiffeWorkloadAPIClient
+	secret *security.SecretItem
+}
+
+func (s *testServer) setSecret(secret *security.SecretItem) {
+	s.secret = secret
+	s.store.Set(security.WorkloadKeyCertResourceName, secret)
+	s.store.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     secret.RootCert,
+		ResourceName: security.RootCertReqResourceName,
+	})
+	s.server.UpdateCallback(security.WorkloadKeyCertResourceName)
+}
+
+func setupServer(t *testing.T) *testServer {
+	store := security.NewDirectSecretManager()
+	socket := filepath.Join(t.TempDir(), "workload.sock")
+	server, err := NewServer(&security.Options{WorkloadAPIUDSPath: socket}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &testServer{server: server, store: store, client: workloadpb.NewSpiffeWorkloadAPIClient(conn)}
+	s.setSecret(newSecret(t))
+	return s
+}
+
+func workloadContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, securityHeader, "true")
+}
+
+func verifySVID(t *testing.T, resp *workloadpb.X509SVIDResponse, secret *security.SecretItem) {
+	t.Helper()
+	if len(resp.Svids) != 1 {
+		t.Fatalf("expected 1 SVID, got %d", len(resp.Svids))
+	}
+	svid := resp.Svids[0]
+	if svid.SpiffeId != testSpiffeID {
+		t.Errorf("got SPIFFE ID %q, want %q", svid.SpiffeId, testSpiffeID)
+	}
+	certs, err := x509.ParseCertificates(svid.X509Svid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := util.ParsePemEncodedCertificate(secret.CertificateChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certs[0].Equal(want) {
+		t.Errorf("unexpected SVID certificate")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(svid.X509SvidKey); err != nil {
+		t.Errorf("SVID key is not PKCS#8: %v", err)
+	}
+	if !bytes.Equal(svid.Bundle, want.Raw) {
+		t.Errorf("unexpected bundle")
+	}
+}
+
+func TestFetchX509SVID(t *testing.T) {
+	s := setupServer(t)
+	stream, err := s.client.FetchX509SVID(workloadContext(t), &workloadpb.X509SVIDRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifySVID(t, resp, s.secret)
+
+	// A rotated certificate is pushed on the open stream.
+	rotated := newSecret(t)
+	s.setSecret(rotated)
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifySVID(t, resp, rotated)
+}
+
+func TestFetchX509Bundles(t *testing.T) {
+	s := setupServer(t)
+	stream, err := s.client.FetchX509Bundles(workloadContext(t), &workloadpb.X509BundlesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := util.ParsePemEncodedCertificate(s.secret.RootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Bundles["spiffe://cluster.local"]; !bytes.Equal(got, root.Raw) {
+		t.Fatalf("unexpected bundles: %v", resp.Bundles)
+	}
+
+	// The bundles of federated trust domains are served with that of the workload.
+	federated := newSecret(t)
+	s.store.Set(security.RootCertReqResourceName, &security.SecretItem{
+		RootCert:     s.secret.RootCert,
+		TrustBundles: map[string][]byte{"cluster.local": s.secret.RootCert, "example.com": federated.RootCert},
+		ResourceName: security.RootCertReqResourceName,
+	})
+	s.server.UpdateCallback(security.RootCertReqResourceName)
+	if resp, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	federatedRoot, err := util.ParsePemEncodedCertificate(federated.RootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Bundles) != 2 || !bytes.Equal(resp.Bundles["spiffe://example.com"], federatedRoot.Raw) ||
+		!bytes.Equal(resp.Bundles["spiffe://cluster.local"], root.Raw) {
+		t.Fatalf("unexpected bundles: %v", resp.Bundles)
+	}
+}
+
+func TestFetchJWTSVID(t *testing.T) {
+	s := setupServer(t)
+	s.store.SetJWTSVID("example.com", &security.JWTSVID{SpiffeID: testSpiffeID, Token: "token", Audience: "example.com"})
+	resp, err := s.client.FetchJWTSVID(workloadContext(t), &workloadpb.JWTSVIDRequest{Audience: []string{"example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Svids) != 1 || resp.Svids[0].SpiffeId != testSpiffeID || resp.Svids[0].Svid != "token" {
+		t.Fatalf("unexpected JWT SVIDs %v", resp.Svids)
+	}
+
+	_, err = s.client.FetchJWTSVID(workloadContext(t), &workloadpb.JWTSVIDRequest{
+		Audience: []string{"example.com"}, SpiffeId: "spiffe://cluster.local/ns/foo/sa/other",
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for another SPIFFE ID, got %v", err)
+	}
+	_, err = s.client.FetchJWTSVID(workloadContext(t), &workloadpb.JWTSVIDRequest{Audience: []string{"a", "b"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for several audiences, got %v", err)
+	}
+	_, err = s.client.FetchJWTSVID(context.Background(), &workloadpb.JWTSVIDRequest{Audience: []string{"example.com"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument without security header, got %v", err)
+	}
+}
+
+func TestSecurityHeaderRequired(t *testing.T) {
+	s := setupServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := s.client.FetchX509SVID(ctx, &workloadpb.X509SVIDRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument without security header, got %v", err)
+	}
+}
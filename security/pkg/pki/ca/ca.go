@@ -22,6 +22,7 @@ import (
 	"os"
 	"time"
 
+	"go.uber.org/atomic"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
@@ -57,6 +58,9 @@ const (
 
 var pkiCaLog = log.RegisterScope("pkica", "Citadel CA log", 0)
 
+// issuerWarningInterval is the minimum interval between warnings about the expiry of the issuer.
+const issuerWarningInterval = time.Hour
+
 // caTypes is the enum for the CA type.
 type caTypes int
 
@@ -91,6 +95,10 @@ type IstioCAOptions struct {
 	MaxCertTTL     time.Duration
 	CARSAKeySize   int
 
+	// IssuerExpiryWarning is how long before the expiry of the signing certificate, its chain or root
+	// the CA starts warning about it. Certificates are never issued past that expiry.
+	IssuerExpiryWarning time.Duration
+
 	KeyCertBundle *util.KeyCertBundle
 
 	LivenessProbeOptions *probe.Options
@@ -271,6 +279,11 @@ type IstioCA struct {
 	maxCertTTL     time.Duration
 	caRSAKeySize   int
 
+	issuerExpiryWarning time.Duration
+	// lastIssuerWarning is the time in Unix nanoseconds of the last warning about the expiry of the
+	// issuer, to rate limit them.
+	lastIssuerWarning atomic.Int64
+
 	keyCertBundle *util.KeyCertBundle
 
 	livenessProbe *probe.Probe
@@ -283,10 +296,11 @@ type IstioCA struct {
 // NewIstioCA returns a new IstioCA instance.
 func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
 	ca := &IstioCA{
-		maxCertTTL:    opts.MaxCertTTL,
-		keyCertBundle: opts.KeyCertBundle,
-		livenessProbe: probe.NewProbe(),
-		caRSAKeySize:  opts.CARSAKeySize,
+		maxCertTTL:          opts.MaxCertTTL,
+		keyCertBundle:       opts.KeyCertBundle,
+		livenessProbe:       probe.NewProbe(),
+		caRSAKeySize:        opts.CARSAKeySize,
+		issuerExpiryWarning: opts.IssuerExpiryWarning,
 	}
 
 	if opts.CAType == selfSignedCA && opts.RotatorConfig != nil && opts.RotatorConfig.CheckInterval > time.Duration(0) {
@@ -400,6 +414,11 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 			"requested TTL %s is greater than the max allowed TTL %s", requestedLifetime, ca.maxCertTTL))
 	}
 
+	lifetime, err = ca.clampToIssuerExpiry(lifetime, signingCert, time.Now())
+	if err != nil {
+		return nil, caerror.NewError(caerror.CertGenError, err)
+	}
+
 	certBytes, err := util.GenCertFromCSR(csr, signingCert, csr.PublicKey, *signingKey, subjectIDs, lifetime, forCA)
 	if err != nil {
 		return nil, caerror.NewError(caerror.CertGenError, err)
@@ -414,6 +433,56 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	return cert, nil
 }
 
+// clampToIssuerExpiry shortens lifetime so that a certificate issued at now does not outlive the
+// signing certificate, its chain or root, and warns when they approach their expiry.
+func (ca *IstioCA) clampToIssuerExpiry(lifetime time.Duration, signingCert *x509.Certificate, now time.Time) (time.Duration, error) {
+	expiry := ca.issuerExpiry(signingCert)
+	// Certificate times have a precision of a second, and the certificate is issued slightly after now.
+	remaining := expiry.Sub(now).Truncate(time.Second) - time.Second
+	if remaining <= 0 {
+		return 0, fmt.Errorf("the issuer of the certificate expired at %v", expiry)
+	}
+	if lifetime > remaining {
+		ca.warnIssuerExpiry(now, "issuer of the certificates expires at %v, shortening the TTL of issued certificates to %v",
+			expiry, remaining)
+		return remaining, nil
+	}
+	if remaining < ca.issuerExpiryWarning {
+		ca.warnIssuerExpiry(now, "issuer of the certificates expires at %v, the TTL of issued certificates will be shortened", expiry)
+	}
+	return lifetime, nil
+}
+
+// issuerExpiry returns the earliest expiry of the signing certificate, its chain and root.
+func (ca *IstioCA) issuerExpiry(signingCert *x509.Certificate) time.Time {
+	expiry := signingCert.NotAfter
+	for _, certsPEM := range [][]byte{ca.keyCertBundle.GetCertChainPem(), ca.keyCertBundle.GetRootCertPem()} {
+		if len(certsPEM) == 0 {
+			continue
+		}
+		// The chain was verified when loaded.
+		certs, err := util.ParsePemEncodedCertificateChain(certsPEM)
+		if err != nil {
+			continue
+		}
+		for _, cert := range certs {
+			if cert.NotAfter.Before(expiry) {
+				expiry = cert.NotAfter
+			}
+		}
+	}
+	return expiry
+}
+
+// warnIssuerExpiry logs a warning about the expiry of the issuer, at most once per issuerWarningInterval.
+func (ca *IstioCA) warnIssuerExpiry(now time.Time, format string, args ...interface{}) {
+	last := ca.lastIssuerWarning.Load()
+	if now.Sub(time.Unix(0, last)) < issuerWarningInterval || !ca.lastIssuerWarning.CAS(last, now.UnixNano()) {
+		return
+	}
+	pkiCaLog.Warn(fmt.Sprintf(format, args...))
+}
+
 func (ca *IstioCA) signWithCertChain(csrPEM []byte, subjectIDs []string, requestedLifetime time.Duration, lifetimeCheck,
 	forCA bool) ([]byte, error) {
 	cert, err := ca.sign(csrPEM, subjectIDs, requestedLifetime, lifetimeCheck, forCA)
@@ -494,6 +494,37 @@ func TestSignCSR(t *testing.T) {
 	}
 }
 
+func TestSignClampedToIssuerExpiry(t *testing.T) {
+	ca, err := createCAWithIssuerTTL(24*time.Hour, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.Sign(csrPEM, CertOpts{SubjectIDs: []string{"spiffe://example.com/ns/foo/sa/bar"}, TTL: 12 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.NotAfter.After(signingCert.NotAfter) {
+		t.Fatalf("certificate expiring at %v outlives its issuer expiring at %v", cert.NotAfter, signingCert.NotAfter)
+	}
+	if ttl := cert.NotAfter.Sub(cert.NotBefore) - util.ClockSkewGracePeriod; ttl < 50*time.Minute {
+		t.Fatalf("expected the TTL to be shortened to the lifetime of the issuer, got %v", ttl)
+	}
+
+	// Certificates are not issued by an expired issuer.
+	if _, err := ca.clampToIssuerExpiry(time.Hour, signingCert, signingCert.NotAfter.Add(time.Minute)); err == nil {
+		t.Fatal("expected an expired issuer to be rejected")
+	}
+}
+
 func TestAppendRootCerts(t *testing.T) {
 	root1 := "root-cert-1"
 	expRootCerts := `root-cert-1
@@ -668,11 +699,16 @@ func TestGenKeyCert(t *testing.T) {
 }
 
 func createCA(maxTTL time.Duration, ecSigAlg util.SupportedECSignatureAlgorithms) (*IstioCA, error) {
+	// The issuer outlives the certificates it signs.
+	return createCAWithIssuerTTL(maxTTL, 2*365*24*time.Hour, ecSigAlg)
+}
+
+func createCAWithIssuerTTL(maxTTL, issuerTTL time.Duration, ecSigAlg util.SupportedECSignatureAlgorithms) (*IstioCA, error) {
 	// Generate root CA key and cert.
 	rootCAOpts := util.CertOptions{
 		IsCA:         true,
 		IsSelfSigned: true,
-		TTL:          time.Hour,
+		TTL:          issuerTTL,
 		Org:          "Root CA",
 		RSAKeySize:   2048,
 		ECSigAlg:     ecSigAlg,
@@ -696,7 +732,7 @@ func createCA(maxTTL time.Duration, ecSigAlg util.SupportedECSignatureAlgorithms
 	intermediateCAOpts := util.CertOptions{
 		IsCA:         true,
 		IsSelfSigned: false,
-		TTL:          time.Hour,
+		TTL:          issuerTTL,
 		Org:          "Intermediate CA",
 		RSAKeySize:   2048,
 		SignerCert:   rootCert,
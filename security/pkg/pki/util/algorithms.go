@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// minRSAKeySize is the smallest RSA modulus accepted in received certificates.
+const minRSAKeySize = 2048
+
+// weakSignatureAlgorithms are always rejected in the signatures of received certificates.
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// CheckCertAlgorithms returns an error if a certificate in certsPEM is signed with MD5 or SHA-1, has
+// a DSA key or an RSA key shorter than 2048 bits, or uses one of the denied algorithms. The denied
+// algorithms are signature algorithm names, such as "SHA256-RSA", or public key algorithm names, such
+// as "RSA", as printed by crypto/x509, and are matched case insensitively.
+//
+// The signatures of self-signed certificates are not checked, as roots are trusted by their presence
+// rather than their signature.
+func CheckCertAlgorithms(certsPEM []byte, denied []string) error {
+	deny := map[string]bool{}
+	for _, alg := range denied {
+		if alg = strings.TrimSpace(alg); alg != "" {
+			deny[strings.ToUpper(alg)] = true
+		}
+	}
+	for block, rest := pem.Decode(certsPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse X.509 certificate: %v", err)
+		}
+		if err := checkCertAlgorithms(cert, deny); err != nil {
+			return fmt.Errorf("certificate %q %v", cert.Subject, err)
+		}
+	}
+	return nil
+}
+
+func checkCertAlgorithms(cert *x509.Certificate, deny map[string]bool) error {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+			return fmt.Errorf("is signed with weak algorithm %v", cert.SignatureAlgorithm)
+		}
+		if deny[strings.ToUpper(cert.SignatureAlgorithm.String())] {
+			return fmt.Errorf("is signed with denied algorithm %v", cert.SignatureAlgorithm)
+		}
+	}
+	if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < minRSAKeySize {
+		return fmt.Errorf("has a %d bit RSA key, at least %d bits are required", key.N.BitLen(), minRSAKeySize)
+	}
+	if cert.PublicKeyAlgorithm == x509.DSA {
+		return fmt.Errorf("has a weak DSA key")
+	}
+	if deny[strings.ToUpper(cert.PublicKeyAlgorithm.String())] {
+		return fmt.Errorf("has a key of denied algorithm %v", cert.PublicKeyAlgorithm)
+	}
+	return nil
+}
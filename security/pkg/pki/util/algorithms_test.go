@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// algorithmTestCert creates a certificate with the key, signed by the parent with the algorithm.
+// The certificate is self-signed if parent is nil.
+func algorithmTestCert(t *testing.T, name string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer,
+	alg x509.SignatureAlgorithm) (*x509.Certificate, []byte) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		SignatureAlgorithm:    alg,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCheckCertAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, rootPEM := algorithmTestCert(t, "root", rsaKey, nil, nil, x509.SHA256WithRSA)
+	_, sha1RootPEM := algorithmTestCert(t, "sha1 root", rsaKey, nil, nil, x509.SHA1WithRSA)
+	_, weakRootPEM := algorithmTestCert(t, "weak root", weakRSAKey, nil, nil, x509.SHA256WithRSA)
+	_, leafPEM := algorithmTestCert(t, "leaf", ecKey, root, rsaKey, x509.SHA256WithRSA)
+	_, sha1LeafPEM := algorithmTestCert(t, "sha1 leaf", ecKey, root, rsaKey, x509.SHA1WithRSA)
+	_, weakLeafPEM := algorithmTestCert(t, "weak leaf", weakRSAKey, root, rsaKey, x509.SHA256WithRSA)
+	join := func(certs ...[]byte) []byte {
+		var out []byte
+		for _, cert := range certs {
+			out = append(out, cert...)
+		}
+		return out
+	}
+
+	cases := []struct {
+		name    string
+		certs   []byte
+		denied  []string
+		wantErr string
+	}{
+		{name: "strong chain", certs: join(leafPEM, rootPEM)},
+		{name: "no certificates", certs: nil},
+		{name: "SHA-1 signed root", certs: join(leafPEM, sha1RootPEM)},
+		{name: "SHA-1 signed leaf", certs: join(sha1LeafPEM, rootPEM), wantErr: "weak algorithm SHA1-RSA"},
+		{name: "1024 bit RSA leaf", certs: join(weakLeafPEM, rootPEM), wantErr: "1024 bit RSA key"},
+		{name: "1024 bit RSA root", certs: weakRootPEM, wantErr: "1024 bit RSA key"},
+		{name: "denied signature", certs: join(leafPEM, rootPEM), denied: []string{"sha256-rsa"}, wantErr: "denied algorithm SHA256-RSA"},
+		{name: "denied key", certs: join(leafPEM, rootPEM), denied: []string{" ECDSA "}, wantErr: "denied algorithm ECDSA"},
+		{name: "denied algorithm unused", certs: join(leafPEM, rootPEM), denied: []string{"Ed25519"}},
+		{name: "invalid certificate", certs: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}), wantErr: "failed to parse"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckCertAlgorithms(tc.certs, tc.denied)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseOID parses an object identifier in dotted form, e.g. "1.3.6.1.4.1.1".
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, n)
+	}
+	return oid, nil
+}
+
+// keyAttestationExtension returns the CSR extension carrying the attestation of the public key of
+// priv, as an OCTET STRING.
+func keyAttestationExtension(options CertOptions, priv interface{}) (pkix.Extension, error) {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return pkix.Extension{}, fmt.Errorf("unsupported key type %T", priv)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	digest := sha256.Sum256(spki)
+	attestation, err := options.KeyAttestation(digest[:])
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	value, err := asn1.Marshal(attestation)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: options.KeyAttestationOID, Value: value}, nil
+}
+
+// KeyAttestationFromCSR returns the key attestation carried by csr in the extension oid, or nil if
+// there is none.
+func KeyAttestationFromCSR(csr *x509.CertificateRequest, oid asn1.ObjectIdentifier) ([]byte, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oid) {
+			continue
+		}
+		var attestation []byte
+		rest, err := asn1.Unmarshal(ext.Value, &attestation)
+		if err != nil || len(rest) != 0 {
+			return nil, fmt.Errorf("invalid key attestation extension")
+		}
+		return attestation, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestKeyAttestationCSRExtension(t *testing.T) {
+	oid, err := ParseOID("1.3.6.1.4.1.99999.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attestedDigest []byte
+	csrPEM, _, err := GenCSR(CertOptions{
+		Host:       "spiffe://cluster.local/ns/vm/sa/vm",
+		RSAKeySize: 2048,
+		KeyAttestation: func(keyDigest []byte) ([]byte, error) {
+			attestedDigest = keyDigest
+			return []byte("quote"), nil
+		},
+		KeyAttestationOID: oid,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest := sha256.Sum256(csr.RawSubjectPublicKeyInfo); !bytes.Equal(digest[:], attestedDigest) {
+		t.Errorf("the attested digest does not match the CSR key")
+	}
+	attestation, err := KeyAttestationFromCSR(csr, oid)
+	if err != nil || string(attestation) != "quote" {
+		t.Errorf("unexpected attestation %q: %v", attestation, err)
+	}
+	other, _ := ParseOID("1.3.6.1.4.1.99999.2")
+	if attestation, err := KeyAttestationFromCSR(csr, other); attestation != nil || err != nil {
+		t.Errorf("expected no attestation for another OID, got %q: %v", attestation, err)
+	}
+
+	for _, in := range []string{"", "1", "1.a", "1.-2"} {
+		if _, err := ParseOID(in); err == nil {
+			t.Errorf("expected %q to be an invalid OID", in)
+		}
+	}
+}
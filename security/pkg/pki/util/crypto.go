@@ -24,6 +24,10 @@ import (
 	"reflect"
 )
 
+// MaxCertChainSize bounds the size of the PEM encoded certificate chains and bundles parsed, well
+// above the size of a bundle of all public root CAs.
+const MaxCertChainSize = 1 << 20
+
 const (
 	blockTypeECPrivateKey    = "EC PRIVATE KEY"
 	blockTypeRSAPrivateKey   = "RSA PRIVATE KEY" // PKCS#1 private key
@@ -49,6 +53,9 @@ func ParsePemEncodedCertificate(certBytes []byte) (*x509.Certificate, error) {
 // ParsePemEncodedCertificateChain constructs a slice of `x509.Certificate`
 // objects using the given a PEM-encoded certificate chain.
 func ParsePemEncodedCertificateChain(certBytes []byte) ([]*x509.Certificate, error) {
+	if len(certBytes) > MaxCertChainSize {
+		return nil, fmt.Errorf("certificate chain exceeds %d bytes", MaxCertChainSize)
+	}
 	var (
 		certs []*x509.Certificate
 		cb    *pem.Block
@@ -70,6 +77,18 @@ func ParsePemEncodedCertificateChain(certBytes []byte) ([]*x509.Certificate, err
 	return certs, nil
 }
 
+// SplitCertificates returns the certificates of a PEM bundle as individual PEM blocks.
+// Blocks of other types are skipped.
+func SplitCertificates(bundle []byte) []string {
+	var certs []string
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, string(pem.EncodeToMemory(block)))
+		}
+	}
+	return certs
+}
+
 // ParsePemEncodedCSR constructs a `x509.CertificateRequest` object using the
 // given PEM-encoded certificate signing request.
 func ParsePemEncodedCSR(csrBytes []byte) (*x509.CertificateRequest, error) {
@@ -188,6 +188,26 @@ func TestParsePemEncodedCertificate(t *testing.T) {
 	}
 }
 
+func TestSplitCertificates(t *testing.T) {
+	bundle := certRSA + "\n" + keyECDSA + "\n" + certECDSA
+	certs := SplitCertificates([]byte(bundle))
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(certs))
+	}
+	for i, want := range []x509.PublicKeyAlgorithm{x509.RSA, x509.ECDSA} {
+		cert, err := ParsePemEncodedCertificate([]byte(certs[i]))
+		if err != nil {
+			t.Fatalf("certificate %d: %v", i, err)
+		}
+		if cert.PublicKeyAlgorithm != want {
+			t.Errorf("certificate %d: want public key algorithm %d but got %d", i, want, cert.PublicKeyAlgorithm)
+		}
+	}
+	if certs := SplitCertificates([]byte("invalid pem string")); len(certs) != 0 {
+		t.Errorf("expected no certificates, got %d", len(certs))
+	}
+}
+
 func TestParsePemEncodedCSR(t *testing.T) {
 	testCases := map[string]struct {
 		algo   x509.PublicKeyAlgorithm
@@ -27,6 +27,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -43,10 +44,70 @@ import (
 type SupportedECSignatureAlgorithms string
 
 const (
-	// only ECDSA using P256 is currently supported
+	// EcdsaSigAlg generates ECDSA keys, on the curve of CertOptions.ECCCurve.
 	EcdsaSigAlg SupportedECSignatureAlgorithms = "ECDSA"
+	// Ed25519SigAlg generates Ed25519 keys, which are always encoded with PKCS#8.
+	Ed25519SigAlg SupportedECSignatureAlgorithms = "ED25519"
+
+	// MLDSA44SigAlg, MLDSA65SigAlg and MLDSA87SigAlg generate post-quantum ML-DSA (FIPS 204) keys,
+	// which are always encoded with PKCS#8. They are experimental, and only available in builds with
+	// Go 1.27 or later.
+	MLDSA44SigAlg SupportedECSignatureAlgorithms = "ML-DSA-44"
+	MLDSA65SigAlg SupportedECSignatureAlgorithms = "ML-DSA-65"
+	MLDSA87SigAlg SupportedECSignatureAlgorithms = "ML-DSA-87"
 )
 
+// IsPQCSignatureAlgorithm returns whether alg is a post-quantum signature algorithm.
+func IsPQCSignatureAlgorithm(alg string) bool {
+	switch SupportedECSignatureAlgorithms(alg) {
+	case MLDSA44SigAlg, MLDSA65SigAlg, MLDSA87SigAlg:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportedEllipticCurves are the curves of the ECDSA keys generated with EcdsaSigAlg.
+type SupportedEllipticCurves string
+
+const (
+	// P256Curve is the default curve of ECDSA keys.
+	P256Curve SupportedEllipticCurves = "P256"
+	P384Curve SupportedEllipticCurves = "P384"
+)
+
+// IsSupportedEllipticCurve returns whether curve is a supported ECDSA curve. Empty selects P256.
+func IsSupportedEllipticCurve(curve string) bool {
+	switch SupportedEllipticCurves(curve) {
+	case "", P256Curve, P384Curve:
+		return true
+	default:
+		return false
+	}
+}
+
+// ellipticCurve returns the curve of ECDSA keys generated with options.
+func ellipticCurve(options CertOptions) (elliptic.Curve, error) {
+	switch options.ECCCurve {
+	case "", P256Curve:
+		return elliptic.P256(), nil
+	case P384Curve:
+		return elliptic.P384(), nil
+	default:
+		return nil, fmt.Errorf("unsupported elliptic curve %q", options.ECCCurve)
+	}
+}
+
+// IsSupportedECSignatureAlgorithm returns whether alg is a supported EC signature algorithm.
+func IsSupportedECSignatureAlgorithm(alg string) bool {
+	switch SupportedECSignatureAlgorithms(alg) {
+	case EcdsaSigAlg, Ed25519SigAlg:
+		return true
+	default:
+		return false
+	}
+}
+
 // CertOptions contains options for generating a new certificate.
 type CertOptions struct {
 	// Comma-separated hostnames and IPs to generate a certificate for.
@@ -94,12 +155,24 @@ type CertOptions struct {
 	PKCS8Key bool
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
+	// when generating private keys, ECDSA or Ed25519.
 	// If empty, RSA is used, otherwise ECC is used.
 	ECSigAlg SupportedECSignatureAlgorithms
 
+	// The curve of ECDSA keys. If empty, P256 is used.
+	ECCCurve SupportedEllipticCurves
+
 	// Subjective Alternative Name values.
 	DNSNames string
+
+	// KeyAttestation, if set, returns the attestation of the SHA-256 digest of the DER encoded
+	// SubjectPublicKeyInfo of the key generated by GenCSR. It is added to the CSR as a non-critical
+	// extension with the KeyAttestationOID, so that the CA can check that the key is held by attested
+	// hardware.
+	KeyAttestation func(keyDigest []byte) ([]byte, error)
+
+	// KeyAttestationOID identifies the key attestation extension.
+	KeyAttestationOID asn1.ObjectIdentifier
 }
 
 // GenCertKeyFromOptions generates a X.509 certificate and a private key with the given options.
@@ -110,18 +183,32 @@ func GenCertKeyFromOptions(options CertOptions) (pemCert []byte, pemKey []byte,
 	// case, otherwise the certificate is signed by the signer private key
 	// as specified in the CertOptions.
 	if options.ECSigAlg != "" {
-		var ecPriv *ecdsa.PrivateKey
-
 		switch options.ECSigAlg {
 		case EcdsaSigAlg:
-			ecPriv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			curve, err := ellipticCurve(options)
 			if err != nil {
 				return nil, nil, fmt.Errorf("cert generation fails at EC key generation (%v)", err)
 			}
+			ecPriv, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cert generation fails at EC key generation (%v)", err)
+			}
+			return genCert(options, ecPriv, &ecPriv.PublicKey)
+		case Ed25519SigAlg:
+			edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cert generation fails at Ed25519 key generation (%v)", err)
+			}
+			return genCert(options, edPriv, edPub)
+		case MLDSA44SigAlg, MLDSA65SigAlg, MLDSA87SigAlg:
+			pqcPriv, pqcPub, err := generatePQCKey(options.ECSigAlg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cert generation fails at post-quantum key generation (%v)", err)
+			}
+			return genCert(options, pqcPriv, pqcPub)
 		default:
 			return nil, nil, errors.New("cert generation fails due to unsupported EC signature algorithm")
 		}
-		return genCert(options, ecPriv, &ecPriv.PublicKey)
 	}
 
 	if options.RSAKeySize < minimumRsaKeySize {
@@ -135,6 +222,8 @@ func GenCertKeyFromOptions(options CertOptions) (pemCert []byte, pemKey []byte,
 }
 
 func genCert(options CertOptions, priv interface{}, key interface{}) ([]byte, []byte, error) {
+	// Only the PEM encoding of the generated key is returned.
+	defer ZeroPrivateKey(priv)
 	template, err := genCertTemplateFromOptions(options)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cert generation fails at cert template creation (%v)", err)
@@ -272,7 +361,7 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 		keyUsage = x509.KeyUsageCertSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
-		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		keyUsage = leafKeyUsage(csr.PublicKeyAlgorithm == x509.Ed25519)
 		// For now, we do not differentiate non-CA certs to be used on client auth or server auth.
 		extKeyUsages = append(extKeyUsages, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)
 	}
@@ -317,6 +406,15 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 	}, nil
 }
 
+// leafKeyUsage returns the key usage of a non-CA certificate. Ed25519 keys can only
+// sign, so RFC 8410 forbids asserting key encipherment for them.
+func leafKeyUsage(ed25519Key bool) x509.KeyUsage {
+	if ed25519Key {
+		return x509.KeyUsageDigitalSignature
+	}
+	return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+}
+
 // genCertTemplateFromoptions generates a certificate template with the given options.
 func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error) {
 	var keyUsage x509.KeyUsage
@@ -325,7 +423,7 @@ func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error)
 		keyUsage = x509.KeyUsageCertSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
-		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		keyUsage = leafKeyUsage(options.ECSigAlg == Ed25519SigAlg)
 	}
 
 	extKeyUsages := []x509.ExtKeyUsage{}
@@ -409,18 +507,24 @@ func encodePem(isCSR bool, csrOrCert []byte, priv interface{}, pkcs8 bool) (
 		if encodedKey, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
 			return nil, nil, err
 		}
-		privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey})
+		privPem = encodeKeyPEM(blockTypePKCS8PrivateKey, encodedKey)
 	} else {
 		switch k := priv.(type) {
 		case *rsa.PrivateKey:
 			encodedKey = x509.MarshalPKCS1PrivateKey(k)
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeRSAPrivateKey, Bytes: encodedKey})
+			privPem = encodeKeyPEM(blockTypeRSAPrivateKey, encodedKey)
 		case *ecdsa.PrivateKey:
 			encodedKey, err = x509.MarshalECPrivateKey(k)
 			if err != nil {
 				return nil, nil, err
 			}
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey})
+			privPem = encodeKeyPEM(blockTypeECPrivateKey, encodedKey)
+		default:
+			// Ed25519 and ML-DSA keys have no other encoding than PKCS#8.
+			if encodedKey, err = x509.MarshalPKCS8PrivateKey(k); err != nil {
+				return nil, nil, err
+			}
+			privPem = encodeKeyPEM(blockTypePKCS8PrivateKey, encodedKey)
 		}
 	}
 	err = nil
@@ -19,13 +19,15 @@
 package util
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
@@ -45,10 +47,24 @@ func GenCSR(options CertOptions) ([]byte, []byte, error) {
 	if options.ECSigAlg != "" {
 		switch options.ECSigAlg {
 		case EcdsaSigAlg:
-			priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			curve, err := ellipticCurve(options)
+			if err != nil {
+				return nil, nil, err
+			}
+			priv, err = ecdsa.GenerateKey(curve, rand.Reader)
 			if err != nil {
 				return nil, nil, fmt.Errorf("EC key generation failed (%v)", err)
 			}
+		case Ed25519SigAlg:
+			_, priv, err = ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Ed25519 key generation failed (%v)", err)
+			}
+		case MLDSA44SigAlg, MLDSA65SigAlg, MLDSA87SigAlg:
+			priv, _, err = generatePQCKey(options.ECSigAlg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("post-quantum key generation failed (%v)", err)
+			}
 		default:
 			return nil, nil, errors.New("csr cert generation fails due to unsupported EC signature algorithm")
 		}
@@ -62,10 +78,19 @@ func GenCSR(options CertOptions) ([]byte, []byte, error) {
 			return nil, nil, fmt.Errorf("RSA key generation failed (%v)", err)
 		}
 	}
+	// Only the PEM encoding of the generated key is returned.
+	defer ZeroPrivateKey(priv)
 	template, err := GenCSRTemplate(options)
 	if err != nil {
 		return nil, nil, fmt.Errorf("CSR template creation failed (%v)", err)
 	}
+	if options.KeyAttestation != nil {
+		ext, err := keyAttestationExtension(options, priv)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key attestation failed (%v)", err)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
 
 	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, crypto.PrivateKey(priv))
 	if err != nil {
@@ -128,3 +153,35 @@ func AppendCertByte(pemCert []byte, rootCert []byte) []byte {
 	rootCerts = append(rootCerts, rootCert...)
 	return rootCerts
 }
+
+// DedupCertByte removes duplicate certificates from a PEM encoded bundle, keeping the first
+// occurrence of each. The PEM text of the remaining certificates is preserved as-is, and if there
+// are no duplicates the input slice is returned unchanged.
+func DedupCertByte(pemCerts []byte) []byte {
+	seen := map[string]struct{}{}
+	var blocks [][]byte
+	duplicate := false
+	rest := pemCerts
+	for {
+		var block *pem.Block
+		start := rest
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if _, f := seen[string(block.Bytes)]; f {
+			duplicate = true
+			continue
+		}
+		seen[string(block.Bytes)] = struct{}{}
+		blocks = append(blocks, start[:len(start)-len(rest)])
+	}
+	if !duplicate {
+		return pemCerts
+	}
+	deduped := []byte{}
+	for _, b := range blocks {
+		deduped = AppendCertByte(deduped, bytes.TrimLeft(b, "\n"))
+	}
+	return deduped
+}
@@ -16,6 +16,7 @@ package util
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -45,11 +46,26 @@ func TestGenCSR(t *testing.T) {
 				ECSigAlg: EcdsaSigAlg,
 			},
 		},
+		"GenCSR with EC P384": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: EcdsaSigAlg,
+				ECCCurve: P384Curve,
+			},
+		},
+		"GenCSR with Ed25519": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: Ed25519SigAlg,
+			},
+		},
 		"GenCSR with EC errors due to invalid signature algorithm": {
 			csrOptions: CertOptions{
 				Host:     "test_ca.com",
 				Org:      "MyOrg",
-				ECSigAlg: "ED25519",
+				ECSigAlg: "ED448",
 			},
 			err: errors.New("csr cert generation fails due to unsupported EC signature algorithm"),
 		},
@@ -85,15 +101,19 @@ func TestGenCSR(t *testing.T) {
 		if !strings.HasSuffix(string(csr.Extensions[0].Value), "test_ca.com") {
 			t.Errorf("%s: csr host does not match", id)
 		}
-		if tc.csrOptions.ECSigAlg != "" {
-			if tc.csrOptions.ECSigAlg != EcdsaSigAlg {
-				t.Errorf("%s: Only ECDSA signature algorithms are currently supported", id)
-			}
+		switch tc.csrOptions.ECSigAlg {
+		case EcdsaSigAlg:
 			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&ecdsa.PublicKey{}) {
 				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
 			}
-		} else if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&rsa.PublicKey{}) {
-			t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
+		case Ed25519SigAlg:
+			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(ed25519.PublicKey{}) {
+				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
+			}
+		default:
+			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&rsa.PublicKey{}) {
+				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
+			}
 		}
 	}
 }
@@ -214,3 +234,63 @@ func TestGenCSRTemplateForDualUse(t *testing.T) {
 		}
 	}
 }
+
+func TestDedupCertByte(t *testing.T) {
+	first := []byte(rootCert)
+	second := []byte(certChain)
+	if got := DedupCertByte(AppendCertByte(first, second)); string(got) != string(AppendCertByte(first, second)) {
+		t.Errorf("expected bundle without duplicates to be unchanged, got %s", got)
+	}
+	duplicated := AppendCertByte(AppendCertByte(first, second), first)
+	got := DedupCertByte(duplicated)
+	certs, err := ParsePemEncodedCertificateChain(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParsePemEncodedCertificateChain(AppendCertByte(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != len(want) {
+		t.Fatalf("expected %d certificates after dedup, got %d", len(want), len(certs))
+	}
+	for i := range certs {
+		if !certs[i].Equal(want[i]) {
+			t.Errorf("certificate %d does not match", i)
+		}
+	}
+}
+
+func BenchmarkGenCSR(b *testing.B) {
+	cases := map[string]CertOptions{
+		"RSA": {
+			Host:       "spiffe://cluster.local/ns/default/sa/default",
+			RSAKeySize: 2048,
+		},
+		"EC": {
+			Host:     "spiffe://cluster.local/ns/default/sa/default",
+			ECSigAlg: EcdsaSigAlg,
+		},
+	}
+	for name, opts := range cases {
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, _, err := GenCSR(opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGenCSRTemplate(b *testing.B) {
+	opts := CertOptions{
+		Host: "spiffe://cluster.local/ns/default/sa/default",
+		Org:  "MyOrg",
+	}
+	for n := 0; n < b.N; n++ {
+		if _, err := GenCSRTemplate(opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -21,6 +21,8 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -194,7 +196,7 @@ func (b *KeyCertBundle) CertOptions() (*CertOptions, error) {
 		IsDualUse: ids[0] == b.cert.Subject.CommonName,
 	}
 
-	switch (*b.privKey).(type) {
+	switch key := (*b.privKey).(type) {
 	case *rsa.PrivateKey:
 		size, err := GetRSAKeySize(*b.privKey)
 		if err != nil {
@@ -203,6 +205,11 @@ func (b *KeyCertBundle) CertOptions() (*CertOptions, error) {
 		opts.RSAKeySize = size
 	case *ecdsa.PrivateKey:
 		opts.ECSigAlg = EcdsaSigAlg
+		if key.Curve == elliptic.P384() {
+			opts.ECCCurve = P384Curve
+		}
+	case ed25519.PrivateKey:
+		opts.ECSigAlg = Ed25519SigAlg
 	default:
 		return nil, errors.New("unknown private key type")
 	}
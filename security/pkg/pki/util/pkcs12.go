@@ -0,0 +1,330 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The PKCS#12 bundles are protected as by OpenSSL 3: the key bag is encrypted with PBES2, using
+// PBKDF2 with HMAC-SHA256 and AES-256-CBC, and the bundle is authenticated with an HMAC-SHA256 MAC.
+const pkcs12Iterations = 2048
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,omitempty"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	PRF        pkix.AlgorithmIdentifier
+}
+
+// EncodePKCS12 returns a PKCS#12 bundle of the PEM encoded private key, its certificate chain, leaf
+// first, and the CA certificates, protected by passphrase.
+func EncodePKCS12(privateKeyPEM, certChainPEM, caCertsPEM, passphrase []byte) ([]byte, error) {
+	key, err := ParsePemEncodedKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the private key: %v", err)
+	}
+	chain, err := ParsePemEncodedCertificateChain(certChainPEM)
+	if err != nil {
+		return nil, err
+	}
+	var caCerts []*x509.Certificate
+	if len(caCertsPEM) > 0 {
+		if caCerts, err = ParsePemEncodedCertificateChain(caCertsPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	// The local key ID pairs the key with its certificate.
+	keyID := sha256.Sum256(chain[0].Raw)
+	keyIDAttribute, err := localKeyIDAttribute(keyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	seen := map[string]bool{}
+	for i, cert := range append(chain, caCerts...) {
+		if seen[string(cert.Raw)] {
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		bag, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: cert.Raw})
+		if err != nil {
+			return nil, err
+		}
+		b := safeBag{ID: oidCertBag, Value: explicitContent(bag)}
+		if i == 0 {
+			b.Attributes = []pkcs12Attribute{keyIDAttribute}
+		}
+		certBags = append(certBags, b)
+	}
+
+	encryptedKey, err := encryptPBES2(pkcs8, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	keyBags := []safeBag{{
+		ID:         oidPKCS8ShroudedKeyBag,
+		Value:      explicitContent(encryptedKey),
+		Attributes: []pkcs12Attribute{keyIDAttribute},
+	}}
+
+	var authenticatedSafe []contentInfo
+	for _, bags := range [][]safeBag{certBags, keyBags} {
+		ci, err := dataContentInfo(bags)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, ci)
+	}
+	content, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := dataContentInfo(content)
+	if err != nil {
+		return nil, err
+	}
+
+	macSalt := make([]byte, 16)
+	if _, err := rand.Read(macSalt); err != nil {
+		return nil, err
+	}
+	macKey := pkcs12KDF(bmpString(passphrase), macSalt, 3, pkcs12Iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(content)
+	return asn1.Marshal(pfx{
+		Version:  3,
+		AuthSafe: authSafe,
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// dataContentInfo returns a data content info holding the DER encoding of v, or v itself if it is
+// already encoded.
+func dataContentInfo(v interface{}) (contentInfo, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = asn1.Marshal(v); err != nil {
+			return contentInfo{}, err
+		}
+	}
+	octets, err := asn1.Marshal(data)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidData, Content: explicitContent(octets)}, nil
+}
+
+// explicitContent wraps the DER encoding der in the [0] EXPLICIT tag of contents and bag values.
+// The asn1 package ignores the tags of RawValue fields.
+func explicitContent(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func localKeyIDAttribute(keyID []byte) (pkcs12Attribute, error) {
+	value, err := asn1.Marshal(keyID)
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{ID: oidLocalKeyID, Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal,
+		IsCompound: true, Bytes: value}}, nil
+}
+
+// encryptPBES2 returns the EncryptedPrivateKeyInfo of the PKCS#8 key, encrypted with passphrase.
+func encryptPBES2(pkcs8, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, pkcs12Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(pkcs8)%aes.BlockSize
+	encrypted := make([]byte, len(pkcs8)+padding)
+	copy(encrypted, pkcs8)
+	for i := len(pkcs8); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pkcs12Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+}
+
+// bmpString returns the NUL terminated UTF-16BE encoding of s, the form of the passwords of the
+// PKCS#12 key derivation.
+func bmpString(s []byte) []byte {
+	runes := utf16.Encode([]rune(string(s)))
+	b := make([]byte, 0, 2*len(runes)+2)
+	for _, r := range runes {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return append(b, 0, 0)
+}
+
+// pkcs12KDF derives size bytes from password and salt with the key derivation of RFC 7292
+// appendix B.2, with SHA-256. id selects the purpose of the key, 3 for MAC keys.
+func pkcs12KDF(password, salt []byte, id byte, iterations, size int) []byte {
+	const u, v = sha256.Size, 64
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	input := append(fill(salt), fill(password)...)
+	var out []byte
+	for len(out) < size {
+		h := sha256.New()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			s := sha256.Sum256(a)
+			a = s[:]
+		}
+		out = append(out, a...)
+		// Each block of input is incremented by B + 1, where B repeats a.
+		b := fill(a)
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				carry += int(input[j+k]) + int(b[k])
+				input[j+k] = byte(carry)
+				carry >>= 8
+			}
+		}
+	}
+	return out[:size:size]
+}
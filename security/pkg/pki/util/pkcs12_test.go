@@ -0,0 +1,129 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestPKCS12KDF(t *testing.T) {
+	// Computed with openssl kdf -kdfopt digest:SHA256 -kdfopt id:3 -kdfopt iter:2048 PKCS12KDF.
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	want := "b0a429c3e00233133bfa4e250521ae428c5c6d8f185adf7e166bcafa64c3d939"
+	if got := hex.EncodeToString(pkcs12KDF(bmpString([]byte("s3cr")), salt, 3, 2048, 32)); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	certPEM, keyPEM, err := GenCertKeyFromOptions(CertOptions{
+		Host:         "spiffe://cluster.local/ns/default/sa/default",
+		TTL:          time.Hour,
+		IsSelfSigned: true,
+		ECSigAlg:     EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("s3crét")
+	bundle, err := EncodePKCS12(keyPEM, certPEM, certPEM, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p pfx
+	if _, err := asn1.Unmarshal(bundle, &p); err != nil {
+		t.Fatal(err)
+	}
+	content := unwrapData(t, p.AuthSafe)
+	macKey := pkcs12KDF(bmpString(passphrase), p.MacData.MacSalt, 3, p.MacData.Iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(content)
+	if !hmac.Equal(mac.Sum(nil), p.MacData.Mac.Digest) {
+		t.Fatal("invalid MAC")
+	}
+
+	var authenticatedSafe []contentInfo
+	if _, err := asn1.Unmarshal(content, &authenticatedSafe); err != nil {
+		t.Fatal(err)
+	}
+	var certs, keys []safeBag
+	if _, err := asn1.Unmarshal(unwrapData(t, authenticatedSafe[0]), &certs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(unwrapData(t, authenticatedSafe[1]), &keys); err != nil {
+		t.Fatal(err)
+	}
+	// The duplicate CA certificate is omitted.
+	if len(certs) != 1 || len(keys) != 1 {
+		t.Fatalf("expected a certificate and a key, got %d and %d", len(certs), len(keys))
+	}
+	if !bytes.Equal(certs[0].Attributes[0].Value.Bytes, keys[0].Attributes[0].Value.Bytes) {
+		t.Error("the key and certificate local key IDs differ")
+	}
+
+	var encrypted encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(keys[0].Value.Bytes, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	var params pbes2Params
+	var kdf pbkdf2Params
+	var iv []byte
+	if _, err := asn1.Unmarshal(encrypted.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.Iterations, 32, sha256.New))
+	decrypted := make([]byte, len(encrypted.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted.EncryptedData)
+	decrypted = decrypted[:len(decrypted)-int(decrypted[len(decrypted)-1])]
+	key, err := x509.ParsePKCS8PrivateKey(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ParsePemEncodedKey(keyPEM)
+	if !want.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+		t.Error("the decrypted key differs")
+	}
+}
+
+func unwrapData(t *testing.T, ci contentInfo) []byte {
+	t.Helper()
+	if !ci.ContentType.Equal(oidData) {
+		t.Fatalf("unexpected content type %v", ci.ContentType)
+	}
+	var data []byte
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,44 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.27
+// +build go1.27
+
+package util
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"fmt"
+)
+
+// generatePQCKey generates an ML-DSA key pair for alg.
+func generatePQCKey(alg SupportedECSignatureAlgorithms) (crypto.Signer, crypto.PublicKey, error) {
+	var params mldsa.Parameters
+	switch alg {
+	case MLDSA44SigAlg:
+		params = mldsa.MLDSA44()
+	case MLDSA65SigAlg:
+		params = mldsa.MLDSA65()
+	case MLDSA87SigAlg:
+		params = mldsa.MLDSA87()
+	default:
+		return nil, nil, fmt.Errorf("unsupported post-quantum signature algorithm %q", alg)
+	}
+	priv, err := mldsa.GenerateKey(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, priv.Public(), nil
+}
@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.27
+// +build go1.27
+
+package util
+
+import (
+	"crypto/mldsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestGenCSRMLDSA(t *testing.T) {
+	for _, alg := range []SupportedECSignatureAlgorithms{MLDSA44SigAlg, MLDSA65SigAlg, MLDSA87SigAlg} {
+		t.Run(string(alg), func(t *testing.T) {
+			csrPem, keyPem, err := GenCSR(CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", ECSigAlg: alg})
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, _ := pem.Decode(csrPem)
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				t.Errorf("invalid CSR signature: %v", err)
+			}
+			if _, ok := csr.PublicKey.(*mldsa.PublicKey); !ok {
+				t.Errorf("unexpected key type %T", csr.PublicKey)
+			}
+			key, err := ParsePemEncodedKey(keyPem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := key.(*mldsa.PrivateKey); !ok {
+				t.Errorf("unexpected private key type %T", key)
+			}
+		})
+	}
+}
+
+func TestGenCertKeyFromOptionsMLDSA(t *testing.T) {
+	certPem, keyPem, err := GenCertKeyFromOptions(CertOptions{
+		Host:         "spiffe://cluster.local/ns/foo/sa/bar",
+		NotBefore:    time.Now(),
+		TTL:          time.Hour,
+		IsSelfSigned: true,
+		IsCA:         true,
+		ECSigAlg:     MLDSA65SigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParsePemEncodedCertificate(certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SignatureAlgorithm != x509.MLDSA65 {
+		t.Errorf("unexpected signature algorithm %v", cert.SignatureAlgorithm)
+	}
+	if _, err := ParsePemEncodedKey(keyPem); err != nil {
+		t.Fatal(err)
+	}
+}
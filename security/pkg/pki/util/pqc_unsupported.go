@@ -0,0 +1,28 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !go1.27
+// +build !go1.27
+
+package util
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// generatePQCKey fails: ML-DSA certificates are only supported by crypto/x509 since Go 1.27.
+func generatePQCKey(alg SupportedECSignatureAlgorithms) (crypto.Signer, crypto.PublicKey, error) {
+	return nil, nil, fmt.Errorf("post-quantum signature algorithm %q requires a build with Go 1.27 or later", alg)
+}
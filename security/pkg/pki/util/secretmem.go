@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"runtime"
+)
+
+const pemLineLength = 64
+
+// LockMemory prevents the pages holding b from being swapped out, where the platform allows. Failures,
+// such as exceeding RLIMIT_MEMLOCK, are ignored: the buffer is then only protected by ZeroBytes.
+func LockMemory(b []byte) {
+	_ = TryLockMemory(b)
+}
+
+// TryLockMemory is LockMemory, returning its failure.
+func TryLockMemory(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return lockMemory(b)
+}
+
+// ZeroBytes overwrites b with zeros, and unlocks the pages locked by LockMemory. Other locked buffers
+// sharing these pages may be unlocked as well; they are still zeroed when released.
+func ZeroBytes(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+	unlockMemory(b)
+}
+
+// ZeroPrivateKey overwrites the secret values of a private key. The key must not be used afterwards.
+func ZeroPrivateKey(priv interface{}) {
+	zeroInt := func(i *big.Int) {
+		if i == nil {
+			return
+		}
+		words := i.Bits()
+		for j := range words {
+			words[j] = 0
+		}
+		i.SetInt64(0)
+	}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		zeroInt(k.D)
+		for _, p := range k.Primes {
+			zeroInt(p)
+		}
+		zeroInt(k.Precomputed.Dp)
+		zeroInt(k.Precomputed.Dq)
+		zeroInt(k.Precomputed.Qinv)
+		for _, crt := range k.Precomputed.CRTValues {
+			zeroInt(crt.Exp)
+			zeroInt(crt.Coeff)
+		}
+	case *ecdsa.PrivateKey:
+		zeroInt(k.D)
+	case ed25519.PrivateKey:
+		ZeroBytes(k)
+	}
+}
+
+// encodeKeyPEM encodes the DER private key as PEM into a single locked buffer, without the intermediate
+// copies of pem.EncodeToMemory. The DER key is zeroed.
+func encodeKeyPEM(blockType string, der []byte) []byte {
+	header := "-----BEGIN " + blockType + "-----\n"
+	footer := "-----END " + blockType + "-----\n"
+	encodedLen := base64.StdEncoding.EncodedLen(len(der))
+	lines := (encodedLen + pemLineLength - 1) / pemLineLength
+
+	out := make([]byte, len(header)+encodedLen+lines+len(footer))
+	LockMemory(out)
+	n := copy(out, header)
+	// Encode in chunks of 48 bytes, which encode to exactly one line of 64 characters.
+	const chunk = pemLineLength / 4 * 3
+	for i := 0; i < len(der); i += chunk {
+		end := i + chunk
+		if end > len(der) {
+			end = len(der)
+		}
+		base64.StdEncoding.Encode(out[n:], der[i:end])
+		n += base64.StdEncoding.EncodedLen(end - i)
+		out[n] = '\n'
+		n++
+	}
+	copy(out[n:], footer)
+	ZeroBytes(der)
+	return out
+}
@@ -0,0 +1,103 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"testing"
+)
+
+func TestEncodeKeyPEM(t *testing.T) {
+	// Cover DER lengths ending on, before and after a full PEM line.
+	for _, size := range []int{1, 47, 48, 49, 96, 121, 1190} {
+		der := make([]byte, size)
+		if _, err := rand.Read(der); err != nil {
+			t.Fatal(err)
+		}
+		want := pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: der})
+		got := encodeKeyPEM(blockTypeECPrivateKey, der)
+		if !bytes.Equal(got, want) {
+			t.Errorf("size %d: got\n%s\nwant\n%s", size, got, want)
+		}
+		if !bytes.Equal(der, make([]byte, size)) {
+			t.Errorf("size %d: expected the DER key to be zeroed", size)
+		}
+	}
+}
+
+func TestZeroPrivateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := ecKey.D.Bits()
+	ZeroPrivateKey(ecKey)
+	if ecKey.D.Sign() != 0 {
+		t.Errorf("expected EC private key to be zeroed")
+	}
+	for _, w := range words {
+		if w != 0 {
+			t.Fatalf("expected the words of the EC private key to be zeroed")
+		}
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ZeroPrivateKey(rsaKey)
+	if rsaKey.D.Sign() != 0 || rsaKey.Primes[0].Sign() != 0 || rsaKey.Precomputed.Dp.Sign() != 0 {
+		t.Errorf("expected RSA private key to be zeroed")
+	}
+}
+
+func TestGenCSRKeyParses(t *testing.T) {
+	for _, opts := range []CertOptions{
+		{Host: "spiffe://cluster.local/ns/foo/sa/bar", RSAKeySize: 2048},
+		{Host: "spiffe://cluster.local/ns/foo/sa/bar", ECSigAlg: EcdsaSigAlg},
+		{Host: "spiffe://cluster.local/ns/foo/sa/bar", ECSigAlg: EcdsaSigAlg, PKCS8Key: true},
+	} {
+		csrPEM, keyPEM, err := GenCSR(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The returned key must survive the zeroing of the generated key.
+		key, err := ParsePemEncodedKey(keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := ParsePemEncodedCSR(csrPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !publicKeysEqual(publicKey(key), csr.PublicKey) {
+			t.Errorf("key does not match the CSR for %+v", opts)
+		}
+	}
+}
+
+func publicKeysEqual(a, b interface{}) bool {
+	type equaler interface {
+		Equal(x crypto.PublicKey) bool
+	}
+	ea, ok := a.(equaler)
+	return ok && ea.Equal(b)
+}
@@ -204,3 +204,11 @@ func TestVerifyCert(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkVerifyCertificate(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		if err := VerifyCertificate([]byte(key), []byte(certChain), []byte(rootCert), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
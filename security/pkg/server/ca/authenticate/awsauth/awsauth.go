@@ -0,0 +1,246 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package awsauth authenticates workloads with their AWS IAM identity, proven by an STS
+// GetCallerIdentity request they signed, so that EC2 and EKS workloads do not need a Kubernetes
+// token of the cluster of istiod.
+package awsauth
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	AWSIAMAuthenticatorType = "AWSIAMAuthenticator"
+
+	stsTimeout = 10 * time.Second
+	// maxSTSResponseSize bounds the size of the GetCallerIdentity responses read.
+	maxSTSResponseSize = 64 * 1024
+)
+
+var (
+	awsauthLog = log.RegisterScope("awsauth", "AWS IAM authenticator", 0)
+
+	// stsHost matches the global and regional STS endpoints, the only hosts the signed requests are
+	// sent to.
+	stsHost = regexp.MustCompile(`^sts(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+	// assumedRole matches the ARN of an assumed role session, e.g. of an EC2 instance profile or
+	// of an EKS service account.
+	assumedRole = regexp.MustCompile(`^arn:([a-z-]+):sts::(\d+):assumed-role/([^/]+)/.+$`)
+)
+
+// Options configures an AWSIAMAuthenticator.
+type Options struct {
+	TrustDomain string
+
+	// Identities maps an IAM ARN to the mesh identity granted to it. Keys are the ARN of an IAM user
+	// or role, e.g. arn:aws:iam::123456789012:role/app, or ARN prefixes ending with "*". Values have
+	// the form "<namespace>/<service account>". The sessions of an assumed role are authenticated as
+	// the role.
+	Identities map[string]string
+
+	// Client is the client of the STS requests, a default one if nil.
+	Client *http.Client
+}
+
+// AWSIAMAuthenticator sends the GetCallerIdentity request signed by a workload, sent as the bearer
+// token of the CSR request, to STS, and maps the IAM identity of the workload to a mesh identity.
+type AWSIAMAuthenticator struct {
+	trustDomain string
+	identities  map[string]string
+	// prefixes are the ARN prefixes of identities, longest first.
+	prefixes []string
+	client   *http.Client
+}
+
+var _ security.Authenticator = &AWSIAMAuthenticator{}
+
+// NewAWSIAMAuthenticator creates a new AWSIAMAuthenticator.
+func NewAWSIAMAuthenticator(opts Options) (*AWSIAMAuthenticator, error) {
+	a := &AWSIAMAuthenticator{
+		trustDomain: opts.TrustDomain,
+		identities:  opts.Identities,
+		client:      opts.Client,
+	}
+	for k, v := range opts.Identities {
+		if !strings.HasPrefix(k, "arn:") {
+			return nil, fmt.Errorf("invalid IAM ARN %q", k)
+		}
+		if parts := strings.Split(v, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid identity %q for %q, expected <namespace>/<service account>", v, k)
+		}
+		if strings.HasSuffix(k, "*") {
+			a.prefixes = append(a.prefixes, k)
+		}
+	}
+	sort.Slice(a.prefixes, func(i, j int) bool { return len(a.prefixes[i]) > len(a.prefixes[j]) })
+	if a.client == nil {
+		a.client = &http.Client{Timeout: stsTimeout}
+	}
+	return a, nil
+}
+
+func (a *AWSIAMAuthenticator) AuthenticatorType() string {
+	return AWSIAMAuthenticatorType
+}
+
+// Authenticate authenticates the signed request in the bearer token of the call.
+func (a *AWSIAMAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	token, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("AWS IAM token extraction error: %v", err)
+	}
+	return a.authenticate(ctx, token)
+}
+
+// AuthenticateRequest authenticates the signed request in the bearer token of the request.
+func (a *AWSIAMAuthenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	token, err := security.ExtractRequestToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("AWS IAM token extraction error: %v", err)
+	}
+	return a.authenticate(req.Context(), token)
+}
+
+func (a *AWSIAMAuthenticator) authenticate(ctx context.Context, token string) (*security.Caller, error) {
+	iam, err := security.ParseAWSIAMToken(token)
+	if err != nil {
+		return nil, err
+	}
+	req, err := a.stsRequest(ctx, iam)
+	if err != nil {
+		return nil, err
+	}
+	arn, err := a.getCallerIdentity(req)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := a.lookup(arn)
+	if !ok {
+		return nil, fmt.Errorf("no mesh identity is configured for IAM identity %q", arn)
+	}
+	parts := strings.Split(id, "/")
+	awsauthLog.Debugf("authenticated %s as %s", arn, id)
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, parts[0], parts[1])},
+	}, nil
+}
+
+// stsRequest returns the request of iam, checking that it is a GetCallerIdentity request to STS
+// signed for this server, so that istiod cannot be used to send arbitrary requests nor be replayed
+// requests signed for other servers.
+func (a *AWSIAMAuthenticator) stsRequest(ctx context.Context, iam *security.AWSIAMToken) (*http.Request, error) {
+	if iam.Method != http.MethodPost {
+		return nil, fmt.Errorf("unexpected AWS IAM request method %s", iam.Method)
+	}
+	u, err := url.Parse(iam.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWS IAM request URL: %v", err)
+	}
+	if u.Scheme != "https" || !stsHost.MatchString(u.Host) || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, fmt.Errorf("AWS IAM request URL %q is not an STS endpoint", iam.URL)
+	}
+	body, err := url.ParseQuery(iam.Body)
+	if err != nil || len(body) != 2 || body.Get("Action") != "GetCallerIdentity" || body.Get("Version") == "" {
+		return nil, fmt.Errorf("AWS IAM request is not a GetCallerIdentity request")
+	}
+	if serverID := iam.Headers.Get(security.AWSIAMServerIDHeader); serverID != a.trustDomain {
+		return nil, fmt.Errorf("AWS IAM request is for server %q, expected %q", serverID, a.trustDomain)
+	}
+	if !signedHeader(iam.Headers.Get("Authorization"), security.AWSIAMServerIDHeader) {
+		return nil, fmt.Errorf("AWS IAM request does not sign %s", security.AWSIAMServerIDHeader)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(iam.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = iam.Headers.Clone()
+	return req, nil
+}
+
+// signedHeader returns whether the SigV4 authorization covers header.
+func signedHeader(authorization, header string) bool {
+	for _, field := range strings.Split(authorization, ",") {
+		field = strings.TrimSpace(field)
+		if i := strings.Index(field, "SignedHeaders="); i >= 0 {
+			for _, h := range strings.Split(field[i+len("SignedHeaders="):], ";") {
+				if h == strings.ToLower(header) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type getCallerIdentityResponse struct {
+	Result struct {
+		Arn     string `xml:"Arn"`
+		Account string `xml:"Account"`
+	} `xml:"GetCallerIdentityResult"`
+}
+
+// getCallerIdentity sends req to STS and returns the ARN of the caller.
+func (a *AWSIAMAuthenticator) getCallerIdentity(req *http.Request) (string, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GetCallerIdentity request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSTSResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read GetCallerIdentity response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GetCallerIdentity request returned status %d", resp.StatusCode)
+	}
+	identity := &getCallerIdentityResponse{}
+	if err := xml.Unmarshal(body, identity); err != nil {
+		return "", fmt.Errorf("failed to unmarshal GetCallerIdentity response: %v", err)
+	}
+	if identity.Result.Arn == "" {
+		return "", fmt.Errorf("GetCallerIdentity response has no ARN")
+	}
+	return identity.Result.Arn, nil
+}
+
+// lookup returns the identity granted to arn, the ARN of the role for an assumed role session.
+func (a *AWSIAMAuthenticator) lookup(arn string) (string, bool) {
+	if m := assumedRole.FindStringSubmatch(arn); m != nil {
+		arn = fmt.Sprintf("arn:%s:iam::%s:role/%s", m[1], m[2], m[3])
+	}
+	if id, ok := a.identities[arn]; ok {
+		return id, true
+	}
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(arn, strings.TrimSuffix(prefix, "*")) {
+			return a.identities[prefix], true
+		}
+	}
+	return "", false
+}
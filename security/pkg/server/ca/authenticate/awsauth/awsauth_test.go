@@ -0,0 +1,162 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awsauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+const trustDomain = "cluster.local"
+
+// fakeSTS answers the GetCallerIdentity requests with arn, or with status if set.
+type fakeSTS struct {
+	arn      string
+	status   int
+	requests int
+}
+
+func (f *fakeSTS) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.requests++
+	status, body := http.StatusOK, fmt.Sprintf(`<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult><Arn>%s</Arn><UserId>AROA:session</UserId><Account>123456789012</Account></GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, f.arn)
+	if f.status != 0 {
+		status, body = f.status, "<ErrorResponse/>"
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+}
+
+func token(t *testing.T, modify func(*security.AWSIAMToken)) string {
+	iam := &security.AWSIAMToken{
+		Method: http.MethodPost,
+		URL:    "https://sts.amazonaws.com/",
+		Body:   "Action=GetCallerIdentity&Version=2011-06-15",
+		Headers: http.Header{
+			"Authorization": []string{"AWS4-HMAC-SHA256 Credential=AKID/20210101/us-east-1/sts/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date;x-istio-aws-iam-server-id, Signature=abc"},
+			security.AWSIAMServerIDHeader: []string{trustDomain},
+		},
+	}
+	if modify != nil {
+		modify(iam)
+	}
+	s, err := iam.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewAWSIAMAuthenticator(t *testing.T) {
+	for _, identities := range []map[string]string{
+		{"role/app": "ns/sa"},
+		{"arn:aws:iam::123456789012:role/app": "ns"},
+	} {
+		if _, err := NewAWSIAMAuthenticator(Options{Identities: identities}); err == nil {
+			t.Errorf("expected %v to be invalid", identities)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	cases := []struct {
+		name       string
+		arn        string
+		status     int
+		token      string
+		expectedID string
+		// sent is whether the request is expected to be sent to STS.
+		sent bool
+	}{
+		{
+			name:       "assumed role",
+			arn:        "arn:aws:sts::123456789012:assumed-role/app/i-0123456789",
+			token:      token(t, nil),
+			expectedID: "spiffe://cluster.local/ns/app-ns/sa/app-sa",
+			sent:       true,
+		},
+		{
+			name:       "user prefix",
+			arn:        "arn:aws:iam::123456789012:user/ci/builder",
+			token:      token(t, nil),
+			expectedID: "spiffe://cluster.local/ns/ci/sa/builder",
+			sent:       true,
+		},
+		{
+			name:       "longest prefix",
+			arn:        "arn:aws:iam::123456789012:user/ci/admin/root",
+			token:      token(t, nil),
+			expectedID: "spiffe://cluster.local/ns/ci/sa/admin",
+			sent:       true,
+		},
+		{name: "unmapped role", arn: "arn:aws:iam::123456789012:role/other", token: token(t, nil), sent: true},
+		{name: "rejected by STS", status: http.StatusForbidden, token: token(t, nil), sent: true},
+		{name: "not an STS endpoint", token: token(t, func(iam *security.AWSIAMToken) { iam.URL = "https://example.com/" })},
+		{name: "plain text", token: token(t, func(iam *security.AWSIAMToken) { iam.URL = "http://sts.amazonaws.com/" })},
+		{name: "other action", token: token(t, func(iam *security.AWSIAMToken) { iam.Body = "Action=AssumeRole&Version=2011-06-15" })},
+		{
+			name:  "other server",
+			token: token(t, func(iam *security.AWSIAMToken) { iam.Headers.Set(security.AWSIAMServerIDHeader, "other.domain") }),
+		},
+		{
+			name: "unsigned server ID",
+			token: token(t, func(iam *security.AWSIAMToken) {
+				iam.Headers.Set("Authorization", "AWS4-HMAC-SHA256 SignedHeaders=host;x-amz-date, Signature=abc")
+			}),
+		},
+		{name: "not an AWS IAM token", token: "a.b.c"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sts := &fakeSTS{arn: c.arn, status: c.status}
+			a, err := NewAWSIAMAuthenticator(Options{
+				TrustDomain: trustDomain,
+				Identities: map[string]string{
+					"arn:aws:iam::123456789012:role/app":         "app-ns/app-sa",
+					"arn:aws:iam::123456789012:user/ci/*":        "ci/builder",
+					"arn:aws:iam::123456789012:user/ci/admin/*":  "ci/admin",
+					"arn:aws:iam::210987654321:role/unrelated-*": "other/sa",
+				},
+				Client: &http.Client{Transport: sts},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			caller, err := a.authenticate(context.Background(), c.token)
+			if (sts.requests > 0) != c.sent {
+				t.Errorf("got %d STS requests, expected sent %v", sts.requests, c.sent)
+			}
+			if c.expectedID == "" {
+				if err == nil {
+					t.Fatalf("expected authentication to fail, got %+v", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(caller.Identities) != 1 || caller.Identities[0] != c.expectedID {
+				t.Fatalf("got identities %v, expected %s", caller.Identities, c.expectedID)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azureauth authenticates workloads presenting an Azure AD access token, such as that of
+// the federated workload identity of an AKS pod or of the managed identity of an Azure VM, and maps
+// their Azure AD identity to a mesh identity.
+package azureauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	AzureADAuthenticatorType = "AzureADAuthenticator"
+
+	// DefaultAuthorityHost is the Azure AD authority of the Azure public cloud.
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+	// v1IssuerTemplate is the issuer of the v1 access tokens of a tenant in the Azure public cloud.
+	v1IssuerTemplate = "https://sts.windows.net/%s/"
+
+	// Claims of the keys of Options.Identities.
+	ClaimObjectID = "oid"
+	ClaimSubject  = "sub"
+
+	httpTimeout = 10 * time.Second
+)
+
+var azureauthLog = log.RegisterScope("azureauth", "Azure AD authenticator", 0)
+
+// Options configures an AzureADAuthenticator.
+type Options struct {
+	TrustDomain string `json:"-"`
+
+	// TenantID is the Azure AD tenant issuing the tokens.
+	TenantID string `json:"tenantId"`
+	// Audiences are the accepted audiences, e.g. the application ID URI or client ID of the app
+	// registration of istiod. The aud claim of the tokens must be one of them.
+	Audiences []string `json:"audiences"`
+	// Identities maps an Azure AD identity to the mesh identity granted to it. Keys have the form
+	// "oid:<object ID>", matching the object ID of the managed identity or service principal, or
+	// "sub:<subject>". Values have the form "<namespace>/<service account>".
+	Identities map[string]string `json:"identities"`
+
+	// AuthorityHost is the Azure AD authority, DefaultAuthorityHost if empty.
+	AuthorityHost string `json:"authorityHost,omitempty"`
+	// HTTPClient is the client of the JWKS requests, a default one if nil.
+	HTTPClient *http.Client `json:"-"`
+}
+
+// AzureADAuthenticator validates the Azure AD access token sent as the bearer token of the CSR
+// request, and maps its object ID or subject to a mesh identity.
+type AzureADAuthenticator struct {
+	trustDomain string
+	tenantID    string
+	audiences   []string
+	identities  map[string]string
+	// issuers are the accepted issuers: those of the v2 and, in the public cloud, v1 tokens.
+	issuers  []string
+	verifier *oidc.IDTokenVerifier
+}
+
+var _ security.Authenticator = &AzureADAuthenticator{}
+
+// NewAzureADAuthenticator creates a new AzureADAuthenticator. The signing keys of the tenant are
+// cached, and refreshed when a token is signed by an unknown key.
+func NewAzureADAuthenticator(opts Options) (*AzureADAuthenticator, error) {
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("no Azure AD tenant is configured")
+	}
+	if len(opts.Audiences) == 0 {
+		return nil, fmt.Errorf("no audience is configured for Azure AD tenant %s", opts.TenantID)
+	}
+	for k, v := range opts.Identities {
+		if claim, value, _ := cut(k, ":"); (claim != ClaimObjectID && claim != ClaimSubject) || value == "" {
+			return nil, fmt.Errorf("invalid Azure AD identity %q, expected oid:<object ID> or sub:<subject>", k)
+		}
+		if parts := strings.Split(v, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid identity %q for %q, expected <namespace>/<service account>", v, k)
+		}
+	}
+	authority := strings.TrimSuffix(opts.AuthorityHost, "/")
+	if authority == "" {
+		authority = DefaultAuthorityHost
+	}
+	issuers := []string{fmt.Sprintf("%s/%s/v2.0", authority, opts.TenantID)}
+	if authority == DefaultAuthorityHost {
+		issuers = append(issuers, fmt.Sprintf(v1IssuerTemplate, opts.TenantID))
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	ctx := oidc.ClientContext(context.Background(), client)
+	// The v1 and v2 tokens are signed by the same keys; the issuer is checked by the authenticator.
+	keySet := oidc.NewRemoteKeySet(ctx, fmt.Sprintf("%s/%s/discovery/v2.0/keys", authority, opts.TenantID))
+	return &AzureADAuthenticator{
+		trustDomain: opts.TrustDomain,
+		tenantID:    opts.TenantID,
+		audiences:   opts.Audiences,
+		identities:  opts.Identities,
+		issuers:     issuers,
+		verifier:    oidc.NewVerifier(issuers[0], keySet, &oidc.Config{SkipClientIDCheck: true, SkipIssuerCheck: true}),
+	}, nil
+}
+
+func (a *AzureADAuthenticator) AuthenticatorType() string {
+	return AzureADAuthenticatorType
+}
+
+// Authenticate authenticates the Azure AD token in the bearer token of the call.
+func (a *AzureADAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	token, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract the Azure AD token: %v", err)
+	}
+	return a.authenticate(ctx, token)
+}
+
+// AuthenticateRequest authenticates the Azure AD token in the bearer token of the request.
+func (a *AzureADAuthenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	token, err := security.ExtractRequestToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract the Azure AD token: %v", err)
+	}
+	return a.authenticate(req.Context(), token)
+}
+
+type azureClaims struct {
+	TenantID string `json:"tid"`
+	ObjectID string `json:"oid"`
+}
+
+func (a *AzureADAuthenticator) authenticate(ctx context.Context, token string) (*security.Caller, error) {
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the Azure AD token: %v", err)
+	}
+	if !contains(a.issuers, idToken.Issuer) {
+		return nil, fmt.Errorf("invalid issuer %q", idToken.Issuer)
+	}
+	if !containsAny(a.audiences, idToken.Audience) {
+		return nil, fmt.Errorf("invalid audiences %v", idToken.Audience)
+	}
+	claims := &azureClaims{}
+	if err := idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims from the Azure AD token: %v", err)
+	}
+	if claims.TenantID != a.tenantID {
+		return nil, fmt.Errorf("token of tenant %q, expected %q", claims.TenantID, a.tenantID)
+	}
+	key := ClaimObjectID + ":" + claims.ObjectID
+	id, ok := a.identities[key]
+	if !ok {
+		key = ClaimSubject + ":" + idToken.Subject
+		id, ok = a.identities[key]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no mesh identity is configured for Azure AD object %q or subject %q", claims.ObjectID, idToken.Subject)
+	}
+	parts := strings.Split(id, "/")
+	azureauthLog.Debugf("authenticated %s as %s", key, id)
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, parts[0], parts[1])},
+	}, nil
+}
+
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, c := range candidates {
+		if contains(values, c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const tenant = "tenant-id"
+
+func TestNewAzureADAuthenticator(t *testing.T) {
+	valid := Options{TenantID: tenant, Audiences: []string{"api://istiod"}, Identities: map[string]string{"oid:1": "ns/sa"}}
+	a, err := NewAzureADAuthenticator(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"https://login.microsoftonline.com/tenant-id/v2.0", "https://sts.windows.net/tenant-id/"}
+	if !reflect.DeepEqual(a.issuers, expected) {
+		t.Errorf("got issuers %v, expected %v", a.issuers, expected)
+	}
+	invalid := []func(o *Options){
+		func(o *Options) { o.TenantID = "" },
+		func(o *Options) { o.Audiences = nil },
+		func(o *Options) { o.Identities = map[string]string{"appid:1": "ns/sa"} },
+		func(o *Options) { o.Identities = map[string]string{"oid:": "ns/sa"} },
+		func(o *Options) { o.Identities = map[string]string{"oid:1": "sa"} },
+	}
+	for i, modify := range invalid {
+		opts := valid
+		modify(&opts)
+		if _, err := NewAzureADAuthenticator(opts); err == nil {
+			t.Errorf("expected options %d to be invalid", i)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: "key-1", Algorithm: string(jose.RS256), Use: "sig"}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jwk}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+tenant+"/discovery/v2.0/keys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	}))
+	defer server.Close()
+	issuer := server.URL + "/" + tenant + "/v2.0"
+
+	token := func(claims map[string]interface{}) string {
+		all := map[string]interface{}{
+			"iss": issuer, "aud": "api://istiod", "tid": tenant, "oid": "object-1", "sub": "subject-1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			all[k] = v
+		}
+		payload, _ := json.Marshal(all)
+		jws, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := jws.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	a, err := NewAzureADAuthenticator(Options{
+		TrustDomain:   "cluster.local",
+		TenantID:      tenant,
+		Audiences:     []string{"api://istiod"},
+		Identities:    map[string]string{"oid:object-1": "aks/app", "sub:subject-2": "vms/default"},
+		AuthorityHost: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		token      string
+		expectedID string
+	}{
+		{name: "object ID", token: token(nil), expectedID: "spiffe://cluster.local/ns/aks/sa/app"},
+		{name: "subject", token: token(map[string]interface{}{"oid": "object-2", "sub": "subject-2"}), expectedID: "spiffe://cluster.local/ns/vms/sa/default"},
+		{name: "unmapped", token: token(map[string]interface{}{"oid": "object-2"})},
+		{name: "other tenant", token: token(map[string]interface{}{"tid": "other"})},
+		{name: "v1 issuer outside the public cloud", token: token(map[string]interface{}{"iss": "https://sts.windows.net/" + tenant + "/"})},
+		{name: "wrong audience", token: token(map[string]interface{}{"aud": "api://other"})},
+		{name: "expired", token: token(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			caller, err := a.authenticate(context.Background(), c.token)
+			if c.expectedID == "" {
+				if err == nil {
+					t.Fatalf("expected authentication to fail, got %+v", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(caller.Identities) != 1 || caller.Identities[0] != c.expectedID {
+				t.Fatalf("got identities %v, expected %s", caller.Identities, c.expectedID)
+			}
+		})
+	}
+}
@@ -15,14 +15,17 @@
 package authenticate
 
 import (
+	"crypto/x509/pkix"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
 
 	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/security/pkg/pki/util"
 )
 
@@ -31,7 +34,13 @@ const (
 )
 
 // ClientCertAuthenticator extracts identities from client certificate.
-type ClientCertAuthenticator struct{}
+type ClientCertAuthenticator struct {
+	// TrustDomains, if set, are the only trust domains whose SPIFFE IDs are authenticated.
+	TrustDomains []string
+	// PathPrefixes, if set, are the only path prefixes of the SPIFFE IDs authenticated, matching whole
+	// path segments, e.g. /ns/istio-system.
+	PathPrefixes []string
+}
 
 var _ security.Authenticator = &ClientCertAuthenticator{}
 
@@ -59,15 +68,7 @@ func (cca *ClientCertAuthenticator) Authenticate(ctx context.Context) (*security
 		return nil, fmt.Errorf("no verified chain is found")
 	}
 
-	ids, err := util.ExtractIDs(chains[0][0].Extensions)
-	if err != nil {
-		return nil, err
-	}
-
-	return &security.Caller{
-		AuthSource: security.AuthSourceClientCertificate,
-		Identities: ids,
-	}, nil
+	return cca.callerFromCert(chains[0][0].Extensions)
 }
 
 // AuthenticateRequest performs mTLS authentication for http requests. Requires having the endpoints on a listener
@@ -82,13 +83,62 @@ func (cca *ClientCertAuthenticator) AuthenticateRequest(req *http.Request) (*sec
 		return nil, fmt.Errorf("no verified chain is found")
 	}
 
-	ids, err := util.ExtractIDs(chains[0][0].Extensions)
+	return cca.callerFromCert(chains[0][0].Extensions)
+}
+
+// callerFromCert returns the caller identified by the SAN extension of its certificate. If an allowlist
+// is configured, only the SPIFFE IDs it allows are authenticated.
+func (cca *ClientCertAuthenticator) callerFromCert(exts []pkix.Extension) (*security.Caller, error) {
+	ids, err := util.ExtractIDs(exts)
 	if err != nil {
 		return nil, err
 	}
+	enforce := len(cca.TrustDomains) > 0 || len(cca.PathPrefixes) > 0
+	caller := &security.Caller{AuthSource: security.AuthSourceClientCertificate}
+	var rejected []string
+	for _, id := range ids {
+		sid, err := spiffe.ParseID(id)
+		if err != nil {
+			if enforce {
+				rejected = append(rejected, id)
+				continue
+			}
+			caller.Identities = append(caller.Identities, id)
+			continue
+		}
+		if enforce && !cca.allowed(sid) {
+			rejected = append(rejected, id)
+			continue
+		}
+		caller.Identities = append(caller.Identities, id)
+		caller.SpiffeIDs = append(caller.SpiffeIDs, sid)
+	}
+	if len(caller.Identities) == 0 && len(rejected) > 0 {
+		return nil, fmt.Errorf("client certificate identities %s are not allowed", strings.Join(rejected, ", "))
+	}
+	return caller, nil
+}
+
+func (cca *ClientCertAuthenticator) allowed(id spiffe.ID) bool {
+	if len(cca.TrustDomains) > 0 && !contains(cca.TrustDomains, id.TrustDomain) {
+		return false
+	}
+	if len(cca.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range cca.PathPrefixes {
+		if id.HasPathPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-	return &security.Caller{
-		AuthSource: security.AuthSourceClientCertificate,
-		Identities: ids,
-	}, nil
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
 }
@@ -125,3 +125,59 @@ func TestAuthenticate_clientCertAuthenticator(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthenticate_clientCertAuthenticatorAllowlist(t *testing.T) {
+	auth := &ClientCertAuthenticator{
+		TrustDomains: []string{"cluster.local", "partner.example"},
+		PathPrefixes: []string{"/ns/istio-system", "/ns/apps/"},
+	}
+	testCases := map[string]struct {
+		sans     []string
+		expected []string
+	}{
+		"allowed": {
+			sans:     []string{"spiffe://cluster.local/ns/istio-system/sa/gateway"},
+			expected: []string{"spiffe://cluster.local/ns/istio-system/sa/gateway"},
+		},
+		"other trust domain":  {sans: []string{"spiffe://evil.example/ns/istio-system/sa/gateway"}},
+		"other path":          {sans: []string{"spiffe://cluster.local/ns/default/sa/app"}},
+		"path segment prefix": {sans: []string{"spiffe://cluster.local/ns/istio-system-evil/sa/app"}},
+		"not a SPIFFE ID":     {sans: []string{"test.identity"}},
+		"invalid SPIFFE ID":   {sans: []string{"spiffe://cluster.local/ns/apps/../istio-system/sa/app"}},
+		"disallowed IDs are dropped": {
+			sans:     []string{"spiffe://evil.example/ns/apps/sa/a", "spiffe://partner.example/ns/apps/sa/b"},
+			expected: []string{"spiffe://partner.example/ns/apps/sa/b"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var ids []util.Identity
+			for _, san := range tc.sans {
+				ids = append(ids, util.Identity{Type: util.TypeURI, Value: []byte(san)})
+			}
+			sanExt, err := util.BuildSANExtension(ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsInfo := credentials.TLSInfo{
+				State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Extensions: []pkix.Extension{*sanExt}}}}},
+			}
+			caller, err := auth.Authenticate(peer.NewContext(context.Background(), &peer.Peer{AuthInfo: tlsInfo}))
+			if tc.expected == nil {
+				if err == nil {
+					t.Fatalf("expected authentication to fail, got %+v", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(caller.Identities, tc.expected) {
+				t.Fatalf("got identities %v, expected %v", caller.Identities, tc.expected)
+			}
+			if len(caller.SpiffeIDs) != len(tc.expected) || caller.SpiffeIDs[0].String() != tc.expected[0] {
+				t.Fatalf("got SPIFFE IDs %v, expected %v", caller.SpiffeIDs, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloudauth authenticates VM workloads using the signed instance identity documents of
+// their cloud platform, so that VMs do not need a bootstrap token to get their first certificate.
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	InstanceIdentityAuthenticatorType = "InstanceIdentityAuthenticator"
+
+	// Platform prefixes of the keys in Options.Identities.
+	PlatformAWS   = "aws"
+	PlatformAzure = "azure"
+	PlatformGCP   = "gcp"
+
+	googleIssuer  = "https://accounts.google.com"
+	googleJwksURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// azureSignerDomain is the domain of the certificate signing Azure attested documents.
+	azureSignerDomain = "metadata.azure.com"
+	// azureTimeLayout is the layout of the timestamps in the Azure attested document.
+	azureTimeLayout = "01/02/06 15:04:05 -0700"
+	// AzureNonceWindow is how far from the current time the nonce of an Azure attested document, the
+	// Unix time at which the VM requested it, may be.
+	AzureNonceWindow = 5 * time.Minute
+
+	// DefaultAWSInstanceMaxAge is the default of Options.AWSInstanceMaxAge.
+	DefaultAWSInstanceMaxAge = 10 * time.Minute
+)
+
+var cloudauthLog = log.RegisterScope("cloudauth", "Cloud instance identity authenticator", 0)
+
+// Options configures an InstanceIdentityAuthenticator.
+type Options struct {
+	TrustDomain string
+
+	// Identities maps a cloud account to the mesh identity granted to its VMs. Keys have the form
+	// "<platform>/<account>", where account is the AWS account ID, the GCP project ID or the Azure
+	// subscription ID. Values have the form "<namespace>/<service account>".
+	Identities map[string]string
+
+	// AWSCertificates are the AWS public certificates used to verify the RSA-SHA256 signature of
+	// instance identity documents, one per region in use.
+	AWSCertificates []*x509.Certificate
+
+	// AWSInstanceMaxAge bounds the time since an EC2 instance was launched or last started, after
+	// which its instance identity document is rejected. EC2 documents carry no nonce and do not
+	// expire, so this bounds the time a leaked document can be replayed; VMs renew their certificate
+	// with mTLS afterwards. DefaultAWSInstanceMaxAge is used if zero.
+	AWSInstanceMaxAge time.Duration
+
+	// AzureRoots verify the certificate signing Azure attested documents. The system roots are
+	// used if nil.
+	AzureRoots *x509.CertPool
+}
+
+// InstanceIdentityAuthenticator validates the instance identity document of a VM, sent as the
+// bearer token of the CSR request, and maps the cloud account of the VM to a mesh identity.
+type InstanceIdentityAuthenticator struct {
+	trustDomain string
+	identities  map[string]string
+	awsCerts    []*x509.Certificate
+	awsMaxAge   time.Duration
+	azureRoots  *x509.CertPool
+	gcpVerifier *oidc.IDTokenVerifier
+	now         func() time.Time
+}
+
+var _ security.Authenticator = &InstanceIdentityAuthenticator{}
+
+// NewInstanceIdentityAuthenticator creates a new InstanceIdentityAuthenticator.
+func NewInstanceIdentityAuthenticator(opts Options) (*InstanceIdentityAuthenticator, error) {
+	for k, v := range opts.Identities {
+		if _, _, err := splitKey(k); err != nil {
+			return nil, err
+		}
+		if len(strings.Split(v, "/")) != 2 {
+			return nil, fmt.Errorf("invalid identity %q for %q, expected <namespace>/<service account>", v, k)
+		}
+	}
+	// GCE VMs request an identity token with the trust domain as audience.
+	keySet := oidc.NewRemoteKeySet(context.Background(), googleJwksURL)
+	awsMaxAge := opts.AWSInstanceMaxAge
+	if awsMaxAge <= 0 {
+		awsMaxAge = DefaultAWSInstanceMaxAge
+	}
+	return &InstanceIdentityAuthenticator{
+		trustDomain: opts.TrustDomain,
+		identities:  opts.Identities,
+		awsCerts:    opts.AWSCertificates,
+		awsMaxAge:   awsMaxAge,
+		azureRoots:  opts.AzureRoots,
+		gcpVerifier: oidc.NewVerifier(googleIssuer, keySet, &oidc.Config{ClientID: opts.TrustDomain}),
+		now:         time.Now,
+	}, nil
+}
+
+func splitKey(key string) (string, string, error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid cloud account %q, expected <platform>/<account>", key)
+	}
+	switch parts[0] {
+	case PlatformAWS, PlatformAzure, PlatformGCP:
+		return parts[0], parts[1], nil
+	default:
+		return "", "", fmt.Errorf("unsupported platform %q in %q", parts[0], key)
+	}
+}
+
+func (a *InstanceIdentityAuthenticator) AuthenticatorType() string {
+	return InstanceIdentityAuthenticatorType
+}
+
+// Authenticate authenticates the instance identity document in the bearer token of the call.
+func (a *InstanceIdentityAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	token, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("instance identity extraction error: %v", err)
+	}
+	return a.authenticate(ctx, token)
+}
+
+// AuthenticateRequest authenticates the instance identity document in the bearer token of the request.
+func (a *InstanceIdentityAuthenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	token, err := security.ExtractRequestToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("instance identity extraction error: %v", err)
+	}
+	return a.authenticate(req.Context(), token)
+}
+
+func (a *InstanceIdentityAuthenticator) authenticate(ctx context.Context, token string) (*security.Caller, error) {
+	var account string
+	var err error
+	if security.IsInstanceIdentityToken(token) {
+		iid, perr := security.ParseInstanceIdentityToken(token)
+		if perr != nil {
+			return nil, perr
+		}
+		switch iid.Platform {
+		case security.AWS:
+			account, err = a.verifyAWS(iid)
+		case security.Azure:
+			account, err = a.verifyAzure(iid)
+		default:
+			err = fmt.Errorf("unsupported instance identity platform %q", iid.Platform)
+		}
+	} else {
+		// GCE VMs send the Google signed identity token as is.
+		account, err = a.verifyGCP(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id, ok := a.identities[account]
+	if !ok {
+		return nil, fmt.Errorf("no mesh identity is configured for cloud account %q", account)
+	}
+	parts := strings.Split(id, "/")
+	cloudauthLog.Debugf("authenticated %s as %s", account, id)
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, parts[0], parts[1])},
+	}, nil
+}
+
+type awsIdentityDocument struct {
+	AccountID   string    `json:"accountId"`
+	InstanceID  string    `json:"instanceId"`
+	Region      string    `json:"region"`
+	PendingTime time.Time `json:"pendingTime"`
+}
+
+// verifyAWS verifies the signature of an EC2 instance identity document and returns its account key.
+// The document does not expire, so it is only accepted within awsMaxAge of the time the instance was
+// launched or last started, its pendingTime.
+func (a *InstanceIdentityAuthenticator) verifyAWS(iid *security.InstanceIdentityToken) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(iid.Signature), ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode instance identity signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(iid.Document))
+	verified := false
+	for _, c := range a.awsCerts {
+		if pub, ok := c.PublicKey.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return "", fmt.Errorf("instance identity document is not signed by a configured AWS certificate")
+	}
+	doc := &awsIdentityDocument{}
+	if err := json.Unmarshal([]byte(iid.Document), doc); err != nil {
+		return "", fmt.Errorf("failed to unmarshal instance identity document: %v", err)
+	}
+	if doc.AccountID == "" {
+		return "", fmt.Errorf("instance identity document has no account ID")
+	}
+	if doc.PendingTime.IsZero() {
+		return "", fmt.Errorf("instance identity document has no pending time")
+	}
+	if age := a.now().Sub(doc.PendingTime); age > a.awsMaxAge {
+		return "", fmt.Errorf("instance %s was started %v ago, more than the maximum of %v", doc.InstanceID,
+			age.Round(time.Second), a.awsMaxAge)
+	}
+	return PlatformAWS + "/" + doc.AccountID, nil
+}
+
+type azureAttestedDocument struct {
+	Nonce          string `json:"nonce"`
+	VMID           string `json:"vmId"`
+	SubscriptionID string `json:"subscriptionId"`
+	TimeStamp      struct {
+		CreatedOn string `json:"createdOn"`
+		ExpiresOn string `json:"expiresOn"`
+	} `json:"timeStamp"`
+}
+
+// verifyAzure verifies an Azure attested document and returns its account key. The document must have
+// been requested with the current Unix time as nonce, which the metadata service signs with it, so
+// that it cannot be replayed beyond AzureNonceWindow although it is valid for hours.
+func (a *InstanceIdentityAuthenticator) verifyAzure(iid *security.InstanceIdentityToken) (string, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(iid.Signature), ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode attested document: %v", err)
+	}
+	msg, err := parsePKCS7(der)
+	if err != nil {
+		return "", err
+	}
+	signer, err := msg.verify()
+	if err != nil {
+		return "", err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range msg.certificates {
+		intermediates.AddCert(c)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		DNSName:       azureSignerDomain,
+		Roots:         a.azureRoots,
+		Intermediates: intermediates,
+		CurrentTime:   a.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return "", fmt.Errorf("attested document signer is not trusted: %v", err)
+	}
+	doc := &azureAttestedDocument{}
+	if err := json.Unmarshal(msg.content, doc); err != nil {
+		return "", fmt.Errorf("failed to unmarshal attested document: %v", err)
+	}
+	expiry, err := time.Parse(azureTimeLayout, doc.TimeStamp.ExpiresOn)
+	if err != nil {
+		return "", fmt.Errorf("invalid attested document expiry %q: %v", doc.TimeStamp.ExpiresOn, err)
+	}
+	if a.now().After(expiry) {
+		return "", fmt.Errorf("attested document expired at %v", expiry)
+	}
+	if doc.SubscriptionID == "" {
+		return "", fmt.Errorf("attested document has no subscription ID")
+	}
+	nonce, err := strconv.ParseInt(doc.Nonce, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("attested document has no timestamp nonce")
+	}
+	if skew := a.now().Sub(time.Unix(nonce, 0)); skew > AzureNonceWindow || skew < -AzureNonceWindow {
+		return "", fmt.Errorf("attested document was requested at %v, not within %v of the current time",
+			time.Unix(nonce, 0).UTC(), AzureNonceWindow)
+	}
+	return PlatformAzure + "/" + doc.SubscriptionID, nil
+}
+
+type gcpIdentityClaims struct {
+	Google struct {
+		ComputeEngine struct {
+			ProjectID    string `json:"project_id"`
+			InstanceID   string `json:"instance_id"`
+			InstanceName string `json:"instance_name"`
+		} `json:"compute_engine"`
+	} `json:"google"`
+}
+
+// verifyGCP verifies a GCE instance identity token and returns its account key.
+func (a *InstanceIdentityAuthenticator) verifyGCP(ctx context.Context, token string) (string, error) {
+	idToken, err := a.gcpVerifier.Verify(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify the GCE identity token (error %v)", err)
+	}
+	claims := &gcpIdentityClaims{}
+	if err := idToken.Claims(claims); err != nil {
+		return "", fmt.Errorf("failed to extract claims from GCE identity token: %v", err)
+	}
+	if claims.Google.ComputeEngine.ProjectID == "" {
+		return "", fmt.Errorf("GCE identity token has no compute engine claims, request it with format=full")
+	}
+	return PlatformGCP + "/" + claims.Google.ComputeEngine.ProjectID, nil
+}
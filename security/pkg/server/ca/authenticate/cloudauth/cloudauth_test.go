@@ -0,0 +1,377 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	jose "gopkg.in/square/go-jose.v2"
+
+	"istio.io/istio/pkg/security"
+)
+
+const trustDomain = "cluster.local"
+
+var identities = map[string]string{
+	"aws/123456789012":    "vm-ns/aws-sa",
+	"azure/subscription1": "vm-ns/azure-sa",
+	"gcp/my-project":      "vm-ns/gcp-sa",
+}
+
+func newCert(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newAuthenticator(t *testing.T, opts Options) *InstanceIdentityAuthenticator {
+	t.Helper()
+	opts.TrustDomain = trustDomain
+	opts.Identities = identities
+	a, err := NewInstanceIdentityAuthenticator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func checkCaller(t *testing.T, caller *security.Caller, err error, expectedID string) {
+	t.Helper()
+	if expectedID == "" {
+		if err == nil {
+			t.Fatalf("expected error, got caller %+v", caller)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(caller.Identities, []string{expectedID}) {
+		t.Errorf("got identities %v, expected %s", caller.Identities, expectedID)
+	}
+}
+
+func TestNewInstanceIdentityAuthenticator(t *testing.T) {
+	for _, ids := range []map[string]string{
+		{"aws": "ns/sa"},
+		{"openstack/1": "ns/sa"},
+		{"aws/1": "sa"},
+	} {
+		if _, err := NewInstanceIdentityAuthenticator(Options{Identities: ids}); err == nil {
+			t.Errorf("expected error for identities %v", ids)
+		}
+	}
+}
+
+func TestAuthenticateAWS(t *testing.T) {
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "aws"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	awsCert, awsKey := newCert(t, tmpl, nil, nil)
+	otherCert, _ := newCert(t, tmpl, nil, nil)
+
+	sign := func(doc string) string {
+		sum := sha256.Sum256([]byte(doc))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, awsKey, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	now := time.Date(2021, time.September, 1, 12, 0, 0, 0, time.UTC)
+	doc := `{"accountId":"123456789012","instanceId":"i-1234","region":"us-west-2","pendingTime":"2021-09-01T11:55:00Z"}`
+	unmapped := `{"accountId":"999999999999","instanceId":"i-1234","region":"us-west-2","pendingTime":"2021-09-01T11:55:00Z"}`
+	stale := `{"accountId":"123456789012","instanceId":"i-1234","region":"us-west-2","pendingTime":"2021-09-01T11:45:00Z"}`
+	undated := `{"accountId":"123456789012","instanceId":"i-1234","region":"us-west-2"}`
+
+	cases := []struct {
+		name       string
+		certs      []*x509.Certificate
+		iid        *security.InstanceIdentityToken
+		expectedID string
+	}{
+		{
+			name:       "valid",
+			certs:      []*x509.Certificate{otherCert, awsCert},
+			iid:        &security.InstanceIdentityToken{Platform: security.AWS, Document: doc, Signature: sign(doc)},
+			expectedID: "spiffe://cluster.local/ns/vm-ns/sa/aws-sa",
+		},
+		{
+			name:  "untrusted certificate",
+			certs: []*x509.Certificate{otherCert},
+			iid:   &security.InstanceIdentityToken{Platform: security.AWS, Document: doc, Signature: sign(doc)},
+		},
+		{
+			name:  "tampered document",
+			certs: []*x509.Certificate{awsCert},
+			iid:   &security.InstanceIdentityToken{Platform: security.AWS, Document: unmapped, Signature: sign(doc)},
+		},
+		{
+			name:  "unmapped account",
+			certs: []*x509.Certificate{awsCert},
+			iid:   &security.InstanceIdentityToken{Platform: security.AWS, Document: unmapped, Signature: sign(unmapped)},
+		},
+		{
+			name:  "instance started too long ago",
+			certs: []*x509.Certificate{awsCert},
+			iid:   &security.InstanceIdentityToken{Platform: security.AWS, Document: stale, Signature: sign(stale)},
+		},
+		{
+			name:  "no pending time",
+			certs: []*x509.Certificate{awsCert},
+			iid:   &security.InstanceIdentityToken{Platform: security.AWS, Document: undated, Signature: sign(undated)},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newAuthenticator(t, Options{AWSCertificates: c.certs})
+			a.now = func() time.Time { return now }
+			token, err := c.iid.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			caller, err := a.authenticate(context.Background(), token)
+			checkCaller(t, caller, err, c.expectedID)
+		})
+	}
+}
+
+// signPKCS7 builds a DER encoded PKCS#7 SignedData message with authenticated attributes, the
+// way the Azure metadata service signs attested documents.
+func signPKCS7(t *testing.T, content []byte, cert *x509.Certificate, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	mustMarshal := func(v interface{}, params string) []byte {
+		b, err := asn1.MarshalWithParams(v, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	explicit := func(b []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+	}
+	set := func(b []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b}
+	}
+	oidData := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidContentType := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	sha256OID := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	rsaOID := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}}
+
+	digest := sha256.Sum256(content)
+	attrs := mustMarshal([]attribute{
+		{Type: oidContentType, Value: set(mustMarshal(oidData, ""))},
+		{Type: oidMessageDigest, Value: set(mustMarshal(digest[:], ""))},
+	}, "set")
+	attrsSum := sha256.Sum256(attrs)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, attrsSum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAttrs := append([]byte(nil), attrs...)
+	signedAttrs[0] = 0xa0
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256OID},
+		ContentInfo:      contentInfo{ContentType: oidData, Content: explicit(mustMarshal(content, ""))},
+		Certificates:     explicit(cert.Raw),
+		SignerInfos: []signerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber},
+			DigestAlgorithm:           sha256OID,
+			AuthenticatedAttributes:   asn1.RawValue{FullBytes: signedAttrs},
+			DigestEncryptionAlgorithm: rsaOID,
+			EncryptedDigest:           sig,
+		}},
+	}
+	return mustMarshal(contentInfo{ContentType: oidSignedData, Content: explicit(mustMarshal(sd, ""))}, "")
+}
+
+func TestAuthenticateAzure(t *testing.T) {
+	now := time.Date(2021, time.September, 1, 12, 0, 0, 0, time.UTC)
+	root, rootKey := newCert(t, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "root"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour), IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	signer, signerKey := newCert(t, &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: azureSignerDomain},
+		DNSNames: []string{azureSignerDomain}, NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}, root, rootKey)
+	impostor, impostorKey := newCert(t, &x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com"}, NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}, root, rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	documentWithNonce := func(subscription string, expiry time.Time, nonce string) []byte {
+		return []byte(fmt.Sprintf(`{"nonce":%q,"vmId":"vm1","subscriptionId":%q,"timeStamp":{"createdOn":%q,"expiresOn":%q}}`,
+			nonce, subscription, now.Add(-time.Minute).Format(azureTimeLayout), expiry.Format(azureTimeLayout)))
+	}
+	document := func(subscription string, expiry time.Time) []byte {
+		return documentWithNonce(subscription, expiry, fmt.Sprint(now.Add(-time.Minute).Unix()))
+	}
+
+	cases := []struct {
+		name       string
+		der        []byte
+		expectedID string
+	}{
+		{
+			name:       "valid",
+			der:        signPKCS7(t, document("subscription1", now.Add(time.Hour)), signer, signerKey),
+			expectedID: "spiffe://cluster.local/ns/vm-ns/sa/azure-sa",
+		},
+		{
+			name: "expired",
+			der:  signPKCS7(t, document("subscription1", now.Add(-time.Second)), signer, signerKey),
+		},
+		{
+			name: "wrong signer domain",
+			der:  signPKCS7(t, document("subscription1", now.Add(time.Hour)), impostor, impostorKey),
+		},
+		{
+			name: "unmapped subscription",
+			der:  signPKCS7(t, document("subscription2", now.Add(time.Hour)), signer, signerKey),
+		},
+		{
+			name: "stale nonce",
+			der:  signPKCS7(t, documentWithNonce("subscription1", now.Add(time.Hour), fmt.Sprint(now.Add(-time.Hour).Unix())), signer, signerKey),
+		},
+		{
+			name: "no nonce",
+			der:  signPKCS7(t, documentWithNonce("subscription1", now.Add(time.Hour), ""), signer, signerKey),
+		},
+		{
+			name: "malformed",
+			der:  []byte("not pkcs7"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newAuthenticator(t, Options{AzureRoots: roots})
+			a.now = func() time.Time { return now }
+			iid := &security.InstanceIdentityToken{Platform: security.Azure, Signature: base64.StdEncoding.EncodeToString(c.der)}
+			token, err := iid.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			caller, err := a.authenticate(context.Background(), token)
+			checkCaller(t, caller, err, c.expectedID)
+		})
+	}
+}
+
+func TestPKCS7TamperedContent(t *testing.T) {
+	cert, key := newCert(t, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "signer"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}, nil, nil)
+	der := signPKCS7(t, []byte("original content"), cert, key)
+	msg, err := parsePKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := msg.verify(); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+	msg.content = []byte("tampered content")
+	if _, err := msg.verify(); err == nil {
+		t.Error("expected verification of tampered content to fail")
+	}
+}
+
+type staticKeySet struct {
+	key *rsa.PublicKey
+}
+
+func (s *staticKeySet) VerifySignature(_ context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, err
+	}
+	return jws.Verify(s.key)
+}
+
+func TestAuthenticateGCP(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := func(aud, project string) string {
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss": googleIssuer,
+			"aud": aud,
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"google": map[string]interface{}{
+				"compute_engine": map[string]string{"project_id": project, "instance_id": "1", "instance_name": "vm"},
+			},
+		})
+		jws, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := jws.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	cases := []struct {
+		name       string
+		token      string
+		expectedID string
+	}{
+		{name: "valid", token: token(trustDomain, "my-project"), expectedID: "spiffe://cluster.local/ns/vm-ns/sa/gcp-sa"},
+		{name: "wrong audience", token: token("other", "my-project")},
+		{name: "missing compute engine claims", token: token(trustDomain, "")},
+		{name: "unmapped project", token: token(trustDomain, "other-project")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newAuthenticator(t, Options{})
+			a.gcpVerifier = oidc.NewVerifier(googleIssuer, &staticKeySet{key: &key.PublicKey}, &oidc.Config{ClientID: trustDomain})
+			caller, err := a.authenticate(context.Background(), c.token)
+			checkCaller(t, caller, err, c.expectedID)
+		})
+	}
+}
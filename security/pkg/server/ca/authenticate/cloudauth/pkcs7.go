@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// This file implements just enough of PKCS#7 (RFC 2315) SignedData to verify the Azure attested
+// metadata document: a single signer, DER encoding and RSA or ECDSA signatures.
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	digestAlgorithms = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+// signedMessage is a parsed PKCS#7 SignedData message.
+type signedMessage struct {
+	content      []byte
+	certificates []*x509.Certificate
+	signer       signerInfo
+}
+
+// parsePKCS7 parses a DER encoded PKCS#7 SignedData message. The signature is not verified.
+func parsePKCS7(der []byte) (*signedMessage, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 content info: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after PKCS#7 content info")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signed data: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected a single PKCS#7 signer, found %d", len(sd.SignerInfos))
+	}
+	var content []byte
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#7 content: %v", err)
+		}
+	}
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		var err error
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#7 certificates: %v", err)
+		}
+	}
+	return &signedMessage{content: content, certificates: certs, signer: sd.SignerInfos[0]}, nil
+}
+
+// signerCertificate returns the embedded certificate identified by the signer info.
+func (m *signedMessage) signerCertificate() (*x509.Certificate, error) {
+	for _, c := range m.certificates {
+		if c.SerialNumber.Cmp(m.signer.IssuerAndSerialNumber.SerialNumber) == 0 &&
+			bytes.Equal(c.RawIssuer, m.signer.IssuerAndSerialNumber.Issuer.FullBytes) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("PKCS#7 signer certificate not found")
+}
+
+// verify checks the signature of the message against the embedded signer certificate and returns
+// that certificate. Chain validation is left to the caller.
+func (m *signedMessage) verify() (*x509.Certificate, error) {
+	cert, err := m.signerCertificate()
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := digestAlgorithms[m.signer.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PKCS#7 digest algorithm %v", m.signer.DigestAlgorithm.Algorithm)
+	}
+	h := hash.New()
+	h.Write(m.content)
+	signed := m.content
+	if len(m.signer.AuthenticatedAttributes.FullBytes) > 0 {
+		// With authenticated attributes the signature covers the DER encoding of the attributes as a
+		// SET OF, and the message digest attribute binds the content to it.
+		digest, err := m.messageDigest()
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(digest, h.Sum(nil)) != 1 {
+			return nil, fmt.Errorf("PKCS#7 message digest mismatch")
+		}
+		signed = append([]byte(nil), m.signer.AuthenticatedAttributes.FullBytes...)
+		signed[0] = 0x31 // SET OF, replacing the implicit [0] tag.
+		h = hash.New()
+		h.Write(signed)
+	}
+	sum := h.Sum(nil)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, hash, sum, m.signer.EncryptedDigest)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, sum, m.signer.EncryptedDigest) {
+			err = fmt.Errorf("ecdsa verification failure")
+		}
+	default:
+		err = fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 signature: %v", err)
+	}
+	return cert, nil
+}
+
+func (m *signedMessage) messageDigest() ([]byte, error) {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(m.signer.AuthenticatedAttributes.FullBytes, &attrs, "set,tag:0"); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 authenticated attributes: %v", err)
+	}
+	for _, a := range attrs {
+		if a.Type.Equal(oidMessageDigest) {
+			var digest []byte
+			if _, err := asn1.Unmarshal(a.Value.Bytes, &digest); err != nil {
+				return nil, fmt.Errorf("failed to parse PKCS#7 message digest: %v", err)
+			}
+			return digest, nil
+		}
+	}
+	return nil, fmt.Errorf("PKCS#7 message digest attribute not found")
+}
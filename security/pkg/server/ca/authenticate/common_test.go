@@ -16,6 +16,7 @@ package authenticate
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"google.golang.org/grpc/metadata"
@@ -60,6 +61,14 @@ func TestExtractBearerToken(t *testing.T) {
 			},
 			expectedToken: "bearer-token",
 		},
+		"Oversized auth header": {
+			metadata: metadata.MD{
+				"authorization": []string{
+					"Bearer " + strings.Repeat("a", security.MaxAuthorizationHeaderSize),
+				},
+			},
+			extractBearerTokenErrMsg: "HTTP authorization header exceeds 65536 bytes",
+		},
 	}
 
 	for id, tc := range testCases {
@@ -0,0 +1,123 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// credentialPattern matches the expressions holding credentials, which must only be compared with
+// subtle.ConstantTimeCompare or hmac.Equal.
+var credentialPattern = regexp.MustCompile(`(?i)(token|secret|passw|digest|hmac|signature|nonce)`)
+
+// credentialPaths are the authenticators and the STS path, relative to this package.
+var credentialPaths = []string{"..", "../../../stsservice"}
+
+// TestCredentialComparisonsAreConstantTime guards against comparing credentials with == or
+// bytes.Equal, which leak through timing how much of a guessed credential is correct.
+func TestCredentialComparisonsAreConstantTime(t *testing.T) {
+	for _, root := range credentialPaths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if info.Name() == "mock" || info.Name() == "test" || info.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			checkConstantTimeComparisons(t, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkConstantTimeComparisons checks the non-test files of the package in dir.
+func checkConstantTimeComparisons(t *testing.T, dir string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		// Constants, such as the expected token type, are public.
+		consts := map[string]bool{}
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.CONST {
+					for _, spec := range gen.Specs {
+						for _, name := range spec.(*ast.ValueSpec).Names {
+							consts[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+		isPublic := func(e ast.Expr) bool {
+			switch v := e.(type) {
+			case *ast.BasicLit:
+				return true
+			case *ast.Ident:
+				return v.Name == "nil" || consts[v.Name]
+			case *ast.CallExpr:
+				return types.ExprString(v.Fun) == "len"
+			case *ast.BinaryExpr:
+				// Arithmetic on counters, such as cacheHitCount%cacheHitDivisor.
+				return v.Op == token.REM
+			}
+			return false
+		}
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch e := n.(type) {
+				case *ast.BinaryExpr:
+					if e.Op != token.EQL && e.Op != token.NEQ || isPublic(e.X) || isPublic(e.Y) {
+						return true
+					}
+					if credentialPattern.MatchString(types.ExprString(e.X)) || credentialPattern.MatchString(types.ExprString(e.Y)) {
+						t.Errorf("%v: credential compared with %s, use subtle.ConstantTimeCompare: %s",
+							fset.Position(e.Pos()), e.Op, types.ExprString(e))
+					}
+				case *ast.CallExpr:
+					if fn := types.ExprString(e.Fun); fn != "bytes.Equal" && fn != "reflect.DeepEqual" {
+						return true
+					}
+					for _, arg := range e.Args {
+						if credentialPattern.MatchString(types.ExprString(arg)) {
+							t.Errorf("%v: credential compared with %s, use subtle.ConstantTimeCompare: %s",
+								fset.Position(e.Pos()), types.ExprString(e.Fun), types.ExprString(e))
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+}
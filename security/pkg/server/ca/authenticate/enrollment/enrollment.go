@@ -0,0 +1,230 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package enrollment implements single-use, short-lived enrollment tokens that a VM agent
+// exchanges for its first certificate. Later renewals are authenticated with mTLS using that
+// certificate, so the token is never needed again.
+package enrollment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	EnrollmentTokenAuthenticatorType = "EnrollmentTokenAuthenticator"
+
+	// tokenPrefix distinguishes enrollment tokens from JWTs and instance identity documents.
+	tokenPrefix = "enroll."
+
+	// DefaultTTL is the lifetime of a token if none is requested.
+	DefaultTTL = time.Hour
+	// MaxTTL bounds the lifetime of a token.
+	MaxTTL = 24 * time.Hour
+)
+
+var enrollmentLog = log.RegisterScope("enrollment", "VM enrollment token authenticator", 0)
+
+type claims struct {
+	Namespace      string `json:"ns"`
+	ServiceAccount string `json:"sa"`
+	Expiry         int64  `json:"exp"`
+	Nonce          string `json:"nonce"`
+}
+
+// Authenticator mints enrollment tokens and authenticates CSRs carrying them.
+//
+// Tokens are signed with a key shared by all istiod replicas, so any replica can verify them.
+// The nonce of a token is spent in a NonceStore shared by the replicas once a certificate has been
+// issued for it, after which the token is rejected by all of them.
+type Authenticator struct {
+	trustDomain string
+	key         []byte
+	nonces      NonceStore
+	now         func() time.Time
+}
+
+var _ security.Authenticator = &Authenticator{}
+
+// NewAuthenticator creates an Authenticator. The signing key is derived from secret, which must be
+// the same for all istiod replicas and is typically the CA private key. The spent nonces are kept in
+// nonces, or in memory if it is nil, which only makes the tokens single-use with a single replica.
+func NewAuthenticator(trustDomain string, secret []byte, nonces NonceStore) (*Authenticator, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("enrollment token signing secret is empty")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("istio-vm-enrollment-token"))
+	a := &Authenticator{
+		trustDomain: trustDomain,
+		key:         mac.Sum(nil),
+		nonces:      nonces,
+		now:         time.Now,
+	}
+	if a.nonces == nil {
+		a.nonces = newMemoryNonceStore(func() time.Time { return a.now() })
+	}
+	return a, nil
+}
+
+// Mint returns a new token granting namespace/serviceAccount to the first workload presenting it
+// within ttl.
+func (a *Authenticator) Mint(namespace, serviceAccount string, ttl time.Duration) (string, error) {
+	if namespace == "" || serviceAccount == "" {
+		return "", fmt.Errorf("namespace and service account are required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > MaxTTL {
+		return "", fmt.Errorf("token lifetime %v exceeds the maximum of %v", ttl, MaxTTL)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims{
+		Namespace:      namespace,
+		ServiceAccount: serviceAccount,
+		Expiry:         a.now().Add(ttl).Unix(),
+		Nonce:          base64.RawURLEncoding.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return tokenPrefix + encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), nil
+}
+
+func (a *Authenticator) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func (a *Authenticator) AuthenticatorType() string {
+	return EnrollmentTokenAuthenticatorType
+}
+
+// Authenticate authenticates the enrollment token in the bearer token of the call.
+func (a *Authenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	token, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment token extraction error: %v", err)
+	}
+	return a.authenticate(ctx, token)
+}
+
+// AuthenticateRequest authenticates the enrollment token in the bearer token of the request.
+func (a *Authenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	token, err := security.ExtractRequestToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment token extraction error: %v", err)
+	}
+	return a.authenticate(req.Context(), token)
+}
+
+// authenticate returns the caller of token, whose nonce is spent when the caller is redeemed.
+func (a *Authenticator) authenticate(ctx context.Context, token string) (*security.Caller, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, fmt.Errorf("not an enrollment token")
+	}
+	parts := strings.Split(strings.TrimPrefix(token, tokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed enrollment token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, a.sign(parts[0])) {
+		return nil, fmt.Errorf("invalid enrollment token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode enrollment token: %v", err)
+	}
+	c := claims{}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal enrollment token: %v", err)
+	}
+	expiry := time.Unix(c.Expiry, 0)
+	now := a.now()
+	if now.After(expiry) {
+		return nil, fmt.Errorf("enrollment token expired at %v", expiry)
+	}
+
+	spent, err := a.nonces.Spent(ctx, c.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the enrollment token nonce: %v", err)
+	}
+	if spent {
+		return nil, ErrNonceSpent
+	}
+
+	enrollmentLog.Infof("enrollment token accepted for %s/%s", c.Namespace, c.ServiceAccount)
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, c.Namespace, c.ServiceAccount)},
+		Redeem: func(ctx context.Context) error {
+			return a.nonces.Spend(ctx, c.Nonce, expiry)
+		},
+	}, nil
+}
+
+// ServeHTTP mints a token for the namespace and serviceaccount query parameters, with the optional
+// ttl parameter as lifetime. Only POST requests from localhost are served, so operators mint tokens
+// with "pilot-discovery request POST" from inside the istiod container.
+func (a *Authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isRequestFromLocalhost(req) {
+		http.Error(w, "only requests from localhost are allowed", http.StatusForbidden)
+		return
+	}
+	var ttl time.Duration
+	if v := req.URL.Query().Get("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid ttl: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	token, err := a.Mint(req.URL.Query().Get("namespace"), req.URL.Query().Get("serviceaccount"), ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write([]byte(token))
+}
+
+func isRequestFromLocalhost(r *http.Request) bool {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return net.ParseIP(ip).IsLoopback()
+}
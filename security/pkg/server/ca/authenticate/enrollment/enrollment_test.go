@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrollment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEnrollmentToken(t *testing.T) {
+	ctx := context.Background()
+	nonces := NewKubeNonceStore(fake.NewSimpleClientset(), "istio-system")
+	a, err := NewAuthenticator("cluster.local", []byte("ca-key"), nonces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second replica sharing the CA key and the nonces accepts tokens minted by the first.
+	replica, _ := NewAuthenticator("cluster.local", []byte("ca-key"), nonces)
+	other, _ := NewAuthenticator("cluster.local", []byte("other-key"), nil)
+
+	token, err := a.Mint("vm", "vm-sa", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.authenticate(ctx, token); err == nil {
+		t.Error("token accepted by an authenticator with a different key")
+	}
+	caller, err := a.authenticate(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"spiffe://cluster.local/ns/vm/sa/vm-sa"}; !reflect.DeepEqual(caller.Identities, expected) {
+		t.Errorf("got identities %v, expected %v", caller.Identities, expected)
+	}
+	// The token is only spent once a certificate is issued, so that a failed signing can be retried.
+	retried, err := replica.authenticate(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error from replica before the token is redeemed: %v", err)
+	}
+	if err := caller.Redeem(ctx); err != nil {
+		t.Fatalf("unexpected error redeeming the token: %v", err)
+	}
+	if err := retried.Redeem(ctx); !errors.Is(err, ErrNonceSpent) {
+		t.Errorf("expected concurrent redemption to fail, got %v", err)
+	}
+	if _, err := a.authenticate(ctx, token); !errors.Is(err, ErrNonceSpent) {
+		t.Errorf("expected reused token to be rejected, got %v", err)
+	}
+	if _, err := replica.authenticate(ctx, token); !errors.Is(err, ErrNonceSpent) {
+		t.Errorf("expected token reused with a replica to be rejected, got %v", err)
+	}
+
+	tampered := strings.Replace(token, ".", ".x", 1)
+	if _, err := a.authenticate(ctx, tampered); err == nil {
+		t.Error("tampered token accepted")
+	}
+
+	expired, _ := a.Mint("vm", "vm-sa", time.Minute)
+	a.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := a.authenticate(ctx, expired); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected expired token to be rejected, got %v", err)
+	}
+
+	if _, err := a.Mint("vm", "vm-sa", MaxTTL+time.Second); err == nil {
+		t.Error("expected error for a lifetime above the maximum")
+	}
+	if _, err := a.Mint("", "vm-sa", time.Minute); err == nil {
+		t.Error("expected error for a missing namespace")
+	}
+}
+
+func TestNonceStores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	client := fake.NewSimpleClientset()
+	kube := NewKubeNonceStore(client, "istio-system").(*kubeNonceStore)
+	kube.now = func() time.Time { return now }
+	memory := newMemoryNonceStore(func() time.Time { return now })
+	for name, store := range map[string]NonceStore{"kube": kube, "memory": memory} {
+		t.Run(name, func(t *testing.T) {
+			if spent, err := store.Spent(ctx, "expiring"); err != nil || spent {
+				t.Fatalf("expected unspent nonce, got %v %v", spent, err)
+			}
+			if err := store.Spend(ctx, "expiring", now.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Spend(ctx, "lasting", now.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if spent, err := store.Spent(ctx, "expiring"); err != nil || !spent {
+				t.Fatalf("expected spent nonce, got %v %v", spent, err)
+			}
+			if err := store.Spend(ctx, "expiring", now.Add(time.Minute)); !errors.Is(err, ErrNonceSpent) {
+				t.Fatalf("expected nonce to be spent once, got %v", err)
+			}
+		})
+	}
+
+	// Expired nonces are pruned once they can no longer be presented.
+	now = now.Add(noncePruneInterval + time.Second)
+	for name, store := range map[string]NonceStore{"kube": kube, "memory": memory} {
+		if err := store.Spend(ctx, "fresh", now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		for nonce, expected := range map[string]bool{"expiring": false, "lasting": true, "fresh": true} {
+			if spent, _ := store.Spent(ctx, nonce); spent != expected {
+				t.Errorf("%s: got spent %v for %s, expected %v", name, spent, nonce, expected)
+			}
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	a, _ := NewAuthenticator("cluster.local", []byte("ca-key"), nil)
+	cases := []struct {
+		name   string
+		method string
+		remote string
+		query  string
+		code   int
+	}{
+		{name: "mint", method: http.MethodPost, remote: "127.0.0.1:1234", query: "namespace=vm&serviceaccount=sa&ttl=10m", code: http.StatusOK},
+		{name: "get", method: http.MethodGet, remote: "127.0.0.1:1234", query: "namespace=vm&serviceaccount=sa", code: http.StatusMethodNotAllowed},
+		{name: "remote", method: http.MethodPost, remote: "10.0.0.1:1234", query: "namespace=vm&serviceaccount=sa", code: http.StatusForbidden},
+		{name: "invalid ttl", method: http.MethodPost, remote: "127.0.0.1:1234", query: "namespace=vm&serviceaccount=sa&ttl=x", code: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, "/debug/enrollment_token?"+c.query, nil)
+			req.RemoteAddr = c.remote
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, req)
+			if rw.Code != c.code {
+				t.Fatalf("got code %d, expected %d: %s", rw.Code, c.code, rw.Body.String())
+			}
+			if c.code == http.StatusOK {
+				if _, err := a.authenticate(context.Background(), rw.Body.String()); err != nil {
+					t.Errorf("minted token rejected: %v", err)
+				}
+			}
+		})
+	}
+}
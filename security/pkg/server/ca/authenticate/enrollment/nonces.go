@@ -0,0 +1,164 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrollment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// nonceLabel labels the Secrets recording the spent nonces.
+	nonceLabel = "istio.io/enrollment-nonce"
+	// nonceExpiryAnnotation is the RFC 3339 time after which a spent nonce can be forgotten.
+	nonceExpiryAnnotation = "istio.io/enrollment-nonce-expiry"
+	// nonceSecretType is the type of the Secrets recording the spent nonces.
+	nonceSecretType corev1.SecretType = "istio.io/enrollment-nonce"
+	// noncePruneInterval is how often the Secrets of expired nonces are deleted.
+	noncePruneInterval = 10 * time.Minute
+)
+
+// ErrNonceSpent is returned when the nonce of a token has already been spent.
+var ErrNonceSpent = errors.New("enrollment token has already been used")
+
+// NonceStore records the nonces of the tokens a certificate was issued for, until the tokens expire.
+// It must be shared by all istiod replicas for the tokens to be single-use.
+type NonceStore interface {
+	// Spent returns whether nonce has been spent.
+	Spent(ctx context.Context, nonce string) (bool, error)
+	// Spend records nonce as spent until expiry, failing with ErrNonceSpent if it already was.
+	Spend(ctx context.Context, nonce string, expiry time.Time) error
+}
+
+// memoryNonceStore is a NonceStore local to the replica, for istiod running without Kubernetes.
+type memoryNonceStore struct {
+	now func() time.Time
+
+	mu sync.Mutex
+	// spent maps each spent nonce to its expiry.
+	spent map[string]time.Time
+}
+
+func newMemoryNonceStore(now func() time.Time) *memoryNonceStore {
+	return &memoryNonceStore{now: now, spent: map[string]time.Time{}}
+}
+
+func (s *memoryNonceStore) Spent(_ context.Context, nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, f := s.spent[nonce]
+	return f, nil
+}
+
+func (s *memoryNonceStore) Spend(_ context.Context, nonce string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for n, exp := range s.spent {
+		if now.After(exp) {
+			delete(s.spent, n)
+		}
+	}
+	if _, f := s.spent[nonce]; f {
+		return ErrNonceSpent
+	}
+	s.spent[nonce] = expiry
+	return nil
+}
+
+// kubeNonceStore is a NonceStore recording each spent nonce as an empty Secret named after its hash,
+// which istiod may already manage in its namespace. Creating the Secret fails if another replica spent
+// the nonce first, so a nonce is spent once.
+type kubeNonceStore struct {
+	client    kubernetes.Interface
+	namespace string
+	now       func() time.Time
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewKubeNonceStore returns a NonceStore shared by the istiod replicas through the Secrets of namespace.
+func NewKubeNonceStore(client kubernetes.Interface, namespace string) NonceStore {
+	return &kubeNonceStore{client: client, namespace: namespace, now: time.Now}
+}
+
+func nonceSecretName(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return "istio-enrollment-nonce-" + hex.EncodeToString(sum[:16])
+}
+
+func (s *kubeNonceStore) Spent(ctx context.Context, nonce string) (bool, error) {
+	_, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, nonceSecretName(nonce), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *kubeNonceStore) Spend(ctx context.Context, nonce string, expiry time.Time) error {
+	s.prune(ctx)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        nonceSecretName(nonce),
+			Labels:      map[string]string{nonceLabel: "true"},
+			Annotations: map[string]string{nonceExpiryAnnotation: expiry.UTC().Format(time.RFC3339)},
+		},
+		Type: nonceSecretType,
+	}
+	_, err := s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return ErrNonceSpent
+	}
+	return err
+}
+
+// prune deletes the Secrets of the nonces whose tokens have expired, at most every
+// noncePruneInterval. Failures are only logged, as the Secrets are deleted on a later attempt.
+func (s *kubeNonceStore) prune(ctx context.Context) {
+	now := s.now()
+	s.mu.Lock()
+	if now.Sub(s.lastPruned) < noncePruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPruned = now
+	s.mu.Unlock()
+
+	secrets, err := s.client.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: nonceLabel})
+	if err != nil {
+		enrollmentLog.Warnf("failed to list the spent enrollment nonces: %v", err)
+		return
+	}
+	for _, secret := range secrets.Items {
+		expiry, err := time.Parse(time.RFC3339, secret.Annotations[nonceExpiryAnnotation])
+		if err == nil && !now.After(expiry) {
+			continue
+		}
+		if err := s.client.CoreV1().Secrets(s.namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			enrollmentLog.Warnf("failed to delete the spent enrollment nonce %s: %v", secret.Name, err)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"istio.io/api/security/v1beta1"
 	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
 )
 
 const (
@@ -34,6 +35,8 @@ type JwtAuthenticator struct {
 	trustDomain string
 	audiences   []string
 	verifier    *oidc.IDTokenVerifier
+	// acceptJWTSVID is whether the issuer is trusted to issue JWT SVIDs, e.g. as a SPIRE server.
+	acceptJWTSVID bool
 }
 
 var _ security.Authenticator = &JwtAuthenticator{}
@@ -41,7 +44,9 @@ var _ security.Authenticator = &JwtAuthenticator{}
 // newJwtAuthenticator is used when running istiod outside of a cluster, to validate the tokens using OIDC
 // K8S is created with --service-account-issuer, service-account-signing-key-file and service-account-api-audiences
 // which enable OIDC.
-func NewJwtAuthenticator(jwtRule *v1beta1.JWTRule, trustDomain string) (*JwtAuthenticator, error) {
+// If acceptJWTSVID is set, the tokens may also be JWT SVIDs whose subject is the SPIFFE ID of a service
+// account of the trust domain.
+func NewJwtAuthenticator(jwtRule *v1beta1.JWTRule, trustDomain string, acceptJWTSVID bool) (*JwtAuthenticator, error) {
 	issuer := jwtRule.GetIssuer()
 	jwksURL := jwtRule.GetJwksUri()
 	// The key of a JWT issuer may change, so the key may need to be updated.
@@ -62,9 +67,10 @@ func NewJwtAuthenticator(jwtRule *v1beta1.JWTRule, trustDomain string) (*JwtAuth
 		verifier = oidc.NewVerifier(issuer, keySet, &oidc.Config{SkipClientIDCheck: true})
 	}
 	return &JwtAuthenticator{
-		trustDomain: trustDomain,
-		verifier:    verifier,
-		audiences:   jwtRule.Audiences,
+		trustDomain:   trustDomain,
+		verifier:      verifier,
+		audiences:     jwtRule.Audiences,
+		acceptJWTSVID: acceptJWTSVID,
 	}, nil
 }
 
@@ -98,6 +104,12 @@ func (j *JwtAuthenticator) authenticate(ctx context.Context, bearerToken string)
 	if err := idToken.Claims(&sa); err != nil {
 		return nil, fmt.Errorf("failed to extract claims from ID token: %v", err)
 	}
+	if strings.HasPrefix(sa.Sub, spiffe.URIPrefix) {
+		if !j.acceptJWTSVID {
+			return nil, fmt.Errorf("JWT SVIDs of issuer %v are not accepted", sa.Iss)
+		}
+		return j.authenticateJWTSVID(sa)
+	}
 	if !strings.HasPrefix(sa.Sub, "system:serviceaccount") {
 		return nil, fmt.Errorf("invalid sub %v", sa.Sub)
 	}
@@ -114,6 +126,26 @@ func (j *JwtAuthenticator) authenticate(ctx context.Context, bearerToken string)
 	}, nil
 }
 
+// authenticateJWTSVID authenticates a JWT SVID, e.g. issued by SPIRE, whose subject is the SPIFFE ID
+// of the workload. Only the IDs of service accounts, /ns/<ns>/sa/<sa>, of the trust domain of the mesh
+// are accepted, as the callers are authorized for those identities.
+func (j *JwtAuthenticator) authenticateJWTSVID(sa *JwtPayload) (*security.Caller, error) {
+	id, err := spiffe.ParseIdentity(sa.Sub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sub %v: %v", sa.Sub, err)
+	}
+	if id.TrustDomain != j.trustDomain {
+		return nil, fmt.Errorf("sub %v is not in trust domain %v", sa.Sub, j.trustDomain)
+	}
+	if !checkAudience(sa.Aud, j.audiences) {
+		return nil, fmt.Errorf("invalid audiences %v", sa.Aud)
+	}
+	return &security.Caller{
+		AuthSource: security.AuthSourceIDToken,
+		Identities: []string{id.String()},
+	}, nil
+}
+
 // checkAudience() returns true if the audiences to check are in
 // the expected audiences. Otherwise, return false.
 func checkAudience(audToCheck []string, audExpected []string) bool {
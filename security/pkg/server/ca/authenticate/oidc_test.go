@@ -75,7 +75,7 @@ func TestNewJwtAuthenticator(t *testing.T) {
 				t.Fatalf("failed at unmarshal the jwt rule (%v), err: %v",
 					tt.jwtRule, err)
 			}
-			_, err = NewJwtAuthenticator(&jwtRule, "domain-foo")
+			_, err = NewJwtAuthenticator(&jwtRule, "domain-foo", false)
 			gotErr := err != nil
 			if gotErr != tt.expectErr {
 				t.Errorf("expect error is %v while actual error is %v", tt.expectErr, gotErr)
@@ -140,7 +140,11 @@ func TestOIDCAuthenticate(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed at unmarshal jwt rule")
 	}
-	authenticator, err := NewJwtAuthenticator(&jwtRule, "baz.svc.id.goog")
+	authenticator, err := NewJwtAuthenticator(&jwtRule, "baz.svc.id.goog", false)
+	if err != nil {
+		t.Fatalf("failed to create the JWT authenticator: %v", err)
+	}
+	svidAuthenticator, err := NewJwtAuthenticator(&jwtRule, "baz.svc.id.goog", true)
 	if err != nil {
 		t.Fatalf("failed to create the JWT authenticator: %v", err)
 	}
@@ -172,10 +176,28 @@ func TestOIDCAuthenticate(t *testing.T) {
 		t.Fatalf("failed to generate JWT: %v", err)
 	}
 
+	// Create JWT SVIDs, with a SPIFFE ID as subject
+	claimsSVID := `{"iss": "` + server.URL + `", "aud": ["baz.svc.id.goog"], "sub": "spiffe://baz.svc.id.goog/ns/bar/sa/foo", "exp": ` + expStr + `}`
+	tokenSVID, err := generateJWT(&key, []byte(claimsSVID))
+	if err != nil {
+		t.Fatalf("failed to generate JWT: %v", err)
+	}
+	claimsSVIDOtherDomain := `{"iss": "` + server.URL + `", "aud": ["baz.svc.id.goog"], "sub": "spiffe://other.org/ns/bar/sa/foo", "exp": ` + expStr + `}`
+	tokenSVIDOtherDomain, err := generateJWT(&key, []byte(claimsSVIDOtherDomain))
+	if err != nil {
+		t.Fatalf("failed to generate JWT: %v", err)
+	}
+	claimsSVIDOtherPath := `{"iss": "` + server.URL + `", "aud": ["baz.svc.id.goog"], "sub": "spiffe://baz.svc.id.goog/host/vm-1", "exp": ` + expStr + `}`
+	tokenSVIDOtherPath, err := generateJWT(&key, []byte(claimsSVIDOtherPath))
+	if err != nil {
+		t.Fatalf("failed to generate JWT: %v", err)
+	}
+
 	tests := map[string]struct {
-		token      string
-		expectErr  bool
-		expectedID string
+		token         string
+		acceptJWTSVID bool
+		expectErr     bool
+		expectedID    string
 	}{
 		"No bearer token": {
 			expectErr: true,
@@ -197,6 +219,26 @@ func TestOIDCAuthenticate(t *testing.T) {
 			token:     tokenInvalidSubject,
 			expectErr: true,
 		},
+		"JWT SVID": {
+			token:         tokenSVID,
+			acceptJWTSVID: true,
+			expectErr:     false,
+			expectedID:    fmt.Sprintf(IdentityTemplate, "baz.svc.id.goog", "bar", "foo"),
+		},
+		"JWT SVID not accepted": {
+			token:     tokenSVID,
+			expectErr: true,
+		},
+		"JWT SVID of another trust domain": {
+			token:         tokenSVIDOtherDomain,
+			acceptJWTSVID: true,
+			expectErr:     true,
+		},
+		"JWT SVID of another path than a service account": {
+			token:         tokenSVIDOtherPath,
+			acceptJWTSVID: true,
+			expectErr:     true,
+		},
 	}
 
 	for name, tc := range tests {
@@ -209,7 +251,11 @@ func TestOIDCAuthenticate(t *testing.T) {
 			}
 			ctx = metadata.NewIncomingContext(ctx, md)
 
-			actualCaller, err := authenticator.Authenticate(ctx)
+			authn := authenticator
+			if tc.acceptJWTSVID {
+				authn = svidAuthenticator
+			}
+			actualCaller, err := authn.Authenticate(ctx)
 			gotErr := err != nil
 			if gotErr != tc.expectErr {
 				t.Errorf("gotErr (%v) whereas expectErr (%v)", gotErr, tc.expectErr)
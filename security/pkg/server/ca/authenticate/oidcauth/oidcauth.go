@@ -0,0 +1,232 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidcauth authenticates workloads presenting a token of an arbitrary OIDC issuer, such as a
+// CI system or the OIDC provider of a cloud platform, and maps the claims of the token to a mesh
+// identity.
+package oidcauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	OIDCAuthenticatorType = "OIDCAuthenticator"
+
+	// discoveryRetryInterval is the minimum interval between OIDC discovery attempts, so that an
+	// unavailable issuer is not requested for every CSR.
+	discoveryRetryInterval = 10 * time.Second
+	httpTimeout            = 10 * time.Second
+)
+
+var oidcauthLog = log.RegisterScope("oidcauth", "OIDC authenticator", 0)
+
+// Options configures an OIDCAuthenticator.
+type Options struct {
+	TrustDomain string `json:"-"`
+
+	// Issuer is the issuer of the tokens, which must match their iss claim.
+	Issuer string `json:"issuer"`
+	// JwksURI is the URI of the keys of the issuer. If empty, it is discovered from the OIDC
+	// configuration of the issuer.
+	JwksURI string `json:"jwksUri,omitempty"`
+	// Audiences are the audiences accepted, one of which the aud claim of the tokens must contain.
+	Audiences []string `json:"audiences"`
+	// Identities map the claims of the tokens to mesh identities. The first rule matching applies.
+	Identities []IdentityRule `json:"identities"`
+
+	// HTTPClient is the client of the discovery and JWKS requests, a default one if nil.
+	HTTPClient *http.Client `json:"-"`
+}
+
+// IdentityRule grants a mesh identity to the tokens with matching claims.
+type IdentityRule struct {
+	// Claims are the claims the token must all have. A value ending with "*" matches the claim
+	// values with its prefix.
+	Claims map[string]string `json:"claims"`
+	// Identity is the granted identity, of the form "<namespace>/<service account>".
+	Identity string `json:"identity"`
+}
+
+// OIDCAuthenticator validates the OIDC token sent as the bearer token of the CSR request, and maps
+// its claims to a mesh identity.
+type OIDCAuthenticator struct {
+	trustDomain string
+	issuer      string
+	audiences   []string
+	rules       []IdentityRule
+	// ctx carries the HTTP client of the discovery and JWKS requests.
+	ctx context.Context
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+	// lastDiscovery is the time of the last failed discovery.
+	lastDiscovery time.Time
+	discoveryErr  error
+}
+
+var _ security.Authenticator = &OIDCAuthenticator{}
+
+// NewOIDCAuthenticator creates a new OIDCAuthenticator. Discovery is deferred to the first token
+// authenticated, so that an issuer unavailable at startup does not prevent the CA from starting.
+// The keys of the issuer are cached, and refreshed when a token is signed by an unknown key.
+func NewOIDCAuthenticator(opts Options) (*OIDCAuthenticator, error) {
+	if opts.Issuer == "" {
+		return nil, fmt.Errorf("no OIDC issuer is configured")
+	}
+	if len(opts.Audiences) == 0 {
+		return nil, fmt.Errorf("no audience is configured for OIDC issuer %s", opts.Issuer)
+	}
+	if len(opts.Identities) == 0 {
+		return nil, fmt.Errorf("no identity is configured for OIDC issuer %s", opts.Issuer)
+	}
+	for _, rule := range opts.Identities {
+		if len(rule.Claims) == 0 {
+			return nil, fmt.Errorf("identity %q of OIDC issuer %s matches no claim", rule.Identity, opts.Issuer)
+		}
+		if parts := strings.Split(rule.Identity, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid identity %q, expected <namespace>/<service account>", rule.Identity)
+		}
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	a := &OIDCAuthenticator{
+		trustDomain: opts.TrustDomain,
+		issuer:      opts.Issuer,
+		audiences:   opts.Audiences,
+		rules:       opts.Identities,
+		ctx:         oidc.ClientContext(context.Background(), client),
+	}
+	if opts.JwksURI != "" {
+		keySet := oidc.NewRemoteKeySet(a.ctx, opts.JwksURI)
+		a.verifier = oidc.NewVerifier(opts.Issuer, keySet, &oidc.Config{SkipClientIDCheck: true})
+	}
+	return a, nil
+}
+
+func (a *OIDCAuthenticator) AuthenticatorType() string {
+	return OIDCAuthenticatorType
+}
+
+// Authenticate authenticates the OIDC token in the bearer token of the call.
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	token, err := security.ExtractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ID token extraction error: %v", err)
+	}
+	return a.authenticate(ctx, token)
+}
+
+// AuthenticateRequest authenticates the OIDC token in the bearer token of the request.
+func (a *OIDCAuthenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	token, err := security.ExtractRequestToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("ID token extraction error: %v", err)
+	}
+	return a.authenticate(req.Context(), token)
+}
+
+func (a *OIDCAuthenticator) authenticate(ctx context.Context, token string) (*security.Caller, error) {
+	verifier, err := a.getVerifier()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the token of OIDC issuer %s: %v", a.issuer, err)
+	}
+	if !a.checkAudience(idToken.Audience) {
+		return nil, fmt.Errorf("invalid audiences %v", idToken.Audience)
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims from the token: %v", err)
+	}
+	for _, rule := range a.rules {
+		if !matches(rule.Claims, claims) {
+			continue
+		}
+		parts := strings.Split(rule.Identity, "/")
+		oidcauthLog.Debugf("authenticated %s of %s as %s", idToken.Subject, a.issuer, rule.Identity)
+		return &security.Caller{
+			AuthSource: security.AuthSourceIDToken,
+			Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, parts[0], parts[1])},
+		}, nil
+	}
+	return nil, fmt.Errorf("no mesh identity is configured for subject %q of OIDC issuer %s", idToken.Subject, a.issuer)
+}
+
+// getVerifier returns the verifier of the tokens, discovering the keys of the issuer if needed.
+func (a *OIDCAuthenticator) getVerifier() (*oidc.IDTokenVerifier, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.verifier != nil {
+		return a.verifier, nil
+	}
+	if time.Since(a.lastDiscovery) < discoveryRetryInterval {
+		return nil, a.discoveryErr
+	}
+	provider, err := oidc.NewProvider(a.ctx, a.issuer)
+	if err != nil {
+		a.lastDiscovery = time.Now()
+		a.discoveryErr = fmt.Errorf("failed OIDC discovery of %s: %v", a.issuer, err)
+		oidcauthLog.Warn(a.discoveryErr)
+		return nil, a.discoveryErr
+	}
+	a.verifier = provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+	return a.verifier, nil
+}
+
+func (a *OIDCAuthenticator) checkAudience(audiences []string) bool {
+	for _, aud := range audiences {
+		for _, expected := range a.audiences {
+			if aud == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches returns whether claims has all the expected claims.
+func matches(expected map[string]string, claims map[string]interface{}) bool {
+	for name, want := range expected {
+		v, ok := claims[name]
+		if !ok {
+			return false
+		}
+		got := fmt.Sprint(v)
+		if prefix := strings.TrimSuffix(want, "*"); prefix != want {
+			if !strings.HasPrefix(got, prefix) {
+				return false
+			}
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
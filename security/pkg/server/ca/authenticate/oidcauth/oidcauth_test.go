@@ -0,0 +1,183 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidcauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// issuer is an OIDC issuer serving its discovery document and keys.
+type issuer struct {
+	url      string
+	signer   jose.Signer
+	requests map[string]int
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: "key-1", Algorithm: string(jose.RS256), Use: "sig"}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jwk}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{signer: signer, requests: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		iss.requests[r.URL.Path]++
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": iss.url, "jwks_uri": iss.url + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.requests[r.URL.Path]++
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	iss.url = server.URL
+	return iss
+}
+
+func (iss *issuer) token(t *testing.T, claims map[string]interface{}) string {
+	all := map[string]interface{}{"iss": iss.url, "aud": "istio-ca", "sub": "ci", "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		all[k] = v
+	}
+	payload, _ := json.Marshal(all)
+	jws, err := iss.signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewOIDCAuthenticator(t *testing.T) {
+	valid := Options{
+		Issuer:     "https://issuer",
+		Audiences:  []string{"istio-ca"},
+		Identities: []IdentityRule{{Claims: map[string]string{"sub": "ci"}, Identity: "ci/builder"}},
+	}
+	if _, err := NewOIDCAuthenticator(valid); err != nil {
+		t.Fatalf("expected valid options: %v", err)
+	}
+	invalid := []func(o *Options){
+		func(o *Options) { o.Issuer = "" },
+		func(o *Options) { o.Audiences = nil },
+		func(o *Options) { o.Identities = nil },
+		func(o *Options) { o.Identities = []IdentityRule{{Identity: "ci/builder"}} },
+		func(o *Options) {
+			o.Identities = []IdentityRule{{Claims: map[string]string{"sub": "ci"}, Identity: "builder"}}
+		},
+	}
+	for i, modify := range invalid {
+		opts := valid
+		modify(&opts)
+		if _, err := NewOIDCAuthenticator(opts); err == nil {
+			t.Errorf("expected options %d to be invalid", i)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	iss := newIssuer(t)
+	a, err := NewOIDCAuthenticator(Options{
+		TrustDomain: "cluster.local",
+		Issuer:      iss.url,
+		Audiences:   []string{"istio-ca"},
+		Identities: []IdentityRule{
+			{Claims: map[string]string{"repository": "org/app", "ref": "refs/heads/*"}, Identity: "ci/app-builder"},
+			{Claims: map[string]string{"sub": "vm-*"}, Identity: "vms/default"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		token      string
+		expectedID string
+	}{
+		{
+			name:       "first rule",
+			token:      iss.token(t, map[string]interface{}{"repository": "org/app", "ref": "refs/heads/main"}),
+			expectedID: "spiffe://cluster.local/ns/ci/sa/app-builder",
+		},
+		{
+			name:       "second rule",
+			token:      iss.token(t, map[string]interface{}{"sub": "vm-1"}),
+			expectedID: "spiffe://cluster.local/ns/vms/sa/default",
+		},
+		{name: "unmapped claims", token: iss.token(t, map[string]interface{}{"repository": "org/app", "ref": "refs/tags/v1"})},
+		{name: "wrong audience", token: iss.token(t, map[string]interface{}{"sub": "vm-1", "aud": "other"})},
+		{name: "wrong issuer", token: iss.token(t, map[string]interface{}{"sub": "vm-1", "iss": "https://other"})},
+		{name: "expired", token: iss.token(t, map[string]interface{}{"sub": "vm-1", "exp": time.Now().Add(-time.Hour).Unix()})},
+		{name: "invalid", token: "not-a-token"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+c.token))
+			caller, err := a.Authenticate(ctx)
+			if c.expectedID == "" {
+				if err == nil {
+					t.Fatalf("expected authentication to fail, got %+v", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(caller.Identities) != 1 || caller.Identities[0] != c.expectedID {
+				t.Fatalf("got identities %v, expected %s", caller.Identities, c.expectedID)
+			}
+		})
+	}
+	// The discovery document and the keys are fetched once.
+	if iss.requests["/.well-known/openid-configuration"] != 1 || iss.requests["/keys"] != 1 {
+		t.Errorf("expected discovery and keys to be cached, got requests %v", iss.requests)
+	}
+}
+
+func TestDiscoveryRetry(t *testing.T) {
+	a, err := NewOIDCAuthenticator(Options{
+		Issuer:     "http://127.0.0.1:1",
+		Audiences:  []string{"istio-ca"},
+		Identities: []IdentityRule{{Claims: map[string]string{"sub": "ci"}, Identity: "ci/builder"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.getVerifier(); err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+	first := a.lastDiscovery
+	if _, err := a.getVerifier(); err == nil || a.lastDiscovery != first {
+		t.Fatalf("expected the failed discovery not to be retried within %v", discoveryRetryInterval)
+	}
+}
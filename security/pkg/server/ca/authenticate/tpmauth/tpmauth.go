@@ -0,0 +1,232 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpmauth authenticates VMs with a TPM2 quote over the key of their CSR, signed by an
+// attestation key (AK) resident in the TPM of the VM.
+package tpmauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/pkg/server/ca/authenticate"
+	"istio.io/pkg/log"
+)
+
+const (
+	TPMAuthenticatorType = "TPMAuthenticator"
+
+	// tpmGeneratedValue is the magic prefix of every structure produced by the TPM itself. A
+	// restricted AK refuses to sign external data starting with it, so the quote can't be forged
+	// with the AK through TPM2_Sign.
+	tpmGeneratedValue = 0xff544347
+	// tpmSTAttestQuote is the TPMS_ATTEST type of TPM2_Quote.
+	tpmSTAttestQuote = 0x8018
+)
+
+var tpmauthLog = log.RegisterScope("tpmauth", "TPM attestation authenticator", 0)
+
+// TPMAuthenticator verifies TPM attestations sent in the KeyAttestationMeta metadata or, if csrOID
+// is set, in the CSR extension with that OID.
+//
+// The AK is trusted either because its certificate chains to one of roots, or because its public
+// key is in the allow-list. identities maps the AK to a mesh identity, by "sha256:<hex digest of
+// the AK SubjectPublicKeyInfo>" for allow-listed keys, or by "cn:<AK certificate common name>"
+// for certified keys. Values have the form "<namespace>/<service account>".
+type TPMAuthenticator struct {
+	trustDomain string
+	roots       *x509.CertPool
+	identities  map[string]string
+	csrOID      asn1.ObjectIdentifier
+}
+
+var (
+	_ security.Authenticator    = &TPMAuthenticator{}
+	_ security.CSRAuthenticator = &TPMAuthenticator{}
+)
+
+// NewTPMAuthenticator creates a new TPMAuthenticator. roots may be nil if only allow-listed AKs are
+// used, and csrOID nil if attestations are only accepted in the gRPC metadata.
+func NewTPMAuthenticator(trustDomain string, roots *x509.CertPool, identities map[string]string,
+	csrOID asn1.ObjectIdentifier) (*TPMAuthenticator, error) {
+	for k, v := range identities {
+		if !strings.HasPrefix(k, "sha256:") && !strings.HasPrefix(k, "cn:") {
+			return nil, fmt.Errorf("invalid attestation key %q, expected sha256:<digest> or cn:<common name>", k)
+		}
+		if len(strings.Split(v, "/")) != 2 {
+			return nil, fmt.Errorf("invalid identity %q for %q, expected <namespace>/<service account>", v, k)
+		}
+	}
+	return &TPMAuthenticator{trustDomain: trustDomain, roots: roots, identities: identities, csrOID: csrOID}, nil
+}
+
+func (a *TPMAuthenticator) AuthenticatorType() string {
+	return TPMAuthenticatorType
+}
+
+// Authenticate verifies the TPM attestation of the call. The returned caller may only get a
+// certificate for the attested key.
+func (a *TPMAuthenticator) Authenticate(ctx context.Context) (*security.Caller, error) {
+	encoded, err := security.ExtractKeyAttestation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := security.ParseTPMAttestation(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return a.authenticate(attestation)
+}
+
+// AuthenticateCSR verifies the TPM attestation carried by the key attestation extension of csr.
+func (a *TPMAuthenticator) AuthenticateCSR(csr *x509.CertificateRequest) (*security.Caller, error) {
+	if a.csrOID == nil {
+		return nil, fmt.Errorf("TPM attestations in CSRs are not enabled")
+	}
+	encoded, err := util.KeyAttestationFromCSR(csr, a.csrOID)
+	if err != nil {
+		return nil, err
+	}
+	if encoded == nil {
+		return nil, fmt.Errorf("no TPM attestation in the CSR")
+	}
+	attestation, err := security.ParseTPMAttestation(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	return a.authenticate(attestation)
+}
+
+// AuthenticateRequest is not supported: attestations only bind CSRs, which are sent over gRPC.
+func (a *TPMAuthenticator) AuthenticateRequest(_ *http.Request) (*security.Caller, error) {
+	return nil, fmt.Errorf("TPM attestation is only supported for certificate requests")
+}
+
+func (a *TPMAuthenticator) authenticate(attestation *security.TPMAttestation) (*security.Caller, error) {
+	ak, err := x509.ParseCertificate(attestation.AKCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AK certificate: %v", err)
+	}
+	id, err := a.identity(ak)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(ak.PublicKey, attestation.Attest, attestation.Signature); err != nil {
+		return nil, err
+	}
+	keyDigest, err := parseQuote(attestation.Attest)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyDigest) != sha256.Size {
+		return nil, fmt.Errorf("TPM quote qualifying data is not a key digest")
+	}
+	parts := strings.Split(id, "/")
+	tpmauthLog.Debugf("TPM attestation of %s accepted for %s", ak.Subject, id)
+	return &security.Caller{
+		AuthSource: security.AuthSourceKeyAttestation,
+		Identities: []string{fmt.Sprintf(authenticate.IdentityTemplate, a.trustDomain, parts[0], parts[1])},
+		KeyDigest:  keyDigest,
+	}, nil
+}
+
+// identity returns the mesh identity of a trusted AK.
+func (a *TPMAuthenticator) identity(ak *x509.Certificate) (string, error) {
+	digest := sha256.Sum256(ak.RawSubjectPublicKeyInfo)
+	if id, ok := a.identities["sha256:"+hex.EncodeToString(digest[:])]; ok {
+		return id, nil
+	}
+	if a.roots == nil {
+		return "", fmt.Errorf("AK is not in the allow-list")
+	}
+	if _, err := ak.Verify(x509.VerifyOptions{Roots: a.roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return "", fmt.Errorf("AK is neither in the allow-list nor certified by a trusted CA: %v", err)
+	}
+	if id, ok := a.identities["cn:"+ak.Subject.CommonName]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("no mesh identity is configured for AK %q", ak.Subject.CommonName)
+}
+
+func verifySignature(pub crypto.PublicKey, attest, sig []byte) error {
+	digest := sha256.Sum256(attest)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("invalid TPM quote signature: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return fmt.Errorf("invalid TPM quote signature")
+		}
+	default:
+		return fmt.Errorf("unsupported AK type %T", pub)
+	}
+	return nil
+}
+
+// parseQuote checks that attest is a TPMS_ATTEST produced by TPM2_Quote and returns its qualifying
+// data (extraData).
+func parseQuote(attest []byte) ([]byte, error) {
+	r := bytes.NewReader(attest)
+	var header struct {
+		Magic uint32
+		Type  uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse TPM quote: %v", err)
+	}
+	if header.Magic != tpmGeneratedValue {
+		return nil, fmt.Errorf("TPM quote was not generated by a TPM")
+	}
+	if header.Type != tpmSTAttestQuote {
+		return nil, fmt.Errorf("unexpected TPMS_ATTEST type %#x", header.Type)
+	}
+	// qualifiedSigner is skipped, extraData is returned.
+	if _, err := readSized(r); err != nil {
+		return nil, fmt.Errorf("failed to parse TPM quote signer: %v", err)
+	}
+	extraData, err := readSized(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TPM quote qualifying data: %v", err)
+	}
+	return extraData, nil
+}
+
+// readSized reads a TPM2B structure: a big endian uint16 size followed by the data.
+func readSized(r *bytes.Reader) ([]byte, error) {
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if int(size) > r.Len() {
+		return nil, fmt.Errorf("size %d exceeds remaining %d bytes", size, r.Len())
+	}
+	b := make([]byte, size)
+	_, err := r.Read(b)
+	return b, err
+}
@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func newCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: cn},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: isCA, BasicConstraintsValid: isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// quote builds a TPMS_ATTEST of a TPM2_Quote over extraData, signed by key.
+func quote(t *testing.T, magic uint32, extraData []byte, ak *x509.Certificate, key *rsa.PrivateKey) *security.TPMAttestation {
+	t.Helper()
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, magic)
+	_ = binary.Write(&b, binary.BigEndian, uint16(tpmSTAttestQuote))
+	signer := []byte("ak-name")
+	_ = binary.Write(&b, binary.BigEndian, uint16(len(signer)))
+	b.Write(signer)
+	_ = binary.Write(&b, binary.BigEndian, uint16(len(extraData)))
+	b.Write(extraData)
+	// clockInfo, firmwareVersion and the quote body are not inspected.
+	b.Write(make([]byte, 32))
+	digest := sha256.Sum256(b.Bytes())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &security.TPMAttestation{AKCertificate: ak.Raw, Attest: b.Bytes(), Signature: sig}
+}
+
+func TestTPMAuthenticator(t *testing.T) {
+	root, rootKey := newCert(t, "attestation-ca", true, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	certifiedAK, certifiedKey := newCert(t, "vm-1", false, root, rootKey)
+	allowedAK, allowedKey := newCert(t, "self-signed", false, nil, nil)
+	unknownAK, unknownKey := newCert(t, "unknown", false, nil, nil)
+	allowedDigest := sha256.Sum256(allowedAK.RawSubjectPublicKeyInfo)
+
+	a, err := NewTPMAuthenticator("cluster.local", roots, map[string]string{
+		"cn:vm-1": "vm/certified",
+		"sha256:" + hex.EncodeToString(allowedDigest[:]): "vm/allowed",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDigest := sha256.Sum256([]byte("csr key"))
+
+	cases := []struct {
+		name       string
+		att        *security.TPMAttestation
+		expectedID string
+	}{
+		{
+			name:       "certified AK",
+			att:        quote(t, tpmGeneratedValue, keyDigest[:], certifiedAK, certifiedKey),
+			expectedID: "spiffe://cluster.local/ns/vm/sa/certified",
+		},
+		{
+			name:       "allow-listed AK",
+			att:        quote(t, tpmGeneratedValue, keyDigest[:], allowedAK, allowedKey),
+			expectedID: "spiffe://cluster.local/ns/vm/sa/allowed",
+		},
+		{
+			name: "unknown AK",
+			att:  quote(t, tpmGeneratedValue, keyDigest[:], unknownAK, unknownKey),
+		},
+		{
+			name: "signed by another key",
+			att:  quote(t, tpmGeneratedValue, keyDigest[:], allowedAK, unknownKey),
+		},
+		{
+			name: "not generated by a TPM",
+			att:  quote(t, 0, keyDigest[:], allowedAK, allowedKey),
+		},
+		{
+			name: "qualifying data is not a digest",
+			att:  quote(t, tpmGeneratedValue, []byte("nonce"), allowedAK, allowedKey),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			encoded, err := c.att.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(security.KeyAttestationMeta, encoded))
+			caller, err := a.Authenticate(ctx)
+			if c.expectedID == "" {
+				if err == nil {
+					t.Fatalf("expected error, got caller %+v", caller)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(caller.Identities, []string{c.expectedID}) {
+				t.Errorf("got identities %v, expected %s", caller.Identities, c.expectedID)
+			}
+			if !bytes.Equal(caller.KeyDigest, keyDigest[:]) {
+				t.Errorf("caller is not bound to the attested key")
+			}
+		})
+	}
+}
+
+func TestTPMAuthenticatorCSR(t *testing.T) {
+	ak, akKey := newCert(t, "self-signed", false, nil, nil)
+	akDigest := sha256.Sum256(ak.RawSubjectPublicKeyInfo)
+	oid := asn1.ObjectIdentifier{1, 2, 3, 4}
+	a, err := NewTPMAuthenticator("cluster.local", nil, map[string]string{
+		"sha256:" + hex.EncodeToString(akDigest[:]): "vm/allowed",
+	}, oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, _, err := util.GenCSR(util.CertOptions{
+		Host:              "spiffe://cluster.local/ns/vm/sa/allowed",
+		RSAKeySize:        2048,
+		KeyAttestationOID: oid,
+		KeyAttestation: func(keyDigest []byte) ([]byte, error) {
+			encoded, err := quote(t, tpmGeneratedValue, keyDigest, ak, akKey).Encode()
+			return []byte(encoded), err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller, err := a.AuthenticateCSR(csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(caller.Identities, []string{"spiffe://cluster.local/ns/vm/sa/allowed"}) {
+		t.Errorf("unexpected identities %v", caller.Identities)
+	}
+	if keyDigest := sha256.Sum256(csr.RawSubjectPublicKeyInfo); !bytes.Equal(caller.KeyDigest, keyDigest[:]) {
+		t.Errorf("caller is not bound to the key of the CSR")
+	}
+
+	plainPEM, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/vm/sa/allowed", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := util.ParsePemEncodedCSR(plainPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AuthenticateCSR(plain); err == nil {
+		t.Error("expected a CSR without attestation to be rejected")
+	}
+}
+
+func TestNewTPMAuthenticator(t *testing.T) {
+	for _, ids := range []map[string]string{{"vm-1": "ns/sa"}, {"cn:vm-1": "sa"}} {
+		if _, err := NewTPMAuthenticator("cluster.local", nil, ids, nil); err == nil {
+			t.Errorf("expected error for identities %v", ids)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/proto/jwtsvid"
+)
+
+const (
+	// DefaultJWTSVIDTTL is the lifetime of the JWT SVIDs requested without one.
+	DefaultJWTSVIDTTL = 5 * time.Minute
+	// MaxJWTSVIDTTL bounds the lifetime of the JWT SVIDs, which cannot be revoked.
+	MaxJWTSVIDTTL = time.Hour
+)
+
+// jwtSVIDServer serves the JWT SVIDs of the CA Server.
+type jwtSVIDServer struct {
+	jwtsvid.UnimplementedJWTSVIDServiceServer
+	s *Server
+}
+
+// SignJWTSVID returns a JWT SVID for the SPIFFE ID of the caller, authenticated and authorized like for
+// a certificate. The token is signed with the CA key, identified by the RFC 7638 thumbprint of the CA
+// certificate key, and carries the CA certificate chain in its x5c header, so that it can be verified
+// with the JWKS of the mesh roots exported by the agents.
+func (j *jwtSVIDServer) SignJWTSVID(ctx context.Context, request *jwtsvid.SignJWTSVIDRequest) (*jwtsvid.SignJWTSVIDResponse, error) {
+	s := j.s
+	if request.Audience == "" {
+		return nil, status.Error(codes.InvalidArgument, "audience is required")
+	}
+	ttl := time.Duration(request.ValidityDuration) * time.Second
+	switch {
+	case ttl < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid validity duration %v", ttl)
+	case ttl == 0:
+		ttl = DefaultJWTSVIDTTL
+	case ttl > MaxJWTSVIDTTL:
+		ttl = MaxJWTSVIDTTL
+	}
+	caller := authenticateCall(ctx, security.NewMultiAuthenticator(s.AuthenticationMode, s.Authenticators...))
+	if caller == nil {
+		s.monitoring.AuthnError.Increment()
+		return nil, status.Error(codes.Unauthenticated, "request authenticate failure")
+	}
+	var subject string
+	for _, id := range caller.Identities {
+		if _, err := spiffe.ParseIdentity(id); err == nil {
+			subject = id
+			break
+		}
+	}
+	if subject == "" {
+		s.monitoring.AuthnError.Increment()
+		return nil, status.Errorf(codes.Unauthenticated, "caller %v has no SPIFFE identity", caller.Identities)
+	}
+	if s.Authorizer != nil {
+		resource := security.Resource{Type: security.ResourceJWTSVID, Identities: []string{subject}, Name: request.Audience}
+		if err := s.Authorizer.Authorize(ctx, caller, resource); err != nil {
+			serverCaLog.Warnf("JWT SVID for %v is not authorized: %v", subject, err)
+			s.monitoring.AuthzError.Increment()
+			return nil, status.Errorf(codes.PermissionDenied, "request authorize failure: %v", err)
+		}
+	}
+
+	token, err := signJWTSVID(s.ca.GetCAKeyCertBundle(), subject, request.Audience, time.Now(), ttl)
+	if err != nil {
+		serverCaLog.Errorf("JWT SVID signing error (%v)", err)
+		return nil, err
+	}
+	if caller.Redeem != nil {
+		if err := caller.Redeem(ctx); err != nil {
+			s.monitoring.AuthnError.Increment()
+			return nil, status.Errorf(codes.Unauthenticated, "request authenticate failure: %v", err)
+		}
+	}
+	serverCaLog.Debugf("JWT SVID for %v and audience %q successfully signed.", subject, request.Audience)
+	return &jwtsvid.SignJWTSVIDResponse{Token: token}, nil
+}
+
+// signJWTSVID signs a JWT SVID of subject for audience with the key of bundle.
+func signJWTSVID(bundle *util.KeyCertBundle, subject, audience string, now time.Time, ttl time.Duration) (string, error) {
+	cert, key, certChainBytes, _ := bundle.GetAll()
+	if cert == nil || key == nil {
+		// Only the CAs signing with a local key, rather than an external signer, issue JWT SVIDs.
+		return "", status.Error(codes.Unimplemented, security.ErrJWTSVIDNotSupported.Error())
+	}
+	alg, err := jwtSVIDAlgorithm(*key)
+	if err != nil {
+		return "", status.Error(codes.Unimplemented, err.Error())
+	}
+	chain := []*x509.Certificate{cert}
+	if len(certChainBytes) != 0 {
+		intermediates, err := util.ParsePemEncodedCertificateChain(certChainBytes)
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "invalid CA certificate chain: %v", err)
+		}
+		chain = append(chain, intermediates...)
+	}
+	x5c := make([]string, 0, len(chain))
+	for _, c := range chain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	thumbprint, err := (&jose.JSONWebKey{Key: cert.PublicKey}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to identify the CA key: %v", err)
+	}
+	opts := (&jose.SignerOptions{}).WithType("JWT").
+		WithHeader(jose.HeaderKey("kid"), base64.RawURLEncoding.EncodeToString(thumbprint)).
+		WithHeader(jose.HeaderKey("x5c"), x5c)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: *key}, opts)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to create JWT signer: %v", err)
+	}
+	claims := jwt.Claims{
+		Subject:  subject,
+		Audience: jwt.Audience{audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(ttl)),
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to sign JWT SVID: %v", err)
+	}
+	return token, nil
+}
+
+// jwtSVIDAlgorithm returns the JWS algorithm of the CA key, the one of the agents' JWKS for ECDSA and
+// RSA keys.
+func jwtSVIDAlgorithm(key crypto.PrivateKey) (jose.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 384:
+			return jose.ES384, nil
+		case 521:
+			return jose.ES512, nil
+		default:
+			return jose.ES256, nil
+		}
+	case ed25519.PrivateKey:
+		return jose.EdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported CA key type %T for JWT SVIDs", key)
+	}
+}
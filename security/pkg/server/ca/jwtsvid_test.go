@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/pkg/security"
+	mockca "istio.io/istio/security/pkg/pki/ca/mock"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/proto/jwtsvid"
+)
+
+func TestSignJWTSVID(t *testing.T) {
+	certPem, keyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Org:          "cluster.local",
+		TTL:          time.Hour,
+		IsCA:         true,
+		IsSelfSigned: true,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(certPem, keyPem, nil, certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := "spiffe://cluster.local/ns/apps/sa/app"
+	authorizer := security.AuthorizerFunc(func(_ context.Context, _ *security.Caller, resource security.Resource) error {
+		if resource.Type != security.ResourceJWTSVID || resource.Name == "forbidden" {
+			return fmt.Errorf("%v for %v is not allowed", resource.Type, resource.Name)
+		}
+		return nil
+	})
+	testCases := map[string]struct {
+		authenticator *mockAuthenticator
+		bundle        *util.KeyCertBundle
+		audience      string
+		code          codes.Code
+	}{
+		"Signed":             {authenticator: &mockAuthenticator{identities: []string{"vm.example.com", id}}, audience: "aud", code: codes.OK},
+		"No audience":        {authenticator: &mockAuthenticator{identities: []string{id}}, code: codes.InvalidArgument},
+		"Unauthenticated":    {authenticator: &mockAuthenticator{errMsg: "not authorized"}, audience: "aud", code: codes.Unauthenticated},
+		"No SPIFFE identity": {authenticator: &mockAuthenticator{identities: []string{"vm.example.com"}}, audience: "aud", code: codes.Unauthenticated},
+		"Unauthorized":       {authenticator: &mockAuthenticator{identities: []string{id}}, audience: "forbidden", code: codes.PermissionDenied},
+		"No CA key": {
+			authenticator: &mockAuthenticator{identities: []string{id}},
+			bundle:        util.NewKeyCertBundleFromPem(nil, nil, nil, certPem),
+			audience:      "aud",
+			code:          codes.Unimplemented,
+		},
+	}
+	for name, c := range testCases {
+		t.Run(name, func(t *testing.T) {
+			caBundle := bundle
+			if c.bundle != nil {
+				caBundle = c.bundle
+			}
+			server := &jwtSVIDServer{s: &Server{
+				ca:             &mockca.FakeCA{KeyCertBundle: caBundle},
+				Authenticators: []security.Authenticator{c.authenticator},
+				Authorizer:     authorizer,
+				monitoring:     newMonitoringMetrics(),
+			}}
+			resp, err := server.SignJWTSVID(context.Background(), &jwtsvid.SignJWTSVIDRequest{Audience: c.audience})
+			if code := status.Code(err); code != c.code {
+				t.Fatalf("expecting code to be (%d) but got (%d): %v", c.code, code, err)
+			}
+			if c.code != codes.OK {
+				return
+			}
+
+			token, err := jwt.ParseSigned(resp.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, _, _, _ := bundle.GetAll()
+			thumbprint, _ := (&jose.JSONWebKey{Key: cert.PublicKey}).Thumbprint(crypto.SHA256)
+			header := token.Headers[0]
+			if kid := base64.RawURLEncoding.EncodeToString(thumbprint); header.KeyID != kid {
+				t.Errorf("got kid %q, expected %q", header.KeyID, kid)
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(cert)
+			if chain, err := header.Certificates(x509.VerifyOptions{Roots: roots}); err != nil || len(chain) == 0 {
+				t.Errorf("x5c does not chain to the root: %v", err)
+			}
+			claims := jwt.Claims{}
+			if err := token.Claims(cert.PublicKey, &claims); err != nil {
+				t.Fatalf("token not signed by the CA key: %v", err)
+			}
+			if err := claims.Validate(jwt.Expected{Subject: id, Audience: jwt.Audience{"aud"}, Time: time.Now()}); err != nil {
+				t.Error(err)
+			}
+			if ttl := claims.Expiry.Time().Sub(claims.IssuedAt.Time()); ttl != DefaultJWTSVIDTTL {
+				t.Errorf("got lifetime %v, expected %v", ttl, DefaultJWTSVIDTTL)
+			}
+		})
+	}
+}
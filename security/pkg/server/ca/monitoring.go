@@ -35,6 +35,11 @@ var (
 		"The number of authentication failures.",
 	)
 
+	authzErrorCounts = monitoring.NewSum(
+		"citadel_server_authorization_failure_count",
+		"The number of authorization failures.",
+	)
+
 	csrParsingErrorCounts = monitoring.NewSum(
 		"citadel_server_csr_parsing_err_count",
 		"The number of errors occurred when parsing the CSR.",
@@ -72,6 +77,7 @@ func init() {
 	monitoring.MustRegister(
 		csrCounts,
 		authnErrorCounts,
+		authzErrorCounts,
 		csrParsingErrorCounts,
 		idExtractionErrorCounts,
 		certSignErrorCounts,
@@ -85,6 +91,7 @@ func init() {
 type monitoringMetrics struct {
 	CSR               monitoring.Metric
 	AuthnError        monitoring.Metric
+	AuthzError        monitoring.Metric
 	Success           monitoring.Metric
 	CSRError          monitoring.Metric
 	IDExtractionError monitoring.Metric
@@ -96,6 +103,7 @@ func newMonitoringMetrics() monitoringMetrics {
 	return monitoringMetrics{
 		CSR:               csrCounts,
 		AuthnError:        authnErrorCounts,
+		AuthzError:        authzErrorCounts,
 		Success:           successCounts,
 		CSRError:          csrParsingErrorCounts,
 		IDExtractionError: idExtractionErrorCounts,
@@ -15,7 +15,8 @@
 package ca
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"crypto/subtle"
 	"time"
 
 	"golang.org/x/net/context"
@@ -29,6 +30,7 @@ import (
 	"istio.io/istio/security/pkg/pki/ca"
 	caerror "istio.io/istio/security/pkg/pki/error"
 	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/proto/jwtsvid"
 	"istio.io/pkg/log"
 )
 
@@ -49,8 +51,13 @@ type CertificateAuthority interface {
 type Server struct {
 	monitoring     monitoringMetrics
 	Authenticators []security.Authenticator
-	ca             CertificateAuthority
-	serverCertTTL  time.Duration
+	// AuthenticationMode is how the results of the Authenticators are combined, first-success if empty.
+	AuthenticationMode security.AuthenticationMode
+	ca                 CertificateAuthority
+	serverCertTTL      time.Duration
+
+	// Authorizer, if set, must authorize the identities of the certificate issued to the caller.
+	Authorizer security.Authorizer
 }
 
 func getConnectionAddress(ctx context.Context) string {
@@ -71,13 +78,36 @@ func getConnectionAddress(ctx context.Context) string {
 func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertificateRequest) (
 	*pb.IstioCertificateResponse, error) {
 	s.monitoring.CSR.Increment()
-	caller := Authenticate(ctx, s.Authenticators)
+	authn := security.NewMultiAuthenticator(s.AuthenticationMode, s.Authenticators...)
+	caller := authenticateCall(ctx, authn)
+	// The evidence of the CSR is an alternative to that of the call, which all-required does not allow.
+	if caller == nil && s.AuthenticationMode != security.AuthenticationAllRequired {
+		caller = authenticateCSR(request.Csr, authn)
+	}
 	if caller == nil {
 		s.monitoring.AuthnError.Increment()
 		return nil, status.Error(codes.Unauthenticated, "request authenticate failure")
 	}
+	if caller.KeyDigest != nil {
+		// The caller was authenticated for a specific key, e.g. one attested by a TPM.
+		csr, err := util.ParsePemEncodedCSR([]byte(request.Csr))
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid CSR (%v)", err)
+		}
+		if digest := sha256.Sum256(csr.RawSubjectPublicKeyInfo); subtle.ConstantTimeCompare(digest[:], caller.KeyDigest) != 1 {
+			s.monitoring.AuthnError.Increment()
+			return nil, status.Error(codes.Unauthenticated, "CSR key does not match the attested key")
+		}
+	}
 
-	// TODO: Call authorizer.
+	if s.Authorizer != nil {
+		resource := security.Resource{Type: security.ResourceCertificate, Identities: caller.Identities}
+		if err := s.Authorizer.Authorize(ctx, caller, resource); err != nil {
+			serverCaLog.Warnf("CSR for %v is not authorized: %v", caller.Identities, err)
+			s.monitoring.AuthzError.Increment()
+			return nil, status.Errorf(codes.PermissionDenied, "request authorize failure: %v", err)
+		}
+	}
 	crMetadata := request.Metadata.GetFields()
 	certSigner := crMetadata[security.CertSigner].GetStringValue()
 	log.Debugf("cert signer from workload %s", certSigner)
@@ -113,6 +143,15 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 		rootCertBytes = rootCert
 	}
 	respCertChain = append(respCertChain, string(rootCertBytes))
+	if caller.Redeem != nil {
+		// Single-use credentials are only spent once the certificate is issued, so a failed signing
+		// can be retried with the same credential.
+		if err := caller.Redeem(ctx); err != nil {
+			serverCaLog.Warnf("failed to redeem the credential of %v: %v", caller.Identities, err)
+			s.monitoring.AuthnError.Increment()
+			return nil, status.Errorf(codes.Unauthenticated, "request authenticate failure: %v", err)
+		}
+	}
 	response := &pb.IstioCertificateResponse{
 		CertChain: respCertChain,
 	}
@@ -142,6 +181,7 @@ func recordCertsExpiry(keyCertBundle *util.KeyCertBundle) {
 // Register registers a GRPC server on the specified port.
 func (s *Server) Register(grpcServer *grpc.Server) {
 	pb.RegisterIstioCertificateServiceServer(grpcServer, s)
+	jwtsvid.RegisterJWTSVIDServiceServer(grpcServer, &jwtSVIDServer{s: s})
 }
 
 // New creates a new instance of `IstioCAServiceServer`
@@ -160,21 +200,35 @@ func New(ca CertificateAuthority, ttl time.Duration,
 	return server, nil
 }
 
-// authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
+// Authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
 // and authenticates if one of them is valid.
 func Authenticate(ctx context.Context, auth []security.Authenticator) *security.Caller {
-	// TODO: apply different authenticators in specific order / according to configuration.
-	var errMsg string
-	for id, authn := range auth {
-		u, err := authn.Authenticate(ctx)
-		if err != nil {
-			errMsg += fmt.Sprintf("Authenticator %s at index %d got error: %v. ", authn.AuthenticatorType(), id, err)
-		}
-		if u != nil && err == nil {
-			serverCaLog.Debugf("Authentication successful through auth source %v", u.AuthSource)
-			return u
-		}
+	return authenticateCall(ctx, security.NewMultiAuthenticator(security.AuthenticationFirstSuccess, auth...))
+}
+
+// authenticateCall authenticates the caller of the call with authn, or returns nil.
+func authenticateCall(ctx context.Context, authn *security.MultiAuthenticator) *security.Caller {
+	u, err := authn.Authenticate(ctx)
+	if err != nil {
+		serverCaLog.Warnf("Authentication failed for %v: %v", getConnectionAddress(ctx), err)
+		return nil
+	}
+	serverCaLog.Debugf("Authentication successful through auth source %v", u.AuthSource)
+	return u
+}
+
+// authenticateCSR authenticates a certificate request with the evidence carried by its CSR, for
+// authenticators implementing security.CSRAuthenticator. The caller is bound to the key of the CSR.
+func authenticateCSR(csrPEM string, authn *security.MultiAuthenticator) *security.Caller {
+	csr, err := util.ParsePemEncodedCSR([]byte(csrPEM))
+	if err != nil {
+		return nil
+	}
+	u, err := authn.AuthenticateCSR(csr)
+	if err != nil {
+		serverCaLog.Debugf("Authentication through the CSR failed: %v", err)
+		return nil
 	}
-	serverCaLog.Warnf("Authentication failed for %v: %s", getConnectionAddress(ctx), errMsg)
-	return nil
+	serverCaLog.Debugf("Authentication successful through the CSR with auth source %v", u.AuthSource)
+	return u
 }
@@ -15,6 +15,7 @@
 package ca
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -41,6 +42,8 @@ import (
 type mockAuthenticator struct {
 	authSource security.AuthSource
 	identities []string
+	keyDigest  []byte
+	redeem     func(ctx context.Context) error
 	errMsg     string
 }
 
@@ -56,6 +59,8 @@ func (authn *mockAuthenticator) Authenticate(ctx context.Context) (*security.Cal
 	return &security.Caller{
 		AuthSource: authn.authSource,
 		Identities: authn.identities,
+		KeyDigest:  authn.keyDigest,
+		Redeem:     authn.redeem,
 	}, nil
 }
 
@@ -263,3 +268,111 @@ func TestCreateCertificate(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateCertificateKeyDigest(t *testing.T) {
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/vm/sa/vm", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(csr.RawSubjectPublicKeyInfo)
+
+	testCases := map[string]struct {
+		keyDigest []byte
+		csr       string
+		code      codes.Code
+	}{
+		"Attested key": {keyDigest: digest[:], csr: string(csrPEM), code: codes.OK},
+		"Other key":    {keyDigest: make([]byte, sha256.Size), csr: string(csrPEM), code: codes.Unauthenticated},
+		"Invalid CSR":  {keyDigest: digest[:], csr: "dumb CSR", code: codes.InvalidArgument},
+	}
+	for id, c := range testCases {
+		server := &Server{
+			ca: &mockca.FakeCA{
+				SignedCert:    []byte("cert"),
+				KeyCertBundle: util.NewKeyCertBundleFromPem(nil, nil, []byte("cert_chain"), []byte("root_cert")),
+			},
+			Authenticators: []security.Authenticator{&mockAuthenticator{keyDigest: c.keyDigest}},
+			monitoring:     newMonitoringMetrics(),
+		}
+		_, err := server.CreateCertificate(context.Background(), &pb.IstioCertificateRequest{Csr: c.csr})
+		if code := status.Code(err); code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d): %v", id, c.code, code, err)
+		}
+	}
+}
+
+func TestCreateCertificateRedeem(t *testing.T) {
+	testCases := map[string]struct {
+		signErr   *caerror.Error
+		redeemErr error
+		code      codes.Code
+		redeemed  bool
+	}{
+		"Redeemed":        {code: codes.OK, redeemed: true},
+		"Signing failure": {signErr: caerror.NewError(caerror.CANotReady, fmt.Errorf("cannot sign")), code: codes.Internal},
+		"Redeem failure":  {redeemErr: errors.New("already used"), code: codes.Unauthenticated, redeemed: true},
+	}
+	for id, c := range testCases {
+		redeemed := false
+		server := &Server{
+			ca: &mockca.FakeCA{
+				SignedCert:    []byte("cert"),
+				SignErr:       c.signErr,
+				KeyCertBundle: util.NewKeyCertBundleFromPem(nil, nil, []byte("cert_chain"), []byte("root_cert")),
+			},
+			Authenticators: []security.Authenticator{&mockAuthenticator{redeem: func(context.Context) error {
+				redeemed = true
+				return c.redeemErr
+			}}},
+			monitoring: newMonitoringMetrics(),
+		}
+		_, err := server.CreateCertificate(context.Background(), &pb.IstioCertificateRequest{Csr: "dumb CSR"})
+		if code := status.Code(err); code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d): %v", id, c.code, code, err)
+		}
+		if redeemed != c.redeemed {
+			t.Errorf("Case %s: got redeemed %v, expected %v", id, redeemed, c.redeemed)
+		}
+	}
+}
+
+func TestCreateCertificateAuthorizer(t *testing.T) {
+	allowed := "spiffe://cluster.local/ns/apps/sa/app"
+	authorizer := security.AuthorizerFunc(func(_ context.Context, caller *security.Caller, resource security.Resource) error {
+		if resource.Type != security.ResourceCertificate {
+			return fmt.Errorf("unexpected resource type %v", resource.Type)
+		}
+		for _, id := range resource.Identities {
+			if id != allowed {
+				return fmt.Errorf("identity %v is not allowed", id)
+			}
+		}
+		return nil
+	})
+	testCases := map[string]struct {
+		identities []string
+		code       codes.Code
+	}{
+		"Authorized":   {identities: []string{allowed}, code: codes.OK},
+		"Unauthorized": {identities: []string{allowed, "spiffe://cluster.local/ns/istio-system/sa/istiod"}, code: codes.PermissionDenied},
+	}
+	for id, c := range testCases {
+		server := &Server{
+			ca: &mockca.FakeCA{
+				SignedCert:    []byte("cert"),
+				KeyCertBundle: util.NewKeyCertBundleFromPem(nil, nil, []byte("cert_chain"), []byte("root_cert")),
+			},
+			Authenticators: []security.Authenticator{&mockAuthenticator{identities: c.identities}},
+			Authorizer:     authorizer,
+			monitoring:     newMonitoringMetrics(),
+		}
+		_, err := server.CreateCertificate(context.Background(), &pb.IstioCertificateRequest{Csr: "dumb CSR"})
+		if code := status.Code(err); code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d): %v", id, c.code, code, err)
+		}
+	}
+}
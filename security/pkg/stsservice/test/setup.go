@@ -107,6 +107,7 @@ func SetupTest(t *testing.T, cb *xdsService.XDSCallbacks, testID uint16, enableC
 	}
 	// Set up test environment for Proxy
 	proxySetup := envoy.NewTestSetup(testID, t)
+	proxySetup.IstioOut = t.TempDir()
 	proxySetup.EnvoyTemplate = getDataFromFile(istioEnv.IstioSrc+"/security/pkg/stsservice/test/testdata/bootstrap.yaml", t)
 	// Set up credential files for bootstrap config
 	if err := WriteDataToFile(proxySetup.JWTTokenPath(), jwtToken); err != nil {
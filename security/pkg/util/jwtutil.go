@@ -23,6 +23,9 @@ import (
 	"time"
 )
 
+// maxJWTSize bounds the size of the tokens parsed.
+const maxJWTSize = 64 * 1024
+
 // GetExp returns token expiration time, or error on failures.
 func GetExp(token string) (time.Time, error) {
 	claims, err := parseJwtClaims(token)
@@ -101,6 +104,9 @@ func IsK8SUnbound(jwt string) bool {
 // ExtractJwtAud extracts the audiences from a JWT token. If aud cannot be parse, the bool will be set
 // to false. This distinguishes aud=[] from not parsed.
 func ExtractJwtAud(jwt string) ([]string, bool) {
+	if len(jwt) > maxJWTSize {
+		return nil, false
+	}
 	jwtSplit := strings.Split(jwt, ".")
 	if len(jwtSplit) != 3 {
 		return nil, false
@@ -122,6 +128,9 @@ func ExtractJwtAud(jwt string) ([]string, bool) {
 }
 
 func parseJwtClaims(token string) (map[string]interface{}, error) {
+	if len(token) > maxJWTSize {
+		return nil, fmt.Errorf("token exceeds %d bytes", maxJWTSize)
+	}
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("token contains an invalid number of segments: %d, expected: 3", len(parts))
@@ -17,6 +17,7 @@ package util
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -116,6 +117,9 @@ func TestGetAud(t *testing.T) {
 			jwt: twoAudList,
 			aud: []string{"abc", "xyz"},
 		},
+		"oversized token": {
+			jwt: twoAudList + strings.Repeat("a", maxJWTSize),
+		},
 	}
 
 	for id, tc := range testCases {
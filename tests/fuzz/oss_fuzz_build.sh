@@ -47,6 +47,11 @@ compile_go_fuzzer istio.io/istio/tests/fuzz FuzzNewBootstrapServer fuzz_new_boot
 compile_go_fuzzer istio.io/istio/tests/fuzz FuzzInmemoryKube fuzz_inmemory_kube
 compile_go_fuzzer istio.io/istio/tests/fuzz FuzzGenCSR fuzz_gen_csr
 compile_go_fuzzer istio.io/istio/tests/fuzz FuzzCreateCertE2EUsingClientCertAuthenticator fuzz_create_cert_e2e_using_client_cert_authenticator
+compile_go_fuzzer istio.io/istio/tests/fuzz FuzzExtractBearerToken fuzz_extract_bearer_token
+compile_go_fuzzer istio.io/istio/tests/fuzz FuzzExtractRequestToken fuzz_extract_request_token
+compile_go_fuzzer istio.io/istio/tests/fuzz FuzzJwtClaims fuzz_jwt_claims
+compile_go_fuzzer istio.io/istio/tests/fuzz FuzzParseCertificateChain fuzz_parse_certificate_chain
+compile_go_fuzzer istio.io/istio/tests/fuzz FuzzCSRResponse fuzz_csr_response
 
 # Create seed corpora:
 zip "${OUT}"/fuzz_analyzer_seed_corpus.zip "${SRC}"/istio/galley/pkg/config/analysis/analyzers/testdata/*.yaml
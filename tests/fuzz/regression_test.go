@@ -146,6 +146,11 @@ func TestFuzzers(t *testing.T) {
 		{"FuzzInmemoryKube", FuzzInmemoryKube},
 		{"FuzzGenCSR", FuzzGenCSR},
 		{"FuzzCreateCertE2EUsingClientCertAuthenticator", FuzzCreateCertE2EUsingClientCertAuthenticator},
+		{"FuzzExtractBearerToken", FuzzExtractBearerToken},
+		{"FuzzExtractRequestToken", FuzzExtractRequestToken},
+		{"FuzzJwtClaims", FuzzJwtClaims},
+		{"FuzzParseCertificateChain", FuzzParseCertificateChain},
+		{"FuzzCSRResponse", FuzzCSRResponse},
 	}
 	for _, tt := range cases {
 		if testedFuzzers.Contains(tt.name) {
@@ -21,17 +21,22 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"net"
+	"net/http"
 
 	fuzz "github.com/AdaLogics/go-fuzz-headers"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
 	pb "istio.io/api/security/v1alpha1"
 	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/cache"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	mockca "istio.io/istio/security/pkg/pki/ca/mock"
 	"istio.io/istio/security/pkg/pki/util"
 	"istio.io/istio/security/pkg/server/ca"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
+	secutil "istio.io/istio/security/pkg/util"
 )
 
 func FuzzGenCSR(data []byte) int {
@@ -131,3 +136,95 @@ func FuzzCreateCertE2EUsingClientCertAuthenticator(data []byte) int {
 	_, _ = server.CreateCertificate(ctx, request)
 	return 1
 }
+
+// fuzzedStrings returns up to max strings consumed from f.
+func fuzzedStrings(f *fuzz.ConsumeFuzzer, max int) ([]string, error) {
+	n, err := f.GetInt()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, n%max)
+	for i := 0; i < n%max; i++ {
+		value, err := f.GetString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func FuzzExtractBearerToken(data []byte) int {
+	f := fuzz.NewConsumer(data)
+	values, err := fuzzedStrings(f, 8)
+	if err != nil {
+		return 0
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{"authorization": values})
+	_, _ = security.ExtractBearerToken(ctx)
+	return 1
+}
+
+func FuzzExtractRequestToken(data []byte) int {
+	f := fuzz.NewConsumer(data)
+	values, err := fuzzedStrings(f, 8)
+	if err != nil {
+		return 0
+	}
+	req := &http.Request{Header: http.Header{"Authorization": values}}
+	_, _ = security.ExtractRequestToken(req)
+	return 1
+}
+
+func FuzzJwtClaims(data []byte) int {
+	token := string(data)
+	_, _ = secutil.GetExp(token)
+	_, _ = secutil.GetAud(token)
+	_, _ = secutil.ExtractJwtAud(token)
+	_ = secutil.IsK8SUnbound(token)
+	return 1
+}
+
+func FuzzParseCertificateChain(data []byte) int {
+	_, _ = util.ParsePemEncodedCertificateChain(data)
+	_, _ = util.ParsePemEncodedCertificate(data)
+	_, _ = nodeagentutil.ParseLeafCert(data)
+	_ = util.CheckCertAlgorithms(data, []string{"RSA"})
+	return 1
+}
+
+// fuzzedCAClient returns fuzzed CSR responses.
+type fuzzedCAClient struct {
+	chain  []string
+	bundle []string
+}
+
+func (c *fuzzedCAClient) CSRSign(context.Context, []byte, int64) ([]string, error) {
+	return c.chain, nil
+}
+
+func (c *fuzzedCAClient) GetRootCertBundle(context.Context) ([]string, error) {
+	return c.bundle, nil
+}
+
+func (c *fuzzedCAClient) Close() {}
+
+func FuzzCSRResponse(data []byte) int {
+	f := fuzz.NewConsumer(data)
+	chain, err := fuzzedStrings(f, 4)
+	if err != nil {
+		return 0
+	}
+	bundle, err := fuzzedStrings(f, 4)
+	if err != nil {
+		return 0
+	}
+	sc, err := cache.NewSecretManagerClient(&fuzzedCAClient{chain: chain, bundle: bundle},
+		&security.Options{ECCSigAlg: string(util.EcdsaSigAlg)})
+	if err != nil {
+		return 0
+	}
+	defer sc.Close()
+	_, _ = sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	return 1
+}